@@ -24,8 +24,13 @@ import (
 
 var (
 	httpListenAddr    = flag.String("httpListenAddr", ":8428", "TCP address to listen for http connections")
-	minScrapeInterval = flag.Duration("dedup.minScrapeInterval", 0, "Leave only the first sample in every time series per each discrete interval "+
-		"equal to -dedup.minScrapeInterval > 0. See https://docs.victoriametrics.com/#deduplication and https://docs.victoriametrics.com/#downsampling")
+	minScrapeInterval = flag.Duration("dedup.minScrapeInterval", 0, "Leave only a single sample in every time series per each discrete interval "+
+		"equal to -dedup.minScrapeInterval > 0. See also -dedup.strategy, https://docs.victoriametrics.com/#deduplication and https://docs.victoriametrics.com/#downsampling")
+	dedupStrategy = flag.String("dedup.strategy", "first", "The sample to leave per each -dedup.minScrapeInterval and -downsampling.period interval. "+
+		"Supported values: first, last, min, max, avg. Note that avg is approximate for samples ingested with delays, since it is applied during background merges. "+
+		"See https://docs.victoriametrics.com/#deduplication")
+	downsamplingPeriods = flagutil.NewArray("downsampling.period", "Comma-separated downsampling periods in the format 'offset:period'. For example, '30d:10m' instructs "+
+		"to leave a single sample per 10 minutes for samples older than 30 days. See https://docs.victoriametrics.com/#downsampling for details")
 	dryRun = flag.Bool("dryRun", false, "Whether to check only -promscrape.config and then exit. "+
 		"Unknown config entries aren't allowed in -promscrape.config by default. This can be changed with -promscrape.config.strictParse=false command-line flag")
 )
@@ -52,6 +57,14 @@ func main() {
 	logger.Infof("starting VictoriaMetrics at %q...", *httpListenAddr)
 	startTime := time.Now()
 	storage.SetDedupInterval(*minScrapeInterval)
+	if err := storage.SetDedupStrategy(*dedupStrategy); err != nil {
+		logger.Fatalf("invalid -dedup.strategy: %s", err)
+	}
+	dps, err := storage.ParseDownsamplingPeriods(*downsamplingPeriods)
+	if err != nil {
+		logger.Fatalf("cannot parse -downsampling.period: %s", err)
+	}
+	storage.SetDownsamplingPeriods(dps)
 	vmstorage.Init(promql.ResetRollupResultCacheIfNeeded)
 	vmselect.Init()
 	vminsert.Init()
@@ -82,7 +82,7 @@ func selfScraper(scrapeInterval time.Duration) {
 			}
 			mr := &mrs[len(mrs)-1]
 			mr.MetricNameRaw = storage.MarshalMetricNameRaw(mr.MetricNameRaw[:0], labels)
-			mr.Timestamp = currentTimestamp
+			mr.Timestamp = storage.TimestampFromMsecs(currentTimestamp)
 			mr.Value = r.Value
 		}
 		vmstorage.AddRows(mrs)
@@ -30,7 +30,7 @@ func InsertHandler(at *auth.Token, req *http.Request) error {
 		return err
 	}
 	return writeconcurrencylimiter.Do(func() error {
-		return parser.ParseStream(req.Body, func(tss []prompb.TimeSeries) error {
+		return parser.ParseStream(req.Body, func(tss []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
 			return insertRows(at, tss, extraLabels)
 		})
 	})
@@ -39,7 +39,7 @@ func InsertHandler(at *auth.Token, req *http.Request) error {
 // InsertHandlerForReader processes metrics from given reader
 func InsertHandlerForReader(at *auth.Token, r io.Reader) error {
 	return writeconcurrencylimiter.Do(func() error {
-		return parser.ParseStream(r, func(tss []prompb.TimeSeries) error {
+		return parser.ParseStream(r, func(tss []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
 			return insertRows(at, tss, nil)
 		})
 	})
@@ -53,6 +53,7 @@ func insertRows(at *auth.Token, timeseries []prompb.TimeSeries, extraLabels []pr
 	tssDst := ctx.WriteRequest.Timeseries[:0]
 	labels := ctx.Labels[:0]
 	samples := ctx.Samples[:0]
+	exemplars := ctx.Exemplars[:0]
 	for i := range timeseries {
 		ts := &timeseries[i]
 		rowsTotal += len(ts.Samples)
@@ -73,14 +74,34 @@ func insertRows(at *auth.Token, timeseries []prompb.TimeSeries, extraLabels []pr
 				Timestamp: sample.Timestamp,
 			})
 		}
+		seriesLabels := labels[labelsLen:]
+		exemplarsLen := len(exemplars)
+		for i := range ts.Exemplars {
+			e := &ts.Exemplars[i]
+			labelsLen = len(labels)
+			for j := range e.Labels {
+				label := &e.Labels[j]
+				labels = append(labels, prompbmarshal.Label{
+					Name:  bytesutil.ToUnsafeString(label.Name),
+					Value: bytesutil.ToUnsafeString(label.Value),
+				})
+			}
+			exemplars = append(exemplars, prompbmarshal.Exemplar{
+				Labels:    labels[labelsLen:],
+				Value:     e.Value,
+				Timestamp: e.Timestamp,
+			})
+		}
 		tssDst = append(tssDst, prompbmarshal.TimeSeries{
-			Labels:  labels[labelsLen:],
-			Samples: samples[samplesLen:],
+			Labels:    seriesLabels,
+			Samples:   samples[samplesLen:],
+			Exemplars: exemplars[exemplarsLen:],
 		})
 	}
 	ctx.WriteRequest.Timeseries = tssDst
 	ctx.Labels = labels
 	ctx.Samples = samples
+	ctx.Exemplars = exemplars
 	remotewrite.PushWithAuthToken(at, &ctx.WriteRequest)
 	rowsInserted.Add(rowsTotal)
 	if at != nil {
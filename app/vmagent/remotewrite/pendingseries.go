@@ -97,9 +97,10 @@ type writeRequest struct {
 
 	tss []prompbmarshal.TimeSeries
 
-	labels  []prompbmarshal.Label
-	samples []prompbmarshal.Sample
-	buf     []byte
+	labels    []prompbmarshal.Label
+	samples   []prompbmarshal.Sample
+	exemplars []prompbmarshal.Exemplar
+	buf       []byte
 }
 
 func (wr *writeRequest) reset() {
@@ -111,6 +112,7 @@ func (wr *writeRequest) reset() {
 		ts := &wr.tss[i]
 		ts.Labels = nil
 		ts.Samples = nil
+		ts.Exemplars = nil
 	}
 	wr.tss = wr.tss[:0]
 
@@ -118,6 +120,12 @@ func (wr *writeRequest) reset() {
 	wr.labels = wr.labels[:0]
 
 	wr.samples = wr.samples[:0]
+
+	for i := range wr.exemplars {
+		wr.exemplars[i].Labels = nil
+	}
+	wr.exemplars = wr.exemplars[:0]
+
 	wr.buf = wr.buf[:0]
 }
 
@@ -167,26 +175,48 @@ func (wr *writeRequest) copyTimeSeries(dst, src *prompbmarshal.TimeSeries) {
 	labelsLen := len(wr.labels)
 	samplesDst := wr.samples
 	buf := wr.buf
-	for i := range src.Labels {
-		labelsDst = append(labelsDst, prompbmarshal.Label{})
-		dstLabel := &labelsDst[len(labelsDst)-1]
-		srcLabel := &src.Labels[i]
-
-		buf = append(buf, srcLabel.Name...)
-		dstLabel.Name = bytesutil.ToUnsafeString(buf[len(buf)-len(srcLabel.Name):])
-		buf = append(buf, srcLabel.Value...)
-		dstLabel.Value = bytesutil.ToUnsafeString(buf[len(buf)-len(srcLabel.Value):])
-	}
+	labelsDst, buf = copyLabels(labelsDst, buf, src.Labels)
 	dst.Labels = labelsDst[labelsLen:]
 
 	samplesDst = append(samplesDst, src.Samples...)
 	dst.Samples = samplesDst[len(samplesDst)-len(src.Samples):]
 
+	if len(src.Exemplars) > 0 {
+		exemplarsDst := wr.exemplars
+		exemplarsLen := len(exemplarsDst)
+		for i := range src.Exemplars {
+			srcExemplar := &src.Exemplars[i]
+			labelsLen = len(labelsDst)
+			labelsDst, buf = copyLabels(labelsDst, buf, srcExemplar.Labels)
+			exemplarsDst = append(exemplarsDst, prompbmarshal.Exemplar{
+				Labels:    labelsDst[labelsLen:],
+				Value:     srcExemplar.Value,
+				Timestamp: srcExemplar.Timestamp,
+			})
+		}
+		dst.Exemplars = exemplarsDst[exemplarsLen:]
+		wr.exemplars = exemplarsDst
+	}
+
 	wr.samples = samplesDst
 	wr.labels = labelsDst
 	wr.buf = buf
 }
 
+func copyLabels(dst []prompbmarshal.Label, buf []byte, src []prompbmarshal.Label) ([]prompbmarshal.Label, []byte) {
+	for i := range src {
+		dst = append(dst, prompbmarshal.Label{})
+		dstLabel := &dst[len(dst)-1]
+		srcLabel := &src[i]
+
+		buf = append(buf, srcLabel.Name...)
+		dstLabel.Name = bytesutil.ToUnsafeString(buf[len(buf)-len(srcLabel.Name):])
+		buf = append(buf, srcLabel.Value...)
+		dstLabel.Value = bytesutil.ToUnsafeString(buf[len(buf)-len(srcLabel.Value):])
+	}
+	return dst, buf
+}
+
 func pushWriteRequest(wr *prompbmarshal.WriteRequest, pushBlock func(block []byte)) {
 	if len(wr.Timeseries) == 0 {
 		// Nothing to push
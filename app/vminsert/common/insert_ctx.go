@@ -19,6 +19,9 @@ type InsertCtx struct {
 	mrs            []storage.MetricRow
 	metricNamesBuf []byte
 
+	ers          []storage.ExemplarRow
+	exemplarTags []storage.Tag
+
 	relabelCtx relabel.Ctx
 }
 
@@ -41,6 +44,20 @@ func (ctx *InsertCtx) Reset(rowsLen int) {
 	}
 	ctx.mrs = ctx.mrs[:0]
 	ctx.metricNamesBuf = ctx.metricNamesBuf[:0]
+
+	for i := range ctx.ers {
+		er := &ctx.ers[i]
+		er.MetricNameRaw = nil
+		er.Exemplar.Labels = nil
+	}
+	ctx.ers = ctx.ers[:0]
+	for i := range ctx.exemplarTags {
+		tag := &ctx.exemplarTags[i]
+		tag.Key = nil
+		tag.Value = nil
+	}
+	ctx.exemplarTags = ctx.exemplarTags[:0]
+
 	ctx.relabelCtx.Reset()
 }
 
@@ -53,19 +70,30 @@ func (ctx *InsertCtx) marshalMetricNameRaw(prefix []byte, labels []prompb.Label)
 }
 
 // WriteDataPoint writes (timestamp, value) with the given prefix and labels into ctx buffer.
+//
+// timestamp must be in milliseconds.
 func (ctx *InsertCtx) WriteDataPoint(prefix []byte, labels []prompb.Label, timestamp int64, value float64) error {
+	return ctx.WriteRawDataPoint(prefix, labels, storage.TimestampFromMsecs(timestamp), value)
+}
+
+// WriteRawDataPoint writes (timestamp, value) with the given prefix and labels into ctx buffer.
+//
+// timestamp must be in the storage precision. See storage.TimestampsPerMsec.
+func (ctx *InsertCtx) WriteRawDataPoint(prefix []byte, labels []prompb.Label, timestamp int64, value float64) error {
 	metricNameRaw := ctx.marshalMetricNameRaw(prefix, labels)
 	return ctx.addRow(metricNameRaw, timestamp, value)
 }
 
 // WriteDataPointExt writes (timestamp, value) with the given metricNameRaw and labels into ctx buffer.
 //
+// timestamp must be in milliseconds.
+//
 // It returns metricNameRaw for the given labels if len(metricNameRaw) == 0.
 func (ctx *InsertCtx) WriteDataPointExt(metricNameRaw []byte, labels []prompb.Label, timestamp int64, value float64) ([]byte, error) {
 	if len(metricNameRaw) == 0 {
 		metricNameRaw = ctx.marshalMetricNameRaw(nil, labels)
 	}
-	err := ctx.addRow(metricNameRaw, timestamp, value)
+	err := ctx.addRow(metricNameRaw, storage.TimestampFromMsecs(timestamp), value)
 	return metricNameRaw, err
 }
 
@@ -89,6 +117,35 @@ func (ctx *InsertCtx) addRow(metricNameRaw []byte, timestamp int64, value float6
 	return nil
 }
 
+// AddExemplar adds exemplar with the given exemplarLabels, value and timestamp for the time series with the given metricNameRaw and labels.
+//
+// exemplarLabels contents must exist until FlushBufs is called.
+//
+// It returns metricNameRaw for the given labels if len(metricNameRaw) == 0.
+func (ctx *InsertCtx) AddExemplar(metricNameRaw []byte, labels, exemplarLabels []prompb.Label, value float64, timestamp int64) []byte {
+	if len(metricNameRaw) == 0 {
+		metricNameRaw = ctx.marshalMetricNameRaw(nil, labels)
+	}
+	tagsLen := len(ctx.exemplarTags)
+	for i := range exemplarLabels {
+		label := &exemplarLabels[i]
+		ctx.exemplarTags = append(ctx.exemplarTags, storage.Tag{
+			// Do not copy name and value contents for performance reasons.
+			Key:   label.Name,
+			Value: label.Value,
+		})
+	}
+	ctx.ers = append(ctx.ers, storage.ExemplarRow{
+		MetricNameRaw: metricNameRaw,
+		Exemplar: storage.Exemplar{
+			Labels:    ctx.exemplarTags[tagsLen:],
+			Value:     value,
+			Timestamp: timestamp,
+		},
+	})
+	return metricNameRaw
+}
+
 // AddLabelBytes adds (name, value) label to ctx.Labels.
 //
 // name and value must exist until ctx.Labels is used.
@@ -133,6 +190,9 @@ func (ctx *InsertCtx) ApplyRelabeling() {
 // FlushBufs flushes buffered rows to the underlying storage.
 func (ctx *InsertCtx) FlushBufs() error {
 	err := vmstorage.AddRows(ctx.mrs)
+	if err == nil && len(ctx.ers) > 0 {
+		err = vmstorage.AddExemplars(ctx.ers)
+	}
 	ctx.Reset(0)
 	if err == nil {
 		return nil
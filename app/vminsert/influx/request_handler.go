@@ -119,7 +119,7 @@ func insertRows(db string, rows []parser.Row, extraLabels []prompbmarshal.Label)
 					continue
 				}
 				ic.SortLabelsIfNeeded()
-				if err := ic.WriteDataPoint(nil, ic.Labels, r.Timestamp, f.Value); err != nil {
+				if err := ic.WriteRawDataPoint(nil, ic.Labels, r.Timestamp, f.Value); err != nil {
 					return err
 				}
 			}
@@ -139,7 +139,7 @@ func insertRows(db string, rows []parser.Row, extraLabels []prompbmarshal.Label)
 					// Skip metric without labels.
 					continue
 				}
-				if err := ic.WriteDataPoint(ctx.metricNameBuf, ic.Labels[len(ic.Labels)-1:], r.Timestamp, f.Value); err != nil {
+				if err := ic.WriteRawDataPoint(ctx.metricNameBuf, ic.Labels[len(ic.Labels)-1:], r.Timestamp, f.Value); err != nil {
 					return err
 				}
 			}
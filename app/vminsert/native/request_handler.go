@@ -74,7 +74,7 @@ func insertRows(block *parser.Block, extraLabels []prompbmarshal.Label) error {
 	}
 	for j, value := range values {
 		timestamp := timestamps[j]
-		if err := ic.WriteDataPoint(ctx.metricNameBuf, nil, timestamp, value); err != nil {
+		if err := ic.WriteRawDataPoint(ctx.metricNameBuf, nil, timestamp, value); err != nil {
 			return err
 		}
 	}
@@ -2,8 +2,12 @@ package prompush
 
 import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metrics"
 )
 
@@ -16,6 +20,8 @@ const maxRowsPerBlock = 10000
 
 // Push pushes wr to storage.
 func Push(wr *prompbmarshal.WriteRequest) {
+	pushMetadata(wr.Metadata)
+
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
 
@@ -42,6 +48,25 @@ func Push(wr *prompbmarshal.WriteRequest) {
 	}
 }
 
+func pushMetadata(mms []prompbmarshal.MetricMetadata) {
+	if len(mms) == 0 {
+		return
+	}
+	dst := make([]storage.MetricMetadata, len(mms))
+	for i := range mms {
+		mm := &mms[i]
+		dst[i] = storage.MetricMetadata{
+			MetricFamilyName: mm.MetricFamilyName,
+			Type:             mm.Type.String(),
+			Help:             mm.Help,
+			Unit:             mm.Unit,
+		}
+	}
+	if err := vmstorage.AddMetricMetadata(dst); err != nil {
+		logger.Errorf("cannot write promscrape metadata to storage: %s", err)
+	}
+}
+
 func push(ctx *common.InsertCtx, tss []prompbmarshal.TimeSeries) {
 	rowsLen := 0
 	for i := range tss {
@@ -49,6 +74,7 @@ func push(ctx *common.InsertCtx, tss []prompbmarshal.TimeSeries) {
 	}
 	ctx.Reset(rowsLen)
 	rowsTotal := 0
+	var exemplarLabels []prompb.Label
 	for i := range tss {
 		ts := &tss[i]
 		rowsTotal += len(ts.Samples)
@@ -65,6 +91,18 @@ func push(ctx *common.InsertCtx, tss []prompbmarshal.TimeSeries) {
 		ctx.SortLabelsIfNeeded()
 		var metricNameRaw []byte
 		var err error
+		for i := range ts.Exemplars {
+			e := &ts.Exemplars[i]
+			exemplarLabels = exemplarLabels[:0]
+			for j := range e.Labels {
+				label := &e.Labels[j]
+				exemplarLabels = append(exemplarLabels, prompb.Label{
+					Name:  bytesutil.ToUnsafeBytes(label.Name),
+					Value: bytesutil.ToUnsafeBytes(label.Value),
+				})
+			}
+			metricNameRaw = ctx.AddExemplar(metricNameRaw, ctx.Labels, exemplarLabels, e.Value, e.Timestamp)
+		}
 		for i := range ts.Samples {
 			r := &ts.Samples[i]
 			metricNameRaw, err = ctx.WriteDataPointExt(metricNameRaw, ctx.Labels, r.Timestamp, r.Value)
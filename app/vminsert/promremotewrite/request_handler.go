@@ -5,10 +5,13 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	parserCommon "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/promremotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
 	"github.com/VictoriaMetrics/metrics"
 )
@@ -25,12 +28,32 @@ func InsertHandler(req *http.Request) error {
 		return err
 	}
 	return writeconcurrencylimiter.Do(func() error {
-		return parser.ParseStream(req.Body, func(tss []prompb.TimeSeries) error {
+		return parser.ParseStream(req.Body, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
+			if err := insertMetadata(mms); err != nil {
+				return err
+			}
 			return insertRows(tss, extraLabels)
 		})
 	})
 }
 
+func insertMetadata(mms []prompb.MetricMetadata) error {
+	if len(mms) == 0 {
+		return nil
+	}
+	dst := make([]storage.MetricMetadata, len(mms))
+	for i := range mms {
+		mm := &mms[i]
+		dst[i] = storage.MetricMetadata{
+			MetricFamilyName: bytesutil.ToUnsafeString(mm.MetricFamilyName),
+			Type:             mm.Type.String(),
+			Help:             bytesutil.ToUnsafeString(mm.Help),
+			Unit:             bytesutil.ToUnsafeString(mm.Unit),
+		}
+	}
+	return vmstorage.AddMetricMetadata(dst)
+}
+
 func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompbmarshal.Label) error {
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
@@ -64,6 +87,10 @@ func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompbmarshal.Labe
 		ctx.SortLabelsIfNeeded()
 		var metricNameRaw []byte
 		var err error
+		for i := range ts.Exemplars {
+			e := &ts.Exemplars[i]
+			metricNameRaw = ctx.AddExemplar(metricNameRaw, ctx.Labels, e.Labels, e.Value, e.Timestamp)
+		}
 		samples := ts.Samples
 		for i := range samples {
 			r := &samples[i]
@@ -0,0 +1,209 @@
+package graphite
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// aggrFunc calculates a single value from values.
+//
+// NaN values must be ignored. NaN must be returned if values contain no non-NaN values.
+type aggrFunc func(values []float64) float64
+
+var aggrFuncs = map[string]aggrFunc{
+	"average":  aggrAvg,
+	"avg":      aggrAvg,
+	"avg_zero": aggrAvgZero,
+	"count":    aggrCount,
+	"diff":     aggrDiff,
+	"first":    aggrFirst,
+	"last":     aggrLast,
+	"current":  aggrLast,
+	"max":      aggrMax,
+	"median":   aggrMedian,
+	"min":      aggrMin,
+	"multiply": aggrMultiply,
+	"range":    aggrRange,
+	"rangeOf":  aggrRange,
+	"stddev":   aggrStddev,
+	"sum":      aggrSum,
+	"total":    aggrSum,
+}
+
+func getAggrFunc(name string) (aggrFunc, error) {
+	// Graphite allows passing function names such as `sumSeries` instead of `sum`.
+	name = strings.TrimSuffix(name, "Series")
+	af, ok := aggrFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported aggregate function %q", name)
+	}
+	return af, nil
+}
+
+func aggrAvg(values []float64) float64 {
+	sum := float64(0)
+	n := 0
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		sum += v
+		n++
+	}
+	if n == 0 {
+		return nan
+	}
+	return sum / float64(n)
+}
+
+func aggrAvgZero(values []float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	sum := float64(0)
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			sum += v
+		}
+	}
+	return sum / float64(len(values))
+}
+
+func aggrCount(values []float64) float64 {
+	n := 0
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			n++
+		}
+	}
+	if n == 0 {
+		return nan
+	}
+	return float64(n)
+}
+
+func aggrDiff(values []float64) float64 {
+	result := nan
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if math.IsNaN(result) {
+			result = v
+		} else {
+			result -= v
+		}
+	}
+	return result
+}
+
+func aggrFirst(values []float64) float64 {
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			return v
+		}
+	}
+	return nan
+}
+
+func aggrLast(values []float64) float64 {
+	for i := len(values) - 1; i >= 0; i-- {
+		if v := values[i]; !math.IsNaN(v) {
+			return v
+		}
+	}
+	return nan
+}
+
+func aggrMax(values []float64) float64 {
+	result := nan
+	for _, v := range values {
+		if math.IsNaN(result) || v > result {
+			result = v
+		}
+	}
+	return result
+}
+
+func aggrMin(values []float64) float64 {
+	result := nan
+	for _, v := range values {
+		if math.IsNaN(result) || v < result {
+			result = v
+		}
+	}
+	return result
+}
+
+func aggrMedian(values []float64) float64 {
+	a := make([]float64, 0, len(values))
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			a = append(a, v)
+		}
+	}
+	if len(a) == 0 {
+		return nan
+	}
+	sort.Float64s(a)
+	n := len(a) / 2
+	if len(a)%2 == 1 {
+		return a[n]
+	}
+	return (a[n-1] + a[n]) / 2
+}
+
+func aggrMultiply(values []float64) float64 {
+	result := nan
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if math.IsNaN(result) {
+			result = v
+		} else {
+			result *= v
+		}
+	}
+	return result
+}
+
+func aggrRange(values []float64) float64 {
+	return aggrMax(values) - aggrMin(values)
+}
+
+func aggrStddev(values []float64) float64 {
+	avg := aggrAvg(values)
+	if math.IsNaN(avg) {
+		return nan
+	}
+	sum := float64(0)
+	n := 0
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		d := v - avg
+		sum += d * d
+		n++
+	}
+	return math.Sqrt(sum / float64(n))
+}
+
+func aggrSum(values []float64) float64 {
+	sum := float64(0)
+	n := 0
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		sum += v
+		n++
+	}
+	if n == 0 {
+		return nan
+	}
+	return sum
+}
@@ -0,0 +1,514 @@
+package graphite
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/graphiteql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// evalConfig is the configuration for evaluating Graphite target expressions.
+type evalConfig struct {
+	// startTime and endTime are the timestamps in milliseconds for the first and the last point in the returned series.
+	// Both timestamps are aligned to storageStep.
+	startTime int64
+	endTime   int64
+
+	// storageStep is the interval in milliseconds between points of the series fetched from the storage.
+	storageStep int64
+
+	deadline searchutils.Deadline
+
+	// etfs contains extra tag filters from `extra_label` and `extra_filters[]` query args.
+	etfs [][]storage.TagFilter
+}
+
+// withTimeRange returns a copy of ec with the time range moved to the given start and end timestamps.
+func (ec *evalConfig) withTimeRange(start, end int64) *evalConfig {
+	ecCopy := *ec
+	ecCopy.startTime = start - start%ec.storageStep
+	ecCopy.endTime = end - end%ec.storageStep
+	return &ecCopy
+}
+
+// series is a single time series returned from Graphite target evaluation.
+type series struct {
+	// Name is the series name returned as `target` in render API responses.
+	Name string
+
+	// Tags contains series tags including `name` tag.
+	Tags map[string]string
+
+	// Timestamps contains timestamps in milliseconds for Values.
+	// Timestamps are evenly spaced with the step interval.
+	Timestamps []int64
+
+	// Values contains series values. NaN value means missing point.
+	Values []float64
+
+	// pathExpression is the expression used for selecting the series.
+	// It is used for building names for aggregate functions such as sumSeries.
+	pathExpression string
+
+	// consolidateFunc is the function used for consolidating points when the number of points exceeds maxDataPoints.
+	consolidateFunc aggrFunc
+
+	step int64
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	m := make(map[string]string, len(tags))
+	for k, v := range tags {
+		m[k] = v
+	}
+	return m
+}
+
+// consolidate reduces the number of points in s to maxDataPoints with s.consolidateFunc.
+//
+// See https://graphite.readthedocs.io/en/stable/render_api.html#maxdatapoints
+func (s *series) consolidate(maxDataPoints int) {
+	if len(s.Values) <= maxDataPoints || maxDataPoints <= 0 {
+		return
+	}
+	pointsPerBucket := (len(s.Values) + maxDataPoints - 1) / maxDataPoints
+	cf := s.consolidateFunc
+	if cf == nil {
+		cf = aggrAvg
+	}
+	// Allocate new slices, since s.Timestamps may be shared with other series.
+	dstValues := make([]float64, 0, maxDataPoints)
+	dstTimestamps := make([]int64, 0, maxDataPoints)
+	for i := 0; i < len(s.Values); i += pointsPerBucket {
+		j := i + pointsPerBucket
+		if j > len(s.Values) {
+			j = len(s.Values)
+		}
+		timestamp := s.Timestamps[i]
+		v := cf(s.Values[i:j])
+		dstValues = append(dstValues, v)
+		dstTimestamps = append(dstTimestamps, timestamp)
+	}
+	s.Values = dstValues
+	s.Timestamps = dstTimestamps
+	s.step *= int64(pointsPerBucket)
+}
+
+func evalExpr(ec *evalConfig, expr graphiteql.Expr) ([]*series, error) {
+	switch t := expr.(type) {
+	case *graphiteql.MetricExpr:
+		return evalMetricExpr(ec, t.Query)
+	case *graphiteql.FuncExpr:
+		tf, ok := transformFuncs[strings.ToLower(t.FuncName)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported function %q", t.FuncName)
+		}
+		ss, err := tf(ec, t)
+		if err != nil {
+			return nil, fmt.Errorf("cannot evaluate %q: %w", t.AppendString(nil), err)
+		}
+		return ss, nil
+	default:
+		return nil, fmt.Errorf("unexpected expression type %T: %q; expecting series list", expr, expr.AppendString(nil))
+	}
+}
+
+func evalMetricExpr(ec *evalConfig, query string) ([]*series, error) {
+	tf := storage.TagFilter{
+		Value: []byte(query),
+	}
+	if strings.ContainsAny(query, "*[{") {
+		tf.Key = []byte("__graphite__")
+	}
+	return fetchSeries(ec, []storage.TagFilter{tf}, query)
+}
+
+func fetchSeries(ec *evalConfig, tfs []storage.TagFilter, pathExpression string) ([]*series, error) {
+	tfss := joinTagFilterss(tfs, ec.etfs)
+	// Fetch the data for the whole interval of the last point.
+	sq := storage.NewSearchQuery(ec.startTime, ec.endTime+ec.storageStep-1, tfss)
+	rss, err := netstorage.ProcessSearchQuery(nil, sq, true, ec.deadline)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch data for %q: %w", sq, err)
+	}
+	var ssLock sync.Mutex
+	var ss []*series
+	err = rss.RunParallel(nil, func(rs *netstorage.Result, workerID uint) error {
+		s := newSeriesFromResult(ec, rs, pathExpression)
+		ssLock.Lock()
+		ss = append(ss, s)
+		ssLock.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error when fetching data for %q: %w", sq, err)
+	}
+	// Return series in stable order.
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].Name < ss[j].Name
+	})
+	return ss, nil
+}
+
+func newSeriesFromResult(ec *evalConfig, rs *netstorage.Result, pathExpression string) *series {
+	mn := &rs.MetricName
+	tags := make(map[string]string, len(mn.Tags)+1)
+	tags["name"] = string(mn.MetricGroup)
+	for _, tag := range mn.Tags {
+		tags[string(tag.Key)] = string(tag.Value)
+	}
+	name := string(mn.MetricGroup)
+	if len(mn.Tags) > 0 {
+		name = getCanonicalPath(mn)
+	}
+	timestamps := getTimestamps(ec.startTime, ec.endTime, ec.storageStep)
+	values := normalizeValues(timestamps, ec.storageStep, rs.Timestamps, rs.Values)
+	return &series{
+		Name:            name,
+		Tags:            tags,
+		Timestamps:      timestamps,
+		Values:          values,
+		pathExpression:  pathExpression,
+		consolidateFunc: aggrAvg,
+		step:            ec.storageStep,
+	}
+}
+
+func getTimestamps(start, end, step int64) []int64 {
+	timestamps := make([]int64, 0, (end-start)/step+1)
+	for ts := start; ts <= end; ts += step {
+		timestamps = append(timestamps, ts)
+	}
+	return timestamps
+}
+
+// normalizeValues returns values for the given timestamps from raw samples srcTimestamps and srcValues.
+//
+// The value for each timestamp is calculated as an average of raw samples on the [timestamp ... timestamp+step) interval.
+// NaN is returned for timestamps without raw samples.
+func normalizeValues(timestamps []int64, step int64, srcTimestamps []int64, srcValues []float64) []float64 {
+	values := make([]float64, len(timestamps))
+	i := 0
+	for j, ts := range timestamps {
+		for i < len(srcTimestamps) && srcTimestamps[i] < ts {
+			i++
+		}
+		sum := float64(0)
+		n := 0
+		for i < len(srcTimestamps) && srcTimestamps[i] < ts+step {
+			sum += srcValues[i]
+			n++
+			i++
+		}
+		if n == 0 {
+			values[j] = nan
+		} else {
+			values[j] = sum / float64(n)
+		}
+	}
+	return values
+}
+
+// resample returns s values for the given timestamps with the given step.
+//
+// Points from s are consolidated with s.consolidateFunc into [timestamp ... timestamp+step) intervals.
+func (s *series) resample(timestamps []int64, step int64) []float64 {
+	cf := s.consolidateFunc
+	if cf == nil {
+		cf = aggrAvg
+	}
+	values := make([]float64, len(timestamps))
+	var buf []float64
+	i := 0
+	for j, ts := range timestamps {
+		for i < len(s.Timestamps) && s.Timestamps[i] < ts {
+			i++
+		}
+		buf = buf[:0]
+		for i < len(s.Timestamps) && s.Timestamps[i] < ts+step {
+			buf = append(buf, s.Values[i])
+			i++
+		}
+		values[j] = cf(buf)
+	}
+	return values
+}
+
+// normalizeSeries returns common timestamps and step for ss.
+//
+// Values for series with distinct timestamps are re-sampled to the returned timestamps.
+func normalizeSeries(ss []*series) ([]int64, int64) {
+	if len(ss) == 0 {
+		return nil, 0
+	}
+	timestamps := ss[0].Timestamps
+	step := ss[0].step
+	needResample := false
+	for _, s := range ss[1:] {
+		if s.step != step || !equalTimestamps(s.Timestamps, timestamps) {
+			needResample = true
+			break
+		}
+	}
+	if !needResample {
+		return timestamps, step
+	}
+	minTimestamp := int64(math.MaxInt64)
+	maxTimestamp := int64(math.MinInt64)
+	for _, s := range ss {
+		step = lcm(step, s.step)
+		if len(s.Timestamps) == 0 {
+			continue
+		}
+		if s.Timestamps[0] < minTimestamp {
+			minTimestamp = s.Timestamps[0]
+		}
+		if ts := s.Timestamps[len(s.Timestamps)-1]; ts > maxTimestamp {
+			maxTimestamp = ts
+		}
+	}
+	if minTimestamp > maxTimestamp {
+		return nil, step
+	}
+	timestamps = getTimestamps(minTimestamp-minTimestamp%step, maxTimestamp-maxTimestamp%step, step)
+	for _, s := range ss {
+		s.Values = s.resample(timestamps, step)
+		s.Timestamps = timestamps
+		s.step = step
+	}
+	return timestamps, step
+}
+
+func equalTimestamps(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func lcm(a, b int64) int64 {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	return a / x * b
+}
+
+var nan = math.NaN()
+
+// getArg returns function arg with the given name or at the given position.
+//
+// nil is returned if the arg is missing.
+func getArg(args []*graphiteql.ArgExpr, name string, pos int) *graphiteql.ArgExpr {
+	for _, arg := range args {
+		if arg.Name == name {
+			return arg
+		}
+	}
+	if pos < len(args) && args[pos].Name == "" {
+		return args[pos]
+	}
+	return nil
+}
+
+func getSeriesArg(ec *evalConfig, args []*graphiteql.ArgExpr, name string, pos int) ([]*series, error) {
+	arg := getArg(args, name, pos)
+	if arg == nil {
+		return nil, fmt.Errorf("missing %q arg", name)
+	}
+	return evalExpr(ec, arg.Expr)
+}
+
+// getSeriesArgs evaluates all the positional args starting from pos as series lists and returns the concatenated result.
+func getSeriesArgs(ec *evalConfig, args []*graphiteql.ArgExpr, pos int) ([]*series, error) {
+	var ss []*series
+	for i := pos; i < len(args); i++ {
+		arg := args[i]
+		if arg.Name != "" {
+			return nil, fmt.Errorf("unexpected named arg %q; expecting only positional series args", arg.Name)
+		}
+		ssLocal, err := evalExpr(ec, arg.Expr)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, ssLocal...)
+	}
+	return ss, nil
+}
+
+func getNumberArg(args []*graphiteql.ArgExpr, name string, pos int) (float64, error) {
+	arg := getArg(args, name, pos)
+	if arg == nil {
+		return 0, fmt.Errorf("missing %q arg", name)
+	}
+	return exprToNumber(name, arg.Expr)
+}
+
+func getOptionalNumberArg(args []*graphiteql.ArgExpr, name string, pos int, defaultValue float64) (float64, error) {
+	arg := getArg(args, name, pos)
+	if arg == nil {
+		return defaultValue, nil
+	}
+	if _, ok := arg.Expr.(*graphiteql.NoneExpr); ok {
+		return defaultValue, nil
+	}
+	return exprToNumber(name, arg.Expr)
+}
+
+func exprToNumber(name string, expr graphiteql.Expr) (float64, error) {
+	ne, ok := expr.(*graphiteql.NumberExpr)
+	if !ok {
+		return 0, fmt.Errorf("arg %q must be a number; got %q", name, expr.AppendString(nil))
+	}
+	return ne.N, nil
+}
+
+func getIntArg(args []*graphiteql.ArgExpr, name string, pos int) (int, error) {
+	n, err := getNumberArg(args, name, pos)
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func getStringArg(args []*graphiteql.ArgExpr, name string, pos int) (string, error) {
+	arg := getArg(args, name, pos)
+	if arg == nil {
+		return "", fmt.Errorf("missing %q arg", name)
+	}
+	se, ok := arg.Expr.(*graphiteql.StringExpr)
+	if !ok {
+		return "", fmt.Errorf("arg %q must be a string; got %q", name, arg.Expr.AppendString(nil))
+	}
+	return se.S, nil
+}
+
+func getOptionalStringArg(args []*graphiteql.ArgExpr, name string, pos int, defaultValue string) (string, error) {
+	arg := getArg(args, name, pos)
+	if arg == nil {
+		return defaultValue, nil
+	}
+	if _, ok := arg.Expr.(*graphiteql.NoneExpr); ok {
+		return defaultValue, nil
+	}
+	return getStringArg(args, name, pos)
+}
+
+func getOptionalBoolArg(args []*graphiteql.ArgExpr, name string, pos int, defaultValue bool) (bool, error) {
+	arg := getArg(args, name, pos)
+	if arg == nil {
+		return defaultValue, nil
+	}
+	be, ok := arg.Expr.(*graphiteql.BoolExpr)
+	if !ok {
+		return false, fmt.Errorf("arg %q must be a bool; got %q", name, arg.Expr.AppendString(nil))
+	}
+	return be.B, nil
+}
+
+// getNodeArgs returns node args starting from pos.
+//
+// Each node can be either an integer index of the path node or a tag name.
+func getNodeArgs(args []*graphiteql.ArgExpr, pos int) ([]graphiteql.Expr, error) {
+	var nodes []graphiteql.Expr
+	for i := pos; i < len(args); i++ {
+		expr := args[i].Expr
+		switch expr.(type) {
+		case *graphiteql.NumberExpr, *graphiteql.StringExpr:
+		default:
+			return nil, fmt.Errorf("node must be either an integer or a tag name; got %q", expr.AppendString(nil))
+		}
+		nodes = append(nodes, expr)
+	}
+	return nodes, nil
+}
+
+// getPathFromName returns the first path expression from series name.
+//
+// For example, `foo.bar.baz` is returned for `scale(sumSeries(foo.bar.baz,1),2)`.
+func getPathFromName(name string) string {
+	if n := strings.LastIndexByte(name, '('); n >= 0 {
+		name = name[n+1:]
+	}
+	if n := strings.IndexAny(name, ",)"); n >= 0 {
+		name = name[:n]
+	}
+	return name
+}
+
+// getNodesKey returns a key for the given nodes from s name and tags.
+//
+// See aliasByNode and aliasByTags functions in Graphite.
+func getNodesKey(s *series, nodes []graphiteql.Expr) string {
+	path := getPathFromName(s.Name)
+	if n := strings.IndexByte(path, ';'); n >= 0 {
+		path = path[:n]
+	}
+	parts := strings.Split(path, ".")
+	var dst []string
+	for _, node := range nodes {
+		switch t := node.(type) {
+		case *graphiteql.NumberExpr:
+			idx := int(t.N)
+			if idx < 0 {
+				idx += len(parts)
+			}
+			if idx >= 0 && idx < len(parts) {
+				dst = append(dst, parts[idx])
+			}
+		case *graphiteql.StringExpr:
+			if v, ok := s.Tags[t.S]; ok {
+				dst = append(dst, v)
+			}
+		}
+	}
+	return strings.Join(dst, ".")
+}
+
+// getPathExpressions returns comma-separated unique path expressions for ss.
+func getPathExpressions(ss []*series) string {
+	m := make(map[string]struct{}, len(ss))
+	var a []string
+	for _, s := range ss {
+		if _, ok := m[s.pathExpression]; ok {
+			continue
+		}
+		m[s.pathExpression] = struct{}{}
+		a = append(a, s.pathExpression)
+	}
+	sort.Strings(a)
+	return strings.Join(a, ",")
+}
+
+// getCommonTags returns tags with equal values across all the ss.
+func getCommonTags(ss []*series) map[string]string {
+	if len(ss) == 0 {
+		return map[string]string{}
+	}
+	m := copyTags(ss[0].Tags)
+	for _, s := range ss[1:] {
+		for k, v := range m {
+			if s.Tags[k] != v {
+				delete(m, k)
+			}
+		}
+	}
+	return m
+}
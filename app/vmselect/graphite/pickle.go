@@ -0,0 +1,107 @@
+package graphite
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// marshalPickle appends ss in Python pickle format (protocol 2) to dst and returns the result.
+//
+// The marshaled data is a list of dicts with name, pathExpression, start, end, step and values keys,
+// in the same way as graphite-web returns for /render?format=pickle.
+//
+// See https://graphite.readthedocs.io/en/stable/render_api.html#pickle
+func marshalPickle(dst []byte, ss []*series) []byte {
+	dst = append(dst, pickleProto, 2)
+	dst = append(dst, pickleEmptyList)
+	if len(ss) > 0 {
+		dst = append(dst, pickleMark)
+		for _, s := range ss {
+			dst = marshalPickleSeries(dst, s)
+		}
+		dst = append(dst, pickleAppends)
+	}
+	dst = append(dst, pickleStop)
+	return dst
+}
+
+func marshalPickleSeries(dst []byte, s *series) []byte {
+	start := int64(0)
+	end := int64(0)
+	if len(s.Timestamps) > 0 {
+		start = s.Timestamps[0] / 1e3
+		end = s.Timestamps[len(s.Timestamps)-1]/1e3 + s.step/1e3
+	}
+	dst = append(dst, pickleEmptyDict, pickleMark)
+	dst = marshalPickleString(dst, "name")
+	dst = marshalPickleString(dst, s.Name)
+	dst = marshalPickleString(dst, "pathExpression")
+	dst = marshalPickleString(dst, s.pathExpression)
+	dst = marshalPickleString(dst, "start")
+	dst = marshalPickleInt(dst, start)
+	dst = marshalPickleString(dst, "end")
+	dst = marshalPickleInt(dst, end)
+	dst = marshalPickleString(dst, "step")
+	dst = marshalPickleInt(dst, s.step/1e3)
+	dst = marshalPickleString(dst, "values")
+	dst = append(dst, pickleEmptyList)
+	if len(s.Values) > 0 {
+		dst = append(dst, pickleMark)
+		for _, v := range s.Values {
+			dst = marshalPickleFloat(dst, v)
+		}
+		dst = append(dst, pickleAppends)
+	}
+	dst = append(dst, pickleSetItems)
+	return dst
+}
+
+func marshalPickleString(dst []byte, s string) []byte {
+	dst = append(dst, pickleBinUnicode)
+	dst = appendUint32LE(dst, uint32(len(s)))
+	return append(dst, s...)
+}
+
+func marshalPickleInt(dst []byte, n int64) []byte {
+	if n >= math.MinInt32 && n <= math.MaxInt32 {
+		dst = append(dst, pickleBinInt)
+		return appendUint32LE(dst, uint32(int32(n)))
+	}
+	// Large ints are marshaled as little-endian two's complement bytes.
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(n))
+	dst = append(dst, pickleLong1, 8)
+	return append(dst, buf[:]...)
+}
+
+func marshalPickleFloat(dst []byte, v float64) []byte {
+	if math.IsNaN(v) {
+		return append(dst, pickleNone)
+	}
+	dst = append(dst, pickleBinFloat)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(dst, buf[:]...)
+}
+
+func appendUint32LE(dst []byte, n uint32) []byte {
+	return append(dst, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+}
+
+// Pickle opcodes.
+//
+// See https://github.com/python/cpython/blob/main/Lib/pickletools.py
+const (
+	pickleProto      = 0x80
+	pickleEmptyList  = ']'
+	pickleEmptyDict  = '}'
+	pickleMark       = '('
+	pickleAppends    = 'e'
+	pickleSetItems   = 'u'
+	pickleBinUnicode = 'X'
+	pickleBinInt     = 'J'
+	pickleLong1      = 0x8a
+	pickleBinFloat   = 'G'
+	pickleNone       = 'N'
+	pickleStop       = '.'
+)
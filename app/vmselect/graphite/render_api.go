@@ -0,0 +1,265 @@
+package graphite
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/graphiteql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	storageStep = flag.Duration("search.graphiteStorageStep", 10*time.Second, "The interval between datapoints stored in the database. "+
+		"It is used at Graphite Render API handler for normalizing the interval between datapoints in case it isn't normalized. "+
+		"It can be overriden by sending 'storage_step' query arg to /render API or by sending the desired interval via 'Storage-Step' http header during querying /render API")
+	maxPointsPerSeries = flag.Int("search.graphiteMaxPointsPerSeries", 1e6, "The maximum number of points per series Graphite render API can return")
+)
+
+// RenderHandler implements /render endpoint from Graphite Render API.
+//
+// See https://graphite.readthedocs.io/en/stable/render_api.html
+func RenderHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	format := r.FormValue("format")
+	if format == "" {
+		format = "json"
+	}
+	switch format {
+	case "json", "csv", "pickle":
+	default:
+		return fmt.Errorf(`unexpected "format" query arg: %q; expecting "json", "csv" or "pickle"`, format)
+	}
+	targets := r.Form["target"]
+	if len(targets) == 0 {
+		return fmt.Errorf("missing `target` query arg")
+	}
+	ct := startTime.UnixNano() / 1e6
+	from, err := getGraphiteTime(r, "from", ct, ct-24*3600*1000)
+	if err != nil {
+		return err
+	}
+	until, err := getGraphiteTime(r, "until", ct, ct)
+	if err != nil {
+		return err
+	}
+	step, err := getStorageStep(r)
+	if err != nil {
+		return err
+	}
+	maxDataPoints, err := getInt(r, "maxDataPoints")
+	if err != nil {
+		return err
+	}
+	noNullPoints := searchutils.GetBool(r, "noNullPoints")
+	jsonp := r.FormValue("jsonp")
+	etfs, err := searchutils.GetExtraTagFilters(r)
+	if err != nil {
+		return fmt.Errorf("cannot setup tag filters: %w", err)
+	}
+
+	// Align the time range to step, so the returned datapoints stay stable between requests.
+	start := from - from%step
+	if start < from {
+		start += step
+	}
+	end := until - until%step
+	if end < start {
+		return fmt.Errorf("`from`=%d must be smaller than `until`=%d", from/1e3, until/1e3)
+	}
+	if points := (end-start)/step + 1; points > int64(*maxPointsPerSeries) {
+		return fmt.Errorf("too many points per series must be returned on the given [from=%d ... until=%d] time range and step=%ds: %d; "+
+			"either increase the step via `storage_step` query arg or reduce the time range or increase -search.graphiteMaxPointsPerSeries command-line flag value",
+			from/1e3, until/1e3, step/1e3, points)
+	}
+	ec := &evalConfig{
+		startTime:   start,
+		endTime:     end,
+		storageStep: step,
+		deadline:    deadline,
+		etfs:        etfs,
+	}
+	var ss []*series
+	for _, target := range targets {
+		expr, err := graphiteql.Parse(target)
+		if err != nil {
+			return fmt.Errorf("cannot parse target=%q: %w", target, err)
+		}
+		ssLocal, err := evalExpr(ec, expr)
+		if err != nil {
+			return fmt.Errorf("cannot evaluate target=%q: %w", target, err)
+		}
+		ss = append(ss, ssLocal...)
+	}
+	if maxDataPoints > 0 {
+		for _, s := range ss {
+			s.consolidate(maxDataPoints)
+		}
+	}
+
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", getContentType(jsonp))
+		WriteRenderJSONResponse(bw, ss, noNullPoints, jsonp)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		WriteRenderCSVResponse(bw, ss)
+	case "pickle":
+		w.Header().Set("Content-Type", "application/pickle")
+		_, _ = bw.Write(marshalPickle(nil, ss))
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	renderDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var renderDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/render"}`)
+
+func getStorageStep(r *http.Request) (int64, error) {
+	s := r.FormValue("storage_step")
+	if s == "" {
+		s = r.Header.Get("Storage-Step")
+	}
+	if s == "" {
+		step := storageStep.Milliseconds()
+		if step < 1000 {
+			return 0, fmt.Errorf("-search.graphiteStorageStep must be at least 1s; got %s", *storageStep)
+		}
+		return step - step%1000, nil
+	}
+	step, err := parseInterval(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse storage step %q: %w", s, err)
+	}
+	if step < 1000 {
+		return 0, fmt.Errorf("storage step must be at least 1s; got %q", s)
+	}
+	return step - step%1000, nil
+}
+
+func getGraphiteTime(r *http.Request, argName string, ct, defaultValue int64) (int64, error) {
+	s := r.FormValue(argName)
+	if s == "" {
+		return defaultValue, nil
+	}
+	t, err := parseTime(s, ct)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q=%q: %w", argName, s, err)
+	}
+	return t, nil
+}
+
+// parseTime parses Graphite time s relative to the current time ct in milliseconds.
+//
+// See https://graphite.readthedocs.io/en/stable/render_api.html#from-until
+func parseTime(s string, ct int64) (int64, error) {
+	if s == "now" {
+		return ct, nil
+	}
+	if strings.HasPrefix(s, "now") && len(s) > len("now") && (s[3] == '-' || s[3] == '+') {
+		d, err := parseInterval(s[len("now"):])
+		if err != nil {
+			return 0, err
+		}
+		return ct + d, nil
+	}
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		d, err := parseInterval(s)
+		if err != nil {
+			return 0, err
+		}
+		return ct + d, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && len(s) != len("YYYYMMDD") {
+		return n * 1e3, nil
+	}
+	for _, layout := range []string{"20060102", "15:04_20060102", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t.UnixNano() / 1e6, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported time format; supported formats: now, now-<interval>, -<interval>, unix timestamp in seconds, YYYYMMDD, HH:MM_YYYYMMDD")
+}
+
+// parseInterval parses Graphite interval such as `-5min` or `1d` and returns it in milliseconds.
+//
+// See https://graphite.readthedocs.io/en/stable/render_api.html#from-until
+func parseInterval(s string) (int64, error) {
+	sign := int64(1)
+	tail := s
+	if strings.HasPrefix(tail, "-") {
+		sign = -1
+		tail = tail[1:]
+	} else if strings.HasPrefix(tail, "+") {
+		tail = tail[1:]
+	}
+	n := 0
+	for n < len(tail) && tail[n] >= '0' && tail[n] <= '9' {
+		n++
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("missing number in interval %q", s)
+	}
+	v, err := strconv.ParseInt(tail[:n], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse interval %q: %w", s, err)
+	}
+	unit := strings.TrimSpace(tail[n:])
+	msecs, ok := intervalUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit %q in interval %q; supported units: s, min, h, d, w, mon, y", unit, s)
+	}
+	if v > math.MaxInt64/msecs {
+		return 0, fmt.Errorf("too big interval %q", s)
+	}
+	return sign * v * msecs, nil
+}
+
+var intervalUnits = map[string]int64{
+	"s":       1000,
+	"sec":     1000,
+	"secs":    1000,
+	"second":  1000,
+	"seconds": 1000,
+	"m":       60 * 1000,
+	"min":     60 * 1000,
+	"mins":    60 * 1000,
+	"minute":  60 * 1000,
+	"minutes": 60 * 1000,
+	"h":       3600 * 1000,
+	"hour":    3600 * 1000,
+	"hours":   3600 * 1000,
+	"d":       24 * 3600 * 1000,
+	"day":     24 * 3600 * 1000,
+	"days":    24 * 3600 * 1000,
+	"w":       7 * 24 * 3600 * 1000,
+	"week":    7 * 24 * 3600 * 1000,
+	"weeks":   7 * 24 * 3600 * 1000,
+	"mon":     30 * 24 * 3600 * 1000,
+	"month":   30 * 24 * 3600 * 1000,
+	"months":  30 * 24 * 3600 * 1000,
+	"y":       365 * 24 * 3600 * 1000,
+	"year":    365 * 24 * 3600 * 1000,
+	"years":   365 * 24 * 3600 * 1000,
+}
+
+// quoteCSVField quotes s if it contains chars, which cannot be put into CSV field as is.
+func quoteCSVField(s string) string {
+	if !strings.ContainsAny(s, ",\"\r\n") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
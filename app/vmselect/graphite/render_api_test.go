@@ -0,0 +1,126 @@
+package graphite
+
+import (
+	"testing"
+)
+
+func TestParseIntervalSuccess(t *testing.T) {
+	f := func(s string, resultExpected int64) {
+		t.Helper()
+		result, err := parseInterval(s)
+		if err != nil {
+			t.Fatalf("unexpected error in parseInterval(%q): %s", s, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for parseInterval(%q); got %d; want %d", s, result, resultExpected)
+		}
+	}
+	f("1s", 1000)
+	f("10sec", 10000)
+	f("5min", 5*60*1000)
+	f("5m", 5*60*1000)
+	f("-2h", -2*3600*1000)
+	f("+3days", 3*24*3600*1000)
+	f("1w", 7*24*3600*1000)
+	f("1mon", 30*24*3600*1000)
+	f("1y", 365*24*3600*1000)
+}
+
+func TestParseIntervalError(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, err := parseInterval(s); err == nil {
+			t.Fatalf("expecting non-nil error for parseInterval(%q)", s)
+		}
+	}
+	f("")
+	f("-")
+	f("min")
+	f("1")
+	f("1foo")
+	f("1.5h")
+	f("99999999999999999999s")
+}
+
+func TestParseTimeSuccess(t *testing.T) {
+	ct := int64(1600000000123)
+	f := func(s string, resultExpected int64) {
+		t.Helper()
+		result, err := parseTime(s, ct)
+		if err != nil {
+			t.Fatalf("unexpected error in parseTime(%q): %s", s, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for parseTime(%q); got %d; want %d", s, result, resultExpected)
+		}
+	}
+	f("now", ct)
+	f("-1h", ct-3600*1000)
+	f("now-5min", ct-5*60*1000)
+	f("now+1d", ct+24*3600*1000)
+	f("1600000000", 1600000000000)
+	f("20201018", 1602979200000)
+	f("10:30_20201018", 1603017000000)
+	f("2020-10-18T10:30:00Z", 1603017000000)
+}
+
+func TestParseTimeError(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, err := parseTime(s, 0); err == nil {
+			t.Fatalf("expecting non-nil error for parseTime(%q)", s)
+		}
+	}
+	f("foo")
+	f("-1foo")
+	f("now-")
+	f("2020-10-18")
+}
+
+func TestQuoteCSVField(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+		result := quoteCSVField(s)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for quoteCSVField(%q); got %q; want %q", s, result, resultExpected)
+		}
+	}
+	f("", "")
+	f("foo.bar", "foo.bar")
+	f("sumSeries(foo,bar)", `"sumSeries(foo,bar)"`)
+	f(`alias(foo,"x")`, `"alias(foo,""x"")"`)
+}
+
+func TestMarshalPickle(t *testing.T) {
+	f := func(ss []*series, resultExpected string) {
+		t.Helper()
+		result := marshalPickle(nil, ss)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected pickle;\ngot\n%q\nwant\n%q", result, resultExpected)
+		}
+	}
+	f(nil, "\x80\x02].")
+	f([]*series{{
+		Name:           "foo.bar",
+		pathExpression: "foo.*",
+		Timestamps:     []int64{1000e3, 1010e3},
+		Values:         []float64{1.5, nan},
+		step:           10e3,
+	}}, "\x80\x02](}(X\x04\x00\x00\x00nameX\a\x00\x00\x00foo.barX\x0e\x00\x00\x00pathExpressionX\x05\x00\x00\x00foo.*"+
+		"X\x05\x00\x00\x00startJ\xe8\x03\x00\x00X\x03\x00\x00\x00endJ\xfc\x03\x00\x00X\x04\x00\x00\x00stepJ\n\x00\x00\x00"+
+		"X\x06\x00\x00\x00values](G?\xf8\x00\x00\x00\x00\x00\x00Neue.")
+}
+
+func TestMarshalPickleInt(t *testing.T) {
+	f := func(n int64, resultExpected string) {
+		t.Helper()
+		result := marshalPickleInt(nil, n)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected pickle for %d; got %q; want %q", n, result, resultExpected)
+		}
+	}
+	f(0, "J\x00\x00\x00\x00")
+	f(-1, "J\xff\xff\xff\xff")
+	f(1<<40, "\x8a\x08\x00\x00\x00\x00\x00\x01\x00\x00")
+	f(-1<<40, "\x8a\x08\x00\x00\x00\x00\x00\xff\xff\xff")
+}
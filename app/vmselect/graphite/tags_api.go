@@ -132,7 +132,7 @@ func registerMetrics(startTime time.Time, w http.ResponseWriter, r *http.Request
 		// Put labels with the current timestamp to MetricRow
 		mr := &mrs[i]
 		mr.MetricNameRaw = storage.MarshalMetricNameRaw(mr.MetricNameRaw[:0], labels)
-		mr.Timestamp = ct
+		mr.Timestamp = storage.TimestampFromMsecs(ct)
 	}
 	if err := vmstorage.RegisterMetricNames(mrs); err != nil {
 		return fmt.Errorf("cannot register paths: %w", err)
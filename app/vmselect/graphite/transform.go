@@ -0,0 +1,1200 @@
+package graphite
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/graphiteql"
+)
+
+// transformFunc evaluates Graphite function call fe.
+type transformFunc func(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error)
+
+// transformFuncs contains supported Graphite functions with lowercase names.
+//
+// It is initialized in init(), since transform funcs refer to evalExpr, which refers to transformFuncs.
+//
+// See https://graphite.readthedocs.io/en/stable/functions.html
+var transformFuncs map[string]transformFunc
+
+func init() {
+	transformFuncs = map[string]transformFunc{
+		"absolute":                    newTransformPerPoint("absolute", math.Abs),
+		"aggregate":                   transformAggregate,
+		"aggregatewithwildcards":      transformAggregateWithWildcards,
+		"alias":                       transformAlias,
+		"aliasbymetric":               transformAliasByMetric,
+		"aliasbynode":                 transformAliasByNode,
+		"aliasbytags":                 transformAliasByNode,
+		"aliassub":                    transformAliasSub,
+		"avg":                         newTransformAggregateSeries("averageSeries", aggrAvg),
+		"averageabove":                newTransformFilterSeries("average", ">"),
+		"averagebelow":                newTransformFilterSeries("average", "<="),
+		"averageseries":               newTransformAggregateSeries("averageSeries", aggrAvg),
+		"averageserieswithwildcards":  newTransformAggregateSeriesWithWildcards(aggrAvg),
+		"consolidateby":               transformConsolidateBy,
+		"constantline":                transformConstantLine,
+		"countseries":                 transformCountSeries,
+		"currentabove":                newTransformFilterSeries("current", ">"),
+		"currentbelow":                newTransformFilterSeries("current", "<="),
+		"derivative":                  transformDerivative,
+		"diffseries":                  newTransformAggregateSeries("diffSeries", aggrDiff),
+		"exclude":                     newTransformGrep(true),
+		"filterseries":                transformFilterSeries,
+		"grep":                        newTransformGrep(false),
+		"group":                       transformGroup,
+		"groupbynode":                 transformGroupByNode,
+		"groupbynodes":                transformGroupByNodes,
+		"groupbytags":                 transformGroupByTags,
+		"highest":                     newTransformHighest("", false),
+		"highestaverage":              newTransformHighest("average", false),
+		"highestcurrent":              newTransformHighest("current", false),
+		"highestmax":                  newTransformHighest("max", false),
+		"integral":                    transformIntegral,
+		"invert":                      newTransformPerPoint("invert", func(v float64) float64 { return 1 / v }),
+		"keeplastvalue":               transformKeepLastValue,
+		"limit":                       transformLimit,
+		"lowest":                      newTransformHighest("", true),
+		"lowestaverage":               newTransformHighest("average", true),
+		"lowestcurrent":               newTransformHighest("current", true),
+		"maximumabove":                newTransformFilterSeries("max", ">"),
+		"maximumbelow":                newTransformFilterSeries("max", "<="),
+		"maxseries":                   newTransformAggregateSeries("maxSeries", aggrMax),
+		"medianseries":                newTransformAggregateSeries("medianSeries", aggrMedian),
+		"minimumabove":                newTransformFilterSeries("min", ">"),
+		"minimumbelow":                newTransformFilterSeries("min", "<="),
+		"minseries":                   newTransformAggregateSeries("minSeries", aggrMin),
+		"movingaverage":               newTransformMoving("movingAverage", aggrAvg),
+		"movingmax":                   newTransformMoving("movingMax", aggrMax),
+		"movingmedian":                newTransformMoving("movingMedian", aggrMedian),
+		"movingmin":                   newTransformMoving("movingMin", aggrMin),
+		"movingsum":                   newTransformMoving("movingSum", aggrSum),
+		"movingwindow":                transformMovingWindow,
+		"multiplyseries":              newTransformAggregateSeries("multiplySeries", aggrMultiply),
+		"multiplyserieswithwildcards": newTransformAggregateSeriesWithWildcards(aggrMultiply),
+		"nonnegativederivative":       transformNonNegativeDerivative,
+		"offset":                      newTransformPerPointWithFactor("offset", func(v, factor float64) float64 { return v + factor }),
+		"persecond":                   transformPerSecond,
+		"pow":                         newTransformPerPointWithFactor("pow", math.Pow),
+		"rangeofseries":               newTransformAggregateSeries("rangeOfSeries", aggrRange),
+		"removeemptyseries":           transformRemoveEmptySeries,
+		"scale":                       newTransformPerPointWithFactor("scale", func(v, factor float64) float64 { return v * factor }),
+		"scaletoseconds":              transformScaleToSeconds,
+		"seriesbytag":                 transformSeriesByTag,
+		"sortby":                      transformSortBy,
+		"sortbyname":                  transformSortByName,
+		"stddevseries":                newTransformAggregateSeries("stddevSeries", aggrStddev),
+		"sum":                         newTransformAggregateSeries("sumSeries", aggrSum),
+		"sumseries":                   newTransformAggregateSeries("sumSeries", aggrSum),
+		"sumserieswithwildcards":      newTransformAggregateSeriesWithWildcards(aggrSum),
+		"summarize":                   transformSummarize,
+		"timeshift":                   transformTimeShift,
+		"transformnull":               transformTransformNull,
+	}
+}
+
+func (s *series) rename(name string) {
+	s.Name = name
+	s.pathExpression = name
+}
+
+func newTransformAggregateSeries(funcName string, af aggrFunc) transformFunc {
+	return func(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+		ss, err := getSeriesArgs(ec, fe.Args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return aggregateSeriesList(ss, af, funcName), nil
+	}
+}
+
+// aggregateSeriesList aggregates ss into a single series named `funcName(pathExpressions)`.
+func aggregateSeriesList(ss []*series, af aggrFunc, funcName string) []*series {
+	if len(ss) == 0 {
+		return nil
+	}
+	name := fmt.Sprintf("%s(%s)", funcName, getPathExpressions(ss))
+	return []*series{aggregateSeries(ss, af, name)}
+}
+
+func aggregateSeries(ss []*series, af aggrFunc, name string) *series {
+	timestamps, step := normalizeSeries(ss)
+	values := make([]float64, len(timestamps))
+	buf := make([]float64, len(ss))
+	for i := range timestamps {
+		for j, s := range ss {
+			buf[j] = s.Values[i]
+		}
+		values[i] = af(buf)
+	}
+	tags := getCommonTags(ss)
+	tags["name"] = name
+	return &series{
+		Name:            name,
+		Tags:            tags,
+		Timestamps:      timestamps,
+		Values:          values,
+		pathExpression:  name,
+		consolidateFunc: ss[0].consolidateFunc,
+		step:            step,
+	}
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.aggregate
+func transformAggregate(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	funcName, err := getStringArg(fe.Args, "func", 1)
+	if err != nil {
+		return nil, err
+	}
+	af, err := getAggrFunc(funcName)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	return aggregateSeriesList(ss, af, strings.TrimSuffix(funcName, "Series")+"Series"), nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.countSeries
+func transformCountSeries(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	ss, err := getSeriesArgs(ec, fe.Args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(ss) == 0 {
+		return nil, nil
+	}
+	n := float64(len(ss))
+	return aggregateSeriesList(ss, func(values []float64) float64 { return n }, "countSeries"), nil
+}
+
+// groupSeries groups ss by keys returned from keyFunc and aggregates every group with af.
+//
+// The returned series are named after the group keys and are sorted by name.
+func groupSeries(ss []*series, af aggrFunc, keyFunc func(s *series) string) []*series {
+	m := make(map[string][]*series)
+	for _, s := range ss {
+		key := keyFunc(s)
+		m[key] = append(m[key], s)
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, aggregateSeries(m[key], af, key))
+	}
+	return result
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.groupByNode
+func transformGroupByNode(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	nodeArg := getArg(fe.Args, "nodeNum", 1)
+	if nodeArg == nil {
+		return nil, fmt.Errorf("missing %q arg", "nodeNum")
+	}
+	nodes := []graphiteql.Expr{nodeArg.Expr}
+	callback, err := getOptionalStringArg(fe.Args, "callback", 2, "average")
+	if err != nil {
+		return nil, err
+	}
+	return groupByNodes(ec, fe, callback, nodes)
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.groupByNodes
+func transformGroupByNodes(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	callback, err := getStringArg(fe.Args, "callback", 1)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := getNodeArgs(fe.Args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return groupByNodes(ec, fe, callback, nodes)
+}
+
+func groupByNodes(ec *evalConfig, fe *graphiteql.FuncExpr, callback string, nodes []graphiteql.Expr) ([]*series, error) {
+	af, err := getAggrFunc(callback)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	return groupSeries(ss, af, func(s *series) string {
+		return getNodesKey(s, nodes)
+	}), nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.groupByTags
+func transformGroupByTags(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	callback, err := getStringArg(fe.Args, "callback", 1)
+	if err != nil {
+		return nil, err
+	}
+	af, err := getAggrFunc(callback)
+	if err != nil {
+		return nil, err
+	}
+	var tagKeys []string
+	for i := 2; i < len(fe.Args); i++ {
+		arg := fe.Args[i]
+		se, ok := arg.Expr.(*graphiteql.StringExpr)
+		if !ok {
+			return nil, fmt.Errorf("tag name must be a string; got %q", arg.Expr.AppendString(nil))
+		}
+		tagKeys = append(tagKeys, se.S)
+	}
+	if len(tagKeys) == 0 {
+		return nil, fmt.Errorf("at least a single tag name must be passed")
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	ss = groupSeries(ss, af, func(s *series) string {
+		tags := map[string]string{
+			"name": callback,
+		}
+		for _, key := range tagKeys {
+			tags[key] = s.Tags[key]
+		}
+		return formatTaggedName(tags)
+	})
+	for _, s := range ss {
+		s.Tags = parseTaggedName(s.Name)
+	}
+	return ss, nil
+}
+
+// formatTaggedName returns `name;tag1=value1;...;tagN=valueN` for the given tags sorted by tag name.
+func formatTaggedName(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		if key != "name" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	b := []byte(tags["name"])
+	for _, key := range keys {
+		b = append(b, ';')
+		b = append(b, key...)
+		b = append(b, '=')
+		b = append(b, tags[key]...)
+	}
+	return string(b)
+}
+
+// parseTaggedName parses `name;tag1=value1;...;tagN=valueN` into tags.
+func parseTaggedName(s string) map[string]string {
+	a := strings.Split(s, ";")
+	tags := map[string]string{
+		"name": a[0],
+	}
+	for _, tag := range a[1:] {
+		n := strings.IndexByte(tag, '=')
+		if n < 0 {
+			continue
+		}
+		tags[tag[:n]] = tag[n+1:]
+	}
+	return tags
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.aggregateWithWildcards
+func transformAggregateWithWildcards(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	funcName, err := getStringArg(fe.Args, "func", 1)
+	if err != nil {
+		return nil, err
+	}
+	af, err := getAggrFunc(funcName)
+	if err != nil {
+		return nil, err
+	}
+	return aggregateWithWildcards(ec, fe, af, 2)
+}
+
+func newTransformAggregateSeriesWithWildcards(af aggrFunc) transformFunc {
+	return func(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+		return aggregateWithWildcards(ec, fe, af, 1)
+	}
+}
+
+func aggregateWithWildcards(ec *evalConfig, fe *graphiteql.FuncExpr, af aggrFunc, pos int) ([]*series, error) {
+	positions := make(map[int]bool)
+	for i := pos; i < len(fe.Args); i++ {
+		n, err := exprToNumber("position", fe.Args[i].Expr)
+		if err != nil {
+			return nil, err
+		}
+		positions[int(n)] = true
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	return groupSeries(ss, af, func(s *series) string {
+		parts := strings.Split(s.Name, ".")
+		dst := parts[:0]
+		for i, part := range parts {
+			if !positions[i] {
+				dst = append(dst, part)
+			}
+		}
+		return strings.Join(dst, ".")
+	}), nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.alias
+func transformAlias(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	newName, err := getStringArg(fe.Args, "newName", 1)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		s.Name = newName
+	}
+	return ss, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.aliasByMetric
+func transformAliasByMetric(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []graphiteql.Expr{&graphiteql.NumberExpr{N: -1}}
+	for _, s := range ss {
+		s.Name = getNodesKey(s, nodes)
+	}
+	return ss, nil
+}
+
+// transformAliasByNode implements both aliasByNode and aliasByTags functions.
+//
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.aliasByNode
+// and https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.aliasByTags
+func transformAliasByNode(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	nodes, err := getNodeArgs(fe.Args, 1)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		s.Name = getNodesKey(s, nodes)
+	}
+	return ss, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.aliasSub
+func transformAliasSub(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	search, err := getStringArg(fe.Args, "search", 1)
+	if err != nil {
+		return nil, err
+	}
+	replace, err := getStringArg(fe.Args, "replace", 2)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(search)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile search regexp %q: %w", search, err)
+	}
+	// Convert Python-style backreferences such as `\1` to Go-style `${1}`.
+	replace = backrefRegexp.ReplaceAllString(replace, "$${$1}")
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		s.Name = re.ReplaceAllString(s.Name, replace)
+	}
+	return ss, nil
+}
+
+var backrefRegexp = regexp.MustCompile(`\\(\d+)`)
+
+func newTransformPerPoint(funcName string, f func(v float64) float64) transformFunc {
+	return func(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+		ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range ss {
+			for i, v := range s.Values {
+				s.Values[i] = f(v)
+			}
+			s.rename(fmt.Sprintf("%s(%s)", funcName, s.Name))
+		}
+		return ss, nil
+	}
+}
+
+func newTransformPerPointWithFactor(funcName string, f func(v, factor float64) float64) transformFunc {
+	return func(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+		factor, err := getNumberArg(fe.Args, "factor", 1)
+		if err != nil {
+			return nil, err
+		}
+		ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range ss {
+			for i, v := range s.Values {
+				s.Values[i] = f(v, factor)
+			}
+			s.rename(fmt.Sprintf("%s(%s,%g)", funcName, s.Name, factor))
+		}
+		return ss, nil
+	}
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.scaleToSeconds
+func transformScaleToSeconds(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	seconds, err := getNumberArg(fe.Args, "seconds", 1)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		factor := seconds * 1000 / float64(s.step)
+		for i, v := range s.Values {
+			s.Values[i] = v * factor
+		}
+		s.rename(fmt.Sprintf("scaleToSeconds(%s,%g)", s.Name, seconds))
+	}
+	return ss, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.transformNull
+func transformTransformNull(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	defaultValue, err := getOptionalNumberArg(fe.Args, "default", 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		for i, v := range s.Values {
+			if math.IsNaN(v) {
+				s.Values[i] = defaultValue
+			}
+		}
+		s.rename(fmt.Sprintf("transformNull(%s,%g)", s.Name, defaultValue))
+	}
+	return ss, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.keepLastValue
+func transformKeepLastValue(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	limit, err := getOptionalNumberArg(fe.Args, "limit", 1, math.Inf(1))
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		keepLastValue(s.Values, limit)
+		s.rename(fmt.Sprintf("keepLastValue(%s)", s.Name))
+	}
+	return ss, nil
+}
+
+// keepLastValue fills gaps in values with the last non-NaN value if the gap contains up to limit points.
+func keepLastValue(values []float64, limit float64) {
+	lastIdx := -1
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if lastIdx >= 0 && float64(i-lastIdx-1) <= limit {
+			for j := lastIdx + 1; j < i; j++ {
+				values[j] = values[lastIdx]
+			}
+		}
+		lastIdx = i
+	}
+	if lastIdx >= 0 && float64(len(values)-lastIdx-1) <= limit {
+		for j := lastIdx + 1; j < len(values); j++ {
+			values[j] = values[lastIdx]
+		}
+	}
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.derivative
+func transformDerivative(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		prev := nan
+		for i, v := range s.Values {
+			s.Values[i] = v - prev
+			prev = v
+		}
+		s.rename(fmt.Sprintf("derivative(%s)", s.Name))
+	}
+	return ss, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.nonNegativeDerivative
+func transformNonNegativeDerivative(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	return nonNegativeDelta(ec, fe, "nonNegativeDerivative", false)
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.perSecond
+func transformPerSecond(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	return nonNegativeDelta(ec, fe, "perSecond", true)
+}
+
+func nonNegativeDelta(ec *evalConfig, fe *graphiteql.FuncExpr, funcName string, perSecond bool) ([]*series, error) {
+	maxValue, err := getOptionalNumberArg(fe.Args, "maxValue", 1, nan)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		stepSecs := float64(1)
+		if perSecond {
+			stepSecs = float64(s.step) / 1e3
+		}
+		prev := nan
+		for i, v := range s.Values {
+			s.Values[i] = nonNegativeDeltaValue(prev, v, maxValue) / stepSecs
+			prev = v
+		}
+		s.rename(fmt.Sprintf("%s(%s)", funcName, s.Name))
+	}
+	return ss, nil
+}
+
+// nonNegativeDeltaValue returns v-prev for counters, which may wrap at maxValue.
+//
+// NaN is returned for counter resets.
+func nonNegativeDeltaValue(prev, v, maxValue float64) float64 {
+	if math.IsNaN(prev) || math.IsNaN(v) {
+		return nan
+	}
+	d := v - prev
+	if d >= 0 {
+		return d
+	}
+	if !math.IsNaN(maxValue) && maxValue >= v {
+		return maxValue - prev + v + 1
+	}
+	return nan
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.integral
+func transformIntegral(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		sum := float64(0)
+		for i, v := range s.Values {
+			if math.IsNaN(v) {
+				continue
+			}
+			sum += v
+			s.Values[i] = sum
+		}
+		s.rename(fmt.Sprintf("integral(%s)", s.Name))
+	}
+	return ss, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.consolidateBy
+func transformConsolidateBy(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	funcName, err := getStringArg(fe.Args, "consolidationFunc", 1)
+	if err != nil {
+		return nil, err
+	}
+	af, err := getAggrFunc(funcName)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		s.consolidateFunc = af
+		s.rename(fmt.Sprintf("consolidateBy(%s,%s)", s.Name, strconv.Quote(funcName)))
+	}
+	return ss, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.summarize
+func transformSummarize(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	intervalString, err := getStringArg(fe.Args, "intervalString", 1)
+	if err != nil {
+		return nil, err
+	}
+	interval, err := parseInterval(intervalString)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive; got %q", intervalString)
+	}
+	funcName, err := getOptionalStringArg(fe.Args, "func", 2, "sum")
+	if err != nil {
+		return nil, err
+	}
+	af, err := getAggrFunc(funcName)
+	if err != nil {
+		return nil, err
+	}
+	alignToFrom, err := getOptionalBoolArg(fe.Args, "alignToFrom", 3, false)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		summarizeSeries(s, interval, af, alignToFrom)
+		suffix := ""
+		if alignToFrom {
+			suffix = ", true"
+		}
+		s.rename(fmt.Sprintf("summarize(%s, %s, %s%s)", s.Name, strconv.Quote(intervalString), strconv.Quote(funcName), suffix))
+	}
+	return ss, nil
+}
+
+// summarizeSeries aggregates points in s into interval buckets with af.
+//
+// Buckets are aligned to interval if alignToFrom isn't set. Otherwise buckets are aligned to the first point in s.
+func summarizeSeries(s *series, interval int64, af aggrFunc, alignToFrom bool) {
+	if len(s.Timestamps) == 0 {
+		s.step = interval
+		return
+	}
+	firstTimestamp := s.Timestamps[0]
+	bucketStart := func(ts int64) int64 {
+		if alignToFrom {
+			return ts - (ts-firstTimestamp)%interval
+		}
+		return ts - ts%interval
+	}
+	start := bucketStart(firstTimestamp)
+	end := bucketStart(s.Timestamps[len(s.Timestamps)-1])
+	timestamps := getTimestamps(start, end, interval)
+	values := make([]float64, 0, len(timestamps))
+	var buf []float64
+	i := 0
+	for _, ts := range timestamps {
+		buf = buf[:0]
+		for i < len(s.Timestamps) && s.Timestamps[i] < ts+interval {
+			buf = append(buf, s.Values[i])
+			i++
+		}
+		values = append(values, af(buf))
+	}
+	s.Timestamps = timestamps
+	s.Values = values
+	s.step = interval
+}
+
+func newTransformMoving(funcName string, af aggrFunc) transformFunc {
+	return func(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+		return movingWindow(ec, fe, funcName, af, 2)
+	}
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.movingWindow
+func transformMovingWindow(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	funcName, err := getOptionalStringArg(fe.Args, "func", 2, "average")
+	if err != nil {
+		return nil, err
+	}
+	af, err := getAggrFunc(funcName)
+	if err != nil {
+		return nil, err
+	}
+	return movingWindow(ec, fe, "movingWindow", af, 3)
+}
+
+// movingWindow calculates af over the window preceding every point in the seriesList arg.
+//
+// The window is set via windowSize arg either as the number of points or as an interval string such as `5min`.
+// xFilesFactor arg is located at xFilesFactorPos.
+func movingWindow(ec *evalConfig, fe *graphiteql.FuncExpr, funcName string, af aggrFunc, xFilesFactorPos int) ([]*series, error) {
+	windowArg := getArg(fe.Args, "windowSize", 1)
+	if windowArg == nil {
+		return nil, fmt.Errorf("missing %q arg", "windowSize")
+	}
+	windowPoints := 0
+	windowDuration := int64(0)
+	windowString := ""
+	switch t := windowArg.Expr.(type) {
+	case *graphiteql.NumberExpr:
+		windowPoints = int(t.N)
+		if windowPoints <= 0 {
+			return nil, fmt.Errorf("windowSize must be positive; got %d", windowPoints)
+		}
+		windowString = strconv.Itoa(windowPoints)
+	case *graphiteql.StringExpr:
+		d, err := parseInterval(t.S)
+		if err != nil {
+			return nil, err
+		}
+		if d < 0 {
+			d = -d
+		}
+		if d == 0 {
+			return nil, fmt.Errorf("windowSize must be positive; got %q", t.S)
+		}
+		windowDuration = d
+		windowString = strconv.Quote(t.S)
+	default:
+		return nil, fmt.Errorf("windowSize must be either a number or a string; got %q", windowArg.Expr.AppendString(nil))
+	}
+	xFilesFactor, err := getOptionalNumberArg(fe.Args, "xFilesFactor", xFilesFactorPos, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch additional points preceding the start of the selected time range, so the first points have full windows.
+	bootstrap := windowDuration
+	if windowPoints > 0 {
+		bootstrap = int64(windowPoints) * ec.storageStep
+	}
+	ecBootstrap := ec.withTimeRange(ec.startTime-bootstrap, ec.endTime)
+	ss, err := getSeriesArg(ecBootstrap, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		window := windowDuration
+		if windowPoints > 0 {
+			window = int64(windowPoints) * s.step
+		}
+		movingWindowSeries(s, ec.startTime, window, af, xFilesFactor)
+		s.rename(fmt.Sprintf("%s(%s,%s)", funcName, s.Name, windowString))
+	}
+	return ss, nil
+}
+
+// movingWindowSeries replaces every point in s starting from start with af calculated over the points on [ts-window ... ts) interval.
+//
+// NaN is returned if the share of non-NaN points in the window is smaller than xFilesFactor.
+func movingWindowSeries(s *series, start, window int64, af aggrFunc, xFilesFactor float64) {
+	var timestamps []int64
+	var values []float64
+	j := 0
+	for i, ts := range s.Timestamps {
+		if ts < start {
+			continue
+		}
+		for j < i && s.Timestamps[j] < ts-window {
+			j++
+		}
+		windowValues := s.Values[j:i]
+		v := af(windowValues)
+		if !hasEnoughPoints(windowValues, xFilesFactor) {
+			v = nan
+		}
+		timestamps = append(timestamps, ts)
+		values = append(values, v)
+	}
+	s.Timestamps = timestamps
+	s.Values = values
+}
+
+func hasEnoughPoints(values []float64, xFilesFactor float64) bool {
+	if len(values) == 0 {
+		return xFilesFactor <= 0
+	}
+	n := 0
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			n++
+		}
+	}
+	return float64(n)/float64(len(values)) >= xFilesFactor
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.timeShift
+func transformTimeShift(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	timeShift, err := getStringArg(fe.Args, "timeShift", 1)
+	if err != nil {
+		return nil, err
+	}
+	s := timeShift
+	if !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "+") {
+		// Graphite shifts series back in time if the sign is missing.
+		s = "-" + s
+	}
+	shift, err := parseInterval(s)
+	if err != nil {
+		return nil, err
+	}
+	ecShifted := ec.withTimeRange(ec.startTime+shift, ec.endTime+shift)
+	ss, err := getSeriesArg(ecShifted, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		timestamps := make([]int64, len(s.Timestamps))
+		for i, ts := range s.Timestamps {
+			timestamps[i] = ts - shift
+		}
+		s.Timestamps = timestamps
+		s.rename(fmt.Sprintf("timeShift(%s, %s)", s.Name, strconv.Quote(timeShift)))
+	}
+	return ss, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.limit
+func transformLimit(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	n, err := getIntArg(fe.Args, "n", 1)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n < len(ss) {
+		ss = ss[:n]
+	}
+	return ss, nil
+}
+
+// newTransformGrep implements grep function if isExclude isn't set. Otherwise it implements exclude function.
+//
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.grep
+// and https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.exclude
+func newTransformGrep(isExclude bool) transformFunc {
+	return func(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+		pattern, err := getStringArg(fe.Args, "pattern", 1)
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile pattern %q: %w", pattern, err)
+		}
+		ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+		if err != nil {
+			return nil, err
+		}
+		dst := ss[:0]
+		for _, s := range ss {
+			if re.MatchString(s.Name) != isExclude {
+				dst = append(dst, s)
+			}
+		}
+		return dst, nil
+	}
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.removeEmptySeries
+func transformRemoveEmptySeries(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	xFilesFactor, err := getOptionalNumberArg(fe.Args, "xFilesFactor", 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	dst := ss[:0]
+	for _, s := range ss {
+		if !math.IsNaN(aggrFirst(s.Values)) && hasEnoughPoints(s.Values, xFilesFactor) {
+			dst = append(dst, s)
+		}
+	}
+	return dst, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.sortByName
+func transformSortByName(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	natural, err := getOptionalBoolArg(fe.Args, "natural", 1, false)
+	if err != nil {
+		return nil, err
+	}
+	reverse, err := getOptionalBoolArg(fe.Args, "reverse", 2, false)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ss, func(i, j int) bool {
+		a, b := ss[i].Name, ss[j].Name
+		if reverse {
+			a, b = b, a
+		}
+		if natural {
+			return naturalLess(a, b)
+		}
+		return a < b
+	})
+	return ss, nil
+}
+
+// naturalLess returns true if a is less than b, while comparing numbers inside a and b by their values.
+func naturalLess(a, b string) bool {
+	for len(a) > 0 && len(b) > 0 {
+		na := numberPrefixLen(a)
+		nb := numberPrefixLen(b)
+		if na > 0 && nb > 0 {
+			va, _ := strconv.ParseUint(a[:na], 10, 64)
+			vb, _ := strconv.ParseUint(b[:nb], 10, 64)
+			if va != vb {
+				return va < vb
+			}
+			a, b = a[na:], b[nb:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func numberPrefixLen(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.sortBy
+func transformSortBy(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	funcName, err := getOptionalStringArg(fe.Args, "func", 1, "average")
+	if err != nil {
+		return nil, err
+	}
+	af, err := getAggrFunc(funcName)
+	if err != nil {
+		return nil, err
+	}
+	reverse, err := getOptionalBoolArg(fe.Args, "reverse", 2, false)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	sortSeriesByAggr(ss, af, reverse)
+	return ss, nil
+}
+
+// sortSeriesByAggr sorts ss by af values in ascending order or in descending order if reverse is set.
+//
+// Series with NaN af values are put at the end.
+func sortSeriesByAggr(ss []*series, af aggrFunc, reverse bool) {
+	keys := make(map[*series]float64, len(ss))
+	for _, s := range ss {
+		keys[s] = af(s.Values)
+	}
+	sort.SliceStable(ss, func(i, j int) bool {
+		a, b := keys[ss[i]], keys[ss[j]]
+		if math.IsNaN(a) {
+			return false
+		}
+		if math.IsNaN(b) {
+			return true
+		}
+		if reverse {
+			return a > b
+		}
+		return a < b
+	})
+}
+
+// newTransformHighest implements highest* and lowest* functions.
+//
+// The aggregate function is read from `func` arg if funcName is empty.
+//
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.highest
+// and https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.lowest
+func newTransformHighest(funcName string, isLowest bool) transformFunc {
+	return func(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+		n, err := getOptionalNumberArg(fe.Args, "n", 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		name := funcName
+		if name == "" {
+			name, err = getOptionalStringArg(fe.Args, "func", 2, "average")
+			if err != nil {
+				return nil, err
+			}
+		}
+		af, err := getAggrFunc(name)
+		if err != nil {
+			return nil, err
+		}
+		ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+		if err != nil {
+			return nil, err
+		}
+		sortSeriesByAggr(ss, af, !isLowest)
+		if int(n) < len(ss) {
+			ss = ss[:int(n)]
+		}
+		return ss, nil
+	}
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.filterSeries
+func transformFilterSeries(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	funcName, err := getStringArg(fe.Args, "func", 1)
+	if err != nil {
+		return nil, err
+	}
+	operator, err := getStringArg(fe.Args, "operator", 2)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := getNumberArg(fe.Args, "threshold", 3)
+	if err != nil {
+		return nil, err
+	}
+	return filterSeries(ec, fe, funcName, operator, threshold)
+}
+
+// newTransformFilterSeries implements currentAbove, averageBelow and similar functions.
+//
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.currentAbove
+func newTransformFilterSeries(funcName, operator string) transformFunc {
+	return func(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+		n, err := getNumberArg(fe.Args, "n", 1)
+		if err != nil {
+			return nil, err
+		}
+		return filterSeries(ec, fe, funcName, operator, n)
+	}
+}
+
+func filterSeries(ec *evalConfig, fe *graphiteql.FuncExpr, funcName, operator string, threshold float64) ([]*series, error) {
+	af, err := getAggrFunc(funcName)
+	if err != nil {
+		return nil, err
+	}
+	var cmp func(v float64) bool
+	switch operator {
+	case "=":
+		cmp = func(v float64) bool { return v == threshold }
+	case "!=":
+		cmp = func(v float64) bool { return v != threshold }
+	case ">":
+		cmp = func(v float64) bool { return v > threshold }
+	case ">=":
+		cmp = func(v float64) bool { return v >= threshold }
+	case "<":
+		cmp = func(v float64) bool { return v < threshold }
+	case "<=":
+		cmp = func(v float64) bool { return v <= threshold }
+	default:
+		return nil, fmt.Errorf("unsupported operator %q; supported operators: =, !=, >, >=, <, <=", operator)
+	}
+	ss, err := getSeriesArg(ec, fe.Args, "seriesList", 0)
+	if err != nil {
+		return nil, err
+	}
+	dst := ss[:0]
+	for _, s := range ss {
+		v := af(s.Values)
+		if !math.IsNaN(v) && cmp(v) {
+			dst = append(dst, s)
+		}
+	}
+	return dst, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.group
+func transformGroup(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	return getSeriesArgs(ec, fe.Args, 0)
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.constantLine
+func transformConstantLine(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	value, err := getNumberArg(fe.Args, "value", 0)
+	if err != nil {
+		return nil, err
+	}
+	timestamps := getTimestamps(ec.startTime, ec.endTime, ec.storageStep)
+	values := make([]float64, len(timestamps))
+	for i := range values {
+		values[i] = value
+	}
+	name := strconv.FormatFloat(value, 'g', -1, 64)
+	return []*series{{
+		Name: name,
+		Tags: map[string]string{
+			"name": name,
+		},
+		Timestamps:      timestamps,
+		Values:          values,
+		pathExpression:  name,
+		consolidateFunc: aggrAvg,
+		step:            ec.storageStep,
+	}}, nil
+}
+
+// See https://graphite.readthedocs.io/en/stable/functions.html#graphite.render.functions.seriesByTag
+func transformSeriesByTag(ec *evalConfig, fe *graphiteql.FuncExpr) ([]*series, error) {
+	if len(fe.Args) == 0 {
+		return nil, fmt.Errorf("at least a single tag expression must be passed")
+	}
+	exprs := make([]string, 0, len(fe.Args))
+	for _, arg := range fe.Args {
+		se, ok := arg.Expr.(*graphiteql.StringExpr)
+		if !ok {
+			return nil, fmt.Errorf("tag expression must be a string; got %q", arg.Expr.AppendString(nil))
+		}
+		exprs = append(exprs, se.S)
+	}
+	tfs, err := exprsToTagFilters(exprs)
+	if err != nil {
+		return nil, err
+	}
+	return fetchSeries(ec, tfs, string(fe.AppendString(nil)))
+}
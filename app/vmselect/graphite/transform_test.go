@@ -0,0 +1,299 @@
+package graphite
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/graphiteql"
+)
+
+func TestAggrFuncs(t *testing.T) {
+	f := func(funcName string, values []float64, resultExpected float64) {
+		t.Helper()
+		af, err := getAggrFunc(funcName)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := af(values)
+		if math.IsNaN(resultExpected) {
+			if !math.IsNaN(result) {
+				t.Fatalf("unexpected result for %s(%v); got %v; want NaN", funcName, values, result)
+			}
+			return
+		}
+		if math.Abs(result-resultExpected) > 1e-12 {
+			t.Fatalf("unexpected result for %s(%v); got %v; want %v", funcName, values, result, resultExpected)
+		}
+	}
+	values := []float64{nan, 4, 1, nan, 3, 2}
+	f("sum", values, 10)
+	f("sumSeries", values, 10)
+	f("average", values, 2.5)
+	f("avg", values, 2.5)
+	f("avg_zero", values, 10.0/6)
+	f("min", values, 1)
+	f("max", values, 4)
+	f("median", values, 2.5)
+	f("median", []float64{3, nan, 1, 2}, 2)
+	f("first", values, 4)
+	f("last", values, 2)
+	f("current", values, 2)
+	f("count", values, 4)
+	f("diff", values, -2)
+	f("multiply", values, 24)
+	f("range", values, 3)
+	f("rangeOfSeries", values, 3)
+	f("stddev", values, math.Sqrt(1.25))
+	for funcName := range aggrFuncs {
+		f(funcName, nil, nan)
+		if funcName != "avg_zero" {
+			f(funcName, []float64{nan, nan}, nan)
+		}
+	}
+	f("avg_zero", []float64{nan, nan}, 0)
+}
+
+func TestGetAggrFuncError(t *testing.T) {
+	if _, err := getAggrFunc("foobar"); err == nil {
+		t.Fatalf("expecting non-nil error for unknown aggregate function")
+	}
+}
+
+func TestSeriesConsolidate(t *testing.T) {
+	f := func(maxDataPoints int, cf aggrFunc, timestampsExpected []int64, valuesExpected []float64, stepExpected int64) {
+		t.Helper()
+		s := &series{
+			Timestamps:      []int64{10, 20, 30, 40, 50},
+			Values:          []float64{1, 2, nan, 4, 5},
+			consolidateFunc: cf,
+			step:            10,
+		}
+		s.consolidate(maxDataPoints)
+		if !reflect.DeepEqual(s.Timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps; got %v; want %v", s.Timestamps, timestampsExpected)
+		}
+		if !equalValues(s.Values, valuesExpected) {
+			t.Fatalf("unexpected values; got %v; want %v", s.Values, valuesExpected)
+		}
+		if s.step != stepExpected {
+			t.Fatalf("unexpected step; got %d; want %d", s.step, stepExpected)
+		}
+	}
+	f(0, aggrAvg, []int64{10, 20, 30, 40, 50}, []float64{1, 2, nan, 4, 5}, 10)
+	f(5, aggrAvg, []int64{10, 20, 30, 40, 50}, []float64{1, 2, nan, 4, 5}, 10)
+	f(3, aggrAvg, []int64{10, 30, 50}, []float64{1.5, 4, 5}, 20)
+	f(3, aggrMax, []int64{10, 30, 50}, []float64{2, 4, 5}, 20)
+	f(1, aggrSum, []int64{10}, []float64{12}, 50)
+}
+
+func TestNormalizeValues(t *testing.T) {
+	timestamps := []int64{100, 110, 120, 130}
+	values := normalizeValues(timestamps, 10, []int64{95, 100, 105, 121, 145}, []float64{1, 2, 4, 5, 6})
+	valuesExpected := []float64{3, nan, 5, nan}
+	if !equalValues(values, valuesExpected) {
+		t.Fatalf("unexpected values; got %v; want %v", values, valuesExpected)
+	}
+}
+
+func TestNormalizeSeries(t *testing.T) {
+	s1 := &series{
+		Timestamps: []int64{0, 10, 20, 30},
+		Values:     []float64{1, 2, 3, 4},
+		step:       10,
+	}
+	s2 := &series{
+		Timestamps: []int64{0, 20},
+		Values:     []float64{5, 6},
+		step:       20,
+	}
+	timestamps, step := normalizeSeries([]*series{s1, s2})
+	if step != 20 {
+		t.Fatalf("unexpected step; got %d; want 20", step)
+	}
+	timestampsExpected := []int64{0, 20}
+	if !reflect.DeepEqual(timestamps, timestampsExpected) {
+		t.Fatalf("unexpected timestamps; got %v; want %v", timestamps, timestampsExpected)
+	}
+	if !equalValues(s1.Values, []float64{1.5, 3.5}) {
+		t.Fatalf("unexpected values for s1; got %v", s1.Values)
+	}
+	if !equalValues(s2.Values, []float64{5, 6}) {
+		t.Fatalf("unexpected values for s2; got %v", s2.Values)
+	}
+}
+
+func TestSummarizeSeries(t *testing.T) {
+	f := func(alignToFrom bool, timestampsExpected []int64, valuesExpected []float64) {
+		t.Helper()
+		s := &series{
+			Timestamps: []int64{10, 20, 30, 40, 50, 60},
+			Values:     []float64{1, 2, 3, nan, 5, 6},
+			step:       10,
+		}
+		summarizeSeries(s, 30, aggrSum, alignToFrom)
+		if !reflect.DeepEqual(s.Timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps; got %v; want %v", s.Timestamps, timestampsExpected)
+		}
+		if !equalValues(s.Values, valuesExpected) {
+			t.Fatalf("unexpected values; got %v; want %v", s.Values, valuesExpected)
+		}
+		if s.step != 30 {
+			t.Fatalf("unexpected step; got %d; want 30", s.step)
+		}
+	}
+	f(false, []int64{0, 30, 60}, []float64{3, 8, 6})
+	f(true, []int64{10, 40}, []float64{6, 11})
+}
+
+func TestMovingWindowSeries(t *testing.T) {
+	f := func(window int64, xFilesFactor float64, valuesExpected []float64) {
+		t.Helper()
+		s := &series{
+			Timestamps: []int64{0, 10, 20, 30, 40, 50},
+			Values:     []float64{1, 2, nan, 4, 5, 6},
+			step:       10,
+		}
+		movingWindowSeries(s, 20, window, aggrAvg, xFilesFactor)
+		timestampsExpected := []int64{20, 30, 40, 50}
+		if !reflect.DeepEqual(s.Timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps; got %v; want %v", s.Timestamps, timestampsExpected)
+		}
+		if !equalValues(s.Values, valuesExpected) {
+			t.Fatalf("unexpected values; got %v; want %v", s.Values, valuesExpected)
+		}
+	}
+	f(20, 0, []float64{1.5, 2, 4, 4.5})
+	f(20, 1, []float64{1.5, nan, nan, 4.5})
+	f(10, 0, []float64{2, nan, 4, 5})
+}
+
+func TestKeepLastValue(t *testing.T) {
+	f := func(values []float64, limit float64, valuesExpected []float64) {
+		t.Helper()
+		keepLastValue(values, limit)
+		if !equalValues(values, valuesExpected) {
+			t.Fatalf("unexpected values; got %v; want %v", values, valuesExpected)
+		}
+	}
+	inf := math.Inf(1)
+	f([]float64{nan, 1, nan, nan, 2, nan}, inf, []float64{nan, 1, 1, 1, 2, 2})
+	f([]float64{nan, 1, nan, nan, 2, nan}, 1, []float64{nan, 1, nan, nan, 2, 2})
+	f([]float64{1, nan, nan}, 1, []float64{1, nan, nan})
+	f([]float64{nan, nan}, inf, []float64{nan, nan})
+}
+
+func TestNonNegativeDeltaValue(t *testing.T) {
+	f := func(prev, v, maxValue, resultExpected float64) {
+		t.Helper()
+		result := nonNegativeDeltaValue(prev, v, maxValue)
+		if !equalValues([]float64{result}, []float64{resultExpected}) {
+			t.Fatalf("unexpected result for nonNegativeDeltaValue(%v, %v, %v); got %v; want %v", prev, v, maxValue, result, resultExpected)
+		}
+	}
+	f(nan, 1, nan, nan)
+	f(1, nan, nan, nan)
+	f(1, 3, nan, 2)
+	f(3, 1, nan, nan)
+	f(254, 2, 255, 4)
+	f(254, 300, 255, 46)
+}
+
+func TestGetNodesKey(t *testing.T) {
+	f := func(name string, tags map[string]string, nodes []graphiteql.Expr, resultExpected string) {
+		t.Helper()
+		s := &series{
+			Name: name,
+			Tags: tags,
+		}
+		result := getNodesKey(s, nodes)
+		if result != resultExpected {
+			t.Fatalf("unexpected key for %q; got %q; want %q", name, result, resultExpected)
+		}
+	}
+	n := func(n float64) graphiteql.Expr {
+		return &graphiteql.NumberExpr{N: n}
+	}
+	tag := func(s string) graphiteql.Expr {
+		return &graphiteql.StringExpr{S: s}
+	}
+	f("foo.bar.baz", nil, []graphiteql.Expr{n(1)}, "bar")
+	f("foo.bar.baz", nil, []graphiteql.Expr{n(0), n(-1)}, "foo.baz")
+	f("foo.bar.baz", nil, []graphiteql.Expr{n(5)}, "")
+	f("scale(sumSeries(foo.bar.baz,1),2)", nil, []graphiteql.Expr{n(1)}, "bar")
+	f("cpu.total;host=h1", map[string]string{"name": "cpu.total", "host": "h1"}, []graphiteql.Expr{tag("host"), n(1)}, "h1.total")
+}
+
+func TestTaggedName(t *testing.T) {
+	tags := map[string]string{
+		"name": "cpu",
+		"host": "h1",
+		"dc":   "x",
+	}
+	name := formatTaggedName(tags)
+	if name != "cpu;dc=x;host=h1" {
+		t.Fatalf("unexpected name; got %q; want %q", name, "cpu;dc=x;host=h1")
+	}
+	if result := parseTaggedName(name); !reflect.DeepEqual(result, tags) {
+		t.Fatalf("unexpected tags; got %v; want %v", result, tags)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	f := func(a, b string, resultExpected bool) {
+		t.Helper()
+		if result := naturalLess(a, b); result != resultExpected {
+			t.Fatalf("unexpected result for naturalLess(%q, %q); got %v; want %v", a, b, result, resultExpected)
+		}
+	}
+	f("", "", false)
+	f("", "a", true)
+	f("a", "", false)
+	f("foo2", "foo10", true)
+	f("foo10", "foo2", false)
+	f("foo10.bar", "foo10.baz", true)
+	f("foo", "foo1", true)
+}
+
+func TestSortSeriesByAggr(t *testing.T) {
+	newSeries := func(name string, values ...float64) *series {
+		return &series{
+			Name:   name,
+			Values: values,
+		}
+	}
+	f := func(reverse bool, namesExpected []string) {
+		t.Helper()
+		ss := []*series{
+			newSeries("a", 2, 3),
+			newSeries("b", nan),
+			newSeries("c", 1),
+			newSeries("d", 5, nan),
+		}
+		sortSeriesByAggr(ss, aggrMax, reverse)
+		var names []string
+		for _, s := range ss {
+			names = append(names, s.Name)
+		}
+		if !reflect.DeepEqual(names, namesExpected) {
+			t.Fatalf("unexpected order; got %v; want %v", names, namesExpected)
+		}
+	}
+	f(false, []string{"c", "a", "d", "b"})
+	f(true, []string{"d", "a", "c", "b"})
+}
+
+func equalValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.IsNaN(a[i]) != math.IsNaN(b[i]) {
+			return false
+		}
+		if !math.IsNaN(a[i]) && math.Abs(a[i]-b[i]) > 1e-12 {
+			return false
+		}
+	}
+	return true
+}
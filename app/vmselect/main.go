@@ -24,7 +24,9 @@ import (
 )
 
 var (
-	deleteAuthKey         = flag.String("deleteAuthKey", "", "authKey for metrics' deletion via /api/v1/admin/tsdb/delete_series and /tags/delSeries")
+	deleteAuthKey = flag.String("deleteAuthKey", "", "authKey for metrics' deletion via /api/v1/admin/tsdb/delete_series and /tags/delSeries. "+
+		"It is also used for resetting metric names stats via /api/v1/admin/status/metric_names_stats/reset "+
+		"and for dropping and force-merging partitions via /api/v1/admin/partitions/drop and /api/v1/admin/partitions/force_merge")
 	maxConcurrentRequests = flag.Int("search.maxConcurrentRequests", getDefaultMaxConcurrentRequests(), "The maximum number of concurrent search requests. "+
 		"It shouldn't be high, since a single request can saturate all the CPU cores. See also -search.maxQueueDuration")
 	maxQueueDuration = flag.Duration("search.maxQueueDuration", 10*time.Second, "The maximum time the request waits for execution when -search.maxConcurrentRequests "+
@@ -51,10 +53,15 @@ func getDefaultMaxConcurrentRequests() int {
 
 // Init initializes vmselect
 func Init() {
-	tmpDirPath := *vmstorage.DataPath + "/tmp"
+	dataPath := *vmstorage.DataPath
+	if *vmstorage.ReadOnlyReplica {
+		// -storageDataPath mustn't be modified in read-only replica mode.
+		dataPath = *vmstorage.ReplicaTmpDataPath
+	}
+	tmpDirPath := dataPath + "/tmp"
 	fs.RemoveDirContents(tmpDirPath)
 	netstorage.InitTmpBlocksDir(tmpDirPath)
-	promql.InitRollupResultCache(*vmstorage.DataPath + "/cache/rollupResult")
+	promql.InitRollupResultCache(dataPath + "/cache/rollupResult")
 
 	concurrencyCh = make(chan struct{}, *maxConcurrentRequests)
 }
@@ -214,6 +221,15 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/api/v1/query/explain":
+		queryExplainRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.QueryExplainHandler(startTime, w, r); err != nil {
+			queryExplainErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "/api/v1/query_range":
 		queryRangeRequests.Inc()
 		httpserver.EnableCORS(w, r)
@@ -267,6 +283,33 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/api/v1/status/cardinality":
+		statusCardinalityRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.CardinalityHandler(startTime, w, r); err != nil {
+			statusCardinalityErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "/api/v1/status/churn":
+		statusChurnRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.ChurnHandler(startTime, w, r); err != nil {
+			statusChurnErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "/api/v1/status/metric_names_stats":
+		statusMetricNamesStatsRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.MetricNamesStatsHandler(startTime, w, r); err != nil {
+			statusMetricNamesStatsErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "/api/v1/status/active_queries":
 		statusActiveQueriesRequests.Inc()
 		promql.WriteActiveQueries(w)
@@ -311,6 +354,23 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/api/v1/read":
+		remoteReadRequests.Inc()
+		if err := prometheus.RemoteReadHandler(startTime, w, r); err != nil {
+			remoteReadErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
+	case "/render":
+		graphiteRenderRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := graphite.RenderHandler(startTime, w, r); err != nil {
+			graphiteRenderErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
 	case "/metrics/find", "/metrics/find/":
 		graphiteMetricsFindRequests.Inc()
 		httpserver.EnableCORS(w, r)
@@ -414,16 +474,20 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		fmt.Fprintf(w, "%s", `{"status":"success","data":{"alerts":[]}}`)
 		return true
 	case "/api/v1/metadata":
-		// Return dumb placeholder for https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
 		metadataRequests.Inc()
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, "%s", `{"status":"success","data":{}}`)
+		if err := prometheus.MetadataHandler(startTime, w, r); err != nil {
+			metadataErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
 		return true
 	case "/api/v1/query_exemplars":
-		// Return dumb placeholder for https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
 		queryExemplarsRequests.Inc()
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, "%s", `{"status":"success","data":[]}`)
+		if err := prometheus.QueryExemplarsHandler(startTime, w, r); err != nil {
+			queryExemplarsErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
 		return true
 	case "/api/v1/admin/tsdb/delete_series":
 		deleteRequests.Inc()
@@ -439,6 +503,66 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		}
 		w.WriteHeader(http.StatusNoContent)
 		return true
+	case "/api/v1/admin/status/metric_names_stats/reset":
+		resetMetricNamesStatsRequests.Inc()
+		authKey := r.FormValue("authKey")
+		if authKey != *deleteAuthKey {
+			httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -deleteAuthKey command line flag", authKey)
+			return true
+		}
+		vmstorage.ResetMetricNamesStats()
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	case "/api/v1/admin/partitions":
+		partitionsRequests.Inc()
+		if err := prometheus.PartitionsHandler(startTime, w, r); err != nil {
+			partitionsErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "/api/v1/admin/partitions/drop":
+		dropPartitionRequests.Inc()
+		authKey := r.FormValue("authKey")
+		if authKey != *deleteAuthKey {
+			httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -deleteAuthKey command line flag", authKey)
+			return true
+		}
+		if err := prometheus.DropPartitionHandler(r); err != nil {
+			dropPartitionErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	case "/api/v1/admin/partitions/force_merge":
+		forceMergePartitionRequests.Inc()
+		authKey := r.FormValue("authKey")
+		if authKey != *deleteAuthKey {
+			httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -deleteAuthKey command line flag", authKey)
+			return true
+		}
+		if err := prometheus.ForceMergePartitionHandler(startTime, r); err != nil {
+			forceMergePartitionErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return true
+	case "/api/v1/admin/query/cancel":
+		cancelQueryRequests.Inc()
+		authKey := r.FormValue("authKey")
+		if authKey != *deleteAuthKey {
+			httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -deleteAuthKey command line flag", authKey)
+			return true
+		}
+		if err := prometheus.CancelQueryHandler(r); err != nil {
+			cancelQueryErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return true
 	default:
 		return false
 	}
@@ -478,6 +602,9 @@ var (
 	queryRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query"}`)
 	queryErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query"}`)
 
+	queryExplainRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query/explain"}`)
+	queryExplainErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query/explain"}`)
+
 	queryRangeRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query_range"}`)
 	queryRangeErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query_range"}`)
 
@@ -496,6 +623,15 @@ var (
 	statusTSDBRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/tsdb"}`)
 	statusTSDBErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/tsdb"}`)
 
+	statusCardinalityRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/cardinality"}`)
+	statusCardinalityErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/cardinality"}`)
+
+	statusChurnRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/churn"}`)
+	statusChurnErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/churn"}`)
+
+	statusMetricNamesStatsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/metric_names_stats"}`)
+	statusMetricNamesStatsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/metric_names_stats"}`)
+
 	statusActiveQueriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/active_queries"}`)
 
 	topQueriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/top_queries"}`)
@@ -504,6 +640,20 @@ var (
 	deleteRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/admin/tsdb/delete_series"}`)
 	deleteErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/admin/tsdb/delete_series"}`)
 
+	resetMetricNamesStatsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/admin/status/metric_names_stats/reset"}`)
+
+	partitionsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/admin/partitions"}`)
+	partitionsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/admin/partitions"}`)
+
+	dropPartitionRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/admin/partitions/drop"}`)
+	dropPartitionErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/admin/partitions/drop"}`)
+
+	forceMergePartitionRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/admin/partitions/force_merge"}`)
+	forceMergePartitionErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/admin/partitions/force_merge"}`)
+
+	cancelQueryRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/admin/query/cancel"}`)
+	cancelQueryErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/admin/query/cancel"}`)
+
 	exportRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/export"}`)
 	exportErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/export"}`)
 
@@ -516,6 +666,12 @@ var (
 	federateRequests = metrics.NewCounter(`vm_http_requests_total{path="/federate"}`)
 	federateErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/federate"}`)
 
+	remoteReadRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/read"}`)
+	remoteReadErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/read"}`)
+
+	graphiteRenderRequests = metrics.NewCounter(`vm_http_requests_total{path="/render"}`)
+	graphiteRenderErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/render"}`)
+
 	graphiteMetricsFindRequests = metrics.NewCounter(`vm_http_requests_total{path="/metrics/find"}`)
 	graphiteMetricsFindErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/metrics/find"}`)
 
@@ -554,5 +710,7 @@ var (
 	rulesRequests          = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/rules"}`)
 	alertsRequests         = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/alerts"}`)
 	metadataRequests       = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/metadata"}`)
+	metadataErrors         = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/metadata"}`)
 	queryExemplarsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query_exemplars"}`)
+	queryExemplarsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query_exemplars"}`)
 )
@@ -17,6 +17,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastrand"
@@ -29,6 +30,7 @@ var (
 	maxMetricsPerSearch          = flag.Int("search.maxUniqueTimeseries", 300e3, "The maximum number of unique time series each search can scan. This option allows limiting memory usage")
 	maxSamplesPerSeries          = flag.Int("search.maxSamplesPerSeries", 30e6, "The maximum number of raw samples a single query can scan per each time series. This option allows limiting memory usage")
 	maxSamplesPerQuery           = flag.Int("search.maxSamplesPerQuery", 1e9, "The maximum number of raw samples a single query can process across all time series. This protects from heavy queries, which select unexpectedly high number of raw samples. See also -search.maxSamplesPerSeries")
+	maxCardinalityItems          = flag.Int("search.maxCardinalityItems", 10e6, "The maximum number of unique series per label=value pairs /api/v1/status/cardinality can track for the requested time range. Every series is counted once per each of its label=value pairs. This option allows limiting memory usage")
 )
 
 // Result is a single timeseries result.
@@ -193,7 +195,8 @@ var resultPool sync.Pool
 // Data processing is immediately stopped if f returns non-nil error.
 //
 // rss becomes unusable after the call to RunParallel.
-func (rss *Results) RunParallel(f func(rs *Result, workerID uint) error) error {
+func (rss *Results) RunParallel(qt *querytracer.Tracer, f func(rs *Result, workerID uint) error) error {
+	qt = qt.NewChild("parallel process of fetched data")
 	defer rss.mustClose()
 
 	// Spin up local workers.
@@ -255,6 +258,7 @@ func (rss *Results) RunParallel(f func(rs *Result, workerID uint) error) error {
 		close(workCh)
 	}
 	workChsWG.Wait()
+	qt.Donef("series=%d, samples=%d", seriesProcessedTotal, rowsProcessedTotal)
 
 	return firstErr
 }
@@ -533,7 +537,14 @@ func mergeSortBlocks(dst *Result, sbh sortBlocksHeap, dedupInterval int64) {
 			putSortBlock(top)
 		}
 	}
-	timestamps, values := storage.DeduplicateSamples(dst.Timestamps, dst.Values, dedupInterval)
+	// Query results are processed in milliseconds regardless of the storage precision.
+	// Convert timestamps to milliseconds after the merge, so samples are ordered with the storage precision.
+	timestamps, values := dst.Timestamps, dst.Values
+	if storage.TimestampsPerMsec() > 1 {
+		storage.TimestampsToMsecs(timestamps)
+		timestamps, values = mergeSamplesWithIdenticalTimestamps(timestamps, values)
+	}
+	timestamps, values = storage.DeduplicateSamples(timestamps, values, dedupInterval)
 	dedups := len(dst.Timestamps) - len(timestamps)
 	dedupsDuringSelect.Add(dedups)
 	dst.Timestamps = timestamps
@@ -542,6 +553,27 @@ func mergeSortBlocks(dst *Result, sbh sortBlocksHeap, dedupInterval int64) {
 
 var dedupsDuringSelect = metrics.NewCounter(`vm_deduplicated_samples_total{type="select"}`)
 
+// mergeSamplesWithIdenticalTimestamps leaves only the last sample per each timestamp in sorted timestamps.
+//
+// Samples stored with sub-millisecond precision may have identical timestamps after the conversion to milliseconds.
+// Such samples are merged into a single sample, since query engine requires unique timestamps.
+func mergeSamplesWithIdenticalTimestamps(timestamps []int64, values []float64) ([]int64, []float64) {
+	if len(timestamps) < 2 {
+		return timestamps, values
+	}
+	dstTimestamps := timestamps[:1]
+	dstValues := values[:1]
+	for i := 1; i < len(timestamps); i++ {
+		if timestamps[i] == dstTimestamps[len(dstTimestamps)-1] {
+			dstValues[len(dstValues)-1] = values[i]
+			continue
+		}
+		dstTimestamps = append(dstTimestamps, timestamps[i])
+		dstValues = append(dstValues, values[i])
+	}
+	return dstTimestamps, dstValues
+}
+
 type sortBlock struct {
 	Timestamps []int64
 	Values     []float64
@@ -607,6 +639,21 @@ func DeleteSeries(sq *storage.SearchQuery, deadline searchutils.Deadline) (int,
 	return vmstorage.DeleteMetrics(tfss)
 }
 
+// DeleteSeriesOnTimeRange deletes samples on the sq time range for series matching sq.
+//
+// Returns the number of series with deleted samples.
+func DeleteSeriesOnTimeRange(sq *storage.SearchQuery, deadline searchutils.Deadline) (int, error) {
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	tfss, err := setupTfss(tr, sq.TagFilterss, deadline)
+	if err != nil {
+		return 0, err
+	}
+	return vmstorage.DeleteSeriesOnTimeRange(tfss, tr)
+}
+
 // GetLabelsOnTimeRange returns labels for the given tr until the given deadline.
 func GetLabelsOnTimeRange(tr storage.TimeRange, deadline searchutils.Deadline) ([]string, error) {
 	if deadline.Exceeded() {
@@ -839,6 +886,82 @@ func GetTSDBStatusWithFilters(deadline searchutils.Deadline, sq *storage.SearchQ
 	return status, nil
 }
 
+// GetCardinalityStatus returns cardinality explorer data for series matching sq.
+//
+// Series for all the time series are taken into account if sq has no tag filters.
+func GetCardinalityStatus(deadline searchutils.Deadline, sq *storage.SearchQuery, focusLabel string, topN int) (*storage.CardinalityStatus, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	var tfss []*storage.TagFilters
+	if len(sq.TagFilterss) > 0 {
+		var err error
+		tfss, err = setupTfss(tr, sq.TagFilterss, deadline)
+		if err != nil {
+			return nil, err
+		}
+	}
+	status, err := vmstorage.GetCardinalityStatus(tfss, tr, focusLabel, topN, *maxCardinalityItems, deadline.Deadline())
+	if err != nil {
+		return nil, fmt.Errorf("error during cardinality status request: %w", err)
+	}
+	return status, nil
+}
+
+// GetChurn returns series churn stats.
+//
+// Daily stats on the given tr is returned if isHourly is false.
+// Otherwise hourly stats for the last finished hour and for the current hour is returned.
+func GetChurn(deadline searchutils.Deadline, tr storage.TimeRange, isHourly bool, topN int) ([]storage.ChurnStatus, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	var css []storage.ChurnStatus
+	var err error
+	if isHourly {
+		css, err = vmstorage.GetHourlyChurn(topN, deadline.Deadline())
+	} else {
+		css, err = vmstorage.GetDailyChurn(tr, topN, deadline.Deadline())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error during churn status request: %w", err)
+	}
+	return css, nil
+}
+
+// GetMetricNamesStats returns query stats per metric name.
+//
+// See vmstorage.GetMetricNamesStats for details on args.
+func GetMetricNamesStats(deadline searchutils.Deadline, limit, le int, matchPattern string) ([]storage.MetricNameStats, uint64, error) {
+	if deadline.Exceeded() {
+		return nil, 0, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	mnss, startTimestamp := vmstorage.GetMetricNamesStats(limit, le, matchPattern)
+	return mnss, startTimestamp, nil
+}
+
+// GetPartitionsStats returns stats for storage partitions.
+func GetPartitionsStats(deadline searchutils.Deadline) ([]storage.PartitionStats, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	return vmstorage.GetPartitionsStats(), nil
+}
+
+// DropPartition drops the storage partition with the given name.
+func DropPartition(name string) error {
+	return vmstorage.DropPartition(name)
+}
+
+// ForceMergePartition force-merges the storage partition with the given name.
+func ForceMergePartition(name string) error {
+	return vmstorage.ForceMergePartition(name)
+}
+
 // GetSeriesCount returns the number of unique series.
 func GetSeriesCount(deadline searchutils.Deadline) (uint64, error) {
 	if deadline.Exceeded() {
@@ -851,6 +974,24 @@ func GetSeriesCount(deadline searchutils.Deadline) (uint64, error) {
 	return n, nil
 }
 
+// GetMetricMetadata returns metadata for the given metric.
+//
+// Metadata for all the metrics is returned if metric is empty.
+// Up to limit metric families are returned if limit > 0.
+func GetMetricMetadata(metric string, limit int, deadline searchutils.Deadline) ([]storage.MetricMetadata, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	mms, err := vmstorage.SearchMetricMetadata(metric, limit, deadline.Deadline())
+	if err != nil {
+		if errors.Is(err, storage.ErrDeadlineExceeded) {
+			return nil, fmt.Errorf("timeout exceeded during the query: %s", deadline.String())
+		}
+		return nil, fmt.Errorf("error during metric metadata request: %w", err)
+	}
+	return mms, nil
+}
+
 func getStorageSearch() *storage.Search {
 	v := ssPool.Get()
 	if v == nil {
@@ -894,7 +1035,7 @@ func ExportBlocks(sq *storage.SearchQuery, deadline searchutils.Deadline, f func
 	sr := getStorageSearch()
 	defer putStorageSearch(sr)
 	startTime := time.Now()
-	sr.Init(vmstorage.Storage, tfss, tr, *maxMetricsPerSearch, deadline.Deadline())
+	sr.Init(nil, vmstorage.Storage, tfss, tr, *maxMetricsPerSearch, deadline.Deadline(), deadline.CanceledFlag())
 	indexSearchDuration.UpdateDuration(startTime)
 
 	// Start workers that call f in parallel on available CPU cores.
@@ -1003,10 +1144,79 @@ func SearchMetricNames(sq *storage.SearchQuery, deadline searchutils.Deadline) (
 	return mns, nil
 }
 
+// EstimateSearchQuery estimates the number of series and samples sq selects until the given deadline.
+//
+// The estimation is performed without reading data blocks.
+func EstimateSearchQuery(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutils.Deadline) (*storage.SearchEstimate, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting the query estimation: %s", deadline.String())
+	}
+
+	// Setup search.
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	if err := vmstorage.CheckTimeRange(tr); err != nil {
+		return nil, err
+	}
+	tfss, err := setupTfss(tr, sq.TagFilterss, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	se, err := vmstorage.EstimateSearch(qt, tfss, tr, *maxMetricsPerSearch, deadline.Deadline())
+	if err != nil {
+		if errors.Is(err, storage.ErrDeadlineExceeded) {
+			return nil, fmt.Errorf("timeout exceeded during the query estimation: %s", deadline.String())
+		}
+		return nil, fmt.Errorf("cannot estimate search query %s: %w", sq, err)
+	}
+	return se, nil
+}
+
+// ExemplarsResult contains exemplars for a single time series.
+type ExemplarsResult struct {
+	// The name of the metric.
+	MetricName storage.MetricName
+
+	// Exemplars for the metric sorted by timestamp.
+	Exemplars []storage.Exemplar
+}
+
+// SearchExemplars returns exemplars for time series matching the given sq.
+//
+// Time series without exemplars on the sq time range are skipped.
+func SearchExemplars(sq *storage.SearchQuery, deadline searchutils.Deadline) ([]ExemplarsResult, error) {
+	mns, err := SearchMetricNames(sq, deadline)
+	if err != nil {
+		return nil, err
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	var ers []ExemplarsResult
+	for i := range mns {
+		if deadline.Exceeded() {
+			return nil, fmt.Errorf("timeout exceeded while searching for exemplars: %s", deadline.String())
+		}
+		exemplars := vmstorage.SearchExemplars(nil, &mns[i], tr)
+		if len(exemplars) == 0 {
+			continue
+		}
+		ers = append(ers, ExemplarsResult{
+			MetricName: mns[i],
+			Exemplars:  exemplars,
+		})
+	}
+	return ers, nil
+}
+
 // ProcessSearchQuery performs sq until the given deadline.
 //
 // Results.RunParallel or Results.Cancel must be called on the returned Results.
-func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline searchutils.Deadline) (*Results, error) {
+func ProcessSearchQuery(qt *querytracer.Tracer, sq *storage.SearchQuery, fetchData bool, deadline searchutils.Deadline) (*Results, error) {
 	if deadline.Exceeded() {
 		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
 	}
@@ -1016,6 +1226,8 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline search
 		MinTimestamp: sq.MinTimestamp,
 		MaxTimestamp: sq.MaxTimestamp,
 	}
+	qt = qt.NewChild("fetch matching series: timeRange=%s, fetchData=%v", &tr, fetchData)
+	defer qt.Done()
 	if err := vmstorage.CheckTimeRange(tr); err != nil {
 		return nil, err
 	}
@@ -1029,7 +1241,7 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline search
 
 	sr := getStorageSearch()
 	startTime := time.Now()
-	maxSeriesCount := sr.Init(vmstorage.Storage, tfss, tr, *maxMetricsPerSearch, deadline.Deadline())
+	maxSeriesCount := sr.Init(qt, vmstorage.Storage, tfss, tr, *maxMetricsPerSearch, deadline.Deadline(), deadline.CanceledFlag())
 	indexSearchDuration.UpdateDuration(startTime)
 	m := make(map[string][]blockRef, maxSeriesCount)
 	orderedMetricNames := make([]string, 0, maxSeriesCount)
@@ -1086,6 +1298,8 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline search
 		putStorageSearch(sr)
 		return nil, fmt.Errorf("cannot finalize temporary file: %w", err)
 	}
+	vmstorage.UpdateMetricNamesStats(orderedMetricNames)
+	qt.Printf("fetch unique series=%d, blocks=%d, samples=%d, bytes=%d", len(orderedMetricNames), blocksRead, samples, tbf.Len())
 
 	var rss Results
 	rss.tr = tr
@@ -0,0 +1,24 @@
+package netstorage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeSamplesWithIdenticalTimestamps(t *testing.T) {
+	f := func(timestamps []int64, values []float64, timestampsExpected []int64, valuesExpected []float64) {
+		t.Helper()
+		timestamps, values = mergeSamplesWithIdenticalTimestamps(append([]int64{}, timestamps...), append([]float64{}, values...))
+		if !reflect.DeepEqual(timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps; got %d; want %d", timestamps, timestampsExpected)
+		}
+		if !reflect.DeepEqual(values, valuesExpected) {
+			t.Fatalf("unexpected values; got %v; want %v", values, valuesExpected)
+		}
+	}
+	f([]int64{}, []float64{}, []int64{}, []float64{})
+	f([]int64{1}, []float64{10}, []int64{1}, []float64{10})
+	f([]int64{1, 2, 3}, []float64{10, 20, 30}, []int64{1, 2, 3}, []float64{10, 20, 30})
+	f([]int64{1, 1, 1}, []float64{10, 20, 30}, []int64{1}, []float64{30})
+	f([]int64{1, 2, 2, 3, 3, 4}, []float64{10, 20, 21, 30, 31, 40}, []int64{1, 2, 3, 4}, []float64{10, 21, 31, 40})
+}
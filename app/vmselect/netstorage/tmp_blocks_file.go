@@ -124,6 +124,11 @@ func (tbf *tmpBlocksFile) WriteBlockRefData(b []byte) (tmpBlockAddr, error) {
 	return addr, nil
 }
 
+// Len returns the number of bytes written to tbf.
+func (tbf *tmpBlocksFile) Len() uint64 {
+	return tbf.offset
+}
+
 func (tbf *tmpBlocksFile) Finalize() error {
 	if tbf.f == nil {
 		return nil
@@ -1,8 +1,10 @@
 package prometheus
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"sort"
@@ -23,8 +25,10 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
 	"github.com/valyala/fastjson/fastfloat"
 	"github.com/valyala/quicktemplate"
 )
@@ -79,7 +83,7 @@ func FederateHandler(startTime time.Time, w http.ResponseWriter, r *http.Request
 		return err
 	}
 	sq := storage.NewSearchQuery(start, end, tagFilterss)
-	rss, err := netstorage.ProcessSearchQuery(sq, true, deadline)
+	rss, err := netstorage.ProcessSearchQuery(nil, sq, true, deadline)
 	if err != nil {
 		return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 	}
@@ -87,7 +91,7 @@ func FederateHandler(startTime time.Time, w http.ResponseWriter, r *http.Request
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
-	err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+	err = rss.RunParallel(nil, func(rs *netstorage.Result, workerID uint) error {
 		if err := bw.Error(); err != nil {
 			return err
 		}
@@ -151,12 +155,12 @@ func ExportCSVHandler(startTime time.Time, w http.ResponseWriter, r *http.Reques
 	}
 	doneCh := make(chan error, 1)
 	if !reduceMemUsage {
-		rss, err := netstorage.ProcessSearchQuery(sq, true, deadline)
+		rss, err := netstorage.ProcessSearchQuery(nil, sq, true, deadline)
 		if err != nil {
 			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 		}
 		go func() {
-			err := rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+			err := rss.RunParallel(nil, func(rs *netstorage.Result, workerID uint) error {
 				if err := bw.Error(); err != nil {
 					return err
 				}
@@ -184,6 +188,7 @@ func ExportCSVHandler(startTime time.Time, w http.ResponseWriter, r *http.Reques
 				xb := exportBlockPool.Get().(*exportBlock)
 				xb.mn = mn
 				xb.timestamps, xb.values = b.AppendRowsWithTimeRangeFilter(xb.timestamps[:0], xb.values[:0], tr)
+				storage.TimestampsToMsecs(xb.timestamps)
 				writeCSVLine(xb)
 				xb.reset()
 				exportBlockPool.Put(xb)
@@ -227,6 +232,10 @@ func ExportNativeHandler(startTime time.Time, w http.ResponseWriter, r *http.Req
 	if err != nil {
 		return err
 	}
+	timestampsPerMsec, err := searchutils.GetTimestampsPerMsec(r)
+	if err != nil {
+		return err
+	}
 	deadline := searchutils.GetDeadlineForExport(r, startTime)
 	tagFilterss, err := getTagFilterssFromRequest(r)
 	if err != nil {
@@ -259,7 +268,15 @@ func ExportNativeHandler(startTime time.Time, w http.ResponseWriter, r *http.Req
 		dst = append(dst, tmp...)
 
 		// Marshal b
-		tmp = b.MarshalPortable(tmp[:0])
+		tmp = b.MarshalPortableExt(tmp[:0], timestampsPerMsec)
+		if len(tmp) == 0 {
+			// All the samples in b are deleted.
+			tmpBuf.B = tmp
+			bbPool.Put(tmpBuf)
+			dstBuf.B = dst[:0]
+			bbPool.Put(dstBuf)
+			return nil
+		}
 		dst = encoding.MarshalUint32(dst, uint32(len(tmp)))
 		dst = append(dst, tmp...)
 
@@ -308,6 +325,13 @@ func ExportHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 	format := r.FormValue("format")
 	maxRowsPerLine := int(fastfloat.ParseInt64BestEffort(r.FormValue("max_rows_per_line")))
 	reduceMemUsage := searchutils.GetBool(r, "reduce_mem_usage")
+	timestampsPerMsec, err := searchutils.GetTimestampsPerMsec(r)
+	if err != nil {
+		return err
+	}
+	if timestampsPerMsec != 1 && format != "" {
+		return fmt.Errorf("`timestamp_precision` query arg is supported only for JSON line format; got format=%q", format)
+	}
 	deadline := searchutils.GetDeadlineForExport(r, startTime)
 	if start >= end {
 		end = start + defaultStep
@@ -316,7 +340,7 @@ func ExportHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return err
 	}
-	if err := exportHandler(w, matches, etfs, start, end, format, maxRowsPerLine, reduceMemUsage, deadline); err != nil {
+	if err := exportHandler(nil, w, matches, etfs, start, end, format, maxRowsPerLine, reduceMemUsage, timestampsPerMsec, deadline); err != nil {
 		return fmt.Errorf("error when exporting data for queries=%q on the time range (start=%d, end=%d): %w", matches, start, end, err)
 	}
 	return nil
@@ -324,7 +348,11 @@ func ExportHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 
 var exportDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/export"}`)
 
-func exportHandler(w http.ResponseWriter, matches []string, etfs [][]storage.TagFilter, start, end int64, format string, maxRowsPerLine int, reduceMemUsage bool, deadline searchutils.Deadline) error {
+// exportHandler exports samples with timestamps in timestampsPerMsec units per millisecond.
+//
+// qt is added to the response only for `promapi` format.
+func exportHandler(qt *querytracer.Tracer, w http.ResponseWriter, matches []string, etfs [][]storage.TagFilter, start, end int64, format string, maxRowsPerLine int, reduceMemUsage bool,
+	timestampsPerMsec int64, deadline searchutils.Deadline) error {
 	writeResponseFunc := WriteExportStdResponse
 	writeLineFunc := func(xb *exportBlock, resultsCh chan<- *quicktemplate.ByteBuffer) {
 		bb := quicktemplate.AcquireByteBuffer()
@@ -340,7 +368,9 @@ func exportHandler(w http.ResponseWriter, matches []string, etfs [][]storage.Tag
 			resultsCh <- bb
 		}
 	} else if format == "promapi" {
-		writeResponseFunc = WriteExportPromAPIResponse
+		writeResponseFunc = func(w io.Writer, resultsCh <-chan *quicktemplate.ByteBuffer) {
+			WriteExportPromAPIResponse(w, resultsCh, qt)
+		}
 		writeLineFunc = func(xb *exportBlock, resultsCh chan<- *quicktemplate.ByteBuffer) {
 			bb := quicktemplate.AcquireByteBuffer()
 			WriteExportPromAPILine(bb, xb)
@@ -390,13 +420,14 @@ func exportHandler(w http.ResponseWriter, matches []string, etfs [][]storage.Tag
 
 	resultsCh := make(chan *quicktemplate.ByteBuffer, cgroup.AvailableCPUs())
 	doneCh := make(chan error, 1)
-	if !reduceMemUsage {
-		rss, err := netstorage.ProcessSearchQuery(sq, true, deadline)
+	// Query results contain timestamps in milliseconds, so raw blocks must be exported for other precisions.
+	if !reduceMemUsage && timestampsPerMsec == 1 {
+		rss, err := netstorage.ProcessSearchQuery(qt, sq, true, deadline)
 		if err != nil {
 			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 		}
 		go func() {
-			err := rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+			err := rss.RunParallel(qt, func(rs *netstorage.Result, workerID uint) error {
 				if err := bw.Error(); err != nil {
 					return err
 				}
@@ -424,6 +455,7 @@ func exportHandler(w http.ResponseWriter, matches []string, etfs [][]storage.Tag
 				xb := exportBlockPool.Get().(*exportBlock)
 				xb.mn = mn
 				xb.timestamps, xb.values = b.AppendRowsWithTimeRangeFilter(xb.timestamps[:0], xb.values[:0], tr)
+				storage.ConvertTimestamps(xb.timestamps, storage.TimestampsPerMsec(), timestampsPerMsec)
 				if len(xb.timestamps) > 0 {
 					writeLineFunc(xb, resultsCh)
 				}
@@ -476,14 +508,34 @@ func DeleteHandler(startTime time.Time, r *http.Request) error {
 	if err := r.ParseForm(); err != nil {
 		return fmt.Errorf("cannot parse request form values: %w", err)
 	}
-	if r.FormValue("start") != "" || r.FormValue("end") != "" {
-		return fmt.Errorf("start and end aren't supported. Remove these args from the query in order to delete all the matching metrics")
-	}
 	tagFilterss, err := getTagFilterssFromRequest(r)
 	if err != nil {
 		return err
 	}
 	ct := startTime.UnixNano() / 1e6
+	if r.FormValue("start") != "" || r.FormValue("end") != "" {
+		// Delete samples on the given time range only.
+		end, err := searchutils.GetTime(r, "end", ct)
+		if err != nil {
+			return err
+		}
+		start, err := searchutils.GetTime(r, "start", 0)
+		if err != nil {
+			return err
+		}
+		if start > end {
+			return fmt.Errorf("start=%d cannot exceed end=%d", start, end)
+		}
+		sq := storage.NewSearchQuery(start, end, tagFilterss)
+		deletedCount, err := netstorage.DeleteSeriesOnTimeRange(sq, deadline)
+		if err != nil {
+			return fmt.Errorf("cannot delete samples on the time range [%d..%d]: %w", start, end, err)
+		}
+		if deletedCount > 0 {
+			promql.ResetRollupResultCache()
+		}
+		return nil
+	}
 	sq := storage.NewSearchQuery(0, ct, tagFilterss)
 	deletedCount, err := netstorage.DeleteSeries(sq, deadline)
 	if err != nil {
@@ -613,12 +665,12 @@ func labelValuesWithMatches(labelName string, matches []string, etfs [][]storage
 			m[string(labelValue)] = struct{}{}
 		}
 	} else {
-		rss, err := netstorage.ProcessSearchQuery(sq, false, deadline)
+		rss, err := netstorage.ProcessSearchQuery(nil, sq, false, deadline)
 		if err != nil {
 			return nil, fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 		}
 		var mLock sync.Mutex
-		err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+		err = rss.RunParallel(nil, func(rs *netstorage.Result, workerID uint) error {
 			labelValue := rs.MetricName.GetTagValue(labelName)
 			if len(labelValue) == 0 {
 				return nil
@@ -692,20 +744,9 @@ func TSDBStatusHandler(startTime time.Time, w http.ResponseWriter, r *http.Reque
 		}
 		date = uint64(t.Unix()) / secsPerDay
 	}
-	topN := 10
-	topNStr := r.FormValue("topN")
-	if len(topNStr) > 0 {
-		n, err := strconv.Atoi(topNStr)
-		if err != nil {
-			return fmt.Errorf("cannot parse `topN` arg %q: %w", topNStr, err)
-		}
-		if n <= 0 {
-			n = 1
-		}
-		if n > 1000 {
-			n = 1000
-		}
-		topN = n
+	topN, err := getTopNFromRequest(r)
+	if err != nil {
+		return err
 	}
 	var status *storage.TSDBStatus
 	if len(matches) == 0 && len(etfs) == 0 {
@@ -750,6 +791,302 @@ func tsdbStatusWithMatches(matches []string, etfs [][]storage.TagFilter, date ui
 
 var tsdbStatusDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/status/tsdb"}`)
 
+// getTopNFromRequest returns the value for `topN` query arg in the range [1..1000].
+//
+// 10 is returned if `topN` query arg is missing.
+func getTopNFromRequest(r *http.Request) (int, error) {
+	topNStr := r.FormValue("topN")
+	if len(topNStr) == 0 {
+		return 10, nil
+	}
+	n, err := strconv.Atoi(topNStr)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse `topN` arg %q: %w", topNStr, err)
+	}
+	if n <= 0 {
+		n = 1
+	}
+	if n > 1000 {
+		n = 1000
+	}
+	return n, nil
+}
+
+// CardinalityHandler processes /api/v1/status/cardinality request.
+//
+// It returns cardinality stats for series on the time range specified via `start` and `end` query args.
+// The stats are compared against the previous time range with the same duration.
+// Top values for the label specified via `focusLabel` query arg are returned additionally.
+func CardinalityHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer cardinalityDuration.UpdateDuration(startTime)
+
+	deadline := searchutils.GetDeadlineForStatusRequest(r, startTime)
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	etfs, err := searchutils.GetExtraTagFilters(r)
+	if err != nil {
+		return err
+	}
+	matches := getMatchesFromRequest(r)
+	ct := startTime.UnixNano() / 1e6
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	start, err := searchutils.GetTime(r, "start", end)
+	if err != nil {
+		return err
+	}
+	if start > end {
+		return fmt.Errorf("`start` cannot exceed `end`; got start=%d, end=%d", start, end)
+	}
+	topN, err := getTopNFromRequest(r)
+	if err != nil {
+		return err
+	}
+	focusLabel := r.FormValue("focusLabel")
+	var tagFilterss [][]storage.TagFilter
+	if len(matches) > 0 {
+		tagFilterss, err = getTagFilterssFromMatches(matches)
+		if err != nil {
+			return err
+		}
+	}
+	tagFilterss = searchutils.JoinTagFilterss(tagFilterss, etfs)
+	sq := storage.NewSearchQuery(start, end, tagFilterss)
+	status, err := netstorage.GetCardinalityStatus(deadline, sq, focusLabel, topN)
+	if err != nil {
+		return fmt.Errorf("cannot obtain cardinality status for start=%d, end=%d, topN=%d: %w", start, end, topN, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteCardinalityResponse(bw, status, focusLabel)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot send cardinality status response to remote client: %w", err)
+	}
+	return nil
+}
+
+var cardinalityDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/status/cardinality"}`)
+
+// ChurnHandler processes /api/v1/status/churn request.
+//
+// It returns the number of appeared and disappeared series per metric name for every day on the [start ... end] time range
+// or for the last hours if `granularity=hour` query arg is passed.
+func ChurnHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer churnDuration.UpdateDuration(startTime)
+
+	deadline := searchutils.GetDeadlineForStatusRequest(r, startTime)
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	isHourly := false
+	granularity := r.FormValue("granularity")
+	switch granularity {
+	case "", "day":
+		granularity = "day"
+	case "hour":
+		isHourly = true
+	default:
+		return fmt.Errorf("unsupported `granularity` arg %q; supported values: day, hour", granularity)
+	}
+	ct := startTime.UnixNano() / 1e6
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	start, err := searchutils.GetTime(r, "start", end-6*secsPerDay*1000)
+	if err != nil {
+		return err
+	}
+	if start > end {
+		return fmt.Errorf("`start` cannot exceed `end`; got start=%d, end=%d", start, end)
+	}
+	topN, err := getTopNFromRequest(r)
+	if err != nil {
+		return err
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: start,
+		MaxTimestamp: end,
+	}
+	css, err := netstorage.GetChurn(deadline, tr, isHourly, topN)
+	if err != nil {
+		return fmt.Errorf("cannot obtain churn status for granularity=%s, start=%d, end=%d, topN=%d: %w", granularity, start, end, topN, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteChurnResponse(bw, css, granularity)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot send churn status response to remote client: %w", err)
+	}
+	return nil
+}
+
+var churnDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/status/churn"}`)
+
+// MetricNamesStatsHandler processes /api/v1/status/metric_names_stats request.
+//
+// It returns the number of queries and the last query time per each metric name
+// tracked since the start of the stats collection. Least recently queried metric names go first.
+//
+// The following optional query args are supported:
+//
+//   - limit - the maximum number of metric names to return. Default is 1000.
+//   - le - return only metric names queried no more than the given number of times.
+//   - match_pattern - return only metric names containing the given substring.
+func MetricNamesStatsHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer metricNamesStatsDuration.UpdateDuration(startTime)
+
+	deadline := searchutils.GetDeadlineForStatusRequest(r, startTime)
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	limit := 1000
+	if limitStr := r.FormValue("limit"); len(limitStr) > 0 {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil {
+			return fmt.Errorf("cannot parse `limit` arg %q: %w", limitStr, err)
+		}
+		if n < 0 {
+			n = 0
+		}
+		limit = n
+	}
+	le := -1
+	if leStr := r.FormValue("le"); len(leStr) > 0 {
+		n, err := strconv.Atoi(leStr)
+		if err != nil {
+			return fmt.Errorf("cannot parse `le` arg %q: %w", leStr, err)
+		}
+		if n < 0 {
+			return fmt.Errorf("`le` arg cannot be negative; got %d", n)
+		}
+		le = n
+	}
+	matchPattern := r.FormValue("match_pattern")
+	mnss, startTimestamp, err := netstorage.GetMetricNamesStats(deadline, limit, le, matchPattern)
+	if err != nil {
+		return fmt.Errorf("cannot obtain metric names stats for limit=%d, le=%d, match_pattern=%q: %w", limit, le, matchPattern, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteMetricNamesStatsResponse(bw, mnss, startTimestamp)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot send metric names stats response to remote client: %w", err)
+	}
+	return nil
+}
+
+var metricNamesStatsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/status/metric_names_stats"}`)
+
+// PartitionsHandler processes /api/v1/admin/partitions request.
+//
+// It returns storage partitions with their small and big parts, including time ranges, row counts and sizes.
+func PartitionsHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer partitionsDuration.UpdateDuration(startTime)
+
+	deadline := searchutils.GetDeadlineForStatusRequest(r, startTime)
+	pss, err := netstorage.GetPartitionsStats(deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain partitions stats: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WritePartitionsResponse(bw, pss)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot send partitions response to remote client: %w", err)
+	}
+	return nil
+}
+
+var partitionsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/admin/partitions"}`)
+
+// DropPartitionHandler processes /api/v1/admin/partitions/drop request.
+//
+// It drops the partition with the name passed in `name` query arg.
+func DropPartitionHandler(r *http.Request) error {
+	name := r.FormValue("name")
+	if len(name) == 0 {
+		return fmt.Errorf("missing `name` query arg")
+	}
+	if err := netstorage.DropPartition(name); err != nil {
+		return partitionError(err)
+	}
+	// The dropped data may be cached in rollup results.
+	promql.ResetRollupResultCache()
+	return nil
+}
+
+// ForceMergePartitionHandler processes /api/v1/admin/partitions/force_merge request.
+//
+// It starts forced merge in background for the partition with the name passed in `name` query arg.
+func ForceMergePartitionHandler(startTime time.Time, r *http.Request) error {
+	name := r.FormValue("name")
+	if len(name) == 0 {
+		return fmt.Errorf("missing `name` query arg")
+	}
+	deadline := searchutils.GetDeadlineForStatusRequest(r, startTime)
+	pss, err := netstorage.GetPartitionsStats(deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain partitions stats: %w", err)
+	}
+	found := false
+	for _, ps := range pss {
+		if ps.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return partitionError(fmt.Errorf("cannot force merge partition %q: %w", name, storage.ErrPartitionNotFound))
+	}
+	// Run force merge in background, since it may take a lot of time for big partitions.
+	go func() {
+		if err := netstorage.ForceMergePartition(name); err != nil {
+			logger.Errorf("error in forced merge for partition %q: %s", name, err)
+		}
+	}()
+	return nil
+}
+
+func partitionError(err error) error {
+	if errors.Is(err, storage.ErrPartitionNotFound) {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        err,
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return err
+}
+
+// CancelQueryHandler processes /api/v1/admin/query/cancel request.
+//
+// It cancels the active query with the id passed in `id` query arg.
+// Ids for active queries are listed at /api/v1/status/active_queries .
+func CancelQueryHandler(r *http.Request) error {
+	id := r.FormValue("id")
+	if len(id) == 0 {
+		return fmt.Errorf("missing `id` query arg")
+	}
+	qid, err := strconv.ParseUint(id, 16, 64)
+	if err != nil {
+		return fmt.Errorf("cannot parse `id` query arg %q: %w; it must contain hex id from /api/v1/status/active_queries", id, err)
+	}
+	if !promql.CancelActiveQuery(qid) {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot find active query with id=%s", id),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
 // LabelsHandler processes /api/v1/labels request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#getting-label-names
@@ -852,12 +1189,12 @@ func labelsWithMatches(matches []string, etfs [][]storage.TagFilter, start, end
 			m["__name__"] = struct{}{}
 		}
 	} else {
-		rss, err := netstorage.ProcessSearchQuery(sq, false, deadline)
+		rss, err := netstorage.ProcessSearchQuery(nil, sq, false, deadline)
 		if err != nil {
 			return nil, fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 		}
 		var mLock sync.Mutex
-		err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+		err = rss.RunParallel(nil, func(rs *netstorage.Result, workerID uint) error {
 			mLock.Lock()
 			for _, tag := range rs.MetricName.Tags {
 				m[string(tag.Key)] = struct{}{}
@@ -960,7 +1297,7 @@ func SeriesHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 		seriesDuration.UpdateDuration(startTime)
 		return nil
 	}
-	rss, err := netstorage.ProcessSearchQuery(sq, false, deadline)
+	rss, err := netstorage.ProcessSearchQuery(nil, sq, false, deadline)
 	if err != nil {
 		return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 	}
@@ -971,7 +1308,7 @@ func SeriesHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 	resultsCh := make(chan *quicktemplate.ByteBuffer)
 	doneCh := make(chan error)
 	go func() {
-		err := rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+		err := rss.RunParallel(nil, func(rs *netstorage.Result, workerID uint) error {
 			if err := bw.Error(); err != nil {
 				return err
 			}
@@ -997,6 +1334,111 @@ func SeriesHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 
 var seriesDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/series"}`)
 
+// QueryExemplarsHandler processes /api/v1/query_exemplars request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+func QueryExemplarsHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer queryExemplarsDuration.UpdateDuration(startTime)
+
+	ct := startTime.UnixNano() / 1e6
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	start, err := searchutils.GetTime(r, "start", end-defaultStep)
+	if err != nil {
+		return err
+	}
+	if start > end {
+		return fmt.Errorf("start=%d cannot exceed end=%d", start, end)
+	}
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+
+	tagFilterss, err := getTagFilterssFromQuery(query)
+	if err != nil {
+		return err
+	}
+	etfs, err := searchutils.GetExtraTagFilters(r)
+	if err != nil {
+		return err
+	}
+	tagFilterss = searchutils.JoinTagFilterss(tagFilterss, etfs)
+	sq := storage.NewSearchQuery(start, end, tagFilterss)
+	ers, err := netstorage.SearchExemplars(sq, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot fetch exemplars for %q: %w", sq, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteQueryExemplarsResponse(bw, ers)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush query exemplars response to remote client: %w", err)
+	}
+	return nil
+}
+
+var queryExemplarsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query_exemplars"}`)
+
+// MetadataHandler processes /api/v1/metadata request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+func MetadataHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer metadataDuration.UpdateDuration(startTime)
+
+	deadline := searchutils.GetDeadlineForStatusRequest(r, startTime)
+	limit := 0
+	limitStr := r.FormValue("limit")
+	if len(limitStr) > 0 {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil {
+			return fmt.Errorf("cannot parse `limit` arg %q: %w", limitStr, err)
+		}
+		limit = n
+	}
+	metric := r.FormValue("metric")
+	mms, err := netstorage.GetMetricMetadata(metric, limit, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain metric metadata for metric=%q, limit=%d: %w", metric, limit, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteMetadataResponse(bw, mms)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush metadata response to remote client: %w", err)
+	}
+	return nil
+}
+
+var metadataDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/metadata"}`)
+
+// getTagFilterssFromQuery returns tag filters for all the series selectors in the given PromQL query.
+func getTagFilterssFromQuery(query string) ([][]storage.TagFilter, error) {
+	expr, err := metricsql.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse query %q: %w", query, err)
+	}
+	var tagFilterss [][]storage.TagFilter
+	metricsql.VisitAll(expr, func(e metricsql.Expr) {
+		me, ok := e.(*metricsql.MetricExpr)
+		if !ok || len(me.LabelFilters) == 0 {
+			return
+		}
+		tagFilterss = append(tagFilterss, searchutils.ToTagFilters(me.LabelFilters))
+	})
+	if len(tagFilterss) == 0 {
+		return nil, fmt.Errorf("query %q doesn't contain series selectors", query)
+	}
+	return tagFilterss, nil
+}
+
 // QueryHandler processes /api/v1/query request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#instant-queries
@@ -1012,6 +1454,7 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 	if err != nil {
 		return err
 	}
+	qt := querytracer.New(searchutils.GetBool(r, "trace"), "/api/v1/query: query=%s, time=%d", query, start)
 	lookbackDelta, err := getMaxLookback(r)
 	if err != nil {
 		return err
@@ -1043,7 +1486,7 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 		if end < start {
 			end = start
 		}
-		if err := exportHandler(w, []string{childQuery}, etfs, start, end, "promapi", 0, false, deadline); err != nil {
+		if err := exportHandler(qt, w, []string{childQuery}, etfs, start, end, "promapi", 0, false, 1, deadline); err != nil {
 			return fmt.Errorf("error when exporting data for query=%q on the time range (start=%d, end=%d): %w", childQuery, start, end, err)
 		}
 		queryDuration.UpdateDuration(startTime)
@@ -1059,7 +1502,7 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 		start -= offset
 		end := start
 		start = end - window
-		if err := queryRangeHandler(startTime, w, childQuery, start, end, step, r, ct, etfs); err != nil {
+		if err := queryRangeHandler(qt, startTime, w, childQuery, start, end, step, r, ct, etfs); err != nil {
 			return fmt.Errorf("error when executing query=%q on the time range (start=%d, end=%d, step=%d): %w", childQuery, start, end, step, err)
 		}
 		queryDuration.UpdateDuration(startTime)
@@ -1086,7 +1529,7 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 		RoundDigits:         getRoundDigits(r),
 		EnforcedTagFilterss: etfs,
 	}
-	result, err := promql.Exec(&ec, query, true)
+	result, err := promql.Exec(qt, &ec, query, true)
 	if err != nil {
 		return fmt.Errorf("error when executing query=%q for (time=%d, step=%d): %w", query, start, step, err)
 	}
@@ -1102,7 +1545,7 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 	w.Header().Set("Content-Type", "application/json")
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
-	WriteQueryResponse(bw, result)
+	WriteQueryResponse(bw, result, qt)
 	if err := bw.Flush(); err != nil {
 		return fmt.Errorf("cannot flush query response to remote client: %w", err)
 	}
@@ -1111,6 +1554,91 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 
 var queryDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query"}`)
 
+// QueryExplainHandler processes /api/v1/query/explain request.
+//
+// It returns the optimized expression tree for the query with the estimated cost of every series selector
+// without executing the query. The query is explained as a range query if `start` arg is set.
+// Otherwise it is explained as an instant query at `time`.
+func QueryExplainHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer queryExplainDuration.UpdateDuration(startTime)
+
+	ct := startTime.UnixNano() / 1e6
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	if len(query) > maxQueryLen.N {
+		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	lookbackDelta, err := getMaxLookback(r)
+	if err != nil {
+		return err
+	}
+	var start, end, step int64
+	if r.FormValue("start") != "" {
+		start, err = searchutils.GetTime(r, "start", ct-defaultStep)
+		if err != nil {
+			return err
+		}
+		end, err = searchutils.GetTime(r, "end", ct)
+		if err != nil {
+			return err
+		}
+		step, err = searchutils.GetDuration(r, "step", defaultStep)
+		if err != nil {
+			return err
+		}
+		if start > end {
+			end = start + defaultStep
+		}
+		if err := promql.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
+			return err
+		}
+	} else {
+		start, err = searchutils.GetTime(r, "time", ct)
+		if err != nil {
+			return err
+		}
+		end = start
+		step, err = searchutils.GetDuration(r, "step", lookbackDelta)
+		if err != nil {
+			return err
+		}
+		if step <= 0 {
+			step = defaultStep
+		}
+	}
+	etfs, err := searchutils.GetExtraTagFilters(r)
+	if err != nil {
+		return err
+	}
+	qt := querytracer.New(searchutils.GetBool(r, "trace"), "/api/v1/query/explain: query=%s, start=%d, end=%d, step=%d", query, start, end, step)
+	ec := promql.EvalConfig{
+		Start:               start,
+		End:                 end,
+		Step:                step,
+		QuotedRemoteAddr:    httpserver.GetQuotedRemoteAddr(r),
+		Deadline:            searchutils.GetDeadlineForQuery(r, startTime),
+		LookbackDelta:       lookbackDelta,
+		EnforcedTagFilterss: etfs,
+	}
+	er, err := promql.Explain(qt, &ec, query)
+	if err != nil {
+		return fmt.Errorf("cannot explain query=%q for (start=%d, end=%d, step=%d): %w", query, start, end, step, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteQueryExplainResponse(bw, query, start, end, step, er, qt)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush query explain response to remote client: %w", err)
+	}
+	return nil
+}
+
+var queryExplainDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query/explain"}`)
+
 // QueryRangeHandler processes /api/v1/query_range request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#range-queries
@@ -1138,13 +1666,14 @@ func QueryRangeHandler(startTime time.Time, w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		return err
 	}
-	if err := queryRangeHandler(startTime, w, query, start, end, step, r, ct, etfs); err != nil {
+	qt := querytracer.New(searchutils.GetBool(r, "trace"), "/api/v1/query_range: query=%s, start=%d, end=%d, step=%d", query, start, end, step)
+	if err := queryRangeHandler(qt, startTime, w, query, start, end, step, r, ct, etfs); err != nil {
 		return fmt.Errorf("error when executing query=%q on the time range (start=%d, end=%d, step=%d): %w", query, start, end, step, err)
 	}
 	return nil
 }
 
-func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string, start, end, step int64, r *http.Request, ct int64, etfs [][]storage.TagFilter) error {
+func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, query string, start, end, step int64, r *http.Request, ct int64, etfs [][]storage.TagFilter) error {
 	deadline := searchutils.GetDeadlineForQuery(r, startTime)
 	mayCache := !searchutils.GetBool(r, "nocache")
 	lookbackDelta, err := getMaxLookback(r)
@@ -1177,7 +1706,7 @@ func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string,
 		RoundDigits:         getRoundDigits(r),
 		EnforcedTagFilterss: etfs,
 	}
-	result, err := promql.Exec(&ec, query, false)
+	result, err := promql.Exec(qt, &ec, query, false)
 	if err != nil {
 		return fmt.Errorf("cannot execute query: %w", err)
 	}
@@ -1191,11 +1720,12 @@ func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string,
 	// Remove NaN values as Prometheus does.
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/153
 	result = removeEmptyValuesAndTimeseries(result)
+	qt.Printf("remove NaN values and empty series; series left: %d", len(result))
 
 	w.Header().Set("Content-Type", "application/json")
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
-	WriteQueryRangeResponse(bw, result)
+	WriteQueryRangeResponse(bw, result, qt)
 	if err := bw.Flush(); err != nil {
 		return fmt.Errorf("cannot send query range response to remote client: %w", err)
 	}
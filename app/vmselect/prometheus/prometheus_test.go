@@ -1,11 +1,16 @@
 package prometheus
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 )
 
 func TestRemoveEmptyValuesAndTimeseries(t *testing.T) {
@@ -195,3 +200,153 @@ func TestAdjustLastPoints(t *testing.T) {
 		},
 	})
 }
+
+func TestGetTagFilterssFromQuery(t *testing.T) {
+	f := func(query string, resultExpected string) {
+		t.Helper()
+		tfss, err := getTagFilterssFromQuery(query)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var result []string
+		for _, tfs := range tfss {
+			var a []string
+			for i := range tfs {
+				tf := &tfs[i]
+				op := "="
+				switch {
+				case tf.IsNegative && tf.IsRegexp:
+					op = "!~"
+				case tf.IsNegative:
+					op = "!="
+				case tf.IsRegexp:
+					op = "=~"
+				}
+				a = append(a, fmt.Sprintf("%s%s%q", tf.Key, op, tf.Value))
+			}
+			result = append(result, strings.Join(a, ","))
+		}
+		if s := strings.Join(result, ";"); s != resultExpected {
+			t.Fatalf("unexpected tag filters for %q;\ngot\n%s\nwant\n%s", query, s, resultExpected)
+		}
+	}
+	f(`foo`, `="foo"`)
+	f(`rate(foo{job="x"}[5m]) / bar{env=~"a|b"}`, `="foo",job="x";="bar",env=~"a|b"`)
+	f(`sum(foo{job!="x"}) or {env!~"a"}`, `="foo",job!="x";env!~"a"`)
+
+	// Invalid queries
+	for _, query := range []string{`foo{`, `1+2`} {
+		if _, err := getTagFilterssFromQuery(query); err == nil {
+			t.Fatalf("expecting non-nil error for %q", query)
+		}
+	}
+}
+
+func TestQueryExemplarsResponse(t *testing.T) {
+	var mn storage.MetricName
+	mn.MetricGroup = []byte("foo_bucket")
+	mn.AddTag("le", "0.5")
+	ers := []netstorage.ExemplarsResult{{
+		MetricName: mn,
+		Exemplars: []storage.Exemplar{
+			{
+				Labels: []storage.Tag{{
+					Key:   []byte("trace_id"),
+					Value: []byte("abc"),
+				}},
+				Value:     0.3,
+				Timestamp: 1600000000123,
+			},
+			{
+				Value:     1,
+				Timestamp: 1600000001000,
+			},
+		},
+	}}
+	result := QueryExemplarsResponse(ers)
+	resultExpected := `{"status":"success","data":[{"seriesLabels":{"__name__":"foo_bucket","le":"0.5"},"exemplars":[` +
+		`{"labels":{"trace_id":"abc"},"value":"0.3","timestamp":1600000000.123},{"labels":{},"value":"1","timestamp":1600000001}]}]}`
+	if result != resultExpected {
+		t.Fatalf("unexpected response;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+	if result := QueryExemplarsResponse(nil); result != `{"status":"success","data":[]}` {
+		t.Fatalf("unexpected response for empty exemplars: %s", result)
+	}
+}
+
+func TestMetadataResponse(t *testing.T) {
+	f := func(mms []storage.MetricMetadata, resultExpected string) {
+		t.Helper()
+		result := MetadataResponse(mms)
+		if result != resultExpected {
+			t.Fatalf("unexpected response;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(nil, `{"status":"success","data":{}}`)
+	f([]storage.MetricMetadata{
+		{
+			MetricFamilyName: "foo",
+			Type:             "counter",
+			Help:             "foo \"help\"",
+		},
+		{
+			MetricFamilyName: "foo",
+			Type:             "gauge",
+		},
+		{
+			MetricFamilyName: "http_request_duration_seconds",
+			Type:             "histogram",
+			Help:             "Request duration",
+			Unit:             "seconds",
+		},
+	}, `{"status":"success","data":{"foo":[{"type":"counter","help":"foo \"help\"","unit":""},{"type":"gauge","help":"","unit":""}],`+
+		`"http_request_duration_seconds":[{"type":"histogram","help":"Request duration","unit":"seconds"}]}}`)
+}
+
+func TestQueryResponseTrace(t *testing.T) {
+	var mn storage.MetricName
+	mn.MetricGroup = []byte("foo")
+	rs := []netstorage.Result{{
+		MetricName: mn,
+		Values:     []float64{1, 2},
+		Timestamps: []int64{1600000000000, 1600000015000},
+	}}
+
+	// The trace must be missing if tracing is disabled.
+	result := QueryRangeResponse(rs, nil)
+	resultExpected := `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"foo"},"values":[[1600000000,"1"],[1600000015,"2"]]}]}}`
+	if result != resultExpected {
+		t.Fatalf("unexpected response;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// The trace must be added to the response if tracing is enabled.
+	qt := querytracer.New(true, "/api/v1/query_range: query=%s", "foo")
+	qt.Printf("eval")
+	result = QueryRangeResponse(rs, qt)
+	var resp struct {
+		Status string
+		Trace  struct {
+			Message  string `json:"message"`
+			Children []struct {
+				Message string `json:"message"`
+			} `json:"children"`
+		} `json:"trace"`
+	}
+	if err := json.Unmarshal([]byte(result), &resp); err != nil {
+		t.Fatalf("cannot parse response %s: %s", result, err)
+	}
+	if resp.Status != "success" {
+		t.Fatalf("unexpected status; got %q; want %q", resp.Status, "success")
+	}
+	if resp.Trace.Message != "/api/v1/query_range: query=foo" {
+		t.Fatalf("unexpected trace message: %q", resp.Trace.Message)
+	}
+	var messages []string
+	for _, child := range resp.Trace.Children {
+		messages = append(messages, child.Message)
+	}
+	messagesExpected := []string{"eval", "generate /api/v1/query_range response for series=1, points=2"}
+	if !reflect.DeepEqual(messages, messagesExpected) {
+		t.Fatalf("unexpected trace messages;\ngot\n%q\nwant\n%q", messages, messagesExpected)
+	}
+}
@@ -7,112 +7,133 @@ package prometheus
 //line app/vmselect/prometheus/query_range_response.qtpl:1
 import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 )
 
-// QueryRangeResponse generates response for /api/v1/query_range.See https://prometheus.io/docs/prometheus/latest/querying/api/#range-queries
+// QueryRangeResponse generates response for /api/v1/query_range.See https://prometheus.io/docs/prometheus/latest/querying/api/#range-queriesThe qt is finished and is added to the response if it isn't nil.
 
-//line app/vmselect/prometheus/query_range_response.qtpl:8
+//line app/vmselect/prometheus/query_range_response.qtpl:10
 import (
 	qtio422016 "io"
 
 	qt422016 "github.com/valyala/quicktemplate"
 )
 
-//line app/vmselect/prometheus/query_range_response.qtpl:8
+//line app/vmselect/prometheus/query_range_response.qtpl:10
 var (
 	_ = qtio422016.Copy
 	_ = qt422016.AcquireByteBuffer
 )
 
-//line app/vmselect/prometheus/query_range_response.qtpl:8
-func StreamQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/prometheus/query_range_response.qtpl:8
-	qw422016.N().S(`{"status":"success","data":{"resultType":"matrix","result":[`)
-//line app/vmselect/prometheus/query_range_response.qtpl:14
-	if len(rs) > 0 {
+//line app/vmselect/prometheus/query_range_response.qtpl:10
+func StreamQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result, qt *querytracer.Tracer) {
+//line app/vmselect/prometheus/query_range_response.qtpl:10
+	qw422016.N().S(`{`)
+//line app/vmselect/prometheus/query_range_response.qtpl:13
+	seriesCount := len(rs)
+	pointsCount := 0
+
 //line app/vmselect/prometheus/query_range_response.qtpl:15
+	qw422016.N().S(`"status":"success","data":{"resultType":"matrix","result":[`)
+//line app/vmselect/prometheus/query_range_response.qtpl:20
+	if len(rs) > 0 {
+//line app/vmselect/prometheus/query_range_response.qtpl:21
 		streamqueryRangeLine(qw422016, &rs[0])
-//line app/vmselect/prometheus/query_range_response.qtpl:16
+//line app/vmselect/prometheus/query_range_response.qtpl:22
+		pointsCount += len(rs[0].Values)
+
+//line app/vmselect/prometheus/query_range_response.qtpl:23
 		rs = rs[1:]
 
-//line app/vmselect/prometheus/query_range_response.qtpl:17
+//line app/vmselect/prometheus/query_range_response.qtpl:24
 		for i := range rs {
-//line app/vmselect/prometheus/query_range_response.qtpl:17
+//line app/vmselect/prometheus/query_range_response.qtpl:24
 			qw422016.N().S(`,`)
-//line app/vmselect/prometheus/query_range_response.qtpl:18
+//line app/vmselect/prometheus/query_range_response.qtpl:25
 			streamqueryRangeLine(qw422016, &rs[i])
-//line app/vmselect/prometheus/query_range_response.qtpl:19
+//line app/vmselect/prometheus/query_range_response.qtpl:26
+			pointsCount += len(rs[i].Values)
+
+//line app/vmselect/prometheus/query_range_response.qtpl:27
 		}
-//line app/vmselect/prometheus/query_range_response.qtpl:20
+//line app/vmselect/prometheus/query_range_response.qtpl:28
 	}
-//line app/vmselect/prometheus/query_range_response.qtpl:20
-	qw422016.N().S(`]}}`)
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:28
+	qw422016.N().S(`]}`)
+//line app/vmselect/prometheus/query_range_response.qtpl:32
+	qt.Printf("generate /api/v1/query_range response for series=%d, points=%d", seriesCount, pointsCount)
+	qt.Done()
+
+//line app/vmselect/prometheus/query_range_response.qtpl:35
+	streamdumpQueryTrace(qw422016, qt)
+//line app/vmselect/prometheus/query_range_response.qtpl:35
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:24
-func WriteQueryRangeResponse(qq422016 qtio422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:37
+func WriteQueryRangeResponse(qq422016 qtio422016.Writer, rs []netstorage.Result, qt *querytracer.Tracer) {
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:24
-	StreamQueryRangeResponse(qw422016, rs)
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:37
+	StreamQueryRangeResponse(qw422016, rs, qt)
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:24
-func QueryRangeResponse(rs []netstorage.Result) string {
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:37
+func QueryRangeResponse(rs []netstorage.Result, qt *querytracer.Tracer) string {
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/query_range_response.qtpl:24
-	WriteQueryRangeResponse(qb422016, rs)
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:37
+	WriteQueryRangeResponse(qb422016, rs, qt)
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 	return qs422016
-//line app/vmselect/prometheus/query_range_response.qtpl:24
+//line app/vmselect/prometheus/query_range_response.qtpl:37
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:26
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 func streamqueryRangeLine(qw422016 *qt422016.Writer, r *netstorage.Result) {
-//line app/vmselect/prometheus/query_range_response.qtpl:26
+//line app/vmselect/prometheus/query_range_response.qtpl:39
 	qw422016.N().S(`{"metric":`)
-//line app/vmselect/prometheus/query_range_response.qtpl:28
+//line app/vmselect/prometheus/query_range_response.qtpl:41
 	streammetricNameObject(qw422016, &r.MetricName)
-//line app/vmselect/prometheus/query_range_response.qtpl:28
+//line app/vmselect/prometheus/query_range_response.qtpl:41
 	qw422016.N().S(`,"values":`)
-//line app/vmselect/prometheus/query_range_response.qtpl:29
+//line app/vmselect/prometheus/query_range_response.qtpl:42
 	streamvaluesWithTimestamps(qw422016, r.Values, r.Timestamps)
-//line app/vmselect/prometheus/query_range_response.qtpl:29
+//line app/vmselect/prometheus/query_range_response.qtpl:42
 	qw422016.N().S(`}`)
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 func writequeryRangeLine(qq422016 qtio422016.Writer, r *netstorage.Result) {
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	streamqueryRangeLine(qw422016, r)
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 func queryRangeLine(r *netstorage.Result) string {
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	writequeryRangeLine(qb422016, r)
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 	return qs422016
-//line app/vmselect/prometheus/query_range_response.qtpl:31
+//line app/vmselect/prometheus/query_range_response.qtpl:44
 }
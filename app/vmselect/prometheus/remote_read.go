@@ -0,0 +1,259 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+var maxRemoteReadRequestSize = flagutil.NewBytes("search.maxRemoteReadRequestSize", 1024*1024, "The maximum size in bytes of a single Prometheus remote_read API request")
+
+// maxSamplesPerChunk is the maximum number of samples per XOR chunk in streamed remote read response.
+//
+// This is the same value Prometheus uses for its chunks.
+const maxSamplesPerChunk = 120
+
+// RemoteReadHandler processes Prometheus remote_read API requests at /api/v1/read
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/remote_read_api/
+func RemoteReadHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer remoteReadDuration.UpdateDuration(startTime)
+
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse request form values: %w", err)
+	}
+	etfs, err := searchutils.GetExtraTagFilters(r)
+	if err != nil {
+		return err
+	}
+	req, err := readRemoteReadRequest(r.Body)
+	if err != nil {
+		return err
+	}
+	streamed := false
+	for _, rt := range req.AcceptedResponseTypes {
+		if rt == prompb.ReadResponseTypeStreamedXORChunks {
+			streamed = true
+			break
+		}
+		if rt == prompb.ReadResponseTypeSamples {
+			break
+		}
+	}
+
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	if streamed {
+		w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+	} else {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Header().Set("Content-Encoding", "snappy")
+	}
+	var resp prompb.ReadResponse
+	for i := range req.Queries {
+		q := &req.Queries[i]
+		tfs, err := getTagFiltersFromLabelMatchers(q.Matchers)
+		if err != nil {
+			return fmt.Errorf("cannot convert matchers for query #%d: %w", i, err)
+		}
+		tagFilterss := searchutils.JoinTagFilterss([][]storage.TagFilter{tfs}, etfs)
+		sq := storage.NewSearchQuery(q.StartTimestampMs, q.EndTimestampMs, tagFilterss)
+		rss, err := netstorage.ProcessSearchQuery(nil, sq, true, deadline)
+		if err != nil {
+			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
+		}
+		if streamed {
+			queryIndex := int64(i)
+			err = rss.RunParallel(nil, func(rs *netstorage.Result, workerID uint) error {
+				if err := bw.Error(); err != nil {
+					return err
+				}
+				bb := remoteReadBufPool.Get().(*remoteReadBuf)
+				bb.b = marshalChunkedReadResponseFrame(bb.b[:0], rs, queryIndex)
+				_, err := bw.Write(bb.b)
+				remoteReadBufPool.Put(bb)
+				return err
+			})
+		} else {
+			var qr prompb.QueryResult
+			var mu sync.Mutex
+			err = rss.RunParallel(nil, func(rs *netstorage.Result, workerID uint) error {
+				ts := prompb.TimeSeries{
+					Labels:  getRemoteReadLabels(&rs.MetricName),
+					Samples: make([]prompb.Sample, len(rs.Values)),
+				}
+				for j, v := range rs.Values {
+					ts.Samples[j] = prompb.Sample{
+						Value:     v,
+						Timestamp: rs.Timestamps[j],
+					}
+				}
+				mu.Lock()
+				qr.Timeseries = append(qr.Timeseries, ts)
+				mu.Unlock()
+				return nil
+			})
+			resp.Results = append(resp.Results, qr)
+		}
+		if err != nil {
+			return fmt.Errorf("error during sending data to remote client: %w", err)
+		}
+	}
+	if !streamed {
+		data := resp.MarshalProtobuf(nil)
+		_, _ = bw.Write(snappy.Encode(nil, data))
+	}
+	return bw.Flush()
+}
+
+var remoteReadDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/read"}`)
+
+type remoteReadBuf struct {
+	b []byte
+}
+
+var remoteReadBufPool = &sync.Pool{
+	New: func() interface{} {
+		return &remoteReadBuf{}
+	},
+}
+
+func readRemoteReadRequest(r io.Reader) (*prompb.ReadRequest, error) {
+	lr := io.LimitReader(r, int64(maxRemoteReadRequestSize.N)+1)
+	compressed, err := io.ReadAll(lr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read remote_read request: %w", err)
+	}
+	if len(compressed) > maxRemoteReadRequestSize.N {
+		return nil, fmt.Errorf("too big packed request; mustn't exceed -search.maxRemoteReadRequestSize=%d bytes", maxRemoteReadRequestSize.N)
+	}
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode snappy from remote_read request: %w", err)
+	}
+	if n > maxRemoteReadRequestSize.N {
+		return nil, fmt.Errorf("too big unpacked request; mustn't exceed -search.maxRemoteReadRequestSize=%d bytes; got %d bytes", maxRemoteReadRequestSize.N, n)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode snappy from remote_read request: %w", err)
+	}
+	var req prompb.ReadRequest
+	if err := req.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal remote_read request: %w", err)
+	}
+	return &req, nil
+}
+
+func getTagFiltersFromLabelMatchers(lms []prompb.LabelMatcher) ([]storage.TagFilter, error) {
+	tfs := make([]storage.TagFilter, 0, len(lms))
+	for _, lm := range lms {
+		tf := storage.TagFilter{
+			Value: lm.Value,
+		}
+		if string(lm.Name) != "__name__" {
+			tf.Key = lm.Name
+		}
+		switch lm.Type {
+		case prompb.LabelMatcherEQ:
+		case prompb.LabelMatcherNEQ:
+			tf.IsNegative = true
+		case prompb.LabelMatcherRE:
+			tf.IsRegexp = true
+		case prompb.LabelMatcherNRE:
+			tf.IsNegative = true
+			tf.IsRegexp = true
+		default:
+			return nil, fmt.Errorf("unexpected matcher type %d for label %q", lm.Type, lm.Name)
+		}
+		tfs = append(tfs, tf)
+	}
+	return tfs, nil
+}
+
+// getRemoteReadLabels returns labels for mn sorted by name as Prometheus expects.
+//
+// The returned labels don't refer to mn.
+func getRemoteReadLabels(mn *storage.MetricName) []prompb.Label {
+	labels := make([]prompb.Label, 0, len(mn.Tags)+1)
+	if len(mn.MetricGroup) > 0 {
+		labels = append(labels, prompb.Label{
+			Name:  []byte("__name__"),
+			Value: append([]byte{}, mn.MetricGroup...),
+		})
+	}
+	for _, tag := range mn.Tags {
+		labels = append(labels, prompb.Label{
+			Name:  append([]byte{}, tag.Key...),
+			Value: append([]byte{}, tag.Value...),
+		})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return string(labels[i].Name) < string(labels[j].Name)
+	})
+	return labels
+}
+
+// marshalChunkedReadResponseFrame appends a ChunkedReadResponse frame for rs to dst and returns the result.
+//
+// The frame consists of uvarint-encoded message size, big-endian CRC32 Castagnoli checksum for the message and the message itself.
+func marshalChunkedReadResponseFrame(dst []byte, rs *netstorage.Result, queryIndex int64) []byte {
+	cs := prompb.ChunkedSeries{
+		Labels: getRemoteReadLabels(&rs.MetricName),
+	}
+	timestamps := rs.Timestamps
+	values := rs.Values
+	for len(timestamps) > 0 {
+		n := maxSamplesPerChunk
+		if n > len(timestamps) {
+			n = len(timestamps)
+		}
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		if err != nil {
+			logger.Panicf("BUG: cannot create appender for XOR chunk: %s", err)
+		}
+		for j := 0; j < n; j++ {
+			app.Append(timestamps[j], values[j])
+		}
+		cs.Chunks = append(cs.Chunks, prompb.Chunk{
+			MinTimeMs: timestamps[0],
+			MaxTimeMs: timestamps[n-1],
+			Type:      prompb.ChunkEncodingXOR,
+			Data:      c.Bytes(),
+		})
+		timestamps = timestamps[n:]
+		values = values[n:]
+	}
+	resp := prompb.ChunkedReadResponse{
+		ChunkedSeries: []prompb.ChunkedSeries{cs},
+		QueryIndex:    queryIndex,
+	}
+	msg := resp.MarshalProtobuf(nil)
+	var hdr [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(hdr[:], uint64(len(msg)))
+	dst = append(dst, hdr[:n]...)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.Checksum(msg, castagnoliTable))
+	dst = append(dst, crc[:]...)
+	return append(dst, msg...)
+}
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
@@ -0,0 +1,165 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+func TestReadRemoteReadRequest(t *testing.T) {
+	// ReadRequest{queries: [{start: 1000, end: 2000, matchers: [{type: RE, name: "__name__", value: "foo.+"}]}], accepted_response_types: [STREAMED_XOR_CHUNKS, SAMPLES]}
+	matcher := []byte{0x08, 0x02, 0x12, 0x08}
+	matcher = append(matcher, "__name__"...)
+	matcher = append(matcher, 0x1a, 0x05)
+	matcher = append(matcher, "foo.+"...)
+	query := []byte{0x08, 0xe8, 0x07, 0x10, 0xd0, 0x0f, 0x1a, byte(len(matcher))}
+	query = append(query, matcher...)
+	data := []byte{0x0a, byte(len(query))}
+	data = append(data, query...)
+	data = append(data, 0x12, 0x02, 0x01, 0x00)
+
+	req, err := readRemoteReadRequest(bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reqExpected := &prompb.ReadRequest{
+		Queries: []prompb.Query{{
+			StartTimestampMs: 1000,
+			EndTimestampMs:   2000,
+			Matchers: []prompb.LabelMatcher{{
+				Type:  prompb.LabelMatcherRE,
+				Name:  []byte("__name__"),
+				Value: []byte("foo.+"),
+			}},
+		}},
+		AcceptedResponseTypes: []prompb.ReadResponseType{prompb.ReadResponseTypeStreamedXORChunks, prompb.ReadResponseTypeSamples},
+	}
+	if !reflect.DeepEqual(req, reqExpected) {
+		t.Fatalf("unexpected request\ngot\n%+v\nwant\n%+v", req, reqExpected)
+	}
+
+	// Truncated request
+	if _, err := readRemoteReadRequest(bytes.NewReader(snappy.Encode(nil, data[:len(data)-5]))); err == nil {
+		t.Fatalf("expecting non-nil error for truncated request")
+	}
+	// Non-snappy request
+	if _, err := readRemoteReadRequest(bytes.NewReader(data)); err == nil {
+		t.Fatalf("expecting non-nil error for non-snappy request")
+	}
+}
+
+func TestGetTagFiltersFromLabelMatchers(t *testing.T) {
+	f := func(lms []prompb.LabelMatcher, tfsExpected []storage.TagFilter) {
+		t.Helper()
+		tfs, err := getTagFiltersFromLabelMatchers(lms)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(tfs, tfsExpected) {
+			t.Fatalf("unexpected tag filters\ngot\n%+v\nwant\n%+v", tfs, tfsExpected)
+		}
+	}
+
+	f([]prompb.LabelMatcher{}, []storage.TagFilter{})
+	f([]prompb.LabelMatcher{
+		{Type: prompb.LabelMatcherEQ, Name: []byte("__name__"), Value: []byte("foo")},
+		{Type: prompb.LabelMatcherNEQ, Name: []byte("job"), Value: []byte("bar")},
+		{Type: prompb.LabelMatcherRE, Name: []byte("instance"), Value: []byte("a|b")},
+		{Type: prompb.LabelMatcherNRE, Name: []byte("env"), Value: []byte("dev.*")},
+	}, []storage.TagFilter{
+		{Value: []byte("foo")},
+		{Key: []byte("job"), Value: []byte("bar"), IsNegative: true},
+		{Key: []byte("instance"), Value: []byte("a|b"), IsRegexp: true},
+		{Key: []byte("env"), Value: []byte("dev.*"), IsNegative: true, IsRegexp: true},
+	})
+
+	// Unknown matcher type
+	if _, err := getTagFiltersFromLabelMatchers([]prompb.LabelMatcher{{Type: 10, Name: []byte("foo")}}); err == nil {
+		t.Fatalf("expecting non-nil error for unknown matcher type")
+	}
+}
+
+func TestMarshalChunkedReadResponseFrame(t *testing.T) {
+	var rs netstorage.Result
+	rs.MetricName.MetricGroup = []byte("foo")
+	rs.MetricName.AddTag("job", "bar")
+	for i := 0; i < 250; i++ {
+		rs.Timestamps = append(rs.Timestamps, int64(i)*1000)
+		rs.Values = append(rs.Values, float64(i))
+	}
+	frame := marshalChunkedReadResponseFrame(nil, &rs, 0)
+
+	msgLen, n := binary.Uvarint(frame)
+	if n <= 0 {
+		t.Fatalf("cannot read message length from frame")
+	}
+	frame = frame[n:]
+	if len(frame) != int(msgLen)+4 {
+		t.Fatalf("unexpected frame size; got %d; want %d", len(frame), msgLen+4)
+	}
+	msg := frame[4:]
+	crc := binary.BigEndian.Uint32(frame)
+	if crcExpected := crc32.Checksum(msg, castagnoliTable); crc != crcExpected {
+		t.Fatalf("unexpected checksum; got %d; want %d", crc, crcExpected)
+	}
+
+	// Verify the chunks contain all the samples.
+	cs := prompb.ChunkedSeries{
+		Labels: getRemoteReadLabels(&rs.MetricName),
+	}
+	var timestamps []int64
+	var values []float64
+	for _, chunkSamples := range []int{120, 120, 10} {
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		if err != nil {
+			t.Fatalf("cannot create appender: %s", err)
+		}
+		for i := 0; i < chunkSamples; i++ {
+			idx := len(timestamps)
+			app.Append(rs.Timestamps[idx], rs.Values[idx])
+			timestamps = append(timestamps, rs.Timestamps[idx])
+			values = append(values, rs.Values[idx])
+		}
+		cs.Chunks = append(cs.Chunks, prompb.Chunk{
+			MinTimeMs: timestamps[len(timestamps)-chunkSamples],
+			MaxTimeMs: timestamps[len(timestamps)-1],
+			Type:      prompb.ChunkEncodingXOR,
+			Data:      c.Bytes(),
+		})
+	}
+	resp := prompb.ChunkedReadResponse{
+		ChunkedSeries: []prompb.ChunkedSeries{cs},
+	}
+	msgExpected := resp.MarshalProtobuf(nil)
+	if !bytes.Equal(msg, msgExpected) {
+		t.Fatalf("unexpected message\ngot\n%X\nwant\n%X", msg, msgExpected)
+	}
+	if !reflect.DeepEqual(timestamps, rs.Timestamps) || !reflect.DeepEqual(values, rs.Values) {
+		t.Fatalf("chunks don't contain all the samples")
+	}
+}
+
+func TestGetRemoteReadLabels(t *testing.T) {
+	var mn storage.MetricName
+	mn.MetricGroup = []byte("foo")
+	mn.AddTag("job", "bar")
+	mn.AddTag("Instance", "baz")
+	labels := getRemoteReadLabels(&mn)
+	labelsExpected := []prompb.Label{
+		{Name: []byte("Instance"), Value: []byte("baz")},
+		{Name: []byte("__name__"), Value: []byte("foo")},
+		{Name: []byte("job"), Value: []byte("bar")},
+	}
+	if !reflect.DeepEqual(labels, labelsExpected) {
+		t.Fatalf("unexpected labels\ngot\n%q\nwant\n%q", labels, labelsExpected)
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/metrics"
 )
 
 // WriteActiveQueries writes active queries to w.
@@ -25,6 +28,20 @@ func WriteActiveQueries(w io.Writer) {
 	}
 }
 
+// CancelActiveQuery cancels the active query with the given qid.
+//
+// The query is stopped at the next deadline check, so its resources are freed soon.
+// False is returned if there is no active query with the given qid.
+func CancelActiveQuery(qid uint64) bool {
+	if !activeQueriesV.Cancel(qid) {
+		return false
+	}
+	canceledQueries.Inc()
+	return true
+}
+
+var canceledQueries = metrics.NewCounter(`vm_canceled_queries_total`)
+
 var activeQueriesV = newActiveQueries()
 
 type activeQueries struct {
@@ -40,6 +57,7 @@ type activeQueryEntry struct {
 	quotedRemoteAddr string
 	q                string
 	startTime        time.Time
+	deadline         searchutils.Deadline
 }
 
 func newActiveQueries() *activeQueries {
@@ -57,6 +75,7 @@ func (aq *activeQueries) Add(ec *EvalConfig, q string) uint64 {
 	aqe.quotedRemoteAddr = ec.QuotedRemoteAddr
 	aqe.q = q
 	aqe.startTime = time.Now()
+	aqe.deadline = ec.Deadline
 
 	aq.mu.Lock()
 	aq.m[aqe.qid] = aqe
@@ -70,6 +89,17 @@ func (aq *activeQueries) Remove(qid uint64) {
 	aq.mu.Unlock()
 }
 
+func (aq *activeQueries) Cancel(qid uint64) bool {
+	aq.mu.Lock()
+	aqe, ok := aq.m[qid]
+	aq.mu.Unlock()
+	if !ok || aqe.deadline.IsCanceled() {
+		return false
+	}
+	aqe.deadline.Cancel()
+	return true
+}
+
 func (aq *activeQueries) GetAll() []activeQueryEntry {
 	aq.mu.Lock()
 	aqes := make([]activeQueryEntry, 0, len(aq.m))
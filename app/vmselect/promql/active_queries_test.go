@@ -0,0 +1,41 @@
+package promql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+)
+
+func TestActiveQueriesCancel(t *testing.T) {
+	aq := newActiveQueries()
+	ec := &EvalConfig{
+		Start:    1000,
+		End:      2000,
+		Step:     100,
+		Deadline: searchutils.NewDeadline(time.Now(), time.Minute, ""),
+	}
+	qid := aq.Add(ec, "foo")
+	if aq.Cancel(qid + 1) {
+		t.Fatalf("unexpected cancelation of missing query")
+	}
+	if ec.Deadline.IsCanceled() {
+		t.Fatalf("unexpected cancelation of the query deadline")
+	}
+	if !aq.Cancel(qid) {
+		t.Fatalf("cannot cancel active query")
+	}
+	if !ec.Deadline.IsCanceled() {
+		t.Fatalf("expecting canceled query deadline")
+	}
+
+	// Repeated cancelation must fail.
+	if aq.Cancel(qid) {
+		t.Fatalf("unexpected repeated cancelation of the query")
+	}
+
+	aq.Remove(qid)
+	if aq.Cancel(qid) {
+		t.Fatalf("unexpected cancelation of removed query")
+	}
+}
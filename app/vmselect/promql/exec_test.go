@@ -2,11 +2,13 @@ package promql
 
 import (
 	"math"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metricsql"
 )
@@ -65,11 +67,17 @@ func TestExecSuccess(t *testing.T) {
 			RoundDigits: 100,
 		}
 		for i := 0; i < 5; i++ {
-			result, err := Exec(ec, q, false)
+			// Results mustn't depend on query tracing.
+			qt := querytracer.New(i%2 == 0, "test query=%s", q)
+			result, err := Exec(qt, ec, q, false)
 			if err != nil {
 				t.Fatalf(`unexpected error when executing %q: %s`, q, err)
 			}
 			testResultsEqual(t, result, resultExpected)
+			qt.Done()
+			if qt.Enabled() && !strings.Contains(qt.ToJSON(), `"message":"eval: query=`) {
+				t.Fatalf("missing eval span in the trace for %q: %s", q, qt.ToJSON())
+			}
 		}
 	}
 
@@ -7500,14 +7508,14 @@ func TestExecError(t *testing.T) {
 			RoundDigits: 100,
 		}
 		for i := 0; i < 4; i++ {
-			rv, err := Exec(ec, q, false)
+			rv, err := Exec(nil, ec, q, false)
 			if err == nil {
 				t.Fatalf(`expecting non-nil error on %q`, q)
 			}
 			if rv != nil {
 				t.Fatalf(`expecting nil rv`)
 			}
-			rv, err = Exec(ec, q, true)
+			rv, err = Exec(nil, ec, q, true)
 			if err == nil {
 				t.Fatalf(`expecting non-nil error on %q`, q)
 			}
@@ -0,0 +1,307 @@
+package promql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// ExplainResult is the result of Explain.
+type ExplainResult struct {
+	// OptimizedQuery is the query after optimizations applied before its execution.
+	OptimizedQuery string
+
+	// Root is the root node of the optimized expression tree.
+	Root *ExplainNode
+
+	// SeriesCount is the estimated number of series the query selects from the storage.
+	SeriesCount int
+
+	// SamplesCount is the estimated number of raw samples the query selects from the storage.
+	SamplesCount int
+
+	// Warnings contains expensive patterns found in the query.
+	Warnings []string
+}
+
+// ExplainNode is a node of the explained expression tree.
+type ExplainNode struct {
+	// Type is the node type: metric, rollup, subquery, function, aggregate, binaryOp, number, string or duration.
+	Type string
+
+	// Expr is the string representation of the node.
+	Expr string
+
+	// Name is the name of the function or the binary operator for the node.
+	Name string
+
+	// Rollup contains rollup details for rollup and subquery nodes.
+	Rollup *ExplainRollup
+
+	// Selector contains estimated search cost for metric nodes.
+	Selector *ExplainSelector
+
+	// Args contains child nodes.
+	Args []*ExplainNode
+}
+
+// ExplainRollup contains rollup details for the explained rollup or subquery.
+type ExplainRollup struct {
+	// Window is the rollup window in milliseconds.
+	Window int64
+
+	// IsDefaultWindow is set if the window isn't set explicitly in the query, so it is calculated automatically.
+	IsDefaultWindow bool
+
+	// Step is the interval between points calculated by the rollup in milliseconds.
+	Step int64
+
+	// Offset is the offset in milliseconds.
+	Offset int64
+
+	// Start and End is the time range in milliseconds the rollup is calculated on.
+	Start int64
+	End   int64
+}
+
+// ExplainSelector contains estimated search cost for the series selector.
+type ExplainSelector struct {
+	// Start and End is the time range in milliseconds for selecting raw samples from the storage.
+	Start int64
+	End   int64
+
+	// SeriesCount is the number of series matching the selector according to the index.
+	SeriesCount int
+
+	// BlocksCount is the number of data blocks to read.
+	BlocksCount int
+
+	// SamplesCount is the estimated number of raw samples to read.
+	SamplesCount int
+
+	// Err contains the error occurred during the estimation.
+	Err string
+
+	// Warnings contains expensive patterns found in the selector.
+	Warnings []string
+}
+
+// Explain explains the execution of q for the given ec without executing it.
+//
+// The cost of every series selector in q is estimated from the index and block headers
+// without reading data blocks. Cached rollup results aren't taken into account,
+// so the estimation is the cost of the query with empty cache.
+func Explain(qt *querytracer.Tracer, ec *EvalConfig, q string) (*ExplainResult, error) {
+	ec.validate()
+	e, err := parsePromQLWithCache(q)
+	if err != nil {
+		return nil, err
+	}
+	var er ExplainResult
+	er.OptimizedQuery = string(e.AppendString(nil))
+	er.Root = er.explainExpr(qt, ec, e)
+	return &er, nil
+}
+
+func (er *ExplainResult) explainExpr(qt *querytracer.Tracer, ec *EvalConfig, e metricsql.Expr) *ExplainNode {
+	en := &ExplainNode{
+		Expr: string(e.AppendString(nil)),
+	}
+	switch t := e.(type) {
+	case *metricsql.MetricExpr:
+		re := &metricsql.RollupExpr{
+			Expr: t,
+		}
+		en.Type = "rollup"
+		en.Name = "default_rollup"
+		er.explainRollup(qt, ec, en, "default_rollup", re)
+	case *metricsql.RollupExpr:
+		en.Type = "rollup"
+		en.Name = "default_rollup"
+		er.explainRollup(qt, ec, en, "default_rollup", t)
+	case *metricsql.FuncExpr:
+		en.Name = t.Name
+		if getRollupFunc(t.Name) == nil {
+			en.Type = "function"
+			for _, arg := range t.Args {
+				en.Args = append(en.Args, er.explainExpr(qt, ec, arg))
+			}
+			break
+		}
+		en.Type = "rollup"
+		rollupArgIdx := metricsql.GetRollupArgIdx(t)
+		for i, arg := range t.Args {
+			if i == rollupArgIdx {
+				er.explainRollup(qt, ec, en, t.Name, getRollupExprArg(arg))
+				continue
+			}
+			en.Args = append(en.Args, er.explainExpr(qt, ec, arg))
+		}
+	case *metricsql.AggrFuncExpr:
+		en.Type = "aggregate"
+		en.Name = t.Name
+		for _, arg := range t.Args {
+			en.Args = append(en.Args, er.explainExpr(qt, ec, arg))
+		}
+	case *metricsql.BinaryOpExpr:
+		en.Type = "binaryOp"
+		en.Name = t.Op
+		en.Args = []*ExplainNode{
+			er.explainExpr(qt, ec, t.Left),
+			er.explainExpr(qt, ec, t.Right),
+		}
+	case *metricsql.NumberExpr:
+		en.Type = "number"
+	case *metricsql.StringExpr:
+		en.Type = "string"
+	case *metricsql.DurationExpr:
+		en.Type = "duration"
+	default:
+		en.Type = fmt.Sprintf("%T", e)
+	}
+	return en
+}
+
+// explainRollup fills en with the details for funcName over re.
+//
+// It follows the time range adjustments made by evalRollupFunc.
+func (er *ExplainResult) explainRollup(qt *querytracer.Tracer, ec *EvalConfig, en *ExplainNode, funcName string, re *metricsql.RollupExpr) {
+	if re.At != nil {
+		ne, ok := re.At.(*metricsql.NumberExpr)
+		if !ok {
+			er.Warnings = append(er.Warnings, fmt.Sprintf("cannot estimate the time range for `@` modifier in %s; the time range for the query is used instead", en.Expr))
+		} else {
+			atTimestamp := int64(ne.N * 1000)
+			ec = newEvalConfig(ec)
+			ec.Start = atTimestamp
+			ec.End = atTimestamp
+		}
+	}
+	var offset int64
+	if re.Offset != nil {
+		offset = re.Offset.Duration(ec.Step)
+		ec = newEvalConfig(ec)
+		ec.Start -= offset
+		ec.End -= offset
+	}
+	if strings.ToLower(funcName) == "rollup_candlestick" {
+		step := ec.Step
+		ec = newEvalConfig(ec)
+		ec.Start += step
+		ec.End += step
+		offset -= step
+	}
+	window := re.Window.Duration(ec.Step)
+	en.Rollup = &ExplainRollup{
+		Window:          window,
+		IsDefaultWindow: re.Window == nil,
+		Step:            ec.Step,
+		Offset:          offset,
+		Start:           ec.Start,
+		End:             ec.End,
+	}
+	me, ok := re.Expr.(*metricsql.MetricExpr)
+	if ok {
+		en.Args = append(en.Args, er.explainSelector(qt, ec, me, window))
+		return
+	}
+
+	// Subquery. See evalRollupFuncWithSubquery.
+	en.Type = "subquery"
+	step := re.Step.Duration(ec.Step)
+	if step == 0 {
+		step = ec.Step
+	}
+	ecSQ := newEvalConfig(ec)
+	ecSQ.Start -= window + maxSilenceInterval + step
+	ecSQ.End += step
+	ecSQ.Step = step
+	ecSQ.Start, ecSQ.End = alignStartEnd(ecSQ.Start, ecSQ.End, ecSQ.Step)
+	if err := ValidateMaxPointsPerTimeseries(ecSQ.Start, ecSQ.End, ecSQ.Step); err != nil {
+		er.Warnings = append(er.Warnings, fmt.Sprintf("subquery %s cannot be executed: %s", en.Expr, err))
+	}
+	en.Args = append(en.Args, er.explainExpr(qt, ecSQ, re.Expr))
+}
+
+// explainSelector returns the node for me with the estimated search cost.
+//
+// The time range for the search is calculated in the same way as evalRollupFuncWithMetricExpr does.
+func (er *ExplainResult) explainSelector(qt *querytracer.Tracer, ec *EvalConfig, me *metricsql.MetricExpr, window int64) *ExplainNode {
+	en := &ExplainNode{
+		Type: "metric",
+		Expr: string(me.AppendString(nil)),
+	}
+	if me.IsEmpty() {
+		return en
+	}
+	minTimestamp := ec.Start - maxSilenceInterval
+	if window > ec.Step {
+		minTimestamp -= window
+	} else {
+		minTimestamp -= ec.Step
+	}
+	es := &ExplainSelector{
+		Start:    minTimestamp,
+		End:      ec.End,
+		Warnings: getExpensiveSelectorWarnings(me),
+	}
+	en.Selector = es
+	for _, warning := range es.Warnings {
+		er.Warnings = append(er.Warnings, fmt.Sprintf("%s: %s", en.Expr, warning))
+	}
+
+	tfs := searchutils.ToTagFilters(me.LabelFilters)
+	tfss := searchutils.JoinTagFilterss([][]storage.TagFilter{tfs}, ec.EnforcedTagFilterss)
+	sq := storage.NewSearchQuery(minTimestamp, ec.End, tfss)
+	se, err := netstorage.EstimateSearchQuery(qt, sq, ec.Deadline)
+	if err != nil {
+		es.Err = err.Error()
+		er.Warnings = append(er.Warnings, fmt.Sprintf("%s: cannot estimate the number of selected series: %s", en.Expr, err))
+		return en
+	}
+	es.SeriesCount = se.SeriesCount
+	es.BlocksCount = se.BlocksCount
+	es.SamplesCount = se.SamplesCount
+	er.SeriesCount += se.SeriesCount
+	er.SamplesCount += se.SamplesCount
+	return en
+}
+
+// getExpensiveSelectorWarnings returns warnings for expensive filters in me.
+func getExpensiveSelectorWarnings(me *metricsql.MetricExpr) []string {
+	var warnings []string
+	hasMetricName := false
+	hasPositiveFilter := false
+	for _, lf := range me.LabelFilters {
+		isMatchAll := lf.IsRegexp && (lf.Value == ".*" || lf.Value == ".+")
+		if !lf.IsNegative && !isMatchAll && lf.Value != "" {
+			hasPositiveFilter = true
+		}
+		// Regexp filters without special chars are matched as plain filters.
+		isRegexp := lf.IsRegexp && regexp.QuoteMeta(lf.Value) != lf.Value
+		if lf.Label == "__name__" {
+			if isRegexp {
+				warnings = append(warnings, fmt.Sprintf("regexp filter %s over metric name requires matching all the metric names in the index", lf.AppendString(nil)))
+			} else if !lf.IsNegative {
+				hasMetricName = true
+			}
+			continue
+		}
+		if isRegexp && strings.HasPrefix(lf.Value, ".*") && !isMatchAll {
+			warnings = append(warnings, fmt.Sprintf("regexp filter %s starting with `.*` requires matching all the values for %q label in the index", lf.AppendString(nil), lf.Label))
+		}
+	}
+	if !hasMetricName {
+		warnings = append(warnings, "the selector has no metric name, so it may match big number of series")
+	}
+	if !hasPositiveFilter {
+		warnings = append(warnings, "the selector has no positive filters, so it matches all the series except of the excluded ones")
+	}
+	return warnings
+}
@@ -0,0 +1,84 @@
+package promql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+func TestGetExpensiveSelectorWarnings(t *testing.T) {
+	f := func(selector string, warningsExpected []string) {
+		t.Helper()
+		e, err := metricsql.Parse(selector)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", selector, err)
+		}
+		me, ok := e.(*metricsql.MetricExpr)
+		if !ok {
+			t.Fatalf("expecting metric selector; got %T", e)
+		}
+		warnings := getExpensiveSelectorWarnings(me)
+		if !reflect.DeepEqual(warnings, warningsExpected) {
+			t.Fatalf("unexpected warnings for %s\ngot\n%q\nwant\n%q", selector, warnings, warningsExpected)
+		}
+	}
+
+	f(`foo`, nil)
+	f(`foo{job="bar",instance!="baz"}`, nil)
+	f(`{__name__=~"foo"}`, nil)
+	f(`foo{job=~"bar.*"}`, nil)
+	f(`{__name__=~"foo.*"}`, []string{
+		`regexp filter __name__=~"foo.*" over metric name requires matching all the metric names in the index`,
+		`the selector has no metric name, so it may match big number of series`,
+	})
+	f(`foo{job=~".*bar"}`, []string{
+		`regexp filter job=~".*bar" starting with ` + "`.*`" + ` requires matching all the values for "job" label in the index`,
+	})
+	f(`{job="bar"}`, []string{
+		`the selector has no metric name, so it may match big number of series`,
+	})
+	f(`{job!="bar",instance=~".*"}`, []string{
+		`the selector has no metric name, so it may match big number of series`,
+		`the selector has no positive filters, so it matches all the series except of the excluded ones`,
+	})
+}
+
+func TestExplainWithoutSelectors(t *testing.T) {
+	ec := &EvalConfig{
+		Start:    1000e3,
+		End:      2000e3,
+		Step:     100e3,
+		Deadline: searchutils.NewDeadline(time.Now(), time.Minute, ""),
+	}
+	er, err := Explain(nil, ec, `abs(1 + 2*time())`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if er.OptimizedQuery != `abs(1 + (2 * time()))` {
+		t.Fatalf("unexpected optimized query: %s", er.OptimizedQuery)
+	}
+	var types []string
+	var visit func(en *ExplainNode)
+	visit = func(en *ExplainNode) {
+		types = append(types, en.Type+":"+en.Name)
+		for _, arg := range en.Args {
+			visit(arg)
+		}
+	}
+	visit(er.Root)
+	typesExpected := []string{"function:abs", "binaryOp:+", "number:", "binaryOp:*", "number:", "function:time"}
+	if !reflect.DeepEqual(types, typesExpected) {
+		t.Fatalf("unexpected tree\ngot\n%q\nwant\n%q", types, typesExpected)
+	}
+	if er.SeriesCount != 0 || er.SamplesCount != 0 || len(er.Warnings) != 0 {
+		t.Fatalf("unexpected estimation for query without selectors: %+v", er)
+	}
+
+	// Invalid query
+	if _, err := Explain(nil, ec, `foo(`); err == nil {
+		t.Fatalf("expecting non-nil error for invalid query")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
 	"github.com/VictoriaMetrics/fastcache"
@@ -42,7 +43,7 @@ func ResetRollupResultCacheIfNeeded(mrs []storage.MetricRow) {
 	minTimestamp := int64(fasttime.UnixTimestamp()*1000) - cacheTimestampOffset.Milliseconds() + checkRollupResultCacheResetInterval.Milliseconds()
 	needCacheReset := false
 	for i := range mrs {
-		if mrs[i].Timestamp < minTimestamp {
+		if storage.TimestampToMsecs(mrs[i].Timestamp) < minTimestamp {
 			var mr storage.MetricRow
 			mr.CopyFrom(&mrs[i])
 			rollupResultResetMetricRowSample.Store(&mr)
@@ -61,7 +62,7 @@ func checkRollupResultCacheReset() {
 		time.Sleep(checkRollupResultCacheResetInterval)
 		if atomic.SwapUint32(&needRollupResultCacheReset, 0) > 0 {
 			mr := rollupResultResetMetricRowSample.Load().(*storage.MetricRow)
-			d := int64(fasttime.UnixTimestamp()*1000) - mr.Timestamp - cacheTimestampOffset.Milliseconds()
+			d := int64(fasttime.UnixTimestamp()*1000) - storage.TimestampToMsecs(mr.Timestamp) - cacheTimestampOffset.Milliseconds()
 			logger.Warnf("resetting rollup result cache because the metric %s has a timestamp older than -search.cacheTimestampOffset=%s by %.3fs",
 				mr.String(), cacheTimestampOffset, float64(d)/1e3)
 			ResetRollupResultCache()
@@ -185,10 +186,15 @@ func ResetRollupResultCache() {
 	logger.Infof("rollupResult cache has been cleared")
 }
 
-func (rrc *rollupResultCache) Get(ec *EvalConfig, expr metricsql.Expr, window int64) (tss []*timeseries, newStart int64) {
+func (rrc *rollupResultCache) Get(qt *querytracer.Tracer, ec *EvalConfig, expr metricsql.Expr, window int64) (tss []*timeseries, newStart int64) {
 	if !ec.mayCache() {
+		qt.Printf("do not fetch series from rollup result cache, since it is disabled in the current context")
 		return nil, ec.Start
 	}
+	if qt.Enabled() {
+		qt = qt.NewChild("rollup result cache get: query=%s, timeRange=[%d..%d], step=%d, window=%d", expr.AppendString(nil), ec.Start, ec.End, ec.Step, window)
+		defer qt.Done()
+	}
 
 	// Obtain tss from the cache.
 	bb := bbPool.Get()
@@ -197,6 +203,7 @@ func (rrc *rollupResultCache) Get(ec *EvalConfig, expr metricsql.Expr, window in
 	bb.B = marshalRollupResultCacheKey(bb.B[:0], expr, window, ec.Step, ec.EnforcedTagFilterss)
 	metainfoBuf := rrc.c.Get(nil, bb.B)
 	if len(metainfoBuf) == 0 {
+		qt.Printf("cache miss: nothing found")
 		return nil, ec.Start
 	}
 	var mi rollupResultCacheMetainfo
@@ -205,6 +212,7 @@ func (rrc *rollupResultCache) Get(ec *EvalConfig, expr metricsql.Expr, window in
 	}
 	key := mi.GetBestKey(ec.Start, ec.End)
 	if key.prefix == 0 && key.suffix == 0 {
+		qt.Printf("cache miss: nothing found on the given timeRange")
 		return nil, ec.Start
 	}
 	bb.B = key.Marshal(bb.B[:0])
@@ -216,6 +224,7 @@ func (rrc *rollupResultCache) Get(ec *EvalConfig, expr metricsql.Expr, window in
 		metainfoBuf = mi.Marshal(metainfoBuf[:0])
 		bb.B = marshalRollupResultCacheKey(bb.B[:0], expr, window, ec.Step, ec.EnforcedTagFilterss)
 		rrc.c.Set(bb.B, metainfoBuf)
+		qt.Printf("cache miss: the cached entry has been evicted")
 		return nil, ec.Start
 	}
 	// Decompress into newly allocated byte slice, since tss returned from unmarshalTimeseriesFast
@@ -237,10 +246,12 @@ func (rrc *rollupResultCache) Get(ec *EvalConfig, expr metricsql.Expr, window in
 	}
 	if i == len(timestamps) {
 		// no matches.
+		qt.Printf("cache miss: cached series contain no points on the given timeRange")
 		return nil, ec.Start
 	}
 	if timestamps[i] != ec.Start {
 		// The cached range doesn't cover the requested range.
+		qt.Printf("cache miss: cached series don't cover the start of the given timeRange")
 		return nil, ec.Start
 	}
 
@@ -251,6 +262,7 @@ func (rrc *rollupResultCache) Get(ec *EvalConfig, expr metricsql.Expr, window in
 	j++
 	if j <= i {
 		// no matches.
+		qt.Printf("cache miss: cached series contain no points on the given timeRange")
 		return nil, ec.Start
 	}
 
@@ -261,15 +273,24 @@ func (rrc *rollupResultCache) Get(ec *EvalConfig, expr metricsql.Expr, window in
 
 	timestamps = tss[0].Timestamps
 	newStart = timestamps[len(timestamps)-1] + ec.Step
+	if newStart > ec.End {
+		qt.Printf("cache hit: return %d series on the whole timeRange", len(tss))
+	} else {
+		qt.Printf("partial cache hit: return %d series on the timeRange=[%d..%d]", len(tss), ec.Start, newStart-ec.Step)
+	}
 	return tss, newStart
 }
 
 var resultBufPool bytesutil.ByteBufferPool
 
-func (rrc *rollupResultCache) Put(ec *EvalConfig, expr metricsql.Expr, window int64, tss []*timeseries) {
+func (rrc *rollupResultCache) Put(qt *querytracer.Tracer, ec *EvalConfig, expr metricsql.Expr, window int64, tss []*timeseries) {
 	if len(tss) == 0 || !ec.mayCache() {
 		return
 	}
+	if qt.Enabled() {
+		qt = qt.NewChild("rollup result cache put: query=%s, timeRange=[%d..%d], step=%d, window=%d, series=%d", expr.AppendString(nil), ec.Start, ec.End, ec.Step, window, len(tss))
+		defer qt.Done()
+	}
 
 	// Remove values up to currentTime - step - cacheTimestampOffset,
 	// since these values may be added later.
@@ -282,6 +303,7 @@ func (rrc *rollupResultCache) Put(ec *EvalConfig, expr metricsql.Expr, window in
 	i++
 	if i == 0 {
 		// Nothing to store in the cache.
+		qt.Printf("nothing to store in the cache, since all the points are too close to the current time")
 		return
 	}
 	if i < len(timestamps) {
@@ -302,6 +324,7 @@ func (rrc *rollupResultCache) Put(ec *EvalConfig, expr metricsql.Expr, window in
 	resultBuf.B = marshalTimeseriesFast(resultBuf.B[:0], tss, maxMarshaledSize, ec.Step)
 	if len(resultBuf.B) == 0 {
 		tooBigRollupResults.Inc()
+		qt.Printf("cannot store series in the cache, since they would occupy more than %d bytes", maxMarshaledSize)
 		return
 	}
 	compressedResultBuf := resultBufPool.Get()
@@ -328,6 +351,8 @@ func (rrc *rollupResultCache) Put(ec *EvalConfig, expr metricsql.Expr, window in
 	mi.AddKey(key, timestamps[0], timestamps[len(timestamps)-1])
 	metainfoBuf = mi.Marshal(metainfoBuf[:0])
 	rrc.c.Set(bb.B, metainfoBuf)
+	qt.Printf("store %d series with %d points per series on the timeRange=[%d..%d]; compressed size: %d bytes",
+		len(tss), len(timestamps), timestamps[0], timestamps[len(timestamps)-1], len(compressedResultBuf.B))
 }
 
 var (
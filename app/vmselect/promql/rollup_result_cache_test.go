@@ -34,7 +34,7 @@ func TestRollupResultCache(t *testing.T) {
 
 	// Try obtaining an empty value.
 	t.Run("empty", func(t *testing.T) {
-		tss, newStart := rollupResultCacheV.Get(ec, fe, window)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != ec.Start {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, ec.Start)
 		}
@@ -52,8 +52,8 @@ func TestRollupResultCache(t *testing.T) {
 				Values:     []float64{0, 1, 2},
 			},
 		}
-		rollupResultCacheV.Put(ec, fe, window, tss)
-		tss, newStart := rollupResultCacheV.Get(ec, fe, window)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != 1400 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 1400)
 		}
@@ -73,8 +73,8 @@ func TestRollupResultCache(t *testing.T) {
 				Values:     []float64{0, 1, 2},
 			},
 		}
-		rollupResultCacheV.Put(ec, ae, window, tss)
-		tss, newStart := rollupResultCacheV.Get(ec, ae, window)
+		rollupResultCacheV.Put(nil, ec, ae, window, tss)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, ae, window)
 		if newStart != 1400 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 1400)
 		}
@@ -96,8 +96,8 @@ func TestRollupResultCache(t *testing.T) {
 				Values:     []float64{333, 0, 1, 2},
 			},
 		}
-		rollupResultCacheV.Put(ec, fe, window, tss)
-		tss, newStart := rollupResultCacheV.Get(ec, fe, window)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != 1000 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 1000)
 		}
@@ -115,8 +115,8 @@ func TestRollupResultCache(t *testing.T) {
 				Values:     []float64{0, 1, 2},
 			},
 		}
-		rollupResultCacheV.Put(ec, fe, window, tss)
-		tss, newStart := rollupResultCacheV.Get(ec, fe, window)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != 1000 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 1000)
 		}
@@ -134,8 +134,8 @@ func TestRollupResultCache(t *testing.T) {
 				Values:     []float64{0, 1, 2},
 			},
 		}
-		rollupResultCacheV.Put(ec, fe, window, tss)
-		tss, newStart := rollupResultCacheV.Get(ec, fe, window)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != 1000 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 1000)
 		}
@@ -153,8 +153,8 @@ func TestRollupResultCache(t *testing.T) {
 				Values:     []float64{0, 1, 2},
 			},
 		}
-		rollupResultCacheV.Put(ec, fe, window, tss)
-		tss, newStart := rollupResultCacheV.Get(ec, fe, window)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != 1000 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 1000)
 		}
@@ -172,8 +172,8 @@ func TestRollupResultCache(t *testing.T) {
 				Values:     []float64{0, 1, 2, 3, 4, 5, 6, 7},
 			},
 		}
-		rollupResultCacheV.Put(ec, fe, window, tss)
-		tss, newStart := rollupResultCacheV.Get(ec, fe, window)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != 2200 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 2200)
 		}
@@ -195,8 +195,8 @@ func TestRollupResultCache(t *testing.T) {
 				Values:     []float64{1, 2, 3, 4, 5, 6},
 			},
 		}
-		rollupResultCacheV.Put(ec, fe, window, tss)
-		tss, newStart := rollupResultCacheV.Get(ec, fe, window)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != 2200 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 2200)
 		}
@@ -220,8 +220,8 @@ func TestRollupResultCache(t *testing.T) {
 			}
 			tss = append(tss, ts)
 		}
-		rollupResultCacheV.Put(ec, fe, window, tss)
-		tssResult, newStart := rollupResultCacheV.Get(ec, fe, window)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss)
+		tssResult, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != 2200 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 2200)
 		}
@@ -249,10 +249,10 @@ func TestRollupResultCache(t *testing.T) {
 				Values:     []float64{0, 1, 2},
 			},
 		}
-		rollupResultCacheV.Put(ec, fe, window, tss1)
-		rollupResultCacheV.Put(ec, fe, window, tss2)
-		rollupResultCacheV.Put(ec, fe, window, tss3)
-		tss, newStart := rollupResultCacheV.Get(ec, fe, window)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss1)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss2)
+		rollupResultCacheV.Put(nil, ec, fe, window, tss3)
+		tss, newStart := rollupResultCacheV.Get(nil, ec, fe, window)
 		if newStart != 1400 {
 			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 1400)
 		}
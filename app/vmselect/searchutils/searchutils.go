@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
@@ -161,12 +162,32 @@ func GetBool(r *http.Request, argKey string) bool {
 	}
 }
 
+// GetTimestampsPerMsec returns the number of timestamp units per millisecond for the precision from `timestamp_precision` query arg.
+//
+// Milliseconds are used if the arg is missing.
+func GetTimestampsPerMsec(r *http.Request) (int64, error) {
+	precision := r.FormValue("timestamp_precision")
+	if len(precision) == 0 {
+		return 1, nil
+	}
+	n, err := storage.ParseTimestampPrecision(precision)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse `timestamp_precision` query arg: %w", err)
+	}
+	return n, nil
+}
+
 // Deadline contains deadline with the corresponding timeout for pretty error messages.
+//
+// Deadline copies share the cancellation state, so Cancel call on any copy cancels all of them.
 type Deadline struct {
 	deadline uint64
 
 	timeout  time.Duration
 	flagHint string
+
+	// canceled is set to non-zero by Cancel.
+	canceled *uint32
 }
 
 // NewDeadline returns deadline for the given timeout.
@@ -178,12 +199,25 @@ func NewDeadline(startTime time.Time, timeout time.Duration, flagHint string) De
 		deadline: uint64(startTime.Add(timeout).Unix()),
 		timeout:  timeout,
 		flagHint: flagHint,
+		canceled: new(uint32),
 	}
 }
 
-// Exceeded returns true if deadline is exceeded.
+// Exceeded returns true if deadline is exceeded or if d is canceled.
 func (d *Deadline) Exceeded() bool {
-	return fasttime.UnixTimestamp() > d.deadline
+	return d.IsCanceled() || fasttime.UnixTimestamp() > d.deadline
+}
+
+// Cancel cancels d, so Exceeded starts returning true.
+func (d *Deadline) Cancel() {
+	if d.canceled != nil {
+		atomic.StoreUint32(d.canceled, 1)
+	}
+}
+
+// IsCanceled returns true if d is canceled via Cancel.
+func (d *Deadline) IsCanceled() bool {
+	return d.canceled != nil && atomic.LoadUint32(d.canceled) != 0
 }
 
 // Deadline returns deadline in unix timestamp seconds.
@@ -191,10 +225,21 @@ func (d *Deadline) Deadline() uint64 {
 	return d.deadline
 }
 
+// CanceledFlag returns the flag, which is set to non-zero when d is canceled.
+//
+// The flag may be passed to storage searches, so they are stopped on Cancel call.
+// nil is returned for zero d.
+func (d *Deadline) CanceledFlag() *uint32 {
+	return d.canceled
+}
+
 // String returns human-readable string representation for d.
 func (d *Deadline) String() string {
 	startTime := time.Unix(int64(d.deadline), 0).Add(-d.timeout)
 	elapsed := time.Since(startTime)
+	if d.IsCanceled() {
+		return fmt.Sprintf("the query has been canceled after %.3f seconds", elapsed.Seconds())
+	}
 	return fmt.Sprintf("%.3f seconds (elapsed %.3f seconds); the timeout can be adjusted with `%s` command-line flag", d.timeout.Seconds(), elapsed.Seconds(), d.flagHint)
 }
 
@@ -6,7 +6,10 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 )
@@ -316,3 +319,37 @@ func tagFiltersToString(tfs []storage.TagFilter) string {
 	b = append(b, '}')
 	return string(b)
 }
+
+func TestDeadlineCancel(t *testing.T) {
+	d := NewDeadline(time.Now(), time.Minute, "-search.maxQueryDuration")
+	if d.Exceeded() {
+		t.Fatalf("unexpected deadline exceeding before its cancelation")
+	}
+	if d.IsCanceled() {
+		t.Fatalf("unexpected deadline cancelation")
+	}
+
+	// Cancel must be visible via all the copies of d and via the flag passed to storage searches.
+	canceled := d.CanceledFlag()
+	dCopy := d
+	dCopy.Cancel()
+	if !d.IsCanceled() {
+		t.Fatalf("expecting canceled deadline")
+	}
+	if atomic.LoadUint32(canceled) == 0 {
+		t.Fatalf("expecting non-zero canceled flag")
+	}
+	if !d.Exceeded() {
+		t.Fatalf("expecting exceeded deadline after its cancelation")
+	}
+	if s := d.String(); !strings.Contains(s, "the query has been canceled") {
+		t.Fatalf("unexpected string representation for the canceled deadline: %q", s)
+	}
+
+	// Zero deadline cannot be canceled.
+	var dZero Deadline
+	dZero.Cancel()
+	if dZero.IsCanceled() {
+		t.Fatalf("unexpected cancelation for zero deadline")
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage/replication"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
@@ -16,22 +18,37 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/syncwg"
 	"github.com/VictoriaMetrics/metrics"
 )
 
 var (
-	retentionPeriod   = flagutil.NewDuration("retentionPeriod", 1, "Data with timestamps outside the retentionPeriod is automatically deleted")
+	retentionPeriod      = flagutil.NewDuration("retentionPeriod", 1, "Data with timestamps outside the retentionPeriod is automatically deleted")
+	partitionGranularity = flag.String("storage.partitionGranularity", "month", "The time range covered by newly created partitions. Supported values: month, week, day. "+
+		"Existing partitions remain readable after the change. See https://docs.victoriametrics.com/#retention")
+	retentionFilters = flagutil.NewArraySelector("retentionFilter", "Retention filter in the format 'series_selector:retention'. For example, '{env=\"dev\"}:7d' "+
+		"instructs to keep samples for series with env=\"dev\" label for 7 days. The retention cannot exceed -retentionPeriod. "+
+		"See https://docs.victoriametrics.com/#retention-filters")
 	snapshotAuthKey   = flag.String("snapshotAuthKey", "", "authKey, which must be passed in query string to /snapshot* pages")
 	forceMergeAuthKey = flag.String("forceMergeAuthKey", "", "authKey, which must be passed in query string to /internal/force_merge pages")
 	forceFlushAuthKey = flag.String("forceFlushAuthKey", "", "authKey, which must be passed in query string to /internal/force_flush pages")
 
-	precisionBits = flag.Int("precisionBits", 64, "The number of precision bits to store per each value. Lower precision bits improves data compression at the cost of precision loss")
+	precisionBits      = flag.Int("precisionBits", 64, "The number of precision bits to store per each value. Lower precision bits improves data compression at the cost of precision loss")
+	timestampPrecision = flag.String("storage.timestampPrecision", "ms", "The precision for stored timestamps. Supported values: ms, us, ns. "+
+		"The precision cannot be changed after the data is stored at -storageDataPath. See https://docs.victoriametrics.com/#timestamp-precision")
+	xorEncoding = flag.Bool("storage.xorEncoding", false, "Whether to store values with lossless XOR encoding for data blocks where it gives better compression. "+
+		"Data blocks stored with this encoding cannot be read by older releases. See https://docs.victoriametrics.com/#xor-encoding")
 
 	// DataPath is a path to storage data.
 	DataPath = flag.String("storageDataPath", "victoria-metrics-data", "Path to storage data")
 
+	coldDataPath = flag.String("storageDataPath.cold", "", "Optional path to cold storage. Partitions older than -storage.coldPartitionAge are moved "+
+		"from -storageDataPath to this path. Queries are served from both paths. See https://docs.victoriametrics.com/#cold-storage")
+	coldPartitionAge = flagutil.NewDuration("storage.coldPartitionAge", 3, "Partitions with all the samples older than the given age are moved to -storageDataPath.cold. "+
+		"This flag has effect only if -storageDataPath.cold is set")
+
 	finalMergeDelay = flag.Duration("finalMergeDelay", 0, "The delay before starting final merge for per-month partition after no new data is ingested into it. "+
 		"Final merge may require additional disk IO and CPU resources. Final merge may increase query speed and reduce disk space usage in some cases. "+
 		"Zero value disables final merge")
@@ -48,11 +65,42 @@ var (
 	maxDailySeries = flag.Int("storage.maxDailySeries", 0, "The maximum number of unique series can be added to the storage during the last 24 hours. "+
 		"Excess series are logged and dropped. This can be useful for limiting series churn rate. See also -storage.maxHourlySeries")
 
+	maxExemplarsPerSeries = flag.Int("storage.maxExemplarsPerSeries", 10, "The maximum number of the most recent exemplars to keep per each time series. "+
+		"Exemplars are served via /api/v1/query_exemplars. Zero value disables exemplars storage. See also -storage.maxExemplarSeries")
+	maxExemplarSeries = flag.Int("storage.maxExemplarSeries", 10000, "The maximum number of time series to keep exemplars for. "+
+		"Exemplars for the least recently updated series are dropped when the limit is reached. See also -storage.maxExemplarsPerSeries")
+
+	walEnabled = flag.Bool("storage.wal", false, "Whether to write incoming samples to write-ahead log at <-storageDataPath>/wal before accepting them. "+
+		"This prevents from losing recently added samples on unclean shutdown at the cost of higher disk IO and insert latency, since every insert waits for fsync. "+
+		"Concurrent inserts share a single fsync. See https://docs.victoriametrics.com/#write-ahead-log")
+
+	trackMetricNamesStats = flag.Bool("storage.trackMetricNamesStats", false, "Whether to track the number of queries and the last query time per each metric name. "+
+		"The stats is exposed at /api/v1/status/metric_names_stats and can be used for finding unused metrics. See https://docs.victoriametrics.com/#track-ingested-metrics-usage")
+
+	// ReadOnlyReplica is set if -storageDataPath is opened in read-only replica mode.
+	ReadOnlyReplica = flag.Bool("storage.readOnlyReplica", false, "Whether to open -storageDataPath in read-only mode for serving queries. "+
+		"The path may be owned by another VictoriaMetrics instance or may contain a copy of its data. New data becomes visible after -storage.replicaRefreshInterval. "+
+		"See https://docs.victoriametrics.com/#read-only-replica")
+	replicaRefreshInterval = flag.Duration("storage.replicaRefreshInterval", 30*time.Second, "How often to pick up new data at -storageDataPath in read-only replica mode. "+
+		"This flag has effect only if -storage.readOnlyReplica is set")
+	// ReplicaTmpDataPath is a path for temporary files and caches in read-only replica mode.
+	ReplicaTmpDataPath = flag.String("storage.replicaTmpDataPath", "victoria-metrics-replica-tmp", "Path to directory for temporary files and caches in read-only replica mode, "+
+		"since -storageDataPath isn't modified in this mode. This flag has effect only if -storage.readOnlyReplica is set")
+
 	minFreeDiskSpaceBytes = flagutil.NewBytes("storage.minFreeDiskSpaceBytes", 10e6, "The minimum free disk space at -storageDataPath after which the storage stops accepting new data")
 
+	verifyAndExit = flag.Bool("storage.verifyAndExit", false, "Whether to verify the consistency of data at -storageDataPath and -storageDataPath.cold and exit. "+
+		"The exit code is non-zero if corrupted parts, tombstones files, WAL segments or series missing in indexdb are found. See also -storage.quarantineCorruptedParts and https://docs.victoriametrics.com/#storage-verification")
+	quarantineCorruptedParts = flag.Bool("storage.quarantineCorruptedParts", false, "Whether to move corrupted parts found by -storage.verifyAndExit into quarantine directory under -storageDataPath or -storageDataPath.cold, "+
+		"so the storage could be opened without them")
+
 	cacheSizeStorageTSID        = flagutil.NewBytes("storage.cacheSizeStorageTSID", 0, "Overrides max size for storage/tsid cache. See https://docs.victoriametrics.com/Single-server-VictoriaMetrics.html#cache-tuning")
 	cacheSizeIndexDBIndexBlocks = flagutil.NewBytes("storage.cacheSizeIndexDBIndexBlocks", 0, "Overrides max size for indexdb/indexBlocks cache. See https://docs.victoriametrics.com/Single-server-VictoriaMetrics.html#cache-tuning")
 	cacheSizeIndexDBDataBlocks  = flagutil.NewBytes("storage.cacheSizeIndexDBDataBlocks", 0, "Overrides max size for indexdb/dataBlocks cache. See https://docs.victoriametrics.com/Single-server-VictoriaMetrics.html#cache-tuning")
+
+	maxPrewarmBlocks = flag.Int("storage.maxPrewarmBlocks", 100000, "The maximum number of the most recently accessed blocks per each block cache to save on graceful shutdown "+
+		"and to read into caches in background on startup. This reduces query latency after restarts. Set it to 0 for disabling cache prewarming. "+
+		"See https://docs.victoriametrics.com/Single-server-VictoriaMetrics.html#cache-prewarming")
 )
 
 // CheckTimeRange returns true if the given tr is denied for querying.
@@ -84,6 +132,8 @@ func InitWithoutMetrics(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 		logger.Fatalf("invalid `-precisionBits`: %s", err)
 	}
 
+	encoding.SetXOREncoding(*xorEncoding)
+
 	resetResponseCacheIfNeeded = resetCacheIfNeeded
 	storage.SetLogNewSeries(*logNewSeries)
 	storage.SetFinalMergeDelay(*finalMergeDelay)
@@ -93,6 +143,30 @@ func InitWithoutMetrics(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 	storage.SetTSIDCacheSize(cacheSizeStorageTSID.N)
 	mergeset.SetIndexBlocksCacheSize(cacheSizeIndexDBIndexBlocks.N)
 	mergeset.SetDataBlocksCacheSize(cacheSizeIndexDBDataBlocks.N)
+	storage.SetMaxPrewarmBlocks(*maxPrewarmBlocks)
+	rfs, err := storage.ParseRetentionFilters(*retentionFilters)
+	if err != nil {
+		logger.Fatalf("cannot parse -retentionFilter: %s", err)
+	}
+	storage.SetRetentionFilters(rfs)
+	if err := storage.SetPartitionGranularity(*partitionGranularity); err != nil {
+		logger.Fatalf("invalid -storage.partitionGranularity: %s", err)
+	}
+	if err := storage.SetTimestampPrecision(*timestampPrecision); err != nil {
+		logger.Fatalf("invalid -storage.timestampPrecision: %s", err)
+	}
+	storage.SetExemplarsLimits(*maxExemplarsPerSeries, *maxExemplarSeries)
+	storage.SetColdStorage(*coldDataPath, coldPartitionAge.Msecs)
+	storage.SetWAL(*walEnabled)
+	storage.SetTrackMetricNamesStats(*trackMetricNamesStats)
+	storage.SetReadOnlyReplica(*ReadOnlyReplica, *replicaRefreshInterval)
+
+	if *verifyAndExit {
+		mustVerifyStorageAndExit()
+	}
+	if *ReadOnlyReplica && replication.IsEnabled() {
+		logger.Fatalf("-storage.readOnlyReplica cannot be used together with -replication.* command-line flags")
+	}
 
 	logger.Infof("opening storage at %q with -retentionPeriod=%s", *DataPath, retentionPeriod)
 	startTime := time.Now()
@@ -112,6 +186,42 @@ func InitWithoutMetrics(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 	sizeBytes := tm.SmallSizeBytes + tm.BigSizeBytes
 	logger.Infof("successfully opened storage %q in %.3f seconds; partsCount: %d; blocksCount: %d; rowsCount: %d; sizeBytes: %d",
 		*DataPath, time.Since(startTime).Seconds(), partsCount, blocksCount, rowsCount, sizeBytes)
+
+	replication.Init(*DataPath, addReplicatedRows, flushReplicatedRows)
+}
+
+func mustVerifyStorageAndExit() {
+	logger.Infof("verifying storage at %q", *DataPath)
+	startTime := time.Now()
+	vr, err := storage.VerifyStorage(*DataPath, *coldDataPath, *quarantineCorruptedParts)
+	if err != nil {
+		logger.Fatalf("cannot verify storage at %q: %s", *DataPath, err)
+	}
+	for _, cp := range vr.CorruptedParts {
+		if cp.QuarantinePath != "" {
+			logger.Errorf("corrupted part %q has been moved to %q: %s", cp.Path, cp.QuarantinePath, cp.Err)
+		} else {
+			logger.Errorf("corrupted part %q: %s", cp.Path, cp.Err)
+		}
+	}
+	for _, cf := range vr.CorruptedFiles {
+		logger.Errorf("corrupted file %q: %s", cf.Path, cf.Err)
+	}
+	if n := len(vr.MissingMetricIDs); n > 0 {
+		metricIDs := vr.MissingMetricIDs
+		if len(metricIDs) > 10 {
+			metricIDs = metricIDs[:10]
+		}
+		logger.Errorf("%d series from data parts cannot be found in indexdb; the first metricIDs: %d", n, metricIDs)
+	}
+	logger.Infof("verified storage at %q in %.3f seconds; dataParts: %d; indexdbParts: %d; metricMetadataParts: %d; tombstonesFiles: %d; walSegments: %d; "+
+		"corruptedParts: %d; corruptedFiles: %d; missingSeries: %d",
+		*DataPath, time.Since(startTime).Seconds(), vr.DataParts, vr.IndexDBParts, vr.MetricMetadataParts, vr.TombstonesFiles, vr.WALSegments,
+		len(vr.CorruptedParts), len(vr.CorruptedFiles), len(vr.MissingMetricIDs))
+	if vr.HasErrors() {
+		logger.Fatalf("storage verification failed for %q", *DataPath)
+	}
+	os.Exit(0)
 }
 
 // Storage is a storage.
@@ -133,13 +243,74 @@ func AddRows(mrs []storage.MetricRow) error {
 	if Storage.IsReadOnly() {
 		return errReadOnly
 	}
+	if replication.IsStandby() {
+		return replication.ErrStandby
+	}
 	resetResponseCacheIfNeeded(mrs)
 	WG.Add(1)
-	err := Storage.AddRows(mrs, uint8(*precisionBits))
+	// Rows stored in the Storage are added to the replication log even if other rows couldn't be stored,
+	// so the standby doesn't miss them.
+	err := Storage.AddRowsExt(mrs, uint8(*precisionBits), replicateRows)
 	WG.Done()
 	return err
 }
 
+func replicateRows(mrs []*storage.MetricRow) error {
+	return replication.AddRows(mrs, uint8(*precisionBits))
+}
+
+// addReplicatedRows adds mrs received from the primary to the storage.
+func addReplicatedRows(mrs []storage.MetricRow, precisionBits uint8) error {
+	resetResponseCacheIfNeeded(mrs)
+	WG.Add(1)
+	err := Storage.AddRows(mrs, precisionBits)
+	WG.Done()
+	return err
+}
+
+// flushReplicatedRows flushes rows received from the primary to files.
+func flushReplicatedRows() bool {
+	WG.Add(1)
+	ok := Storage.FlushToFiles()
+	WG.Done()
+	return ok
+}
+
+// AddExemplars adds ers to the storage.
+func AddExemplars(ers []storage.ExemplarRow) error {
+	WG.Add(1)
+	err := Storage.AddExemplars(ers)
+	WG.Done()
+	return err
+}
+
+// SearchExemplars appends exemplars for the time series with the given mn on the given tr to dst and returns the result.
+func SearchExemplars(dst []storage.Exemplar, mn *storage.MetricName, tr storage.TimeRange) []storage.Exemplar {
+	WG.Add(1)
+	dst = Storage.SearchExemplars(dst, mn, tr)
+	WG.Done()
+	return dst
+}
+
+// AddMetricMetadata adds mms to the storage.
+func AddMetricMetadata(mms []storage.MetricMetadata) error {
+	WG.Add(1)
+	err := Storage.AddMetricMetadata(mms)
+	WG.Done()
+	return err
+}
+
+// SearchMetricMetadata returns metadata for the given metric.
+//
+// Metadata for all the metrics is returned if metric is empty.
+// Up to limit metric families are returned if limit > 0.
+func SearchMetricMetadata(metric string, limit int, deadline uint64) ([]storage.MetricMetadata, error) {
+	WG.Add(1)
+	mms, err := Storage.SearchMetricMetadata(metric, limit, deadline)
+	WG.Done()
+	return mms, err
+}
+
 var errReadOnly = errors.New("the storage is in read-only mode; check -storage.minFreeDiskSpaceBytes command-line flag value")
 
 // RegisterMetricNames registers all the metrics from mrs in the storage.
@@ -160,6 +331,16 @@ func DeleteMetrics(tfss []*storage.TagFilters) (int, error) {
 	return n, err
 }
 
+// DeleteSeriesOnTimeRange deletes samples on the given tr for series matching tfss.
+//
+// Returns the number of series with deleted samples.
+func DeleteSeriesOnTimeRange(tfss []*storage.TagFilters, tr storage.TimeRange) (int, error) {
+	WG.Add(1)
+	n, err := Storage.DeleteSeriesOnTimeRange(tfss, tr)
+	WG.Done()
+	return n, err
+}
+
 // SearchMetricNames returns metric names for the given tfss on the given tr.
 func SearchMetricNames(tfss []*storage.TagFilters, tr storage.TimeRange, maxMetrics int, deadline uint64) ([]storage.MetricName, error) {
 	WG.Add(1)
@@ -168,6 +349,14 @@ func SearchMetricNames(tfss []*storage.TagFilters, tr storage.TimeRange, maxMetr
 	return mns, err
 }
 
+// EstimateSearch estimates the cost of the search for the given tfss on the given tr.
+func EstimateSearch(qt *querytracer.Tracer, tfss []*storage.TagFilters, tr storage.TimeRange, maxMetrics int, deadline uint64) (*storage.SearchEstimate, error) {
+	WG.Add(1)
+	se, err := Storage.EstimateSearch(qt, tfss, tr, maxMetrics, deadline)
+	WG.Done()
+	return se, err
+}
+
 // SearchTagKeysOnTimeRange searches for tag keys on tr.
 func SearchTagKeysOnTimeRange(tr storage.TimeRange, maxTagKeys int, deadline uint64) ([]string, error) {
 	WG.Add(1)
@@ -242,6 +431,78 @@ func GetTSDBStatusWithFiltersForDate(tfss []*storage.TagFilters, date uint64, to
 	return status, err
 }
 
+// GetCardinalityStatus returns cardinality explorer data for the given filters on the given time range.
+func GetCardinalityStatus(tfss []*storage.TagFilters, tr storage.TimeRange, focusLabel string, topN, maxItems int, deadline uint64) (*storage.CardinalityStatus, error) {
+	WG.Add(1)
+	status, err := Storage.GetCardinalityStatus(tfss, tr, focusLabel, topN, maxItems, deadline)
+	WG.Done()
+	return status, err
+}
+
+// GetDailyChurn returns daily series churn stats on the given time range.
+func GetDailyChurn(tr storage.TimeRange, topN int, deadline uint64) ([]storage.ChurnStatus, error) {
+	WG.Add(1)
+	css, err := Storage.GetDailyChurn(tr, topN, deadline)
+	WG.Done()
+	return css, err
+}
+
+// GetHourlyChurn returns hourly series churn stats for the last finished hour and for the current hour.
+func GetHourlyChurn(topN int, deadline uint64) ([]storage.ChurnStatus, error) {
+	WG.Add(1)
+	css, err := Storage.GetHourlyChurn(topN, deadline)
+	WG.Done()
+	return css, err
+}
+
+// UpdateMetricNamesStats registers a query, which selected series with the given marshaled metricNames.
+func UpdateMetricNamesStats(metricNames []string) {
+	WG.Add(1)
+	Storage.UpdateMetricNamesStats(metricNames)
+	WG.Done()
+}
+
+// GetMetricNamesStats returns query stats per metric name.
+func GetMetricNamesStats(limit, le int, matchPattern string) ([]storage.MetricNameStats, uint64) {
+	WG.Add(1)
+	mnss, startTimestamp := Storage.GetMetricNamesStats(limit, le, matchPattern)
+	WG.Done()
+	return mnss, startTimestamp
+}
+
+// ResetMetricNamesStats resets query stats per metric name.
+func ResetMetricNamesStats() {
+	WG.Add(1)
+	Storage.ResetMetricNamesStats()
+	WG.Done()
+}
+
+// GetPartitionsStats returns stats for partitions sorted by partition name.
+func GetPartitionsStats() []storage.PartitionStats {
+	WG.Add(1)
+	pss := Storage.GetPartitionsStats()
+	WG.Done()
+	return pss
+}
+
+// DropPartition drops the partition with the given name.
+func DropPartition(name string) error {
+	WG.Add(1)
+	err := Storage.DropPartition(name)
+	WG.Done()
+	return err
+}
+
+// ForceMergePartition force-merges the partition with the given name.
+func ForceMergePartition(name string) error {
+	WG.Add(1)
+	activeForceMerges.Inc()
+	err := Storage.ForceMergePartition(name)
+	activeForceMerges.Dec()
+	WG.Done()
+	return err
+}
+
 // GetSeriesCount returns the number of time series in the storage.
 func GetSeriesCount(deadline uint64) (uint64, error) {
 	WG.Add(1)
@@ -254,6 +515,7 @@ func GetSeriesCount(deadline uint64) (uint64, error) {
 func Stop() {
 	logger.Infof("gracefully closing the storage at %s", *DataPath)
 	startTime := time.Now()
+	replication.Stop()
 	WG.WaitAndBlock()
 	Storage.MustClose()
 	logger.Infof("successfully closed the storage in %.3f seconds", time.Since(startTime).Seconds())
@@ -284,6 +546,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		}()
 		return true
 	}
+	if replication.RequestHandler(w, r) {
+		return true
+	}
 	if path == "/internal/force_flush" {
 		authKey := r.FormValue("authKey")
 		if authKey != *forceFlushAuthKey {
@@ -514,6 +779,18 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_pending_rows{type="indexdb"}`, func() float64 {
 		return float64(idbm().PendingItems)
 	})
+	metrics.NewGauge(`vm_pending_tombstones`, func() float64 {
+		return float64(tm().PendingTombstones)
+	})
+	metrics.NewGauge(`vm_tombstones_applied_total`, func() float64 {
+		return float64(tm().TombstonesApplied)
+	})
+	metrics.NewGauge(`vm_cold_partitions`, func() float64 {
+		return float64(tm().ColdPartitions)
+	})
+	metrics.NewGauge(`vm_partitions_moved_to_cold_total`, func() float64 {
+		return float64(tm().PartitionsMovedToCold)
+	})
 
 	metrics.NewGauge(`vm_parts{type="storage/big"}`, func() float64 {
 		return float64(tm().BigPartsCount)
@@ -609,6 +886,40 @@ func registerStorageMetrics() {
 		return float64(m().DailySeriesLimitRowsDropped)
 	})
 
+	metrics.NewGauge(`vm_exemplars_added_total`, func() float64 {
+		return float64(m().ExemplarsAdded)
+	})
+	metrics.NewGauge(`vm_exemplar_series`, func() float64 {
+		return float64(m().ExemplarSeriesCount)
+	})
+	metrics.NewGauge(`vm_metric_names_stats_tracked`, func() float64 {
+		return float64(m().MetricNamesStatsCount)
+	})
+	metrics.NewGauge(`vm_metric_metadata_entries_added_total`, func() float64 {
+		return float64(m().MetricMetadataEntriesAdded)
+	})
+
+	metrics.NewGauge(`vm_wal_bytes_written_total`, func() float64 {
+		return float64(m().WALBytesWritten)
+	})
+	metrics.NewGauge(`vm_wal_syncs_total`, func() float64 {
+		return float64(m().WALSyncs)
+	})
+	metrics.NewGauge(`vm_wal_rows_replayed_total`, func() float64 {
+		return float64(m().WALRowsReplayed)
+	})
+
+	metrics.NewGauge(`vm_replica_refreshes_total`, func() float64 {
+		return float64(m().ReplicaRefreshes)
+	})
+	metrics.NewGauge(`vm_replica_refresh_errors_total`, func() float64 {
+		return float64(m().ReplicaRefreshErrors)
+	})
+
+	metrics.NewGauge(`vm_hot_blocks_prewarmed_total`, func() float64 {
+		return float64(m().HotBlocksPrewarmed)
+	})
+
 	metrics.NewGauge(`vm_timestamps_blocks_merged_total`, func() float64 {
 		return float64(m().TimestampsBlocksMerged)
 	})
@@ -702,6 +1013,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_cache_size_bytes{type="indexdb/indexBlocks"}`, func() float64 {
 		return float64(idbm().IndexBlocksCacheSizeBytes)
 	})
+	metrics.NewGauge(`vm_cache_size_bytes{type="indexdb/bloomFilters"}`, func() float64 {
+		return float64(idbm().BloomFiltersSizeBytes)
+	})
 	metrics.NewGauge(`vm_cache_size_bytes{type="storage/date_metricID"}`, func() float64 {
 		return float64(m().DateMetricIDCacheSizeBytes)
 	})
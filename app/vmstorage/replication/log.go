@@ -0,0 +1,541 @@
+package replication
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	xxhash "github.com/cespare/xxhash/v2"
+)
+
+// logRecordHeaderSize is the size of replication log record header.
+//
+// The header contains the record size and xxhash of the record.
+const logRecordHeaderSize = 4 + 8
+
+// maxLogRecordSize is the maximum size of a single replication log record.
+//
+// It protects from excess memory usage when reading corrupted records.
+const maxLogRecordSize = 256 * 1024 * 1024
+
+// maxLogRecordRowsSize is the maximum size of marshaled rows in a single replication log record.
+//
+// Rows are split into multiple records, so every record fits a single block sent to the standby.
+const maxLogRecordRowsSize = maxBlockSize - logRecordHeaderSize - 1 - 10
+
+// maxLogSegmentSize is the size of a log segment after which the log switches to the next segment.
+var maxLogSegmentSize = uint64(64 * 1024 * 1024)
+
+// logIDFilename is the name of the file with the unique id of the replication log.
+const logIDFilename = "log_id"
+
+// errPositionNotFound is returned when the requested position is missing in the replication log.
+var errPositionNotFound = errors.New("the position is missing in the replication log")
+
+// logSegment is a single segment file of replication log.
+type logSegment struct {
+	// start is the position of the first byte in the segment.
+	start uint64
+
+	// size is the segment size in bytes.
+	size uint64
+}
+
+func (seg *logSegment) end() uint64 {
+	return seg.start + seg.size
+}
+
+// replicationLog is append-only log of rows added to the primary.
+//
+// Every byte in the log has a position, which increases monotonically. Segment files are named
+// by the position of their first byte. Each segment consists of records with the following format:
+//
+//	<recordSize uint32><xxhash(record) uint64><precisionBits uint8><rowsCount varuint><MetricRow>*rowsCount
+//
+// Records never span multiple segments, so segment start is always a record boundary.
+type replicationLog struct {
+	// Atomic counters must go at the top of the structure in order to properly align by 8 bytes on 32-bit archs.
+	droppedBytes uint64
+
+	path string
+
+	// id is unique id of the log. It is generated when the log is created.
+	//
+	// It allows detecting positions from another log on the standby, e.g. after the log has been deleted.
+	id uint64
+
+	// maxSize is the maximum size of the log. The oldest segments are dropped when the log exceeds this size.
+	maxSize uint64
+
+	// notifyCh is notified when new records are appended to the log.
+	notifyCh chan struct{}
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// f is the last segment opened for writing.
+	f *os.File
+
+	// segments contains log segments sorted by start position. The last segment is f.
+	segments []logSegment
+
+	buf []byte
+}
+
+// mustOpenReplicationLog opens replication log at the given path.
+func mustOpenReplicationLog(path string, maxSize uint64) *replicationLog {
+	if err := fs.MkdirAllIfNotExist(path); err != nil {
+		logger.Panicf("FATAL: cannot create directory for replication log: %s", err)
+	}
+	id, err := readOrCreateLogID(path + "/" + logIDFilename)
+	if err != nil {
+		logger.Panicf("FATAL: %s", err)
+	}
+	segments, err := readLogSegments(path)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read replication log segments: %s", err)
+	}
+	rl := &replicationLog{
+		path:     path,
+		id:       id,
+		maxSize:  maxSize,
+		notifyCh: make(chan struct{}, 1),
+		segments: segments,
+	}
+	if len(segments) == 0 {
+		if err := rl.openSegment(0); err != nil {
+			logger.Panicf("FATAL: %s", err)
+		}
+		return rl
+	}
+	seg := &segments[len(segments)-1]
+	segPath := rl.segmentPath(seg.start)
+	size, err := getValidRecordsSize(segPath)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read the last replication log segment: %s", err)
+	}
+	if size < seg.size {
+		logger.Warnf("truncating incomplete records at the end of replication log segment %q from %d to %d bytes; this is expected after unclean shutdown",
+			segPath, seg.size, size)
+		if err := os.Truncate(segPath, int64(size)); err != nil {
+			logger.Panicf("FATAL: cannot truncate replication log segment: %s", err)
+		}
+		seg.size = size
+	}
+	f, err := os.OpenFile(segPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logger.Panicf("FATAL: cannot open replication log segment for writing: %s", err)
+	}
+	rl.f = f
+	return rl
+}
+
+// mustClose closes rl.
+func (rl *replicationLog) mustClose() {
+	rl.mu.Lock()
+	fs.MustClose(rl.f)
+	rl.f = nil
+	rl.mu.Unlock()
+}
+
+// addRows appends mrs to rl.
+func (rl *replicationLog) addRows(mrs []*storage.MetricRow, precisionBits uint8) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for len(mrs) > 0 {
+		n := getLogRecordRowsCount(mrs, maxLogRecordRowsSize)
+		if err := rl.addRecordLocked(mrs[:n], precisionBits); err != nil {
+			return err
+		}
+		mrs = mrs[n:]
+	}
+	return nil
+}
+
+// addRecordLocked appends a single record with mrs to rl.
+//
+// rl.mu must be locked by the caller.
+func (rl *replicationLog) addRecordLocked(mrs []*storage.MetricRow, precisionBits uint8) error {
+	buf := rl.buf[:0]
+	buf = append(buf, make([]byte, logRecordHeaderSize)...)
+	buf = marshalLogRecord(buf, mrs, precisionBits)
+	record := buf[logRecordHeaderSize:]
+
+	// Fill in the record header in place.
+	encoding.MarshalUint32(buf[:0], uint32(len(record)))
+	encoding.MarshalUint64(buf[:4], xxhash.Sum64(record))
+	rl.buf = buf
+
+	seg := &rl.segments[len(rl.segments)-1]
+	if seg.size >= maxLogSegmentSize {
+		if err := rl.openSegment(seg.end()); err != nil {
+			return err
+		}
+		rl.dropOldSegmentsIfNeeded()
+		seg = &rl.segments[len(rl.segments)-1]
+	}
+	if _, err := rl.f.Write(buf); err != nil {
+		// Drop the partially written record, since the log must contain only complete records.
+		if errTruncate := rl.f.Truncate(int64(seg.size)); errTruncate != nil {
+			logger.Panicf("FATAL: cannot truncate replication log segment %q after unsuccessful write: %s", rl.f.Name(), errTruncate)
+		}
+		return fmt.Errorf("cannot write %d bytes to replication log segment %q: %w", len(buf), rl.f.Name(), err)
+	}
+	seg.size += uint64(len(buf))
+
+	select {
+	case rl.notifyCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// openSegment closes the current segment if it is open and opens new segment starting at the given position.
+//
+// rl.mu must be locked by the caller.
+func (rl *replicationLog) openSegment(start uint64) error {
+	if rl.f != nil {
+		fs.MustClose(rl.f)
+		rl.f = nil
+	}
+	path := rl.segmentPath(start)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot create replication log segment: %w", err)
+	}
+	fs.MustSyncPath(rl.path)
+	rl.f = f
+	rl.segments = append(rl.segments, logSegment{
+		start: start,
+	})
+	return nil
+}
+
+// dropOldSegmentsIfNeeded drops the oldest closed segments if the log size exceeds rl.maxSize.
+//
+// rl.mu must be locked by the caller.
+func (rl *replicationLog) dropOldSegmentsIfNeeded() {
+	size := uint64(0)
+	for _, seg := range rl.segments {
+		size += seg.size
+	}
+	n := 0
+	for n < len(rl.segments)-1 && size > rl.maxSize {
+		seg := rl.segments[n]
+		size -= seg.size
+		atomic.AddUint64(&rl.droppedBytes, seg.size)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	logger.Errorf("dropping %d the oldest replication log segments at %q, since the log size exceeds -replication.maxLogSize=%d bytes; "+
+		"the standby will miss the data from these segments", n, rl.path, rl.maxSize)
+	rl.removeSegmentsLocked(n)
+}
+
+// truncate removes segments, which end at or before the given position.
+//
+// The last segment is never removed, since it is used for writing.
+func (rl *replicationLog) truncate(pos uint64) {
+	rl.mu.Lock()
+	n := 0
+	for n < len(rl.segments)-1 && rl.segments[n].end() <= pos {
+		n++
+	}
+	if n > 0 {
+		rl.removeSegmentsLocked(n)
+	}
+	rl.mu.Unlock()
+}
+
+func (rl *replicationLog) removeSegmentsLocked(n int) {
+	for _, seg := range rl.segments[:n] {
+		fs.MustRemoveAll(rl.segmentPath(seg.start))
+	}
+	fs.MustSyncPath(rl.path)
+	rl.segments = append(rl.segments[:0], rl.segments[n:]...)
+}
+
+// bounds returns the positions of the first and the last bytes plus one in rl.
+func (rl *replicationLog) bounds() (uint64, uint64) {
+	rl.mu.Lock()
+	start := rl.segments[0].start
+	end := rl.segments[len(rl.segments)-1].end()
+	rl.mu.Unlock()
+	return start, end
+}
+
+// size returns the size of rl in bytes.
+func (rl *replicationLog) size() uint64 {
+	start, end := rl.bounds()
+	return end - start
+}
+
+// readRecords appends records starting at the given pos to dst while the size of the appended records doesn't exceed maxSize.
+//
+// At least a single record is appended to dst if pos is smaller than the log end.
+// It returns dst and the position after the last appended record.
+// errPositionNotFound is returned if pos is outside the log.
+func (rl *replicationLog) readRecords(dst []byte, pos uint64, maxSize int) ([]byte, uint64, error) {
+	rl.mu.Lock()
+	var seg logSegment
+	found := false
+	for i, s := range rl.segments {
+		if pos >= s.start && (pos < s.end() || i == len(rl.segments)-1 && pos == s.end()) {
+			seg = s
+			found = true
+			break
+		}
+	}
+	rl.mu.Unlock()
+	if !found {
+		return dst, pos, errPositionNotFound
+	}
+	if pos == seg.end() {
+		// There are no new records.
+		return dst, pos, nil
+	}
+
+	path := rl.segmentPath(seg.start)
+	f, err := os.Open(path)
+	if err != nil {
+		return dst, pos, fmt.Errorf("cannot open replication log segment: %w", err)
+	}
+	defer fs.MustClose(f)
+	sr := io.NewSectionReader(f, int64(pos-seg.start), int64(seg.end()-pos))
+	br := bufio.NewReaderSize(sr, 64*1024)
+	dstLen := len(dst)
+	for len(dst)-dstLen < maxSize && pos < seg.end() {
+		dst = bytesutil.ResizeWithCopyMayOverallocate(dst, len(dst)+logRecordHeaderSize)
+		header := dst[len(dst)-logRecordHeaderSize:]
+		if _, err := io.ReadFull(br, header); err != nil {
+			return dst, pos, fmt.Errorf("cannot read record header at position %d from replication log segment %q: %w", pos, path, err)
+		}
+		recordSize := encoding.UnmarshalUint32(header)
+		if recordSize > maxLogRecordSize {
+			return dst, pos, fmt.Errorf("too big record size at position %d in replication log segment %q: %d bytes; max allowed size: %d bytes",
+				pos, path, recordSize, maxLogRecordSize)
+		}
+		if n := len(dst) - dstLen; n > logRecordHeaderSize && n+int(recordSize) > maxSize {
+			// The record doesn't fit maxSize. It will be read on the next call.
+			return dst[:len(dst)-logRecordHeaderSize], pos, nil
+		}
+		dst = bytesutil.ResizeWithCopyMayOverallocate(dst, len(dst)+int(recordSize))
+		if _, err := io.ReadFull(br, dst[len(dst)-int(recordSize):]); err != nil {
+			return dst, pos, fmt.Errorf("cannot read record at position %d from replication log segment %q: %w", pos, path, err)
+		}
+		pos += logRecordHeaderSize + uint64(recordSize)
+	}
+	return dst, pos, nil
+}
+
+func (rl *replicationLog) segmentPath(start uint64) string {
+	return fmt.Sprintf("%s/%016X", rl.path, start)
+}
+
+// unmarshalLogRecords calls f for each record in src.
+//
+// It stops on the first error returned by f. It returns the number of bytes
+// from src occupied by the records successfully processed by f.
+func unmarshalLogRecords(src []byte, f func(mrs []storage.MetricRow, precisionBits uint8) error) (int, error) {
+	var mrs []storage.MetricRow
+	n := 0
+	for len(src) > 0 {
+		if len(src) < logRecordHeaderSize {
+			return n, fmt.Errorf("too short record header; got %d bytes; want %d bytes", len(src), logRecordHeaderSize)
+		}
+		recordSize := encoding.UnmarshalUint32(src)
+		checksum := encoding.UnmarshalUint64(src[4:])
+		src = src[logRecordHeaderSize:]
+		if uint64(len(src)) < uint64(recordSize) {
+			return n, fmt.Errorf("too short record; got %d bytes; want %d bytes", len(src), recordSize)
+		}
+		record := src[:recordSize]
+		src = src[recordSize:]
+		if xxhash.Sum64(record) != checksum {
+			return n, fmt.Errorf("invalid checksum for the record with size %d bytes", recordSize)
+		}
+		var precisionBits uint8
+		var err error
+		mrs, precisionBits, err = unmarshalLogRecord(mrs[:0], record)
+		if err != nil {
+			return n, err
+		}
+		if err := f(mrs, precisionBits); err != nil {
+			return n, err
+		}
+		n += logRecordHeaderSize + int(recordSize)
+	}
+	return n, nil
+}
+
+// getLogRecordRowsCount returns the number of rows from the beginning of mrs, which fit maxSize bytes after marshaling.
+//
+// At least a single row is returned, even if it exceeds maxSize.
+func getLogRecordRowsCount(mrs []*storage.MetricRow, maxSize int) int {
+	size := 0
+	for i, mr := range mrs {
+		// The marshaled row contains length-prefixed MetricNameRaw, timestamp and value.
+		size += 10 + len(mr.MetricNameRaw) + 8 + 8
+		if size > maxSize && i > 0 {
+			return i
+		}
+	}
+	return len(mrs)
+}
+
+func marshalLogRecord(dst []byte, mrs []*storage.MetricRow, precisionBits uint8) []byte {
+	dst = append(dst, precisionBits)
+	dst = encoding.MarshalVarUint64(dst, uint64(len(mrs)))
+	for _, mr := range mrs {
+		dst = mr.Marshal(dst)
+	}
+	return dst
+}
+
+func unmarshalLogRecord(dst []storage.MetricRow, src []byte) ([]storage.MetricRow, uint8, error) {
+	if len(src) < 1 {
+		return dst, 0, fmt.Errorf("cannot unmarshal precisionBits from empty record")
+	}
+	precisionBits := src[0]
+	if err := encoding.CheckPrecisionBits(precisionBits); err != nil {
+		return dst, 0, err
+	}
+	tail, rowsCount, err := encoding.UnmarshalVarUint64(src[1:])
+	if err != nil {
+		return dst, 0, fmt.Errorf("cannot unmarshal rows count: %w", err)
+	}
+	for i := uint64(0); i < rowsCount; i++ {
+		if len(dst) < cap(dst) {
+			dst = dst[:len(dst)+1]
+		} else {
+			dst = append(dst, storage.MetricRow{})
+		}
+		mr := &dst[len(dst)-1]
+		tail, err = mr.UnmarshalX(tail)
+		if err != nil {
+			return dst, 0, fmt.Errorf("cannot unmarshal row #%d out of %d rows: %w", i, rowsCount, err)
+		}
+	}
+	if len(tail) > 0 {
+		return dst, 0, fmt.Errorf("unexpected tail left after unmarshaling %d rows: %d bytes", rowsCount, len(tail))
+	}
+	return dst, precisionBits, nil
+}
+
+// getValidRecordsSize returns the size of valid records at the start of the segment at the given path.
+func getValidRecordsSize(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fs.MustClose(f)
+
+	br := bufio.NewReaderSize(f, 64*1024)
+	size := uint64(0)
+	var header [logRecordHeaderSize]byte
+	var record []byte
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return size, nil
+		}
+		recordSize := encoding.UnmarshalUint32(header[:4])
+		checksum := encoding.UnmarshalUint64(header[4:])
+		if recordSize > maxLogRecordSize {
+			return size, nil
+		}
+		record = bytesutil.ResizeNoCopyMayOverallocate(record, int(recordSize))
+		if _, err := io.ReadFull(br, record); err != nil {
+			return size, nil
+		}
+		if xxhash.Sum64(record) != checksum {
+			return size, nil
+		}
+		size += logRecordHeaderSize + uint64(recordSize)
+	}
+}
+
+// readLogSegments returns segments of replication log at the given path sorted by start position.
+func readLogSegments(path string) ([]logSegment, error) {
+	d, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.MustClose(d)
+
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory %q: %w", path, err)
+	}
+	var segments []logSegment
+	for _, fi := range fis {
+		fn := fi.Name()
+		if !fi.Mode().IsRegular() || len(fn) != 16 || fs.IsTemporaryFileName(fn) {
+			continue
+		}
+		start, err := strconv.ParseUint(fn, 16, 64)
+		if err != nil {
+			logger.Warnf("skipping unexpected file %q in replication log directory", filepath.Join(path, fn))
+			continue
+		}
+		segments = append(segments, logSegment{
+			start: start,
+			size:  uint64(fi.Size()),
+		})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].start < segments[j].start
+	})
+	for i := 1; i < len(segments); i++ {
+		prev := &segments[i-1]
+		if prev.end() != segments[i].start {
+			return nil, fmt.Errorf("missing data in replication log at %q between positions %d and %d", path, prev.end(), segments[i].start)
+		}
+	}
+	return segments, nil
+}
+
+// readOrCreateLogID reads log id from the file at the given path. It creates the file with random id if it is missing.
+func readOrCreateLogID(path string) (uint64, error) {
+	if fs.IsPathExist(path) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return 0, fmt.Errorf("cannot read replication log id: %w", err)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse replication log id from %q: %w", path, err)
+		}
+		return id, nil
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, fmt.Errorf("cannot generate replication log id: %w", err)
+	}
+	id := encoding.UnmarshalUint64(b[:])
+	if err := fs.WriteFileAtomically(path, []byte(formatLogID(id))); err != nil {
+		return 0, fmt.Errorf("cannot write replication log id: %w", err)
+	}
+	return id, nil
+}
+
+func formatLogID(id uint64) string {
+	return fmt.Sprintf("%016X", id)
+}
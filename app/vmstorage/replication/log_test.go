@@ -0,0 +1,180 @@
+package replication
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func newTestRows(prefix string, n int) []storage.MetricRow {
+	var mrs []storage.MetricRow
+	for i := 0; i < n; i++ {
+		mrs = append(mrs, storage.MetricRow{
+			MetricNameRaw: []byte(fmt.Sprintf("%s_%d", prefix, i)),
+			Timestamp:     int64(i) * 1000,
+			Value:         float64(i),
+		})
+	}
+	return mrs
+}
+
+func getMetricRowPtrs(mrs []storage.MetricRow) []*storage.MetricRow {
+	mrPtrs := make([]*storage.MetricRow, len(mrs))
+	for i := range mrs {
+		mrPtrs[i] = &mrs[i]
+	}
+	return mrPtrs
+}
+
+// readAllRows returns all the rows from rl starting at the given pos.
+func readAllRows(t *testing.T, rl *replicationLog, pos uint64) ([]storage.MetricRow, uint64) {
+	t.Helper()
+	var result []storage.MetricRow
+	for {
+		block, nextPos, err := rl.readRecords(nil, pos, 100)
+		if err != nil {
+			t.Fatalf("cannot read records at the position %d: %s", pos, err)
+		}
+		if len(block) == 0 {
+			return result, pos
+		}
+		n, err := unmarshalLogRecords(block, func(mrs []storage.MetricRow, precisionBits uint8) error {
+			if precisionBits != 64 {
+				return fmt.Errorf("unexpected precisionBits; got %d; want 64", precisionBits)
+			}
+			result = append(result, mrs...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("cannot unmarshal records: %s", err)
+		}
+		if uint64(n) != nextPos-pos {
+			t.Fatalf("unexpected size of records; got %d bytes; want %d bytes", n, nextPos-pos)
+		}
+		pos = nextPos
+	}
+}
+
+func TestReplicationLog(t *testing.T) {
+	maxLogSegmentSizeOrig := maxLogSegmentSize
+	maxLogSegmentSize = 1000
+	defer func() {
+		maxLogSegmentSize = maxLogSegmentSizeOrig
+	}()
+
+	path := "TestReplicationLog"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	rl := mustOpenReplicationLog(path, 1e9)
+	var mrsExpected []storage.MetricRow
+	for i := 0; i < 100; i++ {
+		mrs := newTestRows(fmt.Sprintf("metric_%d", i), 3)
+		if err := rl.addRows(getMetricRowPtrs(mrs), 64); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+		mrsExpected = append(mrsExpected, mrs...)
+	}
+	if len(rl.segments) < 2 {
+		t.Fatalf("expecting multiple segments; got %d segments", len(rl.segments))
+	}
+	mrs, end := readAllRows(t, rl, 0)
+	if !reflect.DeepEqual(mrs, mrsExpected) {
+		t.Fatalf("unexpected rows read from the log;\ngot\n%v\nwant\n%v", mrs, mrsExpected)
+	}
+	if _, logEnd := rl.bounds(); end != logEnd {
+		t.Fatalf("unexpected end position; got %d; want %d", end, logEnd)
+	}
+	id := rl.id
+	rl.mustClose()
+
+	// Incomplete record at the end of the log must be truncated on open.
+	lastSegmentPath := rl.segmentPath(rl.segments[len(rl.segments)-1].start)
+	f, err := os.OpenFile(lastSegmentPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("cannot open the last segment: %s", err)
+	}
+	if _, err := f.Write([]byte("foobar")); err != nil {
+		t.Fatalf("cannot write to the last segment: %s", err)
+	}
+	_ = f.Close()
+
+	// The log must be continued after re-opening.
+	rl = mustOpenReplicationLog(path, 1e9)
+	if rl.id != id {
+		t.Fatalf("unexpected log id after re-opening; got %016X; want %016X", rl.id, id)
+	}
+	if _, logEnd := rl.bounds(); logEnd != end {
+		t.Fatalf("unexpected end position after re-opening; got %d; want %d", logEnd, end)
+	}
+	mrsNew := newTestRows("new_metric", 5)
+	if err := rl.addRows(getMetricRowPtrs(mrsNew), 64); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	mrs, _ = readAllRows(t, rl, end)
+	if !reflect.DeepEqual(mrs, mrsNew) {
+		t.Fatalf("unexpected rows read from the log after re-opening;\ngot\n%v\nwant\n%v", mrs, mrsNew)
+	}
+
+	// Truncated positions must be missing in the log.
+	segmentsCount := len(rl.segments)
+	truncatePos := rl.segments[1].end()
+	rl.truncate(truncatePos)
+	if len(rl.segments) != segmentsCount-2 {
+		t.Fatalf("unexpected number of segments after truncation; got %d; want %d", len(rl.segments), segmentsCount-2)
+	}
+	if _, _, err := rl.readRecords(nil, 0, 100); err != errPositionNotFound {
+		t.Fatalf("unexpected error when reading truncated position; got %v; want %v", err, errPositionNotFound)
+	}
+	if start, _ := rl.bounds(); start != truncatePos {
+		t.Fatalf("unexpected start position after truncation; got %d; want %d", start, truncatePos)
+	}
+	rl.mustClose()
+}
+
+func TestReplicationLogMaxSize(t *testing.T) {
+	maxLogSegmentSizeOrig := maxLogSegmentSize
+	maxLogSegmentSize = 1000
+	defer func() {
+		maxLogSegmentSize = maxLogSegmentSizeOrig
+	}()
+
+	path := "TestReplicationLogMaxSize"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	rl := mustOpenReplicationLog(path, 3000)
+	for i := 0; i < 100; i++ {
+		if err := rl.addRows(getMetricRowPtrs(newTestRows(fmt.Sprintf("metric_%d", i), 3)), 64); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+	}
+	// The size of the last segment isn't limited until the switch to the next segment.
+	if n := rl.size(); n > 3000+maxLogSegmentSize+1000 {
+		t.Fatalf("too big log size: %d bytes", n)
+	}
+	if rl.droppedBytes == 0 {
+		t.Fatalf("expecting non-zero dropped bytes")
+	}
+	rl.mustClose()
+}
+
+func TestGetLogRecordRowsCount(t *testing.T) {
+	mrs := getMetricRowPtrs(newTestRows("metric", 10))
+	f := func(maxSize, nExpected int) {
+		t.Helper()
+		if n := getLogRecordRowsCount(mrs, maxSize); n != nExpected {
+			t.Fatalf("unexpected number of rows for maxSize=%d; got %d; want %d", maxSize, n, nExpected)
+		}
+	}
+	// Every row occupies 10+len("metric_N")+8+8=34 bytes.
+	f(0, 1)
+	f(34, 1)
+	f(68, 2)
+	f(100, 2)
+	f(340, 10)
+	f(1e6, 10)
+}
@@ -0,0 +1,230 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+)
+
+// maxBlockSize is the maximum size of log records sent to the standby in a single request.
+const maxBlockSize = 8 * 1024 * 1024
+
+// primary streams replication log to the standby.
+type primary struct {
+	// Atomic counters must go at the top of the structure in order to properly align by 8 bytes on 32-bit archs.
+	ackedPos uint64
+
+	rl         *replicationLog
+	standbyURL string
+	authKey    string
+	hc         *http.Client
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newPrimary(rl *replicationLog, standbyURL, authKey string, sendTimeout time.Duration) *primary {
+	p := &primary{
+		rl:         rl,
+		standbyURL: strings.TrimSuffix(standbyURL, "/"),
+		authKey:    authKey,
+		hc: &http.Client{
+			Timeout: sendTimeout,
+		},
+		stopCh: make(chan struct{}),
+	}
+	start, _ := rl.bounds()
+	p.ackedPos = start
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.run()
+	}()
+	return p
+}
+
+func (p *primary) mustStop() {
+	close(p.stopCh)
+	p.wg.Wait()
+}
+
+// lag returns the number of bytes in the replication log, which aren't acknowledged by the standby yet.
+func (p *primary) lag() uint64 {
+	_, end := p.rl.bounds()
+	ackedPos := atomic.LoadUint64(&p.ackedPos)
+	if ackedPos > end {
+		return 0
+	}
+	return end - ackedPos
+}
+
+func (p *primary) run() {
+	retryDuration := time.Second
+	for {
+		err := p.stream()
+		if err == nil {
+			// The primary is stopped.
+			return
+		}
+		sendErrors.Inc()
+		logger.Errorf("cannot replicate data to -replication.standbyURL=%q: %s; retrying in %.3f seconds", p.standbyURL, err, retryDuration.Seconds())
+		t := timerpool.Get(retryDuration)
+		select {
+		case <-p.stopCh:
+			timerpool.Put(t)
+			return
+		case <-t.C:
+			timerpool.Put(t)
+		}
+		retryDuration *= 2
+		if retryDuration > time.Minute {
+			retryDuration = time.Minute
+		}
+	}
+}
+
+// stream sends replication log to the standby starting from the position acknowledged by the standby.
+//
+// It returns nil only if the primary is stopped.
+func (p *primary) stream() error {
+	st, err := p.getStandbyStatus()
+	if err != nil {
+		return err
+	}
+	if err := checkStandbyTimestampPrecision(st); err != nil {
+		return err
+	}
+	pos := st.Position
+	reset := false
+	start, end := p.rl.bounds()
+	if st.LogID != formatLogID(p.rl.id) || pos < start || pos > end {
+		if st.LogID == formatLogID(p.rl.id) {
+			logger.Errorf("the position %d acknowledged by -replication.standbyURL=%q is missing in the replication log with positions [%d..%d]; "+
+				"replicating from the oldest available position; the standby will miss data between these positions", pos, p.standbyURL, start, end)
+		} else {
+			logger.Infof("starting replication to -replication.standbyURL=%q from the position %d", p.standbyURL, start)
+		}
+		pos = start
+		reset = true
+	}
+	atomic.StoreUint64(&p.ackedPos, pos)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var block []byte
+	var compressed []byte
+	for {
+		var nextPos uint64
+		block, nextPos, err = p.rl.readRecords(block[:0], pos, maxBlockSize)
+		if err != nil {
+			return err
+		}
+		if len(block) == 0 {
+			select {
+			case <-p.stopCh:
+				return nil
+			case <-p.rl.notifyCh:
+			case <-ticker.C:
+			}
+			continue
+		}
+		compressed = encoding.CompressZSTDLevel(compressed[:0], block, 1)
+		st, err = p.sendBlock(compressed, pos, reset)
+		if err != nil {
+			return err
+		}
+		if st.Position != nextPos {
+			return fmt.Errorf("unexpected position returned by the standby after sending records in the range [%d..%d]: %d", pos, nextPos, st.Position)
+		}
+		reset = false
+		pos = nextPos
+		atomic.StoreUint64(&p.ackedPos, pos)
+		sentBytes.Add(len(block))
+
+		// Segments with the data, which is flushed to files on the standby, are no longer needed.
+		p.rl.truncate(st.FlushedPosition)
+
+		select {
+		case <-p.stopCh:
+			return nil
+		default:
+		}
+	}
+}
+
+// checkStandbyTimestampPrecision verifies that the standby stores timestamps with the same precision as the primary.
+//
+// Replicated rows contain timestamps in the primary precision, so they would be stored with invalid timestamps otherwise.
+func checkStandbyTimestampPrecision(st *standbyStatus) error {
+	precision := st.TimestampPrecision
+	if precision == "" {
+		precision = "ms"
+	}
+	if precision != storage.GetTimestampPrecision() {
+		return fmt.Errorf("the standby uses -storage.timestampPrecision=%s, while the primary uses -storage.timestampPrecision=%s; "+
+			"the standby must use the same precision as the primary", precision, storage.GetTimestampPrecision())
+	}
+	return nil
+}
+
+func (p *primary) getStandbyStatus() (*standbyStatus, error) {
+	args := url.Values{}
+	args.Set("authKey", p.authKey)
+	resp, err := p.hc.Get(p.standbyURL + "/internal/replication/status?" + args.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain standby status: %w", err)
+	}
+	return readStandbyStatus(resp)
+}
+
+func (p *primary) sendBlock(block []byte, pos uint64, reset bool) (*standbyStatus, error) {
+	args := url.Values{}
+	args.Set("authKey", p.authKey)
+	args.Set("logID", formatLogID(p.rl.id))
+	args.Set("pos", fmt.Sprintf("%d", pos))
+	if reset {
+		args.Set("reset", "1")
+	}
+	resp, err := p.hc.Post(p.standbyURL+"/internal/replication/write?"+args.Encode(), "application/octet-stream", bytes.NewReader(block))
+	if err != nil {
+		return nil, fmt.Errorf("cannot send %d bytes to the standby: %w", len(block), err)
+	}
+	return readStandbyStatus(resp)
+}
+
+func readStandbyStatus(resp *http.Response) (*standbyStatus, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response from the standby: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		return nil, fmt.Errorf("unexpected status code returned by the standby: %d; response body: %q", resp.StatusCode, body)
+	}
+	var st standbyStatus
+	if err := json.Unmarshal(body, &st); err != nil {
+		return nil, fmt.Errorf("cannot parse standby status %q: %w", body, err)
+	}
+	if st.IsPromoted {
+		return nil, errStandbyPromoted
+	}
+	if resp.StatusCode == http.StatusConflict {
+		return nil, fmt.Errorf("the standby expects data from logID=%s at the position %d", st.LogID, st.Position)
+	}
+	return &st, nil
+}
+
+var errStandbyPromoted = errors.New("the standby has been promoted, so it no longer accepts replicated data")
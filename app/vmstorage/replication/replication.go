@@ -0,0 +1,140 @@
+package replication
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	standbyURL = flag.String("replication.standbyURL", "", "Optional URL of the standby VictoriaMetrics instance to replicate the ingested samples to, e.g. http://standby:8428 . "+
+		"The standby must run with -replication.standby command-line flag. See https://docs.victoriametrics.com/#replication")
+	isStandby = flag.Bool("replication.standby", false, "Whether to run in standby mode. The standby accepts samples replicated from the primary with -replication.standbyURL "+
+		"and rejects samples from other sources until it is promoted via /internal/replication/promote. See https://docs.victoriametrics.com/#replication")
+	authKey = flag.String("replication.authKey", "", "authKey, which must be passed in query string to /internal/replication/* pages on the standby. "+
+		"The primary sends it to -replication.standbyURL. It must be set on the standby")
+	maxLogSize = flagutil.NewBytes("replication.maxLogSize", 1024*1024*1024, "The maximum size of the replication log at <-storageDataPath>/replication/log on the primary. "+
+		"The oldest data, which isn't replicated to the standby yet, is dropped when the log exceeds this size")
+	sendTimeout = flag.Duration("replication.sendTimeout", time.Minute, "Timeout for sending a single block of data to -replication.standbyURL")
+)
+
+var (
+	prim *primary
+	sb   *standby
+)
+
+// Init initializes replication for the storage at the given dataPath.
+//
+// addRows must add rows replicated from the primary to the storage, while flush must flush the added rows to files.
+func Init(dataPath string, addRows func(mrs []storage.MetricRow, precisionBits uint8) error, flush func() bool) {
+	if *standbyURL != "" && *isStandby {
+		logger.Fatalf("-replication.standbyURL cannot be set together with -replication.standby")
+	}
+	path := dataPath + "/replication"
+	if *standbyURL != "" {
+		rl := mustOpenReplicationLog(path+"/log", uint64(maxLogSize.N))
+		prim = newPrimary(rl, *standbyURL, *authKey, *sendTimeout)
+		logger.Infof("replicating ingested samples to -replication.standbyURL=%q", *standbyURL)
+	}
+	if *isStandby {
+		if *authKey == "" {
+			// Otherwise anybody with access to the standby could write arbitrary data to it or promote it.
+			logger.Fatalf("-replication.authKey must be set when running with -replication.standby")
+		}
+		sb = mustOpenStandby(path, addRows, flush)
+		logger.Infof("running in standby mode; accepting replicated samples at /internal/replication/write")
+	}
+}
+
+// Stop stops replication.
+func Stop() {
+	if prim != nil {
+		prim.mustStop()
+		prim.rl.mustClose()
+		prim = nil
+	}
+	if sb != nil {
+		sb.mustStop()
+		sb = nil
+	}
+}
+
+// IsEnabled returns true if replication is enabled either in primary or in standby mode.
+func IsEnabled() bool {
+	return *standbyURL != "" || *isStandby
+}
+
+// IsStandby returns true if the instance accepts only replicated samples.
+//
+// It returns false after the standby is promoted.
+func IsStandby() bool {
+	return sb != nil && sb.isStandby()
+}
+
+// ErrStandby is returned when samples are added to the standby.
+var ErrStandby = errors.New("cannot add samples to the standby; it accepts only samples replicated from the primary until it is promoted via /internal/replication/promote")
+
+// AddRows adds mrs to the replication log if the replication to the standby is enabled.
+func AddRows(mrs []*storage.MetricRow, precisionBits uint8) error {
+	if prim == nil || len(mrs) == 0 {
+		return nil
+	}
+	return prim.rl.addRows(mrs, precisionBits)
+}
+
+// RequestHandler handles /internal/replication/* requests on the standby.
+func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
+	path := r.URL.Path
+	if !strings.HasPrefix(path, "/internal/replication/") {
+		return false
+	}
+	if sb == nil {
+		httpserver.Errorf(w, r, "the instance isn't running in standby mode; see -replication.standby command-line flag")
+		return true
+	}
+	if k := r.FormValue("authKey"); k != *authKey {
+		httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -replication.authKey command line flag", k)
+		return true
+	}
+	return sb.requestHandler(w, r, path[len("/internal/replication"):])
+}
+
+var (
+	sentBytes    = metrics.NewCounter("vm_replication_sent_bytes_total")
+	sendErrors   = metrics.NewCounter("vm_replication_send_errors_total")
+	receivedRows = metrics.NewCounter("vm_replication_received_rows_total")
+
+	_ = metrics.NewGauge("vm_replication_log_size_bytes", func() float64 {
+		if prim == nil {
+			return 0
+		}
+		return float64(prim.rl.size())
+	})
+	_ = metrics.NewGauge("vm_replication_lag_bytes", func() float64 {
+		if prim == nil {
+			return 0
+		}
+		return float64(prim.lag())
+	})
+	_ = metrics.NewGauge("vm_replication_dropped_bytes_total", func() float64 {
+		if prim == nil {
+			return 0
+		}
+		return float64(atomic.LoadUint64(&prim.rl.droppedBytes))
+	})
+	_ = metrics.NewGauge("vm_replication_is_standby", func() float64 {
+		if IsStandby() {
+			return 1
+		}
+		return 0
+	})
+)
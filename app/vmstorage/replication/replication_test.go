@@ -0,0 +1,216 @@
+package replication
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// testStorage collects rows added by the standby.
+type testStorage struct {
+	mu      sync.Mutex
+	rows    []string
+	flushes int
+}
+
+func (ts *testStorage) addRows(mrs []storage.MetricRow, precisionBits uint8) error {
+	ts.mu.Lock()
+	for _, mr := range mrs {
+		ts.rows = append(ts.rows, string(mr.MetricNameRaw))
+	}
+	ts.mu.Unlock()
+	return nil
+}
+
+func (ts *testStorage) flush() bool {
+	ts.mu.Lock()
+	ts.flushes++
+	ts.mu.Unlock()
+	return true
+}
+
+func (ts *testStorage) rowsCount() int {
+	ts.mu.Lock()
+	n := len(ts.rows)
+	ts.mu.Unlock()
+	return n
+}
+
+func newTestStandbyServer(sb *standby) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/internal/replication")
+		if !sb.requestHandler(w, r, path) {
+			http.Error(w, "unsupported path", http.StatusNotFound)
+		}
+	}))
+}
+
+func waitForRowsCount(t *testing.T, ts *testStorage, rowsCountExpected int) {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		if ts.rowsCount() == rowsCountExpected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("unexpected number of replicated rows; got %d; want %d", ts.rowsCount(), rowsCountExpected)
+}
+
+func TestReplication(t *testing.T) {
+	standbyFlushIntervalOrig := standbyFlushInterval
+	standbyFlushInterval = 10 * time.Millisecond
+	defer func() {
+		standbyFlushInterval = standbyFlushIntervalOrig
+	}()
+
+	primaryPath := "TestReplication-primary"
+	standbyPath := "TestReplication-standby"
+	defer func() {
+		_ = os.RemoveAll(primaryPath)
+		_ = os.RemoveAll(standbyPath)
+	}()
+
+	ts := &testStorage{}
+	sb := mustOpenStandby(standbyPath, ts.addRows, ts.flush)
+	srv := newTestStandbyServer(sb)
+
+	rl := mustOpenReplicationLog(primaryPath, 1e9)
+	addRows := func(prefix string, n int) {
+		t.Helper()
+		if err := rl.addRows(getMetricRowPtrs(newTestRows(prefix, n)), 64); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+	}
+	addRows("foo", 10)
+	p := newPrimary(rl, srv.URL, "", time.Second)
+	addRows("bar", 20)
+	waitForRowsCount(t, ts, 30)
+	if lag := p.lag(); lag != 0 {
+		t.Fatalf("unexpected replication lag: %d bytes", lag)
+	}
+
+	// Stop the standby and add more rows to the primary.
+	srv.Close()
+	sb.mustStop()
+	addRows("baz", 5)
+	if lag := p.lag(); lag == 0 {
+		t.Fatalf("expecting non-zero replication lag while the standby is stopped")
+	}
+
+	// The standby must catch up from the last acknowledged position after the restart.
+	sb = mustOpenStandby(standbyPath, ts.addRows, ts.flush)
+	srv = newTestStandbyServer(sb)
+	p.mustStop()
+	p = newPrimary(rl, srv.URL, "", time.Second)
+	waitForRowsCount(t, ts, 35)
+	for i, row := range ts.rows[30:] {
+		if want := fmt.Sprintf("baz_%d", i); row != want {
+			t.Fatalf("unexpected row #%d replicated after the restart; got %q; want %q", i, row, want)
+		}
+	}
+
+	// The standby must reject replicated data after the promotion.
+	if err := sb.promote(); err != nil {
+		t.Fatalf("cannot promote the standby: %s", err)
+	}
+	if sb.isStandby() {
+		t.Fatalf("the standby must be promoted")
+	}
+	addRows("qwe", 3)
+	time.Sleep(100 * time.Millisecond)
+	if n := ts.rowsCount(); n != 35 {
+		t.Fatalf("unexpected number of rows after the promotion; got %d; want 35", n)
+	}
+
+	p.mustStop()
+	rl.mustClose()
+	srv.Close()
+	sb.mustStop()
+
+	// The promotion must survive the restart.
+	sb = mustOpenStandby(standbyPath, ts.addRows, ts.flush)
+	if sb.isStandby() {
+		t.Fatalf("the standby must remain promoted after the restart")
+	}
+	sb.mustStop()
+}
+
+func TestStandbyWriteConflict(t *testing.T) {
+	path := "TestStandbyWriteConflict"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	ts := &testStorage{}
+	sb := mustOpenStandby(path, ts.addRows, ts.flush)
+	defer sb.mustStop()
+
+	f := func(logID string, pos uint64, reset bool, statusCodeExpected int, posExpected uint64) {
+		t.Helper()
+		st, statusCode, err := sb.write(logID, pos, reset, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if statusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", statusCode, statusCodeExpected)
+		}
+		if st.Position != posExpected {
+			t.Fatalf("unexpected position; got %d; want %d", st.Position, posExpected)
+		}
+	}
+
+	// Data from unknown log must be rejected.
+	f("foo", 0, false, http.StatusConflict, 0)
+
+	// Reset must switch the standby to the given log and position.
+	f("foo", 123, true, http.StatusOK, 123)
+	f("foo", 123, false, http.StatusOK, 123)
+
+	// Data at unexpected position must be rejected.
+	f("foo", 100, false, http.StatusConflict, 123)
+	f("bar", 123, false, http.StatusConflict, 123)
+
+	// Data mustn't be applied concurrently with the previously sent data.
+	sb.mu.Lock()
+	sb.isWriting = true
+	sb.mu.Unlock()
+	if _, statusCode, err := sb.write("foo", 123, false, nil); err == nil || statusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expecting error with status code %d; got status code %d, error %v", http.StatusServiceUnavailable, statusCode, err)
+	}
+	sb.mu.Lock()
+	sb.isWriting = false
+	sb.mu.Unlock()
+	f("foo", 123, false, http.StatusOK, 123)
+
+	// Too big data must be rejected.
+	src := encoding.CompressZSTDLevel(nil, make([]byte, maxBlockSize+1), 1)
+	if _, statusCode, err := sb.write("foo", 123, false, src); err == nil || statusCode != http.StatusBadRequest {
+		t.Fatalf("expecting error with status code %d; got status code %d, error %v", http.StatusBadRequest, statusCode, err)
+	}
+	f("foo", 123, false, http.StatusOK, 123)
+}
+
+func TestCheckStandbyTimestampPrecision(t *testing.T) {
+	f := func(precision string, resultExpected bool) {
+		t.Helper()
+		err := checkStandbyTimestampPrecision(&standbyStatus{
+			TimestampPrecision: precision,
+		})
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result for precision %q; got %v; want %v; err: %v", precision, result, resultExpected, err)
+		}
+	}
+
+	// The primary uses the default millisecond precision in tests.
+	f("ms", true)
+	f("", true)
+	f("us", false)
+	f("ns", false)
+}
@@ -0,0 +1,346 @@
+package replication
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// standbyStateFilename is the name of the file with the position flushed to files on the standby.
+const standbyStateFilename = "standby_state"
+
+// promotedFilename is the name of the file, which is created when the standby is promoted.
+const promotedFilename = "promoted"
+
+// standbyFlushInterval is the interval for flushing replicated data to files on the standby.
+//
+// The position is persisted after the flush, so the primary could drop the replicated data.
+var standbyFlushInterval = 5 * time.Second
+
+// maxWriteRequestSize is the maximum size of compressed replicated data accepted by the standby in a single request.
+//
+// The primary sends up to maxBlockSize bytes per request. The additional space is reserved for incompressible data.
+const maxWriteRequestSize = maxBlockSize + maxBlockSize/64
+
+// standbyStatus is the response of the standby to the primary.
+type standbyStatus struct {
+	// LogID is the id of the primary replication log the Position belongs to.
+	LogID string `json:"logID"`
+
+	// Position is the position in the replication log the standby expects to receive data from.
+	Position uint64 `json:"position"`
+
+	// FlushedPosition is the position in the replication log, which is already flushed to files on the standby.
+	FlushedPosition uint64 `json:"flushedPosition"`
+
+	// IsPromoted is set if the standby has been promoted and it no longer accepts replicated data.
+	IsPromoted bool `json:"isPromoted"`
+
+	// TimestampPrecision is the -storage.timestampPrecision used by the standby.
+	//
+	// It is empty for standbys, which don't report the precision. Such standbys store timestamps in milliseconds.
+	TimestampPrecision string `json:"timestampPrecision"`
+}
+
+// standby receives replicated data from the primary.
+type standby struct {
+	path    string
+	addRows func(mrs []storage.MetricRow, precisionBits uint8) error
+	flush   func() bool
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// writeDoneCond is signaled when isWriting is reset.
+	writeDoneCond *sync.Cond
+
+	logID        string
+	pos          uint64
+	isPromoted   bool
+	isWriting    bool
+	flushedLogID string
+	flushedPos   uint64
+}
+
+func mustOpenStandby(path string, addRows func(mrs []storage.MetricRow, precisionBits uint8) error, flush func() bool) *standby {
+	if err := fs.MkdirAllIfNotExist(path); err != nil {
+		logger.Panicf("FATAL: cannot create directory for replication state: %s", err)
+	}
+	sb := &standby{
+		path:    path,
+		addRows: addRows,
+		flush:   flush,
+		stopCh:  make(chan struct{}),
+	}
+	sb.writeDoneCond = sync.NewCond(&sb.mu)
+	if fs.IsPathExist(path + "/" + promotedFilename) {
+		logger.Warnf("the standby has been already promoted; it doesn't accept replicated data; "+
+			"remove %q for accepting replicated data again", path+"/"+promotedFilename)
+		sb.isPromoted = true
+		return sb
+	}
+	logID, pos, err := readStandbyState(path + "/" + standbyStateFilename)
+	if err != nil {
+		logger.Panicf("FATAL: %s", err)
+	}
+	sb.logID = logID
+	sb.pos = pos
+	sb.flushedPos = pos
+	sb.flushedLogID = logID
+	sb.wg.Add(1)
+	go func() {
+		defer sb.wg.Done()
+		sb.runFlusher()
+	}()
+	return sb
+}
+
+func (sb *standby) mustStop() {
+	close(sb.stopCh)
+	sb.wg.Wait()
+	sb.mu.Lock()
+	isPromoted := sb.isPromoted
+	sb.mu.Unlock()
+	if !isPromoted {
+		sb.flushAndPersistState()
+	}
+}
+
+// isStandby returns true if sb accepts replicated data.
+func (sb *standby) isStandby() bool {
+	sb.mu.Lock()
+	ok := !sb.isPromoted
+	sb.mu.Unlock()
+	return ok
+}
+
+// promote stops accepting replicated data, so sb may accept data from other sources.
+func (sb *standby) promote() error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	// Wait until the replicated data is applied, so the logged position below is accurate.
+	for sb.isWriting {
+		sb.writeDoneCond.Wait()
+	}
+	if sb.isPromoted {
+		return nil
+	}
+	if err := fs.WriteFileAtomically(sb.path+"/"+promotedFilename, nil); err != nil {
+		return fmt.Errorf("cannot persist promotion state: %w", err)
+	}
+	sb.isPromoted = true
+	logger.Infof("the standby has been promoted at the position %d of the replication log %s; it no longer accepts replicated data", sb.pos, sb.logID)
+	return nil
+}
+
+func (sb *standby) status() *standbyStatus {
+	sb.mu.Lock()
+	st := sb.statusLocked()
+	sb.mu.Unlock()
+	return st
+}
+
+func (sb *standby) statusLocked() *standbyStatus {
+	flushedPos := sb.flushedPos
+	if sb.flushedLogID != sb.logID {
+		// The flushed data belongs to another replication log.
+		flushedPos = 0
+	}
+	return &standbyStatus{
+		LogID:              sb.logID,
+		Position:           sb.pos,
+		FlushedPosition:    flushedPos,
+		IsPromoted:         sb.isPromoted,
+		TimestampPrecision: storage.GetTimestampPrecision(),
+	}
+}
+
+// write adds replicated records from src to the storage.
+//
+// src must contain records from the replication log with the given logID starting at the given pos.
+// If reset is set, then sb switches to the given logID and pos.
+// It returns standby status and http status code for the response.
+//
+// sb.mu is held only for checking and advancing the position, so status requests and flushes
+// aren't blocked while the replicated data is added to the storage.
+func (sb *standby) write(logID string, pos uint64, reset bool, src []byte) (*standbyStatus, int, error) {
+	// Limit the decompressed size, since small compressed data may expand to huge size.
+	data, err := encoding.DecompressZSTDLimited(nil, src, maxBlockSize)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("cannot decompress replicated data: %w", err)
+	}
+
+	sb.mu.Lock()
+	if sb.isPromoted {
+		st := sb.statusLocked()
+		sb.mu.Unlock()
+		return st, http.StatusConflict, nil
+	}
+	if sb.isWriting {
+		sb.mu.Unlock()
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("cannot apply replicated records at the position %d, since the previously sent records are still being applied", pos)
+	}
+	if reset {
+		if logID != sb.logID || pos != sb.pos {
+			logger.Infof("switching replication from the position %d of the log %q to the position %d of the log %q", sb.pos, sb.logID, pos, logID)
+		}
+		sb.logID = logID
+		sb.pos = pos
+	}
+	if logID != sb.logID || pos != sb.pos {
+		st := sb.statusLocked()
+		sb.mu.Unlock()
+		return st, http.StatusConflict, nil
+	}
+	sb.isWriting = true
+	sb.mu.Unlock()
+
+	n, err := unmarshalLogRecords(data, func(mrs []storage.MetricRow, precisionBits uint8) error {
+		if err := sb.addRows(mrs, precisionBits); err != nil {
+			return err
+		}
+		receivedRows.Add(len(mrs))
+		return nil
+	})
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.isWriting = false
+	sb.writeDoneCond.Broadcast()
+	// Advance the position by successfully applied records, so the primary re-sends only the remaining records.
+	sb.pos += uint64(n)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("cannot apply replicated records at the position %d: %w", sb.pos, err)
+	}
+	return sb.statusLocked(), http.StatusOK, nil
+}
+
+func (sb *standby) runFlusher() {
+	ticker := time.NewTicker(standbyFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sb.stopCh:
+			return
+		case <-ticker.C:
+			sb.flushAndPersistState()
+		}
+	}
+}
+
+// flushAndPersistState flushes the replicated data to files and then persists the replication position.
+func (sb *standby) flushAndPersistState() {
+	sb.mu.Lock()
+	logID := sb.logID
+	pos := sb.pos
+	isFlushed := logID == sb.flushedLogID && pos == sb.flushedPos
+	sb.mu.Unlock()
+
+	if isFlushed {
+		return
+	}
+	// All the data up to pos is already added to the storage, so it becomes durable after the flush.
+	if !sb.flush() {
+		return
+	}
+	if err := writeStandbyState(sb.path+"/"+standbyStateFilename, logID, pos); err != nil {
+		logger.Errorf("cannot persist replication position: %s", err)
+		return
+	}
+
+	sb.mu.Lock()
+	sb.flushedLogID = logID
+	sb.flushedPos = pos
+	sb.mu.Unlock()
+}
+
+func (sb *standby) requestHandler(w http.ResponseWriter, r *http.Request, path string) bool {
+	switch path {
+	case "/status":
+		writeStandbyStatus(w, sb.status(), http.StatusOK)
+		return true
+	case "/write":
+		logID := r.FormValue("logID")
+		pos, err := strconv.ParseUint(r.FormValue("pos"), 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot parse pos: %s", err), http.StatusBadRequest)
+			return true
+		}
+		reset := r.FormValue("reset") == "1"
+		src, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWriteRequestSize+1))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot read request body: %s", err), http.StatusBadRequest)
+			return true
+		}
+		if len(src) > maxWriteRequestSize {
+			http.Error(w, fmt.Sprintf("too big request body; max allowed size: %d bytes", maxWriteRequestSize), http.StatusBadRequest)
+			return true
+		}
+		st, statusCode, err := sb.write(logID, pos, reset, src)
+		if err != nil {
+			logger.Errorf("cannot apply replicated data: %s", err)
+			http.Error(w, err.Error(), statusCode)
+			return true
+		}
+		writeStandbyStatus(w, st, statusCode)
+		return true
+	case "/promote":
+		if err := sb.promote(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true
+		}
+		writeStandbyStatus(w, sb.status(), http.StatusOK)
+		return true
+	default:
+		return false
+	}
+}
+
+func writeStandbyStatus(w http.ResponseWriter, st *standbyStatus, statusCode int) {
+	data, err := json.Marshal(st)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal standby status: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(data)
+}
+
+// readStandbyState reads the replication log id and position from the file at the given path.
+func readStandbyState(path string) (string, uint64, error) {
+	if !fs.IsPathExist(path) {
+		return "", 0, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot read replication state: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return "", 0, fmt.Errorf("unexpected replication state in %q: %q; want `<logID> <position>`", path, data)
+	}
+	pos, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot parse replication position from %q: %w", path, err)
+	}
+	return fields[0], pos, nil
+}
+
+// writeStandbyState atomically replaces the file at the given path with the given replication log id and position.
+func writeStandbyState(path, logID string, pos uint64) error {
+	return fs.ReplaceFileAtomically(path, []byte(fmt.Sprintf("%s %d", logID, pos)))
+}
@@ -2,6 +2,7 @@ package blockcache
 
 import (
 	"container/heap"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -133,6 +134,32 @@ func (c *Cache) Misses() uint64 {
 	return n
 }
 
+// HotKeys returns up to maxKeys keys for the most recently accessed blocks in c.
+//
+// The keys are sorted by the last access time in descending order.
+func (c *Cache) HotKeys(maxKeys int) []Key {
+	var hks []hotKey
+	for _, shard := range c.shards {
+		hks = shard.appendHotKeys(hks)
+	}
+	sort.SliceStable(hks, func(i, j int) bool {
+		return hks[i].lastAccessTime > hks[j].lastAccessTime
+	})
+	if len(hks) > maxKeys {
+		hks = hks[:maxKeys]
+	}
+	keys := make([]Key, len(hks))
+	for i := range hks {
+		keys[i] = hks[i].k
+	}
+	return keys
+}
+
+type hotKey struct {
+	k              Key
+	lastAccessTime uint64
+}
+
 func (c *Cache) cleaner() {
 	ticker := time.NewTicker(57 * time.Second)
 	defer ticker.Stop()
@@ -341,6 +368,19 @@ func (c *cache) PutBlock(k Key, b Block) {
 	}
 }
 
+func (c *cache) appendHotKeys(dst []hotKey) []hotKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range c.lah {
+		dst = append(dst, hotKey{
+			k:              e.k,
+			lastAccessTime: e.lastAccessTime,
+		})
+	}
+	return dst
+}
+
 func (c *cache) Len() int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
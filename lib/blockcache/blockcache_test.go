@@ -2,6 +2,7 @@ package blockcache
 
 import (
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 
@@ -121,6 +122,41 @@ func TestCache(t *testing.T) {
 	}
 }
 
+func TestCacheHotKeys(t *testing.T) {
+	getMaxSize := func() int {
+		return 1024 * 1024
+	}
+	c := NewCache(getMaxSize)
+	defer c.MustStop()
+
+	var keys []Key
+	for i := 0; i < 5; i++ {
+		k := Key{
+			Part:   "foo",
+			Offset: uint64(i),
+		}
+		c.PutBlock(k, &testBlock{})
+		keys = append(keys, k)
+	}
+	// Set distinct access times for the cached blocks, so the keys with bigger offsets are accessed more recently.
+	for _, shard := range c.shards {
+		for _, e := range shard.m["foo"] {
+			e.lastAccessTime = e.k.Offset + 1
+		}
+	}
+
+	f := func(maxKeys int, keysExpected []Key) {
+		t.Helper()
+		hotKeys := c.HotKeys(maxKeys)
+		if !reflect.DeepEqual(hotKeys, keysExpected) {
+			t.Fatalf("unexpected hot keys; got %v; want %v", hotKeys, keysExpected)
+		}
+	}
+	f(0, []Key{})
+	f(2, []Key{keys[4], keys[3]})
+	f(10, []Key{keys[4], keys[3], keys[2], keys[1], keys[0]})
+}
+
 func TestCacheConcurrentAccess(t *testing.T) {
 	const sizeMaxBytes = 16 * 1024 * 1024
 	getMaxSize := func() int {
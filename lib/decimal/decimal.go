@@ -448,6 +448,34 @@ func FromFloat(f float64) (int64, int16) {
 	return v, e
 }
 
+// FromFloatWithScale converts f to v, so f=v*10^e for the given e.
+//
+// v is rounded to the nearest integer if f cannot be represented with the given e.
+// FromFloatWithScale is the inverse of ToFloat for values returned from ToFloat.
+func FromFloatWithScale(f float64, e int16) int64 {
+	if IsStaleNaN(f) {
+		return vStaleNaN
+	}
+	if math.IsInf(f, 0) {
+		v, _ := fromFloatInf(f)
+		return v
+	}
+	// Use the same operations as in ToFloat in order to minimize rounding errors.
+	if e < 0 {
+		f *= math.Pow10(int(-e))
+	} else {
+		f /= math.Pow10(int(e))
+	}
+	f = math.Round(f)
+	if f >= vMax {
+		return vMax
+	}
+	if f <= vMin {
+		return vMin
+	}
+	return int64(f)
+}
+
 func fromFloatInf(f float64) (int64, int16) {
 	// Limit infs by max and min values for int64
 	if math.IsInf(f, 1) {
@@ -537,3 +537,32 @@ func equalFloat(f1, f2 float64) bool {
 	eps := math.Abs(f1 - f2)
 	return eps == 0 || eps*conversionPrecision < math.Abs(f1)+math.Abs(f2)
 }
+
+func TestFromFloatWithScale(t *testing.T) {
+	f := func(v int64, e int16) {
+		t.Helper()
+		fv := ToFloat(v, e)
+		if vNew := FromFloatWithScale(fv, e); vNew != v {
+			t.Fatalf("unexpected value for ToFloat(%d, %d)=%v; got %d; want %d", v, e, fv, vNew, v)
+		}
+	}
+	f(0, 0)
+	f(0, -5)
+	f(1, 0)
+	f(-1, 3)
+	f(1234, -3)
+	f(-1234, -3)
+	f(123456789012, -10)
+	f(5, 300)
+	f(vInfPos, 0)
+	f(vInfNeg, -3)
+	f(vStaleNaN, 2)
+
+	// Values are rounded to the nearest integer for the given scale.
+	if v := FromFloatWithScale(1.26, -1); v != 13 {
+		t.Fatalf("unexpected value; got %d; want 13", v)
+	}
+	if v := FromFloatWithScale(1e300, 0); v != vMax {
+		t.Fatalf("unexpected value; got %d; want %d", v, int64(vMax))
+	}
+}
@@ -20,6 +20,20 @@ func CompressZSTDLevel(dst, src []byte, compressLevel int) []byte {
 	return dst
 }
 
+// DecompressZSTDLimited decompresses src, appends the result to dst and returns
+// the appended dst.
+//
+// An error is returned if the decompressed src exceeds maxSize bytes.
+// This protects from excess memory usage when decompressing untrusted data.
+func DecompressZSTDLimited(dst, src []byte, maxSize int) ([]byte, error) {
+	decompressCalls.Inc()
+	b, err := zstd.DecompressLimited(dst, src, maxSize)
+	if err != nil {
+		return b, fmt.Errorf("cannot decompress zstd block with len=%d to at most %d bytes: %w", len(src), maxSize, err)
+	}
+	return b, nil
+}
+
 // DecompressZSTD decompresses src, appends the result to dst and returns
 // the appended dst.
 func DecompressZSTD(dst, src []byte) ([]byte, error) {
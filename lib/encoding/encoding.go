@@ -40,12 +40,29 @@ const (
 	// MarshalTypeNearestDelta is used instead of MarshalTypeZSTDNearestDelta
 	// if compression doesn't help.
 	MarshalTypeNearestDelta = MarshalType(6)
+
+	// MarshalTypeXOR is used for lossless marshaling of float64 bits for gauge values
+	// if it gives smaller size than the other types. See SetXOREncoding.
+	//
+	// Older releases cannot read values marshaled with this type.
+	MarshalTypeXOR = MarshalType(7)
 )
 
+// SetXOREncoding enables or disables MarshalTypeXOR for values marshaled with MarshalValues.
+//
+// Values marshaled with MarshalTypeXOR are always readable regardless of this setting.
+//
+// This function must be called before marshaling values.
+func SetXOREncoding(enabled bool) {
+	xorEncodingEnabled = enabled
+}
+
+var xorEncodingEnabled = false
+
 // CheckMarshalType verifies whether the mt is valid.
 func CheckMarshalType(mt MarshalType) error {
-	if mt < 0 || mt > 6 {
-		return fmt.Errorf("MarshalType should be in range [0..6]; got %d", mt)
+	if mt < 0 || mt > 7 {
+		return fmt.Errorf("MarshalType should be in range [0..7]; got %d", mt)
 	}
 	return nil
 }
@@ -81,21 +98,46 @@ func UnmarshalTimestamps(dst []int64, src []byte, mt MarshalType, firstTimestamp
 	return dst, nil
 }
 
-// MarshalValues marshals values, appends the marshaled result to dst
+// MarshalValues marshals decimal values with the given scale, appends the marshaled result to dst
 // and returns the dst.
 //
 // precisionBits must be in the range [1...64], where 1 means 50% precision,
 // while 64 means 100% precision, i.e. lossless encoding.
-func MarshalValues(dst []byte, values []int64, precisionBits uint8) (result []byte, mt MarshalType, firstValue int64) {
-	return marshalInt64Array(dst, values, precisionBits)
+//
+// If XOR encoding is enabled via SetXOREncoding, then values are marshaled with lossless MarshalTypeXOR
+// if it gives smaller size than the marshal type selected for the given precisionBits.
+func MarshalValues(dst []byte, values []int64, scale int16, precisionBits uint8) (result []byte, mt MarshalType, firstValue int64) {
+	dstLen := len(dst)
+	dst, mt, firstValue = marshalInt64Array(dst, values, precisionBits)
+	if !xorEncodingEnabled || mt == MarshalTypeConst || mt == MarshalTypeDeltaConst {
+		// There is no sense in trying XOR encoding, since it cannot beat these types.
+		return dst, mt, firstValue
+	}
+
+	bb := bbPool.Get()
+	var xorFirstValue int64
+	var ok bool
+	bb.B, xorFirstValue, ok = marshalFloat64XOR(bb.B[:0], values, scale)
+	if ok && len(bb.B) < len(dst)-dstLen {
+		dst = append(dst[:dstLen], bb.B...)
+		mt = MarshalTypeXOR
+		firstValue = xorFirstValue
+	}
+	bbPool.Put(bb)
+	return dst, mt, firstValue
 }
 
-// UnmarshalValues unmarshals values from src, appends them to dst and returns
+// UnmarshalValues unmarshals decimal values with the given scale from src, appends them to dst and returns
 // the resulting dst.
 //
 // firstValue must be the value returned from MarshalValues.
-func UnmarshalValues(dst []int64, src []byte, mt MarshalType, firstValue int64, itemsCount int) ([]int64, error) {
-	dst, err := unmarshalInt64Array(dst, src, mt, firstValue, itemsCount)
+func UnmarshalValues(dst []int64, src []byte, mt MarshalType, firstValue int64, scale int16, itemsCount int) ([]int64, error) {
+	var err error
+	if mt == MarshalTypeXOR {
+		dst, err = unmarshalFloat64XOR(dst, src, firstValue, scale, itemsCount)
+	} else {
+		dst, err = unmarshalInt64Array(dst, src, mt, firstValue, itemsCount)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("cannot unmarshal %d values from len(src)=%d bytes: %w", itemsCount, len(src), err)
 	}
@@ -182,8 +182,8 @@ func TestMarshalUnmarshalValues(t *testing.T) {
 		v += int64(rand.NormFloat64() * 1e2)
 		values = append(values, v)
 	}
-	result, mt, firstValue := MarshalValues(nil, values, precisionBits)
-	values2, err := UnmarshalValues(nil, result, mt, firstValue, len(values))
+	result, mt, firstValue := MarshalValues(nil, values, 0, precisionBits)
+	values2, err := UnmarshalValues(nil, result, mt, firstValue, 0, len(values))
 	if err != nil {
 		t.Fatalf("cannot unmarshal values: %s", err)
 	}
@@ -0,0 +1,227 @@
+package encoding
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// marshalFloat64XOR converts decimal values with the given scale to float64 and marshals float64 bits
+// with `xor` encoding. The result is appended to dst.
+//
+// This gives better compression than `nearest delta` encoding for gauges with short binary fractions
+// such as 0.25 or 0.0625 steps, since float64 bits for such values contain many trailing zeros.
+//
+// ok is set to false if values cannot be restored from float64 without precision loss.
+// The returned result must be ignored in this case.
+func marshalFloat64XOR(dst []byte, values []int64, scale int16) (result []byte, firstValue int64, ok bool) {
+	is := GetInt64s(len(values))
+	defer PutInt64s(is)
+	a := is.A
+	for i, v := range values {
+		f := decimal.ToFloat(v, scale)
+		if decimal.FromFloatWithScale(f, scale) != v {
+			return dst, 0, false
+		}
+		a[i] = int64(math.Float64bits(f))
+	}
+	dst, firstValue = marshalInt64XOR(dst, a)
+	return dst, firstValue, true
+}
+
+// unmarshalFloat64XOR unmarshals float64 bits marshaled with marshalFloat64XOR,
+// converts them to decimal values with the given scale and appends the result to dst.
+func unmarshalFloat64XOR(dst []int64, src []byte, firstValue int64, scale int16, itemsCount int) ([]int64, error) {
+	dstLen := len(dst)
+	dst, err := unmarshalInt64XOR(dst, src, firstValue, itemsCount)
+	if err != nil {
+		return nil, err
+	}
+	a := dst[dstLen:]
+	for i, v := range a {
+		a[i] = decimal.FromFloatWithScale(math.Float64frombits(uint64(v)), scale)
+	}
+	return dst, nil
+}
+
+// marshalInt64XOR encodes src using `xor` encoding from Facebook Gorilla paper
+// and appends the encoded value to dst.
+//
+// Every value is XORed with the previous value. Zero XOR results are encoded with a single bit,
+// while non-zero XOR results are encoded with the meaningful bits between leading and trailing zeros.
+// The meaningful bits window is re-used for the next values if it fits them.
+//
+// The encoding is lossless. It is applied to float64 bits by marshalFloat64XOR.
+func marshalInt64XOR(dst []byte, src []int64) (result []byte, firstValue int64) {
+	if len(src) < 1 {
+		logger.Panicf("BUG: src must contain at least 1 item; got %d items", len(src))
+	}
+
+	firstValue = src[0]
+	bw := xorBitWriter{
+		dst: dst,
+	}
+	prev := uint64(firstValue)
+	prevLeading := uint(0)
+	prevTrailing := uint(0)
+	hasWindow := false
+	for _, v := range src[1:] {
+		x := uint64(v) ^ prev
+		prev = uint64(v)
+		if x == 0 {
+			bw.writeBits(0, 1)
+			continue
+		}
+		leading := uint(bits.LeadingZeros64(x))
+		trailing := uint(bits.TrailingZeros64(x))
+		if hasWindow && leading >= prevLeading && trailing >= prevTrailing {
+			// The meaningful bits fit the previous window.
+			bw.writeBits(0b10, 2)
+			bw.writeBits(x>>prevTrailing, 64-prevLeading-prevTrailing)
+			continue
+		}
+
+		// Start new window. The number of meaningful bits is in the range [1..64],
+		// so it is stored as meaningful-1 in order to fit 6 bits.
+		meaningful := 64 - leading - trailing
+		bw.writeBits(0b11, 2)
+		bw.writeBits(uint64(leading), 6)
+		bw.writeBits(uint64(meaningful-1), 6)
+		bw.writeBits(x>>trailing, meaningful)
+		prevLeading = leading
+		prevTrailing = trailing
+		hasWindow = true
+	}
+	return bw.flush(), firstValue
+}
+
+// unmarshalInt64XOR decodes src using `xor` encoding, appends the result to dst
+// and returns the appended result.
+//
+// The firstValue must be the value returned from marshalInt64XOR.
+func unmarshalInt64XOR(dst []int64, src []byte, firstValue int64, itemsCount int) ([]int64, error) {
+	if itemsCount < 1 {
+		logger.Panicf("BUG: itemsCount must be greater than 0; got %d", itemsCount)
+	}
+
+	br := xorBitReader{
+		src: src,
+	}
+	v := uint64(firstValue)
+	dst = append(dst, firstValue)
+	leading := uint(0)
+	trailing := uint(0)
+	hasWindow := false
+	for i := 1; i < itemsCount; i++ {
+		controlBit, err := br.readBits(1)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read control bit for item #%d: %w", i, err)
+		}
+		if controlBit == 0 {
+			dst = append(dst, int64(v))
+			continue
+		}
+		windowBit, err := br.readBits(1)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read window bit for item #%d: %w", i, err)
+		}
+		if windowBit == 1 {
+			n, err := br.readBits(6)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read leading zeros for item #%d: %w", i, err)
+			}
+			leading = uint(n)
+			n, err = br.readBits(6)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read meaningful bits count for item #%d: %w", i, err)
+			}
+			meaningful := uint(n) + 1
+			if leading+meaningful > 64 {
+				return nil, fmt.Errorf("invalid window for item #%d: leading zeros=%d, meaningful bits=%d", i, leading, meaningful)
+			}
+			trailing = 64 - leading - meaningful
+			hasWindow = true
+		} else if !hasWindow {
+			return nil, fmt.Errorf("missing window for item #%d", i)
+		}
+		x, err := br.readBits(64 - leading - trailing)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read meaningful bits for item #%d: %w", i, err)
+		}
+		v ^= x << trailing
+		dst = append(dst, int64(v))
+	}
+	if len(br.src) > 0 || br.acc&(1<<br.n-1) != 0 {
+		return nil, fmt.Errorf("unexpected tail left after unmarshaling %d items from %d bytes; tail size=%d bytes", itemsCount, len(src), len(br.src))
+	}
+	return dst, nil
+}
+
+// xorBitWriter appends bits to dst in big-endian order.
+type xorBitWriter struct {
+	dst []byte
+
+	// acc contains n pending bits, which aren't written to dst yet.
+	acc uint64
+	n   uint
+}
+
+// writeBits writes n lower bits from v to bw. n must be in the range [0..64].
+func (bw *xorBitWriter) writeBits(v uint64, n uint) {
+	if n > 32 {
+		bw.writeBits(v>>32, n-32)
+		n = 32
+	}
+	bw.acc = bw.acc<<n | v&(1<<n-1)
+	bw.n += n
+	for bw.n >= 8 {
+		bw.n -= 8
+		bw.dst = append(bw.dst, byte(bw.acc>>bw.n))
+	}
+}
+
+// flush writes pending bits to bw.dst padded with zero bits and returns bw.dst.
+func (bw *xorBitWriter) flush() []byte {
+	if bw.n > 0 {
+		bw.dst = append(bw.dst, byte(bw.acc<<(8-bw.n)))
+		bw.n = 0
+	}
+	return bw.dst
+}
+
+// xorBitReader reads bits written by xorBitWriter.
+type xorBitReader struct {
+	src []byte
+
+	// acc contains n bits, which are read from src, but aren't returned yet.
+	acc uint64
+	n   uint
+}
+
+// readBits reads n bits from br. n must be in the range [0..64].
+func (br *xorBitReader) readBits(n uint) (uint64, error) {
+	if n > 32 {
+		hi, err := br.readBits(n - 32)
+		if err != nil {
+			return 0, err
+		}
+		lo, err := br.readBits(32)
+		if err != nil {
+			return 0, err
+		}
+		return hi<<32 | lo, nil
+	}
+	for br.n < n {
+		if len(br.src) == 0 {
+			return 0, fmt.Errorf("unexpected end of data")
+		}
+		br.acc = br.acc<<8 | uint64(br.src[0])
+		br.src = br.src[1:]
+		br.n += 8
+	}
+	br.n -= n
+	return (br.acc >> br.n) & (1<<n - 1), nil
+}
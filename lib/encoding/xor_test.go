@@ -0,0 +1,154 @@
+package encoding
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+)
+
+func TestMarshalInt64XOR(t *testing.T) {
+	f := func(va []int64, firstValueExpected int64, bExpected string) {
+		t.Helper()
+		b, firstValue := marshalInt64XOR(nil, va)
+		if firstValue != firstValueExpected {
+			t.Fatalf("unexpected firstValue for va=%d; got %d; want %d", va, firstValue, firstValueExpected)
+		}
+		if s := fmt.Sprintf("%x", b); s != bExpected {
+			t.Fatalf("invalid marshaled data for va=%d; got\n%s; expecting\n%s", va, s, bExpected)
+		}
+	}
+	f([]int64{0}, 0, "")
+	f([]int64{5, 5}, 5, "00")
+	f([]int64{5, 5, 5, 5, 5, 5, 5, 5, 5}, 5, "00")
+	f([]int64{0, 1}, 0, "ff02")
+	f([]int64{0, 1, 0}, 0, "ff0340")
+	f([]int64{0, -1}, 0, "c0fffffffffffffffffc")
+}
+
+func TestMarshalUnmarshalInt64XOR(t *testing.T) {
+	f := func(va []int64) {
+		t.Helper()
+		b, firstValue := marshalInt64XOR(nil, va)
+		vaNew, err := unmarshalInt64XOR(nil, b, firstValue, len(va))
+		if err != nil {
+			t.Fatalf("cannot unmarshal va=%d from %x: %s", va, b, err)
+		}
+		if !reflect.DeepEqual(vaNew, va) {
+			t.Fatalf("unexpected vaNew; got\n%d; expecting\n%d", vaNew, va)
+		}
+
+		// Verify unmarshaling into non-empty dst.
+		vaPrefix := []int64{1, 2, 3}
+		vaNew, err = unmarshalInt64XOR(vaPrefix, b, firstValue, len(va))
+		if err != nil {
+			t.Fatalf("cannot unmarshal prefixed va=%d: %s", va, err)
+		}
+		if !reflect.DeepEqual(vaNew[:len(vaPrefix)], vaPrefix) {
+			t.Fatalf("unexpected prefix; got\n%d; expecting\n%d", vaNew[:len(vaPrefix)], vaPrefix)
+		}
+		if !reflect.DeepEqual(vaNew[len(vaPrefix):], va) {
+			t.Fatalf("unexpected prefixed vaNew; got\n%d; expecting\n%d", vaNew[len(vaPrefix):], va)
+		}
+
+		// Verify that truncated data cannot be unmarshaled.
+		if len(b) > 0 {
+			if _, err := unmarshalInt64XOR(nil, b[:len(b)-1], firstValue, len(va)); err == nil {
+				t.Fatalf("expecting non-nil error when unmarshaling truncated data for va=%d", va)
+			}
+		}
+	}
+	f([]int64{0})
+	f([]int64{0, 0})
+	f([]int64{1, -3})
+	f([]int64{math.MinInt64, math.MaxInt64, 0, -1, 1})
+	f([]int64{0, 1, 2, 3, 4, 5})
+	f([]int64{5, 4, 3, 2, 1, 0})
+
+	var va []int64
+	v := int64(0)
+	for i := 0; i < 1024; i++ {
+		v += int64(rand.NormFloat64() * 1e6)
+		va = append(va, v)
+	}
+	f(va)
+
+	va = va[:0]
+	for i := 0; i < 1024; i++ {
+		va = append(va, int64(rand.Uint64()))
+	}
+	f(va)
+}
+
+func TestMarshalValuesXOR(t *testing.T) {
+	// High-entropy gauge values with short binary fractions.
+	r := rand.New(rand.NewSource(1))
+	var fa []float64
+	for i := 0; i < 8*1024; i++ {
+		fa = append(fa, float64(r.Intn(1e5))*0.25)
+	}
+	values, scale := decimal.AppendFloatToDecimal(nil, fa)
+
+	// XOR encoding must be disabled by default.
+	_, mt, _ := MarshalValues(nil, values, scale, 64)
+	if mt == MarshalTypeXOR {
+		t.Fatalf("unexpected MarshalTypeXOR when XOR encoding is disabled")
+	}
+
+	SetXOREncoding(true)
+	defer SetXOREncoding(false)
+
+	// High-entropy values must be marshaled with lossless MarshalTypeXOR, since it gives smaller size.
+	result, mt, firstValue := MarshalValues(nil, values, scale, 64)
+	if mt != MarshalTypeXOR {
+		t.Fatalf("unexpected MarshalType; got %d; want %d", mt, MarshalTypeXOR)
+	}
+	valuesNew, err := UnmarshalValues(nil, result, mt, firstValue, scale, len(values))
+	if err != nil {
+		t.Fatalf("cannot unmarshal values: %s", err)
+	}
+	if !reflect.DeepEqual(valuesNew, values) {
+		t.Fatalf("unexpected unmarshaled values")
+	}
+
+	// Values with low entropy must be marshaled with the other marshal types.
+	values = values[:0]
+	for i := 0; i < 8*1024; i++ {
+		values = append(values, int64(i%10))
+	}
+	_, mt, _ = MarshalValues(nil, values, 0, 64)
+	if mt == MarshalTypeXOR {
+		t.Fatalf("unexpected MarshalTypeXOR for low-entropy values")
+	}
+}
+
+func TestMarshalUnmarshalFloat64XOR(t *testing.T) {
+	f := func(values []int64, scale int16, okExpected bool) {
+		t.Helper()
+		b, firstValue, ok := marshalFloat64XOR(nil, values, scale)
+		if ok != okExpected {
+			t.Fatalf("unexpected ok for values=%d, scale=%d; got %v; want %v", values, scale, ok, okExpected)
+		}
+		if !ok {
+			return
+		}
+		valuesNew, err := unmarshalFloat64XOR(nil, b, firstValue, scale, len(values))
+		if err != nil {
+			t.Fatalf("cannot unmarshal values=%d, scale=%d: %s", values, scale, err)
+		}
+		if !reflect.DeepEqual(valuesNew, values) {
+			t.Fatalf("unexpected values for scale=%d; got\n%d; expecting\n%d", scale, valuesNew, values)
+		}
+	}
+	f([]int64{0}, 0, true)
+	f([]int64{1, 2, 3}, 0, true)
+	f([]int64{12345, -12346, 12347}, -4, true)
+	f([]int64{1, 5, 7}, 10, true)
+
+	// Values, which cannot be represented as float64 without precision loss, must be rejected.
+	f([]int64{1, math.MaxInt64 - 100}, 0, false)
+	f([]int64{1<<53 + 1}, -2, false)
+}
@@ -0,0 +1,40 @@
+package encoding
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func BenchmarkMarshalInt64XOR(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchInt64Array)))
+	b.RunParallel(func(pb *testing.PB) {
+		var dst []byte
+		for pb.Next() {
+			dst, _ = marshalInt64XOR(dst[:0], benchInt64Array)
+			atomic.AddUint64(&Sink, uint64(len(dst)))
+		}
+	})
+}
+
+func BenchmarkUnmarshalInt64XOR(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchInt64Array)))
+	b.RunParallel(func(pb *testing.PB) {
+		var dst []int64
+		var err error
+		for pb.Next() {
+			dst, err = unmarshalInt64XOR(dst[:0], benchInt64XORData, benchInt64Array[0], len(benchInt64Array))
+			if err != nil {
+				panic(fmt.Errorf("unexpected error: %w", err))
+			}
+			atomic.AddUint64(&Sink, uint64(len(dst)))
+		}
+	})
+}
+
+var benchInt64XORData = func() []byte {
+	data, _ := marshalInt64XOR(nil, benchInt64Array)
+	return data
+}()
@@ -0,0 +1,24 @@
+package zstd
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// ErrSizeExceeded is returned from DecompressLimited if the decompressed data exceeds the given limit.
+var ErrSizeExceeded = errors.New("decompressed data exceeds the size limit")
+
+// readLimited appends up to maxSize bytes from r to dst.
+//
+// The decompression stops as soon as maxSize bytes are exceeded, so hostile data cannot occupy more memory.
+func readLimited(dst []byte, r io.Reader, maxSize int) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return dst, err
+	}
+	if len(data) > maxSize {
+		return dst, ErrSizeExceeded
+	}
+	return append(dst, data...), nil
+}
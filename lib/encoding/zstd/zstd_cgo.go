@@ -4,6 +4,8 @@
 package zstd
 
 import (
+	"bytes"
+
 	"github.com/valyala/gozstd"
 )
 
@@ -12,6 +14,15 @@ func Decompress(dst, src []byte) ([]byte, error) {
 	return gozstd.Decompress(dst, src)
 }
 
+// DecompressLimited appends decompressed src to dst and returns the result.
+//
+// ErrSizeExceeded is returned if decompressed src exceeds maxSize bytes.
+func DecompressLimited(dst, src []byte, maxSize int) ([]byte, error) {
+	zr := gozstd.NewReader(bytes.NewReader(src))
+	defer zr.Release()
+	return readLimited(dst, zr, maxSize)
+}
+
 // CompressLevel appends compressed src to dst and returns the result.
 //
 // The given compressionLevel is used for the compression.
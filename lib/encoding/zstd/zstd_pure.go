@@ -4,6 +4,7 @@
 package zstd
 
 import (
+	"bytes"
 	"sync"
 	"sync/atomic"
 
@@ -36,6 +37,18 @@ func Decompress(dst, src []byte) ([]byte, error) {
 	return decoder.DecodeAll(src, dst)
 }
 
+// DecompressLimited appends decompressed src to dst and returns the result.
+//
+// ErrSizeExceeded is returned if decompressed src exceeds maxSize bytes.
+func DecompressLimited(dst, src []byte, maxSize int) ([]byte, error) {
+	zr, err := zstd.NewReader(bytes.NewReader(src), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return dst, err
+	}
+	defer zr.Close()
+	return readLimited(dst, zr, maxSize)
+}
+
 // CompressLevel appends compressed src to dst and returns the result.
 //
 // The given compressionLevel is used for the compression.
@@ -95,3 +95,33 @@ func pureDecompress(dst, src []byte) ([]byte, error) {
 func cgoDecompress(dst, src []byte) ([]byte, error) {
 	return cgo.Decompress(dst, src)
 }
+
+func TestDecompressLimited(t *testing.T) {
+	b := make([]byte, 64*1024)
+	f := func(bc []byte, maxSize int, isErrorExpected bool) {
+		t.Helper()
+		bNew, err := DecompressLimited(nil, bc, maxSize)
+		if isErrorExpected {
+			if err != ErrSizeExceeded {
+				t.Fatalf("unexpected error for maxSize=%d; got %v; want %v", maxSize, err, ErrSizeExceeded)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for maxSize=%d: %s", maxSize, err)
+		}
+		if string(bNew) != string(b) {
+			t.Fatalf("unexpected decompressed data for maxSize=%d", maxSize)
+		}
+	}
+	for _, compress := range []compressFn{pureCompress, cgoCompress} {
+		bc, err := compress(nil, b, 5)
+		if err != nil {
+			t.Fatalf("cannot compress b: %s", err)
+		}
+		f(bc, len(b), false)
+		f(bc, len(b)+1, false)
+		f(bc, len(b)-1, true)
+		f(bc, 1, true)
+	}
+}
@@ -17,6 +17,15 @@ func NewArray(name, description string) *Array {
 	return &a
 }
 
+// NewArraySelector returns new ArraySelector with the given name and description.
+func NewArraySelector(name, description string) *ArraySelector {
+	description += "\nSupports an `array` of values separated by comma" +
+		" or specified via multiple flags."
+	var a ArraySelector
+	flag.Var(&a, name, description)
+	return &a
+}
+
 // NewArrayDuration returns new ArrayDuration with the given name and description.
 func NewArrayDuration(name, description string) *ArrayDuration {
 	description += "\nSupports `array` of values separated by comma" +
@@ -79,13 +88,42 @@ func (a *Array) Set(value string) error {
 	return nil
 }
 
+// ArraySelector is a flag that holds an array of values starting with series selectors.
+//
+// It works the same as Array, except of commas inside curly braces, which aren't treated as delimiters.
+// This allows passing series selectors unquoted. For instance, the following arg creates an array
+// of (`{a="b",c="d"}:7d`, `{e="f"}:1d`) items:
+//
+//    -foo='{a="b",c="d"}:7d,{e="f"}:1d'
+//
+type ArraySelector []string
+
+// String implements flag.Value interface
+func (a *ArraySelector) String() string {
+	return (*Array)(a).String()
+}
+
+// Set implements flag.Value interface
+func (a *ArraySelector) Set(value string) error {
+	values := parseArrayValuesExt(value, indexSelectorArrayDelimiter)
+	*a = append(*a, values...)
+	return nil
+}
+
 func parseArrayValues(s string) []string {
+	return parseArrayValuesExt(s, indexArrayDelimiter)
+}
+
+// parseArrayValuesExt parses comma-separated values from s.
+//
+// indexDelimiter must return the index of the delimiter for unquoted values.
+func parseArrayValuesExt(s string, indexDelimiter func(s string) int) []string {
 	if len(s) == 0 {
 		return nil
 	}
 	var values []string
 	for {
-		v, tail := getNextArrayValue(s)
+		v, tail := getNextArrayValue(s, indexDelimiter)
 		values = append(values, v)
 		if len(tail) == 0 {
 			return values
@@ -97,13 +135,13 @@ func parseArrayValues(s string) []string {
 	}
 }
 
-func getNextArrayValue(s string) (string, string) {
+func getNextArrayValue(s string, indexDelimiter func(s string) int) (string, string) {
 	if len(s) == 0 {
 		return "", ""
 	}
 	if s[0] != '"' {
 		// Fast path - unquoted string
-		n := strings.IndexByte(s, ',')
+		n := indexDelimiter(s)
 		if n < 0 {
 			// The last item
 			return s, ""
@@ -270,3 +308,40 @@ func (a *ArrayInt) GetOptionalArgOrDefault(argIdx int, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func indexArrayDelimiter(s string) int {
+	return strings.IndexByte(s, ',')
+}
+
+// indexSelectorArrayDelimiter returns the index of the first comma in s outside curly braces.
+//
+// This allows passing series selectors such as `{foo="bar",baz="x"}` as a single array value.
+// It returns -1 if s doesn't contain such a comma.
+func indexSelectorArrayDelimiter(s string) int {
+	braces := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case ',':
+			if braces == 0 {
+				return i
+			}
+		case '{':
+			braces++
+		case '}':
+			if braces > 0 {
+				braces--
+			}
+		case '"':
+			if braces == 0 {
+				continue
+			}
+			// Skip quoted string inside curly braces, since it may contain commas and braces.
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return -1
+}
@@ -64,6 +64,28 @@ func TestArraySet(t *testing.T) {
 	f(`"foo,b\nar"`, []string{`foo,b` + "\n" + `ar`})
 	f(`"foo","bar",baz`, []string{`foo`, `bar`, `baz`})
 	f(`,fo,"\"b, a'\\",,r,`, []string{``, `fo`, `"b, a'\`, ``, `r`, ``})
+
+	// Commas inside curly braces are treated as delimiters.
+	f(`{foo="bar",baz="x"}:7d`, []string{`{foo="bar"`, `baz="x"}:7d`})
+}
+
+func TestArraySelectorSet(t *testing.T) {
+	f := func(s string, expectedValues []string) {
+		t.Helper()
+		var a ArraySelector
+		_ = a.Set(s)
+		if !reflect.DeepEqual([]string(a), expectedValues) {
+			t.Fatalf("unexpected values parsed;\ngot\n%q\nwant\n%q", a, expectedValues)
+		}
+	}
+	f("", nil)
+	f(`foo`, []string{`foo`})
+	f(`foo,b ar,baz`, []string{`foo`, `b ar`, `baz`})
+	f(`"foo,b\nar"`, []string{`foo,b` + "\n" + `ar`})
+	f(`{foo="bar"}:7d`, []string{`{foo="bar"}:7d`})
+	f(`{foo="bar",baz="x"}:7d,{a="b"}:1d`, []string{`{foo="bar",baz="x"}:7d`, `{a="b"}:1d`})
+	f(`{foo=~"a,}|b"}:7d,bar`, []string{`{foo=~"a,}|b"}:7d`, `bar`})
+	f(`foo},bar{,baz`, []string{`foo}`, `bar{,baz`})
 }
 
 func TestArrayGetOptionalArg(t *testing.T) {
@@ -35,7 +35,19 @@ func WriteFileAtomically(path string, data []byte) error {
 	if IsPathExist(path) {
 		return fmt.Errorf("cannot create file %q, since it already exists", path)
 	}
+	return writeFileAtomically(path, data)
+}
+
+// ReplaceFileAtomically atomically replaces the file at the given path with data.
+//
+// The file is created if it doesn't exist. The previous file contents remain available at the path
+// until the new contents are fully written and synced, so the file is never lost or truncated on unclean shutdown.
+// Hard links to the previous file, such as links from snapshots, keep pointing to the previous contents.
+func ReplaceFileAtomically(path string, data []byte) error {
+	return writeFileAtomically(path, data)
+}
 
+func writeFileAtomically(path string, data []byte) error {
 	n := atomic.AddUint64(&tmpFileNum, 1)
 	tmpPath := fmt.Sprintf("%s.tmp.%d", path, n)
 	f, err := filestream.Create(tmpPath, false)
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"io/ioutil"
 	"testing"
 )
 
@@ -37,3 +38,35 @@ func TestIsHTTPURLSuccess(t *testing.T) {
 	f("0/filepath", false)                   // something invalid
 	f("filepath.extension", false)           // something invalid
 }
+
+func TestReplaceFileAtomically(t *testing.T) {
+	path := "TestReplaceFileAtomically"
+	MustRemoveAll(path)
+	defer MustRemoveAll(path)
+
+	f := func(data string) {
+		t.Helper()
+		if err := ReplaceFileAtomically(path, []byte(data)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cannot read %q: %s", path, err)
+		}
+		if string(result) != data {
+			t.Fatalf("unexpected file contents; got %q; want %q", result, data)
+		}
+	}
+
+	// Create the missing file
+	f("foo")
+
+	// Replace the existing file
+	f("barbaz")
+	f("")
+
+	// WriteFileAtomically mustn't overwrite the existing file
+	if err := WriteFileAtomically(path, []byte("abc")); err == nil {
+		t.Fatalf("expecting non-nil error when overwriting the existing file")
+	}
+}
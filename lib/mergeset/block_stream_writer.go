@@ -1,6 +1,7 @@
 package mergeset
 
 import (
+	"bytes"
 	"fmt"
 	"path/filepath"
 	"sync"
@@ -8,6 +9,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/filestream"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 )
 
 type blockStreamWriter struct {
@@ -35,6 +37,17 @@ type blockStreamWriter struct {
 
 	// whether the first item for mr has been caught.
 	mrFirstItemCaught bool
+
+	// getItemPrefix is used for building bloom filter for item prefixes in file parts.
+	getItemPrefix ItemPrefixCallback
+
+	// prefixHashes contains hashes for unique item prefixes written to bsw.
+	prefixHashes []uint64
+	lastPrefix   []byte
+
+	// tooManyPrefixes is set if bsw contains more than maxBloomFilterItems unique item prefixes.
+	// The bloom filter isn't written to the part in this case.
+	tooManyPrefixes bool
 }
 
 func (bsw *blockStreamWriter) reset() {
@@ -61,6 +74,11 @@ func (bsw *blockStreamWriter) reset() {
 	bsw.indexBlockOffset = 0
 
 	bsw.mrFirstItemCaught = false
+
+	bsw.getItemPrefix = nil
+	bsw.prefixHashes = bsw.prefixHashes[:0]
+	bsw.lastPrefix = bsw.lastPrefix[:0]
+	bsw.tooManyPrefixes = false
 }
 
 func (bsw *blockStreamWriter) InitFromInmemoryPart(ip *inmemoryPart) {
@@ -79,7 +97,10 @@ func (bsw *blockStreamWriter) InitFromInmemoryPart(ip *inmemoryPart) {
 // InitFromFilePart initializes bsw from a file-based part on the given path.
 //
 // The bsw doesn't pollute OS page cache if nocache is set.
-func (bsw *blockStreamWriter) InitFromFilePart(path string, nocache bool, compressLevel int) error {
+//
+// The bloom filter for item prefixes is written to the part if getItemPrefix isn't nil
+// and the part contains up to maxBloomFilterItems unique item prefixes.
+func (bsw *blockStreamWriter) InitFromFilePart(path string, nocache bool, compressLevel int, getItemPrefix ItemPrefixCallback) error {
 	path = filepath.Clean(path)
 
 	// Create the directory
@@ -134,6 +155,8 @@ func (bsw *blockStreamWriter) InitFromFilePart(path string, nocache bool, compre
 	bsw.itemsWriter = itemsFile
 	bsw.lensWriter = lensFile
 
+	bsw.getItemPrefix = getItemPrefix
+
 	return nil
 }
 
@@ -154,6 +177,14 @@ func (bsw *blockStreamWriter) MustClose() {
 	bsw.itemsWriter.MustClose()
 	bsw.lensWriter.MustClose()
 
+	if bsw.getItemPrefix != nil && !bsw.tooManyPrefixes {
+		bf := newBloomFilter(bsw.prefixHashes)
+		bloomPath := bsw.path + "/" + bloomFilterFilename
+		if err := fs.WriteFileAtomically(bloomPath, bf.Marshal(nil)); err != nil {
+			logger.Panicf("FATAL: cannot write bloom filter: %s", err)
+		}
+	}
+
 	// Sync bsw.path contents to make sure it doesn't disappear
 	// after system crash or power loss.
 	if bsw.path != "" {
@@ -167,6 +198,9 @@ func (bsw *blockStreamWriter) MustClose() {
 //
 // ib must be sorted.
 func (bsw *blockStreamWriter) WriteBlock(ib *inmemoryBlock) {
+	if bsw.getItemPrefix != nil && !bsw.tooManyPrefixes {
+		bsw.addPrefixHashes(ib)
+	}
 	bsw.bh.firstItem, bsw.bh.commonPrefix, bsw.bh.itemsCount, bsw.bh.marshalType = ib.MarshalSortedData(&bsw.sb, bsw.bh.firstItem[:0], bsw.bh.commonPrefix[:0], bsw.compressLevel)
 
 	if !bsw.mrFirstItemCaught {
@@ -195,6 +229,27 @@ func (bsw *blockStreamWriter) WriteBlock(ib *inmemoryBlock) {
 	}
 }
 
+// addPrefixHashes registers item prefixes from ib in bsw.prefixHashes.
+//
+// It stops registering item prefixes and frees bsw.prefixHashes if bsw contains more than maxBloomFilterItems unique prefixes.
+func (bsw *blockStreamWriter) addPrefixHashes(ib *inmemoryBlock) {
+	data := ib.data
+	for _, it := range ib.items {
+		prefix := bsw.getItemPrefix(it.Bytes(data))
+		if len(prefix) == 0 || bytes.Equal(prefix, bsw.lastPrefix) {
+			// Items are sorted, so items with the same prefix are adjacent.
+			continue
+		}
+		if len(bsw.prefixHashes) >= maxBloomFilterItems {
+			bsw.tooManyPrefixes = true
+			bsw.prefixHashes = nil
+			return
+		}
+		bsw.prefixHashes = append(bsw.prefixHashes, getBloomFilterHash(prefix))
+		bsw.lastPrefix = append(bsw.lastPrefix[:0], prefix...)
+	}
+}
+
 // The maximum size of index block with multiple blockHeaders.
 const maxIndexBlockSize = 64 * 1024
 
@@ -0,0 +1,118 @@
+package mergeset
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/cespare/xxhash/v2"
+)
+
+// ItemPrefixCallback must return the prefix of the given item, which is registered in per-part bloom filters.
+//
+// The returned prefix must be determined only by the leading bytes of the item,
+// i.e. the callback must return the same prefix for all the items starting with the returned prefix.
+// The callback must return nil if the item has no such prefix.
+//
+// Parts without items with the given prefix are skipped by TableSearch.SeekPrefix.
+type ItemPrefixCallback func(item []byte) []byte
+
+// bloomFilterFilename is the name of file with bloom filter for item prefixes in file parts.
+//
+// Parts without this file have no bloom filter.
+const bloomFilterFilename = "bloom.bin"
+
+const bloomFilterHashesCount = 4
+const bloomFilterBitsPerItem = 16
+
+// maxBloomFilterItems is the maximum number of unique item prefixes in the bloom filter for a part.
+//
+// Parts with more unique item prefixes have no bloom filter. This limits the memory needed
+// for collecting prefix hashes during the merge to 8MB and the memory for the loaded bloom filter to 2MB per part.
+// Such parts usually contain the majority of prefixes, so the bloom filter wouldn't help skipping them anyway.
+var maxBloomFilterItems = 1 << 20
+
+// bloomFilter is an immutable bloom filter for item prefixes stored in the part.
+type bloomFilter struct {
+	bits []uint64
+}
+
+// newBloomFilter creates a bloom filter for the given hashes returned from getBloomFilterHash.
+func newBloomFilter(hashes []uint64) *bloomFilter {
+	bitsCount := len(hashes) * bloomFilterBitsPerItem
+	if bitsCount < 64 {
+		bitsCount = 64
+	}
+	bf := &bloomFilter{
+		bits: make([]uint64, (bitsCount+63)/64),
+	}
+	for _, h := range hashes {
+		bf.add(h)
+	}
+	return bf
+}
+
+func getBloomFilterHash(prefix []byte) uint64 {
+	return xxhash.Sum64(prefix)
+}
+
+func (bf *bloomFilter) add(h uint64) {
+	bits := bf.bits
+	maxBits := uint64(len(bits)) * 64
+	for i := 0; i < bloomFilterHashesCount; i++ {
+		idx := bloomFilterBitIndex(h, i) % maxBits
+		bits[idx/64] |= uint64(1) << (idx % 64)
+	}
+}
+
+// Has returns false if bf has no the given h.
+//
+// It may return true for missing h with low probability.
+func (bf *bloomFilter) Has(h uint64) bool {
+	bits := bf.bits
+	maxBits := uint64(len(bits)) * 64
+	for i := 0; i < bloomFilterHashesCount; i++ {
+		idx := bloomFilterBitIndex(h, i) % maxBits
+		if bits[idx/64]&(uint64(1)<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomFilterBitIndex(h uint64, i int) uint64 {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], h+uint64(i))
+	return xxhash.Sum64(b[:])
+}
+
+// Marshal appends marshaled bf to dst and returns the result.
+func (bf *bloomFilter) Marshal(dst []byte) []byte {
+	dst = encoding.MarshalVarUint64(dst, uint64(len(bf.bits)))
+	for _, w := range bf.bits {
+		dst = encoding.MarshalUint64(dst, w)
+	}
+	return dst
+}
+
+// Unmarshal unmarshals bf from src.
+func (bf *bloomFilter) Unmarshal(src []byte) error {
+	tail, n, err := encoding.UnmarshalVarUint64(src)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal bloom filter size: %w", err)
+	}
+	if n == 0 || uint64(len(tail)) != n*8 {
+		return fmt.Errorf("unexpected bloom filter data size; got %d bytes; want %d bytes", len(tail), n*8)
+	}
+	bits := make([]uint64, n)
+	for i := range bits {
+		bits[i] = encoding.UnmarshalUint64(tail)
+		tail = tail[8:]
+	}
+	bf.bits = bits
+	return nil
+}
+
+func (bf *bloomFilter) SizeBytes() int {
+	return len(bf.bits) * 8
+}
@@ -0,0 +1,107 @@
+package mergeset
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestBloomFilter(t *testing.T) {
+	f := func(itemsCount int) {
+		t.Helper()
+		var hashes []uint64
+		for i := 0; i < itemsCount; i++ {
+			hashes = append(hashes, getBloomFilterHash([]byte(fmt.Sprintf("item_%d", i))))
+		}
+		bf := newBloomFilter(hashes)
+		data := bf.Marshal(nil)
+		var bf2 bloomFilter
+		if err := bf2.Unmarshal(data); err != nil {
+			t.Fatalf("cannot unmarshal bloom filter: %s", err)
+		}
+		for _, b := range []*bloomFilter{bf, &bf2} {
+			for i, h := range hashes {
+				if !b.Has(h) {
+					t.Fatalf("missing item #%d in bloom filter", i)
+				}
+			}
+			falsePositives := 0
+			for i := 0; i < itemsCount; i++ {
+				if b.Has(getBloomFilterHash([]byte(fmt.Sprintf("missing_item_%d", i)))) {
+					falsePositives++
+				}
+			}
+			if p := float64(falsePositives) / float64(itemsCount); p > 0.01 {
+				t.Fatalf("too high false positive rate for %d items: %.4f", itemsCount, p)
+			}
+		}
+	}
+	f(1)
+	f(10)
+	f(1000)
+	f(100000)
+}
+
+func TestBloomFilterUnmarshalError(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+		var bf bloomFilter
+		if err := bf.Unmarshal(data); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling %X", data)
+		}
+	}
+	f(nil)
+	f([]byte{0})
+	f([]byte{1, 2, 3})
+	f([]byte{2, 1, 2, 3, 4, 5, 6, 7, 8})
+}
+
+func TestBlockStreamWriterBloomFilterMaxItems(t *testing.T) {
+	const path = "TestBlockStreamWriterBloomFilterMaxItems"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	origMaxBloomFilterItems := maxBloomFilterItems
+	maxBloomFilterItems = 100
+	defer func() {
+		maxBloomFilterItems = origMaxBloomFilterItems
+	}()
+
+	getItemPrefix := func(item []byte) []byte {
+		n := bytes.IndexByte(item, ':')
+		if n < 0 {
+			return nil
+		}
+		return item[:n+1]
+	}
+	f := func(prefixesCount int, bloomFilterExpected bool) {
+		t.Helper()
+		var ib inmemoryBlock
+		for i := 0; i < prefixesCount; i++ {
+			for j := 0; j < 3; j++ {
+				if !ib.Add([]byte(fmt.Sprintf("key_%05d:%d", i, j))) {
+					t.Fatalf("cannot add item to inmemoryBlock")
+				}
+			}
+		}
+		var bsw blockStreamWriter
+		if err := bsw.InitFromFilePart(path, false, 0, getItemPrefix); err != nil {
+			t.Fatalf("cannot create part: %s", err)
+		}
+		bsw.WriteBlock(&ib)
+		bsw.MustClose()
+		if fs.IsPathExist(path+"/"+bloomFilterFilename) != bloomFilterExpected {
+			t.Fatalf("unexpected bloom filter presence for %d prefixes; want %v", prefixesCount, bloomFilterExpected)
+		}
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}
+	f(10, true)
+	f(100, true)
+	f(101, false)
+}
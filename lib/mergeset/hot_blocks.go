@@ -0,0 +1,275 @@
+package mergeset
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/blockcache"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+// The types of caches for hot blocks.
+const (
+	// hotBlockTypeIndex is the type for blocks from idxbCache.
+	hotBlockTypeIndex = 0
+
+	// hotBlockTypeItems is the type for blocks from ibCache.
+	hotBlockTypeItems = 1
+)
+
+const hotBlocksFileVersion = 1
+
+// HotBlocks contains keys for the most recently accessed blocks saved by SaveHotBlocks.
+//
+// Call LoadHotBlocks for loading HotBlocks and Table.PrewarmHotBlocks for reading the blocks into caches.
+type HotBlocks struct {
+	// m contains hot blocks per part path.
+	//
+	// Index blocks go before items blocks, since they are needed for locating items blocks.
+	m map[string][]hotBlock
+}
+
+type hotBlock struct {
+	blockType byte
+	offset    uint64
+}
+
+// Len returns the number of hot blocks in hb.
+func (hb *HotBlocks) Len() int {
+	n := 0
+	for _, hbs := range hb.m {
+		n += len(hbs)
+	}
+	return n
+}
+
+// SaveHotBlocks saves keys for up to maxBlocks the most recently accessed index blocks and up to maxBlocks
+// the most recently accessed items blocks for all the file parts to the file at the given path.
+//
+// It returns the number of saved keys.
+func SaveHotBlocks(path string, maxBlocks int) (int, error) {
+	hb := &HotBlocks{
+		m: make(map[string][]hotBlock),
+	}
+	addKeys := func(keys []blockcache.Key, blockType byte) {
+		for _, k := range keys {
+			p := k.Part.(*part)
+			if p.path == "" {
+				// Skip in-memory parts, since they don't survive restarts.
+				continue
+			}
+			hb.m[p.path] = append(hb.m[p.path], hotBlock{
+				blockType: blockType,
+				offset:    k.Offset,
+			})
+		}
+	}
+	addKeys(idxbCache.HotKeys(maxBlocks), hotBlockTypeIndex)
+	addKeys(ibCache.HotKeys(maxBlocks), hotBlockTypeItems)
+
+	// The file must be atomically replaced, so it isn't lost on unclean shutdown.
+	if err := fs.ReplaceFileAtomically(path, hb.marshal(nil)); err != nil {
+		return 0, err
+	}
+	return hb.Len(), nil
+}
+
+// LoadHotBlocks loads hot blocks saved by SaveHotBlocks from the file at the given path.
+//
+// Empty HotBlocks is returned if the file is missing.
+func LoadHotBlocks(path string) (*HotBlocks, error) {
+	hb := &HotBlocks{
+		m: make(map[string][]hotBlock),
+	}
+	if !fs.IsPathExist(path) {
+		return hb, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read hot blocks: %w", err)
+	}
+	if err := hb.unmarshal(data); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal hot blocks from %q: %w", path, err)
+	}
+	return hb, nil
+}
+
+func (hb *HotBlocks) marshal(dst []byte) []byte {
+	dst = encoding.MarshalUint64(dst, hotBlocksFileVersion)
+	dst = encoding.MarshalVarUint64(dst, uint64(len(hb.m)))
+	for partPath, hbs := range hb.m {
+		dst = encoding.MarshalBytes(dst, []byte(partPath))
+		dst = encoding.MarshalVarUint64(dst, uint64(len(hbs)))
+		for _, b := range hbs {
+			dst = append(dst, b.blockType)
+			dst = encoding.MarshalVarUint64(dst, b.offset)
+		}
+	}
+	return dst
+}
+
+func (hb *HotBlocks) unmarshal(src []byte) error {
+	if len(src) < 8 {
+		return fmt.Errorf("too short data; got %d bytes; want at least 8 bytes", len(src))
+	}
+	version := encoding.UnmarshalUint64(src)
+	if version != hotBlocksFileVersion {
+		return fmt.Errorf("unsupported version; got %d; want %d", version, hotBlocksFileVersion)
+	}
+	tail, partsCount, err := encoding.UnmarshalVarUint64(src[8:])
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal parts count: %w", err)
+	}
+	src = tail
+	m := make(map[string][]hotBlock, partsCount)
+	for i := uint64(0); i < partsCount; i++ {
+		tail, partPath, err := encoding.UnmarshalBytes(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal part path: %w", err)
+		}
+		tail, blocksCount, err := encoding.UnmarshalVarUint64(tail)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal blocks count for part %q: %w", partPath, err)
+		}
+		var hbs []hotBlock
+		for j := uint64(0); j < blocksCount; j++ {
+			if len(tail) < 1 {
+				return fmt.Errorf("missing block type for part %q", partPath)
+			}
+			blockType := tail[0]
+			if blockType != hotBlockTypeIndex && blockType != hotBlockTypeItems {
+				return fmt.Errorf("unexpected block type for part %q: %d", partPath, blockType)
+			}
+			var offset uint64
+			tail, offset, err = encoding.UnmarshalVarUint64(tail[1:])
+			if err != nil {
+				return fmt.Errorf("cannot unmarshal block offset for part %q: %w", partPath, err)
+			}
+			hbs = append(hbs, hotBlock{
+				blockType: blockType,
+				offset:    offset,
+			})
+		}
+		sort.SliceStable(hbs, func(i, j int) bool {
+			return hbs[i].blockType < hbs[j].blockType
+		})
+		m[string(partPath)] = hbs
+		src = tail
+	}
+	if len(src) > 0 {
+		return fmt.Errorf("unexpected non-empty tail left after unmarshaling hot blocks; len(tail)=%d", len(src))
+	}
+	hb.m = m
+	return nil
+}
+
+// PrewarmHotBlocks reads hot blocks from hb for tb parts into caches.
+//
+// It stops when the caches are full or when stopCh is closed.
+// It returns the number of read blocks.
+func (tb *Table) PrewarmHotBlocks(hb *HotBlocks, stopCh <-chan struct{}) (int, error) {
+	pws := tb.getParts(nil)
+	defer tb.putParts(pws)
+
+	blocksRead := 0
+	var ps partSearch
+	for _, pw := range pws {
+		hbs := hb.m[pw.p.path]
+		if len(hbs) == 0 {
+			continue
+		}
+		ps.Init(pw.p)
+		for i := range hbs {
+			select {
+			case <-stopCh:
+				return blocksRead, nil
+			default:
+			}
+			b := &hbs[i]
+			c := idxbCache
+			if b.blockType == hotBlockTypeItems {
+				c = ibCache
+			}
+			if c.SizeBytes() >= c.SizeMaxBytes() {
+				continue
+			}
+			ok, err := ps.prewarmBlock(b)
+			if err != nil {
+				return blocksRead, fmt.Errorf("cannot prewarm block at offset %d for part %q: %w", b.offset, pw.p.path, err)
+			}
+			if ok {
+				blocksRead++
+			}
+		}
+	}
+	return blocksRead, nil
+}
+
+// prewarmBlock reads the given hot block b from ps.p into cache.
+//
+// It returns false if ps.p doesn't contain the block.
+func (ps *partSearch) prewarmBlock(b *hotBlock) (bool, error) {
+	mrs := ps.p.mrs
+	if b.blockType == hotBlockTypeIndex {
+		// Index blocks are written in the order of metaindex rows, so their offsets are sorted.
+		n := sort.Search(len(mrs), func(i int) bool {
+			return mrs[i].indexBlockOffset >= b.offset
+		})
+		if n >= len(mrs) || mrs[n].indexBlockOffset != b.offset {
+			return false, nil
+		}
+		idxb, err := ps.readIndexBlock(&mrs[n])
+		if err != nil {
+			return false, err
+		}
+		idxbKey := blockcache.Key{
+			Part:   ps.p,
+			Offset: b.offset,
+		}
+		idxbCache.PutBlock(idxbKey, idxb)
+		return true, nil
+	}
+
+	// Items blocks are written in the order of block headers in index blocks, so their offsets are sorted.
+	// Locate the index block with the given items block at first.
+	var firstErr error
+	n := sort.Search(len(mrs), func(i int) bool {
+		idxb, err := ps.getIndexBlock(&mrs[i])
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return true
+		}
+		return len(idxb.bhs) > 0 && idxb.bhs[0].itemsBlockOffset > b.offset
+	})
+	if firstErr != nil {
+		return false, firstErr
+	}
+	if n == 0 {
+		return false, nil
+	}
+	idxb, err := ps.getIndexBlock(&mrs[n-1])
+	if err != nil {
+		return false, err
+	}
+	bhs := idxb.bhs
+	n = sort.Search(len(bhs), func(i int) bool {
+		return bhs[i].itemsBlockOffset >= b.offset
+	})
+	if n >= len(bhs) || bhs[n].itemsBlockOffset != b.offset {
+		return false, nil
+	}
+	ib, err := ps.readInmemoryBlock(&bhs[n])
+	if err != nil {
+		return false, err
+	}
+	ibKey := blockcache.Key{
+		Part:   ps.p,
+		Offset: b.offset,
+	}
+	ibCache.PutBlock(ibKey, ib)
+	return true, nil
+}
@@ -0,0 +1,121 @@
+package mergeset
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestHotBlocksMarshalUnmarshal(t *testing.T) {
+	hb := &HotBlocks{
+		m: map[string][]hotBlock{
+			"foo": {
+				{blockType: hotBlockTypeIndex, offset: 123},
+				{blockType: hotBlockTypeItems, offset: 0},
+				{blockType: hotBlockTypeItems, offset: 456},
+			},
+			"bar": {
+				{blockType: hotBlockTypeIndex, offset: 1},
+			},
+		},
+	}
+	data := hb.marshal(nil)
+	var hb2 HotBlocks
+	if err := hb2.unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal hot blocks: %s", err)
+	}
+	if !reflect.DeepEqual(hb2.m, hb.m) {
+		t.Fatalf("unexpected unmarshaled hot blocks;\ngot\n%+v\nwant\n%+v", hb2.m, hb.m)
+	}
+	if n := hb2.Len(); n != 4 {
+		t.Fatalf("unexpected number of hot blocks; got %d; want 4", n)
+	}
+
+	// Corrupted data must result in error.
+	f := func(data []byte) {
+		t.Helper()
+		var hb HotBlocks
+		if err := hb.unmarshal(data); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling %q", data)
+		}
+	}
+	f(nil)
+	f(data[:7])
+	f(data[:len(data)-1])
+	f(append(data, 1))
+}
+
+func TestTablePrewarmHotBlocks(t *testing.T) {
+	const path = "TestTablePrewarmHotBlocks"
+	const hotBlocksPath = path + "-hot-blocks"
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(path)
+		_ = os.RemoveAll(hotBlocksPath)
+	}()
+
+	tb, items, err := newTestTable(path, 1e5)
+	if err != nil {
+		t.Fatalf("cannot create test table: %s", err)
+	}
+	// Search the table multiple times, so the accessed blocks are put into caches.
+	for i := 0; i < 2; i++ {
+		if err := testTableSearchSerial(tb, items); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	blocksSaved, err := SaveHotBlocks(hotBlocksPath, 1e6)
+	if err != nil {
+		t.Fatalf("cannot save hot blocks: %s", err)
+	}
+	if blocksSaved == 0 {
+		t.Fatalf("expecting non-zero hot blocks")
+	}
+	// The file must be overwritten on subsequent saves.
+	if _, err := SaveHotBlocks(hotBlocksPath, 1e6); err != nil {
+		t.Fatalf("cannot save hot blocks for the second time: %s", err)
+	}
+	tb.MustClose()
+
+	// Blocks for the closed table must be removed from caches.
+	if n := idxbCache.Len() + ibCache.Len(); n != 0 {
+		t.Fatalf("unexpected number of cached blocks after closing the table; got %d; want 0", n)
+	}
+
+	hb, err := LoadHotBlocks(hotBlocksPath)
+	if err != nil {
+		t.Fatalf("cannot load hot blocks: %s", err)
+	}
+	if n := hb.Len(); n != blocksSaved {
+		t.Fatalf("unexpected number of loaded hot blocks; got %d; want %d", n, blocksSaved)
+	}
+	tb, err = OpenTable(path, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot open table: %s", err)
+	}
+	blocksRead, err := tb.PrewarmHotBlocks(hb, nil)
+	if err != nil {
+		t.Fatalf("cannot prewarm hot blocks: %s", err)
+	}
+	if blocksRead != blocksSaved {
+		t.Fatalf("unexpected number of prewarmed blocks; got %d; want %d", blocksRead, blocksSaved)
+	}
+	if n := idxbCache.Len() + ibCache.Len(); n < blocksSaved {
+		t.Fatalf("unexpected number of cached blocks after prewarm; got %d; want at least %d", n, blocksSaved)
+	}
+	if err := testTableSearchSerial(tb, items); err != nil {
+		t.Fatalf("unexpected error after prewarm: %s", err)
+	}
+	tb.MustClose()
+
+	// Missing file must result in empty hot blocks.
+	hb, err = LoadHotBlocks(hotBlocksPath + "-missing")
+	if err != nil {
+		t.Fatalf("unexpected error when loading missing hot blocks: %s", err)
+	}
+	if n := hb.Len(); n != 0 {
+		t.Fatalf("unexpected number of hot blocks loaded from missing file; got %d; want 0", n)
+	}
+}
@@ -2,6 +2,7 @@ package mergeset
 
 import (
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
 	"sync"
 	"unsafe"
@@ -62,6 +63,11 @@ type part struct {
 
 	mrs []metaindexRow
 
+	// bloom contains bloom filter for item prefixes in the part.
+	//
+	// It is nil if the part has no bloom filter.
+	bloom *bloomFilter
+
 	indexFile fs.MustReadAtCloser
 	itemsFile fs.MustReadAtCloser
 	lensFile  fs.MustReadAtCloser
@@ -95,7 +101,36 @@ func openFilePart(path string) (*part, error) {
 	lensSize := fs.MustFileSize(lensPath)
 
 	size := metaindexSize + indexSize + itemsSize + lensSize
-	return newPart(&ph, path, size, metaindexFile, indexFile, itemsFile, lensFile)
+	p, err := newPart(&ph, path, size, metaindexFile, indexFile, itemsFile, lensFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parts created before bloom filters were introduced have no bloom.bin file.
+	bloomPath := path + "/" + bloomFilterFilename
+	if fs.IsPathExist(bloomPath) {
+		data, err := ioutil.ReadFile(bloomPath)
+		if err != nil {
+			p.MustClose()
+			return nil, fmt.Errorf("cannot read %q: %w", bloomPath, err)
+		}
+		var bf bloomFilter
+		if err := bf.Unmarshal(data); err != nil {
+			p.MustClose()
+			return nil, fmt.Errorf("cannot unmarshal bloom filter from %q: %w", bloomPath, err)
+		}
+		p.bloom = &bf
+		p.size += uint64(len(data))
+	}
+	return p, nil
+}
+
+// mayContainPrefix returns false if p has no items with the prefix for the given prefixHash.
+func (p *part) mayContainPrefix(prefixHash uint64) bool {
+	if p.bloom == nil {
+		return true
+	}
+	return p.bloom.Has(prefixHash)
 }
 
 func newPart(ph *partHeader, path string, size uint64, metaindexReader filestream.ReadCloser, indexFile, itemsFile, lensFile fs.MustReadAtCloser) (*part, error) {
@@ -63,6 +63,24 @@ func (ps *partSearch) Init(p *part) {
 	ps.p = p
 }
 
+// SeekPrefix seeks for the first item greater or equal to prefix in ps.
+//
+// It is equivalent to Seek except of ps is positioned at the end of the part
+// if the part bloom filter has no prefixHash, i.e. the part has no items with the given prefix.
+// So NextItem may skip items without the given prefix after SeekPrefix call.
+func (ps *partSearch) SeekPrefix(prefix []byte, prefixHash uint64) {
+	if err := ps.Error(); err != nil {
+		// Do nothing on unrecoverable error.
+		return
+	}
+	if !ps.p.mayContainPrefix(prefixHash) {
+		// The part has no items with the given prefix.
+		ps.err = io.EOF
+		return
+	}
+	ps.Seek(prefix)
+}
+
 // Seek seeks for the first item greater or equal to k in ps.
 func (ps *partSearch) Seek(k []byte) {
 	if err := ps.Error(); err != nil {
@@ -255,6 +273,15 @@ func (ps *partSearch) nextBHS() error {
 	}
 	mr := &ps.mrs[0]
 	ps.mrs = ps.mrs[1:]
+	idxb, err := ps.getIndexBlock(mr)
+	if err != nil {
+		return err
+	}
+	ps.bhs = idxb.bhs
+	return nil
+}
+
+func (ps *partSearch) getIndexBlock(mr *metaindexRow) (*indexBlock, error) {
 	idxbKey := blockcache.Key{
 		Part:   ps.p,
 		Offset: mr.indexBlockOffset,
@@ -263,14 +290,13 @@ func (ps *partSearch) nextBHS() error {
 	if b == nil {
 		idxb, err := ps.readIndexBlock(mr)
 		if err != nil {
-			return fmt.Errorf("cannot read index block: %w", err)
+			return nil, fmt.Errorf("cannot read index block: %w", err)
 		}
 		b = idxb
 		idxbCache.PutBlock(idxbKey, b)
 	}
 	idxb := b.(*indexBlock)
-	ps.bhs = idxb.bhs
-	return nil
+	return idxb, nil
 }
 
 func (ps *partSearch) readIndexBlock(mr *metaindexRow) (*indexBlock, error) {
@@ -90,6 +90,8 @@ type Table struct {
 
 	prepareBlock PrepareBlockCallback
 
+	getItemPrefix ItemPrefixCallback
+
 	partsLock sync.Mutex
 	parts     []*partWrapper
 
@@ -100,6 +102,9 @@ type Table struct {
 
 	snapshotLock sync.RWMutex
 
+	// isReadOnly is set for tables opened via OpenTableReadOnly.
+	isReadOnly bool
+
 	flockF *os.File
 
 	stopCh chan struct{}
@@ -242,8 +247,11 @@ func (pw *partWrapper) decRef() {
 // Optional prepareBlock is called during merge before flushing the prepared block
 // to persistent storage.
 //
+// Optional getItemPrefix is used for building per-part bloom filters for item prefixes.
+// See TableSearch.SeekPrefix for details.
+//
 // The table is created if it doesn't exist yet.
-func OpenTable(path string, flushCallback func(), prepareBlock PrepareBlockCallback) (*Table, error) {
+func OpenTable(path string, flushCallback func(), prepareBlock PrepareBlockCallback, getItemPrefix ItemPrefixCallback) (*Table, error) {
 	path = filepath.Clean(path)
 	logger.Infof("opening table %q...", path)
 	startTime := time.Now()
@@ -269,6 +277,7 @@ func OpenTable(path string, flushCallback func(), prepareBlock PrepareBlockCallb
 		path:          path,
 		flushCallback: flushCallback,
 		prepareBlock:  prepareBlock,
+		getItemPrefix: getItemPrefix,
 		parts:         pws,
 		mergeIdx:      uint64(time.Now().UnixNano()),
 		flockF:        flockF,
@@ -313,10 +322,110 @@ func OpenTable(path string, flushCallback func(), prepareBlock PrepareBlockCallb
 	return tb, nil
 }
 
+// ErrReadOnly is returned when trying to modify a table opened via OpenTableReadOnly.
+var ErrReadOnly = errors.New("the table is opened in read-only mode")
+
+// OpenTableReadOnly opens an existing table on the given path in read-only mode.
+//
+// The table may be owned by another process, which opened it via OpenTable.
+// The returned table doesn't run background merges and doesn't modify files at the given path.
+// Parts created by the owner of the table become visible to search after RefreshParts call.
+//
+// Optional flushCallback is called every time RefreshParts detects changes in the list of parts.
+//
+// Optional getItemPrefix must match the callback passed to OpenTable by the owner of the table.
+// It is used for skipping parts via per-part bloom filters during search.
+func OpenTableReadOnly(path string, flushCallback func(), getItemPrefix ItemPrefixCallback) (*Table, error) {
+	path = filepath.Clean(path)
+	logger.Infof("opening table %q in read-only mode...", path)
+	startTime := time.Now()
+
+	pws, err := openPartsReadOnlyWithRetries(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open table parts at %q: %w", path, err)
+	}
+
+	tb := &Table{
+		path:          path,
+		flushCallback: flushCallback,
+		getItemPrefix: getItemPrefix,
+		parts:         pws,
+		isReadOnly:    true,
+		stopCh:        make(chan struct{}),
+	}
+	tb.rawItems.init()
+
+	var m TableMetrics
+	tb.UpdateMetrics(&m)
+	logger.Infof("table %q has been opened in read-only mode in %.3f seconds; partsCount: %d; blocksCount: %d, itemsCount: %d; sizeBytes: %d",
+		path, time.Since(startTime).Seconds(), m.PartsCount, m.BlocksCount, m.ItemsCount, m.SizeBytes)
+	return tb, nil
+}
+
+// RefreshParts updates the list of parts for the table opened via OpenTableReadOnly.
+//
+// It picks up parts created and drops parts removed by the owner of the table since the previous call.
+// The list of parts remains unchanged if the table has unfinished transactions,
+// since it may be inconsistent in this case. The next call will pick up the changes.
+func (tb *Table) RefreshParts() error {
+	if !tb.isReadOnly {
+		logger.Panicf("BUG: RefreshParts may be called only for tables opened via OpenTableReadOnly")
+	}
+
+	// tb.parts may be modified only by RefreshParts for read-only table,
+	// so there is no need in holding the lock while opening new parts.
+	tb.partsLock.Lock()
+	oldPws := tb.parts
+	tb.partsLock.Unlock()
+
+	existing := make(map[string]*partWrapper, len(oldPws))
+	for _, pw := range oldPws {
+		existing[pw.p.path] = pw
+	}
+	pws, err := openPartsReadOnly(tb.path, existing, false)
+	if err != nil {
+		if errors.Is(err, errPendingTransactions) {
+			return nil
+		}
+		return fmt.Errorf("cannot refresh parts at %q: %w", tb.path, err)
+	}
+	isChanged := len(pws) != len(oldPws)
+	for _, pw := range pws {
+		if existing[pw.p.path] == nil {
+			isChanged = true
+		}
+	}
+
+	tb.partsLock.Lock()
+	tb.parts = pws
+	tb.partsLock.Unlock()
+
+	for _, pw := range oldPws {
+		pw.decRef()
+	}
+	if isChanged && tb.flushCallback != nil {
+		tb.flushCallback()
+	}
+	return nil
+}
+
 // MustClose closes the table.
 func (tb *Table) MustClose() {
 	close(tb.stopCh)
 
+	if tb.isReadOnly {
+		// Read-only table has no background workers and no inmemory parts.
+		tb.partsLock.Lock()
+		parts := tb.parts
+		tb.parts = nil
+		tb.partsLock.Unlock()
+
+		for _, pw := range parts {
+			pw.decRef()
+		}
+		return
+	}
+
 	logger.Infof("waiting for raw items flusher to stop on %q...", tb.path)
 	startTime := time.Now()
 	tb.rawItemsFlusherWG.Wait()
@@ -400,6 +509,9 @@ type TableMetrics struct {
 	ItemsCount  uint64
 	SizeBytes   uint64
 
+	// BloomFiltersSizeBytes is the memory occupied by per-part bloom filters for item prefixes.
+	BloomFiltersSizeBytes uint64
+
 	DataBlocksCacheSize         uint64
 	DataBlocksCacheSizeBytes    uint64
 	DataBlocksCacheSizeMaxBytes uint64
@@ -432,6 +544,9 @@ func (tb *Table) UpdateMetrics(m *TableMetrics) {
 		m.BlocksCount += p.ph.blocksCount
 		m.ItemsCount += p.ph.itemsCount
 		m.SizeBytes += p.size
+		if p.bloom != nil {
+			m.BloomFiltersSizeBytes += uint64(p.bloom.SizeBytes())
+		}
 
 		m.PartsRefCount += atomic.LoadUint64(&pw.refCount)
 	}
@@ -452,6 +567,9 @@ func (tb *Table) UpdateMetrics(m *TableMetrics) {
 
 // AddItems adds the given items to the tb.
 func (tb *Table) AddItems(items [][]byte) error {
+	if tb.isReadOnly {
+		return fmt.Errorf("cannot insert data into %q: %w", tb.path, ErrReadOnly)
+	}
 	if err := tb.rawItems.addItems(tb, items); err != nil {
 		return fmt.Errorf("cannot insert data into %q: %w", tb.path, err)
 	}
@@ -583,6 +701,9 @@ func (tb *Table) mergePartsOptimal(pws []*partWrapper, stopCh <-chan struct{}) e
 //
 // This function is only for debugging and testing.
 func (tb *Table) DebugFlush() {
+	if tb.isReadOnly {
+		return
+	}
 	tb.flushRawItems(true)
 
 	// Wait for background flushers to finish.
@@ -909,7 +1030,7 @@ func (tb *Table) mergeParts(pws []*partWrapper, stopCh <-chan struct{}, isOuterP
 	tmpPartPath := fmt.Sprintf("%s/tmp/%016X", tb.path, mergeIdx)
 	bsw := getBlockStreamWriter()
 	compressLevel := getCompressLevelForPartItems(outItemsCount, outBlocksCount)
-	if err := bsw.InitFromFilePart(tmpPartPath, nocache, compressLevel); err != nil {
+	if err := bsw.InitFromFilePart(tmpPartPath, nocache, compressLevel, tb.getItemPrefix); err != nil {
 		return fmt.Errorf("cannot create destination part %q: %w", tmpPartPath, err)
 	}
 
@@ -1114,6 +1235,110 @@ func mustCloseParts(pws []*partWrapper) {
 	}
 }
 
+// errPendingTransactions is returned from openPartsReadOnly if the table has unfinished transactions.
+var errPendingTransactions = errors.New("the table has pending transactions")
+
+// openPartsReadOnlyWithRetries opens parts at the given path without modifying it.
+//
+// It waits for a while until pending transactions are finished by the owner of the table.
+// Parts are opened regardless of pending transactions if they aren't finished in time,
+// since they may be left after unclean shutdown of the owner. The next RefreshParts call fixes the list of parts then.
+func openPartsReadOnlyWithRetries(path string) ([]*partWrapper, error) {
+	for i := 0; i < 10; i++ {
+		pws, err := openPartsReadOnly(path, nil, false)
+		if !errors.Is(err, errPendingTransactions) {
+			return pws, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	logger.Warnf("opening parts at %q with pending transactions; the list of parts may be inconsistent until the transactions are finished", path)
+	return openPartsReadOnly(path, nil, true)
+}
+
+// openPartsReadOnly opens parts at the given path without modifying it.
+//
+// Parts from existing are re-used instead of opening them again. Their refCount is incremented.
+// errPendingTransactions is returned if the table has unfinished transactions unless ignorePendingTransactions is set.
+func openPartsReadOnly(path string, existing map[string]*partWrapper, ignorePendingTransactions bool) ([]*partWrapper, error) {
+	if !ignorePendingTransactions {
+		if err := checkPendingTransactions(path); err != nil {
+			return nil, err
+		}
+	}
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory: %w", err)
+	}
+	var pws []*partWrapper
+	putPws := func() {
+		for _, pw := range pws {
+			pw.decRef()
+		}
+	}
+	for _, fi := range fis {
+		if !fs.IsDirOrSymlink(fi) {
+			// Skip non-directories.
+			continue
+		}
+		fn := fi.Name()
+		if isSpecialDir(fn) {
+			// Skip special dirs.
+			continue
+		}
+		partPath := path + "/" + fn
+		if pw := existing[partPath]; pw != nil {
+			pw.incRef()
+			pws = append(pws, pw)
+			continue
+		}
+		if fs.IsEmptyDir(partPath) {
+			// The directory may be left after unclean shutdown on NFS. It is removed by the owner of the table.
+			continue
+		}
+		p, err := openFilePart(partPath)
+		if err != nil {
+			putPws()
+			if !fs.IsPathExist(partPath) {
+				// The part has been removed by a transaction started after reading the list of parts.
+				return nil, errPendingTransactions
+			}
+			return nil, fmt.Errorf("cannot open part %q: %w", partPath, err)
+		}
+		pw := &partWrapper{
+			p:        p,
+			refCount: 1,
+		}
+		pws = append(pws, pw)
+	}
+
+	if !ignorePendingTransactions {
+		// Verify that no transactions were started while reading the list of parts.
+		if err := checkPendingTransactions(path); err != nil {
+			putPws()
+			return nil, err
+		}
+	}
+	return pws, nil
+}
+
+// checkPendingTransactions returns errPendingTransactions if the table at the given path has unfinished transactions.
+func checkPendingTransactions(path string) error {
+	txnDir := path + "/txn"
+	fis, err := ioutil.ReadDir(txnDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("cannot read directory %q: %w", txnDir, err)
+	}
+	for _, fi := range fis {
+		if !fs.IsTemporaryFileName(fi.Name()) {
+			return errPendingTransactions
+		}
+	}
+	return nil
+}
+
 // CreateSnapshotAt creates tb snapshot in the given dstDir.
 //
 // Snapshot is created using linux hard links, so it is usually created
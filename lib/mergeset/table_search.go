@@ -26,6 +26,10 @@ type TableSearch struct {
 
 	err error
 
+	// prefix is set by SeekPrefix. NextItem returns only items with this prefix if it is non-nil.
+	prefix    []byte
+	prefixBuf []byte
+
 	nextItemNoop bool
 	needClosing  bool
 }
@@ -50,6 +54,7 @@ func (ts *TableSearch) reset() {
 	ts.psHeap = ts.psHeap[:0]
 
 	ts.err = nil
+	ts.prefix = nil
 
 	ts.nextItemNoop = false
 	ts.needClosing = false
@@ -82,17 +87,49 @@ func (ts *TableSearch) Init(tb *Table) {
 
 // Seek seeks for the first item greater or equal to k in the ts.
 func (ts *TableSearch) Seek(k []byte) {
+	ts.seek(k, false)
+}
+
+// SeekPrefix seeks for the first item with the given prefix in the ts.
+//
+// The subsequent NextItem calls return only items with the given prefix.
+//
+// Parts without items with the given prefix are skipped without reading their blocks
+// if the table has been opened with non-nil ItemPrefixCallback, which returns non-empty prefix for the given prefix.
+func (ts *TableSearch) SeekPrefix(prefix []byte) {
+	ts.seek(prefix, true)
+}
+
+func (ts *TableSearch) seek(k []byte, isPrefix bool) {
 	if err := ts.Error(); err != nil {
 		// Do nothing on unrecoverable error.
 		return
 	}
 	ts.err = nil
+	ts.prefix = nil
+
+	usePrefixHash := false
+	prefixHash := uint64(0)
+	if isPrefix {
+		ts.prefix = append(ts.prefixBuf[:0], k...)
+		ts.prefixBuf = ts.prefix
+		if ts.tb.getItemPrefix != nil {
+			if bloomPrefix := ts.tb.getItemPrefix(k); len(bloomPrefix) > 0 {
+				usePrefixHash = true
+				prefixHash = getBloomFilterHash(bloomPrefix)
+			}
+		}
+	}
 
 	// Initialize the psHeap.
 	ts.psHeap = ts.psHeap[:0]
 	for i := range ts.psPool {
 		ps := &ts.psPool[i]
-		ps.Seek(k)
+		if usePrefixHash {
+			ps.SeekPrefix(k, prefixHash)
+		} else {
+			ps.Seek(k)
+		}
 		if !ps.NextItem() {
 			if err := ps.Error(); err != nil {
 				// Return only the first error, since it has no sense in returning all errors.
@@ -109,6 +146,10 @@ func (ts *TableSearch) Seek(k []byte) {
 	}
 	heap.Init(&ts.psHeap)
 	ts.Item = ts.psHeap[0].Item
+	if ts.prefix != nil && !bytes.HasPrefix(ts.Item, ts.prefix) {
+		ts.err = io.EOF
+		return
+	}
 	ts.nextItemNoop = true
 }
 
@@ -116,20 +157,14 @@ func (ts *TableSearch) Seek(k []byte) {
 //
 // It returns io.EOF if such an item doesn't exist.
 func (ts *TableSearch) FirstItemWithPrefix(prefix []byte) error {
-	ts.Seek(prefix)
+	ts.SeekPrefix(prefix)
 	if !ts.NextItem() {
 		if err := ts.Error(); err != nil {
 			return err
 		}
 		return io.EOF
 	}
-	if err := ts.Error(); err != nil {
-		return err
-	}
-	if !bytes.HasPrefix(ts.Item, prefix) {
-		return io.EOF
-	}
-	return nil
+	return ts.Error()
 }
 
 // NextItem advances to the next item.
@@ -149,6 +184,11 @@ func (ts *TableSearch) NextItem() bool {
 		}
 		return false
 	}
+	if ts.prefix != nil && !bytes.HasPrefix(ts.Item, ts.prefix) {
+		// There are no more items with the prefix passed to SeekPrefix.
+		ts.err = io.EOF
+		return false
+	}
 	return true
 }
 
@@ -1,10 +1,13 @@
 package mergeset
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"sort"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -40,7 +43,7 @@ func TestTableSearchSerial(t *testing.T) {
 
 	func() {
 		// Re-open the table and verify the search works.
-		tb, err := OpenTable(path, nil, nil)
+		tb, err := OpenTable(path, nil, nil, nil)
 		if err != nil {
 			t.Fatalf("cannot open table: %s", err)
 		}
@@ -75,7 +78,7 @@ func TestTableSearchConcurrent(t *testing.T) {
 
 	// Re-open the table and verify the search works.
 	func() {
-		tb, err := OpenTable(path, nil, nil)
+		tb, err := OpenTable(path, nil, nil, nil)
 		if err != nil {
 			t.Fatalf("cannot open table: %s", err)
 		}
@@ -151,7 +154,7 @@ func newTestTable(path string, itemsCount int) (*Table, []string, error) {
 	flushCallback := func() {
 		atomic.AddUint64(&flushes, 1)
 	}
-	tb, err := OpenTable(path, flushCallback, nil)
+	tb, err := OpenTable(path, flushCallback, nil, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot open table: %w", err)
 	}
@@ -171,3 +174,103 @@ func newTestTable(path string, itemsCount int) (*Table, []string, error) {
 	sort.Strings(items)
 	return tb, items, nil
 }
+
+func TestTableSearchSeekPrefix(t *testing.T) {
+	const path = "TestTableSearchSeekPrefix"
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	// Register the part of items until the first ':' in bloom filters.
+	getItemPrefix := func(item []byte) []byte {
+		n := bytes.IndexByte(item, ':')
+		if n < 0 {
+			return nil
+		}
+		return item[:n+1]
+	}
+	tb, err := OpenTable(path, nil, nil, getItemPrefix)
+	if err != nil {
+		t.Fatalf("cannot open table: %s", err)
+	}
+	defer tb.MustClose()
+
+	// Create multiple parts with distinct prefixes.
+	var items []string
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 100; j++ {
+			item := fmt.Sprintf("key_%d:%03d", i, j)
+			tb.AddItems([][]byte{[]byte(item)})
+			items = append(items, item)
+		}
+		tb.DebugFlush()
+	}
+	sort.Strings(items)
+
+	bloomFilters := 0
+	pws := tb.getParts(nil)
+	for _, pw := range pws {
+		if pw.p.bloom != nil {
+			bloomFilters++
+		}
+	}
+	tb.putParts(pws)
+	if bloomFilters == 0 {
+		t.Fatalf("expecting at least a single part with bloom filter")
+	}
+	var m TableMetrics
+	tb.UpdateMetrics(&m)
+	if m.BloomFiltersSizeBytes == 0 {
+		t.Fatalf("expecting non-zero BloomFiltersSizeBytes")
+	}
+
+	var ts TableSearch
+	ts.Init(tb)
+	defer ts.MustClose()
+	f := func(prefix string) {
+		t.Helper()
+		var itemsExpected []string
+		for _, item := range items {
+			if strings.HasPrefix(item, prefix) {
+				itemsExpected = append(itemsExpected, item)
+			}
+		}
+		var itemsFound []string
+		ts.SeekPrefix([]byte(prefix))
+		for ts.NextItem() {
+			itemsFound = append(itemsFound, string(ts.Item))
+		}
+		if err := ts.Error(); err != nil {
+			t.Fatalf("unexpected error when searching for prefix %q: %s", prefix, err)
+		}
+		if strings.Join(itemsFound, ",") != strings.Join(itemsExpected, ",") {
+			t.Fatalf("unexpected items found for prefix %q; got %d items; want %d items", prefix, len(itemsFound), len(itemsExpected))
+		}
+		err := ts.FirstItemWithPrefix([]byte(prefix))
+		if len(itemsExpected) == 0 {
+			if err != io.EOF {
+				t.Fatalf("expecting io.EOF for prefix %q; got %v", prefix, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error in FirstItemWithPrefix(%q): %s", prefix, err)
+		}
+		if string(ts.Item) != itemsExpected[0] {
+			t.Fatalf("unexpected first item for prefix %q; got %q; want %q", prefix, ts.Item, itemsExpected[0])
+		}
+	}
+	f("")
+	f("key_")
+	f("key_0:")
+	f("key_3:")
+	f("key_4:05")
+	f("key_4:099")
+	f("key_5:")
+	f("key_2:1000")
+	f("missing:")
+	f("missing")
+}
@@ -2,11 +2,13 @@ package mergeset
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 )
@@ -21,7 +23,7 @@ func TestTableOpenClose(t *testing.T) {
 	}()
 
 	// Create a new table
-	tb, err := OpenTable(path, nil, nil)
+	tb, err := OpenTable(path, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("cannot create new table: %s", err)
 	}
@@ -31,7 +33,7 @@ func TestTableOpenClose(t *testing.T) {
 
 	// Re-open created table multiple times.
 	for i := 0; i < 10; i++ {
-		tb, err := OpenTable(path, nil, nil)
+		tb, err := OpenTable(path, nil, nil, nil)
 		if err != nil {
 			t.Fatalf("cannot open created table: %s", err)
 		}
@@ -45,14 +47,14 @@ func TestTableOpenMultipleTimes(t *testing.T) {
 		_ = os.RemoveAll(path)
 	}()
 
-	tb1, err := OpenTable(path, nil, nil)
+	tb1, err := OpenTable(path, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("cannot open table: %s", err)
 	}
 	defer tb1.MustClose()
 
 	for i := 0; i < 10; i++ {
-		tb2, err := OpenTable(path, nil, nil)
+		tb2, err := OpenTable(path, nil, nil, nil)
 		if err == nil {
 			tb2.MustClose()
 			t.Fatalf("expecting non-nil error when opening already opened table")
@@ -73,7 +75,7 @@ func TestTableAddItemSerial(t *testing.T) {
 	flushCallback := func() {
 		atomic.AddUint64(&flushes, 1)
 	}
-	tb, err := OpenTable(path, flushCallback, nil)
+	tb, err := OpenTable(path, flushCallback, nil, nil)
 	if err != nil {
 		t.Fatalf("cannot open %q: %s", path, err)
 	}
@@ -99,7 +101,7 @@ func TestTableAddItemSerial(t *testing.T) {
 	testReopenTable(t, path, itemsCount)
 
 	// Add more items in order to verify merge between inmemory parts and file-based parts.
-	tb, err = OpenTable(path, nil, nil)
+	tb, err = OpenTable(path, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("cannot open %q: %s", path, err)
 	}
@@ -132,7 +134,7 @@ func TestTableCreateSnapshotAt(t *testing.T) {
 		_ = os.RemoveAll(path)
 	}()
 
-	tb, err := OpenTable(path, nil, nil)
+	tb, err := OpenTable(path, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("cannot open %q: %s", path, err)
 	}
@@ -163,13 +165,13 @@ func TestTableCreateSnapshotAt(t *testing.T) {
 	}()
 
 	// Verify snapshots contain all the data.
-	tb1, err := OpenTable(snapshot1, nil, nil)
+	tb1, err := OpenTable(snapshot1, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("cannot open %q: %s", path, err)
 	}
 	defer tb1.MustClose()
 
-	tb2, err := OpenTable(snapshot2, nil, nil)
+	tb2, err := OpenTable(snapshot2, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("cannot open %q: %s", path, err)
 	}
@@ -222,7 +224,7 @@ func TestTableAddItemsConcurrent(t *testing.T) {
 		atomic.AddUint64(&itemsMerged, uint64(len(items)))
 		return data, items
 	}
-	tb, err := OpenTable(path, flushCallback, prepareBlock)
+	tb, err := OpenTable(path, flushCallback, prepareBlock, nil)
 	if err != nil {
 		t.Fatalf("cannot open %q: %s", path, err)
 	}
@@ -252,7 +254,7 @@ func TestTableAddItemsConcurrent(t *testing.T) {
 	testReopenTable(t, path, itemsCount)
 
 	// Add more items in order to verify merge between inmemory parts and file-based parts.
-	tb, err = OpenTable(path, nil, nil)
+	tb, err = OpenTable(path, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("cannot open %q: %s", path, err)
 	}
@@ -294,7 +296,7 @@ func testReopenTable(t *testing.T, path string, itemsCount int) {
 	t.Helper()
 
 	for i := 0; i < 10; i++ {
-		tb, err := OpenTable(path, nil, nil)
+		tb, err := OpenTable(path, nil, nil, nil)
 		if err != nil {
 			t.Fatalf("cannot re-open %q: %s", path, err)
 		}
@@ -306,3 +308,85 @@ func testReopenTable(t *testing.T, path string, itemsCount int) {
 		tb.MustClose()
 	}
 }
+
+func TestTableOpenReadOnly(t *testing.T) {
+	const path = "TestTableOpenReadOnly"
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	tb, err := OpenTable(path, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot open table: %s", err)
+	}
+	var items []string
+	addItems := func(n int) {
+		for i := 0; i < n; i++ {
+			item := fmt.Sprintf("item_%06d", len(items))
+			if err := tb.AddItems([][]byte{[]byte(item)}); err != nil {
+				t.Fatalf("cannot add item: %s", err)
+			}
+			items = append(items, item)
+		}
+		tb.DebugFlush()
+
+		// Wait until transaction files are removed, since RefreshParts ignores changes until then.
+		pendingTxnDeletionsWG.Wait()
+	}
+	addItems(1000)
+
+	// The table may be opened in read-only mode while it is opened by another owner.
+	var flushes uint64
+	tbReadOnly, err := OpenTableReadOnly(path, func() {
+		atomic.AddUint64(&flushes, 1)
+	}, nil)
+	if err != nil {
+		t.Fatalf("cannot open table in read-only mode: %s", err)
+	}
+	defer tbReadOnly.MustClose()
+	if err := testTableSearchSerial(tbReadOnly, items); err != nil {
+		t.Fatalf("unexpected error in read-only table: %s", err)
+	}
+	if err := tbReadOnly.AddItems([][]byte{[]byte("foo")}); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expecting ErrReadOnly when adding items to read-only table; got %v", err)
+	}
+
+	// New items must become visible after RefreshParts call.
+	// Background merges in the owner of the table may postpone the refresh, so retry it a few times.
+	addItems(1000)
+	for i := 0; ; i++ {
+		if err := tbReadOnly.RefreshParts(); err != nil {
+			t.Fatalf("cannot refresh parts: %s", err)
+		}
+		err := testTableSearchSerial(tbReadOnly, items)
+		if err == nil {
+			break
+		}
+		if i >= 100 {
+			t.Fatalf("unexpected error in read-only table after refresh: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadUint64(&flushes); n == 0 {
+		t.Fatalf("expecting flushCallback call after refresh with new parts")
+	}
+
+	// RefreshParts without changes mustn't call flushCallback.
+	tb.MustClose()
+	if err := tbReadOnly.RefreshParts(); err != nil {
+		t.Fatalf("cannot refresh parts: %s", err)
+	}
+	flushesExpected := atomic.LoadUint64(&flushes)
+	if err := tbReadOnly.RefreshParts(); err != nil {
+		t.Fatalf("cannot refresh parts: %s", err)
+	}
+	if n := atomic.LoadUint64(&flushes); n != flushesExpected {
+		t.Fatalf("unexpected number of flushCallback calls; got %d; want %d", n, flushesExpected)
+	}
+	if err := testTableSearchSerial(tbReadOnly, items); err != nil {
+		t.Fatalf("unexpected error in read-only table after closing the owner: %s", err)
+	}
+}
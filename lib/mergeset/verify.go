@@ -0,0 +1,101 @@
+package mergeset
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+// PartError describes a corrupted part found by VerifyTable.
+type PartError struct {
+	// Path is the path to the corrupted part.
+	Path string
+
+	// Err is the error found in the part.
+	Err error
+}
+
+// VerifyTable verifies the consistency of all the parts in the table at the given path.
+//
+// The table mustn't be opened via OpenTable during the verification.
+// The table isn't modified.
+//
+// f is called for every item read from the verified parts if f isn't nil.
+// Items from a corrupted part may be passed to f before the corruption is detected.
+//
+// The number of verified parts and the list of corrupted parts are returned.
+func VerifyTable(path string, f func(item []byte)) (int, []PartError, error) {
+	d, err := os.Open(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot open table directory: %w", err)
+	}
+	defer fs.MustClose(d)
+
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot read directory %q: %w", path, err)
+	}
+	partsCount := 0
+	var pes []PartError
+	for _, fi := range fis {
+		if !fs.IsDirOrSymlink(fi) {
+			// Skip non-directories.
+			continue
+		}
+		fn := fi.Name()
+		if isSpecialDir(fn) {
+			// Skip special dirs.
+			continue
+		}
+		partPath := path + "/" + fn
+		if fs.IsEmptyDir(partPath) {
+			// Empty directories are removed when the table is opened.
+			continue
+		}
+		partsCount++
+		if err := verifyPart(partPath, f); err != nil {
+			pes = append(pes, PartError{
+				Path: partPath,
+				Err:  err,
+			})
+		}
+	}
+	return partsCount, pes, nil
+}
+
+func verifyPart(path string, f func(item []byte)) error {
+	var bsr blockStreamReader
+	if err := bsr.InitFromFilePart(path); err != nil {
+		return err
+	}
+	defer bsr.MustClose()
+
+	if len(bsr.mrs) == 0 {
+		return fmt.Errorf("metaindex file doesn't contain rows")
+	}
+	var prevItem []byte
+	for bsr.Next() {
+		b := &bsr.Block
+		for _, it := range b.items {
+			item := it.Bytes(b.data)
+			if string(item) < string(prevItem) {
+				return fmt.Errorf("items aren't sorted; item %X is smaller than the previous item %X", item, prevItem)
+			}
+			if f != nil {
+				f(item)
+			}
+			prevItem = append(prevItem[:0], item...)
+		}
+	}
+	if err := bsr.Error(); err != nil {
+		return err
+	}
+	if bsr.blocksRead != bsr.ph.blocksCount {
+		return fmt.Errorf("unexpected number of blocks read; got %d; want %d according to partHeader", bsr.blocksRead, bsr.ph.blocksCount)
+	}
+	if bsr.itemsRead != bsr.ph.itemsCount {
+		return fmt.Errorf("unexpected number of items read; got %d; want %d according to partHeader", bsr.itemsRead, bsr.ph.itemsCount)
+	}
+	return nil
+}
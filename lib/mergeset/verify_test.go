@@ -0,0 +1,71 @@
+package mergeset
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyTable(t *testing.T) {
+	const path = "TestVerifyTable"
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	tb, err := OpenTable(path, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot open table: %s", err)
+	}
+	const itemsCount = 1000
+	for i := 0; i < itemsCount; i++ {
+		item := fmt.Sprintf("item %d", i)
+		if err := tb.AddItems([][]byte{[]byte(item)}); err != nil {
+			t.Fatalf("cannot add item: %s", err)
+		}
+	}
+	tb.DebugFlush()
+	tb.MustClose()
+
+	items := 0
+	partsCount, pes, err := VerifyTable(path, func(item []byte) {
+		items++
+	})
+	if err != nil {
+		t.Fatalf("cannot verify table: %s", err)
+	}
+	if len(pes) > 0 {
+		t.Fatalf("unexpected corrupted parts: %v", pes)
+	}
+	if partsCount == 0 {
+		t.Fatalf("expecting at least a single verified part")
+	}
+	if items != itemsCount {
+		t.Fatalf("unexpected number of verified items; got %d; want %d", items, itemsCount)
+	}
+
+	// Corrupt a part by truncating its items file.
+	itemsPaths, err := filepath.Glob(path + "/*/items.bin")
+	if err != nil {
+		t.Fatalf("cannot find items files: %s", err)
+	}
+	if len(itemsPaths) == 0 {
+		t.Fatalf("cannot find items files at %q", path)
+	}
+	if err := os.Truncate(itemsPaths[0], 1); err != nil {
+		t.Fatalf("cannot truncate %q: %s", itemsPaths[0], err)
+	}
+	_, pes, err = VerifyTable(path, nil)
+	if err != nil {
+		t.Fatalf("cannot verify table: %s", err)
+	}
+	if len(pes) != 1 {
+		t.Fatalf("unexpected number of corrupted parts; got %d; want 1", len(pes))
+	}
+	if pes[0].Path != filepath.Dir(itemsPaths[0]) {
+		t.Fatalf("unexpected corrupted part; got %q; want %q", pes[0].Path, filepath.Dir(itemsPaths[0]))
+	}
+}
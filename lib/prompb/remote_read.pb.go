@@ -0,0 +1,508 @@
+// Code generated manually from remote.proto and types.proto
+
+package prompb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ReadRequest represents Prometheus remote read API request.
+type ReadRequest struct {
+	Queries []Query
+
+	// AcceptedResponseTypes contains response types the client accepts in the order of preference.
+	//
+	// Samples response type must be used if it is empty.
+	AcceptedResponseTypes []ReadResponseType
+}
+
+// ReadResponseType is the response type for Prometheus remote read API.
+type ReadResponseType int32
+
+const (
+	// ReadResponseTypeSamples means that the response is a snappy-compressed ReadResponse.
+	ReadResponseTypeSamples ReadResponseType = 0
+
+	// ReadResponseTypeStreamedXORChunks means that the response is a stream of ChunkedReadResponse frames
+	// with XOR-encoded chunks.
+	ReadResponseTypeStreamedXORChunks ReadResponseType = 1
+)
+
+// Query is a query from Prometheus remote read API request.
+type Query struct {
+	StartTimestampMs int64
+	EndTimestampMs   int64
+	Matchers         []LabelMatcher
+	Hints            *ReadHints
+}
+
+// LabelMatcherType is the type of LabelMatcher.
+type LabelMatcherType int32
+
+// Label matcher types as defined in Prometheus remote read protocol.
+const (
+	LabelMatcherEQ  LabelMatcherType = 0
+	LabelMatcherNEQ LabelMatcherType = 1
+	LabelMatcherRE  LabelMatcherType = 2
+	LabelMatcherNRE LabelMatcherType = 3
+)
+
+// LabelMatcher is a label matcher for Query.
+type LabelMatcher struct {
+	Type  LabelMatcherType
+	Name  []byte
+	Value []byte
+}
+
+// ReadHints contains optional hints for Query.
+type ReadHints struct {
+	StepMs   int64
+	Func     string
+	StartMs  int64
+	EndMs    int64
+	Grouping []string
+	By       bool
+	RangeMs  int64
+}
+
+// ReadResponse is the response for Prometheus remote read API request with ReadResponseTypeSamples response type.
+type ReadResponse struct {
+	// Results contains results for every query in ReadRequest in the same order.
+	Results []QueryResult
+}
+
+// QueryResult is the result for a single Query.
+type QueryResult struct {
+	Timeseries []TimeSeries
+}
+
+// ChunkedReadResponse is a single frame for Prometheus remote read API response with ReadResponseTypeStreamedXORChunks response type.
+type ChunkedReadResponse struct {
+	ChunkedSeries []ChunkedSeries
+
+	// QueryIndex is the index of the query in ReadRequest the ChunkedSeries belong to.
+	QueryIndex int64
+}
+
+// ChunkedSeries is a time series with samples packed into chunks.
+type ChunkedSeries struct {
+	Labels []Label
+	Chunks []Chunk
+}
+
+// ChunkEncoding is the encoding for Chunk data.
+type ChunkEncoding int32
+
+// Chunk encodings as defined in Prometheus remote read protocol.
+const (
+	ChunkEncodingUnknown ChunkEncoding = 0
+	ChunkEncodingXOR     ChunkEncoding = 1
+)
+
+// Chunk contains encoded samples on the [MinTimeMs ... MaxTimeMs] time range.
+type Chunk struct {
+	MinTimeMs int64
+	MaxTimeMs int64
+	Type      ChunkEncoding
+	Data      []byte
+}
+
+// Unmarshal unmarshals m from dAtA.
+//
+// m refers to dAtA after the call, so dAtA mustn't be modified while m is in use.
+func (m *ReadRequest) Unmarshal(dAtA []byte) error {
+	m.Queries = m.Queries[:0]
+	m.AcceptedResponseTypes = m.AcceptedResponseTypes[:0]
+	return unmarshalFields(dAtA, "ReadRequest", func(fieldNum int32, wireType int, v uint64, data []byte) error {
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Queries", wireType)
+			}
+			m.Queries = append(m.Queries, Query{})
+			return m.Queries[len(m.Queries)-1].Unmarshal(data)
+		case 2:
+			switch wireType {
+			case 0:
+				m.AcceptedResponseTypes = append(m.AcceptedResponseTypes, ReadResponseType(v))
+			case 2:
+				// Packed repeated enum.
+				for len(data) > 0 {
+					n, size := binary.Uvarint(data)
+					if size <= 0 {
+						return errIntOverflowRemote
+					}
+					data = data[size:]
+					m.AcceptedResponseTypes = append(m.AcceptedResponseTypes, ReadResponseType(n))
+				}
+			default:
+				return fmt.Errorf("proto: wrong wireType = %d for field AcceptedResponseTypes", wireType)
+			}
+		}
+		return nil
+	})
+}
+
+// Unmarshal unmarshals m from dAtA.
+func (m *Query) Unmarshal(dAtA []byte) error {
+	return unmarshalFields(dAtA, "Query", func(fieldNum int32, wireType int, v uint64, data []byte) error {
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StartTimestampMs", wireType)
+			}
+			m.StartTimestampMs = int64(v)
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EndTimestampMs", wireType)
+			}
+			m.EndTimestampMs = int64(v)
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Matchers", wireType)
+			}
+			m.Matchers = append(m.Matchers, LabelMatcher{})
+			return m.Matchers[len(m.Matchers)-1].Unmarshal(data)
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Hints", wireType)
+			}
+			m.Hints = &ReadHints{}
+			return m.Hints.Unmarshal(data)
+		}
+		return nil
+	})
+}
+
+// Unmarshal unmarshals m from dAtA.
+func (m *LabelMatcher) Unmarshal(dAtA []byte) error {
+	return unmarshalFields(dAtA, "LabelMatcher", func(fieldNum int32, wireType int, v uint64, data []byte) error {
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Type", wireType)
+			}
+			m.Type = LabelMatcherType(v)
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			m.Name = data
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Value", wireType)
+			}
+			m.Value = data
+		}
+		return nil
+	})
+}
+
+// Unmarshal unmarshals m from dAtA.
+func (m *ReadHints) Unmarshal(dAtA []byte) error {
+	return unmarshalFields(dAtA, "ReadHints", func(fieldNum int32, wireType int, v uint64, data []byte) error {
+		switch fieldNum {
+		case 1, 3, 4, 6, 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field #%d", wireType, fieldNum)
+			}
+			switch fieldNum {
+			case 1:
+				m.StepMs = int64(v)
+			case 3:
+				m.StartMs = int64(v)
+			case 4:
+				m.EndMs = int64(v)
+			case 6:
+				m.By = v != 0
+			case 7:
+				m.RangeMs = int64(v)
+			}
+		case 2, 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field #%d", wireType, fieldNum)
+			}
+			if fieldNum == 2 {
+				m.Func = string(data)
+			} else {
+				m.Grouping = append(m.Grouping, string(data))
+			}
+		}
+		return nil
+	})
+}
+
+// unmarshalFields calls f for every field in the protobuf message dAtA.
+//
+// v contains the value for varint and fixed-size fields, while data contains the value for length-delimited fields.
+// Unknown fields must be ignored by f.
+func unmarshalFields(dAtA []byte, msgName string, f func(fieldNum int32, wireType int, v uint64, data []byte) error) error {
+	for len(dAtA) > 0 {
+		wire, n := binary.Uvarint(dAtA)
+		if n <= 0 {
+			if n == 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return errIntOverflowRemote
+		}
+		dAtA = dAtA[n:]
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: %s: illegal tag %d (wire type %d)", msgName, fieldNum, wire)
+		}
+		var v uint64
+		var data []byte
+		switch wireType {
+		case 0:
+			v, n = binary.Uvarint(dAtA)
+			if n <= 0 {
+				if n == 0 {
+					return io.ErrUnexpectedEOF
+				}
+				return errIntOverflowRemote
+			}
+			dAtA = dAtA[n:]
+		case 1:
+			if len(dAtA) < 8 {
+				return io.ErrUnexpectedEOF
+			}
+			v = binary.LittleEndian.Uint64(dAtA)
+			dAtA = dAtA[8:]
+		case 2:
+			length, n := binary.Uvarint(dAtA)
+			if n <= 0 {
+				if n == 0 {
+					return io.ErrUnexpectedEOF
+				}
+				return errIntOverflowRemote
+			}
+			dAtA = dAtA[n:]
+			if length > uint64(len(dAtA)) {
+				return io.ErrUnexpectedEOF
+			}
+			data = dAtA[:length]
+			dAtA = dAtA[length:]
+		case 5:
+			if len(dAtA) < 4 {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(binary.LittleEndian.Uint32(dAtA))
+			dAtA = dAtA[4:]
+		default:
+			return fmt.Errorf("proto: %s: unsupported wireType %d for field #%d", msgName, wireType, fieldNum)
+		}
+		if err := f(fieldNum, wireType, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalProtobuf appends protobuf-marshaled m to dst and returns the result.
+func (m *ReadResponse) MarshalProtobuf(dst []byte) []byte {
+	for i := range m.Results {
+		qr := &m.Results[i]
+		dst = appendTagAndLen(dst, 1, qr.size())
+		dst = qr.marshal(dst)
+	}
+	return dst
+}
+
+func (m *QueryResult) size() int {
+	n := 0
+	for i := range m.Timeseries {
+		n += sizeOfMessageField(m.Timeseries[i].size())
+	}
+	return n
+}
+
+func (m *QueryResult) marshal(dst []byte) []byte {
+	for i := range m.Timeseries {
+		ts := &m.Timeseries[i]
+		dst = appendTagAndLen(dst, 1, ts.size())
+		dst = ts.marshal(dst)
+	}
+	return dst
+}
+
+// size returns the size of marshaled m. Exemplars aren't marshaled.
+func (m *TimeSeries) size() int {
+	n := 0
+	for i := range m.Labels {
+		n += sizeOfMessageField(m.Labels[i].size())
+	}
+	for i := range m.Samples {
+		n += sizeOfMessageField(m.Samples[i].size())
+	}
+	return n
+}
+
+func (m *TimeSeries) marshal(dst []byte) []byte {
+	for i := range m.Labels {
+		label := &m.Labels[i]
+		dst = appendTagAndLen(dst, 1, label.size())
+		dst = label.marshal(dst)
+	}
+	for i := range m.Samples {
+		sample := &m.Samples[i]
+		dst = appendTagAndLen(dst, 2, sample.size())
+		dst = sample.marshal(dst)
+	}
+	return dst
+}
+
+func (m *Label) size() int {
+	n := 0
+	if len(m.Name) > 0 {
+		n += sizeOfMessageField(len(m.Name))
+	}
+	if len(m.Value) > 0 {
+		n += sizeOfMessageField(len(m.Value))
+	}
+	return n
+}
+
+func (m *Label) marshal(dst []byte) []byte {
+	if len(m.Name) > 0 {
+		dst = appendTagAndLen(dst, 1, len(m.Name))
+		dst = append(dst, m.Name...)
+	}
+	if len(m.Value) > 0 {
+		dst = appendTagAndLen(dst, 2, len(m.Value))
+		dst = append(dst, m.Value...)
+	}
+	return dst
+}
+
+func (m *Sample) size() int {
+	n := 0
+	if m.Value != 0 {
+		n += 1 + 8
+	}
+	if m.Timestamp != 0 {
+		n += 1 + sizeOfVarint(uint64(m.Timestamp))
+	}
+	return n
+}
+
+func (m *Sample) marshal(dst []byte) []byte {
+	if m.Value != 0 {
+		dst = append(dst, 1<<3|1)
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(m.Value))
+		dst = append(dst, buf[:]...)
+	}
+	if m.Timestamp != 0 {
+		dst = append(dst, 2<<3)
+		dst = appendUvarint(dst, uint64(m.Timestamp))
+	}
+	return dst
+}
+
+// MarshalProtobuf appends protobuf-marshaled m to dst and returns the result.
+func (m *ChunkedReadResponse) MarshalProtobuf(dst []byte) []byte {
+	for i := range m.ChunkedSeries {
+		cs := &m.ChunkedSeries[i]
+		dst = appendTagAndLen(dst, 1, cs.size())
+		dst = cs.marshal(dst)
+	}
+	if m.QueryIndex != 0 {
+		dst = append(dst, 2<<3)
+		dst = appendUvarint(dst, uint64(m.QueryIndex))
+	}
+	return dst
+}
+
+func (m *ChunkedSeries) size() int {
+	n := 0
+	for i := range m.Labels {
+		n += sizeOfMessageField(m.Labels[i].size())
+	}
+	for i := range m.Chunks {
+		n += sizeOfMessageField(m.Chunks[i].size())
+	}
+	return n
+}
+
+func (m *ChunkedSeries) marshal(dst []byte) []byte {
+	for i := range m.Labels {
+		label := &m.Labels[i]
+		dst = appendTagAndLen(dst, 1, label.size())
+		dst = label.marshal(dst)
+	}
+	for i := range m.Chunks {
+		chunk := &m.Chunks[i]
+		dst = appendTagAndLen(dst, 2, chunk.size())
+		dst = chunk.marshal(dst)
+	}
+	return dst
+}
+
+func (m *Chunk) size() int {
+	n := 0
+	if m.MinTimeMs != 0 {
+		n += 1 + sizeOfVarint(uint64(m.MinTimeMs))
+	}
+	if m.MaxTimeMs != 0 {
+		n += 1 + sizeOfVarint(uint64(m.MaxTimeMs))
+	}
+	if m.Type != 0 {
+		n += 1 + sizeOfVarint(uint64(m.Type))
+	}
+	if len(m.Data) > 0 {
+		n += sizeOfMessageField(len(m.Data))
+	}
+	return n
+}
+
+func (m *Chunk) marshal(dst []byte) []byte {
+	if m.MinTimeMs != 0 {
+		dst = append(dst, 1<<3)
+		dst = appendUvarint(dst, uint64(m.MinTimeMs))
+	}
+	if m.MaxTimeMs != 0 {
+		dst = append(dst, 2<<3)
+		dst = appendUvarint(dst, uint64(m.MaxTimeMs))
+	}
+	if m.Type != 0 {
+		dst = append(dst, 3<<3)
+		dst = appendUvarint(dst, uint64(m.Type))
+	}
+	if len(m.Data) > 0 {
+		dst = appendTagAndLen(dst, 4, len(m.Data))
+		dst = append(dst, m.Data...)
+	}
+	return dst
+}
+
+// appendTagAndLen appends the tag for length-delimited field fieldNum and the given length to dst.
+func appendTagAndLen(dst []byte, fieldNum int, length int) []byte {
+	dst = appendUvarint(dst, uint64(fieldNum)<<3|2)
+	return appendUvarint(dst, uint64(length))
+}
+
+// sizeOfMessageField returns the size of length-delimited field with fieldNum < 16 and the given length.
+func sizeOfMessageField(length int) int {
+	return 1 + sizeOfVarint(uint64(length)) + length
+}
+
+func sizeOfVarint(n uint64) int {
+	size := 1
+	for n >= 0x80 {
+		n >>= 7
+		size++
+	}
+	return size
+}
+
+func appendUvarint(dst []byte, n uint64) []byte {
+	for n >= 0x80 {
+		dst = append(dst, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(dst, byte(n))
+}
@@ -17,8 +17,17 @@ type Sample struct {
 
 // TimeSeries is a timeseries.
 type TimeSeries struct {
-	Labels  []Label
-	Samples []Sample
+	Labels    []Label
+	Samples   []Sample
+	Exemplars []Exemplar
+}
+
+// Exemplar is an exemplar for a timeseries sample.
+type Exemplar struct {
+	// Labels contains exemplar labels such as trace_id.
+	Labels    []Label
+	Value     float64
+	Timestamp int64
 }
 
 // Label is a timeseries label
@@ -110,9 +119,12 @@ func (m *Sample) Unmarshal(dAtA []byte) error {
 }
 
 // Unmarshal unmarshals timeseries from dAtA.
-func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Sample) ([]Label, []Sample, error) {
+//
+// Exemplar labels are appended to dstExemplarLabels.
+func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Sample, dstExemplars []Exemplar, dstExemplarLabels []Label) ([]Label, []Sample, []Exemplar, []Label, error) {
 	labelsStart := len(dstLabels)
 	samplesStart := len(dstSamples)
+	exemplarsStart := len(dstExemplars)
 
 	l := len(dAtA)
 	iNdEx := 0
@@ -121,10 +133,10 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 		var wire uint64
 		for shift := uint(0); ; shift += 7 {
 			if shift >= 64 {
-				return dstLabels, dstSamples, errIntOverflowTypes
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, errIntOverflowTypes
 			}
 			if iNdEx >= l {
-				return dstLabels, dstSamples, io.ErrUnexpectedEOF
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, io.ErrUnexpectedEOF
 			}
 			b := dAtA[iNdEx]
 			iNdEx++
@@ -136,23 +148,23 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return dstLabels, dstSamples, fmt.Errorf("proto: TimeSeries: wiretype end group for non-group")
+			return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, fmt.Errorf("proto: TimeSeries: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return dstLabels, dstSamples, fmt.Errorf("proto: TimeSeries: illegal tag %d (wire type %d)", fieldNum, wire)
+			return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, fmt.Errorf("proto: TimeSeries: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return dstLabels, dstSamples, fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
-					return dstLabels, dstSamples, errIntOverflowTypes
+					return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, errIntOverflowTypes
 				}
 				if iNdEx >= l {
-					return dstLabels, dstSamples, io.ErrUnexpectedEOF
+					return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, io.ErrUnexpectedEOF
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
@@ -162,11 +174,11 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 				}
 			}
 			if msglen < 0 {
-				return dstLabels, dstSamples, errInvalidLengthTypes
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, errInvalidLengthTypes
 			}
 			postIndex := iNdEx + msglen
 			if postIndex > l {
-				return dstLabels, dstSamples, io.ErrUnexpectedEOF
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, io.ErrUnexpectedEOF
 			}
 			if cap(dstLabels) > len(dstLabels) {
 				dstLabels = dstLabels[:len(dstLabels)+1]
@@ -175,20 +187,20 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 			}
 			lb := &dstLabels[len(dstLabels)-1]
 			if err := lb.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return dstLabels, dstSamples, err
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, err
 			}
 			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
-				return dstLabels, dstSamples, fmt.Errorf("proto: wrong wireType = %d for field Samples", wireType)
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, fmt.Errorf("proto: wrong wireType = %d for field Samples", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
-					return dstLabels, dstSamples, errIntOverflowTypes
+					return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, errIntOverflowTypes
 				}
 				if iNdEx >= l {
-					return dstLabels, dstSamples, io.ErrUnexpectedEOF
+					return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, io.ErrUnexpectedEOF
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
@@ -198,11 +210,11 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 				}
 			}
 			if msglen < 0 {
-				return dstLabels, dstSamples, errInvalidLengthTypes
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, errInvalidLengthTypes
 			}
 			postIndex := iNdEx + msglen
 			if postIndex > l {
-				return dstLabels, dstSamples, io.ErrUnexpectedEOF
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, io.ErrUnexpectedEOF
 			}
 			if cap(dstSamples) > len(dstSamples) {
 				dstSamples = dstSamples[:len(dstSamples)+1]
@@ -211,32 +223,195 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 			}
 			s := &dstSamples[len(dstSamples)-1]
 			if err := s.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return dstLabels, dstSamples, err
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, fmt.Errorf("proto: wrong wireType = %d for field Exemplars", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, errInvalidLengthTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, io.ErrUnexpectedEOF
+			}
+			if cap(dstExemplars) > len(dstExemplars) {
+				dstExemplars = dstExemplars[:len(dstExemplars)+1]
+			} else {
+				dstExemplars = append(dstExemplars, Exemplar{})
+			}
+			e := &dstExemplars[len(dstExemplars)-1]
+			var err error
+			dstExemplarLabels, err = e.Unmarshal(dAtA[iNdEx:postIndex], dstExemplarLabels)
+			if err != nil {
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, err
 			}
 			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTypes(dAtA[iNdEx:])
 			if err != nil {
-				return dstLabels, dstSamples, err
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, err
 			}
 			if skippy < 0 {
-				return dstLabels, dstSamples, errInvalidLengthTypes
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, errInvalidLengthTypes
 			}
 			if (iNdEx + skippy) > l {
-				return dstLabels, dstSamples, io.ErrUnexpectedEOF
+				return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, io.ErrUnexpectedEOF
 			}
 			iNdEx += skippy
 		}
 	}
 
 	if iNdEx > l {
-		return dstLabels, dstSamples, io.ErrUnexpectedEOF
+		return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, io.ErrUnexpectedEOF
 	}
 
 	m.Labels = dstLabels[labelsStart:]
 	m.Samples = dstSamples[samplesStart:]
-	return dstLabels, dstSamples, nil
+	m.Exemplars = dstExemplars[exemplarsStart:]
+	return dstLabels, dstSamples, dstExemplars, dstExemplarLabels, nil
+}
+
+// Unmarshal unmarshals exemplar from dAtA.
+//
+// Exemplar labels are appended to dstLabels.
+func (m *Exemplar) Unmarshal(dAtA []byte, dstLabels []Label) ([]Label, error) {
+	labelsStart := len(dstLabels)
+
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return dstLabels, errIntOverflowTypes
+			}
+			if iNdEx >= l {
+				return dstLabels, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return dstLabels, fmt.Errorf("proto: Exemplar: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return dstLabels, fmt.Errorf("proto: Exemplar: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return dstLabels, fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return dstLabels, errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return dstLabels, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return dstLabels, errInvalidLengthTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return dstLabels, io.ErrUnexpectedEOF
+			}
+			if cap(dstLabels) > len(dstLabels) {
+				dstLabels = dstLabels[:len(dstLabels)+1]
+			} else {
+				dstLabels = append(dstLabels, Label{})
+			}
+			lb := &dstLabels[len(dstLabels)-1]
+			if err := lb.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return dstLabels, err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 1 {
+				return dstLabels, fmt.Errorf("proto: wrong wireType = %d for field Value", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return dstLabels, io.ErrUnexpectedEOF
+			}
+			v = uint64(binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.Value = float64(math.Float64frombits(v))
+		case 3:
+			if wireType != 0 {
+				return dstLabels, fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
+			}
+			m.Timestamp = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return dstLabels, errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return dstLabels, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Timestamp |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTypes(dAtA[iNdEx:])
+			if err != nil {
+				return dstLabels, err
+			}
+			if skippy < 0 {
+				return dstLabels, errInvalidLengthTypes
+			}
+			if (iNdEx + skippy) > l {
+				return dstLabels, io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return dstLabels, io.ErrUnexpectedEOF
+	}
+
+	m.Labels = dstLabels[labelsStart:]
+	return dstLabels, nil
 }
 
 // Unmarshal unmarshals Label from dAtA.
@@ -349,6 +524,165 @@ func (m *Label) Unmarshal(dAtA []byte) error {
 	return nil
 }
 
+// MetricType is the type of a metric family.
+type MetricType int32
+
+// Metric types as defined in Prometheus remote write protocol.
+const (
+	MetricTypeUnknown        MetricType = 0
+	MetricTypeCounter        MetricType = 1
+	MetricTypeGauge          MetricType = 2
+	MetricTypeHistogram      MetricType = 3
+	MetricTypeGaugeHistogram MetricType = 4
+	MetricTypeSummary        MetricType = 5
+	MetricTypeInfo           MetricType = 6
+	MetricTypeStateset       MetricType = 7
+)
+
+// String returns string representation of mt as used in Prometheus exposition format.
+func (mt MetricType) String() string {
+	switch mt {
+	case MetricTypeCounter:
+		return "counter"
+	case MetricTypeGauge:
+		return "gauge"
+	case MetricTypeHistogram:
+		return "histogram"
+	case MetricTypeGaugeHistogram:
+		return "gaugehistogram"
+	case MetricTypeSummary:
+		return "summary"
+	case MetricTypeInfo:
+		return "info"
+	case MetricTypeStateset:
+		return "stateset"
+	default:
+		return "unknown"
+	}
+}
+
+// MetricMetadata contains metadata for a metric family.
+type MetricMetadata struct {
+	// Type is the metric type.
+	Type MetricType
+
+	// MetricFamilyName is the name of the metric family.
+	MetricFamilyName []byte
+
+	// Help is the help text for the metric family.
+	Help []byte
+
+	// Unit is the unit for the metric family.
+	Unit []byte
+}
+
+// Unmarshal unmarshals m from dAtA.
+func (m *MetricMetadata) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return errIntOverflowTypes
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: MetricMetadata: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: MetricMetadata: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Type", wireType)
+			}
+			m.Type = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Type |= MetricType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2, 4, 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field %d of MetricMetadata", wireType, fieldNum)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return errInvalidLengthTypes
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			switch fieldNum {
+			case 2:
+				m.MetricFamilyName = dAtA[iNdEx:postIndex]
+			case 4:
+				m.Help = dAtA[iNdEx:postIndex]
+			case 5:
+				m.Unit = dAtA[iNdEx:postIndex]
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTypes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return errInvalidLengthTypes
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
 func skipTypes(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
@@ -22,6 +22,10 @@ func MarshalWriteRequest(dst []byte, wr *WriteRequest) []byte {
 // ResetWriteRequest resets wr.
 func ResetWriteRequest(wr *WriteRequest) {
 	wr.Timeseries = ResetTimeSeries(wr.Timeseries)
+	for i := range wr.Metadata {
+		wr.Metadata[i] = MetricMetadata{}
+	}
+	wr.Metadata = wr.Metadata[:0]
 }
 
 // ResetTimeSeries clears all the GC references from tss and returns an empty tss ready for further use.
@@ -30,6 +34,53 @@ func ResetTimeSeries(tss []TimeSeries) []TimeSeries {
 		ts := tss[i]
 		ts.Labels = nil
 		ts.Samples = nil
+		ts.Exemplars = nil
 	}
 	return tss[:0]
 }
+
+// String returns string representation of mt as used in Prometheus exposition format.
+func (mt MetricMetadata_MetricType) String() string {
+	switch mt {
+	case MetricMetadata_COUNTER:
+		return "counter"
+	case MetricMetadata_GAUGE:
+		return "gauge"
+	case MetricMetadata_HISTOGRAM:
+		return "histogram"
+	case MetricMetadata_GAUGEHISTOGRAM:
+		return "gaugehistogram"
+	case MetricMetadata_SUMMARY:
+		return "summary"
+	case MetricMetadata_INFO:
+		return "info"
+	case MetricMetadata_STATESET:
+		return "stateset"
+	default:
+		return "unknown"
+	}
+}
+
+// GetMetricMetadataType returns metric type for the given string representation s.
+//
+// MetricMetadata_UNKNOWN is returned for unsupported s.
+func GetMetricMetadataType(s string) MetricMetadata_MetricType {
+	switch s {
+	case "counter":
+		return MetricMetadata_COUNTER
+	case "gauge":
+		return MetricMetadata_GAUGE
+	case "histogram":
+		return MetricMetadata_HISTOGRAM
+	case "gaugehistogram":
+		return MetricMetadata_GAUGEHISTOGRAM
+	case "summary":
+		return MetricMetadata_SUMMARY
+	case "info":
+		return MetricMetadata_INFO
+	case "stateset":
+		return MetricMetadata_STATESET
+	default:
+		return MetricMetadata_UNKNOWN
+	}
+}
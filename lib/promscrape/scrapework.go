@@ -445,6 +445,9 @@ func (sw *scrapeWork) scrapeInternal(scrapeTimestamp, realTimestamp int64) error
 			sw.seriesLimitExceeded = true
 		}
 	}
+	if up == 1 {
+		wc.addMetadata(wc.rows.Metadata)
+	}
 	sw.addAutoTimeseries(wc, "up", float64(up), scrapeTimestamp)
 	sw.addAutoTimeseries(wc, "scrape_duration_seconds", duration, scrapeTimestamp)
 	sw.addAutoTimeseries(wc, "scrape_samples_scraped", float64(samplesScraped), scrapeTimestamp)
@@ -632,6 +635,9 @@ type writeRequestCtx struct {
 	writeRequest prompbmarshal.WriteRequest
 	labels       []prompbmarshal.Label
 	samples      []prompbmarshal.Sample
+
+	exemplarLabels []prompbmarshal.Label
+	exemplars      []prompbmarshal.Exemplar
 }
 
 func (wc *writeRequestCtx) reset() {
@@ -643,6 +649,8 @@ func (wc *writeRequestCtx) resetNoRows() {
 	prompbmarshal.ResetWriteRequest(&wc.writeRequest)
 	wc.labels = wc.labels[:0]
 	wc.samples = wc.samples[:0]
+	wc.exemplarLabels = wc.exemplarLabels[:0]
+	wc.exemplars = wc.exemplars[:0]
 }
 
 var writeRequestCtxPool leveledWriteRequestCtxPool
@@ -784,6 +792,48 @@ func (sw *scrapeWork) addRowToTimeseries(wc *writeRequestCtx, r *parser.Row, tim
 		Labels:  wc.labels[labelsLen:],
 		Samples: wc.samples[len(wc.samples)-1:],
 	})
+	if len(r.Exemplar.Tags) > 0 {
+		ts := &wr.Timeseries[len(wr.Timeseries)-1]
+		ts.Exemplars = wc.appendExemplar(&r.Exemplar, sampleTimestamp)
+	}
+}
+
+// addMetadata adds mms to wc.writeRequest.
+func (wc *writeRequestCtx) addMetadata(mms []parser.Metadata) {
+	wr := &wc.writeRequest
+	for i := range mms {
+		mm := &mms[i]
+		wr.Metadata = append(wr.Metadata, prompbmarshal.MetricMetadata{
+			Type:             prompbmarshal.GetMetricMetadataType(mm.Type),
+			MetricFamilyName: mm.Metric,
+			Help:             mm.Help,
+			Unit:             mm.Unit,
+		})
+	}
+}
+
+// appendExemplar appends e to wc and returns a slice with the appended exemplar.
+//
+// The exemplar timestamp defaults to sampleTimestamp if e has no timestamp.
+func (wc *writeRequestCtx) appendExemplar(e *parser.Exemplar, sampleTimestamp int64) []prompbmarshal.Exemplar {
+	labelsLen := len(wc.exemplarLabels)
+	for i := range e.Tags {
+		tag := &e.Tags[i]
+		wc.exemplarLabels = append(wc.exemplarLabels, prompbmarshal.Label{
+			Name:  tag.Key,
+			Value: tag.Value,
+		})
+	}
+	timestamp := e.Timestamp
+	if timestamp == 0 {
+		timestamp = sampleTimestamp
+	}
+	wc.exemplars = append(wc.exemplars, prompbmarshal.Exemplar{
+		Labels:    wc.exemplarLabels[labelsLen:],
+		Value:     e.Value,
+		Timestamp: timestamp,
+	})
+	return wc.exemplars[len(wc.exemplars)-1:]
 }
 
 func appendLabels(dst []prompbmarshal.Label, metric string, src []parser.Tag, extraLabels []prompbmarshal.Label, honorLabels bool) []prompbmarshal.Label {
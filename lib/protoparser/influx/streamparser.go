@@ -12,17 +12,21 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metrics"
 )
 
 var (
 	maxLineSize   = flagutil.NewBytes("influx.maxLineSize", 256*1024, "The maximum size in bytes for a single InfluxDB line during parsing")
 	trimTimestamp = flag.Duration("influxTrimTimestamp", time.Millisecond, "Trim timestamps for InfluxDB line protocol data to this duration. "+
-		"Minimum practical duration is 1ms. Higher duration (i.e. 1s) may be used for reducing disk space usage for timestamp data")
+		"Minimum practical duration is 1ms unless -storage.timestampPrecision is set to us or ns. "+
+		"Higher duration (i.e. 1s) may be used for reducing disk space usage for timestamp data")
 )
 
 // ParseStream parses r with the given args and calls callback for the parsed rows.
 //
+// The parsed rows contain timestamps in the storage precision. See storage.TimestampsPerMsec.
+//
 // The callback can be called concurrently multiple times for streamed data from r.
 //
 // callback shouldn't hold rows after returning.
@@ -36,20 +40,21 @@ func ParseStream(r io.Reader, isGzipped bool, precision, db string, callback fun
 		r = zr
 	}
 
-	tsMultiplier := int64(0)
+	// tsUnit is the duration of a timestamp unit in nanoseconds. Zero value means that the unit must be auto-detected.
+	tsUnit := int64(0)
 	switch precision {
 	case "ns":
-		tsMultiplier = 1e6
+		tsUnit = 1
 	case "u", "us", "µ":
-		tsMultiplier = 1e3
+		tsUnit = 1e3
 	case "ms":
-		tsMultiplier = 1
+		tsUnit = 1e6
 	case "s":
-		tsMultiplier = -1e3
+		tsUnit = 1e9
 	case "m":
-		tsMultiplier = -1e3 * 60
+		tsUnit = 1e9 * 60
 	case "h":
-		tsMultiplier = -1e3 * 3600
+		tsUnit = 1e9 * 3600
 	}
 
 	ctx := getStreamContext(r)
@@ -67,7 +72,7 @@ func ParseStream(r io.Reader, isGzipped bool, precision, db string, callback fun
 			ctx.wg.Done()
 		}
 		uw.db = db
-		uw.tsMultiplier = tsMultiplier
+		uw.tsUnit = tsUnit
 		uw.reqBuf, ctx.reqBuf = ctx.reqBuf, uw.reqBuf
 		ctx.wg.Add(1)
 		common.ScheduleUnmarshalWork(uw)
@@ -164,18 +169,18 @@ var streamContextPool sync.Pool
 var streamContextPoolCh = make(chan *streamContext, cgroup.AvailableCPUs())
 
 type unmarshalWork struct {
-	rows         Rows
-	callback     func(db string, rows []Row)
-	db           string
-	tsMultiplier int64
-	reqBuf       []byte
+	rows     Rows
+	callback func(db string, rows []Row)
+	db       string
+	tsUnit   int64
+	reqBuf   []byte
 }
 
 func (uw *unmarshalWork) reset() {
 	uw.rows.Reset()
 	uw.callback = nil
 	uw.db = ""
-	uw.tsMultiplier = 0
+	uw.tsUnit = 0
 	uw.reqBuf = uw.reqBuf[:0]
 }
 
@@ -185,40 +190,34 @@ func (uw *unmarshalWork) Unmarshal() {
 	rows := uw.rows.Rows
 	rowsRead.Add(len(rows))
 
-	// Adjust timestamps according to uw.tsMultiplier
-	currentTs := time.Now().UnixNano() / 1e6
-	tsMultiplier := uw.tsMultiplier
-	if tsMultiplier == 0 {
+	// Convert timestamps from uw.tsUnit to the storage precision.
+	// Timestamps are converted directly, since conversion to nanoseconds may overflow int64 for timestamps after year 2262.
+	timestampsPerMsec := storage.TimestampsPerMsec()
+	currentTsNano := time.Now().UnixNano()
+	tsUnit := uw.tsUnit
+	if tsUnit == 0 {
 		// Default precision is 'ns'. See https://docs.influxdata.com/influxdb/v1.7/write_protocols/line_protocol_tutorial/#timestamp
 		// But it can be in ns, us, ms or s depending on the number of digits in practice.
+		currentTs := convertTimestamp(currentTsNano, 1, timestampsPerMsec)
 		for i := range rows {
 			tsPtr := &rows[i].Timestamp
-			*tsPtr = detectTimestamp(*tsPtr, currentTs)
+			*tsPtr = detectTimestamp(*tsPtr, currentTs, timestampsPerMsec)
 		}
-	} else if tsMultiplier >= 1 {
+	} else {
+		currentTsNano -= currentTsNano % tsUnit
+		currentTs := convertTimestamp(currentTsNano, 1, timestampsPerMsec)
 		for i := range rows {
 			row := &rows[i]
 			if row.Timestamp == 0 {
 				row.Timestamp = currentTs
 			} else {
-				row.Timestamp /= tsMultiplier
-			}
-		}
-	} else if tsMultiplier < 0 {
-		tsMultiplier = -tsMultiplier
-		currentTs -= currentTs % tsMultiplier
-		for i := range rows {
-			row := &rows[i]
-			if row.Timestamp == 0 {
-				row.Timestamp = currentTs
-			} else {
-				row.Timestamp *= tsMultiplier
+				row.Timestamp = convertTimestamp(row.Timestamp, tsUnit, timestampsPerMsec)
 			}
 		}
 	}
 
 	// Trim timestamps if required.
-	if tsTrim := trimTimestamp.Milliseconds(); tsTrim > 1 {
+	if tsTrim := trimTimestamp.Nanoseconds() / (1e6 / timestampsPerMsec); tsTrim > 1 {
 		for i := range rows {
 			row := &rows[i]
 			row.Timestamp -= row.Timestamp % tsTrim
@@ -244,22 +243,36 @@ func putUnmarshalWork(uw *unmarshalWork) {
 
 var unmarshalWorkPool sync.Pool
 
-func detectTimestamp(ts, currentTs int64) int64 {
+// detectTimestamp returns ts converted to the storage precision with the given timestampsPerMsec.
+//
+// currentTs is returned if ts is zero.
+func detectTimestamp(ts, currentTs, timestampsPerMsec int64) int64 {
 	if ts == 0 {
 		return currentTs
 	}
 	if ts >= 1e17 {
-		// convert nanoseconds to milliseconds
-		return ts / 1e6
+		// the ts is in nanoseconds
+		return convertTimestamp(ts, 1, timestampsPerMsec)
 	}
 	if ts >= 1e14 {
-		// convert microseconds to milliseconds
-		return ts / 1e3
+		// the ts is in microseconds
+		return convertTimestamp(ts, 1e3, timestampsPerMsec)
 	}
 	if ts >= 1e11 {
 		// the ts is in milliseconds
-		return ts
+		return convertTimestamp(ts, 1e6, timestampsPerMsec)
+	}
+	// the ts is in seconds
+	return convertTimestamp(ts, 1e9, timestampsPerMsec)
+}
+
+// convertTimestamp converts ts with the given tsUnit in nanoseconds to the storage precision with the given timestampsPerMsec.
+//
+// The result is saturated at math.MinInt64 and math.MaxInt64 instead of overflowing. See storage.ConvertTimestamp.
+func convertTimestamp(ts, tsUnit, timestampsPerMsec int64) int64 {
+	dstUnit := 1e6 / timestampsPerMsec
+	if tsUnit < dstUnit {
+		return storage.ConvertTimestamp(ts, dstUnit/tsUnit, 1)
 	}
-	// convert seconds to milliseconds
-	return ts * 1e3
+	return storage.ConvertTimestamp(ts, 1, tsUnit/dstUnit)
 }
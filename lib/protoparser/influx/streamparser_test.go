@@ -1,14 +1,17 @@
 package influx
 
 import (
+	"math"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 )
 
 func TestDetectTimestamp(t *testing.T) {
 	tsDefault := int64(123)
 	f := func(ts, tsExpected int64) {
 		t.Helper()
-		tsResult := detectTimestamp(ts, tsDefault)
+		tsResult := detectTimestamp(ts, tsDefault, 1)
 		if tsResult != tsExpected {
 			t.Fatalf("unexpected timestamp for detectTimestamp(%d, %d); got %d; want %d", ts, tsDefault, tsResult, tsExpected)
 		}
@@ -28,3 +31,79 @@ func TestDetectTimestamp(t *testing.T) {
 	f(1e17, 1e11)
 	f(1e18, 1e12)
 }
+
+func TestConvertTimestamp(t *testing.T) {
+	f := func(ts, tsUnit, timestampsPerMsec, tsExpected int64) {
+		t.Helper()
+		tsResult := convertTimestamp(ts, tsUnit, timestampsPerMsec)
+		if tsResult != tsExpected {
+			t.Fatalf("unexpected timestamp for convertTimestamp(%d, %d, %d); got %d; want %d", ts, tsUnit, timestampsPerMsec, tsResult, tsExpected)
+		}
+	}
+	f(1600000000123456789, 1, 1, 1600000000123)
+	f(1600000000123456789, 1, 1e3, 1600000000123456)
+	f(1600000000123456789, 1, 1e6, 1600000000123456789)
+	f(1600000000, 1e9, 1, 1600000000000)
+	f(1600000000, 1e9, 1e6, 1600000000000000000)
+	f(450000, 3600e9, 1, 1620000000000)
+
+	// Timestamps after year 2262 must be saturated in nanosecond precision and must be preserved in millisecond precision.
+	f(1e10, 1e9, 1, 1e13)
+	f(1e10, 1e9, 1e6, math.MaxInt64)
+	f(1e13, 1e6, 1, 1e13)
+	f(1e13, 1e6, 1e6, math.MaxInt64)
+	f(3e6, 3600e9, 1, 3e6*3600e3)
+	f(3e6, 3600e9, 1e6, math.MaxInt64)
+	f(-1e13, 1e6, 1e6, math.MinInt64)
+}
+
+func TestUnmarshalWorkTimestampPrecision(t *testing.T) {
+	defer func() {
+		if err := storage.SetTimestampPrecision("ms"); err != nil {
+			t.Fatalf("cannot restore timestamp precision: %s", err)
+		}
+	}()
+	f := func(storagePrecision string, tsUnit int64, s string, timestampsExpected []int64) {
+		t.Helper()
+		if err := storage.SetTimestampPrecision(storagePrecision); err != nil {
+			t.Fatalf("cannot set timestamp precision: %s", err)
+		}
+		var timestamps []int64
+		uw := getUnmarshalWork()
+		uw.tsUnit = tsUnit
+		uw.reqBuf = append(uw.reqBuf[:0], s...)
+		uw.callback = func(db string, rows []Row) {
+			for _, r := range rows {
+				timestamps = append(timestamps, r.Timestamp)
+			}
+		}
+		uw.Unmarshal()
+		if len(timestamps) != len(timestampsExpected) {
+			t.Fatalf("unexpected number of rows; got %d; want %d", len(timestamps), len(timestampsExpected))
+		}
+		for i, ts := range timestamps {
+			if ts != timestampsExpected[i] {
+				t.Fatalf("unexpected timestamp #%d; got %d; want %d", i, ts, timestampsExpected[i])
+			}
+		}
+	}
+
+	// Auto-detected nanosecond timestamps are trimmed to milliseconds by default.
+	f("ms", 0, "foo x=1 1600000000123456789\nfoo x=2 1600000000123999999", []int64{1600000000123, 1600000000123})
+	f("ns", 0, "foo x=1 1600000000123456789\nfoo x=2 1600000000123999999", []int64{1600000000123000000, 1600000000123000000})
+
+	// Explicitly set precision.
+	f("ms", 1e3, "foo x=1 1600000000123456", []int64{1600000000123})
+	f("us", 1e9, "foo x=1 1600000000", []int64{1600000000000000})
+
+	// Sub-millisecond timestamps must be preserved without trimming.
+	trimTimestampOrig := *trimTimestamp
+	*trimTimestamp = 1
+	defer func() {
+		*trimTimestamp = trimTimestampOrig
+	}()
+	f("ms", 0, "foo x=1 1600000000123456789", []int64{1600000000123})
+	f("us", 0, "foo x=1 1600000000123456789", []int64{1600000000123456})
+	f("ns", 0, "foo x=1 1600000000123456789\nfoo x=2 1600000000123999999", []int64{1600000000123456789, 1600000000123999999})
+	f("ns", 1e3, "foo x=1 1600000000123456", []int64{1600000000123456000})
+}
@@ -17,10 +17,21 @@ import (
 
 // ParseStream parses /api/v1/import/native lines from req and calls callback for parsed blocks.
 //
+// The precision for timestamps in req may be set via `timestamp_precision` query arg. Milliseconds are used by default.
+// Parsed blocks contain timestamps in the storage precision. See storage.TimestampsPerMsec.
+//
 // The callback can be called concurrently multiple times for streamed data from req.
 //
 // callback shouldn't hold block after returning.
 func ParseStream(req *http.Request, callback func(block *Block) error) error {
+	timestampsPerMsec := int64(1)
+	if precision := req.URL.Query().Get("timestamp_precision"); precision != "" {
+		n, err := storage.ParseTimestampPrecision(precision)
+		if err != nil {
+			return fmt.Errorf("cannot parse `timestamp_precision` query arg: %w", err)
+		}
+		timestampsPerMsec = n
+	}
 	r := req.Body
 	if req.Header.Get("Content-Encoding") == "gzip" {
 		zr, err := common.GetGzipReader(r)
@@ -53,6 +64,7 @@ func ParseStream(req *http.Request, callback func(block *Block) error) error {
 	for {
 		uw := getUnmarshalWork()
 		uw.tr = tr
+		uw.timestampsPerMsec = timestampsPerMsec
 		uw.callback = func(block *Block) {
 			if err := callback(block); err != nil {
 				processErrors.Inc()
@@ -143,14 +155,16 @@ var (
 )
 
 type unmarshalWork struct {
-	tr            storage.TimeRange
-	callback      func(block *Block)
-	metricNameBuf []byte
-	blockBuf      []byte
-	block         Block
+	tr                storage.TimeRange
+	timestampsPerMsec int64
+	callback          func(block *Block)
+	metricNameBuf     []byte
+	blockBuf          []byte
+	block             Block
 }
 
 func (uw *unmarshalWork) reset() {
+	uw.timestampsPerMsec = 0
 	uw.callback = nil
 	uw.metricNameBuf = uw.metricNameBuf[:0]
 	uw.blockBuf = uw.blockBuf[:0]
@@ -183,7 +197,8 @@ func (uw *unmarshalWork) unmarshal() error {
 	if len(tail) > 0 {
 		return fmt.Errorf("unexpected non-empty tail left after unmarshaling native block from %d bytes; len(tail)=%d bytes", len(uw.blockBuf), len(tail))
 	}
-	block.Timestamps, block.Values = tmpBlock.AppendRowsWithTimeRangeFilter(block.Timestamps[:0], block.Values[:0], uw.tr)
+	block.Timestamps, block.Values = tmpBlock.AppendRowsWithTimeRangeFilterExt(block.Timestamps[:0], block.Values[:0], uw.tr, uw.timestampsPerMsec)
+	storage.ConvertTimestamps(block.Timestamps, uw.timestampsPerMsec, storage.TimestampsPerMsec())
 	rowsRead.Add(len(block.Timestamps))
 	return nil
 }
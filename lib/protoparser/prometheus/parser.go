@@ -3,6 +3,7 @@ package prometheus
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"sync"
@@ -16,6 +17,9 @@ import (
 type Rows struct {
 	Rows []Row
 
+	// Metadata contains metric metadata obtained from `# HELP`, `# TYPE` and `# UNIT` lines.
+	Metadata []Metadata
+
 	tagsPool []Tag
 }
 
@@ -28,6 +32,11 @@ func (rs *Rows) Reset() {
 	}
 	rs.Rows = rs.Rows[:0]
 
+	for i := range rs.Metadata {
+		rs.Metadata[i].reset()
+	}
+	rs.Metadata = rs.Metadata[:0]
+
 	for i := range rs.tagsPool {
 		rs.tagsPool[i].reset()
 	}
@@ -54,7 +63,83 @@ func stdErrLogger(s string) {
 // s shouldn't be modified while rs is in use.
 func (rs *Rows) UnmarshalWithErrLogger(s string, errLogger func(s string)) {
 	noEscapes := strings.IndexByte(s, '\\') < 0
-	rs.Rows, rs.tagsPool = unmarshalRows(rs.Rows[:0], s, rs.tagsPool[:0], noEscapes, errLogger)
+	rs.Rows, rs.Metadata, rs.tagsPool = unmarshalRows(rs.Rows[:0], rs.Metadata[:0], s, rs.tagsPool[:0], noEscapes, errLogger)
+}
+
+// Metadata contains metadata for a metric family.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/master/specification/OpenMetrics.md#metricfamily
+type Metadata struct {
+	// Metric is the metric family name.
+	Metric string
+
+	// Type is the metric type such as counter, gauge, histogram or summary.
+	Type string
+
+	// Help is the help text for the metric.
+	Help string
+
+	// Unit is the metric unit.
+	Unit string
+}
+
+func (m *Metadata) reset() {
+	m.Metric = ""
+	m.Type = ""
+	m.Help = ""
+	m.Unit = ""
+}
+
+// appendMetadata appends metadata from `# HELP`, `# TYPE` or `# UNIT` line s to dst and returns the result.
+//
+// Metadata lines for the same metric are usually grouped together, so they are merged
+// into the last item of dst if it refers to the same metric.
+// dst is returned unchanged if s isn't a metadata line.
+func appendMetadata(dst []Metadata, s string, noEscapes bool) []Metadata {
+	s = skipLeadingWhitespace(s)
+	if len(s) == 0 || s[0] != '#' {
+		return dst
+	}
+	s = skipLeadingWhitespace(s[1:])
+	n := nextWhitespace(s)
+	if n < 0 {
+		return dst
+	}
+	kind := s[:n]
+	if kind != "HELP" && kind != "TYPE" && kind != "UNIT" {
+		return dst
+	}
+	s = skipLeadingWhitespace(s[n+1:])
+	metric := s
+	value := ""
+	if n := nextWhitespace(s); n >= 0 {
+		metric = s[:n]
+		value = skipLeadingWhitespace(s[n+1:])
+	}
+	if len(metric) == 0 {
+		return dst
+	}
+	if len(dst) == 0 || dst[len(dst)-1].Metric != metric {
+		if cap(dst) > len(dst) {
+			dst = dst[:len(dst)+1]
+		} else {
+			dst = append(dst, Metadata{})
+		}
+		dst[len(dst)-1].Metric = metric
+	}
+	m := &dst[len(dst)-1]
+	switch kind {
+	case "HELP":
+		if !noEscapes {
+			value = unescapeValue(value)
+		}
+		m.Help = value
+	case "TYPE":
+		m.Type = skipTrailingWhitespace(value)
+	case "UNIT":
+		m.Unit = skipTrailingWhitespace(value)
+	}
+	return dst
 }
 
 // Row is a single Prometheus row.
@@ -63,6 +148,11 @@ type Row struct {
 	Tags      []Tag
 	Value     float64
 	Timestamp int64
+
+	// Exemplar is an optional OpenMetrics exemplar attached to the row.
+	//
+	// It is empty if the row has no exemplar.
+	Exemplar Exemplar
 }
 
 func (r *Row) reset() {
@@ -70,14 +160,74 @@ func (r *Row) reset() {
 	r.Tags = nil
 	r.Value = 0
 	r.Timestamp = 0
+	r.Exemplar.reset()
+}
+
+// Exemplar is an OpenMetrics exemplar.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/master/specification/OpenMetrics.md#exemplars
+type Exemplar struct {
+	Tags  []Tag
+	Value float64
+
+	// Timestamp is the exemplar timestamp in milliseconds. It is 0 if the exemplar has no timestamp.
+	Timestamp int64
+}
+
+func (e *Exemplar) reset() {
+	e.Tags = nil
+	e.Value = 0
+	e.Timestamp = 0
+}
+
+// unmarshal unmarshals exemplar in the form `{labels} value [timestamp]` from s.
+func (e *Exemplar) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error) {
+	e.reset()
+	s = skipLeadingWhitespace(s)
+	if len(s) == 0 || s[0] != '{' {
+		return tagsPool, fmt.Errorf("missing labels")
+	}
+	tagsStart := len(tagsPool)
+	var err error
+	s, tagsPool, err = unmarshalTags(tagsPool, s[1:], noEscapes)
+	if err != nil {
+		return tagsPool[:tagsStart], fmt.Errorf("cannot unmarshal labels: %w", err)
+	}
+	tags := tagsPool[tagsStart:]
+	s = skipTrailingWhitespace(skipLeadingWhitespace(s))
+	if len(s) == 0 {
+		return tagsPool[:tagsStart], fmt.Errorf("value cannot be empty")
+	}
+	valueStr := s
+	tsStr := ""
+	if n := nextWhitespace(s); n >= 0 {
+		valueStr = s[:n]
+		tsStr = skipLeadingWhitespace(s[n+1:])
+	}
+	v, err := fastfloat.Parse(valueStr)
+	if err != nil {
+		return tagsPool[:tagsStart], fmt.Errorf("cannot parse value %q: %w", valueStr, err)
+	}
+	if len(tsStr) > 0 {
+		// Exemplar timestamps are always in seconds according to OpenMetrics spec.
+		ts, err := fastfloat.Parse(tsStr)
+		if err != nil {
+			return tagsPool[:tagsStart], fmt.Errorf("cannot parse timestamp %q: %w", tsStr, err)
+		}
+		e.Timestamp = int64(math.Round(ts * 1000))
+	}
+	e.Tags = tags[:len(tags):len(tags)]
+	e.Value = v
+	return tagsPool, nil
 }
 
-func skipTrailingComment(s string) string {
+// splitTrailingComment splits s into the part before '#' char and the part after it.
+func splitTrailingComment(s string) (string, string) {
 	n := strings.IndexByte(s, '#')
 	if n < 0 {
-		return s
+		return s, ""
 	}
-	return s[:n]
+	return s[:n], s[n+1:]
 }
 
 func skipLeadingWhitespace(s string) string {
@@ -114,6 +264,12 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 	r.reset()
 	s = skipLeadingWhitespace(s)
 	n := strings.IndexByte(s, '{')
+	if n >= 0 {
+		if w := nextWhitespace(s); w >= 0 && w < n && skipLeadingWhitespace(s[w:])[0] != '{' {
+			// The '{' belongs to the trailing exemplar such as `foo 1 # {trace_id="x"} 1`.
+			n = -1
+		}
+	}
 	if n >= 0 {
 		// Tags found. Parse them.
 		r.Metric = skipTrailingWhitespace(s[:n])
@@ -143,7 +299,12 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 		return tagsPool, fmt.Errorf("metric cannot be empty")
 	}
 	s = skipLeadingWhitespace(s)
-	s = skipTrailingComment(s)
+	s, comment := splitTrailingComment(s)
+	if len(comment) > 0 {
+		// The comment may contain an exemplar. Invalid exemplars are ignored,
+		// since the comment may contain arbitrary text.
+		tagsPool, _ = r.Exemplar.unmarshal(comment, tagsPool, noEscapes)
+	}
 	if len(s) == 0 {
 		return tagsPool, fmt.Errorf("value cannot be empty")
 	}
@@ -187,20 +348,26 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 
 var rowsReadScrape = metrics.NewCounter(`vm_protoparser_rows_read_total{type="promscrape"}`)
 
-func unmarshalRows(dst []Row, s string, tagsPool []Tag, noEscapes bool, errLogger func(s string)) ([]Row, []Tag) {
+func unmarshalRows(dst []Row, mms []Metadata, s string, tagsPool []Tag, noEscapes bool, errLogger func(s string)) ([]Row, []Metadata, []Tag) {
 	dstLen := len(dst)
 	for len(s) > 0 {
 		n := strings.IndexByte(s, '\n')
-		if n < 0 {
+		line := s
+		if n >= 0 {
+			line = s[:n]
+			s = s[n+1:]
+		} else {
 			// The last line.
-			dst, tagsPool = unmarshalRow(dst, s, tagsPool, noEscapes, errLogger)
-			break
+			s = ""
 		}
-		dst, tagsPool = unmarshalRow(dst, s[:n], tagsPool, noEscapes, errLogger)
-		s = s[n+1:]
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		mms = appendMetadata(mms, line, noEscapes)
+		dst, tagsPool = unmarshalRow(dst, line, tagsPool, noEscapes, errLogger)
 	}
 	rowsReadScrape.Add(len(dst) - dstLen)
-	return dst, tagsPool
+	return dst, mms, tagsPool
 }
 
 func unmarshalRow(dst []Row, s string, tagsPool []Tag, noEscapes bool, errLogger func(s string)) ([]Row, []Tag) {
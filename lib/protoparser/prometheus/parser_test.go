@@ -376,6 +376,14 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 					},
 				},
 				Value: 17,
+				Exemplar: Exemplar{
+					Tags: []Tag{{
+						Key:   "trace_id",
+						Value: "oHg5SJ#YRHA0",
+					}},
+					Value:     9.8,
+					Timestamp: 1520879607789,
+				},
 			},
 			{
 				Metric:    "abc",
@@ -389,6 +397,52 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 		},
 	})
 
+	// Exemplar without timestamp
+	f(`foo_bucket{le="+Inf"} 3 123 # {trace_id="abc",span_id="x"} 0.5`, &Rows{
+		Rows: []Row{{
+			Metric: "foo_bucket",
+			Tags: []Tag{{
+				Key:   "le",
+				Value: "+Inf",
+			}},
+			Value:     3,
+			Timestamp: 123000,
+			Exemplar: Exemplar{
+				Tags: []Tag{
+					{
+						Key:   "trace_id",
+						Value: "abc",
+					},
+					{
+						Key:   "span_id",
+						Value: "x",
+					},
+				},
+				Value: 0.5,
+			},
+		}},
+	})
+
+	// Invalid exemplars must be ignored
+	f(`foo 1 # {trace_id="abc"}
+	bar 2 # {trace_id="abc"} xyz
+	baz 3 # {trace_id="abc" 1`, &Rows{
+		Rows: []Row{
+			{
+				Metric: "foo",
+				Value:  1,
+			},
+			{
+				Metric: "bar",
+				Value:  2,
+			},
+			{
+				Metric: "baz",
+				Value:  3,
+			},
+		},
+	})
+
 	// "Infinity" word - this has been added in OpenMetrics.
 	// See https://github.com/OpenObservability/OpenMetrics/blob/master/OpenMetrics.md
 	// Checks for https://github.com/VictoriaMetrics/VictoriaMetrics/issues/924
@@ -568,3 +622,44 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 		},
 	})
 }
+
+func TestRowsUnmarshalMetadata(t *testing.T) {
+	f := func(s string, metadataExpected []Metadata) {
+		t.Helper()
+		var rows Rows
+		rows.Unmarshal(s)
+		if !reflect.DeepEqual(rows.Metadata, metadataExpected) {
+			t.Fatalf("unexpected metadata;\ngot\n%+v\nwant\n%+v", rows.Metadata, metadataExpected)
+		}
+		rows.Reset()
+		if len(rows.Metadata) != 0 {
+			t.Fatalf("non-empty metadata after reset: %+v", rows.Metadata)
+		}
+	}
+	f("", nil)
+	f("# foo bar\n#baz\n# HELP\nfoo 123", nil)
+	f(`# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{code="200"} 1027
+# TYPE temperature gauge
+# UNIT temperature celsius
+# HELP temperature Temperature with \\ and \n escapes
+temperature 23.5
+  # TYPE   foo   summary  `, []Metadata{
+		{
+			Metric: "http_requests_total",
+			Type:   "counter",
+			Help:   "The total number of HTTP requests.",
+		},
+		{
+			Metric: "temperature",
+			Type:   "gauge",
+			Help:   "Temperature with \\ and \n escapes",
+			Unit:   "celsius",
+		},
+		{
+			Metric: "foo",
+			Type:   "summary",
+		},
+	})
+}
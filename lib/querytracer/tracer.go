@@ -0,0 +1,171 @@
+package querytracer
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var denyQueryTracing = flag.Bool("denyQueryTracing", false, "Whether to disable the ability to trace queries. See https://docs.victoriametrics.com/#query-tracing")
+
+// Tracer represents query tracer.
+//
+// It must be created via New call.
+// Each created tracer must be finalized via Done or Donef call.
+//
+// Tracer may contain sub-tracers (branches) in order to build tree-like execution order.
+// Call Tracer.NewChild func for adding sub-tracer.
+//
+// All the Tracer methods are no-op for nil Tracer, so it is safe to pass nil Tracer
+// to the code, which doesn't need tracing.
+type Tracer struct {
+	// startTime is the time when Tracer was created
+	startTime time.Time
+
+	// doneTime is the time when Done or Donef was called
+	doneTime time.Time
+
+	// message is the message generated by NewChild, Printf or Donef call.
+	message string
+
+	// mu protects children, which may be added from concurrently running goroutines.
+	mu sync.Mutex
+
+	// children is a list of children Tracer objects
+	children []*Tracer
+}
+
+// New creates a new instance of the tracer with the given fmt.Sprintf(format, args...) message.
+//
+// If enabled isn't set or -denyQueryTracing command-line flag is set, then nil is returned.
+//
+// Done or Donef must be called when the tracer should be finished.
+func New(enabled bool, format string, args ...interface{}) *Tracer {
+	if *denyQueryTracing || !enabled {
+		return nil
+	}
+	return &Tracer{
+		message:   fmt.Sprintf(format, args...),
+		startTime: time.Now(),
+	}
+}
+
+// Enabled returns true if the t is enabled.
+func (t *Tracer) Enabled() bool {
+	return t != nil
+}
+
+// NewChild adds a new child Tracer to t with the given fmt.Sprintf(format, args...) message.
+//
+// NewChild returns nil if t is nil.
+//
+// Done or Donef must be called on the returned child when it should be finished.
+func (t *Tracer) NewChild(format string, args ...interface{}) *Tracer {
+	if t == nil {
+		return nil
+	}
+	child := &Tracer{
+		message:   fmt.Sprintf(format, args...),
+		startTime: time.Now(),
+	}
+	t.addChild(child)
+	return child
+}
+
+// Done finishes t.
+//
+// Done cannot be called multiple times.
+// Other Tracer functions cannot be called after Done call.
+func (t *Tracer) Done() {
+	if t == nil {
+		return
+	}
+	if !t.doneTime.IsZero() {
+		logger.Panicf("BUG: Done() or Donef() has been already called for the tracer %q", t.message)
+	}
+	t.doneTime = time.Now()
+}
+
+// Donef appends the given fmt.Sprintf(format, args..) message to t and finishes it.
+//
+// Donef cannot be called multiple times.
+// Other Tracer functions cannot be called after Donef call.
+func (t *Tracer) Donef(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.message += ": " + fmt.Sprintf(format, args...)
+	t.Done()
+}
+
+// Printf adds new fmt.Sprintf(format, args...) message to t.
+//
+// The message is added as a finished child with zero duration.
+func (t *Tracer) Printf(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	child := &Tracer{
+		message:   fmt.Sprintf(format, args...),
+		startTime: now,
+		doneTime:  now,
+	}
+	t.addChild(child)
+}
+
+func (t *Tracer) addChild(child *Tracer) {
+	t.mu.Lock()
+	t.children = append(t.children, child)
+	t.mu.Unlock()
+}
+
+// ToJSON returns JSON representation of t.
+//
+// The returned JSON contains the following fields per each span:
+//
+//   - duration_msec - the duration of the span in milliseconds
+//   - message - the span message
+//   - children - the list of children spans
+//
+// An empty string is returned if t is nil.
+func (t *Tracer) ToJSON() string {
+	if t == nil {
+		return ""
+	}
+	s := t.toSpan()
+	data, err := json.Marshal(s)
+	if err != nil {
+		logger.Panicf("BUG: unexpected error from json.Marshal: %s", err)
+	}
+	return string(data)
+}
+
+type span struct {
+	DurationMsec float64 `json:"duration_msec"`
+	Message      string  `json:"message"`
+	Children     []*span `json:"children,omitempty"`
+}
+
+func (t *Tracer) toSpan() *span {
+	doneTime := t.doneTime
+	if doneTime.IsZero() {
+		// The tracer isn't finished yet. Report its duration up to now.
+		doneTime = time.Now()
+	}
+	s := &span{
+		DurationMsec: float64(doneTime.Sub(t.startTime)) / float64(time.Millisecond),
+		Message:      t.message,
+	}
+	t.mu.Lock()
+	children := append([]*Tracer{}, t.children...)
+	t.mu.Unlock()
+	for _, child := range children {
+		s.Children = append(s.Children, child.toSpan())
+	}
+	return s
+}
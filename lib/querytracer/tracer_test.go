@@ -0,0 +1,81 @@
+package querytracer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTracerDisabled(t *testing.T) {
+	qt := New(false, "test")
+	if qt.Enabled() {
+		t.Fatalf("query tracer must be disabled")
+	}
+	qtChild := qt.NewChild("child done %d", 456)
+	if qtChild.Enabled() {
+		t.Fatalf("query tracer must be disabled")
+	}
+	qtChild.Printf("foo %d", 123)
+	qtChild.Donef("foo %d", 33)
+	qt.Printf("parent %d", 789)
+	qt.Done()
+	if s := qt.ToJSON(); s != "" {
+		t.Fatalf("unexpected JSON for disabled tracer; got %q; want empty string", s)
+	}
+}
+
+func TestTracerEnabled(t *testing.T) {
+	qt := New(true, "test")
+	if !qt.Enabled() {
+		t.Fatalf("query tracer must be enabled")
+	}
+	qtChild := qt.NewChild("child %d", 456)
+	if !qtChild.Enabled() {
+		t.Fatalf("child query tracer must be enabled")
+	}
+	qtChild.Printf("foo %d", 123)
+	qtChild.Donef("series=%d", 33)
+	qt.Printf("parent %d", 789)
+	qt.Donef("foo=%s", "bar")
+
+	var s span
+	if err := json.Unmarshal([]byte(qt.ToJSON()), &s); err != nil {
+		t.Fatalf("cannot unmarshal trace: %s", err)
+	}
+	messages := collectMessages(nil, &s, "")
+	messagesExpected := []string{
+		"test: foo=bar",
+		"-child 456: series=33",
+		"--foo 123",
+		"-parent 789",
+	}
+	if !reflect.DeepEqual(messages, messagesExpected) {
+		t.Fatalf("unexpected messages;\ngot\n%q\nwant\n%q", messages, messagesExpected)
+	}
+	if s.DurationMsec < s.Children[0].DurationMsec {
+		t.Fatalf("parent duration cannot be smaller than child duration; got %.3f vs %.3f", s.DurationMsec, s.Children[0].DurationMsec)
+	}
+	if d := s.Children[1].DurationMsec; d != 0 {
+		t.Fatalf("unexpected duration for Printf message; got %.3f; want 0", d)
+	}
+}
+
+func TestTracerEscaping(t *testing.T) {
+	qt := New(true, "query=%s", `foo{bar="baz\n"}`)
+	qt.Done()
+	var s span
+	if err := json.Unmarshal([]byte(qt.ToJSON()), &s); err != nil {
+		t.Fatalf("cannot unmarshal trace: %s", err)
+	}
+	if s.Message != `query=foo{bar="baz\n"}` {
+		t.Fatalf("unexpected message; got %q", s.Message)
+	}
+}
+
+func collectMessages(dst []string, s *span, prefix string) []string {
+	dst = append(dst, prefix+s.Message)
+	for _, child := range s.Children {
+		dst = collectMessages(dst, child, prefix+"-")
+	}
+	return dst
+}
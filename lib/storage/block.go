@@ -8,6 +8,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 )
 
@@ -37,6 +38,9 @@ type Block struct {
 
 	// Marshaled representation of values.
 	valuesData []byte
+
+	// deletedRanges contains time ranges with deleted samples, which must be removed in UnmarshalData.
+	deletedRanges []TimeRange
 }
 
 // Reset resets b.
@@ -49,6 +53,7 @@ func (b *Block) Reset() {
 	b.headerData = b.headerData[:0]
 	b.timestampsData = b.timestampsData[:0]
 	b.valuesData = b.valuesData[:0]
+	b.deletedRanges = b.deletedRanges[:0]
 }
 
 // CopyFrom copies src to b.
@@ -148,8 +153,14 @@ func (b *Block) tooBig() bool {
 }
 
 func (b *Block) deduplicateSamplesDuringMerge() {
-	if !isDedupEnabled() {
-		// Deduplication is disabled
+	if !isDedupEnabled() && !isDownsamplingEnabled() {
+		// Deduplication and downsampling are disabled
+		return
+	}
+	currentTimestamp := int64(fasttime.UnixTimestamp()) * 1000
+	if len(b.values) == 0 && getDedupIntervalForTimestamp(TimestampToMsecs(b.bh.MinTimestamp), currentTimestamp) <= 0 {
+		// Fast path - the oldest sample in the marshaled block doesn't need deduplication,
+		// so newer samples don't need it too.
 		return
 	}
 	// Unmarshal block if it isn't unmarshaled yet in order to apply the de-duplication to unmarshaled samples.
@@ -161,19 +172,55 @@ func (b *Block) deduplicateSamplesDuringMerge() {
 		// Nothing to dedup.
 		return
 	}
-	dedupInterval := GetDedupInterval()
-	if dedupInterval <= 0 {
-		// Deduplication is disabled.
+	if globalDedupStrategy == dedupStrategyAvg {
+		b.deduplicateSamplesDuringMergeAvg(currentTimestamp)
 		return
 	}
 	srcValues := b.values[b.nextIdx:]
-	timestamps, values := deduplicateSamplesDuringMerge(srcTimestamps, srcValues, dedupInterval)
+	var timestamps, values []int64
+	if isDownsamplingEnabled() {
+		timestamps, values = downsampleSamplesDuringMerge(srcTimestamps, srcValues, currentTimestamp)
+	} else {
+		dedupInterval := GetDedupInterval() * globalTimestampsPerMsec
+		timestamps, values = deduplicateSamplesDuringMerge(srcTimestamps, srcValues, dedupInterval)
+	}
 	dedups := len(srcTimestamps) - len(timestamps)
 	atomic.AddUint64(&dedupsDuringMerge, uint64(dedups))
 	b.timestamps = b.timestamps[:b.nextIdx+len(timestamps)]
 	b.values = b.values[:b.nextIdx+len(values)]
 }
 
+// deduplicateSamplesDuringMergeAvg deduplicates samples in b with dedupStrategyAvg.
+//
+// The average of decimal mantissas may need more decimal digits than b.bh.Scale allows,
+// so samples are averaged in float64 and then all the values in b are re-encoded with the new scale.
+//
+// The merge-time average is approximate: b doesn't know how many raw samples were averaged into
+// a sample by the previous merges, so such a sample has the same weight as a single raw sample.
+// This means that the result depends on the merge order if samples for the same interval are ingested with delays.
+func (b *Block) deduplicateSamplesDuringMergeAvg(currentTimestamp int64) {
+	srcTimestamps := b.timestamps[b.nextIdx:]
+	floatValues := decimal.AppendDecimalToFloat(nil, b.values, b.bh.Scale)
+	srcValues := floatValues[b.nextIdx:]
+	var timestamps []int64
+	var values []float64
+	if isDownsamplingEnabled() {
+		timestamps, values = downsampleSamples(srcTimestamps, srcValues, currentTimestamp)
+	} else {
+		dedupInterval := GetDedupInterval() * globalTimestampsPerMsec
+		timestamps, values = DeduplicateSamples(srcTimestamps, srcValues, dedupInterval)
+	}
+	dedups := len(srcTimestamps) - len(timestamps)
+	if dedups == 0 {
+		// Nothing has been deduplicated, so there is no need in re-encoding the values.
+		return
+	}
+	atomic.AddUint64(&dedupsDuringMerge, uint64(dedups))
+	b.timestamps = b.timestamps[:b.nextIdx+len(timestamps)]
+	floatValues = floatValues[:b.nextIdx+len(values)]
+	b.values, b.bh.Scale = decimal.AppendFloatToDecimal(b.values[:0], floatValues)
+}
+
 var dedupsDuringMerge uint64
 
 func (b *Block) rowsCount() int {
@@ -225,7 +272,7 @@ func (b *Block) MarshalData(timestampsBlockOffset, valuesBlockOffset uint64) ([]
 		logger.Panicf("BUG: the number of values must match the number of timestamps; got %d vs %d", len(values), len(timestamps))
 	}
 
-	b.valuesData, b.bh.ValuesMarshalType, b.bh.FirstValue = encoding.MarshalValues(b.valuesData[:0], values, b.bh.PrecisionBits)
+	b.valuesData, b.bh.ValuesMarshalType, b.bh.FirstValue = encoding.MarshalValues(b.valuesData[:0], values, b.bh.Scale, b.bh.PrecisionBits)
 	b.bh.ValuesBlockOffset = valuesBlockOffset
 	b.bh.ValuesBlockSize = uint32(len(b.valuesData))
 	b.values = b.values[:0]
@@ -275,7 +322,7 @@ func (b *Block) UnmarshalData() error {
 	}
 	b.timestampsData = b.timestampsData[:0]
 
-	b.values, err = encoding.UnmarshalValues(b.values[:0], b.valuesData, b.bh.ValuesMarshalType, b.bh.FirstValue, int(b.bh.RowsCount))
+	b.values, err = encoding.UnmarshalValues(b.values[:0], b.valuesData, b.bh.ValuesMarshalType, b.bh.FirstValue, b.bh.Scale, int(b.bh.RowsCount))
 	if err != nil {
 		return err
 	}
@@ -285,6 +332,12 @@ func (b *Block) UnmarshalData() error {
 		return fmt.Errorf("timestamps and values count mismatch; got %d vs %d", len(b.timestamps), len(b.values))
 	}
 
+	if len(b.deletedRanges) > 0 {
+		b.timestamps, b.values = removeDeletedSamples(b.timestamps, b.values, b.deletedRanges)
+		b.bh.RowsCount = uint32(len(b.timestamps))
+		b.deletedRanges = b.deletedRanges[:0]
+	}
+
 	b.nextIdx = 0
 
 	return nil
@@ -292,9 +345,18 @@ func (b *Block) UnmarshalData() error {
 
 // AppendRowsWithTimeRangeFilter filters samples from b according to tr and appends them to dst*.
 //
+// tr must be in milliseconds, while the appended timestamps are in the storage precision. See TimestampsPerMsec.
+//
 // It is expected that UnmarshalData has been already called on b.
 func (b *Block) AppendRowsWithTimeRangeFilter(dstTimestamps []int64, dstValues []float64, tr TimeRange) ([]int64, []float64) {
-	timestamps, values := b.filterTimestamps(tr)
+	return b.AppendRowsWithTimeRangeFilterExt(dstTimestamps, dstValues, tr, globalTimestampsPerMsec)
+}
+
+// AppendRowsWithTimeRangeFilterExt is like AppendRowsWithTimeRangeFilter, but b timestamps may have arbitrary precision.
+//
+// timestampsPerMsec is the number of b timestamp units per millisecond.
+func (b *Block) AppendRowsWithTimeRangeFilterExt(dstTimestamps []int64, dstValues []float64, tr TimeRange, timestampsPerMsec int64) ([]int64, []float64) {
+	timestamps, values := b.filterTimestamps(tr.toTimestamps(timestampsPerMsec))
 	dstTimestamps = append(dstTimestamps, timestamps...)
 	dstValues = decimal.AppendDecimalToFloat(dstValues, values, b.bh.Scale)
 	return dstTimestamps, dstValues
@@ -321,10 +383,40 @@ func (b *Block) filterTimestamps(tr TimeRange) ([]int64, []int64) {
 	return timestamps[i:j], b.values[i:j]
 }
 
+// MarshalPortableExt is like MarshalPortable, but converts b timestamps from the storage precision
+// to timestampsPerMsec units per millisecond before marshaling.
+//
+// Timestamps are rounded down when converting to lower precision, so samples with duplicate timestamps may appear.
+func (b *Block) MarshalPortableExt(dst []byte, timestampsPerMsec int64) []byte {
+	if timestampsPerMsec != globalTimestampsPerMsec {
+		if err := b.UnmarshalData(); err != nil {
+			logger.Panicf("FATAL: cannot unmarshal block: %s", err)
+		}
+		timestamps := b.timestamps[b.nextIdx:]
+		if len(timestamps) == 0 {
+			return dst
+		}
+		ConvertTimestamps(timestamps, globalTimestampsPerMsec, timestampsPerMsec)
+		b.fixupTimestamps()
+	}
+	return b.MarshalPortable(dst)
+}
+
 // MarshalPortable marshals b to dst, so it could be portably migrated to other VictoriaMetrics instance.
 //
 // The marshaled value must be unmarshaled with UnmarshalPortable function.
+//
+// dst is returned unchanged if all the samples in b are deleted.
 func (b *Block) MarshalPortable(dst []byte) []byte {
+	if len(b.deletedRanges) > 0 {
+		// Remove deleted samples before marshaling.
+		if err := b.UnmarshalData(); err != nil {
+			logger.Panicf("FATAL: cannot unmarshal block: %s", err)
+		}
+		if len(b.values) == 0 {
+			return dst
+		}
+	}
 	b.MarshalData(0, 0)
 
 	dst = encoding.MarshalVarInt64(dst, b.bh.MinTimestamp)
@@ -103,6 +103,11 @@ func (bsm *blockStreamMerger) nextBlock() error {
 	return nil
 }
 
+// Tombstones returns tombstones, which must be applied to bsm.Block.
+func (bsm *blockStreamMerger) Tombstones() *tombstones {
+	return bsm.bsrHeap[0].tss
+}
+
 func (bsm *blockStreamMerger) Error() error {
 	if bsm.err == io.EOF {
 		return nil
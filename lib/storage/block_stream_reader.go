@@ -65,6 +65,11 @@ type blockStreamReader struct {
 	// Cursor to indexData.
 	indexCursor []byte
 
+	// Tombstones, which must be applied to blocks read from the stream during the merge.
+	//
+	// May be nil.
+	tss *tombstones
+
 	err error
 }
 
@@ -98,6 +103,8 @@ func (bsr *blockStreamReader) reset() {
 	bsr.prevTimestampsBlockOffset = 0
 	bsr.prevTimestampsData = bsr.prevTimestampsData[:0]
 
+	bsr.tss = nil
+
 	bsr.indexData = bsr.indexData[:0]
 	bsr.compressedIndexData = bsr.compressedIndexData[:0]
 
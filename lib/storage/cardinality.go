@@ -0,0 +1,333 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+)
+
+// CardinalityStatus contains cardinality explorer data for /api/v1/status/cardinality.
+//
+// Entries contain counts for the requested time range and for the previous time range with the same duration.
+type CardinalityStatus struct {
+	// TotalSeries is the number of unique series on the requested time range.
+	TotalSeries uint64
+
+	// PrevTotalSeries is the number of unique series on the previous time range.
+	PrevTotalSeries uint64
+
+	SeriesCountByMetricName      []CardinalityEntry
+	LabelValueCountByLabelName   []CardinalityEntry
+	SeriesCountByLabelValuePair  []CardinalityEntry
+	SeriesCountByFocusLabelValue []CardinalityEntry
+
+	// SeriesGrowthByMetricName and SeriesGrowthByLabelValuePair contain entries
+	// with the biggest series count growth comparing to the previous time range.
+	SeriesGrowthByMetricName     []CardinalityEntry
+	SeriesGrowthByLabelValuePair []CardinalityEntry
+}
+
+// CardinalityEntry represents an entry in CardinalityStatus.
+type CardinalityEntry struct {
+	Name string
+
+	// Count is the count for the requested time range.
+	Count uint64
+
+	// PrevCount is the count for the previous time range.
+	PrevCount uint64
+}
+
+// Growth returns the difference between e.Count and e.PrevCount.
+func (e *CardinalityEntry) Growth() int64 {
+	return int64(e.Count) - int64(e.PrevCount)
+}
+
+// GetCardinalityStatus returns cardinality explorer data for series matching tfss on the given tr.
+//
+// Entries for series with focusLabel are returned in SeriesCountByFocusLabelValue if focusLabel isn't empty.
+// Up to topN entries are returned per each list.
+//
+// The returned counts are compared against the previous time range with the same duration as tr.
+// An error is returned if more than maxItems unique series per `label=value` pairs must be tracked for any of these time ranges.
+func (s *Storage) GetCardinalityStatus(tfss []*TagFilters, tr TimeRange, focusLabel string, topN, maxItems int, deadline uint64) (*CardinalityStatus, error) {
+	return s.idb().GetCardinalityStatus(tfss, tr, focusLabel, topN, maxItems, deadline)
+}
+
+// GetCardinalityStatus returns cardinality explorer data for series matching tfss on the given tr.
+func (db *indexDB) GetCardinalityStatus(tfss []*TagFilters, tr TimeRange, focusLabel string, topN, maxItems int, deadline uint64) (*CardinalityStatus, error) {
+	if tr.MinTimestamp > tr.MaxTimestamp {
+		return nil, fmt.Errorf("start=%d cannot exceed end=%d", tr.MinTimestamp, tr.MaxTimestamp)
+	}
+	minDate := uint64(tr.MinTimestamp) / msecPerDay
+	maxDate := uint64(tr.MaxTimestamp) / msecPerDay
+	days := maxDate - minDate + 1
+	prevTr := TimeRange{
+		MinTimestamp: int64(minDate-days) * msecPerDay,
+		MaxTimestamp: int64(minDate)*msecPerDay - 1,
+	}
+	if minDate < days {
+		prevTr = TimeRange{}
+	}
+
+	cc := newCardinalityCollector(maxItems)
+	if err := db.collectCardinality(cc, tfss, tr, deadline); err != nil {
+		return nil, err
+	}
+	ccPrev := newCardinalityCollector(maxItems)
+	if prevTr.MaxTimestamp > 0 {
+		if err := db.collectCardinality(ccPrev, tfss, prevTr, deadline); err != nil {
+			return nil, err
+		}
+	}
+	return cc.getStatus(ccPrev, focusLabel, topN), nil
+}
+
+// collectCardinality collects series for tfss on the given tr from db and extDB into cc.
+func (db *indexDB) collectCardinality(cc *cardinalityCollector, tfss []*TagFilters, tr TimeRange, deadline uint64) error {
+	is := db.getIndexSearch(deadline)
+	err := is.collectCardinality(cc, tfss, tr)
+	db.putIndexSearch(is)
+	if err != nil {
+		return err
+	}
+	ok := db.doExtDB(func(extDB *indexDB) {
+		is := extDB.getIndexSearch(deadline)
+		err = is.collectCardinality(cc, tfss, tr)
+		extDB.putIndexSearch(is)
+	})
+	if ok && err != nil {
+		return fmt.Errorf("error when collecting cardinality from extDB: %w", err)
+	}
+	return nil
+}
+
+func (is *indexSearch) collectCardinality(cc *cardinalityCollector, tfss []*TagFilters, tr TimeRange) error {
+	var filter *uint64set.Set
+	if len(tfss) > 0 {
+		metricIDs, err := is.searchMetricIDsInternal(tfss, tr, 2e9)
+		if err != nil {
+			return err
+		}
+		if metricIDs.Len() == 0 {
+			// Nothing found.
+			return nil
+		}
+		filter = metricIDs
+	}
+	minDate := uint64(tr.MinTimestamp) / msecPerDay
+	maxDate := uint64(tr.MaxTimestamp) / msecPerDay
+	for date := minDate; date <= maxDate; date++ {
+		if err := is.collectCardinalityForDate(cc, filter, date); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (is *indexSearch) collectCardinalityForDate(cc *cardinalityCollector, filter *uint64set.Set, date uint64) error {
+	ts := &is.ts
+	kb := &is.kb
+	mp := &is.mp
+	var tmp []byte
+
+	loopsPaceLimiter := 0
+	kb.B = is.marshalCommonPrefix(kb.B[:0], nsPrefixDateTagToMetricIDs)
+	kb.B = encoding.MarshalUint64(kb.B, date)
+	prefix := kb.B
+	ts.Seek(prefix)
+	for ts.NextItem() {
+		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
+				return err
+			}
+		}
+		loopsPaceLimiter++
+		item := ts.Item
+		if !bytes.HasPrefix(item, prefix) {
+			break
+		}
+		tail := item[len(prefix):]
+		var err error
+		tail, tmp, err = unmarshalTagValue(tmp[:0], tail)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal tag key from line %q: %w", item, err)
+		}
+		if isArtificialTagKey(tmp) {
+			// Skip artificially created tag keys.
+			kb.B = append(kb.B[:0], prefix...)
+			if len(tmp) > 0 && tmp[0] == compositeTagKeyPrefix {
+				kb.B = append(kb.B, compositeTagKeyPrefix)
+			} else {
+				kb.B = marshalTagValue(kb.B, tmp)
+			}
+			kb.B[len(kb.B)-1]++
+			ts.Seek(kb.B)
+			continue
+		}
+		if len(tmp) == 0 {
+			tmp = append(tmp, "__name__"...)
+		}
+		tmp = append(tmp, '=')
+		tail, tmp, err = unmarshalTagValue(tmp, tail)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal tag value from line %q: %w", item, err)
+		}
+		if err := mp.InitOnlyTail(item, tail); err != nil {
+			return err
+		}
+		mp.ParseMetricIDs()
+		if err := cc.add(tmp, mp.MetricIDs, filter); err != nil {
+			return err
+		}
+	}
+	if err := ts.Error(); err != nil {
+		return fmt.Errorf("error when collecting cardinality for date=%d: %w", date, err)
+	}
+	return nil
+}
+
+// cardinalityCollector collects unique series per each `label=value` pair.
+type cardinalityCollector struct {
+	pairs map[string]*uint64set.Set
+
+	// items is the number of unique series tracked across all the pairs.
+	items int
+
+	// maxItems is the maximum number of items the collector may track.
+	maxItems int
+}
+
+func newCardinalityCollector(maxItems int) *cardinalityCollector {
+	return &cardinalityCollector{
+		pairs:    make(map[string]*uint64set.Set),
+		maxItems: maxItems,
+	}
+}
+
+// add adds metricIDs matching the filter to the given `label=value` pair.
+//
+// All the metricIDs are added if filter is nil.
+// An error is returned if the number of tracked series exceeds cc.maxItems.
+func (cc *cardinalityCollector) add(pair []byte, metricIDs []uint64, filter *uint64set.Set) error {
+	m := cc.pairs[string(pair)]
+	for _, metricID := range metricIDs {
+		if filter != nil && !filter.Has(metricID) {
+			continue
+		}
+		if m == nil {
+			m = &uint64set.Set{}
+			cc.pairs[string(pair)] = m
+		}
+		if m.Has(metricID) {
+			continue
+		}
+		if cc.items >= cc.maxItems {
+			return fmt.Errorf("the number of unique series per label=value pairs exceeds %d; either narrow down the time range and the match[] filter "+
+				"or increase -search.maxCardinalityItems", cc.maxItems)
+		}
+		m.Add(metricID)
+		cc.items++
+	}
+	return nil
+}
+
+// getStatus returns cardinality status for cc compared to ccPrev.
+func (cc *cardinalityCollector) getStatus(ccPrev *cardinalityCollector, focusLabel string, topN int) *CardinalityStatus {
+	nameEqual := "__name__="
+	focusLabelEqual := focusLabel + "="
+	var metricNames, labelValuePairs, focusLabelValues []CardinalityEntry
+	labelValueCounts := make(map[string]*CardinalityEntry)
+	addLabelValueCount := func(pair string, isPrev bool) {
+		n := strings.IndexByte(pair, '=')
+		if n < 0 {
+			return
+		}
+		labelName := pair[:n]
+		e := labelValueCounts[labelName]
+		if e == nil {
+			e = &CardinalityEntry{
+				Name: labelName,
+			}
+			labelValueCounts[labelName] = e
+		}
+		if isPrev {
+			e.PrevCount++
+		} else {
+			e.Count++
+		}
+	}
+	var all uint64set.Set
+	for pair, m := range cc.pairs {
+		all.Union(m)
+		e := CardinalityEntry{
+			Name:  pair,
+			Count: uint64(m.Len()),
+		}
+		if mPrev := ccPrev.pairs[pair]; mPrev != nil {
+			e.PrevCount = uint64(mPrev.Len())
+		}
+		labelValuePairs = append(labelValuePairs, e)
+		if strings.HasPrefix(pair, nameEqual) {
+			e.Name = pair[len(nameEqual):]
+			metricNames = append(metricNames, e)
+		}
+		if focusLabel != "" && strings.HasPrefix(pair, focusLabelEqual) {
+			e.Name = pair[len(focusLabelEqual):]
+			focusLabelValues = append(focusLabelValues, e)
+		}
+		addLabelValueCount(pair, false)
+	}
+	var allPrev uint64set.Set
+	for pair, m := range ccPrev.pairs {
+		allPrev.Union(m)
+		addLabelValueCount(pair, true)
+	}
+	var labelNames []CardinalityEntry
+	for _, e := range labelValueCounts {
+		if e.Count > 0 {
+			labelNames = append(labelNames, *e)
+		}
+	}
+	return &CardinalityStatus{
+		TotalSeries:                  uint64(all.Len()),
+		PrevTotalSeries:              uint64(allPrev.Len()),
+		SeriesCountByMetricName:      getTopCardinalityEntries(metricNames, topN, false),
+		LabelValueCountByLabelName:   getTopCardinalityEntries(labelNames, topN, false),
+		SeriesCountByLabelValuePair:  getTopCardinalityEntries(labelValuePairs, topN, false),
+		SeriesCountByFocusLabelValue: getTopCardinalityEntries(focusLabelValues, topN, false),
+		SeriesGrowthByMetricName:     getTopCardinalityEntries(metricNames, topN, true),
+		SeriesGrowthByLabelValuePair: getTopCardinalityEntries(labelValuePairs, topN, true),
+	}
+}
+
+// getTopCardinalityEntries returns up to topN entries from a with the biggest counts.
+//
+// Entries with the biggest positive growth are returned instead if byGrowth is set.
+func getTopCardinalityEntries(a []CardinalityEntry, topN int, byGrowth bool) []CardinalityEntry {
+	result := make([]CardinalityEntry, 0, len(a))
+	for _, e := range a {
+		if byGrowth && e.Growth() <= 0 {
+			continue
+		}
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := &result[i], &result[j]
+		if byGrowth && a.Growth() != b.Growth() {
+			return a.Growth() > b.Growth()
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+	if len(result) > topN {
+		result = result[:topN]
+	}
+	return result
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorageGetCardinalityStatus(t *testing.T) {
+	path := "TestStorageGetCardinalityStatus"
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	now := time.Now().UnixNano() / 1e6
+	today := now - now%msecPerDay
+	yesterday := today - msecPerDay
+	addSeries := func(timestamp int64, metricGroup string, jobs int) {
+		t.Helper()
+		var mrs []MetricRow
+		for i := 0; i < jobs; i++ {
+			var mn MetricName
+			mn.MetricGroup = []byte(metricGroup)
+			mn.AddTag("job", fmt.Sprintf("job_%d", i))
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: mn.marshalRaw(nil),
+				Timestamp:     timestamp,
+				Value:         1,
+			})
+		}
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+	}
+	addSeries(yesterday, "foo", 2)
+	addSeries(yesterday, "bar", 3)
+	addSeries(today, "foo", 5)
+	addSeries(today, "bar", 3)
+	s.DebugFlush()
+
+	trToday := TimeRange{
+		MinTimestamp: today,
+		MaxTimestamp: today + msecPerDay - 1,
+	}
+	status, err := s.GetCardinalityStatus(nil, trToday, "job", 10, 1e6, noDeadline)
+	if err != nil {
+		t.Fatalf("cannot obtain cardinality status: %s", err)
+	}
+	if status.TotalSeries != 8 {
+		t.Fatalf("unexpected TotalSeries; got %d; want 8", status.TotalSeries)
+	}
+	if status.PrevTotalSeries != 5 {
+		t.Fatalf("unexpected PrevTotalSeries; got %d; want 5", status.PrevTotalSeries)
+	}
+	metricNamesExpected := []CardinalityEntry{
+		{Name: "foo", Count: 5, PrevCount: 2},
+		{Name: "bar", Count: 3, PrevCount: 3},
+	}
+	if !reflect.DeepEqual(status.SeriesCountByMetricName, metricNamesExpected) {
+		t.Fatalf("unexpected SeriesCountByMetricName\ngot\n%v\nwant\n%v", status.SeriesCountByMetricName, metricNamesExpected)
+	}
+	labelNamesExpected := []CardinalityEntry{
+		{Name: "job", Count: 5, PrevCount: 3},
+		{Name: "__name__", Count: 2, PrevCount: 2},
+	}
+	if !reflect.DeepEqual(status.LabelValueCountByLabelName, labelNamesExpected) {
+		t.Fatalf("unexpected LabelValueCountByLabelName\ngot\n%v\nwant\n%v", status.LabelValueCountByLabelName, labelNamesExpected)
+	}
+	if len(status.SeriesCountByFocusLabelValue) != 5 {
+		t.Fatalf("unexpected number of focus label values; got %d; want 5", len(status.SeriesCountByFocusLabelValue))
+	}
+	e := status.SeriesCountByFocusLabelValue[0]
+	if e.Name != "job_0" || e.Count != 2 || e.PrevCount != 2 {
+		t.Fatalf("unexpected first focus label value entry: %+v", e)
+	}
+	growthExpected := []CardinalityEntry{
+		{Name: "foo", Count: 5, PrevCount: 2},
+	}
+	if !reflect.DeepEqual(status.SeriesGrowthByMetricName, growthExpected) {
+		t.Fatalf("unexpected SeriesGrowthByMetricName\ngot\n%v\nwant\n%v", status.SeriesGrowthByMetricName, growthExpected)
+	}
+	if len(status.SeriesGrowthByLabelValuePair) != 4 || status.SeriesGrowthByLabelValuePair[0].Name != "__name__=foo" {
+		t.Fatalf("unexpected SeriesGrowthByLabelValuePair: %v", status.SeriesGrowthByLabelValuePair)
+	}
+
+	// Time range covering both days.
+	trBoth := TimeRange{
+		MinTimestamp: yesterday,
+		MaxTimestamp: today + msecPerDay - 1,
+	}
+	status, err = s.GetCardinalityStatus(nil, trBoth, "", 1, 1e6, noDeadline)
+	if err != nil {
+		t.Fatalf("cannot obtain cardinality status: %s", err)
+	}
+	if status.TotalSeries != 8 || status.PrevTotalSeries != 0 {
+		t.Fatalf("unexpected total series; got %d, %d; want 8, 0", status.TotalSeries, status.PrevTotalSeries)
+	}
+	if len(status.SeriesCountByMetricName) != 1 || status.SeriesCountByMetricName[0].Name != "foo" {
+		t.Fatalf("unexpected SeriesCountByMetricName: %v", status.SeriesCountByMetricName)
+	}
+	if len(status.SeriesCountByFocusLabelValue) != 0 {
+		t.Fatalf("unexpected SeriesCountByFocusLabelValue for empty focusLabel: %v", status.SeriesCountByFocusLabelValue)
+	}
+
+	// Filter by metric name.
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("bar"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	status, err = s.GetCardinalityStatus([]*TagFilters{tfs}, trToday, "", 10, 1e6, noDeadline)
+	if err != nil {
+		t.Fatalf("cannot obtain cardinality status: %s", err)
+	}
+	metricNamesExpected = []CardinalityEntry{
+		{Name: "bar", Count: 3, PrevCount: 3},
+	}
+	if !reflect.DeepEqual(status.SeriesCountByMetricName, metricNamesExpected) {
+		t.Fatalf("unexpected SeriesCountByMetricName with filters\ngot\n%v\nwant\n%v", status.SeriesCountByMetricName, metricNamesExpected)
+	}
+	if len(status.SeriesGrowthByMetricName) != 0 {
+		t.Fatalf("unexpected SeriesGrowthByMetricName with filters: %v", status.SeriesGrowthByMetricName)
+	}
+
+	// Too many series per label=value pairs.
+	if _, err := s.GetCardinalityStatus(nil, trToday, "", 10, 5, noDeadline); err == nil {
+		t.Fatalf("expecting non-nil error when the number of tracked series exceeds maxItems")
+	}
+}
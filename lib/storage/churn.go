@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+)
+
+// ChurnStatus contains series churn stats for a single day or hour.
+type ChurnStatus struct {
+	// Timestamp is the start of the day or hour in milliseconds.
+	Timestamp int64
+
+	// IsPartial is set if the stats is collected for the current day or hour, which isn't finished yet.
+	IsPartial bool
+
+	// AppearedSeries is the number of series, which received samples during the day or hour,
+	// but didn't receive samples during the previous day or hour.
+	AppearedSeries uint64
+
+	// DisappearedSeries is the number of series, which received samples during the previous day or hour,
+	// but didn't receive samples during the day or hour.
+	DisappearedSeries uint64
+
+	// ByMetricName contains top metric names with the biggest churn.
+	ByMetricName []MetricNameChurn
+}
+
+// MetricNameChurn contains series churn stats for a single metric name.
+type MetricNameChurn struct {
+	Name              string
+	AppearedSeries    uint64
+	DisappearedSeries uint64
+}
+
+// GetDailyChurn returns daily series churn stats for days on the given tr.
+//
+// Up to topN metric names with the biggest churn are returned per every day.
+func (s *Storage) GetDailyChurn(tr TimeRange, topN int, deadline uint64) ([]ChurnStatus, error) {
+	if tr.MinTimestamp > tr.MaxTimestamp {
+		return nil, fmt.Errorf("start=%d cannot exceed end=%d", tr.MinTimestamp, tr.MaxTimestamp)
+	}
+	idb := s.idb()
+	minDate := uint64(tr.MinTimestamp) / msecPerDay
+	maxDate := uint64(tr.MaxTimestamp) / msecPerDay
+	currDate := fasttime.UnixDate()
+	var prev map[string]*uint64set.Set
+	if minDate > 0 {
+		m, err := idb.getMetricIDsByMetricNameForDate(minDate-1, deadline)
+		if err != nil {
+			return nil, err
+		}
+		prev = m
+	}
+	var result []ChurnStatus
+	for date := minDate; date <= maxDate; date++ {
+		curr, err := idb.getMetricIDsByMetricNameForDate(date, deadline)
+		if err != nil {
+			return nil, err
+		}
+		cs := getChurnStatus(prev, curr, topN)
+		cs.Timestamp = int64(date) * msecPerDay
+		cs.IsPartial = date >= currDate
+		result = append(result, cs)
+		prev = curr
+	}
+	return result, nil
+}
+
+// GetHourlyChurn returns hourly series churn stats for the last finished hour and for the current hour.
+//
+// The stats is available only for hours tracked by the storage since its start.
+// Up to topN metric names with the biggest churn are returned per every hour.
+func (s *Storage) GetHourlyChurn(topN int, deadline uint64) ([]ChurnStatus, error) {
+	var result []ChurnStatus
+	if hc := s.lastHourChurn.Load().(*hourChurn); hc.appeared != nil {
+		cs, err := s.getChurnStatusForMetricIDs(hc.appeared, hc.disappeared, topN, deadline)
+		if err != nil {
+			return nil, err
+		}
+		cs.Timestamp = int64(hc.hour) * 3600 * 1000
+		result = append(result, cs)
+	}
+	hmCurr := s.currHourMetricIDs.Load().(*hourMetricIDs)
+	hmPrev := s.prevHourMetricIDs.Load().(*hourMetricIDs)
+	if hc := newHourChurn(hmPrev, hmCurr); hc != nil {
+		cs, err := s.getChurnStatusForMetricIDs(hc.appeared, hc.disappeared, topN, deadline)
+		if err != nil {
+			return nil, err
+		}
+		cs.Timestamp = int64(hc.hour) * 3600 * 1000
+		cs.IsPartial = true
+		result = append(result, cs)
+	}
+	return result, nil
+}
+
+// hourChurn contains metricIDs for series, which appeared and disappeared during the hour.
+type hourChurn struct {
+	hour        uint64
+	appeared    *uint64set.Set
+	disappeared *uint64set.Set
+}
+
+// newHourChurn returns series churn for hm comparing to hmPrev.
+//
+// nil is returned if hm and hmPrev aren't adjacent hours or if they have incomplete sets of metricIDs.
+func newHourChurn(hmPrev, hm *hourMetricIDs) *hourChurn {
+	if hmPrev.hour+1 != hm.hour || !hmPrev.isFull || !hm.isFull {
+		return nil
+	}
+	appeared := hm.m.Clone()
+	appeared.Subtract(hmPrev.m)
+	disappeared := hmPrev.m.Clone()
+	disappeared.Subtract(hm.m)
+	return &hourChurn{
+		hour:        hm.hour,
+		appeared:    appeared,
+		disappeared: disappeared,
+	}
+}
+
+// updateLastHourChurn updates s.lastHourChurn for the finished hour hm.
+func (s *Storage) updateLastHourChurn(hmPrev, hm *hourMetricIDs) {
+	hc := newHourChurn(hmPrev, hm)
+	if hc == nil {
+		hc = &hourChurn{}
+	}
+	s.lastHourChurn.Store(hc)
+}
+
+// getChurnStatusForMetricIDs returns churn stats for the given appeared and disappeared metricIDs.
+func (s *Storage) getChurnStatusForMetricIDs(appeared, disappeared *uint64set.Set, topN int, deadline uint64) (ChurnStatus, error) {
+	idb := s.idb()
+	byMetricName := make(map[string]*MetricNameChurn)
+	var metricName []byte
+	var mn MetricName
+	addMetricIDs := func(metricIDs *uint64set.Set, isAppeared bool) error {
+		loopsPaceLimiter := 0
+		for _, metricID := range metricIDs.AppendTo(nil) {
+			if loopsPaceLimiter&paceLimiterSlowIterationsMask == 0 {
+				if err := checkSearchDeadlineAndPace(deadline, nil); err != nil {
+					return err
+				}
+			}
+			loopsPaceLimiter++
+			var err error
+			metricName, err = idb.searchMetricNameWithCache(metricName[:0], metricID)
+			if err != nil {
+				if err == io.EOF {
+					// The series has been deleted.
+					continue
+				}
+				return fmt.Errorf("cannot find metric name for metricID=%d: %w", metricID, err)
+			}
+			if err := mn.Unmarshal(metricName); err != nil {
+				return fmt.Errorf("cannot unmarshal metric name for metricID=%d: %w", metricID, err)
+			}
+			e := byMetricName[string(mn.MetricGroup)]
+			if e == nil {
+				e = &MetricNameChurn{
+					Name: string(mn.MetricGroup),
+				}
+				byMetricName[e.Name] = e
+			}
+			if isAppeared {
+				e.AppearedSeries++
+			} else {
+				e.DisappearedSeries++
+			}
+		}
+		return nil
+	}
+	if err := addMetricIDs(appeared, true); err != nil {
+		return ChurnStatus{}, err
+	}
+	if err := addMetricIDs(disappeared, false); err != nil {
+		return ChurnStatus{}, err
+	}
+	var cs ChurnStatus
+	for _, e := range byMetricName {
+		cs.AppearedSeries += e.AppearedSeries
+		cs.DisappearedSeries += e.DisappearedSeries
+		cs.ByMetricName = append(cs.ByMetricName, *e)
+	}
+	cs.ByMetricName = getTopMetricNameChurns(cs.ByMetricName, topN)
+	return cs, nil
+}
+
+// getChurnStatus returns churn stats for metricIDs per metric name in curr comparing to prev.
+func getChurnStatus(prev, curr map[string]*uint64set.Set, topN int) ChurnStatus {
+	var cs ChurnStatus
+	addEntry := func(name string, appeared, disappeared int) {
+		if appeared == 0 && disappeared == 0 {
+			return
+		}
+		cs.AppearedSeries += uint64(appeared)
+		cs.DisappearedSeries += uint64(disappeared)
+		cs.ByMetricName = append(cs.ByMetricName, MetricNameChurn{
+			Name:              name,
+			AppearedSeries:    uint64(appeared),
+			DisappearedSeries: uint64(disappeared),
+		})
+	}
+	for name, m := range curr {
+		mPrev := prev[name]
+		if mPrev == nil {
+			addEntry(name, m.Len(), 0)
+			continue
+		}
+		appeared := m.Clone()
+		appeared.Subtract(mPrev)
+		disappeared := mPrev.Clone()
+		disappeared.Subtract(m)
+		addEntry(name, appeared.Len(), disappeared.Len())
+	}
+	for name, mPrev := range prev {
+		if _, ok := curr[name]; !ok {
+			addEntry(name, 0, mPrev.Len())
+		}
+	}
+	cs.ByMetricName = getTopMetricNameChurns(cs.ByMetricName, topN)
+	return cs
+}
+
+// getTopMetricNameChurns returns up to topN entries from a with the biggest churn.
+func getTopMetricNameChurns(a []MetricNameChurn, topN int) []MetricNameChurn {
+	sort.Slice(a, func(i, j int) bool {
+		ci := a[i].AppearedSeries + a[i].DisappearedSeries
+		cj := a[j].AppearedSeries + a[j].DisappearedSeries
+		if ci != cj {
+			return ci > cj
+		}
+		return a[i].Name < a[j].Name
+	})
+	if len(a) > topN {
+		a = a[:topN]
+	}
+	return a
+}
+
+// getMetricIDsByMetricNameForDate returns metricIDs per metric name for the given date from db and extDB.
+func (db *indexDB) getMetricIDsByMetricNameForDate(date uint64, deadline uint64) (map[string]*uint64set.Set, error) {
+	m := make(map[string]*uint64set.Set)
+	is := db.getIndexSearch(deadline)
+	err := is.updateMetricIDsByMetricNameForDate(m, date)
+	db.putIndexSearch(is)
+	if err != nil {
+		return nil, err
+	}
+	ok := db.doExtDB(func(extDB *indexDB) {
+		is := extDB.getIndexSearch(deadline)
+		err = is.updateMetricIDsByMetricNameForDate(m, date)
+		extDB.putIndexSearch(is)
+	})
+	if ok && err != nil {
+		return nil, fmt.Errorf("error when searching for metricIDs by metric name in extDB: %w", err)
+	}
+	return m, nil
+}
+
+func (is *indexSearch) updateMetricIDsByMetricNameForDate(m map[string]*uint64set.Set, date uint64) error {
+	ts := &is.ts
+	kb := &is.kb
+	mp := &is.mp
+	mp.Reset()
+	loopsPaceLimiter := 0
+	kb.B = is.marshalCommonPrefix(kb.B[:0], nsPrefixDateTagToMetricIDs)
+	kb.B = encoding.MarshalUint64(kb.B, date)
+	kb.B = marshalTagValue(kb.B, nil)
+	prefix := kb.B
+	ts.Seek(prefix)
+	for ts.NextItem() {
+		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
+				return err
+			}
+		}
+		loopsPaceLimiter++
+		item := ts.Item
+		if !bytes.HasPrefix(item, prefix) {
+			break
+		}
+		if err := mp.Init(item, nsPrefixDateTagToMetricIDs); err != nil {
+			return err
+		}
+		mp.ParseMetricIDs()
+		metricIDs := m[string(mp.Tag.Value)]
+		if metricIDs == nil {
+			metricIDs = &uint64set.Set{}
+			m[string(mp.Tag.Value)] = metricIDs
+		}
+		metricIDs.AddMulti(mp.MetricIDs)
+	}
+	if err := ts.Error(); err != nil {
+		return fmt.Errorf("error when searching for metricIDs by metric name for date=%d: %w", date, err)
+	}
+	return nil
+}
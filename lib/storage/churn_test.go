@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+)
+
+func TestNewHourChurn(t *testing.T) {
+	newHM := func(hour uint64, isFull bool, metricIDs ...uint64) *hourMetricIDs {
+		var m uint64set.Set
+		m.AddMulti(metricIDs)
+		return &hourMetricIDs{
+			m:      &m,
+			hour:   hour,
+			isFull: isFull,
+		}
+	}
+	f := func(hmPrev, hm *hourMetricIDs, appearedExpected, disappearedExpected []uint64) {
+		t.Helper()
+		hc := newHourChurn(hmPrev, hm)
+		if appearedExpected == nil {
+			if hc != nil {
+				t.Fatalf("expecting nil churn; got %v", hc)
+			}
+			return
+		}
+		if hc.hour != hm.hour {
+			t.Fatalf("unexpected hour; got %d; want %d", hc.hour, hm.hour)
+		}
+		if appeared := hc.appeared.AppendTo([]uint64{}); !reflect.DeepEqual(appeared, appearedExpected) {
+			t.Fatalf("unexpected appeared metricIDs; got %v; want %v", appeared, appearedExpected)
+		}
+		if disappeared := hc.disappeared.AppendTo([]uint64{}); !reflect.DeepEqual(disappeared, disappearedExpected) {
+			t.Fatalf("unexpected disappeared metricIDs; got %v; want %v", disappeared, disappearedExpected)
+		}
+	}
+	f(newHM(10, true, 1, 2, 3), newHM(11, true, 2, 3, 4, 5), []uint64{4, 5}, []uint64{1})
+	f(newHM(10, true, 1, 2), newHM(11, true, 1, 2), []uint64{}, []uint64{})
+	f(newHM(10, true), newHM(11, true, 1), []uint64{1}, []uint64{})
+
+	// Non-adjacent hours
+	f(newHM(9, true, 1, 2, 3), newHM(11, true, 2, 3, 4, 5), nil, nil)
+
+	// Incomplete hours
+	f(newHM(10, false, 1, 2, 3), newHM(11, true, 2, 3, 4, 5), nil, nil)
+	f(newHM(10, true, 1, 2, 3), newHM(11, false, 2, 3, 4, 5), nil, nil)
+}
+
+func TestGetChurnStatus(t *testing.T) {
+	newSet := func(metricIDs ...uint64) *uint64set.Set {
+		var m uint64set.Set
+		m.AddMulti(metricIDs)
+		return &m
+	}
+	prev := map[string]*uint64set.Set{
+		"foo": newSet(1, 2, 3),
+		"bar": newSet(4, 5),
+		"baz": newSet(6),
+	}
+	curr := map[string]*uint64set.Set{
+		"foo": newSet(2, 3, 7, 8, 9),
+		"bar": newSet(4, 5),
+		"qux": newSet(10),
+	}
+	cs := getChurnStatus(prev, curr, 10)
+	csExpected := ChurnStatus{
+		AppearedSeries:    4,
+		DisappearedSeries: 2,
+		ByMetricName: []MetricNameChurn{
+			{Name: "foo", AppearedSeries: 3, DisappearedSeries: 1},
+			{Name: "baz", AppearedSeries: 0, DisappearedSeries: 1},
+			{Name: "qux", AppearedSeries: 1, DisappearedSeries: 0},
+		},
+	}
+	if !reflect.DeepEqual(cs, csExpected) {
+		t.Fatalf("unexpected churn status\ngot\n%+v\nwant\n%+v", cs, csExpected)
+	}
+
+	// topN must limit the number of returned metric names.
+	cs = getChurnStatus(prev, curr, 1)
+	if cs.AppearedSeries != 4 || cs.DisappearedSeries != 2 || len(cs.ByMetricName) != 1 || cs.ByMetricName[0].Name != "foo" {
+		t.Fatalf("unexpected churn status for topN=1: %+v", cs)
+	}
+
+	// Missing previous day.
+	cs = getChurnStatus(nil, curr, 10)
+	if cs.AppearedSeries != 8 || cs.DisappearedSeries != 0 {
+		t.Fatalf("unexpected churn status without previous day: %+v", cs)
+	}
+}
+
+func TestStorageGetDailyChurn(t *testing.T) {
+	path := "TestStorageGetDailyChurn"
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	now := time.Now().UnixNano() / 1e6
+	today := now - now%msecPerDay
+	yesterday := today - msecPerDay
+	addSeries := func(timestamp int64, metricGroup string, pods ...int) {
+		t.Helper()
+		var mrs []MetricRow
+		for _, pod := range pods {
+			var mn MetricName
+			mn.MetricGroup = []byte(metricGroup)
+			mn.AddTag("pod", fmt.Sprintf("pod_%d", pod))
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: mn.marshalRaw(nil),
+				Timestamp:     timestamp,
+				Value:         1,
+			})
+		}
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+	}
+	addSeries(yesterday, "foo", 1, 2, 3)
+	addSeries(yesterday, "bar", 1)
+	addSeries(today, "foo", 3, 4, 5, 6)
+	addSeries(today, "bar", 1)
+	s.DebugFlush()
+
+	tr := TimeRange{
+		MinTimestamp: yesterday,
+		MaxTimestamp: today + msecPerDay - 1,
+	}
+	css, err := s.GetDailyChurn(tr, 10, noDeadline)
+	if err != nil {
+		t.Fatalf("cannot obtain daily churn: %s", err)
+	}
+	cssExpected := []ChurnStatus{
+		{
+			Timestamp:      yesterday,
+			AppearedSeries: 4,
+			ByMetricName: []MetricNameChurn{
+				{Name: "foo", AppearedSeries: 3},
+				{Name: "bar", AppearedSeries: 1},
+			},
+		},
+		{
+			Timestamp:         today,
+			IsPartial:         true,
+			AppearedSeries:    3,
+			DisappearedSeries: 2,
+			ByMetricName: []MetricNameChurn{
+				{Name: "foo", AppearedSeries: 3, DisappearedSeries: 2},
+			},
+		},
+	}
+	if !reflect.DeepEqual(css, cssExpected) {
+		t.Fatalf("unexpected daily churn\ngot\n%+v\nwant\n%+v", css, cssExpected)
+	}
+}
@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	coldStoragePath       string
+	coldPartitionAgeMsecs int64
+)
+
+// SetColdStorage sets the path to cold storage and the minimum age for partitions to be moved to cold storage.
+//
+// Partitions with all the samples older than partitionAgeMsecs are moved to the given path.
+// Cold storage is disabled if path is empty.
+//
+// This function must be called before OpenStorage.
+func SetColdStorage(path string, partitionAgeMsecs int64) {
+	coldStoragePath = path
+	coldPartitionAgeMsecs = partitionAgeMsecs
+}
+
+// coldPartitionCompleteFilename is the name of file, which is created in big parts dir of the partition
+// after the partition is completely copied to cold storage.
+//
+// Partitions without this file are removed from cold storage on startup if the partition exists in hot storage,
+// since this means the partition move has been interrupted.
+const coldPartitionCompleteFilename = "cold_partition_complete"
+
+func (tb *table) isColdStorageEnabled() bool {
+	return tb.coldSmallPartitionsPath != ""
+}
+
+func (tb *table) isColdPartition(pt *partition) bool {
+	return tb.isColdStorageEnabled() && filepath.Dir(pt.smallPartsPath) == tb.coldSmallPartitionsPath
+}
+
+func (tb *table) startColdPartitionsWatcher() {
+	tb.coldPartitionsWatcherWG.Add(1)
+	go func() {
+		tb.coldPartitionsWatcher()
+		tb.coldPartitionsWatcherWG.Done()
+	}()
+}
+
+var coldPartitionsCheckInterval = time.Hour
+
+func (tb *table) coldPartitionsWatcher() {
+	if !tb.isColdStorageEnabled() {
+		// Cold storage is disabled.
+		return
+	}
+	t := time.NewTicker(coldPartitionsCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-tb.stop:
+			return
+		case <-t.C:
+			tb.moveColdPartitions()
+		}
+	}
+}
+
+// moveColdPartitions moves partitions older than coldPartitionAgeMsecs to cold storage.
+func (tb *table) moveColdPartitions() {
+	maxTimestamp := int64(fasttime.UnixTimestamp()*1000) - coldPartitionAgeMsecs
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+	for _, ptw := range ptws {
+		if ptw.pt.tr.MaxTimestamp >= maxTimestamp || tb.isColdPartition(ptw.pt) {
+			continue
+		}
+		select {
+		case <-tb.stop:
+			return
+		default:
+		}
+		logger.Infof("moving partition %q to cold storage at %q", ptw.pt.name, tb.coldSmallPartitionsPath)
+		startTime := time.Now()
+		if err := tb.movePartitionToCold(ptw); err != nil {
+			logger.Errorf("cannot move partition %q to cold storage: %s", ptw.pt.name, err)
+			continue
+		}
+		logger.Infof("partition %q has been moved to cold storage in %.3f seconds", ptw.pt.name, time.Since(startTime).Seconds())
+	}
+}
+
+// movePartitionToCold copies the partition from ptw to cold storage and then replaces ptw with the copied partition.
+//
+// The original partition is dropped after all the pending searches over it are finished.
+func (tb *table) movePartitionToCold(ptw *partitionWrapper) error {
+	pt := ptw.pt
+	smallPartsPath := tb.coldSmallPartitionsPath + "/" + pt.name
+	bigPartsPath := tb.coldBigPartitionsPath + "/" + pt.name
+
+	// Remove leftovers from the previous unsuccessful attempt.
+	fs.MustRemoveAll(smallPartsPath)
+	fs.MustRemoveAll(bigPartsPath)
+	if err := createPartitionDirs(smallPartsPath); err != nil {
+		return fmt.Errorf("cannot create directories for small parts %q: %w", smallPartsPath, err)
+	}
+	if err := createPartitionDirs(bigPartsPath); err != nil {
+		return fmt.Errorf("cannot create directories for big parts %q: %w", bigPartsPath, err)
+	}
+
+	// Stop background merges, since the parts, which are merged during the second pass below, would be lost.
+	// Wait for the started merges without blocking data ingestion, since they may take a lot of time.
+	// The merges are resumed only if the move fails, since the original partition is dropped otherwise.
+	moved := false
+	defer func() {
+		if !moved {
+			pt.resumeMerges()
+		}
+	}()
+	if !pt.stopMerges() {
+		return fmt.Errorf("the partition has been stopped")
+	}
+
+	// The first pass copies the bulk of partition data without blocking data ingestion.
+	if err := tb.copyPartitionData(pt, smallPartsPath, bigPartsPath); err != nil {
+		return err
+	}
+
+	// The second pass copies parts created during the first pass.
+	// Data ingestion is blocked during the second pass, so the partition data cannot change until it is replaced.
+	tb.ptsMoveLock.Lock()
+	defer tb.ptsMoveLock.Unlock()
+
+	// Flush all the ingested rows to file parts, so they are copied below. Inmemory parts, which are flushed by background
+	// flusher at the moment, are skipped by CreateSnapshotAt, so wait until they are flushed.
+	pt.flushRawRows(true)
+	if !pt.flushInmemoryPartsToFiles() {
+		return fmt.Errorf("the partition has been stopped")
+	}
+	if err := tb.copyPartitionData(pt, smallPartsPath, bigPartsPath); err != nil {
+		return err
+	}
+	if err := fs.WriteFileAtomically(bigPartsPath+"/"+coldPartitionCompleteFilename, nil); err != nil {
+		return fmt.Errorf("cannot mark the partition as complete: %w", err)
+	}
+	ptCold, err := openPartition(smallPartsPath, bigPartsPath, tb.getDeletedMetricIDs, tb.getRetentionFilterMetricIDs, tb.retentionMsecs)
+	if err != nil {
+		return fmt.Errorf("cannot open the copied partition: %w", err)
+	}
+
+	ptFound := false
+	tb.ptwsLock.Lock()
+	for i := range tb.ptws {
+		if tb.ptws[i] == ptw {
+			tb.ptws[i] = &partitionWrapper{
+				pt:       ptCold,
+				refCount: 1,
+			}
+			ptFound = true
+			break
+		}
+	}
+	tb.ptwsLock.Unlock()
+	moved = true
+
+	if !ptFound {
+		// The partition has been dropped by retention while it was copied.
+		ptCold.MustClose()
+		ptCold.Drop()
+		return nil
+	}
+
+	// Remove table reference from the original partition, so it will be dropped
+	// after all the pending searches are done.
+	ptw.scheduleToDrop()
+	ptw.decRef()
+	atomic.AddUint64(&tb.partitionsMovedToCold, 1)
+	return nil
+}
+
+// copyPartitionData copies parts from pt to the given dirs.
+//
+// Parts, which already exist at the given dirs, aren't copied. Parts missing in pt are removed from the given dirs.
+func (tb *table) copyPartitionData(pt *partition, dstSmallPartsPath, dstBigPartsPath string) error {
+	snapshotName := fmt.Sprintf("%s%s-%08X", coldMoveSnapshotPrefix, pt.name, nextSnapshotIdx())
+	snapshotSmallPath := tb.smallPartitionsPath + "/snapshots/" + snapshotName
+	snapshotBigPath := tb.bigPartitionsPath + "/snapshots/" + snapshotName
+	defer func() {
+		fs.MustRemoveAll(snapshotSmallPath)
+		fs.MustRemoveAll(snapshotBigPath)
+	}()
+	if err := pt.CreateSnapshotAt(snapshotSmallPath, snapshotBigPath); err != nil {
+		return fmt.Errorf("cannot create partition snapshot: %w", err)
+	}
+	if err := syncPartitionDir(snapshotSmallPath, dstSmallPartsPath); err != nil {
+		return err
+	}
+	return syncPartitionDir(snapshotBigPath, dstBigPartsPath)
+}
+
+// syncPartitionDir makes dstDir contents identical to the partition snapshot at srcDir.
+func syncPartitionDir(srcDir, dstDir string) error {
+	srcNames, err := readPartitionDirNames(srcDir)
+	if err != nil {
+		return err
+	}
+	dstNames, err := readPartitionDirNames(dstDir)
+	if err != nil {
+		return err
+	}
+	for name, isDir := range srcNames {
+		srcPath := srcDir + "/" + name
+		dstPath := dstDir + "/" + name
+		if !isDir {
+			// Files such as tombstones may change, so always copy them.
+			// There is no need in atomic replacement, since the copied partition isn't used
+			// until it is marked as complete.
+			data, err := ioutil.ReadFile(srcPath)
+			if err != nil {
+				return fmt.Errorf("cannot read %q: %w", srcPath, err)
+			}
+			fs.MustRemoveAll(dstPath)
+			if err := fs.WriteFileAtomically(dstPath, data); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := dstNames[name]; ok {
+			// Parts are immutable, so there is no need to copy the existing part.
+			continue
+		}
+		// Copy the part to tmp dir at first, so incompletely copied parts do not appear at dstDir on unclean shutdown.
+		tmpPath := dstDir + "/tmp/" + name
+		if err := fs.CopyDirectory(srcPath, tmpPath); err != nil {
+			return fmt.Errorf("cannot copy part %q to %q: %w", srcPath, tmpPath, err)
+		}
+		if err := os.Rename(tmpPath, dstPath); err != nil {
+			return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, dstPath, err)
+		}
+	}
+	for name := range dstNames {
+		if _, ok := srcNames[name]; !ok {
+			fs.MustRemoveAll(dstDir + "/" + name)
+		}
+	}
+	fs.MustSyncPath(dstDir)
+	return nil
+}
+
+// readPartitionDirNames returns names for parts and files at the given partition dir.
+//
+// The returned map values are set to true for parts.
+func readPartitionDirNames(path string) (map[string]bool, error) {
+	d, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open directory: %w", err)
+	}
+	defer fs.MustClose(d)
+
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory %q: %w", path, err)
+	}
+	names := make(map[string]bool, len(fis))
+	for _, fi := range fis {
+		fn := fi.Name()
+		if fn == "tmp" || fn == "txn" || fn == coldPartitionCompleteFilename || fs.IsTemporaryFileName(fn) {
+			continue
+		}
+		names[fn] = fs.IsDirOrSymlink(fi)
+	}
+	return names, nil
+}
+
+// isColdPartitionComplete returns true if the partition at bigPartsPath has been completely moved to cold storage.
+func isColdPartitionComplete(bigPartsPath string) bool {
+	return fs.IsPathExist(bigPartsPath + "/" + coldPartitionCompleteFilename)
+}
+
+// createColdPartitionSnapshot creates a snapshot with the given snapshotName for the cold partition pt
+// and symlinks it from smallPath and bigPath.
+func (tb *table) createColdPartitionSnapshot(pt *partition, snapshotName, smallPath, bigPath string) error {
+	coldSmallPath := tb.coldSmallPartitionsPath + "/snapshots/" + snapshotName + "/" + pt.name
+	coldBigPath := tb.coldBigPartitionsPath + "/snapshots/" + snapshotName + "/" + pt.name
+	if err := pt.CreateSnapshotAt(coldSmallPath, coldBigPath); err != nil {
+		return fmt.Errorf("cannot create snapshot for cold partition %q: %w", pt.name, err)
+	}
+	if err := fs.SymlinkRelative(coldSmallPath, smallPath); err != nil {
+		return fmt.Errorf("cannot create symlink from %q to %q: %w", coldSmallPath, smallPath, err)
+	}
+	if err := fs.SymlinkRelative(coldBigPath, bigPath); err != nil {
+		return fmt.Errorf("cannot create symlink from %q to %q: %w", coldBigPath, bigPath, err)
+	}
+	return nil
+}
+
+// coldMoveSnapshotPrefix is the prefix for names of snapshots, which are created while moving partitions to cold storage.
+const coldMoveSnapshotPrefix = "cold-"
+
+// mustRemoveColdMoveSnapshots removes snapshots left in snapshotsPath after unclean shutdown during partition move.
+func mustRemoveColdMoveSnapshots(snapshotsPath string) {
+	names, err := readSubdirNames(snapshotsPath)
+	if err != nil {
+		logger.Panicf("FATAL: %s", err)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, coldMoveSnapshotPrefix) {
+			fs.MustRemoveAll(snapshotsPath + "/" + name)
+		}
+	}
+}
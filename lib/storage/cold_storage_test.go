@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageColdPartitions(t *testing.T) {
+	path := "TestStorageColdPartitions"
+	coldPath := "TestStorageColdPartitions-cold"
+	SetColdStorage(coldPath, msecPerDay)
+	defer SetColdStorage("", 0)
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+		if err := os.RemoveAll(coldPath); err != nil {
+			t.Fatalf("cannot remove %q: %s", coldPath, err)
+		}
+	}()
+
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+
+	// Add samples for the partition from two months ago.
+	now := time.Now().UnixNano() / 1e6
+	startTimestamp := now - 60*msecPerDay
+	ptName := timestampToPartitionName(startTimestamp)
+	addRows := func(offset int64) {
+		t.Helper()
+		var mn MetricName
+		mn.MetricGroup = []byte("metric")
+		metricNameRaw := mn.marshalRaw(nil)
+		var mrs []MetricRow
+		for i := 0; i < 100; i++ {
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     startTimestamp + offset + int64(i)*1000,
+				Value:         float64(i),
+			})
+		}
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+		s.DebugFlush()
+	}
+	countRows := func() int {
+		t.Helper()
+		tr := TimeRange{
+			MinTimestamp: startTimestamp - msecPerDay,
+			MaxTimestamp: startTimestamp + msecPerDay,
+		}
+		return testCountMetricRows(t, s, "metric", tr)
+	}
+	checkColdPartitions := func(coldPartitionsExpected uint64) {
+		t.Helper()
+		var m Metrics
+		s.UpdateMetrics(&m)
+		if m.TableMetrics.ColdPartitions != coldPartitionsExpected {
+			t.Fatalf("unexpected number of cold partitions; got %d; want %d", m.TableMetrics.ColdPartitions, coldPartitionsExpected)
+		}
+	}
+	hotSmallPath := path + "/data/small/" + ptName
+	hotBigPath := path + "/data/big/" + ptName
+	coldSmallPath := coldPath + "/data/small/" + ptName
+	coldBigPath := coldPath + "/data/big/" + ptName
+
+	addRows(0)
+	checkColdPartitions(0)
+
+	// Move the partition to cold storage.
+	s.tb.moveColdPartitions()
+	checkColdPartitions(1)
+	if fs.IsPathExist(hotSmallPath) || fs.IsPathExist(hotBigPath) {
+		t.Fatalf("the partition must be removed from hot storage")
+	}
+	if !isColdPartitionComplete(coldBigPath) {
+		t.Fatalf("the partition must be marked as complete in cold storage")
+	}
+	if n := countRows(); n != 100 {
+		t.Fatalf("unexpected number of rows after moving the partition to cold storage; got %d; want 100", n)
+	}
+
+	// Late samples must be added to the cold partition.
+	addRows(100 * 1000)
+	if n := countRows(); n != 200 {
+		t.Fatalf("unexpected number of rows after adding late samples; got %d; want 200", n)
+	}
+
+	// Snapshots must include cold partitions.
+	snapshotName, err := s.CreateSnapshot()
+	if err != nil {
+		t.Fatalf("cannot create snapshot: %s", err)
+	}
+	snapshotPartsPaths, err := filepath.Glob(path + "/snapshots/" + snapshotName + "/data/*/" + ptName + "/*/metaindex.bin")
+	if err != nil {
+		t.Fatalf("cannot find snapshot parts: %s", err)
+	}
+	if len(snapshotPartsPaths) == 0 {
+		t.Fatalf("snapshot doesn't contain parts for the cold partition")
+	}
+	if err := s.DeleteSnapshot(snapshotName); err != nil {
+		t.Fatalf("cannot delete snapshot: %s", err)
+	}
+	if fs.IsPathExist(coldSmallPath + "/../snapshots/" + snapshotName) {
+		t.Fatalf("snapshot must be removed from cold storage")
+	}
+
+	// The cold partition must be opened after restart.
+	s.MustClose()
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage: %s", err)
+	}
+	checkColdPartitions(1)
+	if n := countRows(); n != 200 {
+		t.Fatalf("unexpected number of rows after restart; got %d; want 200", n)
+	}
+
+	// The hot copy of the partition must be removed if the partition is completely moved to cold storage.
+	s.MustClose()
+	for _, p := range []string{hotSmallPath, hotBigPath} {
+		if err := createPartitionDirs(p); err != nil {
+			t.Fatalf("cannot create partition dirs: %s", err)
+		}
+	}
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage: %s", err)
+	}
+	checkColdPartitions(1)
+	if fs.IsPathExist(hotSmallPath) || fs.IsPathExist(hotBigPath) {
+		t.Fatalf("the hot copy of the partition must be removed")
+	}
+	if n := countRows(); n != 200 {
+		t.Fatalf("unexpected number of rows; got %d; want 200", n)
+	}
+
+	// The incomplete cold copy of the partition must be removed if the partition exists in hot storage.
+	s.MustClose()
+	fs.MustRemoveAll(coldBigPath + "/" + coldPartitionCompleteFilename)
+	for _, p := range []string{hotSmallPath, hotBigPath} {
+		if err := createPartitionDirs(p); err != nil {
+			t.Fatalf("cannot create partition dirs: %s", err)
+		}
+	}
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage: %s", err)
+	}
+	defer s.MustClose()
+	checkColdPartitions(0)
+	if fs.IsPathExist(coldSmallPath) || fs.IsPathExist(coldBigPath) {
+		t.Fatalf("the incomplete cold copy of the partition must be removed")
+	}
+}
+
+func TestStorageColdPartitionsConcurrentIngestion(t *testing.T) {
+	path := "TestStorageColdPartitionsConcurrentIngestion"
+	coldPath := "TestStorageColdPartitionsConcurrentIngestion-cold"
+	SetColdStorage(coldPath, msecPerDay)
+	defer SetColdStorage("", 0)
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+		if err := os.RemoveAll(coldPath); err != nil {
+			t.Fatalf("cannot remove %q: %s", coldPath, err)
+		}
+	}()
+
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer s.MustClose()
+
+	// Ingest samples into the partition from two months ago in small batches, so they are spread among many inmemory parts,
+	// which are merged in background while the partition is moved to cold storage.
+	now := time.Now().UnixNano() / 1e6
+	startTimestamp := now - 60*msecPerDay
+	var mn MetricName
+	mn.MetricGroup = []byte("metric")
+	metricNameRaw := mn.marshalRaw(nil)
+	const rowsPerBatch = 10
+	var batchesAdded uint64
+	stopCh := make(chan struct{})
+	doneCh := make(chan error)
+	go func() {
+		var mrs []MetricRow
+		for {
+			select {
+			case <-stopCh:
+				doneCh <- nil
+				return
+			default:
+			}
+			n := atomic.LoadUint64(&batchesAdded)
+			mrs = mrs[:0]
+			for i := 0; i < rowsPerBatch; i++ {
+				mrs = append(mrs, MetricRow{
+					MetricNameRaw: metricNameRaw,
+					Timestamp:     startTimestamp + int64(n*rowsPerBatch+uint64(i)),
+					Value:         float64(i),
+				})
+			}
+			if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+				doneCh <- fmt.Errorf("cannot add rows: %w", err)
+				return
+			}
+			atomic.AddUint64(&batchesAdded, 1)
+			if n%10 == 0 {
+				s.tb.flushRawRows()
+			}
+		}
+	}()
+	for atomic.LoadUint64(&batchesAdded) < 100 {
+		time.Sleep(time.Millisecond)
+	}
+	s.tb.moveColdPartitions()
+	batchesAddedAfterMove := atomic.LoadUint64(&batchesAdded)
+	for atomic.LoadUint64(&batchesAdded) < batchesAddedAfterMove+100 {
+		time.Sleep(time.Millisecond)
+	}
+	close(stopCh)
+	if err := <-doneCh; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s.DebugFlush()
+
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.TableMetrics.ColdPartitions != 1 {
+		t.Fatalf("unexpected number of cold partitions; got %d; want 1", m.TableMetrics.ColdPartitions)
+	}
+	tr := TimeRange{
+		MinTimestamp: startTimestamp - msecPerDay,
+		MaxTimestamp: startTimestamp + msecPerDay,
+	}
+	rowsExpected := int(atomic.LoadUint64(&batchesAdded)) * rowsPerBatch
+	if n := testCountMetricRows(t, s, "metric", tr); n != rowsExpected {
+		t.Fatalf("unexpected number of rows after moving the partition to cold storage; got %d; want %d", n, rowsExpected)
+	}
+}
+
+func testCountMetricRows(t *testing.T, s *Storage, metricGroup string, tr TimeRange) int {
+	t.Helper()
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte(metricGroup), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	var sr Search
+	sr.Init(nil, s, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
+	defer sr.MustClose()
+	var b Block
+	rows := 0
+	for sr.NextMetricBlock() {
+		sr.MetricBlockRef.BlockRef.MustReadBlock(&b, true)
+		if err := b.UnmarshalData(); err != nil {
+			t.Fatalf("cannot unmarshal block: %s", err)
+		}
+		rows += len(b.timestamps)
+	}
+	if err := sr.Error(); err != nil {
+		t.Fatalf("search error: %s", err)
+	}
+	return rows
+}
@@ -1,7 +1,12 @@
 package storage
 
 import (
+	"fmt"
+	"math"
 	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 )
 
 // SetDedupInterval sets the deduplication interval, which is applied to raw samples during data ingestion and querying.
@@ -24,6 +29,53 @@ func isDedupEnabled() bool {
 	return globalDedupInterval > 0
 }
 
+// dedupStrategy defines the sample to leave per each dedup interval.
+type dedupStrategy int
+
+const (
+	// dedupStrategyFirst leaves the sample with the smallest timestamp.
+	dedupStrategyFirst = dedupStrategy(iota)
+
+	// dedupStrategyLast leaves the sample with the biggest timestamp.
+	dedupStrategyLast
+
+	// dedupStrategyMin leaves the sample with the minimum value.
+	dedupStrategyMin
+
+	// dedupStrategyMax leaves the sample with the maximum value.
+	dedupStrategyMax
+
+	// dedupStrategyAvg leaves a sample with the average value and the biggest timestamp.
+	//
+	// The average is approximate if samples for the same interval are averaged during distinct background merges,
+	// since the previously averaged sample has the same weight as a single raw sample.
+	dedupStrategyAvg
+)
+
+var dedupStrategyNames = map[string]dedupStrategy{
+	"first": dedupStrategyFirst,
+	"last":  dedupStrategyLast,
+	"min":   dedupStrategyMin,
+	"max":   dedupStrategyMax,
+	"avg":   dedupStrategyAvg,
+}
+
+// SetDedupStrategy sets the strategy for selecting the sample to leave per each dedup interval.
+//
+// Supported strategies: first, last, min, max and avg. The strategy is applied during querying and background merges.
+//
+// This function must be called before initializing the storage.
+func SetDedupStrategy(strategy string) error {
+	ds, ok := dedupStrategyNames[strategy]
+	if !ok {
+		return fmt.Errorf("unsupported dedup strategy %q; supported values: first, last, min, max, avg", strategy)
+	}
+	globalDedupStrategy = ds
+	return nil
+}
+
+var globalDedupStrategy = dedupStrategyFirst
+
 // DeduplicateSamples removes samples from src* if they are closer to each other than dedupInterval in millseconds.
 func DeduplicateSamples(srcTimestamps []int64, srcValues []float64, dedupInterval int64) ([]int64, []float64) {
 	if !needsDedup(srcTimestamps, dedupInterval) {
@@ -34,6 +86,9 @@ func DeduplicateSamples(srcTimestamps []int64, srcValues []float64, dedupInterva
 }
 
 func deduplicateInternal(srcTimestamps []int64, srcValues []float64, dedupInterval int64) ([]int64, []float64) {
+	if globalDedupStrategy != dedupStrategyFirst {
+		return deduplicateWithStrategy(srcTimestamps, srcValues, dedupInterval, globalDedupStrategy)
+	}
 	tsNext := (srcTimestamps[0] - srcTimestamps[0]%dedupInterval) + dedupInterval
 	dstTimestamps := srcTimestamps[:1]
 	dstValues := srcValues[:1]
@@ -64,6 +119,9 @@ func deduplicateSamplesDuringMerge(srcTimestamps, srcValues []int64, dedupInterv
 }
 
 func deduplicateDuringMergeInternal(srcTimestamps, srcValues []int64, dedupInterval int64) ([]int64, []int64) {
+	if globalDedupStrategy != dedupStrategyFirst {
+		return deduplicateDuringMergeWithStrategy(srcTimestamps, srcValues, dedupInterval, globalDedupStrategy)
+	}
 	tsNext := (srcTimestamps[0] - srcTimestamps[0]%dedupInterval) + dedupInterval
 	dstTimestamps := srcTimestamps[:1]
 	dstValues := srcValues[:1]
@@ -85,6 +143,122 @@ func deduplicateDuringMergeInternal(srcTimestamps, srcValues []int64, dedupInter
 	return dstTimestamps, dstValues
 }
 
+// deduplicateWithStrategy leaves a single sample per each dedup interval in src* according to the given ds.
+func deduplicateWithStrategy(srcTimestamps []int64, srcValues []float64, dedupInterval int64, ds dedupStrategy) ([]int64, []float64) {
+	dstTimestamps := srcTimestamps[:0]
+	dstValues := srcValues[:0]
+	for i := 0; i < len(srcTimestamps); {
+		ts := srcTimestamps[i]
+		tsNext := (ts - ts%dedupInterval) + dedupInterval
+		j := i + 1
+		for j < len(srcTimestamps) && srcTimestamps[j] < tsNext {
+			j++
+		}
+		ts, v := selectSample(srcTimestamps[i:j], srcValues[i:j], ds)
+		dstTimestamps = append(dstTimestamps, ts)
+		dstValues = append(dstValues, v)
+		i = j
+	}
+	return dstTimestamps, dstValues
+}
+
+// selectSample returns the sample to leave among the given samples according to ds.
+//
+// NaN values such as staleness marks are ignored by min, max and avg strategies
+// unless all the samples contain NaN values.
+func selectSample(timestamps []int64, values []float64, ds dedupStrategy) (int64, float64) {
+	lastIdx := len(timestamps) - 1
+	switch ds {
+	case dedupStrategyFirst:
+		return timestamps[0], values[0]
+	case dedupStrategyMin, dedupStrategyMax:
+		idx := -1
+		for i, v := range values {
+			if math.IsNaN(v) {
+				continue
+			}
+			if idx < 0 || (ds == dedupStrategyMin && v < values[idx]) || (ds == dedupStrategyMax && v > values[idx]) {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			idx = lastIdx
+		}
+		return timestamps[idx], values[idx]
+	case dedupStrategyAvg:
+		sum := float64(0)
+		n := 0
+		for _, v := range values {
+			if math.IsNaN(v) {
+				continue
+			}
+			sum += v
+			n++
+		}
+		if n == 0 {
+			return timestamps[lastIdx], values[lastIdx]
+		}
+		return timestamps[lastIdx], sum / float64(n)
+	default:
+		return timestamps[lastIdx], values[lastIdx]
+	}
+}
+
+// deduplicateDuringMergeWithStrategy leaves a single sample per each dedup interval in src* according to the given ds.
+//
+// src* values are decimal mantissas with the same exponent.
+func deduplicateDuringMergeWithStrategy(srcTimestamps, srcValues []int64, dedupInterval int64, ds dedupStrategy) ([]int64, []int64) {
+	dstTimestamps := srcTimestamps[:0]
+	dstValues := srcValues[:0]
+	for i := 0; i < len(srcTimestamps); {
+		ts := srcTimestamps[i]
+		tsNext := (ts - ts%dedupInterval) + dedupInterval
+		j := i + 1
+		for j < len(srcTimestamps) && srcTimestamps[j] < tsNext {
+			j++
+		}
+		ts, v := selectSampleDuringMerge(srcTimestamps[i:j], srcValues[i:j], ds)
+		dstTimestamps = append(dstTimestamps, ts)
+		dstValues = append(dstValues, v)
+		i = j
+	}
+	return dstTimestamps, dstValues
+}
+
+// selectSampleDuringMerge is the same as selectSample, but works with decimal mantissas instead of float values.
+//
+// It doesn't support dedupStrategyAvg, since the average of decimal mantissas may be non-integer.
+func selectSampleDuringMerge(timestamps, values []int64, ds dedupStrategy) (int64, int64) {
+	lastIdx := len(timestamps) - 1
+	switch ds {
+	case dedupStrategyFirst:
+		return timestamps[0], values[0]
+	case dedupStrategyMin, dedupStrategyMax:
+		idx := -1
+		for i, v := range values {
+			if isStaleNaNDecimal(v) {
+				continue
+			}
+			if idx < 0 || (ds == dedupStrategyMin && v < values[idx]) || (ds == dedupStrategyMax && v > values[idx]) {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			idx = lastIdx
+		}
+		return timestamps[idx], values[idx]
+	case dedupStrategyAvg:
+		logger.Panicf("BUG: avg dedup strategy must be applied to float values; see Block.deduplicateSamplesDuringMergeAvg")
+		return 0, 0
+	default:
+		return timestamps[lastIdx], values[lastIdx]
+	}
+}
+
+func isStaleNaNDecimal(v int64) bool {
+	return decimal.IsStaleNaN(decimal.ToFloat(v, 0))
+}
+
 func needsDedup(timestamps []int64, dedupInterval int64) bool {
 	if len(timestamps) == 0 || dedupInterval <= 0 {
 		return false
@@ -4,6 +4,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
 )
 
 func TestNeedsDedup(t *testing.T) {
@@ -155,3 +157,72 @@ func TestDeduplicateSamplesDuringMerge(t *testing.T) {
 	f(time.Second, timestamps, timestamps)
 	f(2*time.Second, timestamps, timestampsExpected)
 }
+
+func TestDeduplicateSamplesWithStrategy(t *testing.T) {
+	defer func() {
+		if err := SetDedupStrategy("first"); err != nil {
+			t.Fatalf("cannot reset dedup strategy: %s", err)
+		}
+	}()
+
+	f := func(strategy string, timestamps []int64, values []float64, timestampsExpected []int64, valuesExpected []float64) {
+		t.Helper()
+		if err := SetDedupStrategy(strategy); err != nil {
+			t.Fatalf("cannot set dedup strategy: %s", err)
+		}
+
+		// Verify query-time deduplication.
+		timestampsCopy := append([]int64{}, timestamps...)
+		valuesCopy := append([]float64{}, values...)
+		timestampsResult, valuesResult := DeduplicateSamples(timestampsCopy, valuesCopy, 10)
+		if !reflect.DeepEqual(timestampsResult, timestampsExpected) {
+			t.Fatalf("unexpected timestamps for strategy=%s;\ngot\n%v\nwant\n%v", strategy, timestampsResult, timestampsExpected)
+		}
+		if !reflect.DeepEqual(valuesResult, valuesExpected) {
+			t.Fatalf("unexpected values for strategy=%s;\ngot\n%v\nwant\n%v", strategy, valuesResult, valuesExpected)
+		}
+
+		// Verify deduplication during merge.
+		SetDedupInterval(10 * time.Millisecond)
+		defer SetDedupInterval(0)
+		decimalValues, scale := decimal.AppendFloatToDecimal(nil, values)
+		var b Block
+		b.Init(&TSID{}, timestamps, decimalValues, scale, 64)
+		b.deduplicateSamplesDuringMerge()
+		if !reflect.DeepEqual(b.timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps during merge for strategy=%s;\ngot\n%v\nwant\n%v", strategy, b.timestamps, timestampsExpected)
+		}
+		valuesMergeResult := decimal.AppendDecimalToFloat(nil, b.values, b.bh.Scale)
+		if !reflect.DeepEqual(valuesMergeResult, valuesExpected) {
+			t.Fatalf("unexpected values during merge for strategy=%s;\ngot\n%v\nwant\n%v", strategy, valuesMergeResult, valuesExpected)
+		}
+	}
+
+	timestamps := []int64{0, 3, 5, 9, 10, 20, 22, 35, 39}
+	values := []float64{4, 8, 1, 3, 5, 7, 2, 6, 9}
+	f("first", timestamps, values, []int64{0, 10, 20, 35}, []float64{4, 5, 7, 6})
+	f("last", timestamps, values, []int64{9, 10, 22, 39}, []float64{3, 5, 2, 9})
+	f("min", timestamps, values, []int64{5, 10, 22, 35}, []float64{1, 5, 2, 6})
+	f("max", timestamps, values, []int64{3, 10, 20, 39}, []float64{8, 5, 7, 9})
+	f("avg", timestamps, values, []int64{9, 10, 22, 39}, []float64{4, 5, 4.5, 7.5})
+
+	// The average must be stored without rounding to the scale of the original values.
+	f("avg", []int64{0, 5, 10}, []float64{1, 2, 3}, []int64{5, 10}, []float64{1.5, 3})
+	f("avg", []int64{0, 5, 12}, []float64{0.25, 0.5, 7}, []int64{5, 12}, []float64{0.375, 7})
+
+	// Staleness marks must be ignored by min, max and avg strategies.
+	staleNaN := decimal.StaleNaN
+	timestamps = []int64{0, 5, 9}
+	values = []float64{staleNaN, 2, 4}
+	if err := SetDedupStrategy("max"); err != nil {
+		t.Fatalf("cannot set dedup strategy: %s", err)
+	}
+	timestampsResult, valuesResult := DeduplicateSamples(timestamps, values, 10)
+	if !reflect.DeepEqual(timestampsResult, []int64{9}) || !reflect.DeepEqual(valuesResult, []float64{4}) {
+		t.Fatalf("unexpected result for max strategy with staleness mark; got timestamps=%v, values=%v", timestampsResult, valuesResult)
+	}
+
+	if err := SetDedupStrategy("foobar"); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported dedup strategy")
+	}
+}
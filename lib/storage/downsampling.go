@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutils"
+)
+
+// DownsamplingPeriod describes a single downsampling rule.
+//
+// Samples older than Offset are deduplicated with the given Interval.
+type DownsamplingPeriod struct {
+	// Offset is the minimum age of samples in milliseconds for applying the downsampling.
+	Offset int64
+
+	// Interval is the deduplication interval in milliseconds for samples older than Offset.
+	Interval int64
+}
+
+// String returns string representation of dp.
+func (dp *DownsamplingPeriod) String() string {
+	return fmt.Sprintf("%dms:%dms", dp.Offset, dp.Interval)
+}
+
+// ParseDownsamplingPeriods parses downsampling periods from a in the format `offset:interval`.
+//
+// For example, `30d:5m` means that samples older than 30 days must be deduplicated with 5 minutes interval.
+func ParseDownsamplingPeriods(a []string) ([]DownsamplingPeriod, error) {
+	var dps []DownsamplingPeriod
+	for _, s := range a {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+		n := strings.IndexByte(s, ':')
+		if n < 0 {
+			return nil, fmt.Errorf("missing ':' in downsampling period %q; it must be in the form `offset:interval`", s)
+		}
+		offset, err := promutils.ParseDuration(s[:n])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse offset in downsampling period %q: %w", s, err)
+		}
+		if offset < 0 {
+			return nil, fmt.Errorf("offset cannot be negative in downsampling period %q", s)
+		}
+		interval, err := promutils.ParseDuration(s[n+1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse interval in downsampling period %q: %w", s, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval must be positive in downsampling period %q", s)
+		}
+		dps = append(dps, DownsamplingPeriod{
+			Offset:   offset.Milliseconds(),
+			Interval: interval.Milliseconds(),
+		})
+	}
+	sort.Slice(dps, func(i, j int) bool {
+		return dps[i].Offset < dps[j].Offset
+	})
+	for i := 1; i < len(dps); i++ {
+		prev := &dps[i-1]
+		dp := &dps[i]
+		if dp.Offset == prev.Offset {
+			return nil, fmt.Errorf("duplicate offset in downsampling periods %s and %s", prev, dp)
+		}
+		if dp.Interval < prev.Interval {
+			return nil, fmt.Errorf("downsampling interval for older samples cannot be smaller than the interval for newer samples; got %s and %s", prev, dp)
+		}
+	}
+	return dps, nil
+}
+
+// SetDownsamplingPeriods sets the downsampling periods, which are applied to samples during background merges.
+//
+// Downsampling is disabled if dps is empty.
+//
+// This function must be called before initializing the storage.
+func SetDownsamplingPeriods(dps []DownsamplingPeriod) {
+	globalDownsamplingPeriods = append([]DownsamplingPeriod{}, dps...)
+	sort.Slice(globalDownsamplingPeriods, func(i, j int) bool {
+		return globalDownsamplingPeriods[i].Offset < globalDownsamplingPeriods[j].Offset
+	})
+}
+
+// globalDownsamplingPeriods contains downsampling periods sorted by Offset.
+var globalDownsamplingPeriods []DownsamplingPeriod
+
+func isDownsamplingEnabled() bool {
+	return len(globalDownsamplingPeriods) > 0
+}
+
+// getDedupIntervalForTimestamp returns dedup interval in milliseconds for the sample with the given timestamp
+// according to the configured dedup interval and downsampling periods.
+//
+// currentTimestamp is the current time in milliseconds.
+func getDedupIntervalForTimestamp(timestamp, currentTimestamp int64) int64 {
+	interval, _ := getDedupIntervalAndDeadline(timestamp, currentTimestamp)
+	return interval
+}
+
+// getDedupIntervalAndDeadline returns dedup interval for the sample with the given timestamp
+// plus the maximum timestamp for samples, which must be deduplicated with the same interval.
+func getDedupIntervalAndDeadline(timestamp, currentTimestamp int64) (int64, int64) {
+	dedupInterval := globalDedupInterval
+	deadline := int64(1<<63 - 1)
+	dps := globalDownsamplingPeriods
+	age := currentTimestamp - timestamp
+	n := sort.Search(len(dps), func(i int) bool {
+		return dps[i].Offset > age
+	})
+	if n > 0 {
+		dp := &dps[n-1]
+		if dp.Interval > dedupInterval {
+			dedupInterval = dp.Interval
+		}
+		// Samples with timestamps bigger than the deadline belong to newer downsampling periods.
+		deadline = currentTimestamp - dp.Offset
+	}
+	return dedupInterval, deadline
+}
+
+// downsampleSamplesDuringMerge deduplicates src* according to the downsampling period
+// matching every sample at the given currentTimestamp.
+//
+// srcTimestamps must be in the storage precision, while currentTimestamp must be in milliseconds.
+func downsampleSamplesDuringMerge(srcTimestamps, srcValues []int64, currentTimestamp int64) ([]int64, []int64) {
+	dstTimestamps := srcTimestamps[:0]
+	dstValues := srcValues[:0]
+	for len(srcTimestamps) > 0 {
+		dedupInterval, deadline := getDedupIntervalAndDeadline(TimestampToMsecs(srcTimestamps[0]), currentTimestamp)
+		dedupInterval *= globalTimestampsPerMsec
+		deadline = lastTimestampInMsec(deadline, globalTimestampsPerMsec)
+		n := sort.Search(len(srcTimestamps), func(i int) bool {
+			return srcTimestamps[i] > deadline
+		})
+		if n == 0 {
+			logger.Panicf("BUG: the first timestamp %d must be smaller than or equal to the deadline %d", srcTimestamps[0], deadline)
+		}
+		timestamps, values := deduplicateSamplesDuringMerge(srcTimestamps[:n], srcValues[:n], dedupInterval)
+		dstTimestamps = append(dstTimestamps, timestamps...)
+		dstValues = append(dstValues, values...)
+		srcTimestamps = srcTimestamps[n:]
+		srcValues = srcValues[n:]
+	}
+	return dstTimestamps, dstValues
+}
+
+// downsampleSamples is the same as downsampleSamplesDuringMerge, but works with float values instead of decimal mantissas.
+func downsampleSamples(srcTimestamps []int64, srcValues []float64, currentTimestamp int64) ([]int64, []float64) {
+	dstTimestamps := srcTimestamps[:0]
+	dstValues := srcValues[:0]
+	for len(srcTimestamps) > 0 {
+		dedupInterval, deadline := getDedupIntervalAndDeadline(TimestampToMsecs(srcTimestamps[0]), currentTimestamp)
+		dedupInterval *= globalTimestampsPerMsec
+		deadline = lastTimestampInMsec(deadline, globalTimestampsPerMsec)
+		n := sort.Search(len(srcTimestamps), func(i int) bool {
+			return srcTimestamps[i] > deadline
+		})
+		if n == 0 {
+			logger.Panicf("BUG: the first timestamp %d must be smaller than or equal to the deadline %d", srcTimestamps[0], deadline)
+		}
+		timestamps, values := DeduplicateSamples(srcTimestamps[:n], srcValues[:n], dedupInterval)
+		dstTimestamps = append(dstTimestamps, timestamps...)
+		dstValues = append(dstValues, values...)
+		srcTimestamps = srcTimestamps[n:]
+		srcValues = srcValues[n:]
+	}
+	return dstTimestamps, dstValues
+}
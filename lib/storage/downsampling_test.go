@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDownsamplingPeriodsSuccess(t *testing.T) {
+	f := func(a []string, dpsExpected []DownsamplingPeriod) {
+		t.Helper()
+		dps, err := ParseDownsamplingPeriods(a)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(dps, dpsExpected) {
+			t.Fatalf("unexpected downsampling periods for %q;\ngot\n%v\nwant\n%v", a, dps, dpsExpected)
+		}
+	}
+	f(nil, nil)
+	f([]string{"0s:1m"}, []DownsamplingPeriod{
+		{Offset: 0, Interval: 60e3},
+	})
+	f([]string{"180d:1h", "30d:5m"}, []DownsamplingPeriod{
+		{Offset: 30 * msecPerDay, Interval: 5 * 60e3},
+		{Offset: 180 * msecPerDay, Interval: msecPerHour},
+	})
+}
+
+func TestParseDownsamplingPeriodsFailure(t *testing.T) {
+	f := func(a []string) {
+		t.Helper()
+		dps, err := ParseDownsamplingPeriods(a)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q; got %v", a, dps)
+		}
+	}
+	// Missing colon
+	f([]string{"30d"})
+	// Invalid offset
+	f([]string{"foo:5m"})
+	// Invalid interval
+	f([]string{"30d:bar"})
+	// Zero interval
+	f([]string{"30d:0s"})
+	// Duplicate offsets
+	f([]string{"30d:5m", "30d:1h"})
+	// Older samples with smaller interval
+	f([]string{"30d:1h", "180d:5m"})
+}
+
+func TestDownsampleSamplesDuringMerge(t *testing.T) {
+	defer func() {
+		SetDownsamplingPeriods(nil)
+	}()
+	f := func(dps []DownsamplingPeriod, currentTimestamp int64, timestamps, timestampsExpected []int64) {
+		t.Helper()
+		SetDownsamplingPeriods(dps)
+		timestampsCopy := append([]int64{}, timestamps...)
+		values := make([]int64, len(timestamps))
+		for i := range values {
+			values[i] = int64(i)
+		}
+		timestampsCopy, values = downsampleSamplesDuringMerge(timestampsCopy, values, currentTimestamp)
+		if !reflect.DeepEqual(timestampsCopy, timestampsExpected) {
+			t.Fatalf("unexpected timestamps;\ngot\n%v\nwant\n%v", timestampsCopy, timestampsExpected)
+		}
+		if len(values) != len(timestampsCopy) {
+			t.Fatalf("unexpected number of values; got %d; want %d", len(values), len(timestampsCopy))
+		}
+		j := 0
+		for i, ts := range timestamps {
+			if j < len(timestampsCopy) && ts == timestampsCopy[j] {
+				if values[j] != int64(i) {
+					t.Fatalf("unexpected value at index %d; got %d; want %d", j, values[j], i)
+				}
+				j++
+			}
+		}
+	}
+
+	// No downsampling periods
+	f(nil, 1000, []int64{1, 2, 3}, []int64{1, 2, 3})
+
+	// All the samples are newer than the offset
+	f([]DownsamplingPeriod{{Offset: 1000, Interval: 10}}, 1000, []int64{1, 2, 3, 15}, []int64{1, 2, 3, 15})
+
+	// All the samples are older than the offset
+	f([]DownsamplingPeriod{{Offset: 10, Interval: 10}}, 1000, []int64{1, 2, 3, 15, 18, 25}, []int64{1, 15, 25})
+
+	// Multi-level downsampling
+	f([]DownsamplingPeriod{
+		{Offset: 50, Interval: 10},
+		{Offset: 100, Interval: 100},
+	}, 1000, []int64{1, 20, 30, 899, 900, 901, 905, 911, 949, 950, 951, 952, 990, 999},
+		[]int64{1, 899, 900, 901, 911, 949, 950, 951, 952, 990, 999})
+}
+
+func TestGetDedupIntervalForTimestamp(t *testing.T) {
+	defer func() {
+		SetDownsamplingPeriods(nil)
+		SetDedupInterval(0)
+	}()
+	SetDownsamplingPeriods([]DownsamplingPeriod{
+		{Offset: 50, Interval: 10},
+		{Offset: 100, Interval: 100},
+	})
+	f := func(timestamp, currentTimestamp, intervalExpected int64) {
+		t.Helper()
+		interval := getDedupIntervalForTimestamp(timestamp, currentTimestamp)
+		if interval != intervalExpected {
+			t.Fatalf("unexpected dedup interval for timestamp=%d, currentTimestamp=%d; got %d; want %d", timestamp, currentTimestamp, interval, intervalExpected)
+		}
+	}
+	f(1000, 1000, 0)
+	f(951, 1000, 0)
+	f(950, 1000, 10)
+	f(901, 1000, 10)
+	f(900, 1000, 100)
+	f(0, 1000, 100)
+
+	// The dedup interval is applied to samples newer than the minimum offset
+	SetDedupInterval(20 * time.Millisecond)
+	f(1000, 1000, 20)
+	f(950, 1000, 20)
+	f(900, 1000, 100)
+}
@@ -0,0 +1,397 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// Exemplar is an exemplar attached to a sample of a time series.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#exemplars
+type Exemplar struct {
+	// Labels contains exemplar labels such as trace_id.
+	Labels []Tag
+
+	// Value is the exemplar value.
+	Value float64
+
+	// Timestamp is the exemplar timestamp in milliseconds.
+	Timestamp int64
+}
+
+func (e *Exemplar) equal(other *Exemplar) bool {
+	if e.Timestamp != other.Timestamp || math.Float64bits(e.Value) != math.Float64bits(other.Value) || len(e.Labels) != len(other.Labels) {
+		return false
+	}
+	for i := range e.Labels {
+		if !e.Labels[i].Equal(&other.Labels[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Exemplar) copyFrom(src *Exemplar) {
+	e.Labels = e.Labels[:0]
+	for i := range src.Labels {
+		e.Labels = append(e.Labels, Tag{
+			Key:   append([]byte{}, src.Labels[i].Key...),
+			Value: append([]byte{}, src.Labels[i].Value...),
+		})
+	}
+	e.Value = src.Value
+	e.Timestamp = src.Timestamp
+}
+
+func (e *Exemplar) marshal(dst []byte) []byte {
+	dst = encoding.MarshalVarUint64(dst, uint64(len(e.Labels)))
+	for i := range e.Labels {
+		dst = encoding.MarshalBytes(dst, e.Labels[i].Key)
+		dst = encoding.MarshalBytes(dst, e.Labels[i].Value)
+	}
+	dst = encoding.MarshalUint64(dst, math.Float64bits(e.Value))
+	dst = encoding.MarshalInt64(dst, e.Timestamp)
+	return dst
+}
+
+func (e *Exemplar) unmarshal(src []byte) ([]byte, error) {
+	src, labelsLen, err := encoding.UnmarshalVarUint64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal labels count: %w", err)
+	}
+	e.Labels = e.Labels[:0]
+	for i := uint64(0); i < labelsLen; i++ {
+		tail, key, err := encoding.UnmarshalBytes(src)
+		if err != nil {
+			return tail, fmt.Errorf("cannot unmarshal label name: %w", err)
+		}
+		tail, value, err := encoding.UnmarshalBytes(tail)
+		if err != nil {
+			return tail, fmt.Errorf("cannot unmarshal label value: %w", err)
+		}
+		src = tail
+		e.Labels = append(e.Labels, Tag{
+			Key:   append([]byte{}, key...),
+			Value: append([]byte{}, value...),
+		})
+	}
+	if len(src) < 16 {
+		return src, fmt.Errorf("cannot unmarshal value and timestamp from %d bytes; need at least 16 bytes", len(src))
+	}
+	e.Value = math.Float64frombits(encoding.UnmarshalUint64(src))
+	e.Timestamp = encoding.UnmarshalInt64(src[8:])
+	return src[16:], nil
+}
+
+// ExemplarRow is an exemplar for the time series with the given MetricNameRaw.
+type ExemplarRow struct {
+	// MetricNameRaw contains raw metric name, which must be decoded
+	// with MetricName.UnmarshalRaw.
+	MetricNameRaw []byte
+
+	Exemplar Exemplar
+}
+
+var (
+	maxExemplarsPerSeries = 10
+	maxExemplarSeries     = 10000
+)
+
+// SetExemplarsLimits sets the maximum number of exemplars to store per each time series
+// and the maximum number of time series with exemplars.
+//
+// Exemplars aren't stored if maxPerSeries <= 0.
+//
+// This function must be called before initializing the storage.
+func SetExemplarsLimits(maxPerSeries, maxSeries int) {
+	maxExemplarsPerSeries = maxPerSeries
+	maxExemplarSeries = maxSeries
+}
+
+// exemplarStore is a bounded in-memory store for the most recent exemplars per each time series.
+//
+// It holds up to maxSeries time series in two generations. When the current generation
+// becomes full, it becomes the previous generation, while the old previous generation is dropped.
+// This evicts exemplars for time series, which didn't receive new exemplars for a long time.
+type exemplarStore struct {
+	// exemplarsAdded is the number of exemplars added to the store.
+	exemplarsAdded uint64
+
+	mu sync.Mutex
+
+	curr map[string]*seriesExemplars
+	prev map[string]*seriesExemplars
+
+	maxPerSeries int
+	maxSeries    int
+}
+
+// seriesExemplars is a ring buffer with the most recent exemplars for a single time series.
+type seriesExemplars struct {
+	a       []Exemplar
+	nextIdx int
+}
+
+func newExemplarStore(maxPerSeries, maxSeries int) *exemplarStore {
+	if maxSeries < 2 {
+		maxSeries = 2
+	}
+	return &exemplarStore{
+		curr:         make(map[string]*seriesExemplars),
+		prev:         make(map[string]*seriesExemplars),
+		maxPerSeries: maxPerSeries,
+		maxSeries:    maxSeries,
+	}
+}
+
+func (es *exemplarStore) isEnabled() bool {
+	return es.maxPerSeries > 0
+}
+
+// getSeriesLocked returns exemplars for the given key, creating them if needed.
+//
+// es.mu must be locked by the caller.
+func (es *exemplarStore) getSeriesLocked(key []byte) *seriesExemplars {
+	if se := es.curr[string(key)]; se != nil {
+		return se
+	}
+	se := es.prev[string(key)]
+	if se != nil {
+		delete(es.prev, string(key))
+	} else {
+		se = &seriesExemplars{}
+	}
+	if len(es.curr) >= es.maxSeries/2 {
+		// Rotate generations.
+		es.prev = es.curr
+		es.curr = make(map[string]*seriesExemplars, len(es.prev))
+	}
+	es.curr[string(key)] = se
+	return se
+}
+
+// add adds e to the time series with the given key.
+func (es *exemplarStore) add(key []byte, e *Exemplar) {
+	es.mu.Lock()
+	se := es.getSeriesLocked(key)
+	ok := se.add(e, es.maxPerSeries)
+	es.mu.Unlock()
+	if ok {
+		atomic.AddUint64(&es.exemplarsAdded, 1)
+	}
+}
+
+// add adds e to se and returns true if e isn't a duplicate of the last added exemplar.
+func (se *seriesExemplars) add(e *Exemplar, maxPerSeries int) bool {
+	if len(se.a) > 0 {
+		lastIdx := se.nextIdx - 1
+		if lastIdx < 0 {
+			lastIdx = len(se.a) - 1
+		}
+		if se.a[lastIdx].equal(e) {
+			// Skip duplicate exemplar. Scrape targets usually expose the same exemplar
+			// until the next exemplar is registered.
+			return false
+		}
+	}
+	if len(se.a) < maxPerSeries {
+		se.a = append(se.a, Exemplar{})
+		se.nextIdx = len(se.a) - 1
+	}
+	se.a[se.nextIdx].copyFrom(e)
+	se.nextIdx++
+	if se.nextIdx >= maxPerSeries {
+		se.nextIdx = 0
+	}
+	return true
+}
+
+// search appends exemplars for the time series with the given key on the given tr to dst and returns the result.
+//
+// The returned exemplars are sorted by timestamp.
+func (es *exemplarStore) search(dst []Exemplar, key []byte, tr TimeRange) []Exemplar {
+	dstLen := len(dst)
+	es.mu.Lock()
+	se := es.curr[string(key)]
+	if se == nil {
+		se = es.prev[string(key)]
+	}
+	if se != nil {
+		for i := range se.a {
+			e := &se.a[i]
+			if e.Timestamp < tr.MinTimestamp || e.Timestamp > tr.MaxTimestamp {
+				continue
+			}
+			dst = append(dst, Exemplar{})
+			dst[len(dst)-1].copyFrom(e)
+		}
+	}
+	es.mu.Unlock()
+	result := dst[dstLen:]
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp < result[j].Timestamp
+	})
+	return dst
+}
+
+// seriesCount returns the number of time series in es.
+func (es *exemplarStore) seriesCount() int {
+	es.mu.Lock()
+	n := len(es.curr) + len(es.prev)
+	es.mu.Unlock()
+	return n
+}
+
+const exemplarsFileVersion = 1
+
+// marshal appends marshaled es to dst and returns the result.
+func (es *exemplarStore) marshal(dst []byte) []byte {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	dst = encoding.MarshalUint64(dst, exemplarsFileVersion)
+	// Marshal the previous generation first, so it remains the oldest one after unmarshaling.
+	for _, m := range []map[string]*seriesExemplars{es.prev, es.curr} {
+		dst = encoding.MarshalVarUint64(dst, uint64(len(m)))
+		for key, se := range m {
+			dst = encoding.MarshalBytes(dst, []byte(key))
+			dst = encoding.MarshalVarUint64(dst, uint64(len(se.a)))
+			// Marshal exemplars from the oldest to the newest.
+			for i := range se.a {
+				e := &se.a[(se.nextIdx+i)%len(se.a)]
+				dst = e.marshal(dst)
+			}
+		}
+	}
+	return dst
+}
+
+// unmarshal adds exemplars from src to es.
+func (es *exemplarStore) unmarshal(src []byte) error {
+	if len(src) < 8 {
+		return fmt.Errorf("too short data; got %d bytes; want at least 8 bytes", len(src))
+	}
+	version := encoding.UnmarshalUint64(src)
+	if version != exemplarsFileVersion {
+		return fmt.Errorf("unsupported version; got %d; want %d", version, exemplarsFileVersion)
+	}
+	src = src[8:]
+	var e Exemplar
+	for gen := 0; gen < 2; gen++ {
+		tail, seriesCount, err := encoding.UnmarshalVarUint64(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal series count: %w", err)
+		}
+		src = tail
+		for i := uint64(0); i < seriesCount; i++ {
+			tail, key, err := encoding.UnmarshalBytes(src)
+			if err != nil {
+				return fmt.Errorf("cannot unmarshal series key: %w", err)
+			}
+			tail, exemplarsCount, err := encoding.UnmarshalVarUint64(tail)
+			if err != nil {
+				return fmt.Errorf("cannot unmarshal exemplars count: %w", err)
+			}
+			src = tail
+			for j := uint64(0); j < exemplarsCount; j++ {
+				tail, err := e.unmarshal(src)
+				if err != nil {
+					return fmt.Errorf("cannot unmarshal exemplar: %w", err)
+				}
+				src = tail
+				es.add(key, &e)
+			}
+		}
+	}
+	if len(src) > 0 {
+		return fmt.Errorf("unexpected non-empty tail left after unmarshaling exemplars; len(tail)=%d", len(src))
+	}
+	return nil
+}
+
+// AddExemplars adds the given exemplars to s.
+//
+// Only the most recent exemplars per each time series are stored.
+// See SetExemplarsLimits for details.
+func (s *Storage) AddExemplars(ers []ExemplarRow) error {
+	if s.isReadOnlyReplica {
+		return ErrReadOnlyReplica
+	}
+	if !s.exemplars.isEnabled() {
+		return nil
+	}
+	var key []byte
+	mn := GetMetricName()
+	defer PutMetricName(mn)
+	for i := range ers {
+		er := &ers[i]
+		if err := mn.UnmarshalRaw(er.MetricNameRaw); err != nil {
+			return fmt.Errorf("cannot unmarshal MetricNameRaw %q: %w", er.MetricNameRaw, err)
+		}
+		mn.sortTags()
+		key = mn.Marshal(key[:0])
+		s.exemplars.add(key, &er.Exemplar)
+	}
+	return nil
+}
+
+// SearchExemplars appends exemplars for the time series with the given mn on the given tr to dst and returns the result.
+//
+// The returned exemplars are sorted by timestamp.
+func (s *Storage) SearchExemplars(dst []Exemplar, mn *MetricName, tr TimeRange) []Exemplar {
+	if !s.exemplars.isEnabled() {
+		return dst
+	}
+	mnCopy := GetMetricName()
+	mnCopy.CopyFrom(mn)
+	mnCopy.sortTags()
+	key := mnCopy.Marshal(nil)
+	PutMetricName(mnCopy)
+	return s.exemplars.search(dst, key, tr)
+}
+
+func (s *Storage) mustLoadExemplars() *exemplarStore {
+	es := newExemplarStore(maxExemplarsPerSeries, maxExemplarSeries)
+	if !es.isEnabled() {
+		return es
+	}
+	path := s.cachePath + "/exemplars"
+	if !fs.IsPathExist(path) {
+		return es
+	}
+	logger.Infof("loading exemplars from %q...", path)
+	startTime := time.Now()
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read %s: %s", path, err)
+	}
+	if err := es.unmarshal(src); err != nil {
+		logger.Errorf("discarding exemplars from %s: %s", path, err)
+		return newExemplarStore(maxExemplarsPerSeries, maxExemplarSeries)
+	}
+	logger.Infof("loaded exemplars from %q in %.3f seconds; seriesCount: %d; sizeBytes: %d", path, time.Since(startTime).Seconds(), es.seriesCount(), len(src))
+	return es
+}
+
+func (s *Storage) mustSaveExemplars() {
+	path := s.cachePath + "/exemplars"
+	if !s.exemplars.isEnabled() {
+		fs.MustRemoveAll(path)
+		return
+	}
+	logger.Infof("saving exemplars to %q...", path)
+	startTime := time.Now()
+	dst := s.exemplars.marshal(nil)
+	if err := fs.ReplaceFileAtomically(path, dst); err != nil {
+		logger.Panicf("FATAL: cannot write %d bytes to %q: %s", len(dst), path, err)
+	}
+	logger.Infof("saved exemplars to %q in %.3f seconds; seriesCount: %d; sizeBytes: %d", path, time.Since(startTime).Seconds(), s.exemplars.seriesCount(), len(dst))
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func newTestExemplar(traceID string, value float64, timestamp int64) Exemplar {
+	return Exemplar{
+		Labels: []Tag{{
+			Key:   []byte("trace_id"),
+			Value: []byte(traceID),
+		}},
+		Value:     value,
+		Timestamp: timestamp,
+	}
+}
+
+func TestExemplarStoreAddSearch(t *testing.T) {
+	es := newExemplarStore(3, 100)
+	key := []byte("foo")
+	for i := 0; i < 5; i++ {
+		e := newTestExemplar(fmt.Sprintf("trace_%d", i), float64(i), int64(i*1000))
+		es.add(key, &e)
+		// Duplicate exemplars must be skipped.
+		es.add(key, &e)
+	}
+	if n := es.exemplarsAdded; n != 5 {
+		t.Fatalf("unexpected number of added exemplars; got %d; want 5", n)
+	}
+
+	f := func(key string, tr TimeRange, timestampsExpected []int64) {
+		t.Helper()
+		exemplars := es.search(nil, []byte(key), tr)
+		var timestamps []int64
+		for _, e := range exemplars {
+			timestamps = append(timestamps, e.Timestamp)
+			if traceID := fmt.Sprintf("trace_%d", e.Timestamp/1000); string(e.Labels[0].Value) != traceID {
+				t.Fatalf("unexpected trace_id for exemplar with timestamp %d; got %q; want %q", e.Timestamp, e.Labels[0].Value, traceID)
+			}
+		}
+		if !reflect.DeepEqual(timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps for key=%q, tr=%s; got %v; want %v", key, &tr, timestamps, timestampsExpected)
+		}
+	}
+	// Only the last 3 exemplars must be kept.
+	f("foo", TimeRange{MinTimestamp: 0, MaxTimestamp: 10000}, []int64{2000, 3000, 4000})
+	f("foo", TimeRange{MinTimestamp: 2500, MaxTimestamp: 3500}, []int64{3000})
+	f("foo", TimeRange{MinTimestamp: 5000, MaxTimestamp: 10000}, nil)
+	f("bar", TimeRange{MinTimestamp: 0, MaxTimestamp: 10000}, nil)
+
+	// Verify marshaling and unmarshaling.
+	data := es.marshal(nil)
+	es = newExemplarStore(3, 100)
+	if err := es.unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal exemplars: %s", err)
+	}
+	f("foo", TimeRange{MinTimestamp: 0, MaxTimestamp: 10000}, []int64{2000, 3000, 4000})
+	if err := es.unmarshal(data[:len(data)-1]); err == nil {
+		t.Fatalf("expecting non-nil error when unmarshaling truncated data")
+	}
+}
+
+func TestExemplarStoreRotation(t *testing.T) {
+	es := newExemplarStore(1, 4)
+	add := func(key string) {
+		e := newTestExemplar(key, 1, 1000)
+		es.add([]byte(key), &e)
+	}
+	has := func(key string) bool {
+		return len(es.search(nil, []byte(key), TimeRange{MinTimestamp: 0, MaxTimestamp: 2000})) > 0
+	}
+	add("a")
+	add("b")
+	// This moves a and b to the previous generation.
+	add("c")
+	// This moves a back to the current generation.
+	add("a")
+	// This moves c and a to the previous generation and drops b.
+	add("d")
+	for _, key := range []string{"a", "c", "d"} {
+		if !has(key) {
+			t.Fatalf("missing exemplars for %q", key)
+		}
+	}
+	if has("b") {
+		t.Fatalf("unexpected exemplars for %q", "b")
+	}
+	if n := es.seriesCount(); n != 3 {
+		t.Fatalf("unexpected number of series; got %d; want 3", n)
+	}
+}
+
+func TestStorageAddSearchExemplars(t *testing.T) {
+	s := &Storage{
+		exemplars: newExemplarStore(10, 100),
+	}
+	var mn MetricName
+	mn.MetricGroup = []byte("http_request_duration_seconds_bucket")
+	mn.AddTag("le", "0.5")
+	mn.AddTag("job", "api")
+	ers := []ExemplarRow{{
+		MetricNameRaw: mn.marshalRaw(nil),
+		Exemplar:      newTestExemplar("abc", 0.3, 1000),
+	}}
+	if err := s.AddExemplars(ers); err != nil {
+		t.Fatalf("cannot add exemplars: %s", err)
+	}
+
+	// Search with tags in another order.
+	var mnSearch MetricName
+	mnSearch.MetricGroup = []byte("http_request_duration_seconds_bucket")
+	mnSearch.AddTag("job", "api")
+	mnSearch.AddTag("le", "0.5")
+	exemplars := s.SearchExemplars(nil, &mnSearch, TimeRange{MinTimestamp: 0, MaxTimestamp: 2000})
+	exemplarsExpected := []Exemplar{newTestExemplar("abc", 0.3, 1000)}
+	if !reflect.DeepEqual(exemplars, exemplarsExpected) {
+		t.Fatalf("unexpected exemplars;\ngot\n%+v\nwant\n%+v", exemplars, exemplarsExpected)
+	}
+	if string(mnSearch.Tags[0].Key) != "job" {
+		t.Fatalf("SearchExemplars mustn't modify the passed MetricName")
+	}
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/blockcache"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+)
+
+var maxPrewarmBlocks int
+
+// SetMaxPrewarmBlocks sets the maximum number of the most recently accessed blocks per each block cache,
+// which are saved on shutdown and are read into the caches in background on startup.
+//
+// This reduces query latency after restarts. Zero value disables saving and prewarming hot blocks.
+//
+// This function must be called before OpenStorage.
+func SetMaxPrewarmBlocks(n int) {
+	maxPrewarmBlocks = n
+}
+
+const (
+	// hotBlocksFilename is the name of the file with hot index blocks for data parts.
+	hotBlocksFilename = "hot_blocks"
+
+	// hotIndexDBBlocksFilename is the name of the file with hot blocks for indexdb and metric_metadata parts.
+	hotIndexDBBlocksFilename = "hot_indexdb_blocks"
+)
+
+const hotBlocksFileVersion = 1
+
+// hotBlocks contains offsets of hot index blocks per part path.
+type hotBlocks map[string][]uint64
+
+func (hb hotBlocks) len() int {
+	n := 0
+	for _, offsets := range hb {
+		n += len(offsets)
+	}
+	return n
+}
+
+func getHotBlocks(maxBlocks int) hotBlocks {
+	hb := make(hotBlocks)
+	for _, k := range ibCache.HotKeys(maxBlocks) {
+		p := k.Part.(*part)
+		if p.path == "" {
+			// Skip in-memory parts, since they don't survive restarts.
+			continue
+		}
+		hb[p.path] = append(hb[p.path], k.Offset)
+	}
+	return hb
+}
+
+func (hb hotBlocks) marshal(dst []byte) []byte {
+	dst = encoding.MarshalUint64(dst, hotBlocksFileVersion)
+	dst = encoding.MarshalVarUint64(dst, uint64(len(hb)))
+	for partPath, offsets := range hb {
+		dst = encoding.MarshalBytes(dst, []byte(partPath))
+		dst = encoding.MarshalVarUint64(dst, uint64(len(offsets)))
+		for _, offset := range offsets {
+			dst = encoding.MarshalVarUint64(dst, offset)
+		}
+	}
+	return dst
+}
+
+func unmarshalHotBlocks(src []byte) (hotBlocks, error) {
+	if len(src) < 8 {
+		return nil, fmt.Errorf("too short data; got %d bytes; want at least 8 bytes", len(src))
+	}
+	version := encoding.UnmarshalUint64(src)
+	if version != hotBlocksFileVersion {
+		return nil, fmt.Errorf("unsupported version; got %d; want %d", version, hotBlocksFileVersion)
+	}
+	tail, partsCount, err := encoding.UnmarshalVarUint64(src[8:])
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal parts count: %w", err)
+	}
+	src = tail
+	hb := make(hotBlocks, partsCount)
+	for i := uint64(0); i < partsCount; i++ {
+		tail, partPath, err := encoding.UnmarshalBytes(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal part path: %w", err)
+		}
+		tail, offsetsCount, err := encoding.UnmarshalVarUint64(tail)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal offsets count for part %q: %w", partPath, err)
+		}
+		var offsets []uint64
+		for j := uint64(0); j < offsetsCount; j++ {
+			var offset uint64
+			tail, offset, err = encoding.UnmarshalVarUint64(tail)
+			if err != nil {
+				return nil, fmt.Errorf("cannot unmarshal offset for part %q: %w", partPath, err)
+			}
+			offsets = append(offsets, offset)
+		}
+		hb[string(partPath)] = offsets
+		src = tail
+	}
+	if len(src) > 0 {
+		return nil, fmt.Errorf("unexpected non-empty tail left after unmarshaling hot blocks; len(tail)=%d", len(src))
+	}
+	return hb, nil
+}
+
+// mustSaveHotBlocks saves keys for the most recently accessed blocks, so they could be prewarmed on the next start.
+//
+// It must be called before closing the tables, since blocks for closed parts are removed from caches.
+func (s *Storage) mustSaveHotBlocks() {
+	if maxPrewarmBlocks <= 0 {
+		return
+	}
+	path := s.cachePath + "/" + hotBlocksFilename
+	logger.Infof("saving hot blocks to %q...", path)
+	startTime := time.Now()
+	hb := getHotBlocks(maxPrewarmBlocks)
+	if err := fs.MkdirAllIfNotExist(s.cachePath); err != nil {
+		logger.Panicf("FATAL: cannot create directory %q: %s", s.cachePath, err)
+	}
+	if err := fs.ReplaceFileAtomically(path, hb.marshal(nil)); err != nil {
+		logger.Panicf("FATAL: cannot save hot blocks to %q: %s", path, err)
+	}
+	indexDBPath := s.cachePath + "/" + hotIndexDBBlocksFilename
+	indexDBBlocks, err := mergeset.SaveHotBlocks(indexDBPath, maxPrewarmBlocks)
+	if err != nil {
+		logger.Panicf("FATAL: cannot save hot indexdb blocks to %q: %s", indexDBPath, err)
+	}
+	logger.Infof("saved hot blocks to %q in %.3f seconds; blocks: %d; indexdbBlocks: %d", path, time.Since(startTime).Seconds(), hb.len(), indexDBBlocks)
+}
+
+func (s *Storage) startHotBlocksPrewarmer() {
+	if maxPrewarmBlocks <= 0 {
+		return
+	}
+	s.hotBlocksPrewarmerWG.Add(1)
+	go func() {
+		s.prewarmHotBlocks()
+		s.hotBlocksPrewarmerWG.Done()
+	}()
+}
+
+// prewarmHotBlocks reads blocks saved by mustSaveHotBlocks into caches.
+func (s *Storage) prewarmHotBlocks() {
+	path := s.cachePath + "/" + hotBlocksFilename
+	indexDBPath := s.cachePath + "/" + hotIndexDBBlocksFilename
+	if !fs.IsPathExist(path) && !fs.IsPathExist(indexDBPath) {
+		return
+	}
+	logger.Infof("prewarming hot blocks from %q...", path)
+	startTime := time.Now()
+
+	// Read indexdb blocks at first, since they are needed for locating series in data parts.
+	indexDBBlocks := 0
+	hb, err := mergeset.LoadHotBlocks(indexDBPath)
+	if err != nil {
+		logger.Errorf("skipping prewarming hot indexdb blocks: %s", err)
+	} else {
+		idb := s.idb()
+		tbs := []*mergeset.Table{idb.tb, s.metricMetadata.tb}
+		idb.doExtDB(func(extDB *indexDB) {
+			tbs = append(tbs, extDB.tb)
+		})
+		for _, tb := range tbs {
+			n, err := tb.PrewarmHotBlocks(hb, s.stop)
+			indexDBBlocks += n
+			if err != nil {
+				logger.Errorf("cannot prewarm hot indexdb blocks: %s", err)
+				break
+			}
+		}
+	}
+	atomic.AddUint64(&hotBlocksPrewarmed, uint64(indexDBBlocks))
+
+	blocks := 0
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		var hb hotBlocks
+		hb, err = unmarshalHotBlocks(data)
+		if err == nil {
+			blocks, err = s.tb.prewarmHotBlocks(hb, s.stop)
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logger.Errorf("cannot prewarm hot blocks from %q: %s", path, err)
+	}
+	logger.Infof("prewarmed hot blocks from %q in %.3f seconds; blocks: %d; indexdbBlocks: %d", path, time.Since(startTime).Seconds(), blocks, indexDBBlocks)
+}
+
+// prewarmHotBlocks reads index blocks from hb for tb parts into ibCache.
+//
+// It stops when ibCache is full or when stopCh is closed.
+// It returns the number of read blocks.
+func (tb *table) prewarmHotBlocks(hb hotBlocks, stopCh <-chan struct{}) (int, error) {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+
+	blocksRead := 0
+	for _, ptw := range ptws {
+		pws := ptw.pt.GetParts(nil)
+		n, err := prewarmHotBlocksForParts(pws, hb, stopCh)
+		ptw.pt.PutParts(pws)
+		blocksRead += n
+		if err != nil {
+			return blocksRead, err
+		}
+	}
+	return blocksRead, nil
+}
+
+func prewarmHotBlocksForParts(pws []*partWrapper, hb hotBlocks, stopCh <-chan struct{}) (int, error) {
+	blocksRead := 0
+	var ps partSearch
+	for _, pw := range pws {
+		p := pw.p
+		offsets := hb[p.path]
+		if len(offsets) == 0 {
+			continue
+		}
+		ps.reset()
+		ps.p = p
+		for _, offset := range offsets {
+			select {
+			case <-stopCh:
+				return blocksRead, nil
+			default:
+			}
+			if ibCache.SizeBytes() >= ibCache.SizeMaxBytes() {
+				return blocksRead, nil
+			}
+			// Index blocks are written in the order of metaindex rows, so their offsets are sorted.
+			mrs := p.metaindex
+			n := sort.Search(len(mrs), func(i int) bool {
+				return mrs[i].IndexBlockOffset >= offset
+			})
+			if n >= len(mrs) || mrs[n].IndexBlockOffset != offset {
+				continue
+			}
+			ib, err := ps.readIndexBlock(&mrs[n])
+			if err != nil {
+				return blocksRead, fmt.Errorf("cannot read index block for part %q at offset %d: %w", p.path, offset, err)
+			}
+			indexBlockKey := blockcache.Key{
+				Part:   p,
+				Offset: offset,
+			}
+			ibCache.PutBlock(indexBlockKey, ib)
+			atomic.AddUint64(&hotBlocksPrewarmed, 1)
+			blocksRead++
+		}
+	}
+	return blocksRead, nil
+}
+
+var hotBlocksPrewarmed uint64
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHotBlocksMarshalUnmarshal(t *testing.T) {
+	hb := hotBlocks{
+		"foo": {0, 123, 456},
+		"bar": {1},
+	}
+	data := hb.marshal(nil)
+	hb2, err := unmarshalHotBlocks(data)
+	if err != nil {
+		t.Fatalf("cannot unmarshal hot blocks: %s", err)
+	}
+	if !reflect.DeepEqual(hb2, hb) {
+		t.Fatalf("unexpected unmarshaled hot blocks;\ngot\n%+v\nwant\n%+v", hb2, hb)
+	}
+	if n := hb2.len(); n != 4 {
+		t.Fatalf("unexpected number of hot blocks; got %d; want 4", n)
+	}
+
+	// Corrupted data must result in error.
+	f := func(data []byte) {
+		t.Helper()
+		if _, err := unmarshalHotBlocks(data); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling %q", data)
+		}
+	}
+	f(nil)
+	f(data[:7])
+	f(data[:len(data)-1])
+	f(append(data, 1))
+}
+
+func TestStorageHotBlocks(t *testing.T) {
+	maxPrewarmBlocksOrig := maxPrewarmBlocks
+	SetMaxPrewarmBlocks(1e6)
+	defer SetMaxPrewarmBlocks(maxPrewarmBlocksOrig)
+
+	path := "TestStorageHotBlocks"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+
+	timestamp := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	for i := 0; i < 1000; i++ {
+		var mn MetricName
+		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+		mn.AddTag("job", "hot_blocks")
+		metricNameRaw := mn.marshalRaw(nil)
+		for j := 0; j < 10; j++ {
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     timestamp - int64(j)*1000,
+				Value:         float64(j),
+			})
+		}
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	// Only blocks for file parts are saved.
+	s.DebugFlush()
+	s.tb.flushInmemoryPartsToFiles()
+
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte("job"), []byte("hot_blocks"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: timestamp - 3600*1000,
+		MaxTimestamp: timestamp + 3600*1000,
+	}
+	search := func(s *Storage) {
+		t.Helper()
+		var sr Search
+		sr.Init(nil, s, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
+		n := 0
+		for sr.NextMetricBlock() {
+			n++
+		}
+		if err := sr.Error(); err != nil {
+			t.Fatalf("unexpected search error: %s", err)
+		}
+		sr.MustClose()
+		if n != 1000 {
+			t.Fatalf("unexpected number of found blocks; got %d; want 1000", n)
+		}
+	}
+	// Search multiple times, so the accessed blocks are put into caches.
+	for i := 0; i < 2; i++ {
+		search(s)
+	}
+	// ibCache is shared among all the storages, so only blocks for parts under path are counted.
+	hotBlocksCount := getCachedIndexBlocksCount(path)
+	if hotBlocksCount == 0 {
+		t.Fatalf("expecting non-zero hot blocks before the shutdown")
+	}
+	s.MustClose()
+
+	// Blocks for the closed storage must be removed from caches.
+	if n := getCachedIndexBlocksCount(path); n != 0 {
+		t.Fatalf("unexpected number of cached index blocks after the shutdown; got %d; want 0", n)
+	}
+
+	prewarmedOrig := atomic.LoadUint64(&hotBlocksPrewarmed)
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage: %s", err)
+	}
+	s.hotBlocksPrewarmerWG.Wait()
+	if n := getCachedIndexBlocksCount(path); n != hotBlocksCount {
+		t.Fatalf("unexpected number of cached index blocks after prewarming; got %d; want %d", n, hotBlocksCount)
+	}
+	if n := atomic.LoadUint64(&hotBlocksPrewarmed) - prewarmedOrig; n <= uint64(hotBlocksCount) {
+		t.Fatalf("expecting more than %d prewarmed blocks including indexdb blocks; got %d", hotBlocksCount, n)
+	}
+	search(s)
+
+	// Hot blocks must be saved on every shutdown.
+	s.MustClose()
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage for the second time: %s", err)
+	}
+	s.MustClose()
+}
+
+// getCachedIndexBlocksCount returns the number of blocks in ibCache for parts located under the given storage path.
+func getCachedIndexBlocksCount(path string) int {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		panic(fmt.Errorf("cannot obtain absolute path for %q: %w", path, err))
+	}
+	n := 0
+	for _, k := range ibCache.HotKeys(ibCache.Len()) {
+		p := k.Part.(*part)
+		if strings.HasPrefix(p.path, absPath+"/") {
+			n++
+		}
+	}
+	return n
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
 	"github.com/VictoriaMetrics/fastcache"
@@ -127,7 +128,12 @@ func openIndexDB(path string, s *Storage, rotationTimestamp uint64) (*indexDB, e
 		return nil, fmt.Errorf("failed to parse indexdb path %q: %w", path, err)
 	}
 
-	tb, err := mergeset.OpenTable(path, invalidateTagFiltersCache, mergeTagToMetricIDsRows)
+	var tb *mergeset.Table
+	if s.isReadOnlyReplica {
+		tb, err = mergeset.OpenTableReadOnly(path, invalidateTagFiltersCache, getTagToMetricIDsPrefix)
+	} else {
+		tb, err = mergeset.OpenTable(path, invalidateTagFiltersCache, mergeTagToMetricIDsRows, getTagToMetricIDsPrefix)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("cannot open indexDB %q: %w", path, err)
 	}
@@ -482,6 +488,9 @@ type indexSearch struct {
 	// deadline in unix timestamp seconds for the given search.
 	deadline uint64
 
+	// canceled is an optional flag, which is set to non-zero when the given search is canceled.
+	canceled *uint32
+
 	// tsidByNameMisses and tsidByNameSkips is used for a performance
 	// hack in GetOrCreateTSIDByName. See the comment there.
 	tsidByNameMisses int
@@ -538,6 +547,7 @@ func (db *indexDB) putIndexSearch(is *indexSearch) {
 	is.kb.Reset()
 	is.mp.Reset()
 	is.deadline = 0
+	is.canceled = nil
 
 	// Do not reset tsidByNameMisses and tsidByNameSkips,
 	// since they are used in GetOrCreateTSIDByName across call boundaries.
@@ -768,7 +778,7 @@ func (is *indexSearch) searchTagKeysOnDate(tks map[string]struct{}, date uint64,
 	ts.Seek(prefix)
 	for len(tks) < maxTagKeys && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return err
 			}
 		}
@@ -849,7 +859,7 @@ func (is *indexSearch) searchTagKeys(tks map[string]struct{}, maxTagKeys int) er
 	ts.Seek(prefix)
 	for len(tks) < maxTagKeys && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return err
 			}
 		}
@@ -971,7 +981,7 @@ func (is *indexSearch) searchTagValuesOnDate(tvs map[string]struct{}, tagKey []b
 	ts.Seek(prefix)
 	for len(tvs) < maxTagValues && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return err
 			}
 		}
@@ -1056,7 +1066,7 @@ func (is *indexSearch) searchTagValues(tvs map[string]struct{}, tagKey []byte, m
 	ts.Seek(prefix)
 	for len(tvs) < maxTagValues && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return err
 			}
 		}
@@ -1207,7 +1217,7 @@ func (is *indexSearch) searchTagValueSuffixesForPrefix(tvss map[string]struct{},
 	ts.Seek(prefix)
 	for len(tvss) < maxTagValueSuffixes && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return err
 			}
 		}
@@ -1285,7 +1295,7 @@ func (is *indexSearch) getSeriesCount() (uint64, error) {
 	ts.Seek(kb.B)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return 0, err
 			}
 		}
@@ -1372,7 +1382,7 @@ func (is *indexSearch) getTSDBStatusWithFiltersForDate(tfss []*TagFilters, date
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return nil, err
 			}
 		}
@@ -1595,6 +1605,11 @@ func (db *indexDB) searchMetricNameWithCache(dst []byte, metricID uint64) ([]byt
 	// after a snapshot or due to unflushed entries.
 	atomic.AddUint64(&db.missingMetricNamesForMetricID, 1)
 
+	if db.s.isReadOnlyReplica {
+		// Read-only replica cannot modify indexDB. The missing entry may become visible after the next refresh.
+		return dst, io.EOF
+	}
+
 	// Mark the metricID as deleted, so it will be created again when new data point
 	// for the given time series will arrive.
 	if err := db.deleteMetricIDs([]uint64{metricID}); err != nil {
@@ -1690,7 +1705,7 @@ func (is *indexSearch) loadDeletedMetricIDs() (*uint64set.Set, error) {
 	ts := &is.ts
 	kb := &is.kb
 	kb.B = append(kb.B[:0], nsPrefixDeletedMetricID)
-	ts.Seek(kb.B)
+	ts.SeekPrefix(kb.B)
 	for ts.NextItem() {
 		item := ts.Item
 		if !bytes.HasPrefix(item, kb.B) {
@@ -1710,7 +1725,7 @@ func (is *indexSearch) loadDeletedMetricIDs() (*uint64set.Set, error) {
 }
 
 // searchTSIDs returns sorted tsids matching the given tfss over the given tr.
-func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
+func (db *indexDB) searchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, canceled *uint32) ([]TSID, error) {
 	if len(tfss) == 0 {
 		return nil, nil
 	}
@@ -1725,16 +1740,19 @@ func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 	tsids, ok := db.getFromTagFiltersCache(tfKeyBuf.B)
 	if ok {
 		// Fast path - tsids found in the cache.
+		qt.Printf("found %d matching series in the tag filters cache", len(tsids))
 		return tsids, nil
 	}
 
 	// Slow path - search for tsids in the db and extDB.
 	is := db.getIndexSearch(deadline)
+	is.canceled = canceled
 	localTSIDs, err := is.searchTSIDs(tfss, tr, maxMetrics)
 	db.putIndexSearch(is)
 	if err != nil {
 		return nil, err
 	}
+	qt.Printf("found %d matching series in the current indexdb", len(localTSIDs))
 
 	var extTSIDs []TSID
 	if db.doExtDB(func(extDB *indexDB) {
@@ -1746,11 +1764,18 @@ func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 		tsids, ok := extDB.getFromTagFiltersCache(tfKeyExtBuf.B)
 		if ok {
 			extTSIDs = tsids
+			qt.Printf("found %d matching series in the tag filters cache for the previous indexdb", len(extTSIDs))
 			return
 		}
 		is := extDB.getIndexSearch(deadline)
+		is.canceled = canceled
 		extTSIDs, err = is.searchTSIDs(tfss, tr, maxMetrics)
 		extDB.putIndexSearch(is)
+		if err != nil {
+			// Do not cache partial results for failed or canceled search.
+			return
+		}
+		qt.Printf("found %d matching series in the previous indexdb", len(extTSIDs))
 
 		sort.Slice(extTSIDs, func(i, j int) bool { return extTSIDs[i].Less(&extTSIDs[j]) })
 		extDB.putToTagFiltersCache(extTSIDs, tfKeyExtBuf.B)
@@ -1782,7 +1807,7 @@ func (is *indexSearch) getTSIDByMetricName(dst *TSID, metricName []byte) error {
 	kb.B = append(kb.B[:0], nsPrefixMetricNameToTSID)
 	kb.B = append(kb.B, metricName...)
 	kb.B = append(kb.B, kvSeparatorChar)
-	ts.Seek(kb.B)
+	ts.SeekPrefix(kb.B)
 	for ts.NextItem() {
 		if !bytes.HasPrefix(ts.Item, kb.B) {
 			// Nothing found.
@@ -1920,7 +1945,7 @@ func (is *indexSearch) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics
 	i := 0
 	for loopsPaceLimiter, metricID := range metricIDs {
 		if loopsPaceLimiter&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return nil, err
 			}
 		}
@@ -1996,7 +2021,7 @@ func (is *indexSearch) updateMetricIDsByMetricNameMatch(metricIDs, srcMetricIDs
 	defer PutMetricName(mn)
 	for loopsPaceLimiter, metricID := range sortedMetricIDs {
 		if loopsPaceLimiter&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return err
 			}
 		}
@@ -2286,7 +2311,7 @@ func (is *indexSearch) getMetricIDsForTagFilterSlow(tf *tagFilter, f func(metric
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterMediumIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return loopsCount, err
 			}
 		}
@@ -2388,10 +2413,10 @@ func (is *indexSearch) updateMetricIDsForOrSuffix(prefix []byte, metricIDs *uint
 	mp.Reset()
 	var loopsCount int64
 	loopsPaceLimiter := 0
-	ts.Seek(prefix)
+	ts.SeekPrefix(prefix)
 	for metricIDs.Len() < maxMetrics && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return loopsCount, err
 			}
 		}
@@ -2891,10 +2916,10 @@ func (is *indexSearch) updateMetricIDsForPrefix(prefix []byte, metricIDs *uint64
 	ts := &is.ts
 	mp := &is.mp
 	loopsPaceLimiter := 0
-	ts.Seek(prefix)
+	ts.SeekPrefix(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return err
 			}
 		}
@@ -3095,6 +3120,37 @@ func (mp *tagToMetricIDsRowParser) IsDeletedTag(dmis *uint64set.Set) bool {
 	return true
 }
 
+// getTagToMetricIDsPrefix returns the (date, tag) prefix for the given tag->metricIDs item.
+//
+// The prefix is registered in per-part bloom filters, so searches for missing tags may skip indexdb parts
+// without reading their blocks. nil is returned for items without such prefix.
+func getTagToMetricIDsPrefix(item []byte) []byte {
+	tail, nsPrefix, err := unmarshalCommonPrefix(item)
+	if err != nil {
+		return nil
+	}
+	switch nsPrefix {
+	case nsPrefixTagToMetricIDs:
+	case nsPrefixDateTagToMetricIDs:
+		if len(tail) < 8 {
+			return nil
+		}
+		tail = tail[8:]
+	default:
+		return nil
+	}
+	// The marshaled tag key and value end with tagSeparatorChar, which cannot occur inside them due to escaping.
+	n := bytes.IndexByte(tail, tagSeparatorChar)
+	if n < 0 {
+		return nil
+	}
+	m := bytes.IndexByte(tail[n+1:], tagSeparatorChar)
+	if m < 0 {
+		return nil
+	}
+	return item[:len(item)-len(tail)+n+1+m+1]
+}
+
 func mergeTagToMetricIDsRows(data []byte, items []mergeset.Item) ([]byte, []mergeset.Item) {
 	data, items = mergeTagToMetricIDsRowsInternal(data, items, nsPrefixTagToMetricIDs)
 	data, items = mergeTagToMetricIDsRowsInternal(data, items, nsPrefixDateTagToMetricIDs)
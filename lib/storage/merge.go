@@ -14,14 +14,18 @@ import (
 //
 // mergeBlockStreams returns immediately if stopCh is closed.
 //
+// Samples outside the retention deadlines from rds are dropped. rds may be nil.
+//
+// Samples deleted by per-stream tombstones from blockStreamReader.tss are dropped.
+//
 // rowsMerged is atomically updated with the number of merged rows during the merge.
 func mergeBlockStreams(ph *partHeader, bsw *blockStreamWriter, bsrs []*blockStreamReader, stopCh <-chan struct{},
-	dmis *uint64set.Set, retentionDeadline int64, rowsMerged, rowsDeleted *uint64) error {
+	dmis *uint64set.Set, rds *retentionDeadlines, rowsMerged, rowsDeleted *uint64) error {
 	ph.Reset()
 
 	bsm := bsmPool.Get().(*blockStreamMerger)
 	bsm.Init(bsrs)
-	err := mergeBlockStreamsInternal(ph, bsw, bsm, stopCh, dmis, retentionDeadline, rowsMerged, rowsDeleted)
+	err := mergeBlockStreamsInternal(ph, bsw, bsm, stopCh, dmis, rds, rowsMerged, rowsDeleted)
 	bsm.reset()
 	bsmPool.Put(bsm)
 	bsw.MustClose()
@@ -40,7 +44,7 @@ var bsmPool = &sync.Pool{
 var errForciblyStopped = fmt.Errorf("forcibly stopped")
 
 func mergeBlockStreamsInternal(ph *partHeader, bsw *blockStreamWriter, bsm *blockStreamMerger, stopCh <-chan struct{},
-	dmis *uint64set.Set, retentionDeadline int64, rowsMerged, rowsDeleted *uint64) error {
+	dmis *uint64set.Set, rds *retentionDeadlines, rowsMerged, rowsDeleted *uint64) error {
 	pendingBlockIsEmpty := true
 	pendingBlock := getBlock()
 	defer putBlock(pendingBlock)
@@ -57,11 +61,22 @@ func mergeBlockStreamsInternal(ph *partHeader, bsw *blockStreamWriter, bsm *bloc
 			atomic.AddUint64(rowsDeleted, uint64(bsm.Block.bh.RowsCount))
 			continue
 		}
+		retentionDeadline := TimestampFromMsecs(rds.get(bsm.Block.bh.TSID.MetricID))
 		if bsm.Block.bh.MaxTimestamp < retentionDeadline {
 			// Skip blocks out of the given retention.
 			atomic.AddUint64(rowsDeleted, uint64(bsm.Block.bh.RowsCount))
 			continue
 		}
+		if tss := bsm.Tombstones(); tss.hasItems() {
+			ok, err := applyTombstones(bsm.Block, tss, rowsDeleted)
+			if err != nil {
+				return fmt.Errorf("cannot apply tombstones to block: %w", err)
+			}
+			if !ok {
+				// Skip blocks with all the samples deleted.
+				continue
+			}
+		}
 		if pendingBlockIsEmpty {
 			// Load the next block if pendingBlock is empty.
 			pendingBlock.CopyFrom(bsm.Block)
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+)
+
+// MetricMetadata contains metadata for a metric family.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+type MetricMetadata struct {
+	// MetricFamilyName is the name of the metric family.
+	MetricFamilyName string
+
+	// Type is the metric type such as counter, gauge, histogram or summary.
+	Type string
+
+	// Help is the help text for the metric family.
+	Help string
+
+	// Unit is the unit for the metric family.
+	Unit string
+}
+
+// marshal appends mm added at the given timestamp to dst and returns the result.
+//
+// The marshaled mm starts with the key returned from marshalKey followed by the inverted timestamp,
+// so the most recently added entry goes first among entries with the same key in the index.
+func (mm *MetricMetadata) marshal(dst []byte, timestamp uint64) []byte {
+	dst = mm.marshalKey(dst)
+	dst = encoding.MarshalUint64(dst, math.MaxUint64-timestamp)
+	dst = marshalTagValue(dst, []byte(mm.Help))
+	return dst
+}
+
+// marshalKey appends the key for mm to dst and returns the result.
+//
+// Only the most recently added entry is kept for every key.
+func (mm *MetricMetadata) marshalKey(dst []byte) []byte {
+	dst = marshalTagValue(dst, []byte(mm.MetricFamilyName))
+	dst = marshalTagValue(dst, []byte(mm.Type))
+	dst = marshalTagValue(dst, []byte(mm.Unit))
+	return dst
+}
+
+// unmarshal unmarshals mm from src and returns the timestamp when mm was added.
+func (mm *MetricMetadata) unmarshal(src []byte) (uint64, error) {
+	var buf []byte
+	var err error
+	fields := []*string{&mm.MetricFamilyName, &mm.Type, &mm.Unit}
+	for _, f := range fields {
+		src, buf, err = unmarshalTagValue(buf[:0], src)
+		if err != nil {
+			return 0, fmt.Errorf("cannot unmarshal metric metadata: %w", err)
+		}
+		*f = string(buf)
+	}
+	if len(src) < 8 {
+		return 0, fmt.Errorf("cannot unmarshal metric metadata timestamp from %d bytes; need at least 8 bytes", len(src))
+	}
+	timestamp := math.MaxUint64 - encoding.UnmarshalUint64(src)
+	src, buf, err = unmarshalTagValue(buf[:0], src[8:])
+	if err != nil {
+		return 0, fmt.Errorf("cannot unmarshal metric metadata help: %w", err)
+	}
+	mm.Help = string(buf)
+	if len(src) > 0 {
+		return 0, fmt.Errorf("unexpected non-empty tail left after unmarshaling metric metadata; len(tail)=%d", len(src))
+	}
+	return timestamp, nil
+}
+
+// getMetricMetadataKey returns the key for the marshaled metadata item.
+//
+// The whole item is returned if it cannot be parsed.
+func getMetricMetadataKey(item []byte) []byte {
+	tail := item
+	var err error
+	for i := 0; i < 3; i++ {
+		tail, _, err = unmarshalTagValue(nil, tail)
+		if err != nil {
+			return item
+		}
+	}
+	return item[:len(item)-len(tail)]
+}
+
+// metricMetadataIndex is a persistent index for metric metadata keyed by metric family name.
+//
+// Only the most recently added entry is kept per (metric family name, type, unit), so a metric family
+// may have multiple metadata entries only if it is exposed with distinct type or unit by distinct targets.
+// Older entries are dropped during background merges and are skipped during searches.
+type metricMetadataIndex struct {
+	// entriesAdded is the number of metadata entries added to the index.
+	entriesAdded uint64
+
+	tb *mergeset.Table
+
+	// seen maps keys for recently added entries to their help. It is used for avoiding repeated writes
+	// of the same metadata, which is usually sent on every scrape.
+	seenLock sync.Mutex
+	seen     map[string]string
+}
+
+// maxMetricMetadataSeenItems is the maximum number of items to keep in metricMetadataIndex.seen.
+const maxMetricMetadataSeenItems = 100000
+
+func openMetricMetadataIndex(path string) (*metricMetadataIndex, error) {
+	tb, err := mergeset.OpenTable(path, nil, dedupMetricMetadataItems, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open metric metadata index at %q: %w", path, err)
+	}
+	return &metricMetadataIndex{
+		tb:   tb,
+		seen: make(map[string]string),
+	}, nil
+}
+
+// MustClose closes mi.
+func (mi *metricMetadataIndex) MustClose() {
+	mi.tb.MustClose()
+	mi.tb = nil
+}
+
+// dedupMetricMetadataItems leaves only the most recently added item per metadata key.
+//
+// Older items appear after changing the metadata or after adding the same metadata before and after restart.
+//
+// The last item is always kept, since mergeset requires it to be unchanged. It is skipped during searches if it is outdated.
+func dedupMetricMetadataItems(data []byte, items []mergeset.Item) ([]byte, []mergeset.Item) {
+	if len(items) < 3 {
+		return data, items
+	}
+	lastItem := items[len(items)-1]
+	dstItems := items[:1]
+	prevKey := getMetricMetadataKey(items[0].Bytes(data))
+	for _, it := range items[1 : len(items)-1] {
+		key := getMetricMetadataKey(it.Bytes(data))
+		if string(key) == string(prevKey) {
+			// Items with the same key are sorted from the newest to the oldest.
+			continue
+		}
+		dstItems = append(dstItems, it)
+		prevKey = key
+	}
+	dstItems = append(dstItems, lastItem)
+	return data, dstItems
+}
+
+func (mi *metricMetadataIndex) add(mms []MetricMetadata) error {
+	var items [][]byte
+	// Use nanosecond timestamps, so the last entry wins among entries with the same key in mms.
+	timestamp := uint64(time.Now().UnixNano())
+	mi.seenLock.Lock()
+	for i := range mms {
+		mm := &mms[i]
+		if len(mm.MetricFamilyName) == 0 {
+			continue
+		}
+		key := mm.marshalKey(nil)
+		if help, ok := mi.seen[string(key)]; ok && help == mm.Help {
+			continue
+		}
+		if len(mi.seen) >= maxMetricMetadataSeenItems {
+			mi.seen = make(map[string]string)
+		}
+		mi.seen[string(key)] = mm.Help
+		items = append(items, mm.marshal(nil, timestamp+uint64(i)))
+	}
+	mi.seenLock.Unlock()
+	if len(items) == 0 {
+		return nil
+	}
+	if err := mi.tb.AddItems(items); err != nil {
+		return fmt.Errorf("cannot add %d metric metadata entries: %w", len(items), err)
+	}
+	atomic.AddUint64(&mi.entriesAdded, uint64(len(items)))
+	return nil
+}
+
+// search returns metadata entries for the given metric.
+//
+// Metadata for all the metrics is returned if metric is empty.
+// Up to limit metric families are returned if limit > 0.
+// The returned entries are sorted by metric family name.
+func (mi *metricMetadataIndex) search(metric string, limit int, deadline uint64) ([]MetricMetadata, error) {
+	var prefix []byte
+	if len(metric) > 0 {
+		prefix = marshalTagValue(nil, []byte(metric))
+	}
+	var ts mergeset.TableSearch
+	ts.Init(mi.tb)
+	defer ts.MustClose()
+
+	var mms []MetricMetadata
+	var prevKey []byte
+	metrics := 0
+	loops := 0
+	ts.Seek(prefix)
+	for ts.NextItem() {
+		if loops&paceLimiterSlowIterationsMask == 0 {
+			if err := checkSearchDeadlineAndPace(deadline, nil); err != nil {
+				return nil, err
+			}
+		}
+		loops++
+		item := ts.Item
+		if !bytes.HasPrefix(item, prefix) {
+			break
+		}
+		key := getMetricMetadataKey(item)
+		if string(key) == string(prevKey) {
+			// Skip outdated item, which hasn't been merged yet. The most recent item goes first.
+			continue
+		}
+		prevKey = append(prevKey[:0], key...)
+		var mm MetricMetadata
+		if _, err := mm.unmarshal(item); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal metric metadata item %q: %w", item, err)
+		}
+		if len(mms) == 0 || mms[len(mms)-1].MetricFamilyName != mm.MetricFamilyName {
+			if limit > 0 && metrics >= limit {
+				break
+			}
+			metrics++
+		}
+		mms = append(mms, mm)
+	}
+	if err := ts.Error(); err != nil {
+		return nil, fmt.Errorf("error when searching for metric metadata: %w", err)
+	}
+	return mms, nil
+}
+
+// AddMetricMetadata adds mms to the storage.
+func (s *Storage) AddMetricMetadata(mms []MetricMetadata) error {
+	if s.isReadOnlyReplica {
+		return ErrReadOnlyReplica
+	}
+	return s.metricMetadata.add(mms)
+}
+
+// SearchMetricMetadata returns metadata for the given metric sorted by metric family name.
+//
+// Metadata for all the metrics is returned if metric is empty.
+// Up to limit metric families are returned if limit > 0.
+func (s *Storage) SearchMetricMetadata(metric string, limit int, deadline uint64) ([]MetricMetadata, error) {
+	return s.metricMetadata.search(metric, limit, deadline)
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+)
+
+func TestMetricMetadataMarshalUnmarshal(t *testing.T) {
+	f := func(mm *MetricMetadata) {
+		t.Helper()
+		const timestamp = 1234567890
+		data := mm.marshal(nil, timestamp)
+		var mm2 MetricMetadata
+		ts, err := mm2.unmarshal(data)
+		if err != nil {
+			t.Fatalf("cannot unmarshal metric metadata: %s", err)
+		}
+		if ts != timestamp {
+			t.Fatalf("unexpected timestamp after unmarshaling; got %d; want %d", ts, timestamp)
+		}
+		if !reflect.DeepEqual(mm, &mm2) {
+			t.Fatalf("unexpected metric metadata after unmarshaling;\ngot\n%+v\nwant\n%+v", &mm2, mm)
+		}
+		if key := getMetricMetadataKey(data); string(key) != string(mm.marshalKey(nil)) {
+			t.Fatalf("unexpected key for the marshaled metric metadata; got %q; want %q", key, mm.marshalKey(nil))
+		}
+		if _, err := mm2.unmarshal(data[:len(data)-1]); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling truncated data")
+		}
+	}
+	f(&MetricMetadata{})
+	f(&MetricMetadata{
+		MetricFamilyName: "http_requests_total",
+		Type:             "counter",
+		Help:             "The total number of requests\x00with\x01special\x02chars",
+		Unit:             "requests",
+	})
+}
+
+func TestDedupMetricMetadataItems(t *testing.T) {
+	mms := []MetricMetadata{
+		{
+			MetricFamilyName: "foo",
+			Type:             "counter",
+			Help:             "old help",
+		},
+		{
+			MetricFamilyName: "foo",
+			Type:             "counter",
+			Help:             "new help",
+		},
+		{
+			MetricFamilyName: "foo",
+			Type:             "gauge",
+			Help:             "old help",
+		},
+		{
+			MetricFamilyName: "foo",
+			Type:             "gauge",
+			Help:             "new help",
+		},
+		{
+			MetricFamilyName: "foo",
+			Type:             "summary",
+		},
+	}
+	var itemsStr []string
+	for i := range mms {
+		itemsStr = append(itemsStr, string(mms[i].marshal(nil, uint64(i))))
+	}
+	sort.Strings(itemsStr)
+	var data []byte
+	var items []mergeset.Item
+	for _, s := range itemsStr {
+		items = append(items, mergeset.Item{
+			Start: uint32(len(data)),
+			End:   uint32(len(data) + len(s)),
+		})
+		data = append(data, s...)
+	}
+	data, items = dedupMetricMetadataItems(data, items)
+	var mmsResult []MetricMetadata
+	for _, it := range items {
+		var mm MetricMetadata
+		if _, err := mm.unmarshal(it.Bytes(data)); err != nil {
+			t.Fatalf("cannot unmarshal metric metadata: %s", err)
+		}
+		mmsResult = append(mmsResult, mm)
+	}
+	// The last item must be always kept.
+	mmsExpected := []MetricMetadata{mms[1], mms[3], mms[4]}
+	if !reflect.DeepEqual(mmsResult, mmsExpected) {
+		t.Fatalf("unexpected metric metadata after dedup;\ngot\n%+v\nwant\n%+v", mmsResult, mmsExpected)
+	}
+}
+
+func TestStorageAddSearchMetricMetadata(t *testing.T) {
+	path := "TestStorageAddSearchMetricMetadata"
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	mms := []MetricMetadata{
+		{
+			MetricFamilyName: "foo_bar",
+			Type:             "gauge",
+		},
+		{
+			MetricFamilyName: "foo",
+			Type:             "counter",
+			Help:             "foo help",
+		},
+		{
+			MetricFamilyName: "foo",
+			Type:             "counter",
+			Help:             "another foo help",
+		},
+		{
+			// Metadata without metric name must be ignored
+			Type: "counter",
+		},
+	}
+	if err := s.AddMetricMetadata(mms); err != nil {
+		t.Fatalf("cannot add metric metadata: %s", err)
+	}
+	// Duplicate entries must be ignored.
+	if err := s.AddMetricMetadata(mms[:1]); err != nil {
+		t.Fatalf("cannot add metric metadata: %s", err)
+	}
+	s.metricMetadata.tb.DebugFlush()
+
+	f := func(metric string, limit int, mmsExpected []MetricMetadata) {
+		t.Helper()
+		mms, err := s.SearchMetricMetadata(metric, limit, noDeadline)
+		if err != nil {
+			t.Fatalf("cannot search metric metadata: %s", err)
+		}
+		if !reflect.DeepEqual(mms, mmsExpected) {
+			t.Fatalf("unexpected metric metadata for metric=%q, limit=%d;\ngot\n%+v\nwant\n%+v", metric, limit, mms, mmsExpected)
+		}
+	}
+	// Only the most recently added entry is returned for the same metric family, type and unit.
+	fooMMs := []MetricMetadata{mms[2]}
+	f("", 0, append(fooMMs, mms[0]))
+	f("", 1, fooMMs)
+	f("foo", 0, fooMMs)
+	f("foo_bar", 10, mms[:1])
+	f("fo", 0, nil)
+	f("missing", 0, nil)
+
+	// The changed help replaces the previous entry, while distinct unit results in a separate entry.
+	fooMMsNew := []MetricMetadata{
+		{
+			MetricFamilyName: "foo",
+			Type:             "counter",
+			Help:             "updated foo help",
+		},
+		{
+			MetricFamilyName: "foo",
+			Type:             "counter",
+			Help:             "foo help",
+			Unit:             "seconds",
+		},
+	}
+	if err := s.AddMetricMetadata(fooMMsNew); err != nil {
+		t.Fatalf("cannot add metric metadata: %s", err)
+	}
+	s.metricMetadata.tb.DebugFlush()
+	f("foo", 0, fooMMsNew)
+
+	// The search must respect the deadline.
+	if _, err := s.SearchMetricMetadata("", 0, 0); !errors.Is(err, ErrDeadlineExceeded) {
+		t.Fatalf("unexpected error for the exceeded deadline; got %v; want %v", err, ErrDeadlineExceeded)
+	}
+
+	// Verify that the metadata is persisted and isn't duplicated after re-opening the storage.
+	s.MustClose()
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage: %s", err)
+	}
+	defer s.MustClose()
+	if err := s.AddMetricMetadata(mms); err != nil {
+		t.Fatalf("cannot add metric metadata: %s", err)
+	}
+	s.metricMetadata.tb.DebugFlush()
+	// The re-added entries replace the previously added entries with the same metric family, type and unit.
+	f("", 0, append([]MetricMetadata{mms[2], fooMMsNew[1]}, mms[0]))
+	if n := s.metricMetadata.entriesAdded; n != 3 {
+		t.Fatalf("unexpected number of added entries; got %d; want 3", n)
+	}
+}
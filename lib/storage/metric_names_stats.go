@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var trackMetricNamesStats bool
+
+// SetTrackMetricNamesStats enables tracking query stats per metric name.
+//
+// This function must be called before OpenStorage.
+func SetTrackMetricNamesStats(enabled bool) {
+	trackMetricNamesStats = enabled
+}
+
+// MetricNameStats contains query stats for a single metric name.
+type MetricNameStats struct {
+	Name string
+
+	// LastQueryTimestamp is unix timestamp in seconds for the last query, which selected series with the given metric name.
+	//
+	// It is set to zero if the metric name wasn't queried yet.
+	LastQueryTimestamp uint64
+
+	// QueriesCount is the number of queries, which selected series with the given metric name.
+	QueriesCount uint64
+}
+
+// metricNamesStats tracks query stats per metric name.
+type metricNamesStats struct {
+	mu sync.Mutex
+
+	// startTimestamp is unix timestamp in seconds when the tracking has been started.
+	startTimestamp uint64
+
+	m map[string]*MetricNameStats
+}
+
+func newMetricNamesStats() *metricNamesStats {
+	return &metricNamesStats{
+		startTimestamp: fasttime.UnixTimestamp(),
+		m:              make(map[string]*MetricNameStats),
+	}
+}
+
+// registerIngested registers the ingested metricGroup, so it is returned with zero query stats until it is queried.
+func (mns *metricNamesStats) registerIngested(metricGroup []byte) {
+	mns.mu.Lock()
+	if mns.m[string(metricGroup)] == nil {
+		name := string(metricGroup)
+		mns.m[name] = &MetricNameStats{
+			Name: name,
+		}
+	}
+	mns.mu.Unlock()
+}
+
+// register registers a query at the given timestamp, which selected series with the given metric names.
+func (mns *metricNamesStats) register(metricGroups map[string]struct{}, timestamp uint64) {
+	mns.mu.Lock()
+	for name := range metricGroups {
+		e := mns.m[name]
+		if e == nil {
+			e = &MetricNameStats{
+				Name: name,
+			}
+			mns.m[name] = e
+		}
+		if timestamp > e.LastQueryTimestamp {
+			e.LastQueryTimestamp = timestamp
+		}
+		e.QueriesCount++
+	}
+	mns.mu.Unlock()
+}
+
+func (mns *metricNamesStats) get(dst []MetricNameStats) []MetricNameStats {
+	mns.mu.Lock()
+	for _, e := range mns.m {
+		dst = append(dst, *e)
+	}
+	mns.mu.Unlock()
+	return dst
+}
+
+func (mns *metricNamesStats) len() int {
+	mns.mu.Lock()
+	n := len(mns.m)
+	mns.mu.Unlock()
+	return n
+}
+
+const metricNamesStatsFileVersion = 1
+
+// marshal appends marshaled mns to dst and returns the result.
+func (mns *metricNamesStats) marshal(dst []byte) []byte {
+	mns.mu.Lock()
+	defer mns.mu.Unlock()
+	dst = encoding.MarshalUint64(dst, metricNamesStatsFileVersion)
+	dst = encoding.MarshalUint64(dst, mns.startTimestamp)
+	dst = encoding.MarshalVarUint64(dst, uint64(len(mns.m)))
+	for name, e := range mns.m {
+		dst = encoding.MarshalBytes(dst, []byte(name))
+		dst = encoding.MarshalVarUint64(dst, e.LastQueryTimestamp)
+		dst = encoding.MarshalVarUint64(dst, e.QueriesCount)
+	}
+	return dst
+}
+
+// unmarshal unmarshals mns from src.
+func (mns *metricNamesStats) unmarshal(src []byte) error {
+	if len(src) < 16 {
+		return fmt.Errorf("too short data; got %d bytes; want at least 16 bytes", len(src))
+	}
+	version := encoding.UnmarshalUint64(src)
+	if version != metricNamesStatsFileVersion {
+		return fmt.Errorf("unsupported version; got %d; want %d", version, metricNamesStatsFileVersion)
+	}
+	startTimestamp := encoding.UnmarshalUint64(src[8:])
+	tail, n, err := encoding.UnmarshalVarUint64(src[16:])
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal metric names count: %w", err)
+	}
+	src = tail
+	m := make(map[string]*MetricNameStats, n)
+	for i := uint64(0); i < n; i++ {
+		tail, name, err := encoding.UnmarshalBytes(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal metric name: %w", err)
+		}
+		e := &MetricNameStats{
+			Name: string(name),
+		}
+		tail, e.LastQueryTimestamp, err = encoding.UnmarshalVarUint64(tail)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal last query timestamp for metric name %q: %w", name, err)
+		}
+		tail, e.QueriesCount, err = encoding.UnmarshalVarUint64(tail)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal queries count for metric name %q: %w", name, err)
+		}
+		src = tail
+		m[e.Name] = e
+	}
+	if len(src) > 0 {
+		return fmt.Errorf("unexpected non-empty tail left after unmarshaling metric names stats; len(tail)=%d", len(src))
+	}
+	mns.mu.Lock()
+	mns.startTimestamp = startTimestamp
+	mns.m = m
+	mns.mu.Unlock()
+	return nil
+}
+
+// UpdateMetricNamesStats registers a query, which selected series with the given metricNames.
+//
+// metricNames must contain marshaled MetricName values.
+// The stats is updated only if tracking is enabled via SetTrackMetricNamesStats.
+func (s *Storage) UpdateMetricNamesStats(metricNames []string) {
+	if !trackMetricNamesStats || len(metricNames) == 0 {
+		return
+	}
+	metricGroups := make(map[string]struct{})
+	var metricGroup []byte
+	for _, metricName := range metricNames {
+		var err error
+		_, metricGroup, err = unmarshalTagValue(metricGroup[:0], []byte(metricName))
+		if err != nil {
+			logger.Panicf("BUG: cannot unmarshal metric group from metricName %q: %s", metricName, err)
+		}
+		metricGroups[string(metricGroup)] = struct{}{}
+	}
+	s.metricNamesStats.register(metricGroups, fasttime.UnixTimestamp())
+}
+
+// registerIngestedMetricName registers the metric group from the given marshaled MetricName in metric names stats.
+//
+// It must be called when a new series is registered in the storage, so ingested metric names, which are never queried,
+// are returned by GetMetricNamesStats.
+func (s *Storage) registerIngestedMetricName(metricName []byte) {
+	if !trackMetricNamesStats {
+		return
+	}
+	_, metricGroup, err := unmarshalTagValue(nil, metricName)
+	if err != nil {
+		logger.Panicf("BUG: cannot unmarshal metric group from metricName %q: %s", metricName, err)
+	}
+	s.metricNamesStats.registerIngested(metricGroup)
+}
+
+// maxSeededMetricNames is the maximum number of metric names, which are loaded from indexdb into metric names stats on startup.
+const maxSeededMetricNames = 1e6
+
+// seedMetricNamesStats registers metric names from indexdb in metric names stats.
+//
+// This allows returning metric names, which have been ingested before the stats tracking has been enabled
+// and which are never queried.
+func (s *Storage) seedMetricNamesStats() {
+	if !trackMetricNamesStats {
+		return
+	}
+	startTime := time.Now()
+	metricGroups, err := s.idb().SearchTagValues(nil, maxSeededMetricNames, noDeadline)
+	if err != nil {
+		logger.Errorf("cannot load metric names from indexdb for metric names stats: %s", err)
+		return
+	}
+	for _, metricGroup := range metricGroups {
+		s.metricNamesStats.registerIngested([]byte(metricGroup))
+	}
+	logger.Infof("loaded %d metric names from indexdb for metric names stats in %.3f seconds", len(metricGroups), time.Since(startTime).Seconds())
+}
+
+// GetMetricNamesStats returns query stats for the tracked metric names containing matchPattern substring.
+//
+// Only metric names queried no more than le times are returned if le >= 0.
+// Up to limit least recently queried metric names are returned.
+// It also returns unix timestamp in seconds when the stats tracking has been started.
+func (s *Storage) GetMetricNamesStats(limit, le int, matchPattern string) ([]MetricNameStats, uint64) {
+	mnss := s.metricNamesStats.get(nil)
+	dst := mnss[:0]
+	for _, e := range mnss {
+		if le >= 0 && e.QueriesCount > uint64(le) {
+			continue
+		}
+		if matchPattern != "" && !strings.Contains(e.Name, matchPattern) {
+			continue
+		}
+		dst = append(dst, e)
+	}
+	mnss = dst
+	sort.Slice(mnss, func(i, j int) bool {
+		a, b := &mnss[i], &mnss[j]
+		if a.LastQueryTimestamp != b.LastQueryTimestamp {
+			return a.LastQueryTimestamp < b.LastQueryTimestamp
+		}
+		return a.Name < b.Name
+	})
+	if len(mnss) > limit {
+		mnss = mnss[:limit]
+	}
+	s.metricNamesStats.mu.Lock()
+	startTimestamp := s.metricNamesStats.startTimestamp
+	s.metricNamesStats.mu.Unlock()
+	return mnss, startTimestamp
+}
+
+// ResetMetricNamesStats resets query stats for metric names.
+//
+// The tracked metric names are kept with zero query stats, since they are still ingested.
+func (s *Storage) ResetMetricNamesStats() {
+	mns := s.metricNamesStats
+	mns.mu.Lock()
+	mns.startTimestamp = fasttime.UnixTimestamp()
+	for _, e := range mns.m {
+		e.LastQueryTimestamp = 0
+		e.QueriesCount = 0
+	}
+	mns.mu.Unlock()
+}
+
+func (s *Storage) startMetricNamesStatsSaver() {
+	if !trackMetricNamesStats {
+		return
+	}
+	s.metricNamesStatsSaverWG.Add(1)
+	go func() {
+		s.metricNamesStatsSaver()
+		s.metricNamesStatsSaverWG.Done()
+	}()
+}
+
+// metricNamesStatsSaveInterval is the interval for persisting metric names stats,
+// so the stats isn't lost on unclean shutdown.
+var metricNamesStatsSaveInterval = 10 * time.Minute
+
+func (s *Storage) metricNamesStatsSaver() {
+	ticker := time.NewTicker(metricNamesStatsSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			// The stats is saved in MustClose.
+			return
+		case <-ticker.C:
+			s.mustSaveMetricNamesStats()
+		}
+	}
+}
+
+func (s *Storage) mustLoadMetricNamesStats() *metricNamesStats {
+	mns := newMetricNamesStats()
+	if !trackMetricNamesStats {
+		return mns
+	}
+	path := s.cachePath + "/metric_names_stats"
+	if !fs.IsPathExist(path) {
+		return mns
+	}
+	logger.Infof("loading metric names stats from %q...", path)
+	startTime := time.Now()
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read %s: %s", path, err)
+	}
+	if err := mns.unmarshal(src); err != nil {
+		logger.Errorf("discarding metric names stats from %s: %s", path, err)
+		return newMetricNamesStats()
+	}
+	logger.Infof("loaded metric names stats from %q in %.3f seconds; metricNames: %d; sizeBytes: %d", path, time.Since(startTime).Seconds(), mns.len(), len(src))
+	return mns
+}
+
+func (s *Storage) mustSaveMetricNamesStats() {
+	path := s.cachePath + "/metric_names_stats"
+	if !trackMetricNamesStats {
+		return
+	}
+	logger.Infof("saving metric names stats to %q...", path)
+	startTime := time.Now()
+	dst := s.metricNamesStats.marshal(nil)
+	// The cache directory may be missing if the stats is saved periodically before any cache is saved there.
+	if err := fs.MkdirAllIfNotExist(s.cachePath); err != nil {
+		logger.Panicf("FATAL: cannot create directory %q: %s", s.cachePath, err)
+	}
+	// The file from the previous run must be atomically replaced, so the stats isn't lost on unclean shutdown.
+	if err := fs.ReplaceFileAtomically(path, dst); err != nil {
+		logger.Panicf("FATAL: cannot write %d bytes to %q: %s", len(dst), path, err)
+	}
+	logger.Infof("saved metric names stats to %q in %.3f seconds; metricNames: %d; sizeBytes: %d", path, time.Since(startTime).Seconds(), s.metricNamesStats.len(), len(dst))
+}
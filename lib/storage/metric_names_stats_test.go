@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestMetricNamesStatsMarshalUnmarshal(t *testing.T) {
+	mns := newMetricNamesStats()
+	mns.startTimestamp = 12345
+	mns.register(map[string]struct{}{
+		"foo": {},
+		"bar": {},
+	}, 100)
+	mns.register(map[string]struct{}{
+		"foo": {},
+	}, 200)
+
+	data := mns.marshal(nil)
+	mns2 := newMetricNamesStats()
+	if err := mns2.unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal metric names stats: %s", err)
+	}
+	if mns2.startTimestamp != mns.startTimestamp {
+		t.Fatalf("unexpected startTimestamp; got %d; want %d", mns2.startTimestamp, mns.startTimestamp)
+	}
+	if !reflect.DeepEqual(mns2.m, mns.m) {
+		t.Fatalf("unexpected unmarshaled stats;\ngot\n%+v\nwant\n%+v", mns2.m, mns.m)
+	}
+
+	// Corrupted data must result in error.
+	f := func(data []byte) {
+		t.Helper()
+		mns := newMetricNamesStats()
+		if err := mns.unmarshal(data); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling %q", data)
+		}
+	}
+	f(nil)
+	f(data[:10])
+	f(data[:len(data)-1])
+	f(append(data, 1))
+}
+
+func TestStorageUpdateMetricNamesStats(t *testing.T) {
+	trackMetricNamesStatsOrig := trackMetricNamesStats
+	SetTrackMetricNamesStats(true)
+	defer SetTrackMetricNamesStats(trackMetricNamesStatsOrig)
+
+	s := &Storage{
+		metricNamesStats: newMetricNamesStats(),
+	}
+	newMetricNames := func(names ...string) []string {
+		var a []string
+		for i, name := range names {
+			var mn MetricName
+			mn.MetricGroup = []byte(name)
+			mn.AddTag("instance", string(rune('a'+i)))
+			a = append(a, string(mn.Marshal(nil)))
+		}
+		return a
+	}
+	// Every query must be counted only once per metric name.
+	s.UpdateMetricNamesStats(newMetricNames("foo", "foo", "bar"))
+	s.UpdateMetricNamesStats(newMetricNames("foo"))
+	s.UpdateMetricNamesStats(newMetricNames("foo_total"))
+	s.UpdateMetricNamesStats(nil)
+
+	f := func(limit, le int, matchPattern string, namesExpected []string, countsExpected []uint64) {
+		t.Helper()
+		mnss, _ := s.GetMetricNamesStats(limit, le, matchPattern)
+		var names []string
+		var counts []uint64
+		for _, e := range mnss {
+			if e.LastQueryTimestamp == 0 {
+				t.Fatalf("missing last query timestamp for %q", e.Name)
+			}
+			names = append(names, e.Name)
+			counts = append(counts, e.QueriesCount)
+		}
+		if !reflect.DeepEqual(names, namesExpected) {
+			t.Fatalf("unexpected metric names; got %q; want %q", names, namesExpected)
+		}
+		if !reflect.DeepEqual(counts, countsExpected) {
+			t.Fatalf("unexpected queries counts; got %d; want %d", counts, countsExpected)
+		}
+	}
+	f(10, -1, "", []string{"bar", "foo", "foo_total"}, []uint64{1, 2, 1})
+	f(2, -1, "", []string{"bar", "foo"}, []uint64{1, 2})
+	f(10, 1, "", []string{"bar", "foo_total"}, []uint64{1, 1})
+	f(10, -1, "foo", []string{"foo", "foo_total"}, []uint64{2, 1})
+	f(10, 0, "", nil, nil)
+
+	// Metric names must be kept with zero stats after the reset.
+	s.ResetMetricNamesStats()
+	mnss, _ := s.GetMetricNamesStats(10, 0, "")
+	var names []string
+	for _, e := range mnss {
+		if e.LastQueryTimestamp != 0 || e.QueriesCount != 0 {
+			t.Fatalf("unexpected non-zero stats after the reset: %+v", e)
+		}
+		names = append(names, e.Name)
+	}
+	namesExpected := []string{"bar", "foo", "foo_total"}
+	if !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected metric names after the reset; got %q; want %q", names, namesExpected)
+	}
+}
+
+func TestStorageMetricNamesStatsIngested(t *testing.T) {
+	trackMetricNamesStatsOrig := trackMetricNamesStats
+	SetTrackMetricNamesStats(true)
+	defer SetTrackMetricNamesStats(trackMetricNamesStatsOrig)
+
+	path := "TestStorageMetricNamesStatsIngested"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+
+	addRows := func(names ...string) {
+		t.Helper()
+		var mrs []MetricRow
+		for _, name := range names {
+			var mn MetricName
+			mn.MetricGroup = []byte(name)
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: mn.marshalRaw(nil),
+				Timestamp:     time.Now().UnixNano() / 1e6,
+				Value:         1,
+			})
+		}
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+	}
+	f := func(le int, namesExpected []string) {
+		t.Helper()
+		mnss, _ := s.GetMetricNamesStats(10, le, "")
+		var names []string
+		for _, e := range mnss {
+			names = append(names, e.Name)
+		}
+		if !reflect.DeepEqual(names, namesExpected) {
+			t.Fatalf("unexpected metric names for le=%d; got %q; want %q", le, names, namesExpected)
+		}
+	}
+
+	// Ingested metric names must be returned with zero stats until they are queried.
+	addRows("foo", "bar")
+	f(0, []string{"bar", "foo"})
+	var mn MetricName
+	mn.MetricGroup = []byte("foo")
+	s.UpdateMetricNamesStats([]string{string(mn.Marshal(nil))})
+	f(0, []string{"bar"})
+	f(-1, []string{"bar", "foo"})
+
+	// Metric names ingested before the stats tracking has been enabled must be loaded from indexdb on startup.
+	s.MustClose()
+	fs.MustRemoveAll(path + "/cache/metric_names_stats")
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage: %s", err)
+	}
+	defer s.MustClose()
+	f(0, []string{"bar", "foo"})
+}
+
+func TestStorageMetricNamesStatsSaver(t *testing.T) {
+	trackMetricNamesStatsOrig := trackMetricNamesStats
+	SetTrackMetricNamesStats(true)
+	defer SetTrackMetricNamesStats(trackMetricNamesStatsOrig)
+	metricNamesStatsSaveIntervalOrig := metricNamesStatsSaveInterval
+	metricNamesStatsSaveInterval = 10 * time.Millisecond
+	defer func() {
+		metricNamesStatsSaveInterval = metricNamesStatsSaveIntervalOrig
+	}()
+
+	path := "TestStorageMetricNamesStatsSaver"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer s.MustClose()
+
+	// The stats must be saved periodically, so it isn't lost on unclean shutdown.
+	var mn MetricName
+	mn.MetricGroup = []byte("foo")
+	s.UpdateMetricNamesStats([]string{string(mn.Marshal(nil))})
+	statsPath := path + "/cache/metric_names_stats"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if fs.IsPathExist(statsPath) {
+			mns := s.mustLoadMetricNamesStats()
+			if mns.len() == 1 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metric names stats hasn't been saved to %q", statsPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStorageSaveLoadMetricNamesStats(t *testing.T) {
+	trackMetricNamesStatsOrig := trackMetricNamesStats
+	SetTrackMetricNamesStats(true)
+	defer SetTrackMetricNamesStats(trackMetricNamesStatsOrig)
+
+	path := "TestStorageSaveLoadMetricNamesStats"
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatalf("cannot create %q: %s", path, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	s := &Storage{
+		cachePath:        path,
+		metricNamesStats: newMetricNamesStats(),
+	}
+	s.metricNamesStats.register(map[string]struct{}{
+		"foo": {},
+	}, 100)
+
+	// The stats must be saved multiple times, since it is saved on every shutdown.
+	for i := 0; i < 3; i++ {
+		s.mustSaveMetricNamesStats()
+		mns := s.mustLoadMetricNamesStats()
+		if !reflect.DeepEqual(mns.m, s.metricNamesStats.m) {
+			t.Fatalf("unexpected stats loaded on iteration #%d;\ngot\n%+v\nwant\n%+v", i, mns.m, s.metricNamesStats.m)
+		}
+		s.metricNamesStats = mns
+	}
+}
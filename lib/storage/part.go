@@ -3,6 +3,8 @@ package storage
 import (
 	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"unsafe"
 
@@ -43,6 +45,12 @@ type part struct {
 	indexFile      fs.MustReadAtCloser
 
 	metaindex []metaindexRow
+
+	// mergeIdx is the index of the merge, which created the part.
+	//
+	// Indexes increase over time, so they are used for determining whether the part
+	// has been created before the given tombstone. See tombstone.mergeIdx.
+	mergeIdx uint64
 }
 
 // openFilePart opens file-based part from the given path.
@@ -77,7 +85,27 @@ func openFilePart(path string) (*part, error) {
 	metaindexSize := fs.MustFileSize(metaindexPath)
 
 	size := timestampsSize + valuesSize + indexSize + metaindexSize
-	return newPart(&ph, path, size, metaindexFile, timestampsFile, valuesFile, indexFile)
+	p, err := newPart(&ph, path, size, metaindexFile, timestampsFile, valuesFile, indexFile)
+	if err != nil {
+		return nil, err
+	}
+	p.mergeIdx = getMergeIdxFromPath(path)
+	return p, nil
+}
+
+// getMergeIdxFromPath returns the merge index from the part path created via partHeader.Path.
+//
+// Zero is returned if the path doesn't contain the merge index.
+func getMergeIdxFromPath(path string) uint64 {
+	n := strings.LastIndexByte(path, '_')
+	if n < 0 {
+		return 0
+	}
+	mergeIdx, err := strconv.ParseUint(path[n+1:], 16, 64)
+	if err != nil {
+		return 0
+	}
+	return mergeIdx
 }
 
 // newPart returns new part initialized with the given arguments.
@@ -37,20 +37,38 @@ func (ph *partHeader) String() string {
 	return fmt.Sprintf("%d_%d_%s_%s", ph.RowsCount, ph.BlocksCount, toUserReadableTimestamp(ph.MinTimestamp), toUserReadableTimestamp(ph.MaxTimestamp))
 }
 
+// toUserReadableTimestamp returns user-readable representation of the given timestamp in the storage precision.
+//
+// Sub-second digits are formatted according to the storage precision, so the timestamp can be restored without precision loss.
 func toUserReadableTimestamp(timestamp int64) string {
-	t := timestampToTime(timestamp)
-	return t.Format(userReadableTimeFormat)
+	if globalTimestampsPerMsec == 1 {
+		return timestampToTime(timestamp).Format(userReadableTimeFormat)
+	}
+	t := time.Unix(0, ConvertTimestamp(timestamp, globalTimestampsPerMsec, 1e6)).UTC()
+	switch globalTimestampsPerMsec {
+	case 1e3:
+		return t.Format(userReadableTimeFormat + "000")
+	default:
+		return t.Format(userReadableTimeFormat + "000000")
+	}
 }
 
 func fromUserReadableTimestamp(s string) (int64, error) {
-	t, err := time.Parse(userReadableTimeFormat, s)
+	// Fractional seconds are parsed with arbitrary number of digits, even if they are missing in the layout.
+	t, err := time.Parse(userReadableTimeFormatNoFrac, s)
 	if err != nil {
 		return 0, err
 	}
-	return timestampFromTime(t), nil
+	if globalTimestampsPerMsec == 1 {
+		return timestampFromTime(t), nil
+	}
+	return ConvertTimestamp(t.UnixNano(), 1e6, globalTimestampsPerMsec), nil
 }
 
-const userReadableTimeFormat = "20060102150405.000"
+const (
+	userReadableTimeFormat       = "20060102150405.000"
+	userReadableTimeFormatNoFrac = "20060102150405"
+)
 
 // Path returns a path to part header with the given prefix and suffix.
 //
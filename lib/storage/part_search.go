@@ -28,7 +28,7 @@ type partSearch struct {
 	// tsidIdx points to the currently searched tsid in tsids.
 	tsidIdx int
 
-	// tr is a time range to search.
+	// tr is a time range to search. It is in the storage precision. See TimestampsPerMsec.
 	tr TimeRange
 
 	metaindex []metaindexRow
@@ -65,6 +65,8 @@ func (ps *partSearch) Init(p *part, tsids []TSID, tr TimeRange) {
 	ps.reset()
 	ps.p = p
 
+	// Blocks contain timestamps in the storage precision, while tr is in milliseconds.
+	tr = tr.toTimestamps(globalTimestampsPerMsec)
 	if p.ph.MinTimestamp <= tr.MaxTimestamp && p.ph.MaxTimestamp >= tr.MinTimestamp {
 		if isInTest && !sort.SliceIsSorted(tsids, func(i, j int) bool { return tsids[i].Less(&tsids[j]) }) {
 			logger.Panicf("BUG: tsids must be sorted; got %+v", tsids)
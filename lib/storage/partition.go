@@ -114,6 +114,14 @@ type partition struct {
 	smallMergeNeedFreeDiskSpace uint64
 	bigMergeNeedFreeDiskSpace   uint64
 
+	tombstonesApplied uint64
+
+	// tombstonesMergeTimestamp is the timestamp in milliseconds for the last tombstones merge. See runTombstonesMerge.
+	tombstonesMergeTimestamp int64
+
+	// mergesStopped is set to 1 if background merges are stopped via stopMerges.
+	mergesStopped uint64
+
 	mergeIdx uint64
 
 	smallPartsPath string
@@ -122,14 +130,17 @@ type partition struct {
 	// The callack that returns deleted metric ids which must be skipped during merge.
 	getDeletedMetricIDs func() *uint64set.Set
 
+	// The callback that returns metric ids for retention filters, which must be applied during merge.
+	getRetentionFilterMetricIDs func() *retentionFilterMetricIDs
+
 	// data retention in milliseconds.
 	// Used for deleting data outside the retention during background merge.
 	retentionMsecs int64
 
-	// Name is the name of the partition in the form YYYY_MM.
+	// Name is the name of the partition in the form YYYY_MM, YYYY_Www or YYYY_MM_DD depending on the partition granularity.
 	name string
 
-	// The time range for the partition. Usually this is a whole month.
+	// The time range for the partition. Usually this is a whole month, week or day depending on the partition granularity.
 	tr TimeRange
 
 	// partsLock protects smallParts and bigParts.
@@ -147,8 +158,17 @@ type partition struct {
 	// rawRows aren't used in search for performance reasons.
 	rawRows rawRowsShards
 
+	// tombstones contains *tombstones for samples deleted via Storage.DeleteSeriesOnTimeRange.
+	//
+	// tombstonesLock serializes tombstones updates.
+	tombstones     atomic.Value
+	tombstonesLock sync.Mutex
+
 	snapshotLock sync.RWMutex
 
+	// isReadOnly is set for partitions opened via openPartitionReadOnly.
+	isReadOnly bool
+
 	stopCh chan struct{}
 
 	smallPartsMergerWG     sync.WaitGroup
@@ -199,7 +219,7 @@ func (pw *partWrapper) decRef() {
 
 // createPartition creates new partition for the given timestamp and the given paths
 // to small and big partitions.
-func createPartition(timestamp int64, smallPartitionsPath, bigPartitionsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) (*partition, error) {
+func createPartition(timestamp int64, smallPartitionsPath, bigPartitionsPath string, getDeletedMetricIDs func() *uint64set.Set, getRetentionFilterMetricIDs func() *retentionFilterMetricIDs, retentionMsecs int64) (*partition, error) {
 	name := timestampToPartitionName(timestamp)
 	smallPartsPath := filepath.Clean(smallPartitionsPath) + "/" + name
 	bigPartsPath := filepath.Clean(bigPartitionsPath) + "/" + name
@@ -212,8 +232,9 @@ func createPartition(timestamp int64, smallPartitionsPath, bigPartitionsPath str
 		return nil, fmt.Errorf("cannot create directories for big parts %q: %w", bigPartsPath, err)
 	}
 
-	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs)
+	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs, getRetentionFilterMetricIDs, retentionMsecs)
 	pt.tr.fromPartitionTimestamp(timestamp)
+	pt.tombstones.Store(&tombstones{})
 	pt.startMergeWorkers()
 	pt.startRawRowsFlusher()
 	pt.startInmemoryPartsFlusher()
@@ -238,13 +259,13 @@ func (pt *partition) Drop() {
 }
 
 // openPartition opens the existing partition from the given paths.
-func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) (*partition, error) {
+func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, getRetentionFilterMetricIDs func() *retentionFilterMetricIDs, retentionMsecs int64) (*partition, error) {
 	smallPartsPath = filepath.Clean(smallPartsPath)
 	bigPartsPath = filepath.Clean(bigPartsPath)
 
 	n := strings.LastIndexByte(smallPartsPath, '/')
 	if n < 0 {
-		return nil, fmt.Errorf("cannot find partition name from smallPartsPath %q; must be in the form /path/to/smallparts/YYYY_MM", smallPartsPath)
+		return nil, fmt.Errorf("cannot find partition name from smallPartsPath %q; must be in the form /path/to/smallparts/YYYY_MM, /path/to/smallparts/YYYY_Www or /path/to/smallparts/YYYY_MM_DD", smallPartsPath)
 	}
 	name := smallPartsPath[n+1:]
 
@@ -262,12 +283,14 @@ func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func
 		return nil, fmt.Errorf("cannot open big parts from %q: %w", bigPartsPath, err)
 	}
 
-	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs)
+	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs, getRetentionFilterMetricIDs, retentionMsecs)
 	pt.smallParts = smallParts
 	pt.bigParts = bigParts
 	if err := pt.tr.fromPartitionName(name); err != nil {
 		return nil, fmt.Errorf("cannot obtain partition time range from smallPartsPath %q: %w", smallPartsPath, err)
 	}
+	pt.mustLoadTombstones()
+	pt.adjustMergeIdx()
 	pt.startMergeWorkers()
 	pt.startRawRowsFlusher()
 	pt.startInmemoryPartsFlusher()
@@ -276,14 +299,15 @@ func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func
 	return pt, nil
 }
 
-func newPartition(name, smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) *partition {
+func newPartition(name, smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, getRetentionFilterMetricIDs func() *retentionFilterMetricIDs, retentionMsecs int64) *partition {
 	p := &partition{
 		name:           name,
 		smallPartsPath: smallPartsPath,
 		bigPartsPath:   bigPartsPath,
 
-		getDeletedMetricIDs: getDeletedMetricIDs,
-		retentionMsecs:      retentionMsecs,
+		getDeletedMetricIDs:         getDeletedMetricIDs,
+		getRetentionFilterMetricIDs: getRetentionFilterMetricIDs,
+		retentionMsecs:              retentionMsecs,
 
 		mergeIdx: uint64(time.Now().UnixNano()),
 		stopCh:   make(chan struct{}),
@@ -296,6 +320,9 @@ func newPartition(name, smallPartsPath, bigPartsPath string, getDeletedMetricIDs
 type partitionMetrics struct {
 	PendingRows uint64
 
+	PendingTombstones uint64
+	TombstonesApplied uint64
+
 	IndexBlocksCacheSize         uint64
 	IndexBlocksCacheSizeBytes    uint64
 	IndexBlocksCacheSizeMaxBytes uint64
@@ -339,6 +366,10 @@ type partitionMetrics struct {
 func (pt *partition) UpdateMetrics(m *partitionMetrics) {
 	rawRowsLen := uint64(pt.rawRows.Len())
 	m.PendingRows += rawRowsLen
+	if tss := pt.getTombstones(); tss != nil {
+		m.PendingTombstones += uint64(len(tss.items))
+	}
+	m.TombstonesApplied += atomic.LoadUint64(&pt.tombstonesApplied)
 	m.SmallRowsCount += rawRowsLen
 
 	pt.partsLock.Lock()
@@ -402,7 +433,7 @@ func (pt *partition) AddRows(rows []rawRow) {
 	// Validate all the rows.
 	for i := range rows {
 		r := &rows[i]
-		if !pt.HasTimestamp(r.Timestamp) {
+		if !pt.HasTimestamp(TimestampToMsecs(r.Timestamp)) {
 			logger.Panicf("BUG: row %+v has Timestamp outside partition %q range %+v", r, pt.smallPartsPath, &pt.tr)
 		}
 		if err := encoding.CheckPrecisionBits(r.PrecisionBits); err != nil {
@@ -510,19 +541,21 @@ func (pt *partition) addRowsPart(rows []rawRow) {
 		logger.Panicf("BUG: the part %q cannot be added to partition %q because its MinTimestamp exceeds MaxTimestamp; %d vs %d",
 			&mp.ph, pt.smallPartsPath, mp.ph.MinTimestamp, mp.ph.MaxTimestamp)
 	}
-	if mp.ph.MinTimestamp < pt.tr.MinTimestamp {
+	partTr := msecsTimeRange(mp.ph.MinTimestamp, mp.ph.MaxTimestamp)
+	if partTr.MinTimestamp < pt.tr.MinTimestamp {
 		logger.Panicf("BUG: the part %q cannot be added to partition %q because of too small MinTimestamp; got %d; want at least %d",
-			&mp.ph, pt.smallPartsPath, mp.ph.MinTimestamp, pt.tr.MinTimestamp)
+			&mp.ph, pt.smallPartsPath, partTr.MinTimestamp, pt.tr.MinTimestamp)
 	}
-	if mp.ph.MaxTimestamp > pt.tr.MaxTimestamp {
+	if partTr.MaxTimestamp > pt.tr.MaxTimestamp {
 		logger.Panicf("BUG: the part %q cannot be added to partition %q because of too big MaxTimestamp; got %d; want at least %d",
-			&mp.ph, pt.smallPartsPath, mp.ph.MaxTimestamp, pt.tr.MaxTimestamp)
+			&mp.ph, pt.smallPartsPath, partTr.MaxTimestamp, pt.tr.MaxTimestamp)
 	}
 
 	p, err := mp.NewPart()
 	if err != nil {
 		logger.Panicf("BUG: cannot create part from %q: %s", &mp.ph, err)
 	}
+	p.mergeIdx = pt.nextMergeIdx()
 
 	pw := &partWrapper{
 		p:        p,
@@ -590,6 +623,20 @@ func (pt *partition) PutParts(pws []*partWrapper) {
 func (pt *partition) MustClose() {
 	close(pt.stopCh)
 
+	if pt.isReadOnly {
+		// Read-only partition has no background workers and no inmemory parts.
+		pt.partsLock.Lock()
+		smallParts := pt.smallParts
+		bigParts := pt.bigParts
+		pt.smallParts = nil
+		pt.bigParts = nil
+		pt.partsLock.Unlock()
+
+		pt.PutParts(smallParts)
+		pt.PutParts(bigParts)
+		return
+	}
+
 	// Wait until all the pending transaction deletions are finished.
 	pendingTxnDeletionsWG.Wait()
 
@@ -769,6 +816,50 @@ func (pt *partition) flushInmemoryParts(dstPws []*partWrapper, force bool) ([]*p
 	return dstPws, nil
 }
 
+// flushInmemoryPartsToFiles flushes all the inmemory parts, which exist in pt at the moment of the call, to files.
+//
+// It returns false if pt is stopped before all the inmemory parts are flushed.
+func (pt *partition) flushInmemoryPartsToFiles() bool {
+	pending := make(map[*partWrapper]struct{})
+	pt.partsLock.Lock()
+	for _, pw := range pt.smallParts {
+		if pw.mp != nil {
+			pending[pw] = struct{}{}
+		}
+	}
+	pt.partsLock.Unlock()
+
+	var pwsBuf []*partWrapper
+	var err error
+	for len(pending) > 0 {
+		pwsBuf, err = pt.flushInmemoryParts(pwsBuf[:0], true)
+		if err != nil {
+			logger.Panicf("FATAL: cannot flush inmemory parts: %s", err)
+		}
+
+		// flushInmemoryParts skips parts, which are merged by background mergers at the moment.
+		// Wait until these parts are merged into file parts.
+		pt.partsLock.Lock()
+		inmemoryParts := make(map[*partWrapper]struct{}, len(pending))
+		for _, pw := range pt.smallParts {
+			if _, ok := pending[pw]; ok {
+				inmemoryParts[pw] = struct{}{}
+			}
+		}
+		pt.partsLock.Unlock()
+		pending = inmemoryParts
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-pt.stopCh:
+			return false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return true
+}
+
 func (pt *partition) mergePartsOptimal(pws []*partWrapper, stopCh <-chan struct{}) error {
 	defer func() {
 		// Remove isInMerge flag from pws.
@@ -797,17 +888,31 @@ func (pt *partition) mergePartsOptimal(pws []*partWrapper, stopCh <-chan struct{
 
 // ForceMergeAllParts runs merge for all the parts in pt - small and big.
 func (pt *partition) ForceMergeAllParts() error {
+	_, err := pt.forceMergeAllParts()
+	return err
+}
+
+// forceMergeAllParts merges all the parts in pt into a single part.
+//
+// false is returned if the merge cannot be started now because of concurrent merges or the lack of free disk space.
+func (pt *partition) forceMergeAllParts() (bool, error) {
+	if pt.isMergesStopped() {
+		return false, nil
+	}
 	var pws []*partWrapper
+	hasConcurrentMerges := false
 	pt.partsLock.Lock()
 	if !hasActiveMerges(pt.smallParts) && !hasActiveMerges(pt.bigParts) {
 		pws = appendAllPartsToMerge(pws, pt.smallParts)
 		pws = appendAllPartsToMerge(pws, pt.bigParts)
+	} else {
+		hasConcurrentMerges = true
 	}
 	pt.partsLock.Unlock()
 
 	if len(pws) == 0 {
 		// Nothing to merge.
-		return nil
+		return !hasConcurrentMerges, nil
 	}
 
 	// Check whether there is enough disk space for merging pws.
@@ -817,14 +922,58 @@ func (pt *partition) ForceMergeAllParts() error {
 		freeSpaceNeededBytes := newPartSize - maxOutBytes
 		logger.WithThrottler("forceMerge", time.Minute).Warnf("cannot initiate force merge for the partition %s; additional space needed: %d bytes",
 			pt.name, freeSpaceNeededBytes)
-		return nil
+		return false, nil
 	}
 
 	// If len(pws) == 1, then the merge must run anyway. This allows removing the deleted series and performing de-duplication if needed.
 	if err := pt.mergePartsOptimal(pws, pt.stopCh); err != nil {
-		return fmt.Errorf("cannot force merge %d parts from partition %q: %w", len(pws), pt.name, err)
+		return false, fmt.Errorf("cannot force merge %d parts from partition %q: %w", len(pws), pt.name, err)
 	}
-	return nil
+	return true, nil
+}
+
+// mergeMatchingParts merges parts in pt, for which f returns true.
+//
+// Parts, which are merged at the moment, are skipped, since they are replaced with new parts after the merge.
+// The caller may call mergeMatchingParts again later for processing the new parts.
+//
+// false is returned if the merge cannot be started now because of the lack of free disk space or because merges are stopped.
+func (pt *partition) mergeMatchingParts(f func(pw *partWrapper) bool) (bool, error) {
+	if pt.isMergesStopped() {
+		return false, nil
+	}
+	var pws []*partWrapper
+	pt.partsLock.Lock()
+	for _, src := range [][]*partWrapper{pt.smallParts, pt.bigParts} {
+		for _, pw := range src {
+			if pw.isInMerge || !f(pw) {
+				continue
+			}
+			pw.isInMerge = true
+			pws = append(pws, pw)
+		}
+	}
+	pt.partsLock.Unlock()
+
+	if len(pws) == 0 {
+		// Nothing to merge.
+		return true, nil
+	}
+
+	// Check whether there is enough disk space for merging pws.
+	newPartSize := getPartsSize(pws)
+	maxOutBytes := fs.MustGetFreeSpace(pt.bigPartsPath)
+	if newPartSize > maxOutBytes {
+		pt.releasePartsToMerge(pws)
+		freeSpaceNeededBytes := newPartSize - maxOutBytes
+		logger.WithThrottler("mergeMatchingParts", time.Minute).Warnf("cannot initiate merge for %d parts in the partition %s; additional space needed: %d bytes",
+			len(pws), pt.name, freeSpaceNeededBytes)
+		return false, nil
+	}
+	if err := pt.mergePartsOptimal(pws, pt.stopCh); err != nil {
+		return false, fmt.Errorf("cannot merge %d parts from partition %q: %w", len(pws), pt.name, err)
+	}
+	return true, nil
 }
 
 func appendAllPartsToMerge(dst, src []*partWrapper) []*partWrapper {
@@ -847,6 +996,38 @@ func hasActiveMerges(pws []*partWrapper) bool {
 	return false
 }
 
+// stopMerges prevents from starting new merges in pt and waits until the already started merges are finished.
+//
+// Inmemory parts are still flushed to files after the call, so flushInmemoryPartsToFiles may be used
+// for obtaining pt with only file parts, which don't change until resumeMerges is called.
+//
+// false is returned if pt is stopped before the started merges are finished.
+func (pt *partition) stopMerges() bool {
+	atomicSetBool(&pt.mergesStopped, true)
+	for {
+		pt.partsLock.Lock()
+		hasMerges := hasActiveMerges(pt.smallParts) || hasActiveMerges(pt.bigParts)
+		pt.partsLock.Unlock()
+		if !hasMerges {
+			return true
+		}
+		select {
+		case <-pt.stopCh:
+			return false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// resumeMerges resumes merges stopped via stopMerges.
+func (pt *partition) resumeMerges() {
+	atomicSetBool(&pt.mergesStopped, false)
+}
+
+func (pt *partition) isMergesStopped() bool {
+	return atomic.LoadUint64(&pt.mergesStopped) != 0
+}
+
 var (
 	bigMergeWorkersCount   = (cgroup.AvailableCPUs() + 1) / 2
 	smallMergeWorkersCount = (cgroup.AvailableCPUs() + 1) / 2
@@ -979,6 +1160,9 @@ func getMaxOutBytes(path string, workersCount int) uint64 {
 }
 
 func (pt *partition) mergeBigParts(isFinal bool) error {
+	if pt.isMergesStopped() {
+		return errNothingToMerge
+	}
 	maxOutBytes := getMaxOutBytes(pt.bigPartsPath, bigMergeWorkersCount)
 
 	pt.partsLock.Lock()
@@ -990,6 +1174,10 @@ func (pt *partition) mergeBigParts(isFinal bool) error {
 }
 
 func (pt *partition) mergeSmallParts(isFinal bool) error {
+	if pt.isMergesStopped() {
+		return errNothingToMerge
+	}
+
 	// Try merging small parts to a big part at first.
 	maxBigPartOutBytes := getMaxOutBytes(pt.bigPartsPath, bigMergeWorkersCount)
 	pt.partsLock.Lock()
@@ -1060,7 +1248,8 @@ func (pt *partition) runFinalDedup() error {
 func (pt *partition) getRequiredDedupInterval() (int64, int64) {
 	pws := pt.GetParts(nil)
 	defer pt.PutParts(pws)
-	dedupInterval := GetDedupInterval()
+	currentTimestamp := int64(fasttime.UnixTimestamp()) * 1000
+	dedupInterval := getDedupIntervalForTimestamp(pt.tr.MaxTimestamp, currentTimestamp)
 	minDedupInterval := getMinDedupInterval(pws)
 	return dedupInterval, minDedupInterval
 }
@@ -1129,7 +1318,16 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) erro
 		ptPath = pt.bigPartsPath
 	}
 	ptPath = filepath.Clean(ptPath)
+
+	// Obtain mergeIdx together with tombstones, so tombstones added later apply to the merged part.
+	pt.tombstonesLock.Lock()
 	mergeIdx := pt.nextMergeIdx()
+	tss := pt.getTombstones()
+	pt.tombstonesLock.Unlock()
+	for i, pw := range pws {
+		bsrs[i].tss = tss.forPart(pw.p)
+	}
+
 	tmpPartPath := fmt.Sprintf("%s/tmp/%016X", ptPath, mergeIdx)
 	bsw := getBlockStreamWriter()
 	compressLevel := getCompressLevelForRowsCount(outRowsCount, outBlocksCount)
@@ -1152,7 +1350,11 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) erro
 		atomic.AddUint64(&pt.activeSmallMerges, 1)
 	}
 	retentionDeadline := timestampFromTime(startTime) - pt.retentionMsecs
-	err := mergeBlockStreams(&ph, bsw, bsrs, stopCh, dmis, retentionDeadline, rowsMerged, rowsDeleted)
+	// Samples in the merged part are downsampled at least with the interval
+	// calculated for the current timestamp, since downsampling intervals cannot decrease over time.
+	currentTimestamp := int64(fasttime.UnixTimestamp()) * 1000
+	rds := newRetentionDeadlines(pt.getRetentionFilterMetricIDs(), currentTimestamp, retentionDeadline)
+	err := mergeBlockStreams(&ph, bsw, bsrs, stopCh, dmis, rds, rowsMerged, rowsDeleted)
 	if isBigPart {
 		atomic.AddUint64(&pt.activeBigMerges, ^uint64(0))
 	} else {
@@ -1169,7 +1371,7 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) erro
 	}
 	bsrs = nil
 
-	ph.MinDedupInterval = GetDedupInterval()
+	ph.MinDedupInterval = getDedupIntervalForTimestamp(TimestampToMsecs(ph.MaxTimestamp), currentTimestamp)
 	if err := ph.writeMinDedupInterval(tmpPartPath); err != nil {
 		return fmt.Errorf("cannot store min dedup interval for part %q: %w", tmpPartPath, err)
 	}
@@ -1325,13 +1527,13 @@ func (pt *partition) removeStaleParts() {
 
 	pt.partsLock.Lock()
 	for _, pw := range pt.bigParts {
-		if !pw.isInMerge && pw.p.ph.MaxTimestamp < retentionDeadline {
+		if !pw.isInMerge && TimestampToMsecs(pw.p.ph.MaxTimestamp) < retentionDeadline {
 			atomic.AddUint64(&pt.bigRowsDeleted, pw.p.ph.RowsCount)
 			m[pw] = true
 		}
 	}
 	for _, pw := range pt.smallParts {
-		if !pw.isInMerge && pw.p.ph.MaxTimestamp < retentionDeadline {
+		if !pw.isInMerge && TimestampToMsecs(pw.p.ph.MaxTimestamp) < retentionDeadline {
 			atomic.AddUint64(&pt.smallRowsDeleted, pw.p.ph.RowsCount)
 			m[pw] = true
 		}
@@ -1628,11 +1830,19 @@ func (pt *partition) createSnapshot(srcDir, dstDir string) error {
 		return fmt.Errorf("cannot read directory: %w", err)
 	}
 	for _, fi := range fis {
+		fn := fi.Name()
+		if fn == tombstonesFilename {
+			srcPath := srcDir + "/" + fn
+			dstPath := dstDir + "/" + fn
+			if err := os.Link(srcPath, dstPath); err != nil {
+				return fmt.Errorf("cannot create hard link from %q to %q: %w", srcPath, dstPath, err)
+			}
+			continue
+		}
 		if !fs.IsDirOrSymlink(fi) {
 			// Skip non-directories.
 			continue
 		}
-		fn := fi.Name()
 		if fn == "tmp" || fn == "txn" {
 			// Skip special dirs.
 			continue
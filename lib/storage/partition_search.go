@@ -16,6 +16,9 @@ type partitionSearch struct {
 	// pt is a partition to search.
 	pt *partition
 
+	// tss contains tombstones snapshot for pt during Init call.
+	tss *tombstones
+
 	// pws hold parts snapshot for the given partition during Init call.
 	// This snapshot is used for calling Part.PutParts on partitionSearch.MustClose.
 	pws []*partWrapper
@@ -32,6 +35,7 @@ type partitionSearch struct {
 func (pts *partitionSearch) reset() {
 	pts.BlockRef = nil
 	pts.pt = nil
+	pts.tss = nil
 
 	for i := range pts.pws {
 		pts.pws[i] = nil
@@ -81,6 +85,7 @@ func (pts *partitionSearch) Init(pt *partition, tsids []TSID, tr TimeRange) {
 	}
 
 	pts.pws = pt.GetParts(pts.pws[:0])
+	pts.tss = pt.getTombstones()
 
 	// Initialize psPool.
 	if n := len(pts.pws) - cap(pts.psPool); n > 0 {
@@ -89,6 +94,7 @@ func (pts *partitionSearch) Init(pt *partition, tsids []TSID, tr TimeRange) {
 	pts.psPool = pts.psPool[:len(pts.pws)]
 	for i, pw := range pts.pws {
 		pts.psPool[i].Init(pw.p, tsids, tr)
+		pts.psPool[i].BlockRef.tss = pts.tss.forPart(pw.p)
 	}
 
 	// Initialize the psHeap.
@@ -124,17 +130,34 @@ func (pts *partitionSearch) NextBlock() bool {
 	}
 	if pts.nextBlockNoop {
 		pts.nextBlockNoop = false
-		return true
+		if !pts.isBlockDeleted() {
+			return true
+		}
 	}
 
-	pts.err = pts.nextBlock()
-	if pts.err != nil {
-		if pts.err != io.EOF {
-			pts.err = fmt.Errorf("cannot obtain the next block to search in the partition: %w", pts.err)
+	for {
+		pts.err = pts.nextBlock()
+		if pts.err != nil {
+			if pts.err != io.EOF {
+				pts.err = fmt.Errorf("cannot obtain the next block to search in the partition: %w", pts.err)
+			}
+			return false
 		}
+		if !pts.isBlockDeleted() {
+			return true
+		}
+	}
+}
+
+// isBlockDeleted returns true if all the samples in pts.BlockRef are deleted by tombstones.
+func (pts *partitionSearch) isBlockDeleted() bool {
+	tss := pts.BlockRef.tss
+	if !tss.hasItems() {
 		return false
 	}
-	return true
+	bh := &pts.BlockRef.bh
+	tr := msecsTimeRange(bh.MinTimestamp, bh.MaxTimestamp)
+	return tss.covers(bh.TSID.MetricID, tr)
 }
 
 func (pts *partitionSearch) nextBlock() error {
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// PartitionStats contains stats for a single partition.
+type PartitionStats struct {
+	// Name is the partition name such as 2022_01.
+	Name string
+
+	// MinTimestamp and MaxTimestamp is the time range in milliseconds covered by the partition.
+	MinTimestamp int64
+	MaxTimestamp int64
+
+	// IsCold is set if the partition is located at cold storage. See SetColdStorage.
+	IsCold bool
+
+	// PendingRows is the number of recently added rows, which aren't converted into parts yet.
+	PendingRows uint64
+
+	SmallParts []PartStats
+	BigParts   []PartStats
+}
+
+// RowsCount returns the total number of rows in ps parts.
+func (ps *PartitionStats) RowsCount() uint64 {
+	n := uint64(0)
+	for _, p := range ps.SmallParts {
+		n += p.RowsCount
+	}
+	for _, p := range ps.BigParts {
+		n += p.RowsCount
+	}
+	return n
+}
+
+// SizeBytes returns the total size of ps parts.
+func (ps *PartitionStats) SizeBytes() uint64 {
+	n := uint64(0)
+	for _, p := range ps.SmallParts {
+		n += p.SizeBytes
+	}
+	for _, p := range ps.BigParts {
+		n += p.SizeBytes
+	}
+	return n
+}
+
+// PartStats contains stats for a single part.
+type PartStats struct {
+	// Name is the name of part directory. It is empty for in-memory parts.
+	Name string
+
+	// IsInmemory is set for in-memory parts, which aren't flushed to disk yet.
+	IsInmemory bool
+
+	// MinTimestamp and MaxTimestamp are the minimum and the maximum timestamps in milliseconds for rows in the part.
+	MinTimestamp int64
+	MaxTimestamp int64
+
+	RowsCount   uint64
+	BlocksCount uint64
+
+	// SizeBytes is the on-disk size of the part. It is the in-memory size for in-memory parts.
+	SizeBytes uint64
+}
+
+func appendPartStats(dst []PartStats, pws []*partWrapper) []PartStats {
+	for _, pw := range pws {
+		p := pw.p
+		ps := PartStats{
+			IsInmemory:   pw.mp != nil,
+			MinTimestamp: TimestampToMsecs(p.ph.MinTimestamp),
+			MaxTimestamp: TimestampToMsecs(p.ph.MaxTimestamp),
+			RowsCount:    p.ph.RowsCount,
+			BlocksCount:  p.ph.BlocksCount,
+			SizeBytes:    p.size,
+		}
+		if p.path != "" {
+			ps.Name = filepath.Base(p.path)
+		}
+		dst = append(dst, ps)
+	}
+	return dst
+}
+
+// GetPartitionsStats returns stats for tb partitions sorted by name.
+func (tb *table) GetPartitionsStats() []PartitionStats {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+
+	pss := make([]PartitionStats, 0, len(ptws))
+	for _, ptw := range ptws {
+		pt := ptw.pt
+		ps := PartitionStats{
+			Name:         pt.name,
+			MinTimestamp: pt.tr.MinTimestamp,
+			MaxTimestamp: pt.tr.MaxTimestamp,
+			IsCold:       tb.isColdPartition(pt),
+			PendingRows:  uint64(pt.rawRows.Len()),
+		}
+		pt.partsLock.Lock()
+		ps.SmallParts = appendPartStats(ps.SmallParts, pt.smallParts)
+		ps.BigParts = appendPartStats(ps.BigParts, pt.bigParts)
+		pt.partsLock.Unlock()
+		pss = append(pss, ps)
+	}
+	sort.Slice(pss, func(i, j int) bool {
+		return pss[i].Name < pss[j].Name
+	})
+	return pss
+}
+
+// ErrPartitionNotFound is returned when the partition with the given name is missing.
+var ErrPartitionNotFound = errors.New("partition not found")
+
+// DropPartition drops the partition with the given name from tb.
+//
+// The partition data is removed from disk after all the pending searches over it are finished.
+// Rows for the partition time range are rejected until then.
+// The partition is created again if new rows for its time range are added to tb after that.
+func (tb *table) DropPartition(name string) error {
+	var ptwDrop *partitionWrapper
+	tb.ptwsLock.Lock()
+	dst := tb.ptws[:0]
+	for _, ptw := range tb.ptws {
+		if ptwDrop == nil && ptw.pt.name == name {
+			ptwDrop = ptw
+		} else {
+			dst = append(dst, ptw)
+		}
+	}
+	tb.ptws = dst
+	if ptwDrop != nil {
+		// Mark the partition as dropping under tb.ptwsLock, so concurrent AddRows cannot create it until its data is removed.
+		tb.addDroppingPartition(name)
+		ptwDrop.dropCallback = func() {
+			tb.removeDroppingPartition(name)
+			logger.Infof("partition %q has been dropped", name)
+		}
+	}
+	tb.ptwsLock.Unlock()
+
+	if ptwDrop == nil {
+		return fmt.Errorf("cannot drop partition %q: %w", name, ErrPartitionNotFound)
+	}
+	logger.Infof("partition %q has been detached from the table and will be dropped after all the pending searches over it are finished", name)
+
+	// Remove table reference from the partition, so it will be eventually
+	// closed and dropped after all the pending searches are done.
+	ptwDrop.scheduleToDrop()
+	ptwDrop.decRef()
+	return nil
+}
+
+func (tb *table) addDroppingPartition(name string) {
+	tb.droppingPartitionsLock.Lock()
+	if tb.droppingPartitions == nil {
+		tb.droppingPartitions = make(map[string]struct{})
+	}
+	tb.droppingPartitions[name] = struct{}{}
+	tb.droppingPartitionsLock.Unlock()
+}
+
+func (tb *table) removeDroppingPartition(name string) {
+	tb.droppingPartitionsLock.Lock()
+	delete(tb.droppingPartitions, name)
+	tb.droppingPartitionsLock.Unlock()
+}
+
+// isDroppingPartition returns true if the partition with the given name is dropped, but its data isn't removed yet.
+func (tb *table) isDroppingPartition(name string) bool {
+	tb.droppingPartitionsLock.Lock()
+	_, ok := tb.droppingPartitions[name]
+	tb.droppingPartitionsLock.Unlock()
+	return ok
+}
+
+// ForceMergePartition force-merges all the parts in the partition with the given name into a single part.
+func (tb *table) ForceMergePartition(name string) error {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+	for _, ptw := range ptws {
+		if ptw.pt.name != name {
+			continue
+		}
+		logger.Infof("starting forced merge for partition %q", name)
+		startTime := time.Now()
+		if err := ptw.pt.ForceMergeAllParts(); err != nil {
+			return fmt.Errorf("cannot complete forced merge for partition %q: %w", name, err)
+		}
+		logger.Infof("forced merge for partition %q has been finished in %.3f seconds", name, time.Since(startTime).Seconds())
+		return nil
+	}
+	return fmt.Errorf("cannot force merge partition %q: %w", name, ErrPartitionNotFound)
+}
+
+// GetPartitionsStats returns stats for partitions in s sorted by partition name.
+func (s *Storage) GetPartitionsStats() []PartitionStats {
+	return s.tb.GetPartitionsStats()
+}
+
+// DropPartition drops the partition with the given name from s.
+//
+// Dropping the partition for the current time range makes sense only after stopping data ingestion for it,
+// since the partition is created again when new rows for its time range are added.
+func (s *Storage) DropPartition(name string) error {
+	if s.isReadOnlyReplica {
+		return ErrReadOnlyReplica
+	}
+	return s.tb.DropPartition(name)
+}
+
+// ForceMergePartition force-merges the partition with the given name in s.
+func (s *Storage) ForceMergePartition(name string) error {
+	if s.isReadOnlyReplica {
+		return ErrReadOnlyReplica
+	}
+	return s.tb.ForceMergePartition(name)
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStoragePartitionsStats(t *testing.T) {
+	path := "TestStoragePartitionsStats"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+
+	// Add rows to the current and the previous month.
+	now := time.Now().UTC()
+	currMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	prevMonth := currMonth.AddDate(0, -1, 0)
+	addRows := func(t0 time.Time, rowsCount int) {
+		t.Helper()
+		var mrs []MetricRow
+		for i := 0; i < rowsCount; i++ {
+			var mn MetricName
+			mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i%10))
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: mn.marshalRaw(nil),
+				Timestamp:     t0.UnixNano()/1e6 + int64(i)*1000,
+				Value:         float64(i),
+			})
+		}
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+		s.DebugFlush()
+		s.tb.flushInmemoryPartsToFiles()
+	}
+	for i := 0; i < 3; i++ {
+		addRows(prevMonth, 100)
+	}
+	addRows(currMonth, 50)
+
+	currName := currMonth.Format("2006_01")
+	prevName := prevMonth.Format("2006_01")
+	getStats := func(name string) *PartitionStats {
+		t.Helper()
+		for _, ps := range s.GetPartitionsStats() {
+			if ps.Name == name {
+				return &ps
+			}
+		}
+		return nil
+	}
+	checkStats := func(name string, rowsCountExpected uint64) {
+		t.Helper()
+		ps := getStats(name)
+		if ps == nil {
+			t.Fatalf("cannot find partition %q", name)
+		}
+		if n := ps.RowsCount(); n != rowsCountExpected {
+			t.Fatalf("unexpected rows count for partition %q; got %d; want %d", name, n, rowsCountExpected)
+		}
+		if ps.SizeBytes() == 0 {
+			t.Fatalf("expecting non-zero size for partition %q", name)
+		}
+		for _, p := range append(ps.SmallParts, ps.BigParts...) {
+			if p.MinTimestamp < ps.MinTimestamp || p.MaxTimestamp > ps.MaxTimestamp {
+				t.Fatalf("part %q time range [%d..%d] is outside partition %q time range [%d..%d]",
+					p.Name, p.MinTimestamp, p.MaxTimestamp, name, ps.MinTimestamp, ps.MaxTimestamp)
+			}
+		}
+	}
+	checkStats(prevName, 300)
+	checkStats(currName, 50)
+
+	// Force merge must leave a single part in the partition.
+	if err := s.ForceMergePartition(prevName); err != nil {
+		t.Fatalf("cannot force merge partition %q: %s", prevName, err)
+	}
+	checkStats(prevName, 300)
+	if ps := getStats(prevName); len(ps.SmallParts)+len(ps.BigParts) != 1 {
+		t.Fatalf("unexpected number of parts after force merge; got %d small parts and %d big parts; want a single part", len(ps.SmallParts), len(ps.BigParts))
+	}
+
+	// The dropped partition must disappear, while other partitions must remain.
+	// Hold partitions references in order to simulate pending searches, which postpone the removal of partition data.
+	ptws := s.tb.GetPartitions(nil)
+	if err := s.DropPartition(prevName); err != nil {
+		t.Fatalf("cannot drop partition %q: %s", prevName, err)
+	}
+	if ps := getStats(prevName); ps != nil {
+		t.Fatalf("the partition %q must be dropped", prevName)
+	}
+	checkStats(currName, 50)
+
+	// Rows for the dropped partition must be rejected until its data is removed.
+	var mn MetricName
+	mn.MetricGroup = []byte("metric")
+	mrs := []MetricRow{{
+		MetricNameRaw: mn.marshalRaw(nil),
+		Timestamp:     prevMonth.UnixNano() / 1e6,
+		Value:         1,
+	}}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err == nil {
+		t.Fatalf("expecting non-nil error when adding rows to the partition %q being dropped", prevName)
+	}
+	if ps := getStats(prevName); ps != nil {
+		t.Fatalf("the partition %q cannot be created until its data is removed", prevName)
+	}
+	s.tb.PutPartitions(ptws)
+	if fs.IsPathExist(s.tb.smallPartitionsPath + "/" + prevName) {
+		t.Fatalf("the data for the partition %q must be removed", prevName)
+	}
+
+	// The partition must be created again after its data is removed.
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows to the partition %q after its data is removed: %s", prevName, err)
+	}
+	s.DebugFlush()
+	checkStats(prevName, 1)
+	if err := s.DropPartition(prevName); err != nil {
+		t.Fatalf("cannot drop partition %q: %s", prevName, err)
+	}
+
+	// Missing partitions must result in ErrPartitionNotFound.
+	if err := s.DropPartition(prevName); !errors.Is(err, ErrPartitionNotFound) {
+		t.Fatalf("unexpected error when dropping missing partition; got %v; want %v", err, ErrPartitionNotFound)
+	}
+	if err := s.ForceMergePartition("foobar"); !errors.Is(err, ErrPartitionNotFound) {
+		t.Fatalf("unexpected error when merging missing partition; got %v; want %v", err, ErrPartitionNotFound)
+	}
+	s.MustClose()
+
+	// The dropped partition must be missing after the restart.
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage: %s", err)
+	}
+	if ps := getStats(prevName); ps != nil {
+		t.Fatalf("the partition %q must be missing after the restart", prevName)
+	}
+	checkStats(currName, 50)
+	s.MustClose()
+}
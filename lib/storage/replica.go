@@ -0,0 +1,588 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
+)
+
+var (
+	readOnlyReplica        bool
+	replicaRefreshInterval = 30 * time.Second
+)
+
+// SetReadOnlyReplica enables read-only replica mode for the storage.
+//
+// In this mode the storage is opened on the path owned by another VictoriaMetrics instance
+// or on a copy of such path. The storage doesn't modify files at the path, doesn't run background merges
+// and picks up changes made by the owner of the path every refreshInterval.
+//
+// This function must be called before OpenStorage.
+func SetReadOnlyReplica(enabled bool, refreshInterval time.Duration) {
+	readOnlyReplica = enabled
+	if refreshInterval > 0 {
+		replicaRefreshInterval = refreshInterval
+	}
+}
+
+// ErrReadOnlyReplica is returned when trying to modify the storage opened in read-only replica mode.
+var ErrReadOnlyReplica = errors.New("the storage is opened in read-only replica mode")
+
+// IsReadOnlyReplica returns true if s is opened in read-only replica mode.
+//
+// See SetReadOnlyReplica.
+func (s *Storage) IsReadOnlyReplica() bool {
+	return s.isReadOnlyReplica
+}
+
+// openReadOnly opens s in read-only replica mode.
+func (s *Storage) openReadOnly() error {
+	path := s.path
+	if !fs.IsPathExist(path) {
+		return fmt.Errorf("cannot open storage at %q in read-only replica mode, since the directory doesn't exist", path)
+	}
+	restoreLockF := path + "/restore-in-progress"
+	if fs.IsPathExist(restoreLockF) {
+		return fmt.Errorf("restore lock file exists, incomplete vmrestore run. Wait until vmrestore is finished at %q", path)
+	}
+
+	// Caches aren't loaded from the storage path and aren't saved there,
+	// since the path is owned by another process.
+	mem := memory.Allowed()
+	s.tsidCache = workingsetcache.New(getTSIDCacheSize())
+	s.metricIDCache = workingsetcache.New(mem / 16)
+	s.metricNameCache = workingsetcache.New(mem / 10)
+	s.dateMetricIDCache = newDateMetricIDCache()
+	s.exemplars = newExemplarStore(maxExemplarsPerSeries, maxExemplarSeries)
+	s.metricNamesStats = newMetricNamesStats()
+
+	hour := fasttime.UnixHour()
+	s.currHourMetricIDs.Store(&hourMetricIDs{hour: hour})
+	s.prevHourMetricIDs.Store(&hourMetricIDs{hour: hour - 1})
+	s.lastHourChurn.Store(&hourChurn{})
+	s.pendingHourEntries = &uint64set.Set{}
+	s.nextDayMetricIDs.Store(&byDateMetricIDEntry{date: fasttime.UnixDate()})
+	s.pendingNextDayMetricIDs = &uint64set.Set{}
+	s.prefetchedMetricIDs.Store(&uint64set.Set{})
+	s.retentionFilterMetricIDs.Store(&retentionFilterMetricIDs{})
+	s.setDeletedMetricIDs(&uint64set.Set{})
+
+	if err := checkTimestampPrecision(path+"/metadata", false, true); err != nil {
+		return err
+	}
+	minTimestampPath := path + "/metadata/minTimestampForCompositeIndex"
+	minTimestamp, err := loadMinTimestampForCompositeIndex(minTimestampPath)
+	if err != nil {
+		return fmt.Errorf("cannot load minTimestampForCompositeIndex from %q: %w", minTimestampPath, err)
+	}
+	s.minTimestampForCompositeIndex = minTimestamp
+
+	// Load indexdb
+	idbPath := path + "/indexdb"
+	idbCurr, idbPrev, err := s.openIndexDBTablesReadOnly(idbPath)
+	if err != nil {
+		return fmt.Errorf("cannot open indexdb tables at %q: %w", idbPath, err)
+	}
+	idbCurr.SetExtDB(idbPrev)
+	s.idbCurr.Store(idbCurr)
+	if err := s.reloadDeletedMetricIDs(); err != nil {
+		s.idb().MustClose()
+		return err
+	}
+
+	// Load data
+	tablePath := path + "/data"
+	tb, err := openTableReadOnly(tablePath, s.getDeletedMetricIDs, s.getRetentionFilterMetricIDs, s.retentionMsecs)
+	if err != nil {
+		s.idb().MustClose()
+		return fmt.Errorf("cannot open table at %q: %w", tablePath, err)
+	}
+	s.tb = tb
+
+	// Load metric metadata index
+	mmPath := path + "/metric_metadata"
+	mmTable, err := mergeset.OpenTableReadOnly(mmPath, nil, nil)
+	if err != nil {
+		s.tb.MustClose()
+		s.idb().MustClose()
+		return fmt.Errorf("cannot open metric metadata index at %q: %w", mmPath, err)
+	}
+	s.metricMetadata = &metricMetadataIndex{
+		tb:   mmTable,
+		seen: make(map[string]string),
+	}
+
+	s.startReplicaRefresher()
+	return nil
+}
+
+// mustCloseReadOnly closes s opened in read-only replica mode.
+func (s *Storage) mustCloseReadOnly() {
+	s.replicaRefresherWG.Wait()
+
+	s.tb.MustClose()
+	s.idb().MustClose()
+	s.metricMetadata.MustClose()
+
+	// Do not save caches, since the storage path is owned by another process.
+	s.tsidCache.Stop()
+	s.metricIDCache.Stop()
+	s.metricNameCache.Stop()
+}
+
+func (s *Storage) openIndexDBTablesReadOnly(path string) (curr, prev *indexDB, err error) {
+	tableNames, err := readIndexDBTableNames(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tableNames) < 2 {
+		return nil, nil, fmt.Errorf("unexpected number of indexdb tables at %q; got %d; want at least 2", path, len(tableNames))
+	}
+	currPath := path + "/" + tableNames[len(tableNames)-1]
+	curr, err = openIndexDB(currPath, s, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open curr indexdb table at %q: %w", currPath, err)
+	}
+	prevPath := path + "/" + tableNames[len(tableNames)-2]
+	prev, err = openIndexDB(prevPath, s, 0)
+	if err != nil {
+		curr.MustClose()
+		return nil, nil, fmt.Errorf("cannot open prev indexdb table at %q: %w", prevPath, err)
+	}
+	return curr, prev, nil
+}
+
+func (s *Storage) startReplicaRefresher() {
+	s.replicaRefresherWG.Add(1)
+	go func() {
+		s.replicaRefresher()
+		s.replicaRefresherWG.Done()
+	}()
+}
+
+func (s *Storage) replicaRefresher() {
+	ticker := time.NewTicker(replicaRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.refreshReplica(); err != nil {
+				logger.Errorf("cannot refresh read-only replica at %q: %s", s.path, err)
+			}
+		}
+	}
+}
+
+// refreshReplica picks up changes made by the owner of the storage path since the previous call.
+func (s *Storage) refreshReplica() error {
+	s.replicaRefreshLock.Lock()
+	defer s.replicaRefreshLock.Unlock()
+
+	atomic.AddUint64(&s.replicaRefreshes, 1)
+	err := s.refreshReplicaLocked()
+	if err != nil {
+		atomic.AddUint64(&s.replicaRefreshErrors, 1)
+	}
+	return err
+}
+
+func (s *Storage) refreshReplicaLocked() error {
+	// Refresh indexdb before the data, so the index for newly added series
+	// is usually visible by the time the data for these series becomes visible.
+	if err := s.refreshIndexDBReadOnly(); err != nil {
+		return fmt.Errorf("cannot refresh indexdb: %w", err)
+	}
+	if err := s.reloadDeletedMetricIDs(); err != nil {
+		return err
+	}
+	if err := s.tb.refreshPartitionsReadOnly(); err != nil {
+		return fmt.Errorf("cannot refresh partitions: %w", err)
+	}
+	if err := s.metricMetadata.tb.RefreshParts(); err != nil {
+		return fmt.Errorf("cannot refresh metric metadata index: %w", err)
+	}
+	return nil
+}
+
+// refreshIndexDBReadOnly picks up indexdb parts created by the owner of the storage path.
+//
+// It switches to the new indexdb tables if the indexdb has been rotated by the owner.
+func (s *Storage) refreshIndexDBReadOnly() error {
+	idbPath := s.path + "/indexdb"
+	tableNames, err := readIndexDBTableNames(idbPath)
+	if err != nil {
+		return err
+	}
+	if len(tableNames) < 2 {
+		return fmt.Errorf("unexpected number of indexdb tables at %q; got %d; want at least 2", idbPath, len(tableNames))
+	}
+	currName := tableNames[len(tableNames)-1]
+	prevName := tableNames[len(tableNames)-2]
+
+	idbCurr := s.idb()
+	if idbCurr.name == currName {
+		if err := idbCurr.tb.RefreshParts(); err != nil {
+			return err
+		}
+		idbCurr.doExtDB(func(extDB *indexDB) {
+			err = extDB.tb.RefreshParts()
+		})
+		return err
+	}
+
+	// The indexdb has been rotated by the owner of the storage path.
+	currPath := idbPath + "/" + currName
+	idbNew, err := openIndexDB(currPath, s, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open curr indexdb table at %q: %w", currPath, err)
+	}
+	if idbCurr.name == prevName {
+		// Use the current indexdb as the previous one in the same way as Storage.mustRotateIndexDB does.
+		if err := idbCurr.tb.RefreshParts(); err != nil {
+			idbNew.MustClose()
+			return err
+		}
+		idbCurr.SetExtDB(nil)
+		idbNew.SetExtDB(idbCurr)
+		s.idbCurr.Store(idbNew)
+	} else {
+		// Multiple rotations were missed. Open both tables from scratch.
+		prevPath := idbPath + "/" + prevName
+		idbPrev, err := openIndexDB(prevPath, s, 0)
+		if err != nil {
+			idbNew.MustClose()
+			return fmt.Errorf("cannot open prev indexdb table at %q: %w", prevPath, err)
+		}
+		idbNew.SetExtDB(idbPrev)
+		s.idbCurr.Store(idbNew)
+		idbCurr.MustClose()
+	}
+	s.dateMetricIDCache.Reset()
+	logger.Infof("switched to indexdb table %q after the rotation at %q", currName, s.path)
+	return nil
+}
+
+// reloadDeletedMetricIDs loads deleted metricIDs from the current and the previous indexdb.
+func (s *Storage) reloadDeletedMetricIDs() error {
+	idb := s.idb()
+	dmis, err := idb.loadDeletedMetricIDs()
+	if err != nil {
+		return fmt.Errorf("cannot load deleted metricIDs for the current indexDB: %w", err)
+	}
+	var dmisPrev *uint64set.Set
+	idb.doExtDB(func(extDB *indexDB) {
+		dmisPrev, err = extDB.loadDeletedMetricIDs()
+	})
+	if err != nil {
+		return fmt.Errorf("cannot load deleted metricIDs for the previous indexDB: %w", err)
+	}
+	dmis.Union(dmisPrev)
+	if dmis.Equal(s.getDeletedMetricIDs()) {
+		return nil
+	}
+	s.setDeletedMetricIDs(dmis)
+
+	// Reset TagFilters -> TSIDS cache, since it may contain deleted TSIDs.
+	invalidateTagFiltersCache()
+	return nil
+}
+
+// openTableReadOnly opens the existing table at the given path in read-only mode.
+func openTableReadOnly(path string, getDeletedMetricIDs func() *uint64set.Set, getRetentionFilterMetricIDs func() *retentionFilterMetricIDs, retentionMsecs int64) (*table, error) {
+	path = filepath.Clean(path)
+	tb := &table{
+		path:                        path,
+		smallPartitionsPath:         path + "/small",
+		bigPartitionsPath:           path + "/big",
+		getDeletedMetricIDs:         getDeletedMetricIDs,
+		getRetentionFilterMetricIDs: getRetentionFilterMetricIDs,
+		retentionMsecs:              retentionMsecs,
+		isReadOnly:                  true,
+
+		stop: make(chan struct{}),
+	}
+	if coldStoragePath != "" {
+		coldPath, err := filepath.Abs(coldStoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine absolute path for cold storage %q: %w", coldStoragePath, err)
+		}
+		tb.coldSmallPartitionsPath = coldPath + "/data/small"
+		tb.coldBigPartitionsPath = coldPath + "/data/big"
+	}
+	if err := tb.refreshPartitionsReadOnly(); err != nil {
+		tb.MustClose()
+		return nil, err
+	}
+	return tb, nil
+}
+
+type partitionPaths struct {
+	smallPartsPath string
+	bigPartsPath   string
+}
+
+// refreshPartitionsReadOnly updates the list of partitions and their parts for tb opened via openTableReadOnly.
+func (tb *table) refreshPartitionsReadOnly() error {
+	ptPaths, err := tb.getPartitionPathsReadOnly()
+	if err != nil {
+		return err
+	}
+
+	tb.ptwsLock.Lock()
+	oldPtws := append([]*partitionWrapper{}, tb.ptws...)
+	tb.ptwsLock.Unlock()
+
+	var errGlobal error
+	var ptws, ptwsToClose []*partitionWrapper
+	for _, ptw := range oldPtws {
+		pt := ptw.pt
+		paths, ok := ptPaths[pt.name]
+		if !ok || paths.smallPartsPath != pt.smallPartsPath {
+			// The partition has been dropped or moved to cold storage by the owner of the table.
+			ptwsToClose = append(ptwsToClose, ptw)
+			continue
+		}
+		delete(ptPaths, pt.name)
+		if err := pt.refreshPartsReadOnly(false); err != nil && !errors.Is(err, errPendingTransactions) {
+			errGlobal = fmt.Errorf("cannot refresh partition %q: %w", pt.name, err)
+		}
+		ptws = append(ptws, ptw)
+	}
+	for ptName, paths := range ptPaths {
+		pt, err := openPartitionReadOnly(paths.smallPartsPath, paths.bigPartsPath, tb.getDeletedMetricIDs, tb.getRetentionFilterMetricIDs, tb.retentionMsecs)
+		if err != nil {
+			errGlobal = fmt.Errorf("cannot open partition %q: %w", ptName, err)
+			continue
+		}
+		ptws = append(ptws, &partitionWrapper{
+			pt:       pt,
+			refCount: 1,
+		})
+	}
+
+	tb.ptwsLock.Lock()
+	tb.ptws = ptws
+	tb.ptwsLock.Unlock()
+
+	// The partitions are closed after all the pending searches on them are finished.
+	tb.PutPartitions(ptwsToClose)
+	return errGlobal
+}
+
+// getPartitionPathsReadOnly returns paths for partitions in tb keyed by partition name.
+func (tb *table) getPartitionPathsReadOnly() (map[string]partitionPaths, error) {
+	ptNames := make(map[string]bool)
+	if err := populatePartitionNames(tb.smallPartitionsPath, ptNames); err != nil {
+		return nil, err
+	}
+	if err := populatePartitionNames(tb.bigPartitionsPath, ptNames); err != nil {
+		return nil, err
+	}
+	coldPtNames := make(map[string]bool)
+	if tb.isColdStorageEnabled() && fs.IsPathExist(tb.coldSmallPartitionsPath) {
+		if err := populatePartitionNames(tb.coldSmallPartitionsPath, coldPtNames); err != nil {
+			return nil, err
+		}
+		if err := populatePartitionNames(tb.coldBigPartitionsPath, coldPtNames); err != nil {
+			return nil, err
+		}
+	}
+	m := make(map[string]partitionPaths, len(ptNames))
+	for ptName := range ptNames {
+		m[ptName] = partitionPaths{
+			smallPartsPath: tb.smallPartitionsPath + "/" + ptName,
+			bigPartsPath:   tb.bigPartitionsPath + "/" + ptName,
+		}
+	}
+	for ptName := range coldPtNames {
+		coldBigPartsPath := tb.coldBigPartitionsPath + "/" + ptName
+		if ptNames[ptName] && !isColdPartitionComplete(coldBigPartsPath) {
+			// The partition is being moved to cold storage. Continue using it from hot storage.
+			continue
+		}
+		m[ptName] = partitionPaths{
+			smallPartsPath: tb.coldSmallPartitionsPath + "/" + ptName,
+			bigPartsPath:   coldBigPartsPath,
+		}
+	}
+	return m, nil
+}
+
+// openPartitionReadOnly opens the existing partition from the given paths in read-only mode.
+func openPartitionReadOnly(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, getRetentionFilterMetricIDs func() *retentionFilterMetricIDs, retentionMsecs int64) (*partition, error) {
+	smallPartsPath = filepath.Clean(smallPartsPath)
+	bigPartsPath = filepath.Clean(bigPartsPath)
+	name := filepath.Base(smallPartsPath)
+
+	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs, getRetentionFilterMetricIDs, retentionMsecs)
+	pt.isReadOnly = true
+	if err := pt.tr.fromPartitionName(name); err != nil {
+		return nil, fmt.Errorf("cannot obtain partition time range from smallPartsPath %q: %w", smallPartsPath, err)
+	}
+
+	// Wait for a while until pending transactions are finished by the owner of the partition.
+	// Open parts regardless of pending transactions if they aren't finished in time,
+	// since they may be left after unclean shutdown of the owner.
+	err := pt.refreshPartsReadOnly(false)
+	for i := 0; i < 10 && errors.Is(err, errPendingTransactions); i++ {
+		time.Sleep(100 * time.Millisecond)
+		err = pt.refreshPartsReadOnly(false)
+	}
+	if errors.Is(err, errPendingTransactions) {
+		logger.Warnf("opening partition %q with pending transactions; the list of parts may be inconsistent until the transactions are finished", smallPartsPath)
+		err = pt.refreshPartsReadOnly(true)
+	}
+	if err != nil {
+		pt.MustClose()
+		return nil, err
+	}
+	return pt, nil
+}
+
+// errPendingTransactions is returned if the partition has unfinished transactions.
+var errPendingTransactions = errors.New("the partition has pending transactions")
+
+// refreshPartsReadOnly updates the list of parts and tombstones for pt opened via openPartitionReadOnly.
+//
+// The list of parts remains unchanged and errPendingTransactions is returned if pt has unfinished transactions
+// unless ignorePendingTransactions is set, since the list of parts may be inconsistent in this case.
+func (pt *partition) refreshPartsReadOnly(ignorePendingTransactions bool) error {
+	pt.partsLock.Lock()
+	oldSmallParts := pt.smallParts
+	oldBigParts := pt.bigParts
+	pt.partsLock.Unlock()
+
+	existing := make(map[string]*partWrapper, len(oldSmallParts)+len(oldBigParts))
+	for _, pw := range oldSmallParts {
+		existing[pw.p.path] = pw
+	}
+	for _, pw := range oldBigParts {
+		existing[pw.p.path] = pw
+	}
+
+	if !ignorePendingTransactions {
+		if err := pt.checkPendingTransactions(); err != nil {
+			return err
+		}
+	}
+	smallParts, err := openPartsReadOnly(pt.smallPartsPath, existing)
+	if err != nil {
+		return err
+	}
+	bigParts, err := openPartsReadOnly(pt.bigPartsPath, existing)
+	if err != nil {
+		pt.PutParts(smallParts)
+		return err
+	}
+	if !ignorePendingTransactions {
+		// Verify that no transactions were started while reading the list of parts.
+		if err := pt.checkPendingTransactions(); err != nil {
+			pt.PutParts(smallParts)
+			pt.PutParts(bigParts)
+			return err
+		}
+	}
+
+	pt.partsLock.Lock()
+	pt.smallParts = smallParts
+	pt.bigParts = bigParts
+	pt.partsLock.Unlock()
+
+	pt.PutParts(oldSmallParts)
+	pt.PutParts(oldBigParts)
+
+	pt.mustLoadTombstones()
+	pt.adjustMergeIdx()
+	return nil
+}
+
+// checkPendingTransactions returns errPendingTransactions if pt has unfinished transactions.
+//
+// Transactions for merges may be stored in both small and big parts dirs.
+func (pt *partition) checkPendingTransactions() error {
+	for _, path := range []string{pt.smallPartsPath, pt.bigPartsPath} {
+		txnDir := path + "/txn"
+		fis, err := ioutil.ReadDir(txnDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("cannot read directory %q: %w", txnDir, err)
+		}
+		for _, fi := range fis {
+			if !fs.IsTemporaryFileName(fi.Name()) {
+				return errPendingTransactions
+			}
+		}
+	}
+	return nil
+}
+
+// openPartsReadOnly opens parts at the given path without modifying it.
+//
+// Parts from existing are re-used instead of opening them again. Their refCount is incremented.
+func openPartsReadOnly(path string, existing map[string]*partWrapper) ([]*partWrapper, error) {
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// The path can be missing after restoring from backup or while the partition is created by its owner.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read directory %q: %w", path, err)
+	}
+	var pws []*partWrapper
+	putPws := func() {
+		for _, pw := range pws {
+			pw.decRef()
+		}
+	}
+	for _, fi := range fis {
+		if !fs.IsDirOrSymlink(fi) {
+			// Skip non-directories.
+			continue
+		}
+		fn := fi.Name()
+		if fn == "tmp" || fn == "txn" || fn == "snapshots" {
+			// Skip special dirs.
+			continue
+		}
+		partPath := path + "/" + fn
+		if pw := existing[partPath]; pw != nil {
+			pw.incRef()
+			pws = append(pws, pw)
+			continue
+		}
+		if fs.IsEmptyDir(partPath) {
+			// The directory may be left after unclean shutdown on NFS. It is removed by the owner of the partition.
+			continue
+		}
+		p, err := openFilePart(partPath)
+		if err != nil {
+			putPws()
+			if !fs.IsPathExist(partPath) {
+				// The part has been removed by a transaction started after reading the list of parts.
+				return nil, errPendingTransactions
+			}
+			return nil, fmt.Errorf("cannot open part %q: %w", partPath, err)
+		}
+		pws = append(pws, &partWrapper{
+			p:        p,
+			refCount: 1,
+		})
+	}
+	return pws, nil
+}
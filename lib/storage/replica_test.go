@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStorageReadOnlyReplica(t *testing.T) {
+	path := "TestStorageReadOnlyReplica"
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+
+	timestamp := time.Now().UnixNano() / 1e6
+	addRows := func(metricsCount, rowsPerMetric int) {
+		t.Helper()
+		var mrs []MetricRow
+		for i := 0; i < metricsCount; i++ {
+			var mn MetricName
+			mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+			mn.AddTag("job", "replica")
+			metricNameRaw := mn.marshalRaw(nil)
+			for j := 0; j < rowsPerMetric; j++ {
+				mrs = append(mrs, MetricRow{
+					MetricNameRaw: metricNameRaw,
+					Timestamp:     timestamp - int64(j)*1000,
+					Value:         float64(j),
+				})
+			}
+		}
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+		// The replica sees only the data flushed to files.
+		s.DebugFlush()
+		s.tb.flushInmemoryPartsToFiles()
+	}
+	addRows(10, 100)
+
+	// Open the replica while the storage is still opened by the owner.
+	readOnlyReplicaOrig := readOnlyReplica
+	replicaRefreshIntervalOrig := replicaRefreshInterval
+	SetReadOnlyReplica(true, time.Hour)
+	defer SetReadOnlyReplica(readOnlyReplicaOrig, replicaRefreshIntervalOrig)
+	r, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open read-only replica: %s", err)
+	}
+	if !r.IsReadOnlyReplica() {
+		t.Fatalf("expecting read-only replica")
+	}
+
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte("job"), []byte("replica"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: timestamp - 3600*1000,
+		MaxTimestamp: timestamp + 3600*1000,
+	}
+	getRowsCount := func() int {
+		t.Helper()
+		var sr Search
+		sr.Init(nil, r, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
+		n := 0
+		for sr.NextMetricBlock() {
+			var b Block
+			sr.MetricBlockRef.BlockRef.MustReadBlock(&b, true)
+			if err := b.UnmarshalData(); err != nil {
+				t.Fatalf("cannot unmarshal block: %s", err)
+			}
+			n += b.RowsCount()
+		}
+		if err := sr.Error(); err != nil {
+			t.Fatalf("unexpected search error: %s", err)
+		}
+		sr.MustClose()
+		return n
+	}
+	waitForRowsCount := func(rowsCountExpected int) {
+		t.Helper()
+		// The owner of the storage path removes transaction files in background,
+		// so the replica may need a few refreshes before it sees the changes.
+		for i := 0; i < 100; i++ {
+			if err := r.refreshReplica(); err != nil {
+				t.Fatalf("cannot refresh replica: %s", err)
+			}
+			if getRowsCount() == rowsCountExpected {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("unexpected rows count; got %d; want %d", getRowsCount(), rowsCountExpected)
+	}
+	waitForRowsCount(10 * 100)
+
+	// The replica must reject writes.
+	var mn MetricName
+	mn.MetricGroup = []byte("foo")
+	mrs := []MetricRow{{
+		MetricNameRaw: mn.marshalRaw(nil),
+		Timestamp:     timestamp,
+	}}
+	if err := r.AddRows(mrs, defaultPrecisionBits); !errors.Is(err, ErrReadOnlyReplica) {
+		t.Fatalf("unexpected error when adding rows to the replica; got %v; want %v", err, ErrReadOnlyReplica)
+	}
+	if _, err := r.DeleteMetrics([]*TagFilters{tfs}); !errors.Is(err, ErrReadOnlyReplica) {
+		t.Fatalf("unexpected error when deleting metrics from the replica; got %v; want %v", err, ErrReadOnlyReplica)
+	}
+	if _, err := r.CreateSnapshot(); !errors.Is(err, ErrReadOnlyReplica) {
+		t.Fatalf("unexpected error when creating snapshot for the replica; got %v; want %v", err, ErrReadOnlyReplica)
+	}
+
+	// The replica must pick up new data and new series after the refresh.
+	addRows(20, 100)
+	waitForRowsCount(10*100 + 20*100)
+
+	// The replica must pick up the indexdb rotation.
+	s.mustRotateIndexDB()
+	timestamp += 1000
+	addRows(20, 1)
+	waitForRowsCount(10*100 + 20*100 + 20)
+	if r.idb().name != s.idb().name {
+		t.Fatalf("unexpected indexdb table name in the replica; got %q; want %q", r.idb().name, s.idb().name)
+	}
+
+	var m Metrics
+	r.UpdateMetrics(&m)
+	if m.ReplicaRefreshes == 0 {
+		t.Fatalf("expecting non-zero replica refreshes")
+	}
+	if m.ReplicaRefreshErrors != 0 {
+		t.Fatalf("unexpected replica refresh errors: %d", m.ReplicaRefreshErrors)
+	}
+
+	r.MustClose()
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
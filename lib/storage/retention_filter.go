@@ -0,0 +1,544 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// RetentionFilter contains retention for time series matching the given label filters.
+type RetentionFilter struct {
+	// Filter is the original series selector such as `{env="dev"}`.
+	Filter string
+
+	// RetentionMsecs is the retention in milliseconds for series matching Filter.
+	RetentionMsecs int64
+
+	tfs *TagFilters
+}
+
+// String returns string representation of rf.
+func (rf *RetentionFilter) String() string {
+	return fmt.Sprintf("%s:%dms", rf.Filter, rf.RetentionMsecs)
+}
+
+// ParseRetentionFilters parses retention filters from a in the format `series_selector:retention`.
+//
+// For example, `{env="dev"}:7d` means that samples for series with env="dev" label must be kept for 7 days.
+func ParseRetentionFilters(a []string) ([]RetentionFilter, error) {
+	var rfs []RetentionFilter
+	for _, s := range a {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+		n := strings.LastIndexByte(s, ':')
+		if n < 0 {
+			return nil, fmt.Errorf("missing ':' in retention filter %q; it must be in the form `series_selector:retention`", s)
+		}
+		filter := strings.TrimSpace(s[:n])
+		tfs, err := parseRetentionFilterSelector(filter)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse series selector in retention filter %q: %w", s, err)
+		}
+		retention, err := promutils.ParseDuration(strings.TrimSpace(s[n+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse retention in retention filter %q: %w", s, err)
+		}
+		if retention <= 0 {
+			return nil, fmt.Errorf("retention must be positive in retention filter %q", s)
+		}
+		rfs = append(rfs, RetentionFilter{
+			Filter:         filter,
+			RetentionMsecs: retention.Milliseconds(),
+			tfs:            tfs,
+		})
+	}
+	return rfs, nil
+}
+
+func parseRetentionFilterSelector(s string) (*TagFilters, error) {
+	expr, err := metricsql.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	me, ok := expr.(*metricsql.MetricExpr)
+	if !ok {
+		return nil, fmt.Errorf("expecting series selector; got %q", expr.AppendString(nil))
+	}
+	if len(me.LabelFilters) == 0 {
+		return nil, fmt.Errorf("label filters cannot be empty")
+	}
+	tfs := NewTagFilters()
+	for _, lf := range me.LabelFilters {
+		var key []byte
+		if lf.Label != "__name__" {
+			key = []byte(lf.Label)
+		}
+		if err := tfs.Add(key, []byte(lf.Value), lf.IsNegative, lf.IsRegexp); err != nil {
+			return nil, fmt.Errorf("cannot parse label filter %s: %w", lf.AppendString(nil), err)
+		}
+	}
+	return tfs, nil
+}
+
+// SetRetentionFilters sets retention filters, which are applied to the matching series
+// during background merges.
+//
+// The first matching filter wins if a series matches multiple filters.
+// Retention filters cannot increase the retention beyond the retention passed to OpenStorage.
+//
+// This function must be called before initializing the storage.
+func SetRetentionFilters(rfs []RetentionFilter) {
+	globalRetentionFilters = append([]RetentionFilter{}, rfs...)
+}
+
+var globalRetentionFilters []RetentionFilter
+
+func isRetentionFiltersEnabled() bool {
+	return len(globalRetentionFilters) > 0
+}
+
+// getRetentionFiltersKey returns a string, which uniquely identifies the configured retention filters.
+func getRetentionFiltersKey() string {
+	a := make([]string, len(globalRetentionFilters))
+	for i := range globalRetentionFilters {
+		a[i] = globalRetentionFilters[i].String()
+	}
+	return strings.Join(a, ",")
+}
+
+// retentionFilterMetricIDs contains metricIDs for series matching retention filters.
+type retentionFilterMetricIDs struct {
+	// retentionsMsecs contains retention in milliseconds for every retention filter.
+	retentionsMsecs []int64
+
+	// metricIDs contains metricIDs matching every retention filter.
+	//
+	// The sets mustn't be modified after rfm creation.
+	metricIDs []*uint64set.Set
+
+	// newMetricIDsLock protects newMetricIDs.
+	newMetricIDsLock sync.Mutex
+
+	// newMetricIDs contains metricIDs matching every retention filter, which have been registered after rfm creation.
+	newMetricIDs []*uint64set.Set
+}
+
+// addNewMetricID adds metricID for the series matching the retention filter with the given idx to rfm.
+func (rfm *retentionFilterMetricIDs) addNewMetricID(idx int, metricID uint64) {
+	rfm.newMetricIDsLock.Lock()
+	for idx >= len(rfm.newMetricIDs) {
+		rfm.newMetricIDs = append(rfm.newMetricIDs, nil)
+	}
+	if rfm.newMetricIDs[idx] == nil {
+		rfm.newMetricIDs[idx] = &uint64set.Set{}
+	}
+	rfm.newMetricIDs[idx].Add(metricID)
+	rfm.newMetricIDsLock.Unlock()
+}
+
+// getNewMetricIDs returns a copy of metricIDs registered in rfm for the retention filter with the given idx.
+//
+// nil is returned if there are no such metricIDs.
+func (rfm *retentionFilterMetricIDs) getNewMetricIDs(idx int) *uint64set.Set {
+	rfm.newMetricIDsLock.Lock()
+	defer rfm.newMetricIDsLock.Unlock()
+	if idx >= len(rfm.newMetricIDs) || rfm.newMetricIDs[idx] == nil {
+		return nil
+	}
+	return rfm.newMetricIDs[idx].Clone()
+}
+
+// retentionDeadlines contains per-series retention deadlines in milliseconds for a merge.
+type retentionDeadlines struct {
+	// deadline is the retention deadline for series without matching retention filters.
+	deadline int64
+
+	filterDeadlines    []int64
+	filterMetricIDs    []*uint64set.Set
+	filterNewMetricIDs []*uint64set.Set
+}
+
+func newRetentionDeadlines(rfm *retentionFilterMetricIDs, currentTimestamp, deadline int64) *retentionDeadlines {
+	rds := &retentionDeadlines{
+		deadline: deadline,
+	}
+	if rfm == nil {
+		return rds
+	}
+	for i, metricIDs := range rfm.metricIDs {
+		d := currentTimestamp - rfm.retentionsMsecs[i]
+		if d < deadline {
+			d = deadline
+		}
+		rds.filterDeadlines = append(rds.filterDeadlines, d)
+		rds.filterMetricIDs = append(rds.filterMetricIDs, metricIDs)
+		rds.filterNewMetricIDs = append(rds.filterNewMetricIDs, rfm.getNewMetricIDs(i))
+	}
+	return rds
+}
+
+// get returns retention deadline for the given metricID.
+//
+// Zero is returned if rds is nil, e.g. samples mustn't be dropped because of retention.
+func (rds *retentionDeadlines) get(metricID uint64) int64 {
+	if rds == nil {
+		return 0
+	}
+	for i, metricIDs := range rds.filterMetricIDs {
+		if metricIDs.Has(metricID) {
+			return rds.filterDeadlines[i]
+		}
+		if newMetricIDs := rds.filterNewMetricIDs[i]; newMetricIDs != nil && newMetricIDs.Has(metricID) {
+			return rds.filterDeadlines[i]
+		}
+	}
+	return rds.deadline
+}
+
+// applyRetentionFilters registers metricID for the series with the given mn in the first matching retention filter.
+//
+// It must be called when the series is registered in the storage, so the retention filters apply to it
+// before the next update of retention filter metricIDs.
+func (s *Storage) applyRetentionFilters(metricID uint64, mn *MetricName) {
+	if !isRetentionFiltersEnabled() {
+		return
+	}
+	idx, err := getMatchingRetentionFilterIdx(mn)
+	if err != nil {
+		logger.Errorf("cannot match series %s against retention filters: %s", mn, err)
+		return
+	}
+	if idx < 0 {
+		return
+	}
+	s.retentionFilterMetricIDsLock.Lock()
+	s.getRetentionFilterMetricIDs().addNewMetricID(idx, metricID)
+	s.retentionFilterMetricIDsLock.Unlock()
+}
+
+// getMatchingRetentionFilterIdx returns the index of the first retention filter matching mn.
+//
+// -1 is returned if mn doesn't match any retention filter.
+func getMatchingRetentionFilterIdx(mn *MetricName) (int, error) {
+	var kb bytesutil.ByteBuffer
+	var tfs []*tagFilter
+	for i := range globalRetentionFilters {
+		tfs = tfs[:0]
+		for j := range globalRetentionFilters[i].tfs.tfs {
+			tfs = append(tfs, &globalRetentionFilters[i].tfs.tfs[j])
+		}
+		ok, err := matchTagFilters(mn, tfs, &kb)
+		if err != nil {
+			return -1, err
+		}
+		if ok {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func (s *Storage) getRetentionFilterMetricIDs() *retentionFilterMetricIDs {
+	return s.retentionFilterMetricIDs.Load().(*retentionFilterMetricIDs)
+}
+
+var retentionFiltersUpdateInterval = 5 * time.Minute
+
+func (s *Storage) startRetentionFiltersWatcher() {
+	if !isRetentionFiltersEnabled() {
+		return
+	}
+	s.retentionFiltersWatcherWG.Add(1)
+	go func() {
+		s.retentionFiltersWatcher()
+		s.retentionFiltersWatcherWG.Done()
+	}()
+}
+
+func (s *Storage) retentionFiltersWatcher() {
+	ticker := time.NewTicker(retentionFiltersUpdateInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.updateRetentionFilterMetricIDs(); err != nil {
+			logger.Errorf("cannot update metricIDs for retention filters: %s", err)
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// retentionFiltersFullUpdateInterval is the interval between full updates of metricIDs for retention filters.
+//
+// Other updates search only for series registered since the previous update.
+var retentionFiltersFullUpdateInterval = 24 * time.Hour
+
+// updateRetentionFilterMetricIDs updates metricIDs for the configured retention filters.
+//
+// The full update searches for series on the whole retention and deletes series without samples inside
+// their retention from the indexdb. Other updates search only for series on the dates since the previous update
+// and add them to the existing metricIDs.
+func (s *Storage) updateRetentionFilterMetricIDs() error {
+	currentTimestamp := int64(fasttime.UnixTimestamp()) * 1000
+	prevRFM := s.getRetentionFilterMetricIDs()
+	var rfm *retentionFilterMetricIDs
+	var expiredMetricIDs []uint64
+	isFullUpdate := len(prevRFM.metricIDs) != len(globalRetentionFilters) ||
+		currentTimestamp-atomic.LoadInt64(&s.retentionFiltersFullUpdateTimestamp) >= retentionFiltersFullUpdateInterval.Milliseconds()
+	if isFullUpdate {
+		var err error
+		rfm, expiredMetricIDs, err = s.searchRetentionFilterMetricIDs(currentTimestamp)
+		if err != nil {
+			return err
+		}
+	} else {
+		// The previous update could miss series registered on the previous day in the per-day index.
+		tr := TimeRange{
+			MinTimestamp: atomic.LoadInt64(&s.retentionFiltersUpdateTimestamp) - msecPerDay,
+			MaxTimestamp: currentTimestamp + msecPerDay,
+		}
+		rfm = &retentionFilterMetricIDs{}
+		for i := range globalRetentionFilters {
+			rf := &globalRetentionFilters[i]
+			metricIDs, err := s.searchMetricIDsOnTimeRange([]*TagFilters{rf.tfs}, tr)
+			if err != nil {
+				return fmt.Errorf("cannot search new series for retention filter %s: %w", rf, err)
+			}
+			metricIDs.Union(prevRFM.metricIDs[i])
+			rfm.retentionsMsecs = append(rfm.retentionsMsecs, prevRFM.retentionsMsecs[i])
+			rfm.metricIDs = append(rfm.metricIDs, metricIDs)
+		}
+	}
+
+	// Carry over metricIDs registered since the previous update, since they may be missing in the search results.
+	s.retentionFilterMetricIDsLock.Lock()
+	prevRFM = s.getRetentionFilterMetricIDs()
+	for i, metricIDs := range rfm.metricIDs {
+		if newMetricIDs := prevRFM.getNewMetricIDs(i); newMetricIDs != nil {
+			metricIDs.UnionMayOwn(newMetricIDs)
+		}
+	}
+	s.retentionFilterMetricIDs.Store(rfm)
+	s.retentionFilterMetricIDsLock.Unlock()
+
+	atomic.StoreInt64(&s.retentionFiltersUpdateTimestamp, currentTimestamp)
+	if isFullUpdate {
+		atomic.StoreInt64(&s.retentionFiltersFullUpdateTimestamp, currentTimestamp)
+	}
+	if len(expiredMetricIDs) == 0 {
+		return nil
+	}
+	if err := s.idb().deleteMetricIDs(expiredMetricIDs); err != nil {
+		return fmt.Errorf("cannot delete %d series outside retention filters: %w", len(expiredMetricIDs), err)
+	}
+	logger.Infof("deleted %d series without samples inside the retention configured via retention filters", len(expiredMetricIDs))
+	return nil
+}
+
+// searchRetentionFilterMetricIDs searches for metricIDs matching the configured retention filters on the whole retention.
+//
+// It also returns metricIDs for series without samples inside their retention.
+func (s *Storage) searchRetentionFilterMetricIDs(currentTimestamp int64) (*retentionFilterMetricIDs, []uint64, error) {
+	trAll := TimeRange{
+		MinTimestamp: 0,
+		MaxTimestamp: (1 << 63) - 1,
+	}
+	hmCurr := s.currHourMetricIDs.Load().(*hourMetricIDs)
+	hmPrev := s.prevHourMetricIDs.Load().(*hourMetricIDs)
+	rfm := &retentionFilterMetricIDs{}
+	var expiredMetricIDs []uint64
+	for i := range globalRetentionFilters {
+		rf := &globalRetentionFilters[i]
+		retentionMsecs := rf.RetentionMsecs
+		if retentionMsecs > s.retentionMsecs {
+			retentionMsecs = s.retentionMsecs
+		}
+		metricIDs, err := s.searchMetricIDsOnTimeRange([]*TagFilters{rf.tfs}, trAll)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot search series for retention filter %s: %w", rf, err)
+		}
+		// Series with samples inside the retention must be kept in the indexdb.
+		tr := TimeRange{
+			MinTimestamp: currentTimestamp - retentionMsecs,
+			MaxTimestamp: currentTimestamp,
+		}
+		liveMetricIDs, err := s.searchMetricIDsOnTimeRange([]*TagFilters{rf.tfs}, tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot search live series for retention filter %s: %w", rf, err)
+		}
+		metricIDs.ForEach(func(part []uint64) bool {
+			for _, metricID := range part {
+				if liveMetricIDs.Has(metricID) || hmCurr.m.Has(metricID) || hmPrev.m.Has(metricID) {
+					continue
+				}
+				if rfm.hasMetricID(metricID) {
+					// The series matches preceding retention filter.
+					continue
+				}
+				expiredMetricIDs = append(expiredMetricIDs, metricID)
+			}
+			return true
+		})
+		rfm.retentionsMsecs = append(rfm.retentionsMsecs, retentionMsecs)
+		rfm.metricIDs = append(rfm.metricIDs, metricIDs)
+	}
+	return rfm, expiredMetricIDs, nil
+}
+
+func (rfm *retentionFilterMetricIDs) hasMetricID(metricID uint64) bool {
+	for _, metricIDs := range rfm.metricIDs {
+		if metricIDs.Has(metricID) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchMetricIDsOnTimeRange returns metricIDs matching tfss on the given tr in both the current and the previous indexdb.
+func (s *Storage) searchMetricIDsOnTimeRange(tfss []*TagFilters, tr TimeRange) (*uint64set.Set, error) {
+	m := &uint64set.Set{}
+	search := func(db *indexDB) error {
+		is := db.getIndexSearch(noDeadline)
+		metricIDs, err := is.searchMetricIDs(tfss, tr, 2e9)
+		db.putIndexSearch(is)
+		if err != nil {
+			return err
+		}
+		m.AddMulti(metricIDs)
+		return nil
+	}
+	idb := s.idb()
+	if err := search(idb); err != nil {
+		return nil, err
+	}
+	var err error
+	idb.doExtDB(func(extDB *indexDB) {
+		err = search(extDB)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot search in the previous indexdb: %w", err)
+	}
+	return m, nil
+}
+
+// retentionFiltersMergeInterval is the minimum interval between retention filters merges for a partition,
+// which contains samples on both sides of the retention filter deadline.
+var retentionFiltersMergeInterval = 24 * time.Hour
+
+// runRetentionFiltersMerge merges parts in pt, which contain samples that became outside the retention
+// for some of retention filters since the previous run.
+//
+// This removes samples outside retention filters from partitions, which aren't merged anymore in background.
+func (pt *partition) runRetentionFiltersMerge() error {
+	if !isRetentionFiltersEnabled() {
+		return nil
+	}
+	rfm := pt.getRetentionFilterMetricIDs()
+	if rfm == nil || len(rfm.metricIDs) == 0 {
+		// Metricids for retention filters aren't known yet.
+		return nil
+	}
+	currentTimestamp := int64(fasttime.UnixTimestamp()) * 1000
+	key := getRetentionFiltersKey()
+	prevTimestamp := pt.readRetentionFiltersMergeTimestamp(key)
+	if !needRetentionFiltersMerge(pt.tr, rfm.retentionsMsecs, prevTimestamp, currentTimestamp) {
+		return nil
+	}
+	t := time.Now()
+	logger.Infof("starting retention filters merge for partition %s", pt.bigPartsPath)
+	// Parts, which are merged at the moment, are skipped, since the merged parts are created with the current retention filters.
+	ok, err := pt.mergeMatchingParts(func(pw *partWrapper) bool {
+		return hasExpiredSamples(msecsTimeRange(pw.p.ph.MinTimestamp, pw.p.ph.MaxTimestamp), rfm.retentionsMsecs, prevTimestamp, currentTimestamp)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot apply retention filters to partition %s: %w", pt.bigPartsPath, err)
+	}
+	if !ok {
+		logger.Infof("postponing retention filters merge for partition %s, since it cannot be started now", pt.bigPartsPath)
+		return nil
+	}
+	if err := pt.writeRetentionFiltersMergeTimestamp(key, currentTimestamp); err != nil {
+		return err
+	}
+	logger.Infof("retention filters merge for partition %s has been finished in %.3f seconds", pt.bigPartsPath, time.Since(t).Seconds())
+	return nil
+}
+
+// needRetentionFiltersMerge returns true if the partition with the given tr contains samples,
+// which became outside some of retentionsMsecs between prevTimestamp and currentTimestamp.
+//
+// The partition, which still contains samples inside the retention, is merged at most once per retentionFiltersMergeInterval,
+// while the partition, which became fully outside the retention, is merged immediately.
+func needRetentionFiltersMerge(tr TimeRange, retentionsMsecs []int64, prevTimestamp, currentTimestamp int64) bool {
+	mergeIntervalPassed := currentTimestamp-prevTimestamp >= retentionFiltersMergeInterval.Milliseconds()
+	for _, retentionMsecs := range retentionsMsecs {
+		if !hasExpiredSamples(tr, []int64{retentionMsecs}, prevTimestamp, currentTimestamp) {
+			// The partition has no samples, which became outside the retention since the previous merge.
+			continue
+		}
+		if tr.MaxTimestamp < currentTimestamp-retentionMsecs || mergeIntervalPassed {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExpiredSamples returns true if tr contains samples, which became outside some of retentionsMsecs
+// between prevTimestamp and currentTimestamp.
+func hasExpiredSamples(tr TimeRange, retentionsMsecs []int64, prevTimestamp, currentTimestamp int64) bool {
+	for _, retentionMsecs := range retentionsMsecs {
+		deadline := currentTimestamp - retentionMsecs
+		prevDeadline := prevTimestamp - retentionMsecs
+		if tr.MinTimestamp < deadline && tr.MaxTimestamp >= prevDeadline {
+			return true
+		}
+	}
+	return false
+}
+
+// readRetentionFiltersMergeTimestamp returns the timestamp of the last retention filters merge for pt with the given key.
+//
+// Zero is returned if retention filters merge wasn't performed for pt with the given key.
+func (pt *partition) readRetentionFiltersMergeTimestamp(key string) int64 {
+	filePath := pt.bigPartsPath + "/retention_filters_merge"
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return 0
+	}
+	n := strings.IndexByte(string(data), '\n')
+	if n < 0 || string(data[n+1:]) != key {
+		// Retention filters have been changed since the last merge.
+		return 0
+	}
+	timestamp, err := strconv.ParseInt(string(data[:n]), 10, 64)
+	if err != nil {
+		logger.Errorf("cannot parse timestamp from %q: %s", filePath, err)
+		return 0
+	}
+	return timestamp
+}
+
+func (pt *partition) writeRetentionFiltersMergeTimestamp(key string, timestamp int64) error {
+	filePath := pt.bigPartsPath + "/retention_filters_merge"
+	data := fmt.Sprintf("%d\n%s", timestamp, key)
+	if err := fs.ReplaceFileAtomically(filePath, []byte(data)); err != nil {
+		return fmt.Errorf("cannot create %q: %w", filePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+)
+
+func TestParseRetentionFiltersSuccess(t *testing.T) {
+	f := func(a []string, resultExpected string) {
+		t.Helper()
+		rfs, err := ParseRetentionFilters(a)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var result []string
+		for i := range rfs {
+			result = append(result, rfs[i].String()+" "+rfs[i].tfs.String())
+		}
+		if s := fmt.Sprintf("%q", result); s != resultExpected {
+			t.Fatalf("unexpected retention filters for %q;\ngot\n%s\nwant\n%s", a, s, resultExpected)
+		}
+	}
+	f(nil, `[]`)
+	f([]string{`{env="dev"}:7d`}, `["{env=\"dev\"}:604800000ms {env=\"dev\"}"]`)
+	f([]string{` foo{env=~"dev|staging"} : 1h `, `{job!="x"}:30d`},
+		`["foo{env=~\"dev|staging\"}:3600000ms {__name__=\"foo\", env=~\"dev|staging\"}" "{job!=\"x\"}:2592000000ms {job!=\"x\"}"]`)
+}
+
+func TestParseRetentionFiltersFailure(t *testing.T) {
+	f := func(a []string) {
+		t.Helper()
+		rfs, err := ParseRetentionFilters(a)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q; got %v", a, rfs)
+		}
+	}
+	// Missing colon
+	f([]string{`{env="dev"}`})
+	// Invalid selector
+	f([]string{`{env="dev":7d`})
+	f([]string{`sum(foo):7d`})
+	f([]string{`{}:7d`})
+	// Invalid retention
+	f([]string{`{env="dev"}:foo`})
+	f([]string{`{env="dev"}:0s`})
+}
+
+func TestRetentionDeadlinesGet(t *testing.T) {
+	var rds *retentionDeadlines
+	if d := rds.get(123); d != 0 {
+		t.Fatalf("unexpected deadline for nil retentionDeadlines; got %d; want 0", d)
+	}
+
+	var m1, m2 uint64set.Set
+	m1.Add(1)
+	m1.Add(3)
+	m2.Add(2)
+	m2.Add(3)
+	rfm := &retentionFilterMetricIDs{
+		retentionsMsecs: []int64{100, 2000},
+		metricIDs:       []*uint64set.Set{&m1, &m2},
+	}
+	rfm.addNewMetricID(0, 5)
+	rds = newRetentionDeadlines(rfm, 1000, 500)
+	f := func(metricID uint64, deadlineExpected int64) {
+		t.Helper()
+		if d := rds.get(metricID); d != deadlineExpected {
+			t.Fatalf("unexpected deadline for metricID=%d; got %d; want %d", metricID, d, deadlineExpected)
+		}
+	}
+	f(1, 900)
+	// The first matching filter wins
+	f(3, 900)
+	// Retention filters cannot extend the retention
+	f(2, 500)
+	// The default deadline
+	f(4, 500)
+	// The series registered after rfm creation
+	f(5, 900)
+}
+
+func TestNeedRetentionFiltersMerge(t *testing.T) {
+	day := int64(24 * 3600 * 1000)
+	retentionsMsecs := []int64{7 * day}
+	tr := TimeRange{
+		MinTimestamp: 100 * day,
+		MaxTimestamp: 130 * day,
+	}
+	f := func(prevTimestamp, currentTimestamp int64, resultExpected bool) {
+		t.Helper()
+		result := needRetentionFiltersMerge(tr, retentionsMsecs, prevTimestamp, currentTimestamp)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for prevTimestamp=%d, currentTimestamp=%d; got %v; want %v", prevTimestamp, currentTimestamp, result, resultExpected)
+		}
+	}
+
+	// The partition has no samples outside the retention
+	f(0, 105*day, false)
+
+	// The partition contains samples outside the retention, while the previous merge wasn't performed
+	f(0, 110*day, true)
+
+	// The partition contains samples outside the retention, while the previous merge was performed recently
+	f(110*day, 110*day+3600*1000, false)
+
+	// The partition contains new samples outside the retention since the merge performed a day ago
+	f(110*day, 111*day, true)
+
+	// The partition became fully outside the retention since the recent merge
+	f(137*day, 137*day+3600*1000, true)
+
+	// The partition was already merged after it became fully outside the retention
+	f(138*day, 150*day, false)
+}
+
+func TestHasExpiredSamples(t *testing.T) {
+	day := int64(24 * 3600 * 1000)
+	retentionsMsecs := []int64{30 * day, 7 * day}
+	f := func(minTimestamp, maxTimestamp, prevTimestamp, currentTimestamp int64, resultExpected bool) {
+		t.Helper()
+		tr := TimeRange{
+			MinTimestamp: minTimestamp,
+			MaxTimestamp: maxTimestamp,
+		}
+		result := hasExpiredSamples(tr, retentionsMsecs, prevTimestamp, currentTimestamp)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for tr=%s, prevTimestamp=%d, currentTimestamp=%d; got %v; want %v", &tr, prevTimestamp, currentTimestamp, result, resultExpected)
+		}
+	}
+
+	// The part contains only samples inside all the retentions
+	f(105*day, 110*day, 100*day, 111*day, false)
+
+	// The part contains samples, which became outside the shortest retention
+	f(102*day, 110*day, 100*day, 111*day, true)
+
+	// The part contains samples, which were already outside the retention at the previous merge
+	f(90*day, 92*day, 100*day, 111*day, false)
+
+	// The part contains samples, which became outside the longest retention only
+	f(75*day, 80*day, 100*day, 111*day, true)
+}
+
+func TestStorageUpdateRetentionFilterMetricIDs(t *testing.T) {
+	rfs, err := ParseRetentionFilters([]string{`{env="dev"}:7d`})
+	if err != nil {
+		t.Fatalf("cannot parse retention filters: %s", err)
+	}
+	SetRetentionFilters(rfs)
+	defer SetRetentionFilters(nil)
+
+	path := "TestStorageUpdateRetentionFilterMetricIDs"
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	now := time.Now().UnixNano() / 1e6
+	addRow := func(name, env string, timestamp int64) {
+		t.Helper()
+		var mn MetricName
+		mn.MetricGroup = []byte(name)
+		mn.AddTag("env", env)
+		mr := MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     timestamp,
+			Value:         1,
+		}
+		if err := s.AddRows([]MetricRow{mr}, defaultPrecisionBits); err != nil {
+			t.Fatalf("cannot add row: %s", err)
+		}
+	}
+	addRow("expired", "dev", now-30*msecPerDay)
+	addRow("live", "dev", now-2*msecPerDay)
+	addRow("expired", "prod", now-30*msecPerDay)
+	s.DebugFlush()
+
+	// Force the full update, since the storage may already perform the update on start.
+	atomic.StoreInt64(&s.retentionFiltersFullUpdateTimestamp, 0)
+	if err := s.updateRetentionFilterMetricIDs(); err != nil {
+		t.Fatalf("cannot update retention filter metricIDs: %s", err)
+	}
+	rfm := s.getRetentionFilterMetricIDs()
+	if len(rfm.metricIDs) != 1 {
+		t.Fatalf("unexpected number of retention filter metricIDs; got %d; want 1", len(rfm.metricIDs))
+	}
+	if n := rfm.metricIDs[0].Len(); n != 2 {
+		t.Fatalf("unexpected number of metricIDs for the retention filter; got %d; want 2", n)
+	}
+
+	// Verify that only the expired dev series has been deleted.
+	f := func(name, env string, countExpected int) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte(name), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		if err := tfs.Add([]byte("env"), []byte(env), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		metricIDs, err := s.searchMetricIDsOnTimeRange([]*TagFilters{tfs}, TimeRange{MinTimestamp: 0, MaxTimestamp: (1 << 63) - 1})
+		if err != nil {
+			t.Fatalf("cannot search metricIDs: %s", err)
+		}
+		if n := metricIDs.Len(); n != countExpected {
+			t.Fatalf("unexpected number of series for %s{env=%q}; got %d; want %d", name, env, n, countExpected)
+		}
+	}
+	f("expired", "dev", 0)
+	f("live", "dev", 1)
+	f("expired", "prod", 1)
+
+	// Verify that the retention filter applies to the series registered after the update.
+	addRow("new", "dev", now)
+	s.DebugFlush()
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("new"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	metricIDs, err := s.searchMetricIDsOnTimeRange([]*TagFilters{tfs}, TimeRange{MinTimestamp: 0, MaxTimestamp: (1 << 63) - 1})
+	if err != nil {
+		t.Fatalf("cannot search metricIDs: %s", err)
+	}
+	if n := metricIDs.Len(); n != 1 {
+		t.Fatalf("unexpected number of series for new{env=\"dev\"}; got %d; want 1", n)
+	}
+	metricID := metricIDs.AppendTo(nil)[0]
+	rds := newRetentionDeadlines(s.getRetentionFilterMetricIDs(), now, 0)
+	if d, dExpected := rds.get(metricID), now-7*msecPerDay; d != dExpected {
+		t.Fatalf("unexpected deadline for the new series; got %d; want %d", d, dExpected)
+	}
+
+	// Verify that the incremental update keeps both the existing and the new series.
+	if err := s.updateRetentionFilterMetricIDs(); err != nil {
+		t.Fatalf("cannot update retention filter metricIDs: %s", err)
+	}
+	rfm = s.getRetentionFilterMetricIDs()
+	if n := rfm.metricIDs[0].Len(); n != 3 {
+		t.Fatalf("unexpected number of metricIDs for the retention filter after the incremental update; got %d; want 3", n)
+	}
+	if !rfm.metricIDs[0].Has(metricID) {
+		t.Fatalf("missing metricID for the new series after the incremental update")
+	}
+}
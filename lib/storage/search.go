@@ -3,11 +3,13 @@ package storage
 import (
 	"fmt"
 	"io"
+	"sync/atomic"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storagepacelimiter"
 )
 
@@ -18,11 +20,15 @@ import (
 type BlockRef struct {
 	p  *part
 	bh blockHeader
+
+	// tss contains tombstones, which apply to the part the block belongs to.
+	tss *tombstones
 }
 
 func (br *BlockRef) reset() {
 	br.p = nil
 	br.bh = blockHeader{}
+	br.tss = nil
 }
 
 func (br *BlockRef) init(p *part, bh *blockHeader) {
@@ -33,6 +39,7 @@ func (br *BlockRef) init(p *part, bh *blockHeader) {
 // Init initializes br from pr and data
 func (br *BlockRef) Init(pr PartRef, data []byte) error {
 	br.p = pr.p
+	br.tss = pr.tss
 	tail, err := br.bh.Unmarshal(data)
 	if err != nil {
 		return err
@@ -56,13 +63,15 @@ func (br *BlockRef) RowsCount() int {
 // PartRef returns PartRef from br.
 func (br *BlockRef) PartRef() PartRef {
 	return PartRef{
-		p: br.p,
+		p:   br.p,
+		tss: br.tss,
 	}
 }
 
 // PartRef is Part reference.
 type PartRef struct {
-	p *part
+	p   *part
+	tss *tombstones
 }
 
 // MustReadBlock reads block from br to dst.
@@ -74,6 +83,8 @@ func (br *BlockRef) MustReadBlock(dst *Block, fetchData bool) {
 	if !fetchData {
 		return
 	}
+	tr := msecsTimeRange(br.bh.MinTimestamp, br.bh.MaxTimestamp)
+	dst.deletedRanges = br.tss.appendTimeRanges(dst.deletedRanges[:0], br.bh.TSID.MetricID, tr)
 
 	dst.timestampsData = bytesutil.ResizeNoCopyMayOverallocate(dst.timestampsData, int(br.bh.TimestampsBlockSize))
 	br.p.timestampsFile.MustReadAt(dst.timestampsData, int64(br.bh.TimestampsBlockOffset))
@@ -109,6 +120,9 @@ type Search struct {
 	// deadline in unix timestamp seconds for the current search.
 	deadline uint64
 
+	// canceled is an optional flag, which is set to non-zero when the current search is canceled.
+	canceled *uint32
+
 	err error
 
 	needClosing bool
@@ -127,6 +141,7 @@ func (s *Search) reset() {
 	s.tr = TimeRange{}
 	s.tfss = nil
 	s.deadline = 0
+	s.canceled = nil
 	s.err = nil
 	s.needClosing = false
 	s.loops = 0
@@ -138,7 +153,9 @@ func (s *Search) reset() {
 // MustClose must be called when the search is done.
 //
 // Init returns the upper bound on the number of found time series.
-func (s *Search) Init(storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) int {
+func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, canceled *uint32) int {
+	qt = qt.NewChild("init series search: filters=%s, timeRange=%s", tfss, &tr)
+	defer qt.Done()
 	if s.needClosing {
 		logger.Panicf("BUG: missing MustClose call before the next call to Init")
 	}
@@ -147,11 +164,12 @@ func (s *Search) Init(storage *Storage, tfss []*TagFilters, tr TimeRange, maxMet
 	s.tr = tr
 	s.tfss = tfss
 	s.deadline = deadline
+	s.canceled = canceled
 	s.needClosing = true
 
-	tsids, err := storage.searchTSIDs(tfss, tr, maxMetrics, deadline)
+	tsids, err := storage.searchTSIDs(qt, tfss, tr, maxMetrics, deadline, canceled)
 	if err == nil {
-		err = storage.prefetchMetricNames(tsids, deadline)
+		err = storage.prefetchMetricNames(qt, tsids, deadline, canceled)
 	}
 	// It is ok to call Init on error from storage.searchTSIDs.
 	// Init must be called before returning because it will fail
@@ -191,7 +209,7 @@ func (s *Search) NextMetricBlock() bool {
 	}
 	for s.ts.NextBlock() {
 		if s.loops&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(s.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(s.deadline, s.canceled); err != nil {
 				s.err = err
 				return false
 			}
@@ -393,8 +411,10 @@ func (sq *SearchQuery) Unmarshal(src []byte) ([]byte, error) {
 	return src, nil
 }
 
-func checkSearchDeadlineAndPace(deadline uint64) error {
-	if fasttime.UnixTimestamp() > deadline {
+// checkSearchDeadlineAndPace returns ErrDeadlineExceeded if the deadline is exceeded
+// or if the search is canceled via the optional canceled flag.
+func checkSearchDeadlineAndPace(deadline uint64, canceled *uint32) error {
+	if fasttime.UnixTimestamp() > deadline || (canceled != nil && atomic.LoadUint32(canceled) != 0) {
 		return ErrDeadlineExceeded
 	}
 	storagepacelimiter.Search.WaitIfNeeded()
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -160,6 +161,24 @@ func TestSearch(t *testing.T) {
 			t.Fatalf("unexpected error: %s", firstError)
 		}
 	})
+
+	t.Run("canceled", func(t *testing.T) {
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric_1.*"), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		canceled := uint32(1)
+		var s Search
+		s.Init(nil, st, []*TagFilters{tfs}, tr, 1e5, noDeadline, &canceled)
+		for s.NextMetricBlock() {
+			t.Fatalf("unexpected block returned from the canceled search")
+		}
+		err := s.Error()
+		s.MustClose()
+		if !errors.Is(err, ErrDeadlineExceeded) {
+			t.Fatalf("unexpected error for the canceled search; got %v; want %v", err, ErrDeadlineExceeded)
+		}
+	})
 }
 
 func testSearchInternal(st *Storage, tr TimeRange, mrs []MetricRow, accountsCount int) error {
@@ -202,7 +221,7 @@ func testSearchInternal(st *Storage, tr TimeRange, mrs []MetricRow, accountsCoun
 		}
 
 		// Search
-		s.Init(st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		s.Init(nil, st, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
 		var mbs []metricBlock
 		for s.NextMetricBlock() {
 			var b Block
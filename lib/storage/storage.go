@@ -24,6 +24,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storagepacelimiter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
@@ -50,6 +51,12 @@ type Storage struct {
 	searchTSIDsConcurrencyLimitReached uint64
 	searchTSIDsConcurrencyLimitTimeout uint64
 
+	// retentionFiltersUpdateTimestamp is the timestamp in milliseconds for the last update of retentionFilterMetricIDs.
+	retentionFiltersUpdateTimestamp int64
+
+	// retentionFiltersFullUpdateTimestamp is the timestamp in milliseconds for the last full update of retentionFilterMetricIDs.
+	retentionFiltersFullUpdateTimestamp int64
+
 	slowRowInserts         uint64
 	slowPerDayIndexInserts uint64
 	slowMetricNameLoads    uint64
@@ -57,6 +64,9 @@ type Storage struct {
 	hourlySeriesLimitRowsDropped uint64
 	dailySeriesLimitRowsDropped  uint64
 
+	replicaRefreshes     uint64
+	replicaRefreshErrors uint64
+
 	path           string
 	cachePath      string
 	retentionMsecs int64
@@ -84,12 +94,27 @@ type Storage struct {
 	// dateMetricIDCache is (Date, MetricID) cache.
 	dateMetricIDCache *dateMetricIDCache
 
+	// exemplars contains the most recent exemplars per each time series.
+	exemplars *exemplarStore
+
+	// metricNamesStats contains query stats per metric name. See SetTrackMetricNamesStats.
+	metricNamesStats *metricNamesStats
+
+	// metricMetadata contains metric metadata such as HELP, TYPE and UNIT keyed by metric family name.
+	metricMetadata *metricMetadataIndex
+
+	// wal is write-ahead log for added rows. It is nil if WAL is disabled via SetWAL.
+	wal *wal
+
 	// Fast cache for MetricID values occurred during the current hour.
 	currHourMetricIDs atomic.Value
 
 	// Fast cache for MetricID values occurred during the previous hour.
 	prevHourMetricIDs atomic.Value
 
+	// lastHourChurn contains series churn for the last finished hour.
+	lastHourChurn atomic.Value
+
 	// Fast cache for pre-populating per-day inverted index for the next day.
 	// This is needed in order to remove CPU usage spikes at 00:00 UTC
 	// due to creation of per-day inverted index for active time series.
@@ -118,7 +143,18 @@ type Storage struct {
 	currHourMetricIDsUpdaterWG sync.WaitGroup
 	nextDayMetricIDsUpdaterWG  sync.WaitGroup
 	retentionWatcherWG         sync.WaitGroup
+	retentionFiltersWatcherWG  sync.WaitGroup
 	freeDiskSpaceWatcherWG     sync.WaitGroup
+	walWatcherWG               sync.WaitGroup
+	metricNamesStatsSaverWG    sync.WaitGroup
+	replicaRefresherWG         sync.WaitGroup
+	hotBlocksPrewarmerWG       sync.WaitGroup
+
+	// isReadOnlyReplica is set if the storage is opened in read-only replica mode. See SetReadOnlyReplica.
+	isReadOnlyReplica bool
+
+	// replicaRefreshLock serializes refreshes for the storage opened in read-only replica mode.
+	replicaRefreshLock sync.Mutex
 
 	// The snapshotLock prevents from concurrent creation of snapshots,
 	// since this may result in snapshots without recently added data,
@@ -136,6 +172,14 @@ type Storage struct {
 	deletedMetricIDs           atomic.Value
 	deletedMetricIDsUpdateLock sync.Mutex
 
+	// metricIDs for series matching retention filters.
+	// It is periodically updated by retentionFiltersWatcher.
+	retentionFilterMetricIDs atomic.Value
+
+	// retentionFilterMetricIDsLock serializes registering new metricIDs in retentionFilterMetricIDs
+	// with replacing retentionFilterMetricIDs, so the registered metricIDs aren't lost.
+	retentionFilterMetricIDsLock sync.Mutex
+
 	isReadOnly uint32
 }
 
@@ -157,6 +201,13 @@ func OpenStorage(path string, retentionMsecs int64, maxHourlySeries, maxDailySer
 		retentionMsecs: retentionMsecs,
 		stop:           make(chan struct{}),
 	}
+	if readOnlyReplica {
+		s.isReadOnlyReplica = true
+		if err := s.openReadOnly(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
 	if err := fs.MkdirAllIfNotExist(path); err != nil {
 		return nil, fmt.Errorf("cannot create a directory for the storage at %q: %w", path, err)
 	}
@@ -206,12 +257,15 @@ func OpenStorage(path string, retentionMsecs int64, maxHourlySeries, maxDailySer
 	s.metricIDCache = s.mustLoadCache("MetricID->TSID", "metricID_tsid", mem/16)
 	s.metricNameCache = s.mustLoadCache("MetricID->MetricName", "metricID_metricName", mem/10)
 	s.dateMetricIDCache = newDateMetricIDCache()
+	s.exemplars = s.mustLoadExemplars()
+	s.metricNamesStats = s.mustLoadMetricNamesStats()
 
 	hour := fasttime.UnixHour()
 	hmCurr := s.mustLoadHourMetricIDs(hour, "curr_hour_metric_ids")
 	hmPrev := s.mustLoadHourMetricIDs(hour-1, "prev_hour_metric_ids")
 	s.currHourMetricIDs.Store(hmCurr)
 	s.prevHourMetricIDs.Store(hmPrev)
+	s.lastHourChurn.Store(&hourChurn{})
 	s.pendingHourEntries = &uint64set.Set{}
 
 	date := fasttime.UnixDate()
@@ -220,6 +274,7 @@ func OpenStorage(path string, retentionMsecs int64, maxHourlySeries, maxDailySer
 	s.pendingNextDayMetricIDs = &uint64set.Set{}
 
 	s.prefetchedMetricIDs.Store(&uint64set.Set{})
+	s.retentionFilterMetricIDs.Store(&retentionFilterMetricIDs{})
 
 	// Load metadata
 	metadataDir := path + "/metadata"
@@ -227,6 +282,10 @@ func OpenStorage(path string, retentionMsecs int64, maxHourlySeries, maxDailySer
 	if err := fs.MkdirAllIfNotExist(metadataDir); err != nil {
 		return nil, fmt.Errorf("cannot create %q: %w", metadataDir, err)
 	}
+	if err := checkTimestampPrecision(metadataDir, isEmptyDB, false); err != nil {
+		_ = s.flockF.Close()
+		return nil, err
+	}
 	s.minTimestampForCompositeIndex = mustGetMinTimestampForCompositeIndex(metadataDir, isEmptyDB)
 
 	// Load indexdb
@@ -254,19 +313,43 @@ func OpenStorage(path string, retentionMsecs int64, maxHourlySeries, maxDailySer
 	s.setDeletedMetricIDs(dmisCurr)
 	s.updateDeletedMetricIDs(dmisPrev)
 
+	// Register metric names from indexdb in metric names stats, so never queried metric names are returned in the stats.
+	s.seedMetricNamesStats()
+
 	// Load data
 	tablePath := path + "/data"
-	tb, err := openTable(tablePath, s.getDeletedMetricIDs, retentionMsecs)
+	tb, err := openTable(tablePath, s.getDeletedMetricIDs, s.getRetentionFilterMetricIDs, retentionMsecs)
 	if err != nil {
 		s.idb().MustClose()
 		return nil, fmt.Errorf("cannot open table at %q: %w", tablePath, err)
 	}
 	s.tb = tb
 
+	// Load metric metadata index
+	mmi, err := openMetricMetadataIndex(path + "/metric_metadata")
+	if err != nil {
+		s.tb.MustClose()
+		s.idb().MustClose()
+		return nil, err
+	}
+	s.metricMetadata = mmi
+
+	// Replay rows left in WAL after unclean shutdown.
+	if err := s.openWAL(); err != nil {
+		s.metricMetadata.MustClose()
+		s.tb.MustClose()
+		s.idb().MustClose()
+		return nil, fmt.Errorf("cannot open WAL: %w", err)
+	}
+
 	s.startCurrHourMetricIDsUpdater()
 	s.startNextDayMetricIDsUpdater()
 	s.startRetentionWatcher()
+	s.startRetentionFiltersWatcher()
 	s.startFreeDiskSpaceWatcher()
+	s.startWALWatcher()
+	s.startHotBlocksPrewarmer()
+	s.startMetricNamesStatsSaver()
 
 	return s, nil
 }
@@ -304,12 +387,28 @@ func (s *Storage) updateDeletedMetricIDs(metricIDs *uint64set.Set) {
 
 // DebugFlush flushes recently added storage data, so it becomes visible to search.
 func (s *Storage) DebugFlush() {
+	if s.isReadOnlyReplica {
+		return
+	}
 	s.tb.flushRawRows()
 	s.idb().tb.DebugFlush()
 }
 
+// FlushToFiles flushes recently added storage data to files, so it survives unclean shutdown.
+//
+// It returns false if the storage is stopped before the flush is complete.
+func (s *Storage) FlushToFiles() bool {
+	if s.isReadOnlyReplica {
+		return true
+	}
+	return s.flushToFiles()
+}
+
 // CreateSnapshot creates snapshot for s and returns the snapshot name.
 func (s *Storage) CreateSnapshot() (string, error) {
+	if s.isReadOnlyReplica {
+		return "", ErrReadOnlyReplica
+	}
 	logger.Infof("creating Storage snapshot for %q...", s.path)
 	startTime := time.Now()
 
@@ -399,6 +498,9 @@ func (s *Storage) ListSnapshots() ([]string, error) {
 
 // DeleteSnapshot deletes the given snapshot.
 func (s *Storage) DeleteSnapshot(snapshotName string) error {
+	if s.isReadOnlyReplica {
+		return ErrReadOnlyReplica
+	}
 	if !snapshotNameRegexp.MatchString(snapshotName) {
 		return fmt.Errorf("invalid snapshotName %q", snapshotName)
 	}
@@ -458,6 +560,22 @@ type Metrics struct {
 	TimestampsBlocksMerged uint64
 	TimestampsBytesSaved   uint64
 
+	ExemplarsAdded      uint64
+	ExemplarSeriesCount uint64
+
+	MetricNamesStatsCount uint64
+
+	MetricMetadataEntriesAdded uint64
+
+	WALBytesWritten uint64
+	WALSyncs        uint64
+	WALRowsReplayed uint64
+
+	ReplicaRefreshes     uint64
+	ReplicaRefreshErrors uint64
+
+	HotBlocksPrewarmed uint64
+
 	TSIDCacheSize         uint64
 	TSIDCacheSizeBytes    uint64
 	TSIDCacheSizeMaxBytes uint64
@@ -533,6 +651,22 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	m.TimestampsBlocksMerged = atomic.LoadUint64(&timestampsBlocksMerged)
 	m.TimestampsBytesSaved = atomic.LoadUint64(&timestampsBytesSaved)
 
+	m.ExemplarsAdded += atomic.LoadUint64(&s.exemplars.exemplarsAdded)
+	m.ExemplarSeriesCount += uint64(s.exemplars.seriesCount())
+	m.MetricNamesStatsCount += uint64(s.metricNamesStats.len())
+	m.MetricMetadataEntriesAdded += atomic.LoadUint64(&s.metricMetadata.entriesAdded)
+
+	if s.wal != nil {
+		m.WALBytesWritten += atomic.LoadUint64(&s.wal.bytesWritten)
+		m.WALSyncs += atomic.LoadUint64(&s.wal.syncsTotal)
+	}
+	m.WALRowsReplayed = atomic.LoadUint64(&walRowsReplayed)
+
+	m.ReplicaRefreshes += atomic.LoadUint64(&s.replicaRefreshes)
+	m.ReplicaRefreshErrors += atomic.LoadUint64(&s.replicaRefreshErrors)
+
+	m.HotBlocksPrewarmed = atomic.LoadUint64(&hotBlocksPrewarmed)
+
 	var cs fastcache.Stats
 	s.tsidCache.UpdateStats(&cs)
 	m.TSIDCacheSize += cs.EntriesCount
@@ -752,13 +886,31 @@ func (s *Storage) resetAndSaveTSIDCache() {
 func (s *Storage) MustClose() {
 	close(s.stop)
 
+	if s.isReadOnlyReplica {
+		s.mustCloseReadOnly()
+		return
+	}
+
 	s.freeDiskSpaceWatcherWG.Wait()
 	s.retentionWatcherWG.Wait()
+	s.retentionFiltersWatcherWG.Wait()
 	s.currHourMetricIDsUpdaterWG.Wait()
 	s.nextDayMetricIDsUpdaterWG.Wait()
+	s.walWatcherWG.Wait()
+	s.hotBlocksPrewarmerWG.Wait()
+	s.metricNamesStatsSaverWG.Wait()
+
+	// Hot blocks must be saved before closing the tables, since this drops their blocks from caches.
+	s.mustSaveHotBlocks()
 
 	s.tb.MustClose()
 	s.idb().MustClose()
+	s.metricMetadata.MustClose()
+
+	// All the rows are flushed to files, so WAL segments are no longer needed.
+	if s.wal != nil {
+		s.wal.mustClose()
+	}
 
 	// Save caches.
 	s.mustSaveCache(s.tsidCache, "MetricName->TSID", "metricName_tsid")
@@ -767,6 +919,8 @@ func (s *Storage) MustClose() {
 	s.metricIDCache.Stop()
 	s.mustSaveCache(s.metricNameCache, "MetricID->MetricName", "metricID_metricName")
 	s.metricNameCache.Stop()
+	s.mustSaveExemplars()
+	s.mustSaveMetricNamesStats()
 
 	hmCurr := s.currHourMetricIDs.Load().(*hourMetricIDs)
 	s.mustSaveHourMetricIDs(hmCurr, "curr_hour_metric_ids")
@@ -1034,11 +1188,11 @@ func nextRetentionDuration(retentionMsecs int64) time.Duration {
 
 // SearchMetricNames returns metric names matching the given tfss on the given tr.
 func (s *Storage) SearchMetricNames(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]MetricName, error) {
-	tsids, err := s.searchTSIDs(tfss, tr, maxMetrics, deadline)
+	tsids, err := s.searchTSIDs(nil, tfss, tr, maxMetrics, deadline, nil)
 	if err != nil {
 		return nil, err
 	}
-	if err = s.prefetchMetricNames(tsids, deadline); err != nil {
+	if err = s.prefetchMetricNames(nil, tsids, deadline, nil); err != nil {
 		return nil, err
 	}
 	idb := s.idb()
@@ -1046,7 +1200,7 @@ func (s *Storage) SearchMetricNames(tfss []*TagFilters, tr TimeRange, maxMetrics
 	var metricName []byte
 	for i := range tsids {
 		if i&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(deadline, nil); err != nil {
 				return nil, err
 			}
 		}
@@ -1070,8 +1224,71 @@ func (s *Storage) SearchMetricNames(tfss []*TagFilters, tr TimeRange, maxMetrics
 	return mns, nil
 }
 
+// SearchEstimate contains the estimated cost of the search.
+type SearchEstimate struct {
+	// SeriesCount is the number of series matching the search filters according to the index.
+	SeriesCount int
+
+	// BlocksCount is the number of data blocks the search needs to read.
+	BlocksCount int
+
+	// SamplesCount is the estimated number of samples on the searched time range.
+	SamplesCount int
+}
+
+// EstimateSearch estimates the cost of the search for the given tfss on the given tr.
+//
+// It reads only the index and block headers without reading data blocks.
+func (s *Storage) EstimateSearch(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) (*SearchEstimate, error) {
+	qt = qt.NewChild("estimate search: filters=%s, timeRange=%s", tfss, &tr)
+	defer qt.Done()
+	tsids, err := s.searchTSIDs(qt, tfss, tr, maxMetrics, deadline, nil)
+	if err != nil {
+		return nil, err
+	}
+	se := &SearchEstimate{
+		SeriesCount: len(tsids),
+	}
+	trStorage := tr.toTimestamps(globalTimestampsPerMsec)
+	var ts tableSearch
+	ts.Init(s.tb, tsids, tr)
+	defer ts.MustClose()
+	samples := float64(0)
+	for ts.NextBlock() {
+		if se.BlocksCount&paceLimiterSlowIterationsMask == 0 {
+			if err := checkSearchDeadlineAndPace(deadline, nil); err != nil {
+				return nil, err
+			}
+		}
+		se.BlocksCount++
+		bh := &ts.BlockRef.bh
+		minTimestamp, maxTimestamp := bh.MinTimestamp, bh.MaxTimestamp
+		if minTimestamp >= trStorage.MinTimestamp && maxTimestamp <= trStorage.MaxTimestamp {
+			samples += float64(bh.RowsCount)
+			continue
+		}
+		// The block partially overlaps tr. Assume samples are evenly distributed inside the block.
+		if minTimestamp < trStorage.MinTimestamp {
+			minTimestamp = trStorage.MinTimestamp
+		}
+		if maxTimestamp > trStorage.MaxTimestamp {
+			maxTimestamp = trStorage.MaxTimestamp
+		}
+		samples += float64(bh.RowsCount) * float64(maxTimestamp-minTimestamp+1) / float64(bh.MaxTimestamp-bh.MinTimestamp+1)
+	}
+	if err := ts.Error(); err != nil {
+		return nil, err
+	}
+	se.SamplesCount = int(samples)
+	qt.Printf("found %d series, %d blocks, %d samples", se.SeriesCount, se.BlocksCount, se.SamplesCount)
+	return se, nil
+}
+
 // searchTSIDs returns sorted TSIDs for the given tfss and the given tr.
-func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
+func (s *Storage) searchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, canceled *uint32) ([]TSID, error) {
+	qt = qt.NewChild("search for matching series: filters=%s, timeRange=%s", tfss, &tr)
+	defer qt.Done()
+
 	// Do not cache tfss -> tsids here, since the caching is performed
 	// on idb level.
 
@@ -1083,6 +1300,7 @@ func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 	default:
 		// Sleep for a while until giving up
 		atomic.AddUint64(&s.searchTSIDsConcurrencyLimitReached, 1)
+		qt.Printf("wait for a free slot, since more than %d concurrent searches are performed", cap(searchTSIDsConcurrencyCh))
 		currentTime := fasttime.UnixTimestamp()
 		timeoutSecs := uint64(0)
 		if currentTime < deadline {
@@ -1100,7 +1318,7 @@ func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 				cap(searchTSIDsConcurrencyCh), timeout.Seconds())
 		}
 	}
-	tsids, err := s.idb().searchTSIDs(tfss, tr, maxMetrics, deadline)
+	tsids, err := s.idb().searchTSIDs(qt, tfss, tr, maxMetrics, deadline, canceled)
 	<-searchTSIDsConcurrencyCh
 	if err != nil {
 		return nil, fmt.Errorf("error when searching tsids: %w", err)
@@ -1118,8 +1336,9 @@ var (
 // prefetchMetricNames pre-fetches metric names for the given tsids into metricID->metricName cache.
 //
 // This should speed-up further searchMetricNameWithCache calls for metricIDs from tsids.
-func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
+func (s *Storage) prefetchMetricNames(qt *querytracer.Tracer, tsids []TSID, deadline uint64, canceled *uint32) error {
 	if len(tsids) == 0 {
+		qt.Printf("nothing to prefetch")
 		return nil
 	}
 	var metricIDs uint64Sorter
@@ -1134,6 +1353,7 @@ func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
 	}
 	if len(metricIDs) < 500 {
 		// It is cheaper to skip pre-fetching and obtain metricNames inline.
+		qt.Printf("skip prefetching metric names for %d series, since %d of them are already prefetched", len(tsids), len(tsids)-len(metricIDs))
 		return nil
 	}
 	atomic.AddUint64(&s.slowMetricNameLoads, uint64(len(metricIDs)))
@@ -1145,10 +1365,11 @@ func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
 	var err error
 	idb := s.idb()
 	is := idb.getIndexSearch(deadline)
+	is.canceled = canceled
 	defer idb.putIndexSearch(is)
 	for loops, metricID := range metricIDs {
 		if loops&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 				return err
 			}
 		}
@@ -1163,10 +1384,11 @@ func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
 	}
 	idb.doExtDB(func(extDB *indexDB) {
 		is := extDB.getIndexSearch(deadline)
+		is.canceled = canceled
 		defer extDB.putIndexSearch(is)
 		for loops, metricID := range missingMetricIDs {
 			if loops&paceLimiterSlowIterationsMask == 0 {
-				if err = checkSearchDeadlineAndPace(is.deadline); err != nil {
+				if err = checkSearchDeadlineAndPace(is.deadline, is.canceled); err != nil {
 					return
 				}
 			}
@@ -1198,6 +1420,7 @@ func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
 	}
 	s.prefetchedMetricIDs.Store(prefetchedMetricIDsNew)
 	s.prefetchedMetricIDsLock.Unlock()
+	qt.Printf("prefetched metric names for %d series", len(metricIDs))
 	return nil
 }
 
@@ -1208,6 +1431,9 @@ var ErrDeadlineExceeded = fmt.Errorf("deadline exceeded")
 //
 // Returns the number of metrics deleted.
 func (s *Storage) DeleteMetrics(tfss []*TagFilters) (int, error) {
+	if s.isReadOnlyReplica {
+		return 0, ErrReadOnlyReplica
+	}
 	deletedCount, err := s.idb().DeleteTSIDs(tfss)
 	if err != nil {
 		return deletedCount, fmt.Errorf("cannot delete tsids: %w", err)
@@ -1538,6 +1764,9 @@ func (mr *MetricRow) UnmarshalX(src []byte) ([]byte, error) {
 //
 // Partitions are merged sequentially in order to reduce load on the system.
 func (s *Storage) ForceMergePartitions(partitionNamePrefix string) error {
+	if s.isReadOnlyReplica {
+		return ErrReadOnlyReplica
+	}
 	return s.tb.ForceMergePartitions(partitionNamePrefix)
 }
 
@@ -1545,9 +1774,22 @@ var rowsAddedTotal uint64
 
 // AddRows adds the given mrs to s.
 func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
+	return s.AddRowsExt(mrs, precisionBits, nil)
+}
+
+// AddRowsExt adds the given mrs to s and calls addedRows for the rows passed to the underlying table.
+//
+// addedRows is called even if other rows couldn't be added to s, so the error returned from AddRowsExt
+// doesn't mean that none of mrs were stored. addedRows may be called multiple times.
+// It mustn't hold references to the passed rows after returning.
+// The error returned from addedRows is returned from AddRowsExt.
+func (s *Storage) AddRowsExt(mrs []MetricRow, precisionBits uint8, addedRows func(mrs []*MetricRow) error) error {
 	if len(mrs) == 0 {
 		return nil
 	}
+	if s.isReadOnlyReplica {
+		return ErrReadOnlyReplica
+	}
 
 	// Limit the number of concurrent goroutines that may add rows to the storage.
 	// This should prevent from out of memory errors and CPU trashing when too many
@@ -1576,6 +1818,12 @@ func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 		}
 	}
 
+	// Rows must be written to WAL and added to the storage before the switch to the next WAL segment.
+	w := s.wal
+	if w != nil {
+		w.rotateLock.RLock()
+	}
+
 	// Add rows to the storage in blocks with limited size in order to reduce memory usage.
 	var firstErr error
 	ic := getMetricRowsInsertCtx()
@@ -1588,7 +1836,15 @@ func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 		} else {
 			mrs = nil
 		}
-		if err := s.add(ic.rrs, ic.tmpMrs, mrsBlock, precisionBits); err != nil {
+		if w != nil {
+			if err := w.addRows(mrsBlock, precisionBits); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+		}
+		if err := s.add(ic.rrs, ic.tmpMrs, mrsBlock, precisionBits, addedRows); err != nil {
 			if firstErr == nil {
 				firstErr = err
 			}
@@ -1598,6 +1854,10 @@ func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 	}
 	putMetricRowsInsertCtx(ic)
 
+	if w != nil {
+		w.rotateLock.RUnlock()
+	}
+
 	<-addRowsConcurrencyCh
 
 	return firstErr
@@ -1644,6 +1904,9 @@ var (
 // The the MetricRow.Timestamp is used for registering the metric name starting from the given timestamp.
 // Th MetricRow.Value field is ignored.
 func (s *Storage) RegisterMetricNames(mrs []MetricRow) error {
+	if s.isReadOnlyReplica {
+		return ErrReadOnlyReplica
+	}
 	var (
 		metricName []byte
 	)
@@ -1685,9 +1948,11 @@ func (s *Storage) RegisterMetricNames(mrs []MetricRow) error {
 			return fmt.Errorf("cannot register the metric because cannot create TSID for metricName %q: %w", metricName, err)
 		}
 		s.putTSIDToCache(&genTSID, mr.MetricNameRaw)
+		s.registerIngestedMetricName(metricName)
+		s.applyRetentionFilters(genTSID.TSID.MetricID, mn)
 
 		// Register the metric in per-day inverted index.
-		date := uint64(mr.Timestamp) / msecPerDay
+		date := uint64(TimestampToMsecs(mr.Timestamp)) / msecPerDay
 		metricID := genTSID.TSID.MetricID
 		if s.dateMetricIDCache.Has(date, metricID) {
 			// Fast path: the metric has been already registered in per-day inverted index
@@ -1713,7 +1978,7 @@ func (s *Storage) RegisterMetricNames(mrs []MetricRow) error {
 	return nil
 }
 
-func (s *Storage) add(rows []rawRow, dstMrs []*MetricRow, mrs []MetricRow, precisionBits uint8) error {
+func (s *Storage) add(rows []rawRow, dstMrs []*MetricRow, mrs []MetricRow, precisionBits uint8, addedRows func(mrs []*MetricRow) error) error {
 	idb := s.idb()
 	j := 0
 	var (
@@ -1737,23 +2002,24 @@ func (s *Storage) add(rows []rawRow, dstMrs []*MetricRow, mrs []MetricRow, preci
 				continue
 			}
 		}
-		if mr.Timestamp < minTimestamp {
+		timestampMsecs := TimestampToMsecs(mr.Timestamp)
+		if timestampMsecs < minTimestamp {
 			// Skip rows with too small timestamps outside the retention.
 			if firstWarn == nil {
 				metricName := getUserReadableMetricName(mr.MetricNameRaw)
 				firstWarn = fmt.Errorf("cannot insert row with too small timestamp %d outside the retention; minimum allowed timestamp is %d; "+
 					"probably you need updating -retentionPeriod command-line flag; metricName: %s",
-					mr.Timestamp, minTimestamp, metricName)
+					timestampMsecs, minTimestamp, metricName)
 			}
 			atomic.AddUint64(&s.tooSmallTimestampRows, 1)
 			continue
 		}
-		if mr.Timestamp > maxTimestamp {
+		if timestampMsecs > maxTimestamp {
 			// Skip rows with too big timestamps significantly exceeding the current time.
 			if firstWarn == nil {
 				metricName := getUserReadableMetricName(mr.MetricNameRaw)
 				firstWarn = fmt.Errorf("cannot insert row with too big timestamp %d exceeding the current time; maximum allowed timestamp is %d; metricName: %s",
-					mr.Timestamp, maxTimestamp, metricName)
+					timestampMsecs, maxTimestamp, metricName)
 			}
 			atomic.AddUint64(&s.tooBigTimestampRows, 1)
 			continue
@@ -1823,6 +2089,7 @@ func (s *Storage) add(rows []rawRow, dstMrs []*MetricRow, mrs []MetricRow, preci
 			return string(pendingMetricRows[i].MetricName) < string(pendingMetricRows[j].MetricName)
 		})
 		is := idb.getIndexSearch(noDeadline)
+		mn := GetMetricName()
 		prevMetricNameRaw = nil
 		var slowInsertsCount uint64
 		for i := range pendingMetricRows {
@@ -1859,6 +2126,13 @@ func (s *Storage) add(rows []rawRow, dstMrs []*MetricRow, mrs []MetricRow, preci
 			genTSID.generation = idb.generation
 			genTSID.TSID = r.TSID
 			s.putTSIDToCache(&genTSID, mr.MetricNameRaw)
+			s.registerIngestedMetricName(pmr.MetricName)
+			if isRetentionFiltersEnabled() {
+				if err := mn.Unmarshal(pmr.MetricName); err != nil {
+					logger.Panicf("BUG: cannot unmarshal metricName %q: %s", pmr.MetricName, err)
+				}
+				s.applyRetentionFilters(r.TSID.MetricID, mn)
+			}
 			prevTSID = r.TSID
 			prevMetricNameRaw = mr.MetricNameRaw
 			if s.isSeriesCardinalityExceeded(r.TSID.MetricID, mr.MetricNameRaw) {
@@ -1867,6 +2141,7 @@ func (s *Storage) add(rows []rawRow, dstMrs []*MetricRow, mrs []MetricRow, preci
 				continue
 			}
 		}
+		PutMetricName(mn)
 		idb.putIndexSearch(is)
 		putPendingMetricRows(pmrs)
 		atomic.AddUint64(&s.slowRowInserts, slowInsertsCount)
@@ -1881,6 +2156,11 @@ func (s *Storage) add(rows []rawRow, dstMrs []*MetricRow, mrs []MetricRow, preci
 	if err := s.tb.AddRows(rows); err != nil {
 		firstError = fmt.Errorf("cannot add rows to table: %w", err)
 	}
+	if addedRows != nil && len(dstMrs) > 0 {
+		if err := addedRows(dstMrs); err != nil && firstError == nil {
+			firstError = err
+		}
+	}
 	if err := s.updatePerDateData(rows, dstMrs); err != nil && firstError == nil {
 		firstError = fmt.Errorf("cannot update per-date data: %w", err)
 	}
@@ -2015,8 +2295,9 @@ func (s *Storage) updatePerDateData(rows []rawRow, mrs []*MetricRow) error {
 	for i := range rows {
 		r := &rows[i]
 		if r.Timestamp != prevTimestamp {
-			date = uint64(r.Timestamp) / msecPerDay
-			hour = uint64(r.Timestamp) / msecPerHour
+			timestampMsecs := TimestampToMsecs(r.Timestamp)
+			date = uint64(timestampMsecs) / msecPerDay
+			hour = uint64(timestampMsecs) / msecPerHour
 			prevTimestamp = r.Timestamp
 		}
 		metricID := r.TSID.MetricID
@@ -2397,7 +2678,9 @@ func (s *Storage) updateCurrHourMetricIDs() {
 	}
 	s.currHourMetricIDs.Store(hmNew)
 	if hm.hour != hour {
+		hmPrev := s.prevHourMetricIDs.Load().(*hourMetricIDs)
 		s.prevHourMetricIDs.Store(hm)
+		s.updateLastHourChurn(hmPrev, hm)
 	}
 }
 
@@ -2430,34 +2713,12 @@ func (s *Storage) openIndexDBTables(path string) (curr, prev *indexDB, err error
 		return nil, nil, fmt.Errorf("cannot create directory %q: %w", path, err)
 	}
 
-	d, err := os.Open(path)
-	if err != nil {
-		return nil, nil, fmt.Errorf("cannot open directory: %w", err)
-	}
-	defer fs.MustClose(d)
-
 	// Search for the two most recent tables - the last one is active,
 	// the previous one contains backup data.
-	fis, err := d.Readdir(-1)
+	tableNames, err := readIndexDBTableNames(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot read directory: %w", err)
-	}
-	var tableNames []string
-	for _, fi := range fis {
-		if !fs.IsDirOrSymlink(fi) {
-			// Skip non-directories.
-			continue
-		}
-		tableName := fi.Name()
-		if !indexDBTableNameRegexp.MatchString(tableName) {
-			// Skip invalid directories.
-			continue
-		}
-		tableNames = append(tableNames, tableName)
+		return nil, nil, err
 	}
-	sort.Slice(tableNames, func(i, j int) bool {
-		return tableNames[i] < tableNames[j]
-	})
 	if len(tableNames) < 2 {
 		// Create missing tables
 		if len(tableNames) == 0 {
@@ -2498,6 +2759,37 @@ func (s *Storage) openIndexDBTables(path string) (curr, prev *indexDB, err error
 	return curr, prev, nil
 }
 
+// readIndexDBTableNames returns sorted names of indexdb tables at the given path.
+func readIndexDBTableNames(path string) ([]string, error) {
+	d, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open directory: %w", err)
+	}
+	defer fs.MustClose(d)
+
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory: %w", err)
+	}
+	var tableNames []string
+	for _, fi := range fis {
+		if !fs.IsDirOrSymlink(fi) {
+			// Skip non-directories.
+			continue
+		}
+		tableName := fi.Name()
+		if !indexDBTableNameRegexp.MatchString(tableName) {
+			// Skip invalid directories.
+			continue
+		}
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Slice(tableNames, func(i, j int) bool {
+		return tableNames[i] < tableNames[j]
+	})
+	return tableNames, nil
+}
+
 var indexDBTableNameRegexp = regexp.MustCompile("^[0-9A-F]{16}$")
 
 func nextIndexDBTableName() string {
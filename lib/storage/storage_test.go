@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"reflect"
@@ -635,7 +637,7 @@ func testStorageDeleteMetrics(s *Storage, workerNum int) error {
 	metricBlocksCount := func(tfs *TagFilters) int {
 		// Verify the number of blocks
 		n := 0
-		sr.Init(s, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		sr.Init(nil, s, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
 		for sr.NextMetricBlock() {
 			n++
 		}
@@ -918,6 +920,49 @@ func TestStorageAddRowsConcurrent(t *testing.T) {
 	}
 }
 
+func TestStorageAddRowsExt(t *testing.T) {
+	path := "TestStorageAddRowsExt"
+	s, err := OpenStorage(path, 0, 1e5, 1e5)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	mrs := testGenerateMetricRows(100, 0, 1e10)
+	// The row with NaN value must be skipped.
+	mrs[10].Value = math.NaN()
+
+	var addedRows []MetricRow
+	f := func(mrs []*MetricRow) error {
+		for _, mr := range mrs {
+			addedRows = append(addedRows, *mr)
+		}
+		return nil
+	}
+	if err := s.AddRowsExt(mrs, defaultPrecisionBits, f); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(addedRows) != len(mrs)-1 {
+		t.Fatalf("unexpected number of added rows; got %d; want %d", len(addedRows), len(mrs)-1)
+	}
+	for i := range addedRows {
+		if math.IsNaN(addedRows[i].Value) {
+			t.Fatalf("unexpected row with NaN value passed to the callback")
+		}
+	}
+
+	// The error from the callback must be returned.
+	errExpected := fmt.Errorf("callback error")
+	f = func(mrs []*MetricRow) error {
+		return errExpected
+	}
+	if err := s.AddRowsExt(mrs, defaultPrecisionBits, f); !errors.Is(err, errExpected) {
+		t.Fatalf("unexpected error; got %v; want %v", err, errExpected)
+	}
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
 func testGenerateMetricRows(rows uint64, timestampMin, timestampMax int64) []MetricRow {
 	var mrs []MetricRow
 	var mn MetricName
@@ -1114,3 +1159,73 @@ func containsString(a []string, s string) bool {
 	}
 	return false
 }
+
+func TestStorageEstimateSearch(t *testing.T) {
+	path := "TestStorageEstimateSearch"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer s.MustClose()
+
+	// Add 10 series with 100 samples each at 1s interval.
+	const seriesCount = 10
+	const samplesPerSeries = 100
+	minTimestamp := time.Now().UnixNano()/1e6 - 3600*1000
+	var mrs []MetricRow
+	for i := 0; i < seriesCount; i++ {
+		var mn MetricName
+		mn.MetricGroup = []byte("metric")
+		mn.AddTag("instance", fmt.Sprintf("host_%d", i))
+		metricNameRaw := mn.marshalRaw(nil)
+		for j := 0; j < samplesPerSeries; j++ {
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     minTimestamp + int64(j)*1000,
+				Value:         float64(j),
+			})
+		}
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	s.DebugFlush()
+
+	f := func(instanceRegexp string, tr TimeRange, seriesExpected, samplesMin, samplesMax int) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric"), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		if err := tfs.Add([]byte("instance"), []byte(instanceRegexp), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		se, err := s.EstimateSearch(nil, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if se.SeriesCount != seriesExpected {
+			t.Fatalf("unexpected series count; got %d; want %d", se.SeriesCount, seriesExpected)
+		}
+		if se.SamplesCount < samplesMin || se.SamplesCount > samplesMax {
+			t.Fatalf("unexpected samples count; got %d; want [%d..%d]", se.SamplesCount, samplesMin, samplesMax)
+		}
+	}
+	trFull := TimeRange{
+		MinTimestamp: minTimestamp,
+		MaxTimestamp: minTimestamp + samplesPerSeries*1000,
+	}
+	f(".*", trFull, seriesCount, seriesCount*samplesPerSeries, seriesCount*samplesPerSeries)
+	f("host_[0-4]", trFull, 5, 5*samplesPerSeries, 5*samplesPerSeries)
+	f("missing", trFull, 0, 0, 0)
+
+	// Half of the time range must result in roughly half of samples.
+	trHalf := TimeRange{
+		MinTimestamp: minTimestamp,
+		MaxTimestamp: minTimestamp + samplesPerSeries*1000/2,
+	}
+	f(".*", trHalf, seriesCount, seriesCount*samplesPerSeries/2-seriesCount, seriesCount*samplesPerSeries/2+seriesCount)
+}
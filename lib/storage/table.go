@@ -17,22 +17,49 @@ import (
 
 // table represents a single table with time series data.
 type table struct {
+	// Atomic counters must be at the top of struct for proper 8-byte alignment on 32-bit archs.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/212
+
+	partitionsMovedToCold uint64
+
 	path                string
 	smallPartitionsPath string
 	bigPartitionsPath   string
 
-	getDeletedMetricIDs func() *uint64set.Set
-	retentionMsecs      int64
+	// Paths to partitions in cold storage. They are empty if cold storage is disabled.
+	coldSmallPartitionsPath string
+	coldBigPartitionsPath   string
+
+	getDeletedMetricIDs         func() *uint64set.Set
+	getRetentionFilterMetricIDs func() *retentionFilterMetricIDs
+	retentionMsecs              int64
 
 	ptws     []*partitionWrapper
 	ptwsLock sync.Mutex
 
-	flockF *os.File
+	// droppingPartitions contains names for partitions dropped via DropPartition, which still have data on disk.
+	//
+	// Such partitions cannot be created again until their data is removed. See partitionWrapper.dropCallback.
+	droppingPartitions     map[string]struct{}
+	droppingPartitionsLock sync.Mutex
+
+	// ptsMoveLock prevents from data modification while partitions are moved to cold storage.
+	ptsMoveLock sync.RWMutex
+
+	flockF     *os.File
+	coldFlockF *os.File
+
+	// isReadOnly is set for tables opened via openTableReadOnly.
+	isReadOnly bool
 
 	stop chan struct{}
 
 	retentionWatcherWG  sync.WaitGroup
 	finalDedupWatcherWG sync.WaitGroup
+
+	retentionFiltersMergeWatcherWG sync.WaitGroup
+	tombstonesMergeWatcherWG       sync.WaitGroup
+	coldPartitionsWatcherWG        sync.WaitGroup
 }
 
 // partitionWrapper provides refcounting mechanism for the partition.
@@ -46,6 +73,9 @@ type partitionWrapper struct {
 	mustDrop uint64
 
 	pt *partition
+
+	// dropCallback is called after the partition data is removed from disk if it isn't nil.
+	dropCallback func()
 }
 
 func (ptw *partitionWrapper) incRef() {
@@ -72,6 +102,9 @@ func (ptw *partitionWrapper) decRef() {
 	// ptw.mustDrop > 0. Drop the partition.
 	ptw.pt.Drop()
 	ptw.pt = nil
+	if ptw.dropCallback != nil {
+		ptw.dropCallback()
+	}
 }
 
 func (ptw *partitionWrapper) scheduleToDrop() {
@@ -83,7 +116,7 @@ func (ptw *partitionWrapper) scheduleToDrop() {
 // The table is created if it doesn't exist.
 //
 // Data older than the retentionMsecs may be dropped at any time.
-func openTable(path string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) (*table, error) {
+func openTable(path string, getDeletedMetricIDs func() *uint64set.Set, getRetentionFilterMetricIDs func() *retentionFilterMetricIDs, retentionMsecs int64) (*table, error) {
 	path = filepath.Clean(path)
 
 	// Create a directory for the table if it doesn't exist yet.
@@ -115,20 +148,52 @@ func openTable(path string, getDeletedMetricIDs func() *uint64set.Set, retention
 		return nil, fmt.Errorf("cannot create %q: %w", bigSnapshotsPath, err)
 	}
 
+	mustRemoveColdMoveSnapshots(smallSnapshotsPath)
+	mustRemoveColdMoveSnapshots(bigSnapshotsPath)
+
+	// Create directories for partitions in cold storage if it is enabled.
+	var coldSmallPartitionsPath, coldBigPartitionsPath string
+	var coldFlockF *os.File
+	if coldStoragePath != "" {
+		coldPath, err := filepath.Abs(coldStoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine absolute path for cold storage %q: %w", coldStoragePath, err)
+		}
+		coldPath += "/data"
+		if err := fs.MkdirAllIfNotExist(coldPath); err != nil {
+			return nil, fmt.Errorf("cannot create directory for cold table %q: %w", coldPath, err)
+		}
+		coldFlockF, err = fs.CreateFlockFile(coldPath)
+		if err != nil {
+			return nil, err
+		}
+		coldSmallPartitionsPath = coldPath + "/small"
+		coldBigPartitionsPath = coldPath + "/big"
+		for _, p := range []string{coldSmallPartitionsPath + "/snapshots", coldBigPartitionsPath + "/snapshots"} {
+			if err := fs.MkdirAllIfNotExist(p); err != nil {
+				return nil, fmt.Errorf("cannot create %q: %w", p, err)
+			}
+		}
+	}
+
 	// Open partitions.
-	pts, err := openPartitions(smallPartitionsPath, bigPartitionsPath, getDeletedMetricIDs, retentionMsecs)
+	pts, err := openPartitions(smallPartitionsPath, bigPartitionsPath, coldSmallPartitionsPath, coldBigPartitionsPath, getDeletedMetricIDs, getRetentionFilterMetricIDs, retentionMsecs)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open partitions in the table %q: %w", path, err)
 	}
 
 	tb := &table{
-		path:                path,
-		smallPartitionsPath: smallPartitionsPath,
-		bigPartitionsPath:   bigPartitionsPath,
-		getDeletedMetricIDs: getDeletedMetricIDs,
-		retentionMsecs:      retentionMsecs,
-
-		flockF: flockF,
+		path:                        path,
+		smallPartitionsPath:         smallPartitionsPath,
+		bigPartitionsPath:           bigPartitionsPath,
+		coldSmallPartitionsPath:     coldSmallPartitionsPath,
+		coldBigPartitionsPath:       coldBigPartitionsPath,
+		getDeletedMetricIDs:         getDeletedMetricIDs,
+		getRetentionFilterMetricIDs: getRetentionFilterMetricIDs,
+		retentionMsecs:              retentionMsecs,
+
+		flockF:     flockF,
+		coldFlockF: coldFlockF,
 
 		stop: make(chan struct{}),
 	}
@@ -137,6 +202,9 @@ func openTable(path string, getDeletedMetricIDs func() *uint64set.Set, retention
 	}
 	tb.startRetentionWatcher()
 	tb.startFinalDedupWatcher()
+	tb.startRetentionFiltersMergeWatcher()
+	tb.startTombstonesMergeWatcher()
+	tb.startColdPartitionsWatcher()
 	return tb, nil
 }
 
@@ -160,6 +228,14 @@ func (tb *table) CreateSnapshot(snapshotName string) (string, string, error) {
 	for _, ptw := range ptws {
 		smallPath := dstSmallDir + "/" + ptw.pt.name
 		bigPath := dstBigDir + "/" + ptw.pt.name
+		if tb.isColdPartition(ptw.pt) {
+			// Hard links cannot be created across file systems, so create the snapshot for the cold partition
+			// in cold storage and then symlink it from the snapshot dir.
+			if err := tb.createColdPartitionSnapshot(ptw.pt, snapshotName, smallPath, bigPath); err != nil {
+				return "", "", err
+			}
+			continue
+		}
 		if err := ptw.pt.CreateSnapshotAt(smallPath, bigPath); err != nil {
 			return "", "", fmt.Errorf("cannot create snapshot for partition %q in %q: %w", ptw.pt.name, tb.path, err)
 		}
@@ -180,6 +256,10 @@ func (tb *table) MustDeleteSnapshot(snapshotName string) {
 	fs.MustRemoveAll(smallDir)
 	bigDir := fmt.Sprintf("%s/big/snapshots/%s", tb.path, snapshotName)
 	fs.MustRemoveAll(bigDir)
+	if tb.isColdStorageEnabled() {
+		fs.MustRemoveAll(tb.coldSmallPartitionsPath + "/snapshots/" + snapshotName)
+		fs.MustRemoveAll(tb.coldBigPartitionsPath + "/snapshots/" + snapshotName)
+	}
 }
 
 func (tb *table) addPartitionNolock(pt *partition) {
@@ -196,6 +276,9 @@ func (tb *table) MustClose() {
 	close(tb.stop)
 	tb.retentionWatcherWG.Wait()
 	tb.finalDedupWatcherWG.Wait()
+	tb.retentionFiltersMergeWatcherWG.Wait()
+	tb.tombstonesMergeWatcherWG.Wait()
+	tb.coldPartitionsWatcherWG.Wait()
 
 	tb.ptwsLock.Lock()
 	ptws := tb.ptws
@@ -209,15 +292,25 @@ func (tb *table) MustClose() {
 		ptw.decRef()
 	}
 
+	if tb.isReadOnly {
+		// Read-only table doesn't hold locks.
+		return
+	}
+
 	// Release exclusive lock on the table.
 	if err := tb.flockF.Close(); err != nil {
 		logger.Panicf("FATAL: cannot release lock on %q: %s", tb.flockF.Name(), err)
 	}
+	if tb.coldFlockF != nil {
+		if err := tb.coldFlockF.Close(); err != nil {
+			logger.Panicf("FATAL: cannot release lock on %q: %s", tb.coldFlockF.Name(), err)
+		}
+	}
 }
 
 // flushRawRows flushes all the pending rows, so they become visible to search.
 //
-// This function is for debug purposes only.
+// It is used by Storage.DebugFlush and before WAL truncation, since rows from the truncated WAL segments must be flushed to files.
 func (tb *table) flushRawRows() {
 	ptws := tb.GetPartitions(nil)
 	defer tb.PutPartitions(ptws)
@@ -227,11 +320,29 @@ func (tb *table) flushRawRows() {
 	}
 }
 
+// flushInmemoryPartsToFiles flushes all the inmemory parts in tb to files.
+//
+// It returns false if tb is stopped before all the inmemory parts are flushed.
+func (tb *table) flushInmemoryPartsToFiles() bool {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+
+	for _, ptw := range ptws {
+		if !ptw.pt.flushInmemoryPartsToFiles() {
+			return false
+		}
+	}
+	return true
+}
+
 // TableMetrics contains essential metrics for the table.
 type TableMetrics struct {
 	partitionMetrics
 
 	PartitionsRefCount uint64
+
+	ColdPartitions        uint64
+	PartitionsMovedToCold uint64
 }
 
 // UpdateMetrics updates m with metrics from tb.
@@ -240,8 +351,12 @@ func (tb *table) UpdateMetrics(m *TableMetrics) {
 	for _, ptw := range tb.ptws {
 		ptw.pt.UpdateMetrics(&m.partitionMetrics)
 		m.PartitionsRefCount += atomic.LoadUint64(&ptw.refCount)
+		if tb.isColdPartition(ptw.pt) {
+			m.ColdPartitions++
+		}
 	}
 	tb.ptwsLock.Unlock()
+	m.PartitionsMovedToCold += atomic.LoadUint64(&tb.partitionsMovedToCold)
 }
 
 // ForceMergePartitions force-merges partitions in tb with names starting from the given partitionNamePrefix.
@@ -270,6 +385,9 @@ func (tb *table) AddRows(rows []rawRow) error {
 		return nil
 	}
 
+	tb.ptsMoveLock.RLock()
+	defer tb.ptsMoveLock.RUnlock()
+
 	// Verify whether all the rows may be added to a single partition.
 	ptwsX := getPartitionWrappers()
 	defer putPartitionWrappers(ptwsX)
@@ -279,7 +397,7 @@ func (tb *table) AddRows(rows []rawRow) error {
 	for i, ptw := range ptws {
 		singlePt := true
 		for j := range rows {
-			if !ptw.pt.HasTimestamp(rows[j].Timestamp) {
+			if !ptw.pt.HasTimestamp(TimestampToMsecs(rows[j].Timestamp)) {
 				singlePt = false
 				break
 			}
@@ -314,7 +432,7 @@ func (tb *table) AddRows(rows []rawRow) error {
 		r := &rows[i]
 		ptFound := false
 		for _, ptw := range ptws {
-			if ptw.pt.HasTimestamp(r.Timestamp) {
+			if ptw.pt.HasTimestamp(TimestampToMsecs(r.Timestamp)) {
 				ptBuckets[ptw] = append(ptBuckets[ptw], *r)
 				ptFound = true
 				break
@@ -337,11 +455,13 @@ func (tb *table) AddRows(rows []rawRow) error {
 	// Create new partitions for these rows.
 	// Do this under tb.ptwsLock.
 	minTimestamp, maxTimestamp := tb.getMinMaxTimestamps()
+	rowsForDroppingPartitions := 0
 	tb.ptwsLock.Lock()
 	for i := range missingRows {
 		r := &missingRows[i]
+		timestamp := TimestampToMsecs(r.Timestamp)
 
-		if r.Timestamp < minTimestamp || r.Timestamp > maxTimestamp {
+		if timestamp < minTimestamp || timestamp > maxTimestamp {
 			// Silently skip row outside retention, since it should be deleted anyway.
 			continue
 		}
@@ -349,7 +469,7 @@ func (tb *table) AddRows(rows []rawRow) error {
 		// Make sure the partition for the r hasn't been added by another goroutines.
 		ptFound := false
 		for _, ptw := range tb.ptws {
-			if ptw.pt.HasTimestamp(r.Timestamp) {
+			if ptw.pt.HasTimestamp(timestamp) {
 				ptFound = true
 				ptw.pt.AddRows(missingRows[i : i+1])
 				break
@@ -358,8 +478,13 @@ func (tb *table) AddRows(rows []rawRow) error {
 		if ptFound {
 			continue
 		}
+		if tb.isDroppingPartition(timestampToPartitionName(timestamp)) {
+			// The partition cannot be created until its data is removed by DropPartition.
+			rowsForDroppingPartitions++
+			continue
+		}
 
-		pt, err := createPartition(r.Timestamp, tb.smallPartitionsPath, tb.bigPartitionsPath, tb.getDeletedMetricIDs, tb.retentionMsecs)
+		pt, err := createPartition(timestamp, tb.smallPartitionsPath, tb.bigPartitionsPath, tb.getDeletedMetricIDs, tb.getRetentionFilterMetricIDs, tb.retentionMsecs)
 		if err != nil {
 			// Return only the first error, since it has no sense in returning all errors.
 			tb.ptwsLock.Unlock()
@@ -370,6 +495,9 @@ func (tb *table) AddRows(rows []rawRow) error {
 	}
 	tb.ptwsLock.Unlock()
 
+	if rowsForDroppingPartitions > 0 {
+		return fmt.Errorf("cannot add %d rows to table %q, since their partitions are being dropped; try adding these rows later", rowsForDroppingPartitions, tb.path)
+	}
 	return nil
 }
 
@@ -443,18 +571,17 @@ func (tb *table) startFinalDedupWatcher() {
 }
 
 func (tb *table) finalDedupWatcher() {
-	if !isDedupEnabled() {
-		// Deduplication is disabled.
+	if !isDedupEnabled() && !isDownsamplingEnabled() {
+		// Deduplication and downsampling are disabled.
 		return
 	}
 	f := func() {
 		ptws := tb.GetPartitions(nil)
 		defer tb.PutPartitions(ptws)
 		timestamp := timestampFromTime(time.Now())
-		currentPartitionName := timestampToPartitionName(timestamp)
 		for _, ptw := range ptws {
-			if ptw.pt.name == currentPartitionName {
-				// Do not run final dedup for the current month.
+			if ptw.pt.HasTimestamp(timestamp) {
+				// Do not run final dedup for the current partition.
 				continue
 			}
 			if err := ptw.pt.runFinalDedup(); err != nil {
@@ -475,6 +602,41 @@ func (tb *table) finalDedupWatcher() {
 	}
 }
 
+func (tb *table) startRetentionFiltersMergeWatcher() {
+	tb.retentionFiltersMergeWatcherWG.Add(1)
+	go func() {
+		tb.retentionFiltersMergeWatcher()
+		tb.retentionFiltersMergeWatcherWG.Done()
+	}()
+}
+
+func (tb *table) retentionFiltersMergeWatcher() {
+	if !isRetentionFiltersEnabled() {
+		// Retention filters are disabled.
+		return
+	}
+	f := func() {
+		ptws := tb.GetPartitions(nil)
+		defer tb.PutPartitions(ptws)
+		for _, ptw := range ptws {
+			if err := ptw.pt.runRetentionFiltersMerge(); err != nil {
+				logger.Errorf("cannot apply retention filters to partition %s: %s", ptw.pt.name, err)
+				continue
+			}
+		}
+	}
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for {
+		select {
+		case <-tb.stop:
+			return
+		case <-t.C:
+			f()
+		}
+	}
+}
+
 // GetPartitions appends tb's partitions snapshot to dst and returns the result.
 //
 // The returned partitions must be passed to PutPartitions
@@ -497,7 +659,8 @@ func (tb *table) PutPartitions(ptws []*partitionWrapper) {
 	}
 }
 
-func openPartitions(smallPartitionsPath, bigPartitionsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) ([]*partition, error) {
+func openPartitions(smallPartitionsPath, bigPartitionsPath, coldSmallPartitionsPath, coldBigPartitionsPath string,
+	getDeletedMetricIDs func() *uint64set.Set, getRetentionFilterMetricIDs func() *retentionFilterMetricIDs, retentionMsecs int64) ([]*partition, error) {
 	// Certain partition directories in either `big` or `small` dir may be missing
 	// after restoring from backup. So populate partition names from both dirs.
 	ptNames := make(map[string]bool)
@@ -507,11 +670,47 @@ func openPartitions(smallPartitionsPath, bigPartitionsPath string, getDeletedMet
 	if err := populatePartitionNames(bigPartitionsPath, ptNames); err != nil {
 		return nil, err
 	}
+	coldPtNames := make(map[string]bool)
+	if coldSmallPartitionsPath != "" {
+		if err := populatePartitionNames(coldSmallPartitionsPath, coldPtNames); err != nil {
+			return nil, err
+		}
+		if err := populatePartitionNames(coldBigPartitionsPath, coldPtNames); err != nil {
+			return nil, err
+		}
+	}
+	for ptName := range coldPtNames {
+		coldSmallPartsPath := coldSmallPartitionsPath + "/" + ptName
+		coldBigPartsPath := coldBigPartitionsPath + "/" + ptName
+		if !ptNames[ptName] {
+			continue
+		}
+		// The partition exists in both hot and cold storage. This may happen on unclean shutdown during the partition move.
+		if isColdPartitionComplete(coldBigPartsPath) {
+			// The partition has been completely moved to cold storage. Remove it from hot storage.
+			logger.Infof("removing partition %q from hot storage, since it has been moved to cold storage", ptName)
+			fs.MustRemoveAll(smallPartitionsPath + "/" + ptName)
+			fs.MustRemoveAll(bigPartitionsPath + "/" + ptName)
+			continue
+		}
+		// The partition move has been interrupted. Remove the incomplete copy from cold storage.
+		logger.Infof("removing incomplete copy of partition %q from cold storage", ptName)
+		fs.MustRemoveAll(coldSmallPartsPath)
+		fs.MustRemoveAll(coldBigPartsPath)
+		delete(coldPtNames, ptName)
+	}
+	for ptName := range coldPtNames {
+		ptNames[ptName] = true
+	}
 	var pts []*partition
 	for ptName := range ptNames {
 		smallPartsPath := smallPartitionsPath + "/" + ptName
 		bigPartsPath := bigPartitionsPath + "/" + ptName
-		pt, err := openPartition(smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs)
+		if coldPtNames[ptName] {
+			smallPartsPath = coldSmallPartitionsPath + "/" + ptName
+			bigPartsPath = coldBigPartitionsPath + "/" + ptName
+		}
+		pt, err := openPartition(smallPartsPath, bigPartsPath, getDeletedMetricIDs, getRetentionFilterMetricIDs, retentionMsecs)
 		if err != nil {
 			mustClosePartitions(pts)
 			return nil, fmt.Errorf("cannot open partition %q: %w", ptName, err)
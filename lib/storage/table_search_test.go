@@ -181,7 +181,7 @@ func testTableSearchEx(t *testing.T, trData, trSearch TimeRange, partitionsCount
 	})
 
 	// Create a table from rowss and test search on it.
-	tb, err := openTable("./test-table", nilGetDeletedMetricIDs, maxRetentionMsecs)
+	tb, err := openTable("./test-table", nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, maxRetentionMsecs)
 	if err != nil {
 		t.Fatalf("cannot create table: %s", err)
 	}
@@ -202,7 +202,7 @@ func testTableSearchEx(t *testing.T, trData, trSearch TimeRange, partitionsCount
 	tb.MustClose()
 
 	// Open the created table and test search on it.
-	tb, err = openTable("./test-table", nilGetDeletedMetricIDs, maxRetentionMsecs)
+	tb, err = openTable("./test-table", nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, maxRetentionMsecs)
 	if err != nil {
 		t.Fatalf("cannot open table: %s", err)
 	}
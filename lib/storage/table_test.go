@@ -2,7 +2,10 @@ package storage
 
 import (
 	"os"
+	"reflect"
+	"sort"
 	"testing"
+	"time"
 )
 
 func TestTableOpenClose(t *testing.T) {
@@ -17,7 +20,7 @@ func TestTableOpenClose(t *testing.T) {
 	}()
 
 	// Create a new table
-	tb, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs)
+	tb, err := openTable(path, nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, retentionMsecs)
 	if err != nil {
 		t.Fatalf("cannot create new table: %s", err)
 	}
@@ -27,7 +30,7 @@ func TestTableOpenClose(t *testing.T) {
 
 	// Re-open created table multiple times.
 	for i := 0; i < 10; i++ {
-		tb, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs)
+		tb, err := openTable(path, nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, retentionMsecs)
 		if err != nil {
 			t.Fatalf("cannot open created table: %s", err)
 		}
@@ -43,17 +46,99 @@ func TestTableOpenMultipleTimes(t *testing.T) {
 		_ = os.RemoveAll(path)
 	}()
 
-	tb1, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs)
+	tb1, err := openTable(path, nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, retentionMsecs)
 	if err != nil {
 		t.Fatalf("cannot open table the first time: %s", err)
 	}
 	defer tb1.MustClose()
 
 	for i := 0; i < 10; i++ {
-		tb2, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs)
+		tb2, err := openTable(path, nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, retentionMsecs)
 		if err == nil {
 			tb2.MustClose()
 			t.Fatalf("expecting non-nil error when opening already opened table")
 		}
 	}
 }
+
+func TestTablePartitionGranularity(t *testing.T) {
+	const path = "TestTablePartitionGranularity"
+	const retentionMsecs = 12 * msecsPerMonth
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	defer func() {
+		if err := SetPartitionGranularity("month"); err != nil {
+			t.Fatalf("cannot restore partition granularity: %s", err)
+		}
+	}()
+
+	tb, err := openTable(path, nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, retentionMsecs)
+	if err != nil {
+		t.Fatalf("cannot open table: %s", err)
+	}
+	addRow := func(timestamp int64) {
+		t.Helper()
+		rows := []rawRow{{
+			Timestamp:     timestamp,
+			Value:         1,
+			PrecisionBits: defaultPrecisionBits,
+		}}
+		if err := tb.AddRows(rows); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+	}
+	checkPartitions := func(namesExpected []string) {
+		t.Helper()
+		ptws := tb.GetPartitions(nil)
+		defer tb.PutPartitions(ptws)
+		var names []string
+		for _, ptw := range ptws {
+			var tr TimeRange
+			if err := tr.fromPartitionName(ptw.pt.name); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tr != ptw.pt.tr {
+				t.Fatalf("unexpected time range for partition %q; got %s; want %s", ptw.pt.name, &ptw.pt.tr, &tr)
+			}
+			names = append(names, ptw.pt.name)
+		}
+		sort.Strings(names)
+		sort.Strings(namesExpected)
+		if !reflect.DeepEqual(names, namesExpected) {
+			t.Fatalf("unexpected partitions; got %q; want %q", names, namesExpected)
+		}
+	}
+
+	now := time.Now().UnixNano() / 1e6
+	monthTimestamp := now - 45*msecPerDay
+	addRow(monthTimestamp)
+	monthName := timestampToPartitionName(monthTimestamp)
+	checkPartitions([]string{monthName})
+
+	// Switch to per-day partitions. Samples for the existing per-month partition must go there.
+	if err := SetPartitionGranularity("day"); err != nil {
+		t.Fatalf("cannot set partition granularity: %s", err)
+	}
+	addRow(monthTimestamp + 1000)
+	checkPartitions([]string{monthName})
+	namesExpected := []string{monthName}
+	for i := int64(1); i <= 3; i++ {
+		timestamp := now - i*msecPerDay
+		addRow(timestamp)
+		namesExpected = append(namesExpected, timestampToPartitionName(timestamp))
+	}
+	checkPartitions(namesExpected)
+
+	// Partitions with distinct granularities must be opened after restart.
+	tb.MustClose()
+	tb, err = openTable(path, nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, retentionMsecs)
+	if err != nil {
+		t.Fatalf("cannot re-open table: %s", err)
+	}
+	defer tb.MustClose()
+	checkPartitions(namesExpected)
+}
@@ -46,7 +46,7 @@ func benchmarkTableAddRows(b *testing.B, rowsPerInsert, tsidsCount int) {
 	b.SetBytes(int64(rowsCountExpected))
 	tablePath := "./benchmarkTableAddRows"
 	for i := 0; i < b.N; i++ {
-		tb, err := openTable(tablePath, nilGetDeletedMetricIDs, maxRetentionMsecs)
+		tb, err := openTable(tablePath, nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, maxRetentionMsecs)
 		if err != nil {
 			b.Fatalf("cannot open table %q: %s", tablePath, err)
 		}
@@ -94,7 +94,7 @@ func benchmarkTableAddRows(b *testing.B, rowsPerInsert, tsidsCount int) {
 		tb.MustClose()
 
 		// Open the table from files and verify the rows count on it
-		tb, err = openTable(tablePath, nilGetDeletedMetricIDs, maxRetentionMsecs)
+		tb, err = openTable(tablePath, nilGetDeletedMetricIDs, nilGetRetentionFilterMetricIDs, maxRetentionMsecs)
 		if err != nil {
 			b.Fatalf("cannot open table %q: %s", tablePath, err)
 		}
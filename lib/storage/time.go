@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -31,29 +32,134 @@ func (tr *TimeRange) String() string {
 	return fmt.Sprintf("[%s - %s]", minTime, maxTime)
 }
 
+// partitionGranularity is the time range covered by a single partition.
+type partitionGranularity int
+
+const (
+	partitionGranularityMonth partitionGranularity = iota
+	partitionGranularityWeek
+	partitionGranularityDay
+)
+
+// granularity is the time range covered by newly created partitions.
+var granularity = partitionGranularityMonth
+
+// SetPartitionGranularity sets the time range covered by newly created partitions.
+//
+// Supported values are `month`, `week` and `day`. Existing partitions remain readable
+// after the granularity change.
+//
+// This function must be called before OpenStorage.
+func SetPartitionGranularity(s string) error {
+	switch s {
+	case "month":
+		granularity = partitionGranularityMonth
+	case "week":
+		granularity = partitionGranularityWeek
+	case "day":
+		granularity = partitionGranularityDay
+	default:
+		return fmt.Errorf("unsupported partition granularity %q; supported values: month, week, day", s)
+	}
+	return nil
+}
+
 // timestampToPartitionName returns partition name for the given timestamp.
+//
+// The name depends on the current partition granularity:
+//
+//   - YYYY_MM for monthly partitions
+//   - YYYY_Www for weekly partitions, where ww is ISO 8601 week number
+//   - YYYY_MM_DD for daily partitions
 func timestampToPartitionName(timestamp int64) string {
 	t := timestampToTime(timestamp)
-	return t.Format("2006_01")
+	switch granularity {
+	case partitionGranularityWeek:
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%04d_W%02d", y, w)
+	case partitionGranularityDay:
+		return t.Format("2006_01_02")
+	default:
+		return t.Format("2006_01")
+	}
 }
 
 // fromPartitionName initializes tr from the given parition name.
+//
+// Partition names for all the supported granularities are accepted.
 func (tr *TimeRange) fromPartitionName(name string) error {
-	t, err := time.Parse("2006_01", name)
-	if err != nil {
-		return fmt.Errorf("cannot parse partition name %q: %w", name, err)
+	if t, err := time.Parse("2006_01", name); err == nil {
+		tr.fromPartitionTime(t)
+		return nil
 	}
-	tr.fromPartitionTime(t)
-	return nil
+	if t, err := time.Parse("2006_01_02", name); err == nil {
+		tr.fromPartitionDay(t)
+		return nil
+	}
+	if y, w, ok := parseWeekPartitionName(name); ok {
+		// Go to the Monday of the first ISO week. It is always within January 1-7 interval, which contains January 4.
+		t := time.Date(y, 1, 4, 0, 0, 0, 0, time.UTC)
+		t = t.AddDate(0, 0, -int((t.Weekday()+6)%7))
+		tr.fromPartitionWeek(t.AddDate(0, 0, 7*(w-1)))
+		if yy, ww := timestampToTime(tr.MinTimestamp).ISOWeek(); yy != y || ww != w {
+			return fmt.Errorf("cannot parse partition name %q: week %d doesn't exist in %d", name, w, y)
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot parse partition name %q; supported formats: YYYY_MM, YYYY_Www, YYYY_MM_DD", name)
+}
+
+// parseWeekPartitionName parses weekly partition name in the form YYYY_Www.
+func parseWeekPartitionName(name string) (int, int, bool) {
+	if len(name) != len("2006_W01") || name[4:6] != "_W" {
+		return 0, 0, false
+	}
+	y, err := strconv.Atoi(name[:4])
+	if err != nil || y < 0 {
+		return 0, 0, false
+	}
+	w, err := strconv.Atoi(name[6:])
+	if err != nil || w < 1 || w > 53 {
+		return 0, 0, false
+	}
+	return y, w, true
 }
 
-// fromPartitionTimestamp initializes tr from the given partition timestamp.
+// fromPartitionTimestamp initializes tr from the given partition timestamp according to the current partition granularity.
 func (tr *TimeRange) fromPartitionTimestamp(timestamp int64) {
 	t := timestampToTime(timestamp)
-	tr.fromPartitionTime(t)
+	switch granularity {
+	case partitionGranularityWeek:
+		tr.fromPartitionWeek(t)
+	case partitionGranularityDay:
+		tr.fromPartitionDay(t)
+	default:
+		tr.fromPartitionTime(t)
+	}
+}
+
+// fromPartitionWeek initializes tr from the given partition time t for weekly partition.
+//
+// Weeks start on Monday according to ISO 8601.
+func (tr *TimeRange) fromPartitionWeek(t time.Time) {
+	y, m, d := t.UTC().Date()
+	minTime := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	minTime = minTime.AddDate(0, 0, -int((minTime.Weekday()+6)%7))
+	maxTime := minTime.AddDate(0, 0, 7)
+	tr.MinTimestamp = minTime.Unix() * 1e3
+	tr.MaxTimestamp = maxTime.Unix()*1e3 - 1
+}
+
+// fromPartitionDay initializes tr from the given partition time t for daily partition.
+func (tr *TimeRange) fromPartitionDay(t time.Time) {
+	y, m, d := t.UTC().Date()
+	minTime := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	maxTime := minTime.AddDate(0, 0, 1)
+	tr.MinTimestamp = minTime.Unix() * 1e3
+	tr.MaxTimestamp = maxTime.Unix()*1e3 - 1
 }
 
-// fromPartitionTime initializes tr from the given partition time t.
+// fromPartitionTime initializes tr from the given partition time t for monthly partition.
 func (tr *TimeRange) fromPartitionTime(t time.Time) {
 	y, m, _ := t.UTC().Date()
 	minTime := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
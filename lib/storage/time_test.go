@@ -52,3 +52,83 @@ func testTimeRangeFromPartition(t *testing.T, initialTime time.Time) {
 		t.Fatalf("unexpected nextY, nextM; got %d, %d; want %d, %d+1;\nnextTime=%s\nmaxTime=%s", nextY, nextM, maxY, maxM, nextTime, maxTime)
 	}
 }
+
+func TestPartitionNameGranularity(t *testing.T) {
+	defer func() {
+		if err := SetPartitionGranularity("month"); err != nil {
+			t.Fatalf("cannot restore partition granularity: %s", err)
+		}
+	}()
+	f := func(granularity string, timestamp int64, nameExpected string) {
+		t.Helper()
+		if err := SetPartitionGranularity(granularity); err != nil {
+			t.Fatalf("cannot set partition granularity: %s", err)
+		}
+		name := timestampToPartitionName(timestamp)
+		if name != nameExpected {
+			t.Fatalf("unexpected partition name; got %q; want %q", name, nameExpected)
+		}
+		var tr, trExpected TimeRange
+		if err := tr.fromPartitionName(name); err != nil {
+			t.Fatalf("cannot parse partition name %q: %s", name, err)
+		}
+		trExpected.fromPartitionTimestamp(timestamp)
+		if tr != trExpected {
+			t.Fatalf("unexpected time range for partition %q; got %s; want %s", name, &tr, &trExpected)
+		}
+		if timestamp < tr.MinTimestamp || timestamp > tr.MaxTimestamp {
+			t.Fatalf("time range %s for partition %q doesn't contain timestamp %d", &tr, name, timestamp)
+		}
+		if s := timestampToPartitionName(tr.MinTimestamp); s != name {
+			t.Fatalf("unexpected partition name for MinTimestamp; got %q; want %q", s, name)
+		}
+		if s := timestampToPartitionName(tr.MaxTimestamp); s != name {
+			t.Fatalf("unexpected partition name for MaxTimestamp; got %q; want %q", s, name)
+		}
+		if s := timestampToPartitionName(tr.MinTimestamp - 1); s == name {
+			t.Fatalf("the previous millisecond before MinTimestamp mustn't belong to partition %q", name)
+		}
+		if s := timestampToPartitionName(tr.MaxTimestamp + 1); s == name {
+			t.Fatalf("the next millisecond after MaxTimestamp mustn't belong to partition %q", name)
+		}
+	}
+	ts := func(s string) int64 {
+		t.Helper()
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", s, err)
+		}
+		return timestampFromTime(tm)
+	}
+	f("month", ts("2022-02-03T10:00:00Z"), "2022_02")
+	f("day", ts("2022-02-03T10:00:00Z"), "2022_02_03")
+	f("day", ts("2020-02-29T23:59:59Z"), "2020_02_29")
+	f("week", ts("2022-02-03T10:00:00Z"), "2022_W05")
+	f("week", ts("2021-01-01T00:00:00Z"), "2020_W53")
+	f("week", ts("2024-12-30T00:00:00Z"), "2025_W01")
+
+	// Verify week and day partitions for every hour during a few years.
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, granularity := range []string{"week", "day"} {
+		for i := 0; i < 24*365*3; i += 7 {
+			timestamp := timestampFromTime(start.Add(time.Hour * time.Duration(i)))
+			if err := SetPartitionGranularity(granularity); err != nil {
+				t.Fatalf("cannot set partition granularity: %s", err)
+			}
+			f(granularity, timestamp, timestampToPartitionName(timestamp))
+		}
+	}
+
+	// Invalid names
+	for _, name := range []string{"", "2022", "2022_13", "2022_W00", "2022_W54", "2021_W53", "2022_02_30", "2022_02_03_04", "abcd_W01"} {
+		var tr TimeRange
+		if err := tr.fromPartitionName(name); err == nil {
+			t.Fatalf("expecting non-nil error for partition name %q", name)
+		}
+	}
+
+	// Invalid granularity
+	if err := SetPartitionGranularity("year"); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported partition granularity")
+	}
+}
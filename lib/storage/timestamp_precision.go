@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+// SetTimestampPrecision sets the precision for timestamps stored in MetricRow.Timestamp and in data blocks.
+//
+// Supported values are `ms`, `us` and `ns`. TimeRange, partitions, retention and dedup intervals remain in milliseconds.
+// Use TimestampToMsecs and TimestampFromMsecs for converting between stored timestamps and milliseconds.
+//
+// This function must be called before OpenStorage.
+func SetTimestampPrecision(precision string) error {
+	n, err := ParseTimestampPrecision(precision)
+	if err != nil {
+		return err
+	}
+	globalTimestampPrecision = precision
+	globalTimestampsPerMsec = n
+	return nil
+}
+
+// GetTimestampPrecision returns the precision set via SetTimestampPrecision.
+func GetTimestampPrecision() string {
+	return globalTimestampPrecision
+}
+
+// TimestampsPerMsec returns the number of stored timestamp units per millisecond.
+func TimestampsPerMsec() int64 {
+	return globalTimestampsPerMsec
+}
+
+var (
+	globalTimestampPrecision       = "ms"
+	globalTimestampsPerMsec  int64 = 1
+)
+
+// ParseTimestampPrecision returns the number of timestamp units per millisecond for the given precision.
+//
+// Supported precisions are `ms`, `us` and `ns`.
+func ParseTimestampPrecision(precision string) (int64, error) {
+	switch precision {
+	case "ms":
+		return 1, nil
+	case "us":
+		return 1e3, nil
+	case "ns":
+		return 1e6, nil
+	default:
+		return 0, fmt.Errorf("unsupported timestamp precision %q; supported values: ms, us, ns", precision)
+	}
+}
+
+// TimestampToMsecs converts the stored timestamp to milliseconds.
+func TimestampToMsecs(timestamp int64) int64 {
+	return ConvertTimestamp(timestamp, globalTimestampsPerMsec, 1)
+}
+
+// TimestampFromMsecs converts msecs to the stored timestamp.
+func TimestampFromMsecs(msecs int64) int64 {
+	return ConvertTimestamp(msecs, 1, globalTimestampsPerMsec)
+}
+
+// TimestampsToMsecs converts stored timestamps to milliseconds in place.
+func TimestampsToMsecs(timestamps []int64) {
+	ConvertTimestamps(timestamps, globalTimestampsPerMsec, 1)
+}
+
+// ConvertTimestamps converts timestamps in place from srcTimestampsPerMsec units to dstTimestampsPerMsec units.
+func ConvertTimestamps(timestamps []int64, srcTimestampsPerMsec, dstTimestampsPerMsec int64) {
+	if srcTimestampsPerMsec == dstTimestampsPerMsec {
+		return
+	}
+	for i, timestamp := range timestamps {
+		timestamps[i] = ConvertTimestamp(timestamp, srcTimestampsPerMsec, dstTimestampsPerMsec)
+	}
+}
+
+// ConvertTimestamp converts timestamp from srcTimestampsPerMsec units to dstTimestampsPerMsec units.
+//
+// The timestamp is rounded down when converting to lower precision,
+// so the order of converted timestamps is preserved.
+func ConvertTimestamp(timestamp, srcTimestampsPerMsec, dstTimestampsPerMsec int64) int64 {
+	if srcTimestampsPerMsec == dstTimestampsPerMsec {
+		return timestamp
+	}
+	if srcTimestampsPerMsec > dstTimestampsPerMsec {
+		n := srcTimestampsPerMsec / dstTimestampsPerMsec
+		q := timestamp / n
+		if timestamp%n < 0 {
+			q--
+		}
+		return q
+	}
+	n := dstTimestampsPerMsec / srcTimestampsPerMsec
+	if timestamp > math.MaxInt64/n {
+		return math.MaxInt64
+	}
+	if timestamp < math.MinInt64/n {
+		return math.MinInt64
+	}
+	return timestamp * n
+}
+
+// toTimestamps returns tr converted from milliseconds to timestampsPerMsec units.
+//
+// The returned time range covers all the timestamps inside the last millisecond of tr.
+func (tr *TimeRange) toTimestamps(timestampsPerMsec int64) TimeRange {
+	return TimeRange{
+		MinTimestamp: ConvertTimestamp(tr.MinTimestamp, 1, timestampsPerMsec),
+		MaxTimestamp: lastTimestampInMsec(tr.MaxTimestamp, timestampsPerMsec),
+	}
+}
+
+// lastTimestampInMsec returns the biggest timestamp in timestampsPerMsec units inside the given millisecond.
+func lastTimestampInMsec(msecs, timestampsPerMsec int64) int64 {
+	timestamp := ConvertTimestamp(msecs, 1, timestampsPerMsec)
+	if timestamp > math.MaxInt64-timestampsPerMsec+1 {
+		return math.MaxInt64
+	}
+	return timestamp + timestampsPerMsec - 1
+}
+
+// msecsTimeRange returns time range in milliseconds for the given stored timestamps.
+func msecsTimeRange(minTimestamp, maxTimestamp int64) TimeRange {
+	return TimeRange{
+		MinTimestamp: TimestampToMsecs(minTimestamp),
+		MaxTimestamp: TimestampToMsecs(maxTimestamp),
+	}
+}
+
+// timestampPrecisionFilename is the name of the file in the metadata directory, which contains the precision for the stored timestamps.
+const timestampPrecisionFilename = "timestampPrecision"
+
+// checkTimestampPrecision verifies that the data at metadataDir has been stored with the precision set via SetTimestampPrecision.
+//
+// The precision is saved at metadataDir if it is missing there, so it cannot be changed for the existing data afterwards.
+func checkTimestampPrecision(metadataDir string, isEmptyDB, isReadOnly bool) error {
+	path := metadataDir + "/" + timestampPrecisionFilename
+	precision, err := loadTimestampPrecision(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.IsNotExist(err) {
+		if isEmptyDB {
+			precision = globalTimestampPrecision
+		} else {
+			// The data has been stored before the timestamp precision has been introduced, so it has millisecond precision.
+			precision = "ms"
+		}
+		if !isReadOnly {
+			if err := fs.WriteFileAtomically(path, []byte(precision)); err != nil {
+				return fmt.Errorf("cannot store timestamp precision: %w", err)
+			}
+		}
+	}
+	if precision != globalTimestampPrecision {
+		return fmt.Errorf("cannot use timestamp precision %q for the data stored with timestamp precision %q; "+
+			"the timestamp precision cannot be changed for the existing data; see -storage.timestampPrecision command-line flag", globalTimestampPrecision, precision)
+	}
+	return nil
+}
+
+func loadTimestampPrecision(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	precision := string(bytes.TrimSpace(data))
+	if _, err := ParseTimestampPrecision(precision); err != nil {
+		return "", fmt.Errorf("invalid contents of %q: %w", path, err)
+	}
+	return precision, nil
+}
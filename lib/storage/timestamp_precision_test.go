@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvertTimestamp(t *testing.T) {
+	f := func(timestamp, srcTimestampsPerMsec, dstTimestampsPerMsec, resultExpected int64) {
+		t.Helper()
+		result := ConvertTimestamp(timestamp, srcTimestampsPerMsec, dstTimestampsPerMsec)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for ConvertTimestamp(%d, %d, %d); got %d; want %d",
+				timestamp, srcTimestampsPerMsec, dstTimestampsPerMsec, result, resultExpected)
+		}
+	}
+	f(123, 1, 1, 123)
+	f(123, 1, 1e6, 123e6)
+	f(123456789, 1e6, 1, 123)
+	f(123456789, 1e6, 1e3, 123456)
+	f(123456, 1e3, 1e6, 123456000)
+
+	// Negative timestamps must be rounded down.
+	f(-1, 1e6, 1, -1)
+	f(-1e6, 1e6, 1, -1)
+	f(-1e6-1, 1e6, 1, -2)
+
+	// Overflow must be saturated.
+	f(math.MaxInt64/1000, 1, 1e6, math.MaxInt64)
+	f(math.MinInt64/1000, 1, 1e6, math.MinInt64)
+}
+
+func TestTimeRangeToTimestamps(t *testing.T) {
+	f := func(tr TimeRange, timestampsPerMsec int64, trExpected TimeRange) {
+		t.Helper()
+		result := tr.toTimestamps(timestampsPerMsec)
+		if result != trExpected {
+			t.Fatalf("unexpected time range for %d timestamps per msec; got %+v; want %+v", timestampsPerMsec, result, trExpected)
+		}
+	}
+	f(TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, 1, TimeRange{MinTimestamp: 10, MaxTimestamp: 20})
+	f(TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, 1e3, TimeRange{MinTimestamp: 10000, MaxTimestamp: 20999})
+	f(TimeRange{MinTimestamp: 0, MaxTimestamp: math.MaxInt64}, 1e6, TimeRange{MinTimestamp: 0, MaxTimestamp: math.MaxInt64})
+}
+
+func TestStorageTimestampPrecision(t *testing.T) {
+	if err := SetTimestampPrecision("ns"); err != nil {
+		t.Fatalf("cannot set timestamp precision: %s", err)
+	}
+	defer func() {
+		if err := SetTimestampPrecision("ms"); err != nil {
+			t.Fatalf("cannot restore timestamp precision: %s", err)
+		}
+	}()
+
+	path := "TestStorageTimestampPrecision"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+
+	// Add samples, which belong to the same millisecond.
+	var mn MetricName
+	mn.MetricGroup = []byte("metric")
+	metricNameRaw := mn.marshalRaw(nil)
+	msecs := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	var timestampsExpected []int64
+	for i := 0; i < 100; i++ {
+		timestamp := msecs*1e6 + int64(i)*1000 + 1
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: metricNameRaw,
+			Timestamp:     timestamp,
+			Value:         float64(i),
+		})
+		timestampsExpected = append(timestampsExpected, timestamp)
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	s.DebugFlush()
+
+	searchTimestamps := func(tr TimeRange) []int64 {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric"), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		var sr Search
+		sr.Init(nil, s, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
+		defer sr.MustClose()
+		var b Block
+		var timestamps []int64
+		var values []float64
+		for sr.NextMetricBlock() {
+			sr.MetricBlockRef.BlockRef.MustReadBlock(&b, true)
+			if err := b.UnmarshalData(); err != nil {
+				t.Fatalf("cannot unmarshal block: %s", err)
+			}
+			timestamps, values = b.AppendRowsWithTimeRangeFilter(timestamps, values, tr)
+		}
+		if err := sr.Error(); err != nil {
+			t.Fatalf("search error: %s", err)
+		}
+		return timestamps
+	}
+	checkTimestamps := func() {
+		t.Helper()
+		timestamps := searchTimestamps(TimeRange{
+			MinTimestamp: msecs,
+			MaxTimestamp: msecs,
+		})
+		if !reflect.DeepEqual(timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps;\ngot\n%d\nwant\n%d", timestamps, timestampsExpected)
+		}
+		timestamps = searchTimestamps(TimeRange{
+			MinTimestamp: msecs + 1,
+			MaxTimestamp: msecs + 3600*1000,
+		})
+		if len(timestamps) > 0 {
+			t.Fatalf("unexpected timestamps found outside the searched time range: %d", timestamps)
+		}
+	}
+	checkTimestamps()
+
+	// Sub-millisecond timestamps must survive merges.
+	if err := s.ForceMergePartitions(""); err != nil {
+		t.Fatalf("cannot force merge partitions: %s", err)
+	}
+	checkTimestamps()
+	s.MustClose()
+
+	// The storage cannot be opened with distinct timestamp precision.
+	if err := SetTimestampPrecision("ms"); err != nil {
+		t.Fatalf("cannot set timestamp precision: %s", err)
+	}
+	if _, err := OpenStorage(path, 0, 0, 0); err == nil {
+		t.Fatalf("expecting non-nil error when opening the storage with distinct timestamp precision")
+	}
+	if err := SetTimestampPrecision("ns"); err != nil {
+		t.Fatalf("cannot set timestamp precision: %s", err)
+	}
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage: %s", err)
+	}
+	checkTimestamps()
+	s.MustClose()
+}
+
+func TestBlockMarshalPortableExt(t *testing.T) {
+	if err := SetTimestampPrecision("us"); err != nil {
+		t.Fatalf("cannot set timestamp precision: %s", err)
+	}
+	defer func() {
+		if err := SetTimestampPrecision("ms"); err != nil {
+			t.Fatalf("cannot restore timestamp precision: %s", err)
+		}
+	}()
+	timestamps := []int64{1000000, 1000500, 1001000, 1002999}
+	values := []int64{1, 2, 3, 4}
+	var b Block
+	b.Init(&TSID{}, timestamps, values, 0, defaultPrecisionBits)
+	b.MarshalData(0, 0)
+
+	f := func(timestampsPerMsec int64, timestampsExpected []int64) {
+		t.Helper()
+		var bb Block
+		bb.CopyFrom(&b)
+		data := bb.MarshalPortableExt(nil, timestampsPerMsec)
+		var b2 Block
+		tail, err := b2.UnmarshalPortable(data)
+		if err != nil {
+			t.Fatalf("cannot unmarshal block: %s", err)
+		}
+		if len(tail) > 0 {
+			t.Fatalf("unexpected non-empty tail left: %X", tail)
+		}
+		tr := TimeRange{
+			MinTimestamp: 0,
+			MaxTimestamp: math.MaxInt64,
+		}
+		timestamps, _ := b2.AppendRowsWithTimeRangeFilterExt(nil, nil, tr, timestampsPerMsec)
+		if !reflect.DeepEqual(timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps for %d timestamps per msec;\ngot\n%d\nwant\n%d", timestampsPerMsec, timestamps, timestampsExpected)
+		}
+	}
+	f(1e3, timestamps)
+	f(1, []int64{1000, 1000, 1001, 1002})
+	f(1e6, []int64{1000000000, 1000500000, 1001000000, 1002999000})
+}
+
+func TestPartHeaderTimestampPrecision(t *testing.T) {
+	defer func() {
+		if err := SetTimestampPrecision("ms"); err != nil {
+			t.Fatalf("cannot restore timestamp precision: %s", err)
+		}
+	}()
+	f := func(precision string, minTimestamp, maxTimestamp int64) {
+		t.Helper()
+		if err := SetTimestampPrecision(precision); err != nil {
+			t.Fatalf("cannot set timestamp precision: %s", err)
+		}
+		ph := partHeader{
+			RowsCount:    10,
+			BlocksCount:  2,
+			MinTimestamp: minTimestamp,
+			MaxTimestamp: maxTimestamp,
+		}
+		var ph2 partHeader
+		if err := ph2.ParseFromPath(ph.Path("foo", 123)); err != nil {
+			t.Fatalf("cannot parse part header: %s", err)
+		}
+		if ph2 != ph {
+			t.Fatalf("unexpected part header for precision %q;\ngot\n%+v\nwant\n%+v", precision, &ph2, &ph)
+		}
+	}
+	f("ms", 1600000000123, 1600000000456)
+	f("us", 1600000000123456, 1600000000456789)
+	f("ns", 1600000000123456789, 1600000000456789012)
+}
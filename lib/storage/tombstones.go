@@ -0,0 +1,522 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+)
+
+// tombstonesFilename is the name of the file with partition tombstones.
+//
+// The file is stored in the big parts directory of the partition.
+const tombstonesFilename = "tombstones.bin"
+
+// tombstone marks samples for the given metricIDs on the given time range as deleted.
+//
+// The tombstone applies only to parts with part.mergeIdx smaller than tombstone.mergeIdx,
+// i.e. to parts, which have been created before the tombstone. This guarantees that samples
+// ingested into the deleted time range after the deletion remain visible.
+type tombstone struct {
+	tr TimeRange
+
+	// mergeIdx is the partition merge index at the time the tombstone has been created.
+	mergeIdx uint64
+
+	// metricIDs contains sorted metricIDs for the deleted series.
+	metricIDs []uint64
+
+	m *uint64set.Set
+}
+
+func newTombstone(metricIDs []uint64, tr TimeRange, mergeIdx uint64) *tombstone {
+	a := append([]uint64{}, metricIDs...)
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	m := &uint64set.Set{}
+	m.AddMulti(a)
+	return &tombstone{
+		tr:        tr,
+		mergeIdx:  mergeIdx,
+		metricIDs: a,
+		m:         m,
+	}
+}
+
+func (t *tombstone) marshal(dst []byte) []byte {
+	dst = encoding.MarshalInt64(dst, t.tr.MinTimestamp)
+	dst = encoding.MarshalInt64(dst, t.tr.MaxTimestamp)
+	dst = encoding.MarshalUint64(dst, t.mergeIdx)
+	dst = encoding.MarshalUint64(dst, uint64(len(t.metricIDs)))
+	for _, metricID := range t.metricIDs {
+		dst = encoding.MarshalUint64(dst, metricID)
+	}
+	return dst
+}
+
+func unmarshalTombstone(src []byte) (*tombstone, []byte, error) {
+	if len(src) < 32 {
+		return nil, src, fmt.Errorf("cannot unmarshal tombstone header from %d bytes; need at least 32 bytes", len(src))
+	}
+	var tr TimeRange
+	tr.MinTimestamp = encoding.UnmarshalInt64(src)
+	tr.MaxTimestamp = encoding.UnmarshalInt64(src[8:])
+	mergeIdx := encoding.UnmarshalUint64(src[16:])
+	n := encoding.UnmarshalUint64(src[24:])
+	src = src[32:]
+	if uint64(len(src))/8 < n {
+		return nil, src, fmt.Errorf("cannot unmarshal %d metricIDs from %d bytes", n, len(src))
+	}
+	metricIDs := make([]uint64, n)
+	for i := range metricIDs {
+		metricIDs[i] = encoding.UnmarshalUint64(src)
+		src = src[8:]
+	}
+	return newTombstone(metricIDs, tr, mergeIdx), src, nil
+}
+
+// tombstones is an immutable list of tombstones for a partition.
+type tombstones struct {
+	items []*tombstone
+}
+
+// hasItems returns true if tss contains at least a single tombstone.
+//
+// It is safe calling hasItems on nil tss.
+func (tss *tombstones) hasItems() bool {
+	return tss != nil && len(tss.items) > 0
+}
+
+// forPart returns tombstones from tss, which apply to p.
+//
+// nil is returned if no tombstones apply to p.
+func (tss *tombstones) forPart(p *part) *tombstones {
+	if !tss.hasItems() {
+		return nil
+	}
+	n := 0
+	for _, t := range tss.items {
+		if p.mergeIdx < t.mergeIdx {
+			n++
+		}
+	}
+	if n == len(tss.items) {
+		// Fast path - all the tombstones apply to p.
+		return tss
+	}
+	if n == 0 {
+		// Fast path - p has been created after all the tombstones.
+		return nil
+	}
+	tssPart := &tombstones{
+		items: make([]*tombstone, 0, n),
+	}
+	for _, t := range tss.items {
+		if p.mergeIdx < t.mergeIdx {
+			tssPart.items = append(tssPart.items, t)
+		}
+	}
+	return tssPart
+}
+
+// appliesTo returns true if tss contains tombstones, which may delete samples from p.
+func (tss *tombstones) appliesTo(p *part) bool {
+	if !tss.hasItems() {
+		return false
+	}
+	tr := msecsTimeRange(p.ph.MinTimestamp, p.ph.MaxTimestamp)
+	for _, t := range tss.items {
+		if t.appliesTo(p.mergeIdx, tr) {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo returns true if t may delete samples from the part with the given mergeIdx and the given time range tr in milliseconds.
+func (t *tombstone) appliesTo(mergeIdx uint64, tr TimeRange) bool {
+	return mergeIdx < t.mergeIdx && t.tr.MinTimestamp <= tr.MaxTimestamp && t.tr.MaxTimestamp >= tr.MinTimestamp
+}
+
+// appendTimeRanges appends deleted time ranges for the given metricID, which intersect tr, to dst and returns the result.
+func (tss *tombstones) appendTimeRanges(dst []TimeRange, metricID uint64, tr TimeRange) []TimeRange {
+	if !tss.hasItems() {
+		return dst
+	}
+	for _, t := range tss.items {
+		if t.tr.MinTimestamp > tr.MaxTimestamp || t.tr.MaxTimestamp < tr.MinTimestamp {
+			continue
+		}
+		if t.m.Has(metricID) {
+			dst = append(dst, t.tr)
+		}
+	}
+	return dst
+}
+
+// covers returns true if all the samples for the given metricID on tr are deleted.
+func (tss *tombstones) covers(metricID uint64, tr TimeRange) bool {
+	if !tss.hasItems() {
+		return false
+	}
+	for _, t := range tss.items {
+		if t.tr.MinTimestamp <= tr.MinTimestamp && t.tr.MaxTimestamp >= tr.MaxTimestamp && t.m.Has(metricID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (tss *tombstones) marshal(dst []byte) []byte {
+	for _, t := range tss.items {
+		dst = t.marshal(dst)
+	}
+	return dst
+}
+
+func unmarshalTombstones(src []byte) (*tombstones, error) {
+	tss := &tombstones{}
+	for len(src) > 0 {
+		t, tail, err := unmarshalTombstone(src)
+		if err != nil {
+			return nil, err
+		}
+		src = tail
+		tss.items = append(tss.items, t)
+	}
+	return tss, nil
+}
+
+// removeDeletedSamples removes samples on the deleted time ranges drs from timestamps and values and returns the result.
+//
+// timestamps and values are modified in place.
+func removeDeletedSamples(timestamps, values []int64, drs []TimeRange) ([]int64, []int64) {
+	if len(drs) == 0 {
+		return timestamps, values
+	}
+	dstTimestamps := timestamps[:0]
+	dstValues := values[:0]
+	for i, ts := range timestamps {
+		if isDeletedTimestamp(ts, drs) {
+			continue
+		}
+		dstTimestamps = append(dstTimestamps, ts)
+		dstValues = append(dstValues, values[i])
+	}
+	return dstTimestamps, dstValues
+}
+
+// applyTombstones removes samples deleted by tss from b.
+//
+// tss must contain only tombstones, which apply to the part b belongs to. See tombstones.forPart.
+//
+// false is returned if all the samples in b are deleted.
+func applyTombstones(b *Block, tss *tombstones, rowsDeleted *uint64) (bool, error) {
+	bh := &b.bh
+	tr := msecsTimeRange(bh.MinTimestamp, bh.MaxTimestamp)
+	if tss.covers(bh.TSID.MetricID, tr) {
+		atomic.AddUint64(rowsDeleted, uint64(b.rowsCount()))
+		return false, nil
+	}
+	drs := tss.appendTimeRanges(nil, bh.TSID.MetricID, tr)
+	if len(drs) == 0 {
+		return true, nil
+	}
+	if err := b.UnmarshalData(); err != nil {
+		return false, err
+	}
+	srcTimestamps := b.timestamps[b.nextIdx:]
+	timestamps, values := removeDeletedSamples(srcTimestamps, b.values[b.nextIdx:], drs)
+	atomic.AddUint64(rowsDeleted, uint64(len(srcTimestamps)-len(timestamps)))
+	b.timestamps = b.timestamps[:b.nextIdx+len(timestamps)]
+	b.values = b.values[:b.nextIdx+len(values)]
+	if len(timestamps) == 0 {
+		return false, nil
+	}
+	b.fixupTimestamps()
+	return true, nil
+}
+
+func isDeletedTimestamp(timestamp int64, drs []TimeRange) bool {
+	// Deleted time ranges are in milliseconds.
+	timestamp = TimestampToMsecs(timestamp)
+	for _, tr := range drs {
+		if timestamp >= tr.MinTimestamp && timestamp <= tr.MaxTimestamp {
+			return true
+		}
+	}
+	return false
+}
+
+// mustLoadTombstones loads tombstones for pt from disk.
+func (pt *partition) mustLoadTombstones() {
+	path := pt.bigPartsPath + "/" + tombstonesFilename
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Panicf("FATAL: cannot read tombstones from %q: %s", path, err)
+		}
+		pt.tombstones.Store(&tombstones{})
+		return
+	}
+	tss, err := unmarshalTombstones(data)
+	if err != nil {
+		logger.Panicf("FATAL: cannot unmarshal tombstones from %q: %s", path, err)
+	}
+	pt.tombstones.Store(tss)
+}
+
+func (pt *partition) getTombstones() *tombstones {
+	v := pt.tombstones.Load()
+	if v == nil {
+		return nil
+	}
+	return v.(*tombstones)
+}
+
+// storeTombstones persists tss to disk and makes it visible to searches and merges.
+//
+// pt.tombstonesLock must be locked by the caller.
+func (pt *partition) storeTombstones(tss *tombstones) error {
+	path := pt.bigPartsPath + "/" + tombstonesFilename
+	if len(tss.items) == 0 {
+		fs.MustRemoveAll(path)
+		pt.tombstones.Store(tss)
+		return nil
+	}
+	// The file must be atomically replaced instead of being modified in place,
+	// since it may be hard-linked into snapshots. The old file mustn't be removed before the replacement,
+	// since otherwise the deleted samples may become visible after unclean shutdown.
+	if err := fs.ReplaceFileAtomically(path, tss.marshal(nil)); err != nil {
+		return fmt.Errorf("cannot store tombstones to %q: %w", path, err)
+	}
+	pt.tombstones.Store(tss)
+	return nil
+}
+
+// addTombstone marks samples for metricIDs on tr as deleted in pt.
+//
+// Only samples added to pt before the call are deleted.
+func (pt *partition) addTombstone(metricIDs []uint64, tr TimeRange) error {
+	if tr.MinTimestamp < pt.tr.MinTimestamp {
+		tr.MinTimestamp = pt.tr.MinTimestamp
+	}
+	if tr.MaxTimestamp > pt.tr.MaxTimestamp {
+		tr.MaxTimestamp = pt.tr.MaxTimestamp
+	}
+
+	// Convert pending rows to parts, so they are covered by the tombstone.
+	// This must be performed without holding pt.tombstonesLock, since the conversion may start assisted merges.
+	pt.flushRawRows(true)
+
+	pt.tombstonesLock.Lock()
+	defer pt.tombstonesLock.Unlock()
+
+	tssOld := pt.getTombstones()
+	tss := &tombstones{}
+	if tssOld != nil {
+		tss.items = append(tss.items, tssOld.items...)
+	}
+	// The tombstone applies to all the parts created before this point, including parts for merges in progress,
+	// since they obtain mergeIdx together with tombstones under pt.tombstonesLock. See partition.mergeParts.
+	tss.items = append(tss.items, newTombstone(metricIDs, tr, pt.nextMergeIdx()))
+	return pt.storeTombstones(tss)
+}
+
+// activePartitionTombstonesMergeInterval is the minimum interval between tombstones merges for the partition,
+// which may still receive new samples.
+var activePartitionTombstonesMergeInterval = time.Hour
+
+// runTombstonesMerge merges parts in pt, which contain samples deleted by tombstones.
+//
+// This physically removes the deleted samples, so the applied tombstones are dropped afterwards.
+func (pt *partition) runTombstonesMerge() error {
+	tss := pt.getTombstones()
+	if !tss.hasItems() {
+		return nil
+	}
+	currentTimestamp := int64(fasttime.UnixTimestamp()) * 1000
+	prevTimestamp := atomic.LoadInt64(&pt.tombstonesMergeTimestamp)
+	if !needTombstonesMerge(pt.tr, prevTimestamp, currentTimestamp) {
+		return nil
+	}
+	// Flush pending rows, so they are merged together with the rest of parts.
+	pt.flushRawRows(true)
+
+	t := time.Now()
+	logger.Infof("starting tombstones merge for partition %s", pt.bigPartsPath)
+	// Merge only parts, which may contain the deleted samples. Parts, which are merged at the moment, are skipped.
+	// They are replaced with the merged parts, which either have no deleted samples or are merged during the next run.
+	ok, err := pt.mergeMatchingParts(func(pw *partWrapper) bool {
+		return tss.appliesTo(pw.p)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot apply tombstones to partition %s: %w", pt.bigPartsPath, err)
+	}
+	if !ok {
+		logger.Infof("postponing tombstones merge for partition %s, since it cannot be started now", pt.bigPartsPath)
+		return nil
+	}
+	atomic.StoreInt64(&pt.tombstonesMergeTimestamp, currentTimestamp)
+
+	// Drop tombstones, which don't apply to any of the remaining parts.
+	// Tombstones added during the merge are kept, since they apply to the merged parts.
+	// Parts for merges in progress are kept in pt until the merge is finished, so tombstones for them are kept too.
+	pt.tombstonesLock.Lock()
+	defer pt.tombstonesLock.Unlock()
+	tssCurr := pt.getTombstones()
+	tssNew := &tombstones{}
+	pt.partsLock.Lock()
+	for _, t := range tssCurr.items {
+		if hasPartsForTombstone(pt.smallParts, t) || hasPartsForTombstone(pt.bigParts, t) {
+			tssNew.items = append(tssNew.items, t)
+		}
+	}
+	pt.partsLock.Unlock()
+	if len(tssNew.items) < len(tssCurr.items) {
+		if err := pt.storeTombstones(tssNew); err != nil {
+			return err
+		}
+		atomic.AddUint64(&pt.tombstonesApplied, uint64(len(tssCurr.items)-len(tssNew.items)))
+	}
+	logger.Infof("tombstones merge for partition %s has been finished in %.3f seconds", pt.bigPartsPath, time.Since(t).Seconds())
+	return nil
+}
+
+// needTombstonesMerge returns true if tombstones merge must be performed for the partition with the given tr
+// at currentTimestamp if the previous tombstones merge has been performed at prevTimestamp.
+//
+// The partition, which may still receive new samples, is merged at most once per activePartitionTombstonesMergeInterval,
+// since new tombstones may be frequently added to it. Other partitions are merged immediately.
+func needTombstonesMerge(tr TimeRange, prevTimestamp, currentTimestamp int64) bool {
+	if tr.MaxTimestamp < currentTimestamp {
+		return true
+	}
+	return currentTimestamp-prevTimestamp >= activePartitionTombstonesMergeInterval.Milliseconds()
+}
+
+func hasPartsForTombstone(pws []*partWrapper, t *tombstone) bool {
+	for _, pw := range pws {
+		p := pw.p
+		if t.appliesTo(p.mergeIdx, msecsTimeRange(p.ph.MinTimestamp, p.ph.MaxTimestamp)) {
+			return true
+		}
+	}
+	return false
+}
+
+// adjustMergeIdx makes sure the next merge index for pt exceeds merge indexes for the existing parts and tombstones.
+//
+// This prevents from applying the existing tombstones to new parts if the system clock goes back after restart.
+func (pt *partition) adjustMergeIdx() {
+	maxMergeIdx := uint64(0)
+	pt.partsLock.Lock()
+	for _, pws := range [][]*partWrapper{pt.smallParts, pt.bigParts} {
+		for _, pw := range pws {
+			if pw.p.mergeIdx > maxMergeIdx {
+				maxMergeIdx = pw.p.mergeIdx
+			}
+		}
+	}
+	pt.partsLock.Unlock()
+	if tss := pt.getTombstones(); tss != nil {
+		for _, t := range tss.items {
+			if t.mergeIdx > maxMergeIdx {
+				maxMergeIdx = t.mergeIdx
+			}
+		}
+	}
+	for {
+		mergeIdx := atomic.LoadUint64(&pt.mergeIdx)
+		if mergeIdx >= maxMergeIdx || atomic.CompareAndSwapUint64(&pt.mergeIdx, mergeIdx, maxMergeIdx) {
+			return
+		}
+	}
+}
+
+// addTombstone marks samples for metricIDs on tr as deleted in all the partitions intersecting tr.
+func (tb *table) addTombstone(metricIDs []uint64, tr TimeRange) error {
+	tb.ptsMoveLock.RLock()
+	defer tb.ptsMoveLock.RUnlock()
+
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+	for _, ptw := range ptws {
+		pt := ptw.pt
+		if pt.tr.MinTimestamp > tr.MaxTimestamp || pt.tr.MaxTimestamp < tr.MinTimestamp {
+			continue
+		}
+		if err := pt.addTombstone(metricIDs, tr); err != nil {
+			return fmt.Errorf("cannot add tombstone to partition %s: %w", pt.name, err)
+		}
+	}
+	return nil
+}
+
+func (tb *table) startTombstonesMergeWatcher() {
+	tb.tombstonesMergeWatcherWG.Add(1)
+	go func() {
+		tb.tombstonesMergeWatcher()
+		tb.tombstonesMergeWatcherWG.Done()
+	}()
+}
+
+var tombstonesMergeInterval = 10 * time.Minute
+
+func (tb *table) tombstonesMergeWatcher() {
+	f := func() {
+		ptws := tb.GetPartitions(nil)
+		defer tb.PutPartitions(ptws)
+		for _, ptw := range ptws {
+			if err := ptw.pt.runTombstonesMerge(); err != nil {
+				logger.Errorf("cannot apply tombstones to partition %s: %s", ptw.pt.name, err)
+				continue
+			}
+		}
+	}
+	t := time.NewTicker(tombstonesMergeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-tb.stop:
+			return
+		case <-t.C:
+			f()
+		}
+	}
+}
+
+// DeleteSeriesOnTimeRange deletes samples on the given tr for series matching tfss.
+//
+// Deleted samples are marked with per-partition tombstones, so they are immediately
+// hidden from search results. They are physically removed during background merges.
+// Samples added on tr after the call aren't deleted.
+//
+// Returns the number of series with deleted samples.
+func (s *Storage) DeleteSeriesOnTimeRange(tfss []*TagFilters, tr TimeRange) (int, error) {
+	if s.isReadOnlyReplica {
+		return 0, ErrReadOnlyReplica
+	}
+	if tr.MinTimestamp > tr.MaxTimestamp {
+		return 0, fmt.Errorf("start=%d cannot exceed end=%d", tr.MinTimestamp, tr.MaxTimestamp)
+	}
+	m, err := s.searchMetricIDsOnTimeRange(tfss, tr)
+	if err != nil {
+		return 0, fmt.Errorf("cannot search series to delete: %w", err)
+	}
+	metricIDs := m.AppendTo(nil)
+	if len(metricIDs) == 0 {
+		return 0, nil
+	}
+	if err := s.tb.addTombstone(metricIDs, tr); err != nil {
+		return 0, err
+	}
+	return len(metricIDs), nil
+}
@@ -0,0 +1,388 @@
+package storage
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTombstonesMarshalUnmarshal(t *testing.T) {
+	f := func(tss *tombstones) {
+		t.Helper()
+		data := tss.marshal(nil)
+		tss2, err := unmarshalTombstones(data)
+		if err != nil {
+			t.Fatalf("cannot unmarshal tombstones: %s", err)
+		}
+		if len(tss2.items) != len(tss.items) {
+			t.Fatalf("unexpected number of tombstones; got %d; want %d", len(tss2.items), len(tss.items))
+		}
+		for i, t1 := range tss.items {
+			t2 := tss2.items[i]
+			if t1.tr != t2.tr {
+				t.Fatalf("unexpected time range for tombstone #%d; got %+v; want %+v", i, &t2.tr, &t1.tr)
+			}
+			if t1.mergeIdx != t2.mergeIdx {
+				t.Fatalf("unexpected mergeIdx for tombstone #%d; got %d; want %d", i, t2.mergeIdx, t1.mergeIdx)
+			}
+			if !reflect.DeepEqual(t1.metricIDs, t2.metricIDs) {
+				t.Fatalf("unexpected metricIDs for tombstone #%d; got %d; want %d", i, t2.metricIDs, t1.metricIDs)
+			}
+		}
+		if len(data) > 0 {
+			if _, err := unmarshalTombstones(data[:len(data)-1]); err == nil {
+				t.Fatalf("expecting non-nil error when unmarshaling truncated data")
+			}
+		}
+	}
+	f(&tombstones{})
+	f(&tombstones{
+		items: []*tombstone{
+			newTombstone([]uint64{3, 1, 2}, TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, 123),
+			newTombstone(nil, TimeRange{MinTimestamp: -5, MaxTimestamp: 0}, 1<<63),
+		},
+	})
+}
+
+func TestTombstonesForPart(t *testing.T) {
+	tss := &tombstones{
+		items: []*tombstone{
+			newTombstone([]uint64{1}, TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, 10),
+			newTombstone([]uint64{2}, TimeRange{MinTimestamp: 30, MaxTimestamp: 40}, 20),
+		},
+	}
+	f := func(partMergeIdx uint64, mergeIdxsExpected []uint64) {
+		t.Helper()
+		p := &part{
+			mergeIdx: partMergeIdx,
+		}
+		var mergeIdxs []uint64
+		if tssPart := tss.forPart(p); tssPart != nil {
+			for _, t := range tssPart.items {
+				mergeIdxs = append(mergeIdxs, t.mergeIdx)
+			}
+		}
+		if !reflect.DeepEqual(mergeIdxs, mergeIdxsExpected) {
+			t.Fatalf("unexpected tombstones for part with mergeIdx=%d; got %d; want %d", partMergeIdx, mergeIdxs, mergeIdxsExpected)
+		}
+	}
+	f(0, []uint64{10, 20})
+	f(9, []uint64{10, 20})
+	f(10, []uint64{20})
+	f(15, []uint64{20})
+	f(20, nil)
+	f(30, nil)
+
+	// nil tombstones must be safe to use
+	var tssNil *tombstones
+	if tssNil.forPart(&part{}) != nil {
+		t.Fatalf("expecting nil tombstones for nil tss")
+	}
+}
+
+func TestTombstonesAppliesTo(t *testing.T) {
+	tss := &tombstones{
+		items: []*tombstone{
+			newTombstone([]uint64{1}, TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, 10),
+			newTombstone([]uint64{2}, TimeRange{MinTimestamp: 30, MaxTimestamp: 40}, 20),
+		},
+	}
+	f := func(partMergeIdx uint64, minTimestamp, maxTimestamp int64, resultExpected bool) {
+		t.Helper()
+		p := &part{
+			mergeIdx: partMergeIdx,
+		}
+		p.ph.MinTimestamp = minTimestamp
+		p.ph.MaxTimestamp = maxTimestamp
+		if result := tss.appliesTo(p); result != resultExpected {
+			t.Fatalf("unexpected result for part with mergeIdx=%d on time range [%d..%d]; got %v; want %v",
+				partMergeIdx, minTimestamp, maxTimestamp, result, resultExpected)
+		}
+	}
+	f(0, 0, 100, true)
+	f(0, 15, 15, true)
+	f(0, 20, 30, true)
+	f(0, 0, 9, false)
+	f(0, 21, 29, false)
+	f(0, 41, 100, false)
+	f(10, 0, 100, true)
+	f(10, 10, 20, false)
+	f(20, 0, 100, false)
+
+	// nil tombstones must be safe to use
+	var tssNil *tombstones
+	if tssNil.appliesTo(&part{}) {
+		t.Fatalf("nil tombstones mustn't apply to parts")
+	}
+}
+
+func TestNeedTombstonesMerge(t *testing.T) {
+	const hour = 3600 * 1000
+	f := func(tr TimeRange, prevTimestamp, currentTimestamp int64, resultExpected bool) {
+		t.Helper()
+		result := needTombstonesMerge(tr, prevTimestamp, currentTimestamp)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for tr=%s, prevTimestamp=%d, currentTimestamp=%d; got %v; want %v",
+				&tr, prevTimestamp, currentTimestamp, result, resultExpected)
+		}
+	}
+	trActive := TimeRange{
+		MinTimestamp: 0,
+		MaxTimestamp: 10 * hour,
+	}
+	trInactive := TimeRange{
+		MinTimestamp: 0,
+		MaxTimestamp: hour,
+	}
+	// The partition, which doesn't receive new samples, is merged immediately.
+	f(trInactive, 2*hour, 2*hour+1, true)
+
+	// The active partition is merged at most once per activePartitionTombstonesMergeInterval.
+	f(trActive, 0, 2*hour, true)
+	f(trActive, 2*hour, 2*hour+1, false)
+	f(trActive, 2*hour, 3*hour, true)
+}
+
+func TestGetMergeIdxFromPath(t *testing.T) {
+	f := func(path string, mergeIdxExpected uint64) {
+		t.Helper()
+		if mergeIdx := getMergeIdxFromPath(path); mergeIdx != mergeIdxExpected {
+			t.Fatalf("unexpected mergeIdx for %q; got %d; want %d", path, mergeIdx, mergeIdxExpected)
+		}
+	}
+	f("", 0)
+	f("foo", 0)
+	f("data/small/2022_01/10_1_20220101000000.000_20220101000001.000_16E2B86A5C1B1F0A", 0x16E2B86A5C1B1F0A)
+	f("data/small/2022_01/10_1_20220101000000.000_20220101000001.000_XYZ", 0)
+}
+
+func TestTombstonesCoversAppendTimeRanges(t *testing.T) {
+	tss := &tombstones{
+		items: []*tombstone{
+			newTombstone([]uint64{1, 2}, TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, 1),
+			newTombstone([]uint64{2}, TimeRange{MinTimestamp: 30, MaxTimestamp: 40}, 1),
+		},
+	}
+	f := func(metricID uint64, tr TimeRange, coversExpected bool, drsExpected []TimeRange) {
+		t.Helper()
+		if covers := tss.covers(metricID, tr); covers != coversExpected {
+			t.Fatalf("unexpected covers result for metricID=%d, tr=%+v; got %v; want %v", metricID, &tr, covers, coversExpected)
+		}
+		drs := tss.appendTimeRanges(nil, metricID, tr)
+		if !reflect.DeepEqual(drs, drsExpected) {
+			t.Fatalf("unexpected time ranges for metricID=%d, tr=%+v; got %+v; want %+v", metricID, &tr, drs, drsExpected)
+		}
+	}
+	f(1, TimeRange{MinTimestamp: 12, MaxTimestamp: 18}, true, []TimeRange{{MinTimestamp: 10, MaxTimestamp: 20}})
+	f(1, TimeRange{MinTimestamp: 5, MaxTimestamp: 18}, false, []TimeRange{{MinTimestamp: 10, MaxTimestamp: 20}})
+	f(1, TimeRange{MinTimestamp: 30, MaxTimestamp: 40}, false, nil)
+	f(2, TimeRange{MinTimestamp: 15, MaxTimestamp: 35}, false, []TimeRange{{MinTimestamp: 10, MaxTimestamp: 20}, {MinTimestamp: 30, MaxTimestamp: 40}})
+	f(3, TimeRange{MinTimestamp: 10, MaxTimestamp: 20}, false, nil)
+
+	// nil tombstones must be safe to use
+	var tssNil *tombstones
+	if tssNil.covers(1, TimeRange{MinTimestamp: 10, MaxTimestamp: 20}) {
+		t.Fatalf("nil tombstones cannot cover anything")
+	}
+	if drs := tssNil.appendTimeRanges(nil, 1, TimeRange{MinTimestamp: 10, MaxTimestamp: 20}); len(drs) > 0 {
+		t.Fatalf("unexpected time ranges for nil tombstones: %+v", drs)
+	}
+}
+
+func TestRemoveDeletedSamples(t *testing.T) {
+	f := func(timestamps []int64, drs []TimeRange, timestampsExpected []int64) {
+		t.Helper()
+		values := append([]int64{}, timestamps...)
+		timestamps = append([]int64{}, timestamps...)
+		timestamps, values = removeDeletedSamples(timestamps, values, drs)
+		if len(timestamps) == 0 {
+			timestamps = nil
+			values = nil
+		}
+		if !reflect.DeepEqual(timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps; got %d; want %d", timestamps, timestampsExpected)
+		}
+		if !reflect.DeepEqual(values, timestampsExpected) {
+			t.Fatalf("unexpected values; got %d; want %d", values, timestampsExpected)
+		}
+	}
+	f([]int64{1, 2, 3}, nil, []int64{1, 2, 3})
+	f([]int64{1, 2, 3, 4, 5}, []TimeRange{{MinTimestamp: 2, MaxTimestamp: 3}}, []int64{1, 4, 5})
+	f([]int64{1, 2, 3, 4, 5}, []TimeRange{{MinTimestamp: 0, MaxTimestamp: 1}, {MinTimestamp: 5, MaxTimestamp: 10}}, []int64{2, 3, 4})
+	f([]int64{1, 2, 3}, []TimeRange{{MinTimestamp: 0, MaxTimestamp: 10}}, nil)
+}
+
+func TestStorageDeleteSeriesOnTimeRange(t *testing.T) {
+	path := "TestStorageDeleteSeriesOnTimeRange"
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	// Use timestamps from the middle of the previous day, so all the samples belong to a single partition.
+	now := time.Now().UnixNano() / 1e6
+	startTimestamp := now - now%msecPerDay - msecPerDay/2
+	const rowsPerSeries = 100
+	addRows := func(job string, from, to int) {
+		t.Helper()
+		var mn MetricName
+		mn.MetricGroup = []byte("metric")
+		mn.AddTag("job", job)
+		metricNameRaw := mn.marshalRaw(nil)
+		var mrs []MetricRow
+		for i := from; i < to; i++ {
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     startTimestamp + int64(i)*1000,
+				Value:         float64(i),
+			})
+		}
+		if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+		s.DebugFlush()
+	}
+	addRows("bad", 0, rowsPerSeries)
+	addRows("good", 0, rowsPerSeries)
+
+	// Add samples outside the deleted time range, so they are stored in a separate file part, which mustn't be merged.
+	s.tb.flushInmemoryPartsToFiles()
+	addRows("other", -3600, -3600+rowsPerSeries)
+	s.tb.flushInmemoryPartsToFiles()
+	otherPartPaths := func() []string {
+		t.Helper()
+		var paths []string
+		ptws := s.tb.GetPartitions(nil)
+		defer s.tb.PutPartitions(ptws)
+		for _, ptw := range ptws {
+			pws := ptw.pt.GetParts(nil)
+			for _, pw := range pws {
+				if pw.p.ph.MaxTimestamp < startTimestamp {
+					paths = append(paths, pw.p.path)
+				}
+			}
+			ptw.pt.PutParts(pws)
+		}
+		return paths
+	}
+
+	trAll := TimeRange{
+		MinTimestamp: startTimestamp - msecPerDay,
+		MaxTimestamp: startTimestamp + msecPerDay,
+	}
+	deletedTr := TimeRange{
+		MinTimestamp: startTimestamp + 10*1000,
+		MaxTimestamp: startTimestamp + 29*1000,
+	}
+	// countRows returns the number of rows for the given job and the number of these rows on deletedTr.
+	countRows := func(job string) (int, int) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add([]byte("job"), []byte(job), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		var sr Search
+		sr.Init(nil, s, []*TagFilters{tfs}, trAll, 1e5, noDeadline, nil)
+		defer sr.MustClose()
+		var b Block
+		rows := 0
+		deletedTrRows := 0
+		for sr.NextMetricBlock() {
+			sr.MetricBlockRef.BlockRef.MustReadBlock(&b, true)
+			if err := b.UnmarshalData(); err != nil {
+				t.Fatalf("cannot unmarshal block: %s", err)
+			}
+			for _, timestamp := range b.timestamps {
+				if timestamp >= deletedTr.MinTimestamp && timestamp <= deletedTr.MaxTimestamp {
+					deletedTrRows++
+				}
+			}
+			rows += len(b.timestamps)
+		}
+		if err := sr.Error(); err != nil {
+			t.Fatalf("search error: %s", err)
+		}
+		return rows, deletedTrRows
+	}
+	checkRows := func(badRowsExpected, badDeletedTrRowsExpected int) {
+		t.Helper()
+		n, nDeletedTr := countRows("bad")
+		if n != badRowsExpected {
+			t.Fatalf("unexpected number of rows for job=bad; got %d; want %d", n, badRowsExpected)
+		}
+		if nDeletedTr != badDeletedTrRowsExpected {
+			t.Fatalf("unexpected number of rows on the deleted time range for job=bad; got %d; want %d", nDeletedTr, badDeletedTrRowsExpected)
+		}
+		if n, _ := countRows("good"); n != rowsPerSeries {
+			t.Fatalf("unexpected number of rows for job=good; got %d; want %d", n, rowsPerSeries)
+		}
+	}
+	checkRows(rowsPerSeries, 20)
+
+	// Delete 20 samples for the job=bad series.
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte("job"), []byte("bad"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	n, err := s.DeleteSeriesOnTimeRange([]*TagFilters{tfs}, deletedTr)
+	if err != nil {
+		t.Fatalf("cannot delete series: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("unexpected number of series with deleted samples; got %d; want 1", n)
+	}
+	checkRows(rowsPerSeries-20, 0)
+
+	// Tombstones must survive storage restart.
+	s.MustClose()
+	s, err = OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage: %s", err)
+	}
+	defer s.MustClose()
+	checkRows(rowsPerSeries-20, 0)
+
+	// Samples added to the deleted time range after the deletion must be visible.
+	addRows("bad", 10, 20)
+	checkRows(rowsPerSeries-10, 10)
+
+	// Tombstones merge must physically remove the deleted samples and drop the applied tombstones.
+	otherPartPathsExpected := otherPartPaths()
+	if len(otherPartPathsExpected) != 1 {
+		t.Fatalf("unexpected number of parts outside the deleted time range; got %d; want 1", len(otherPartPathsExpected))
+	}
+	ptws := s.tb.GetPartitions(nil)
+	defer s.tb.PutPartitions(ptws)
+	for _, ptw := range ptws {
+		if err := ptw.pt.runTombstonesMerge(); err != nil {
+			t.Fatalf("cannot run tombstones merge: %s", err)
+		}
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.TableMetrics.PendingTombstones != 0 {
+		t.Fatalf("unexpected number of pending tombstones after the merge; got %d; want 0", m.TableMetrics.PendingTombstones)
+	}
+	if m.TableMetrics.TombstonesApplied != 1 {
+		t.Fatalf("unexpected number of applied tombstones; got %d; want 1", m.TableMetrics.TombstonesApplied)
+	}
+	rowsExpected := uint64(3*rowsPerSeries - 10)
+	if rows := m.TableMetrics.SmallRowsCount + m.TableMetrics.BigRowsCount; rows != rowsExpected {
+		t.Fatalf("unexpected number of rows after the merge; got %d; want %d", rows, rowsExpected)
+	}
+	checkRows(rowsPerSeries-10, 10)
+	if paths := otherPartPaths(); !reflect.DeepEqual(paths, otherPartPathsExpected) {
+		t.Fatalf("the part outside the deleted time range mustn't be merged; got parts %q; want %q", paths, otherPartPathsExpected)
+	}
+
+	// Invalid time range must be rejected.
+	if _, err := s.DeleteSeriesOnTimeRange([]*TagFilters{tfs}, TimeRange{MinTimestamp: 2, MaxTimestamp: 1}); err == nil {
+		t.Fatalf("expecting non-nil error for invalid time range")
+	}
+}
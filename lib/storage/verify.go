@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+)
+
+// quarantineDirname is the name of directory inside the storage path, where corrupted parts are moved by VerifyStorage.
+const quarantineDirname = "quarantine"
+
+// CorruptedPart describes a corrupted part found by VerifyStorage.
+type CorruptedPart struct {
+	// Path is the path to the corrupted part.
+	Path string
+
+	// Err is the error found in the part.
+	Err error
+
+	// QuarantinePath is the path where the part has been moved to.
+	//
+	// It is empty if the part hasn't been quarantined.
+	QuarantinePath string
+}
+
+// CorruptedFile describes a corrupted tombstones file or WAL segment found by VerifyStorage.
+type CorruptedFile struct {
+	// Path is the path to the corrupted file.
+	Path string
+
+	// Err is the error found in the file.
+	Err error
+}
+
+// VerifyResult is the result of VerifyStorage call.
+type VerifyResult struct {
+	// DataParts is the number of verified data parts.
+	DataParts int
+
+	// IndexDBParts is the number of verified indexdb parts.
+	IndexDBParts int
+
+	// MetricMetadataParts is the number of verified metric metadata parts.
+	MetricMetadataParts int
+
+	// TombstonesFiles is the number of verified tombstones files.
+	TombstonesFiles int
+
+	// WALSegments is the number of verified WAL segments.
+	WALSegments int
+
+	// CorruptedParts contains the found corrupted parts.
+	CorruptedParts []CorruptedPart
+
+	// CorruptedFiles contains the found corrupted tombstones files and WAL segments.
+	CorruptedFiles []CorruptedFile
+
+	// MissingMetricIDs contains sorted metricIDs for series found in data parts,
+	// which cannot be resolved via indexdb.
+	MissingMetricIDs []uint64
+}
+
+// HasErrors returns true if vr contains any errors.
+func (vr *VerifyResult) HasErrors() bool {
+	return len(vr.CorruptedParts) > 0 || len(vr.CorruptedFiles) > 0 || len(vr.MissingMetricIDs) > 0
+}
+
+// VerifyStorage verifies the consistency of the storage at the given path and of the cold storage at coldPath.
+//
+// coldPath may be empty if the storage has no cold storage.
+//
+// The storage mustn't be opened during the verification.
+// VerifyStorage checks part headers, metaindex rows, block headers and the order of timestamps in data parts,
+// the consistency of indexdb and metric metadata parts and verifies that all the series from data parts
+// can be resolved via indexdb. It also checks that tombstones files can be parsed and that WAL segments
+// contain only valid records, except of an incomplete record at the end, which is left after unclean shutdown.
+//
+// Corrupted parts are moved into `quarantine` directory under the storage path they belong to if quarantine is set.
+// Corrupted tombstones files and WAL segments are only reported, since removing them would restore deleted samples
+// or lose samples, which aren't flushed to parts yet.
+func VerifyStorage(path, coldPath string, quarantine bool) (*VerifyResult, error) {
+	path = filepath.Clean(path)
+	if !fs.IsPathExist(path) {
+		return nil, fmt.Errorf("storage path %q doesn't exist", path)
+	}
+
+	// Protect from concurrent access to the storage.
+	flockF, err := fs.CreateFlockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.MustClose(flockF)
+
+	var vr VerifyResult
+
+	// Verify data parts.
+	dataMetricIDs := &uint64set.Set{}
+	if err := vr.verifyPartitions(path+"/data", dataMetricIDs); err != nil {
+		return nil, err
+	}
+	if coldPath != "" {
+		coldPath = filepath.Clean(coldPath)
+		coldDataPath := coldPath + "/data"
+		if fs.IsPathExist(coldDataPath) {
+			// Protect from concurrent access to the cold storage. See openTable.
+			coldFlockF, err := fs.CreateFlockFile(coldDataPath)
+			if err != nil {
+				return nil, err
+			}
+			defer fs.MustClose(coldFlockF)
+			if err := vr.verifyPartitions(coldDataPath, dataMetricIDs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Verify WAL segments.
+	walPath := path + "/" + walDirname
+	segmentNames, err := readWALSegmentNames(walPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range segmentNames {
+		segmentPath := walPath + "/" + name
+		vr.WALSegments++
+		if err := readWALSegment(segmentPath, func(mrs []MetricRow, precisionBits uint8) error { return nil }); err != nil {
+			vr.CorruptedFiles = append(vr.CorruptedFiles, CorruptedFile{
+				Path: segmentPath,
+				Err:  err,
+			})
+		}
+	}
+
+	// Verify indexdb parts and collect the metricIDs registered in indexdb.
+	idbMetricIDs := &uint64set.Set{}
+	idbPath := path + "/indexdb"
+	tableNames, err := readSubdirNames(idbPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, tableName := range tableNames {
+		if !indexDBTableNameRegexp.MatchString(tableName) {
+			continue
+		}
+		n, pes, err := mergeset.VerifyTable(idbPath+"/"+tableName, func(item []byte) {
+			if len(item) < 1+8 {
+				return
+			}
+			switch item[0] {
+			case nsPrefixMetricIDToTSID, nsPrefixDeletedMetricID:
+				// Deleted series may still have samples in data parts until they are removed by background merges.
+				idbMetricIDs.Add(encoding.UnmarshalUint64(item[1:]))
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot verify indexdb table: %w", err)
+		}
+		vr.IndexDBParts += n
+		vr.addCorruptedParts(pes)
+	}
+
+	// Verify metric metadata parts.
+	mmPath := path + "/metric_metadata"
+	if fs.IsPathExist(mmPath) {
+		n, pes, err := mergeset.VerifyTable(mmPath, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot verify metric metadata: %w", err)
+		}
+		vr.MetricMetadataParts = n
+		vr.addCorruptedParts(pes)
+	}
+
+	dataMetricIDs.Subtract(idbMetricIDs)
+	vr.MissingMetricIDs = dataMetricIDs.AppendTo(nil)
+
+	if quarantine {
+		for i := range vr.CorruptedParts {
+			cp := &vr.CorruptedParts[i]
+			rootPath := path
+			if coldPath != "" && strings.HasPrefix(cp.Path, coldPath+"/") {
+				// Keep cold parts on the cold storage in order to avoid copying them between filesystems.
+				rootPath = coldPath
+			}
+			dstPath, err := quarantinePart(rootPath, cp.Path)
+			if err != nil {
+				return nil, err
+			}
+			cp.QuarantinePath = dstPath
+		}
+	}
+	return &vr, nil
+}
+
+// verifyPartitions verifies partitions under small and big subdirectories of the given dataPath.
+//
+// metricIDs for the series found in data parts are added to metricIDs.
+func (vr *VerifyResult) verifyPartitions(dataPath string, metricIDs *uint64set.Set) error {
+	for _, partitionsPath := range []string{dataPath + "/small", dataPath + "/big"} {
+		ptNames, err := readSubdirNames(partitionsPath)
+		if err != nil {
+			return err
+		}
+		for _, ptName := range ptNames {
+			if ptName == "snapshots" {
+				continue
+			}
+			var tr TimeRange
+			if err := tr.fromPartitionName(ptName); err != nil {
+				return fmt.Errorf("cannot verify partition %q: %w", partitionsPath+"/"+ptName, err)
+			}
+			ptPath := partitionsPath + "/" + ptName
+			partNames, err := readSubdirNames(ptPath)
+			if err != nil {
+				return err
+			}
+			for _, partName := range partNames {
+				if partName == "tmp" || partName == "txn" || partName == "snapshots" {
+					continue
+				}
+				partPath := ptPath + "/" + partName
+				if fs.IsEmptyDir(partPath) {
+					// Empty directories are removed when the partition is opened.
+					continue
+				}
+				vr.DataParts++
+				if err := verifyDataPart(partPath, tr, metricIDs); err != nil {
+					vr.CorruptedParts = append(vr.CorruptedParts, CorruptedPart{
+						Path: partPath,
+						Err:  err,
+					})
+				}
+			}
+
+			// Tombstones are stored only in big partition directories, so the check is no-op for small partitions.
+			tombstonesPath := ptPath + "/" + tombstonesFilename
+			if fs.IsPathExist(tombstonesPath) {
+				vr.TombstonesFiles++
+				if err := verifyTombstonesFile(tombstonesPath); err != nil {
+					vr.CorruptedFiles = append(vr.CorruptedFiles, CorruptedFile{
+						Path: tombstonesPath,
+						Err:  err,
+					})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func verifyTombstonesFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read tombstones file: %w", err)
+	}
+	if _, err := unmarshalTombstones(data); err != nil {
+		return fmt.Errorf("cannot parse tombstones file: %w", err)
+	}
+	return nil
+}
+
+func (vr *VerifyResult) addCorruptedParts(pes []mergeset.PartError) {
+	for _, pe := range pes {
+		vr.CorruptedParts = append(vr.CorruptedParts, CorruptedPart{
+			Path: pe.Path,
+			Err:  pe.Err,
+		})
+	}
+}
+
+func verifyDataPart(path string, tr TimeRange, metricIDs *uint64set.Set) error {
+	var bsr blockStreamReader
+	if err := bsr.InitFromFilePart(path); err != nil {
+		return err
+	}
+	defer bsr.MustClose()
+
+	ph := &bsr.ph
+	if ph.MinTimestamp > ph.MaxTimestamp {
+		return fmt.Errorf("MinTimestamp=%d cannot be bigger than MaxTimestamp=%d in partHeader", ph.MinTimestamp, ph.MaxTimestamp)
+	}
+	if partTr := msecsTimeRange(ph.MinTimestamp, ph.MaxTimestamp); partTr.MinTimestamp < tr.MinTimestamp || partTr.MaxTimestamp > tr.MaxTimestamp {
+		return fmt.Errorf("part time range [%d..%d] is outside the partition time range [%d..%d]", partTr.MinTimestamp, partTr.MaxTimestamp, tr.MinTimestamp, tr.MaxTimestamp)
+	}
+	for bsr.NextBlock() {
+		b := &bsr.Block
+		metricIDs.Add(b.bh.TSID.MetricID)
+		if err := b.UnmarshalData(); err != nil {
+			return fmt.Errorf("cannot unmarshal block for TSID=%v: %w", &b.bh.TSID, err)
+		}
+		if err := checkBlockTimestamps(&b.bh, b.timestamps); err != nil {
+			return fmt.Errorf("invalid block for TSID=%v: %w", &b.bh.TSID, err)
+		}
+	}
+	if err := bsr.Error(); err != nil {
+		return err
+	}
+	if bsr.blocksCount != ph.BlocksCount {
+		return fmt.Errorf("unexpected number of blocks read; got %d; want %d according to partHeader", bsr.blocksCount, ph.BlocksCount)
+	}
+	if bsr.rowsCount != ph.RowsCount {
+		return fmt.Errorf("unexpected number of rows read; got %d; want %d according to partHeader", bsr.rowsCount, ph.RowsCount)
+	}
+	return nil
+}
+
+func checkBlockTimestamps(bh *blockHeader, timestamps []int64) error {
+	if len(timestamps) != int(bh.RowsCount) {
+		return fmt.Errorf("unexpected number of timestamps; got %d; want %d", len(timestamps), bh.RowsCount)
+	}
+	if timestamps[0] != bh.MinTimestamp {
+		return fmt.Errorf("the first timestamp %d doesn't match MinTimestamp=%d from block header", timestamps[0], bh.MinTimestamp)
+	}
+	if last := timestamps[len(timestamps)-1]; last != bh.MaxTimestamp {
+		return fmt.Errorf("the last timestamp %d doesn't match MaxTimestamp=%d from block header", last, bh.MaxTimestamp)
+	}
+	prevTimestamp := timestamps[0]
+	for i, timestamp := range timestamps[1:] {
+		if timestamp < prevTimestamp {
+			return fmt.Errorf("timestamps aren't sorted; timestamp #%d=%d is smaller than the previous timestamp %d", i+1, timestamp, prevTimestamp)
+		}
+		prevTimestamp = timestamp
+	}
+	return nil
+}
+
+// quarantinePart moves the part at partPath into quarantine directory under the storage path.
+//
+// It returns the path to the moved part.
+func quarantinePart(path, partPath string) (string, error) {
+	relPath, err := filepath.Rel(path, partPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot determine relative path for part %q: %w", partPath, err)
+	}
+	dstPath := path + "/" + quarantineDirname + "/" + relPath
+	dstDir := filepath.Dir(dstPath)
+	if err := fs.MkdirAllIfNotExist(dstDir); err != nil {
+		return "", fmt.Errorf("cannot create quarantine directory %q: %w", dstDir, err)
+	}
+	if err := os.Rename(partPath, dstPath); err != nil {
+		return "", fmt.Errorf("cannot move part %q to quarantine: %w", partPath, err)
+	}
+	fs.MustSyncPath(filepath.Dir(partPath))
+	fs.MustSyncPath(dstDir)
+	return dstPath, nil
+}
+
+// readSubdirNames returns sorted names of subdirectories at the given path.
+//
+// An empty list is returned if the path doesn't exist.
+func readSubdirNames(path string) ([]string, error) {
+	if !fs.IsPathExist(path) {
+		return nil, nil
+	}
+	d, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open directory %q: %w", path, err)
+	}
+	defer fs.MustClose(d)
+
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory %q: %w", path, err)
+	}
+	var names []string
+	for _, fi := range fis {
+		if !fs.IsDirOrSymlink(fi) {
+			// Skip non-directories.
+			continue
+		}
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestCheckBlockTimestamps(t *testing.T) {
+	f := func(minTimestamp, maxTimestamp int64, timestamps []int64, resultExpected bool) {
+		t.Helper()
+		bh := &blockHeader{
+			MinTimestamp: minTimestamp,
+			MaxTimestamp: maxTimestamp,
+			RowsCount:    uint32(len(timestamps)),
+		}
+		err := checkBlockTimestamps(bh, timestamps)
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result for timestamps=%d; got %v; want %v; err: %v", timestamps, result, resultExpected, err)
+		}
+	}
+	f(1, 1, []int64{1}, true)
+	f(1, 3, []int64{1, 2, 2, 3}, true)
+	f(0, 3, []int64{1, 2, 3}, false)
+	f(1, 4, []int64{1, 2, 3}, false)
+	f(1, 3, []int64{1, 3, 2, 3}, false)
+}
+
+func TestVerifyStorage(t *testing.T) {
+	path := "TestVerifyStorage"
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	const seriesCount = 10
+	now := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	for i := 0; i < seriesCount; i++ {
+		var mn MetricName
+		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+		metricNameRaw := mn.marshalRaw(nil)
+		for j := 0; j < 10; j++ {
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     now - int64(j)*1000,
+				Value:         float64(j),
+			})
+		}
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	s.DebugFlush()
+
+	// The verification must fail while the storage is open.
+	if _, err := VerifyStorage(path, "", false); err == nil {
+		t.Fatalf("expecting non-nil error when verifying the opened storage")
+	}
+	s.MustClose()
+
+	vr, err := VerifyStorage(path, "", false)
+	if err != nil {
+		t.Fatalf("cannot verify storage: %s", err)
+	}
+	if vr.HasErrors() {
+		t.Fatalf("unexpected errors for valid storage: %+v", vr)
+	}
+	if vr.DataParts == 0 {
+		t.Fatalf("expecting at least a single verified data part")
+	}
+	if vr.IndexDBParts == 0 {
+		t.Fatalf("expecting at least a single verified indexdb part")
+	}
+
+	// Series must be reported as missing if indexdb is lost.
+	idbPath := path + "/indexdb"
+	idbPathTmp := path + "/indexdb.tmp"
+	if err := os.Rename(idbPath, idbPathTmp); err != nil {
+		t.Fatalf("cannot rename indexdb: %s", err)
+	}
+	vr, err = VerifyStorage(path, "", false)
+	if err != nil {
+		t.Fatalf("cannot verify storage: %s", err)
+	}
+	if len(vr.MissingMetricIDs) != seriesCount {
+		t.Fatalf("unexpected number of missing metricIDs; got %d; want %d", len(vr.MissingMetricIDs), seriesCount)
+	}
+	if err := os.Rename(idbPathTmp, idbPath); err != nil {
+		t.Fatalf("cannot rename indexdb: %s", err)
+	}
+
+	// Corrupt a data part and move it to quarantine.
+	valuesPaths, err := filepath.Glob(path + "/data/*/*/*/values.bin")
+	if err != nil {
+		t.Fatalf("cannot find values files: %s", err)
+	}
+	if len(valuesPaths) == 0 {
+		t.Fatalf("cannot find values files at %q", path)
+	}
+	if err := os.Truncate(valuesPaths[0], 1); err != nil {
+		t.Fatalf("cannot truncate %q: %s", valuesPaths[0], err)
+	}
+	partPath := filepath.Dir(valuesPaths[0])
+	vr, err = VerifyStorage(path, "", true)
+	if err != nil {
+		t.Fatalf("cannot verify storage: %s", err)
+	}
+	if len(vr.CorruptedParts) != 1 {
+		t.Fatalf("unexpected number of corrupted parts; got %d; want 1", len(vr.CorruptedParts))
+	}
+	cp := vr.CorruptedParts[0]
+	if cp.Path != partPath {
+		t.Fatalf("unexpected corrupted part; got %q; want %q", cp.Path, partPath)
+	}
+	if cp.QuarantinePath == "" || !fs.IsPathExist(cp.QuarantinePath) {
+		t.Fatalf("the corrupted part must be moved to quarantine; got QuarantinePath=%q", cp.QuarantinePath)
+	}
+	if fs.IsPathExist(partPath) {
+		t.Fatalf("the corrupted part must be removed from %q", partPath)
+	}
+
+	// The storage must be valid after the corrupted part is moved to quarantine.
+	quarantinedPartPath := cp.QuarantinePath
+	vr, err = VerifyStorage(path, "", false)
+	if err != nil {
+		t.Fatalf("cannot verify storage: %s", err)
+	}
+	if len(vr.CorruptedParts) > 0 {
+		t.Fatalf("unexpected corrupted parts after quarantine: %+v", vr.CorruptedParts)
+	}
+
+	// Corrupted parts in cold storage must be detected and moved to quarantine under the cold storage path.
+	coldPath := path + ".cold"
+	defer func() {
+		if err := os.RemoveAll(coldPath); err != nil {
+			t.Fatalf("cannot remove %q: %s", coldPath, err)
+		}
+	}()
+	relPartPath, err := filepath.Rel(path, partPath)
+	if err != nil {
+		t.Fatalf("cannot determine relative path for %q: %s", partPath, err)
+	}
+	coldPartPath := coldPath + "/" + relPartPath
+	if err := fs.CopyDirectory(quarantinedPartPath, coldPartPath); err != nil {
+		t.Fatalf("cannot copy the corrupted part to cold storage: %s", err)
+	}
+	vr, err = VerifyStorage(path, coldPath, true)
+	if err != nil {
+		t.Fatalf("cannot verify storage: %s", err)
+	}
+	if len(vr.CorruptedParts) != 1 {
+		t.Fatalf("unexpected number of corrupted parts in cold storage; got %d; want 1", len(vr.CorruptedParts))
+	}
+	cp = vr.CorruptedParts[0]
+	if !strings.HasPrefix(cp.QuarantinePath, coldPath+"/"+quarantineDirname+"/") {
+		t.Fatalf("the corrupted cold part must be moved to quarantine under %q; got QuarantinePath=%q", coldPath, cp.QuarantinePath)
+	}
+
+	// Corrupted tombstones files and WAL segments must be reported.
+	bigPtPath := path + "/data/big/" + filepath.Base(filepath.Dir(partPath))
+	tombstonesPath := bigPtPath + "/" + tombstonesFilename
+	if err := ioutil.WriteFile(tombstonesPath, []byte("invalid tombstones"), 0644); err != nil {
+		t.Fatalf("cannot write %q: %s", tombstonesPath, err)
+	}
+	walSegmentPath := path + "/" + walDirname + "/0000000000000123"
+	if err := fs.MkdirAllIfNotExist(filepath.Dir(walSegmentPath)); err != nil {
+		t.Fatalf("cannot create WAL directory: %s", err)
+	}
+	var header [walRecordHeaderSize]byte
+	copy(header[:], encoding.MarshalUint32(nil, 4))
+	if err := ioutil.WriteFile(walSegmentPath, append(header[:], "data"...), 0644); err != nil {
+		t.Fatalf("cannot write %q: %s", walSegmentPath, err)
+	}
+	vr, err = VerifyStorage(path, coldPath, false)
+	if err != nil {
+		t.Fatalf("cannot verify storage: %s", err)
+	}
+	if vr.TombstonesFiles != 1 {
+		t.Fatalf("unexpected number of verified tombstones files; got %d; want 1", vr.TombstonesFiles)
+	}
+	if vr.WALSegments == 0 {
+		t.Fatalf("expecting at least a single verified WAL segment")
+	}
+	if len(vr.CorruptedParts) > 0 {
+		t.Fatalf("unexpected corrupted parts: %+v", vr.CorruptedParts)
+	}
+	if len(vr.CorruptedFiles) != 2 {
+		t.Fatalf("unexpected number of corrupted files; got %d; want 2; files: %+v", len(vr.CorruptedFiles), vr.CorruptedFiles)
+	}
+	if vr.CorruptedFiles[0].Path != tombstonesPath || vr.CorruptedFiles[1].Path != walSegmentPath {
+		t.Fatalf("unexpected corrupted files: %+v", vr.CorruptedFiles)
+	}
+	if !fs.IsPathExist(tombstonesPath) || !fs.IsPathExist(walSegmentPath) {
+		t.Fatalf("corrupted tombstones files and WAL segments mustn't be removed")
+	}
+}
@@ -0,0 +1,458 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	xxhash "github.com/cespare/xxhash/v2"
+)
+
+var walEnabled bool
+
+// SetWAL enables or disables write-ahead log for rows added via Storage.AddRows.
+//
+// Rows are written to WAL before they are added to the storage, so they survive unclean shutdown
+// before they are flushed to file parts. WAL segments left after unclean shutdown are replayed
+// by OpenStorage even if WAL is disabled.
+//
+// This function must be called before OpenStorage.
+func SetWAL(enabled bool) {
+	walEnabled = enabled
+}
+
+// walDirname is the name of directory inside the storage path, which contains WAL segments.
+const walDirname = "wal"
+
+// walFlushInterval is the interval for switching to new WAL segment.
+//
+// The previous segments are removed after the rows from them are flushed to file parts.
+var walFlushInterval = 10 * time.Second
+
+// maxWALRecordSize is the maximum size of a single WAL record.
+//
+// It protects from excess memory usage when reading corrupted WAL segments.
+const maxWALRecordSize = 256 * 1024 * 1024
+
+// walRecordHeaderSize is the size of WAL record header.
+//
+// The header contains the record size and xxhash of the record.
+const walRecordHeaderSize = 4 + 8
+
+// wal is write-ahead log for rows added to the storage.
+//
+// Rows are stored in segment files with sequentially increasing names.
+// Each segment consists of records with the following format:
+//
+//	<recordSize uint32><xxhash(record) uint64><precisionBits uint8><rowsCount varuint><MetricRow>*rowsCount
+type wal struct {
+	// Atomic counters must go at the top of the structure in order to properly align by 8 bytes on 32-bit archs.
+	bytesWritten uint64
+	syncsTotal   uint64
+
+	path string
+
+	// rotateLock is held in read mode while rows are written to WAL and are added to the storage.
+	//
+	// It is held in write mode when switching to the next segment, so all the rows from the previous segments
+	// are already added to the storage after the switch.
+	rotateLock sync.RWMutex
+
+	// syncMu serializes WAL syncs and protects syncedRecords.
+	syncMu sync.Mutex
+
+	// syncedRecords is the number of records, which are synced to disk.
+	syncedRecords uint64
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	f           *os.File
+	segmentIdx  uint64
+	segmentSize int64
+	buf         []byte
+
+	// writtenRecords is the number of records written to WAL segments.
+	writtenRecords uint64
+
+	// closedSegments contains paths to closed segments, which must be removed
+	// after the rows from them are flushed to file parts.
+	closedSegments []string
+}
+
+// openWAL replays WAL segments at s.path and then opens WAL for writing if it is enabled via SetWAL.
+func (s *Storage) openWAL() error {
+	path := s.path + "/" + walDirname
+	segmentNames, err := readWALSegmentNames(path)
+	if err != nil {
+		return err
+	}
+	var segmentIdx uint64
+	if len(segmentNames) > 0 {
+		logger.Infof("replaying %d WAL segments at %q...", len(segmentNames), path)
+		startTime := time.Now()
+		rowsReplayed := 0
+		for _, name := range segmentNames {
+			n, err := s.replayWALSegment(path + "/" + name)
+			if err != nil {
+				return err
+			}
+			rowsReplayed += n
+		}
+		if !s.flushToFiles() {
+			logger.Panicf("BUG: cannot flush replayed rows to files, since the storage is stopped")
+		}
+		for _, name := range segmentNames {
+			fs.MustRemoveAll(path + "/" + name)
+		}
+		fs.MustSyncPath(path)
+		segmentIdx = mustParseWALSegmentIdx(segmentNames[len(segmentNames)-1])
+		atomic.AddUint64(&walRowsReplayed, uint64(rowsReplayed))
+		logger.Infof("replayed %d rows from %d WAL segments at %q in %.3f seconds", rowsReplayed, len(segmentNames), path, time.Since(startTime).Seconds())
+	}
+	if !walEnabled {
+		return nil
+	}
+
+	if err := fs.MkdirAllIfNotExist(path); err != nil {
+		return fmt.Errorf("cannot create directory for WAL: %w", err)
+	}
+	w := &wal{
+		path:       path,
+		segmentIdx: segmentIdx,
+	}
+	if err := w.openNextSegment(); err != nil {
+		return err
+	}
+	s.wal = w
+	return nil
+}
+
+// replayWALSegment adds rows from the WAL segment at the given path to s.
+//
+// It returns the number of replayed rows.
+func (s *Storage) replayWALSegment(path string) (int, error) {
+	rowsReplayed := 0
+	err := readWALSegment(path, func(mrs []MetricRow, precisionBits uint8) error {
+		if err := s.AddRows(mrs, precisionBits); err != nil {
+			return fmt.Errorf("cannot add rows from WAL segment %q: %w", path, err)
+		}
+		rowsReplayed += len(mrs)
+		return nil
+	})
+	if errors.Is(err, errCorruptedWALSegment) {
+		logger.Errorf("skipping the rest of WAL segment %q: %s", path, err)
+		return rowsReplayed, nil
+	}
+	return rowsReplayed, err
+}
+
+// errCorruptedWALSegment is returned from readWALSegment if the WAL segment contains corrupted records.
+var errCorruptedWALSegment = errors.New("corrupted WAL segment")
+
+// readWALSegment calls f for every record in the WAL segment at the given path.
+//
+// An incomplete record at the end of the segment is skipped, since this is expected after unclean shutdown.
+// The returned error wraps errCorruptedWALSegment if the segment contains corrupted records.
+func readWALSegment(path string, f func(mrs []MetricRow, precisionBits uint8) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open WAL segment: %w", err)
+	}
+	defer fs.MustClose(file)
+
+	br := bufio.NewReaderSize(file, 64*1024)
+	var header [walRecordHeaderSize]byte
+	var record []byte
+	var mrs []MetricRow
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			logger.Warnf("skipping incomplete record header at the end of WAL segment %q; this is expected after unclean shutdown: %s", path, err)
+			return nil
+		}
+		recordSize := encoding.UnmarshalUint32(header[:4])
+		checksum := encoding.UnmarshalUint64(header[4:])
+		if recordSize > maxWALRecordSize {
+			return fmt.Errorf("%w: too big record size: %d bytes; max allowed size: %d bytes", errCorruptedWALSegment, recordSize, maxWALRecordSize)
+		}
+		record = bytesutil.ResizeNoCopyMayOverallocate(record, int(recordSize))
+		if _, err := io.ReadFull(br, record); err != nil {
+			logger.Warnf("skipping incomplete record at the end of WAL segment %q; this is expected after unclean shutdown: %s", path, err)
+			return nil
+		}
+		if xxhash.Sum64(record) != checksum {
+			return fmt.Errorf("%w: invalid checksum for the record with size %d bytes", errCorruptedWALSegment, recordSize)
+		}
+		var precisionBits uint8
+		mrs, precisionBits, err = unmarshalWALRecord(mrs[:0], record)
+		if err != nil {
+			return fmt.Errorf("%w: invalid record: %s", errCorruptedWALSegment, err)
+		}
+		if err := f(mrs, precisionBits); err != nil {
+			return err
+		}
+	}
+}
+
+func marshalWALRecord(dst []byte, mrs []MetricRow, precisionBits uint8) []byte {
+	dst = append(dst, precisionBits)
+	dst = encoding.MarshalVarUint64(dst, uint64(len(mrs)))
+	for i := range mrs {
+		dst = mrs[i].Marshal(dst)
+	}
+	return dst
+}
+
+func unmarshalWALRecord(dst []MetricRow, src []byte) ([]MetricRow, uint8, error) {
+	if len(src) < 1 {
+		return dst, 0, fmt.Errorf("cannot unmarshal precisionBits from empty record")
+	}
+	precisionBits := src[0]
+	if err := encoding.CheckPrecisionBits(precisionBits); err != nil {
+		return dst, 0, err
+	}
+	tail, rowsCount, err := encoding.UnmarshalVarUint64(src[1:])
+	if err != nil {
+		return dst, 0, fmt.Errorf("cannot unmarshal rows count: %w", err)
+	}
+	for i := uint64(0); i < rowsCount; i++ {
+		if len(dst) < cap(dst) {
+			dst = dst[:len(dst)+1]
+		} else {
+			dst = append(dst, MetricRow{})
+		}
+		mr := &dst[len(dst)-1]
+		tail, err = mr.UnmarshalX(tail)
+		if err != nil {
+			return dst, 0, fmt.Errorf("cannot unmarshal row #%d out of %d rows: %w", i, rowsCount, err)
+		}
+	}
+	if len(tail) > 0 {
+		return dst, 0, fmt.Errorf("unexpected tail left after unmarshaling %d rows: %d bytes", rowsCount, len(tail))
+	}
+	return dst, precisionBits, nil
+}
+
+// addRows writes mrs to the current WAL segment and waits until it is synced to disk.
+//
+// Concurrent addRows calls share a single sync, so the sync cost is amortized among concurrent inserts.
+func (w *wal) addRows(mrs []MetricRow, precisionBits uint8) error {
+	w.mu.Lock()
+	buf := w.buf[:0]
+	buf = append(buf, make([]byte, walRecordHeaderSize)...)
+	buf = marshalWALRecord(buf, mrs, precisionBits)
+	record := buf[walRecordHeaderSize:]
+
+	// Fill in the record header in place.
+	encoding.MarshalUint32(buf[:0], uint32(len(record)))
+	encoding.MarshalUint64(buf[:4], xxhash.Sum64(record))
+	w.buf = buf
+
+	if _, err := w.f.Write(buf); err != nil {
+		w.mu.Unlock()
+		return fmt.Errorf("cannot write %d bytes to WAL segment %q: %w", len(buf), w.f.Name(), err)
+	}
+	w.segmentSize += int64(len(buf))
+	w.writtenRecords++
+	n := w.writtenRecords
+	w.mu.Unlock()
+
+	atomic.AddUint64(&w.bytesWritten, uint64(len(buf)))
+	return w.syncRecords(n)
+}
+
+// syncRecords makes sure that the first n records written to w are synced to disk.
+//
+// The current segment cannot be switched while syncRecords is called from addRows,
+// since the caller holds w.rotateLock in read mode.
+func (w *wal) syncRecords(n uint64) error {
+	w.syncMu.Lock()
+	defer w.syncMu.Unlock()
+
+	if w.syncedRecords >= n {
+		// The records have been already synced by a concurrent goroutine.
+		return nil
+	}
+
+	// Sync all the records written so far, including records from concurrent goroutines waiting for syncMu.
+	w.mu.Lock()
+	f := w.f
+	writtenRecords := w.writtenRecords
+	w.mu.Unlock()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("cannot sync WAL segment %q: %w", f.Name(), err)
+	}
+	w.syncedRecords = writtenRecords
+	atomic.AddUint64(&w.syncsTotal, 1)
+	return nil
+}
+
+// openNextSegment closes the current segment if it is open and opens the next segment for writing.
+//
+// w.mu must be locked by the caller.
+func (w *wal) openNextSegment() error {
+	if w.f != nil {
+		fs.MustClose(w.f)
+		w.closedSegments = append(w.closedSegments, w.f.Name())
+		w.f = nil
+	}
+	w.segmentIdx++
+	path := fmt.Sprintf("%s/%016X", w.path, w.segmentIdx)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot create WAL segment: %w", err)
+	}
+	fs.MustSyncPath(w.path)
+	w.f = f
+	w.segmentSize = 0
+	return nil
+}
+
+// removeClosedSegments removes closed segments from w.
+func (w *wal) removeClosedSegments() {
+	w.mu.Lock()
+	closedSegments := w.closedSegments
+	w.closedSegments = nil
+	w.mu.Unlock()
+
+	if len(closedSegments) == 0 {
+		return
+	}
+	for _, path := range closedSegments {
+		fs.MustRemoveAll(path)
+	}
+	fs.MustSyncPath(w.path)
+}
+
+// mustClose closes w and removes all its segments.
+//
+// It must be called after all the rows are flushed to file parts.
+func (w *wal) mustClose() {
+	w.mu.Lock()
+	if w.f != nil {
+		fs.MustClose(w.f)
+		w.closedSegments = append(w.closedSegments, w.f.Name())
+		w.f = nil
+	}
+	w.mu.Unlock()
+	w.removeClosedSegments()
+}
+
+func (s *Storage) startWALWatcher() {
+	if s.wal == nil {
+		return
+	}
+	s.walWatcherWG.Add(1)
+	go func() {
+		s.walWatcher()
+		s.walWatcherWG.Done()
+	}()
+}
+
+func (s *Storage) walWatcher() {
+	ticker := time.NewTicker(walFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.truncateWAL()
+		}
+	}
+}
+
+// truncateWAL switches WAL to the next segment and removes the previous segments
+// after the rows from them are flushed to file parts.
+func (s *Storage) truncateWAL() {
+	w := s.wal
+	w.rotateLock.Lock()
+	w.mu.Lock()
+	var err error
+	if w.segmentSize > 0 {
+		err = w.openNextSegment()
+	}
+	w.mu.Unlock()
+	w.rotateLock.Unlock()
+	if err != nil {
+		logger.Errorf("cannot switch to the next WAL segment: %s", err)
+		return
+	}
+
+	// All the rows from closed segments are already added to the storage,
+	// so they can be removed after flushing the storage data to files.
+	if !s.flushToFiles() {
+		// The storage is stopped. Closed segments will be removed in Storage.MustClose
+		// after all the data is flushed to files.
+		return
+	}
+	w.removeClosedSegments()
+}
+
+// flushToFiles flushes recently added rows and the corresponding indexdb entries to files.
+//
+// It returns false if the storage is stopped before the flush is complete.
+func (s *Storage) flushToFiles() bool {
+	s.tb.flushRawRows()
+	if !s.tb.flushInmemoryPartsToFiles() {
+		return false
+	}
+	s.idb().tb.DebugFlush()
+	return true
+}
+
+// readWALSegmentNames returns sorted names of WAL segments at the given path.
+func readWALSegmentNames(path string) ([]string, error) {
+	if !fs.IsPathExist(path) {
+		return nil, nil
+	}
+	d, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open WAL directory: %w", err)
+	}
+	defer fs.MustClose(d)
+
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read WAL directory %q: %w", path, err)
+	}
+	var names []string
+	for _, fi := range fis {
+		fn := fi.Name()
+		if !fi.Mode().IsRegular() || len(fn) != 16 || fs.IsTemporaryFileName(fn) {
+			continue
+		}
+		if _, err := strconv.ParseUint(fn, 16, 64); err != nil {
+			logger.Warnf("skipping unexpected file %q in WAL directory", filepath.Join(path, fn))
+			continue
+		}
+		names = append(names, fn)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func mustParseWALSegmentIdx(name string) uint64 {
+	idx, err := strconv.ParseUint(name, 16, 64)
+	if err != nil {
+		logger.Panicf("BUG: unexpected WAL segment name %q: %s", name, err)
+	}
+	return idx
+}
+
+var walRowsReplayed uint64
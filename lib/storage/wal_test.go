@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestMarshalUnmarshalWALRecord(t *testing.T) {
+	f := func(mrs []MetricRow, precisionBits uint8) {
+		t.Helper()
+		data := marshalWALRecord(nil, mrs, precisionBits)
+		mrsNew, precisionBitsNew, err := unmarshalWALRecord(nil, data)
+		if err != nil {
+			t.Fatalf("cannot unmarshal WAL record: %s", err)
+		}
+		if precisionBitsNew != precisionBits {
+			t.Fatalf("unexpected precisionBits; got %d; want %d", precisionBitsNew, precisionBits)
+		}
+		if len(mrsNew) != len(mrs) {
+			t.Fatalf("unexpected number of rows; got %d; want %d", len(mrsNew), len(mrs))
+		}
+		for i := range mrs {
+			if !reflect.DeepEqual(&mrsNew[i], &mrs[i]) {
+				t.Fatalf("unexpected row #%d; got %s; want %s", i, &mrsNew[i], &mrs[i])
+			}
+		}
+
+		// Truncated record must be rejected.
+		if _, _, err := unmarshalWALRecord(nil, data[:len(data)-1]); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling truncated record")
+		}
+	}
+	f(nil, 64)
+	f([]MetricRow{{
+		MetricNameRaw: []byte("foo"),
+		Timestamp:     123,
+		Value:         -4.5,
+	}}, 64)
+	f([]MetricRow{
+		{
+			MetricNameRaw: []byte("foo"),
+			Timestamp:     123,
+			Value:         1,
+		},
+		{
+			MetricNameRaw: []byte("bar"),
+			Timestamp:     -1,
+			Value:         0,
+		},
+	}, 10)
+}
+
+func TestStorageWAL(t *testing.T) {
+	path := "TestStorageWAL"
+	pathReplay := "TestStorageWAL-replay"
+	SetWAL(true)
+	defer SetWAL(false)
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+		if err := os.RemoveAll(pathReplay); err != nil {
+			t.Fatalf("cannot remove %q: %s", pathReplay, err)
+		}
+	}()
+
+	const rowsCount = 1000
+	now := time.Now().UnixNano() / 1e6
+	var mrs []MetricRow
+	for i := 0; i < rowsCount; i++ {
+		var mn MetricName
+		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i%10))
+		mrs = append(mrs, MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     now - int64(i)*1000,
+			Value:         float64(i),
+		})
+	}
+	countRows := func(s *Storage) int {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric_.*"), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		tr := TimeRange{
+			MinTimestamp: now - 2*rowsCount*1000,
+			MaxTimestamp: now + 1000,
+		}
+		var sr Search
+		sr.Init(nil, s, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
+		defer sr.MustClose()
+		var b Block
+		rows := 0
+		for sr.NextMetricBlock() {
+			sr.MetricBlockRef.BlockRef.MustReadBlock(&b, true)
+			if err := b.UnmarshalData(); err != nil {
+				t.Fatalf("cannot unmarshal block: %s", err)
+			}
+			rows += len(b.timestamps)
+		}
+		if err := sr.Error(); err != nil {
+			t.Fatalf("search error: %s", err)
+		}
+		return rows
+	}
+	walSegmentsCount := func(path string) int {
+		t.Helper()
+		names, err := readWALSegmentNames(path + "/" + walDirname)
+		if err != nil {
+			t.Fatalf("cannot read WAL segments: %s", err)
+		}
+		return len(names)
+	}
+
+	s, err := OpenStorage(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+
+	// Simulate unclean shutdown by copying WAL to an empty storage.
+	if err := fs.CopyDirectory(path+"/"+walDirname, pathReplay+"/"+walDirname); err != nil {
+		t.Fatalf("cannot copy WAL: %s", err)
+	}
+
+	// WAL segments must be removed after the rows are flushed to files.
+	s.truncateWAL()
+	if n := walSegmentsCount(path); n != 1 {
+		t.Fatalf("unexpected number of WAL segments after truncation; got %d; want 1", n)
+	}
+	ptws := s.tb.GetPartitions(nil)
+	for _, ptw := range ptws {
+		pws := ptw.pt.GetParts(nil)
+		for _, pw := range pws {
+			if pw.mp != nil {
+				t.Fatalf("unexpected inmemory part after WAL truncation")
+			}
+		}
+		ptw.pt.PutParts(pws)
+	}
+	s.tb.PutPartitions(ptws)
+	s.MustClose()
+	if n := walSegmentsCount(path); n != 0 {
+		t.Fatalf("unexpected number of WAL segments after clean shutdown; got %d; want 0", n)
+	}
+
+	// Append incomplete record to the copied WAL segment. It must be skipped during replay.
+	segmentPaths, err := filepath.Glob(pathReplay + "/" + walDirname + "/*")
+	if err != nil {
+		t.Fatalf("cannot find WAL segments: %s", err)
+	}
+	if len(segmentPaths) != 1 {
+		t.Fatalf("unexpected number of copied WAL segments; got %d; want 1", len(segmentPaths))
+	}
+	f, err := os.OpenFile(segmentPaths[0], os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("cannot open WAL segment: %s", err)
+	}
+	if _, err := f.Write([]byte{0, 0, 1, 0, 1, 2, 3}); err != nil {
+		t.Fatalf("cannot write to WAL segment: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("cannot close WAL segment: %s", err)
+	}
+
+	// The rows must be restored from WAL.
+	s, err = OpenStorage(pathReplay, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer s.MustClose()
+	if n := countRows(s); n != rowsCount {
+		t.Fatalf("unexpected number of rows after WAL replay; got %d; want %d", n, rowsCount)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.WALRowsReplayed < rowsCount {
+		t.Fatalf("unexpected number of replayed rows; got %d; want at least %d", m.WALRowsReplayed, rowsCount)
+	}
+	if n := walSegmentsCount(pathReplay); n != 1 {
+		t.Fatalf("unexpected number of WAL segments after replay; got %d; want 1", n)
+	}
+}
+
+func TestWALSyncRecords(t *testing.T) {
+	path := "TestWALSyncRecords"
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+	if err := fs.MkdirAllIfNotExist(path); err != nil {
+		t.Fatalf("cannot create %q: %s", path, err)
+	}
+	w := &wal{
+		path: path,
+	}
+	if err := w.openNextSegment(); err != nil {
+		t.Fatalf("cannot open WAL segment: %s", err)
+	}
+	defer w.mustClose()
+
+	const workers = 5
+	const addsPerWorker = 20
+	mrs := []MetricRow{{
+		MetricNameRaw: []byte("foo"),
+		Timestamp:     123,
+		Value:         1,
+	}}
+	ch := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := 0; j < addsPerWorker; j++ {
+				w.rotateLock.RLock()
+				err := w.addRows(mrs, defaultPrecisionBits)
+				w.rotateLock.RUnlock()
+				if err != nil {
+					ch <- err
+					return
+				}
+			}
+			ch <- nil
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		if err := <-ch; err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+	}
+	if w.writtenRecords != workers*addsPerWorker {
+		t.Fatalf("unexpected number of written records; got %d; want %d", w.writtenRecords, workers*addsPerWorker)
+	}
+	if w.syncedRecords != w.writtenRecords {
+		t.Fatalf("unexpected number of synced records; got %d; want %d", w.syncedRecords, w.writtenRecords)
+	}
+	syncs := atomic.LoadUint64(&w.syncsTotal)
+	if syncs == 0 || syncs > w.writtenRecords {
+		t.Fatalf("unexpected number of syncs: %d; must be in the range [1..%d]", syncs, w.writtenRecords)
+	}
+
+	// Already synced records mustn't be synced again.
+	if err := w.syncRecords(1); err != nil {
+		t.Fatalf("cannot sync records: %s", err)
+	}
+	if n := atomic.LoadUint64(&w.syncsTotal); n != syncs {
+		t.Fatalf("unexpected number of syncs after syncing already synced records; got %d; want %d", n, syncs)
+	}
+}